@@ -1,20 +1,87 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
 	"filevault/internal/config"
 	"filevault/internal/database"
 )
 
+const usage = `Usage: migrate [command]
+
+Commands:
+  up            apply all pending migrations (default)
+  down [steps]  roll back the last steps applied migrations (default 1)
+  status        list migrations and whether they have been applied`
+
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Run migrations
-	if err := database.Migrate(cfg.DatabaseURL); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+	command := "up"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "up":
+		if err := database.Migrate(cfg.DatabaseURL); err != nil {
+			log.Fatal("Failed to run migrations:", err)
+		}
+		log.Println("Migrations completed successfully!")
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid number of steps %q: must be a positive integer", os.Args[2])
+			}
+			steps = n
+		}
+		if err := database.MigrateDown(cfg.DatabaseURL, steps); err != nil {
+			log.Fatal("Failed to roll back migrations:", err)
+		}
+
+	case "status":
+		states, err := database.MigrationStatus(cfg.DatabaseURL)
+		if err != nil {
+			log.Fatal("Failed to read migration status:", err)
+		}
+		printStatus(states)
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// printStatus writes one line per migration: its version, whether and when it was applied and
+// whether it can be rolled back
+func printStatus(states []database.MigrationState) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tROLLBACK")
+
+	pending := 0
+	for _, state := range states {
+		status, appliedAt, rollback := "pending", "-", "no"
+		if state.Applied {
+			status = "applied"
+			appliedAt = state.AppliedAt.UTC().Format(time.RFC3339)
+		} else {
+			pending++
+		}
+		if state.Reversible {
+			rollback = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", state.Version, status, appliedAt, rollback)
 	}
+	w.Flush()
 
-	log.Println("Migrations completed successfully!")
+	fmt.Printf("\n%d migration(s), %d pending\n", len(states), pending)
 }
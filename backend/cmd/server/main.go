@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"filevault/graph"
 	"filevault/internal/config"
 	"filevault/internal/database"
 	"filevault/internal/handlers"
+	"filevault/internal/middleware"
 	"filevault/internal/models"
 	"filevault/internal/repositories"
 	"filevault/internal/services"
@@ -13,9 +15,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -25,11 +33,6 @@ import (
 	"github.com/google/uuid"
 )
 
-// Define custom type for context key to avoid collisions
-type contextKey string
-
-const userContextKey contextKey = "user"
-
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
@@ -42,8 +45,12 @@ func main() {
 	defer db.Close()
 
 	// Run migrations
-	if err := database.Migrate(cfg.DatabaseURL); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+	if cfg.MigrateOnStart {
+		if err := database.Migrate(cfg.DatabaseURL); err != nil {
+			log.Fatal("Failed to run migrations:", err)
+		}
+	} else {
+		log.Println("MIGRATE_ON_START is off, not applying migrations")
 	}
 
 	// Initialize repositories
@@ -52,9 +59,15 @@ func main() {
 	fileHashRepo := repositories.NewFileHashRepository(db)
 	shareRepo := repositories.NewShareRepository(db)
 	downloadRepo := repositories.NewDownloadRepository(db)
+	uploadMetricsRepo := repositories.NewUploadMetricsRepository(db)
 	fileShareRepo := repositories.NewFileShareRepository(db)
 	userFileShareRepo := repositories.NewUserFileShareRepository(db)
 	folderRepo := repositories.NewFolderRepository(db)
+	notificationRepo := repositories.NewNotificationRepository(db)
+	fileAccessGrantRepo := repositories.NewFileAccessGrantRepository(db)
+	userFolderShareRepo := repositories.NewUserFolderShareRepository(db)
+	systemSettingsRepo := repositories.NewSystemSettingsRepository(db)
+	fileCommentRepo := repositories.NewFileCommentRepository(db)
 
 	// Initialize S3 service
 	log.Printf("DEBUG: Initializing S3Service with AWS Region: %s, Bucket: %s", cfg.AWSRegion, cfg.S3BucketName)
@@ -68,9 +81,21 @@ func main() {
 	} else {
 		log.Printf("DEBUG: AWS Secret Key: %s", cfg.AWSSecretKey)
 	}
+	s3UploadOptions := services.S3UploadOptions{
+		StorageClass:         cfg.S3StorageClass,
+		ServerSideEncryption: cfg.S3ServerSideEncryption,
+		SSEKMSKeyID:          cfg.S3SSEKMSKeyID,
+	}
+	if err := s3UploadOptions.Validate(); err != nil {
+		log.Fatal("Invalid S3 upload configuration:", err)
+	}
 	var s3Service services.S3ServiceInterface
 	var s3ServiceConcrete *services.S3Service
-	s3ServiceConcrete, err = services.NewS3Service(cfg.AWSRegion, cfg.AWSAccessKeyID, cfg.AWSSecretKey, cfg.S3BucketName, cfg.S3BucketURL)
+	s3ServiceConcrete, err = services.NewS3Service(cfg.AWSRegion, cfg.AWSAccessKeyID, cfg.AWSSecretKey, cfg.S3BucketName, cfg.S3BucketURL, s3UploadOptions, services.S3RetryPolicy{
+		MaxAttempts: cfg.S3RetryMaxAttempts,
+		BaseDelay:   time.Duration(cfg.S3RetryBaseDelayMS) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.S3RetryMaxDelayMS) * time.Millisecond,
+	})
 	if err != nil {
 		log.Printf("WARNING: Failed to initialize S3 service (running in local mode): %v", err)
 		log.Printf("WARNING: File upload/download features will not work without S3 configuration")
@@ -88,14 +113,101 @@ func main() {
 	go hub.Run()
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, cfg.JWTSecret)
+	authService := services.NewAuthService(userRepo, cfg.JWTSecret, services.TokenConfig{
+		Expiry:            cfg.JWTExpiry,
+		Issuer:            cfg.JWTIssuer,
+		Audience:          cfg.JWTAudience,
+		AllowLegacyTokens: cfg.JWTAllowLegacyTokens,
+		IdleTimeout:       cfg.SessionIdleTimeout,
+	})
+	authService.SetSessionStore(repositories.NewSessionRepository(db))
+	authService.SetPasswordPolicy(services.PasswordPolicy{
+		MinLength:    cfg.PasswordMinLength,
+		RequireMixed: cfg.PasswordRequireMixed,
+	})
 	mimeValidationService := services.NewMimeValidationService()
-	websocketService := services.NewWebSocketService(hub)
-	fileService := services.NewFileService(fileRepo, fileHashRepo, shareRepo, downloadRepo, s3Service, mimeValidationService, websocketService)
+	notificationService := services.NewNotificationService(notificationRepo)
+	websocketService := services.NewWebSocketService(hub, notificationService)
+	fileService := services.NewFileService(fileRepo, fileHashRepo, shareRepo, downloadRepo, s3Service, mimeValidationService, websocketService, folderRepo)
+	duplicateUploadMode, err := services.ParseDuplicateUploadMode(cfg.DuplicateUploadMode)
+	if err != nil {
+		log.Fatal("Invalid duplicate upload configuration:", err)
+	}
+	fileService.SetDuplicateUploadMode(duplicateUploadMode)
+	dedupScope, err := services.ParseDedupScope(cfg.DedupScope)
+	if err != nil {
+		log.Fatal("Invalid deduplication configuration:", err)
+	}
+	fileService.SetDedupScope(dedupScope)
+	fileService.SetDedupPreferences(userRepo)
+	systemSettingsService := services.NewSystemSettingsService(systemSettingsRepo, 0)
+	fileService.SetUploadGate(systemSettingsService)
+	fileService.SetUploadMetrics(uploadMetricsRepo)
+	var uploadIdempotencyRepo *repositories.UploadIdempotencyRepository
+	if cfg.UploadIdempotencyTTL > 0 {
+		uploadIdempotencyRepo = repositories.NewUploadIdempotencyRepository(db)
+		fileService.SetIdempotencyStore(uploadIdempotencyRepo, cfg.UploadIdempotencyTTL)
+	}
+	fileService.SetArchiveLimits(services.ArchiveLimits{
+		MaxCompressionRatio:  cfg.ArchiveMaxCompressionRatio,
+		MaxUncompressedBytes: cfg.ArchiveMaxUncompressedMB << 20,
+	})
+	processingService := services.NewProcessingService(fileRepo, websocketService, cfg.ProcessingWorkers, cfg.ProcessingQueueSize)
+	if cfg.PerceptualHashEnabled && s3Service != nil {
+		processingService.AddTask(services.NewPerceptualHashTask(services.NewPerceptualHashService(), s3Service, fileRepo))
+	}
+	thumbnailSizes, err := services.ParseThumbnailSizes(cfg.ThumbnailSizes)
+	if err != nil {
+		log.Fatal("Invalid THUMBNAIL_SIZES:", err)
+	}
+	var thumbnailService *services.ThumbnailService
+	if s3Service != nil {
+		thumbnailService = services.NewThumbnailService(s3Service, repositories.NewThumbnailRepository(db), thumbnailSizes)
+		processingService.AddTask(services.NewThumbnailTask(thumbnailService))
+		fileService.SetThumbnailService(thumbnailService)
+	}
+	fileService.SetProcessingService(processingService)
 	quotaService := services.NewQuotaService(fileRepo, cfg.StorageQuotaMB)
+	roleQuotas, err := services.ParseRoleQuotas(cfg.RoleQuotas)
+	if err != nil {
+		log.Fatal("Invalid role quota configuration:", err)
+	}
+	quotaService.SetRoleQuotas(userRepo, roleQuotas)
+	fileService.SetQuotaChecker(quotaService)
 	searchService := services.NewSearchService(fileRepo)
-	adminService := services.NewAdminService(userRepo, fileRepo, fileHashRepo, s3ServiceConcrete, websocketService)
+	adminService := services.NewAdminService(userRepo, fileRepo, fileHashRepo, fileShareRepo, uploadMetricsRepo, s3ServiceConcrete, websocketService)
+	adminService.SetStorageCostPerGBMonth(cfg.StorageCostPerGBMonth)
+	adminService.SetDownloadLogRetention(cfg.DownloadLogRetentionDays)
+	if uploadIdempotencyRepo != nil {
+		adminService.SetUploadIdempotencyPruning(uploadIdempotencyRepo, cfg.UploadIdempotencyTTL)
+	}
 	folderService := services.NewFolderService(folderRepo)
+	folderService.SetMaxFolderDepth(cfg.MaxFolderDepth)
+	defaultFolders, err := services.ParseDefaultFolders(cfg.DefaultFolders, cfg.MaxFolderDepth)
+	if err != nil {
+		log.Fatal("Invalid DEFAULT_FOLDERS:", err)
+	}
+	fileAccessService := services.NewFileAccessService(fileAccessGrantRepo, fileRepo, userRepo)
+	commentService := services.NewCommentService(fileCommentRepo, fileRepo, fileAccessService, userFileShareRepo, websocketService)
+	emailService := services.NewEmailService(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	authService.SetDefaultFolders(folderService, defaultFolders)
+	lockoutPolicy := services.LoginLockoutPolicy{
+		MaxFailures: cfg.LoginMaxFailedAttempts,
+		Window:      time.Duration(cfg.LoginLockoutMinutes) * time.Minute,
+		Notify:      cfg.LoginLockoutNotify,
+	}
+	var lockoutEmail services.EmailSender
+	if emailService != nil {
+		lockoutEmail = emailService
+	}
+	authService.SetLoginLockout(lockoutPolicy, websocketService, lockoutEmail)
+	shareExpiryService := services.NewShareExpiryService(
+		fileShareRepo,
+		userRepo,
+		websocketService,
+		emailService,
+		time.Duration(cfg.ShareExpiryCheckIntervalMinutes)*time.Minute,
+	)
 
 	// Initialize file share service with S3 configuration
 	log.Printf("DEBUG: Initializing FileShareService with AWS Region: %s, Bucket: %s, BaseURL: %s", cfg.AWSRegion, cfg.S3BucketName, cfg.BaseURL)
@@ -104,46 +216,152 @@ func main() {
 		userFileShareRepo,
 		fileRepo,
 		userRepo,
+		userFolderShareRepo,
+		folderRepo,
 		cfg.AWSRegion,
 		cfg.AWSAccessKeyID,
 		cfg.AWSSecretKey,
 		cfg.S3BucketName,
 		cfg.BaseURL,
 		websocketService,
+		shareExpiryService,
+		time.Duration(cfg.ShareURLMaxExpiryHours)*time.Hour,
 	)
 	if err != nil {
 		log.Fatal("Failed to initialize file share service:", err)
 	}
 	log.Printf("DEBUG: FileShareService initialized successfully")
+	commentService.SetFolderShareChecker(fileShareService)
+	shareURLMode, err := services.ParseShareURLMode(cfg.ShareURLMode)
+	if err != nil {
+		log.Fatal("Invalid share URL configuration:", err)
+	}
+	fileShareService.SetShareURLMode(shareURLMode)
+	if cfg.CDNDomain != "" {
+		cdnKey, err := os.ReadFile(cfg.CDNPrivateKeyPath)
+		if err != nil {
+			log.Fatal("Failed to read CDN_PRIVATE_KEY_PATH:", err)
+		}
+		cdnService, err := services.NewCDNService(cfg.CDNDomain, cfg.CDNKeyPairID, cdnKey)
+		if err != nil {
+			log.Fatal("Invalid CDN configuration:", err)
+		}
+		fileShareService.SetCDN(cdnService)
+		log.Printf("Direct share links are served through the CDN at %s", cfg.CDNDomain)
+	}
+	downloadVerifyMaxSize := cfg.DownloadVerifyMaxSizeMB * 1024 * 1024
+	fileShareService.SetDownloadVerification(downloadVerifyMaxSize)
+	if emailService != nil {
+		fileShareService.SetEmailSender(emailService)
+	}
+	previewPolicy, err := services.ParsePreviewPolicy(cfg.PreviewableMimeTypes)
+	if err != nil {
+		log.Fatal("Invalid PREVIEWABLE_MIME_TYPES:", err)
+	}
+	fileShareService.SetPreviewPolicy(previewPolicy)
+
+	// Start background processing of uploads, resuming any interrupted by a restart
+	processingService.Start()
+
+	// Start background job that warns owners about expiring shares
+	shareExpiryService.Start()
+	defer shareExpiryService.Stop()
+
+	// Start daily job that rolls up download logs past their retention
+	stopDataCleanup := adminService.StartDataCleanup(24 * time.Hour)
+	defer stopDataCleanup()
 
 	// Create simple GraphQL server
 	log.Printf("DEBUG: Creating GraphQL server with FileShareService and FolderService")
-	graphqlServer := graph.NewSimpleGraphQLServer(authService, fileService, searchService, adminService, fileShareService, folderService)
+	graphqlServer := graph.NewSimpleGraphQLServer(authService, fileService, searchService, adminService, fileShareService, folderService, notificationService, fileAccessService, systemSettingsService, quotaService, commentService, graph.QueryLimits{
+		MaxDepth:          cfg.GraphQLMaxDepth,
+		MaxFields:         cfg.GraphQLMaxFields,
+		MaxTopLevelFields: cfg.GraphQLMaxTopLevelFields,
+	})
 	log.Printf("DEBUG: GraphQL server created successfully")
 
 	// Setup Gin router
 	r := gin.Default()
 
+	// Only configured proxies may set the client IP that rate limits and logs go by; gin would
+	// otherwise take X-Forwarded-For from anyone
+	trustedProxies, err := cfg.GetTrustedProxies()
+	if err != nil {
+		log.Fatal("Invalid trusted proxy configuration:", err)
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Failed to set trusted proxies:", err)
+	}
+
+	// Count in-flight requests so shutdown can report how many it drained
+	inFlight := middleware.NewInFlightCounter()
+	r.Use(inFlight.Middleware())
+
+	// Tag every request with an ID for log correlation
+	r.Use(middleware.RequestIDMiddleware())
+
+	// Cancel hung S3 calls once a request runs past its deadline. Routes that stream file
+	// bodies, the WebSocket and the long admin scans only end when the client goes away.
+	r.Use(middleware.RequestTimeout(cfg.RequestTimeout,
+		"/api/upload",
+		"/api/files/export.csv",
+		"/files/:id/download",
+		"/files/:id/preview",
+		"/public/files/:id",
+		"/api/files/share/:token",
+		"/api/user-shares/:id/download",
+		"/api/ws",
+		"/api/admin/files/:id/verify",
+		"/api/admin/orphans",
+		"/api/admin/orphans/purge",
+		"/api/admin/cleanup",
+		"/api/admin/files/redetect-mime",
+	))
+
+	// Security headers on every response; inline previews relax them below
+	r.Use(middleware.SecurityHeadersMiddleware())
+
 	// CORS configuration
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://127.0.0.1:3000", "https://file-vault-balkan-id.vercel.app"},
+	allowedOrigins, err := cfg.GetCORSAllowedOrigins()
+	if err != nil {
+		log.Fatal("Invalid CORS configuration:", err)
+	}
+	log.Printf("CORS allowed origins: %s", strings.Join(allowedOrigins, ", "))
+
+	publicShareOrigins, err := cfg.GetPublicShareCORSOrigins()
+	if err != nil {
+		log.Fatal("Invalid public share CORS configuration:", err)
+	}
+	if publicShareOrigins == nil {
+		log.Printf("Public share CORS allowed origins: *")
+	} else {
+		log.Printf("Public share CORS allowed origins: %s", strings.Join(publicShareOrigins, ", "))
+	}
+
+	appCORS := cors.New(cors.Config{
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH", "HEAD"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Cache-Control"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Cache-Control", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "Idempotency-Key", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Authorization", "Content-Disposition", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600, // 12 hours
-	}))
+	})
+	// Public share links get their own credential-free policy; everything else stays locked down
+	r.Use(middleware.ScopedCORS(appCORS, middleware.PublicCORS(publicShareOrigins), middleware.PublicSharePathPrefixes))
 
 	// Auth middleware for protected routes
 	authMiddleware := graph.AuthMiddleware(authService)
 
+	// Rejects non-UUID :id path parameters with a 400 before the route's handler runs
+	validID := middleware.ValidateUUIDParams("id")
+
 	// API group for protected routes
 	api := r.Group("/api")
 	api.Use(authMiddleware)
 
 	// GraphQL playground (only in development)
 	if os.Getenv("GIN_MODE") != "release" {
-		r.GET("/", gin.WrapH(playground.Handler("GraphQL playground", "/query")))
+		r.GET("/", middleware.AllowScripts(), gin.WrapH(playground.Handler("GraphQL playground", "/query")))
 	}
 
 	// GraphQL endpoint (no auth middleware - handled internally)
@@ -153,55 +371,90 @@ func main() {
 		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
 			if user, err := authService.ValidateToken(token); err == nil {
-				// Set user in both request context and Gin context
-				ctx := context.WithValue(c.Request.Context(), userContextKey, user)
-				c.Request = c.Request.WithContext(ctx)
-				c.Set("user", user) // Also set in Gin context for GraphQL server
+				middleware.SetUser(c, user)
 			}
 		}
+		// Resolvers such as loginUser report where a request came from
+		c.Request = c.Request.WithContext(middleware.WithClientIP(c.Request.Context(), c.ClientIP()))
 		graphqlServer.HandleGraphQL(c)
 	})
 
+	// uploadResponse describes a completed upload, including whether its content was deduplicated
+	uploadResponse := func(upload *services.UploadResult) gin.H {
+		response := gin.H{
+			"file":         upload.File,
+			"deduplicated": upload.Deduplicated,
+			"existingFile": upload.ExistingFile,
+			"bytesSaved":   upload.BytesSaved,
+			"dedup":        !upload.File.DedupDisabled,
+		}
+		if upload.Replayed {
+			response["replayed"] = true
+		}
+		if upload.Deduplicated {
+			response["message"] = fmt.Sprintf("Deduplicated, saved %d bytes", upload.BytesSaved)
+		}
+		return response
+	}
+
+	// uploadErrorStatus maps an upload error to the HTTP status reported for it
+	uploadErrorStatus := func(err error) int {
+		switch {
+		case errors.Is(err, services.ErrUploadsDisabled):
+			return 503
+		case errors.Is(err, services.ErrQuotaExceeded):
+			return 413
+		case errors.Is(err, services.ErrArchiveRejected):
+			return 422
+		case errors.Is(err, services.ErrUploadInProgress):
+			return 409
+		default:
+			return 500
+		}
+	}
+
+	// uploadBatchFile uploads one file of a batch. The file service checks the quota per file
+	// against usage that already includes the batch's earlier files, so the batch as a whole
+	// stays within it.
+	uploadBatchFile := func(ctx context.Context, header *multipart.FileHeader, userID uuid.UUID, folderID *uuid.UUID, opts services.UploadOptions) (*services.UploadResult, error) {
+		file, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		defer file.Close()
+
+		return fileService.UploadFileWithOptions(ctx, file, header, userID, folderID, opts)
+	}
+
 	// File upload endpoint with detailed debug statements
 	api.POST("/upload", func(c *gin.Context) {
 
 		// Get user from context
-		user, exists := c.Get("user")
-		if !exists {
-			fmt.Println("ERROR: No user found in context")
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
+		fmt.Printf("DEBUG: User authenticated: %s (%s)\n", userModel.Username, userModel.ID)
 
-		userModel, ok := user.(*models.User)
-		if !ok {
-			fmt.Println("ERROR: Invalid user data in context")
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+		// Refuse before reading the body while uploads are paused
+		if !systemSettingsService.UploadsEnabled() {
+			c.JSON(503, gin.H{"error": services.ErrUploadsDisabled.Error()})
 			return
 		}
-		fmt.Printf("DEBUG: User authenticated: %s (%s)\n", userModel.Username, userModel.ID)
 
 		// Parse multipart form
 		fmt.Println("DEBUG: Parsing multipart form...")
-		err := c.Request.ParseMultipartForm(100 << 20) // 100 MB max
+		// Files beyond the memory limit are spilled to temp files, removed once the upload is done
+		err := c.Request.ParseMultipartForm(cfg.UploadMemoryLimitMB << 20)
 		if err != nil {
 			fmt.Printf("ERROR: Failed to parse multipart form: %v\n", err)
 			c.JSON(400, gin.H{"error": "Failed to parse form data"})
 			return
 		}
+		defer c.Request.MultipartForm.RemoveAll()
 		fmt.Println("DEBUG: Multipart form parsed successfully")
 
-		// Get file from form
-		file, header, err := c.Request.FormFile("file")
-		if err != nil {
-			fmt.Printf("ERROR: No file provided or failed to get file: %v\n", err)
-			c.JSON(400, gin.H{"error": "No file provided"})
-			return
-		}
-		defer file.Close()
-		fmt.Printf("DEBUG: File received - Name: %s, Size: %d, Content-Type: %s\n",
-			header.Filename, header.Size, header.Header.Get("Content-Type"))
-
 		// Get folder_id from form (optional)
 		var folderID *uuid.UUID
 		if folderIDStr := c.PostForm("folder_id"); folderIDStr != "" {
@@ -216,32 +469,93 @@ func main() {
 			fmt.Println("DEBUG: No folder ID provided, uploading to root")
 		}
 
+		// Deduplication is on unless the client asks for a private copy with dedup=false
+		opts := services.UploadOptions{}
+		if dedupStr := c.PostForm("dedup"); dedupStr != "" {
+			dedup, err := strconv.ParseBool(dedupStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "dedup must be true or false"})
+				return
+			}
+			opts.DisableDedup = !dedup
+		}
+
+		// A retried request repeating an Idempotency-Key gets the file the first one created
+		opts.IdempotencyKey = strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if len(opts.IdempotencyKey) > 255 {
+			c.JSON(400, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		// Several files sent as files[] parts are uploaded one by one, each getting its own result
+		if batch := c.Request.MultipartForm.File["files[]"]; len(batch) > 0 {
+			if opts.IdempotencyKey != "" {
+				c.JSON(400, gin.H{"error": "Idempotency-Key is only supported for single-file uploads"})
+				return
+			}
+			if len(batch) > cfg.UploadMaxBatchFiles {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("At most %d files can be uploaded at once", cfg.UploadMaxBatchFiles)})
+				return
+			}
+
+			results := make([]gin.H, 0, len(batch))
+			uploaded := 0
+			for _, header := range batch {
+				result := gin.H{"filename": header.Filename, "success": false}
+				upload, err := uploadBatchFile(c.Request.Context(), header, userModel.ID, folderID, opts)
+				if err != nil {
+					fmt.Printf("ERROR: Batch upload of %s failed: %v\n", header.Filename, err)
+					result["error"] = err.Error()
+					result["status"] = uploadErrorStatus(err)
+				} else {
+					for key, value := range uploadResponse(upload) {
+						result[key] = value
+					}
+					result["success"] = true
+					uploaded++
+				}
+				results = append(results, result)
+			}
+
+			c.JSON(200, gin.H{
+				"results":  results,
+				"uploaded": uploaded,
+				"failed":   len(batch) - uploaded,
+			})
+			return
+		}
+
+		// Get file from form
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			fmt.Printf("ERROR: No file provided or failed to get file: %v\n", err)
+			c.JSON(400, gin.H{"error": "No file provided"})
+			return
+		}
+		defer file.Close()
+		fmt.Printf("DEBUG: File received - Name: %s, Size: %d, Content-Type: %s\n",
+			header.Filename, header.Size, header.Header.Get("Content-Type"))
+
 		// Upload file using service
 		fmt.Println("DEBUG: Calling FileService.UploadFile...")
-		uploadedFile, err := fileService.UploadFile(file, header, userModel.ID, folderID)
+		upload, err := fileService.UploadFileWithOptions(c.Request.Context(), file, header, userModel.ID, folderID, opts)
 		if err != nil {
 			fmt.Printf("ERROR: FileService.UploadFile failed: %v\n", err)
-			c.JSON(500, gin.H{"error": err.Error()})
+			c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		fmt.Printf("DEBUG: File uploaded successfully: %s\n", uploadedFile.ID)
+		fmt.Printf("DEBUG: File uploaded successfully: %s\n", upload.File.ID)
 
 		fmt.Println("=== UPLOAD ENDPOINT DEBUG END (SUCCESS) ===")
-		c.JSON(200, gin.H{"file": uploadedFile})
+		c.JSON(200, uploadResponse(upload))
 	})
 
 	// Simple file listing endpoint
 	r.GET("/files", authMiddleware, func(c *gin.Context) {
 		// Get user from context
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		userModel, ok := user.(*models.User)
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -258,55 +572,96 @@ func main() {
 		})
 	})
 
-	// File preview endpoint (serves file for inline viewing)
-	r.GET("/files/:id/preview", func(c *gin.Context) {
-		fileID := c.Param("id")
+	// authenticateViewer validates the token of a request for inline content, taken from the
+	// token query parameter (for <img> and <video> tags) or the Authorization header
+	authenticateViewer := func(c *gin.Context) (*models.User, bool) {
 		token := c.Query("token")
-
-		var user *models.User
-		var err error
-
-		// Validate token if provided
-		if token != "" {
-			// Parse and validate JWT token
-			user, err = authService.ValidateToken(token)
-			if err != nil {
-				c.JSON(401, gin.H{"error": "Invalid token"})
-				return
-			}
-		} else {
+		if token == "" {
 			// No token provided, try to get from Authorization header
 			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
 				c.JSON(401, gin.H{"error": "Authentication required"})
-				return
+				return nil, false
 			}
 
 			// Extract token from "Bearer <token>"
 			tokenParts := strings.Split(authHeader, " ")
 			if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
 				c.JSON(401, gin.H{"error": "Invalid authorization header"})
-				return
+				return nil, false
 			}
+			token = tokenParts[1]
+		}
 
-			// Parse and validate JWT token
-			user, err = authService.ValidateToken(tokenParts[1])
-			if err != nil {
-				c.JSON(401, gin.H{"error": "Invalid token"})
-				return
-			}
+		// Parse and validate JWT token
+		user, err := authService.ValidateToken(token)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid token"})
+			return nil, false
+		}
+		return user, true
+	}
+
+	// canViewFile checks that the user owns the file or can read it through a shared folder or
+	// an access grant, writing a 403 if not
+	canViewFile := func(c *gin.Context, user *models.User, file *models.File) bool {
+		if file.UploaderID == user.ID {
+			return true
+		}
+		hasAccess, err := fileShareService.CanAccessFileViaFolderShare(user.ID, file.ID)
+		if err == nil && !hasAccess {
+			hasAccess, err = fileAccessService.HasAccess(user.ID, file.ID, models.FilePermissionView)
+		}
+		if err != nil || !hasAccess {
+			c.JSON(403, gin.H{"error": "Access denied"})
+			return false
+		}
+		return true
+	}
+
+	// File preview endpoint (serves file for inline viewing)
+	r.GET("/files/:id/preview", middleware.PreviewSecurityHeaders(allowedOrigins), validID, func(c *gin.Context) {
+		fileID, ok := middleware.UUIDParam(c, "id")
+		if !ok {
+			return
+		}
+
+		user, ok := authenticateViewer(c)
+		if !ok {
+			return
 		}
 
 		// Get file from database
-		file, err := fileRepo.GetByID(uuid.MustParse(fileID))
+		file, err := fileRepo.GetByID(fileID)
 		if err != nil {
 			c.JSON(404, gin.H{"error": "File not found"})
 			return
 		}
 
-		// Check if user owns the file
-		if file.UploaderID != user.ID {
-			c.JSON(403, gin.H{"error": "Access denied"})
+		if !canViewFile(c, user, file) {
+			return
+		}
+
+		// Types outside the preview allowlist are only ever sent as attachments; clients asking
+		// for JSON get an explanation instead of the file
+		if !previewPolicy.Allows(file.MimeType) && strings.Contains(c.GetHeader("Accept"), "application/json") {
+			c.JSON(415, gin.H{
+				"error":       services.PreviewUnsupportedMessage(file.MimeType),
+				"previewable": false,
+				"downloadUrl": fmt.Sprintf("/files/%s/download", file.ID),
+			})
+			return
+		}
+
+		if err := fileService.RecordAccess(user.ID, file.ID, models.FileAccessPreview); err != nil {
+			log.Printf("Failed to record preview of file %s: %v", file.ID, err)
+		}
+
+		// Stored files never change, so a cached copy with a matching ETag is still current
+		services.SetFileValidators(c.Writer.Header(), file)
+		if services.NotModified(c.Request, file) {
+			c.Header("Cache-Control", "public, max-age=3600")
+			c.Status(304)
 			return
 		}
 
@@ -317,9 +672,7 @@ func main() {
 			localFilePath := filepath.Join(cfg.UploadPath, file.Filename)
 			if _, err := os.Stat(localFilePath); err == nil {
 				// Set headers for inline viewing
-				c.Header("Content-Type", file.MimeType)
-				c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", file.OriginalName))
-				c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
+				services.SetFilePreviewHeaders(c.Writer.Header(), file, previewPolicy)
 				c.File(localFilePath)
 				return
 			} else {
@@ -329,7 +682,7 @@ func main() {
 		}
 
 		// Download file from S3 and serve it directly for preview
-		result, err := s3Service.GetClient().GetObject(c.Request.Context(), &s3.GetObjectInput{
+		result, err := s3Service.GetObject(c.Request.Context(), &s3.GetObjectInput{
 			Bucket: aws.String(cfg.S3BucketName),
 			Key:    aws.String(s3Key),
 		})
@@ -340,42 +693,158 @@ func main() {
 		defer result.Body.Close()
 
 		// Set appropriate headers for inline viewing
-		c.Header("Content-Type", file.MimeType)
-		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", file.OriginalName))
-		c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
+		services.SetFilePreviewHeaders(c.Writer.Header(), file, previewPolicy)
 		c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
 
 		// Stream the file content
 		io.Copy(c.Writer, result.Body)
 	})
 
-	// Simple file download endpoint
-	r.GET("/files/:id/download", authMiddleware, func(c *gin.Context) {
-		fileID := c.Param("id")
+	// Thumbnail endpoint: a scaled-down copy of an image file, generated on first request
+	r.GET("/files/:id/thumbnail", validID, func(c *gin.Context) {
+		if thumbnailService == nil {
+			c.JSON(503, gin.H{"error": "Thumbnails are not available"})
+			return
+		}
 
-		// Get file from database
-		file, err := fileRepo.GetByID(uuid.MustParse(fileID))
+		user, ok := authenticateViewer(c)
+		if !ok {
+			return
+		}
+
+		fileID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid file ID"})
+			return
+		}
+
+		size := thumbnailService.Sizes()[0]
+		if raw := c.Query("size"); raw != "" {
+			size, err = strconv.Atoi(raw)
+			if err != nil || !thumbnailService.AllowsSize(size) {
+				c.JSON(400, gin.H{
+					"error":        "Unsupported thumbnail size",
+					"allowedSizes": thumbnailService.Sizes(),
+				})
+				return
+			}
+		}
+
+		file, err := fileRepo.GetByID(fileID)
 		if err != nil {
 			c.JSON(404, gin.H{"error": "File not found"})
 			return
 		}
 
+		if !canViewFile(c, user, file) {
+			return
+		}
+
+		thumb, err := thumbnailService.Get(c.Request.Context(), file, size)
+		if errors.Is(err, services.ErrThumbnailUnsupported) {
+			c.JSON(415, gin.H{"error": "Thumbnails are not available for this file type"})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get thumbnail of file %s: %v", file.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to generate thumbnail"})
+			return
+		}
+
+		// Thumbnails are keyed by content, so a cached copy with a matching ETag is still current
+		c.Header("ETag", services.ThumbnailETag(thumb))
+		c.Header("Cache-Control", "private, max-age=86400")
+		if services.ThumbnailNotModified(c.Request, thumb) {
+			c.Status(304)
+			return
+		}
+
+		body, err := thumbnailService.Open(c.Request.Context(), thumb)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to load thumbnail"})
+			return
+		}
+		defer body.Close()
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(200, thumb.ByteSize, thumb.ContentType, body, nil)
+	})
+
+	// authorizeFileDownload loads the requested file and checks that the current user may
+	// download it, writing the error response and returning ok=false if not
+	authorizeFileDownload := func(c *gin.Context) (file *models.File, userModel *models.User, ok bool) {
+		fileID, ok := middleware.UUIDParam(c, "id")
+		if !ok {
+			return nil, nil, false
+		}
+
+		// Get file from database
+		file, err := fileRepo.GetByID(fileID)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "File not found"})
+			return nil, nil, false
+		}
+
 		// Get user from context
-		user, exists := c.Get("user")
-		if !exists {
+		userModel, ok = middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return nil, nil, false
+		}
+
+		// Check if user owns the file or can read it through a shared folder or an access grant
+		if file.UploaderID != userModel.ID {
+			hasAccess, err := fileShareService.CanAccessFileViaFolderShare(userModel.ID, file.ID)
+			if err == nil && !hasAccess {
+				hasAccess, err = fileAccessService.HasAccess(userModel.ID, file.ID, models.FilePermissionDownload)
+			}
+			if err != nil || !hasAccess {
+				c.JSON(403, gin.H{"error": "Access denied"})
+				return nil, nil, false
+			}
+		}
+
+		return file, userModel, true
+	}
+
+	// Download headers without the body, for clients that check the size and type first
+	r.HEAD("/files/:id/download", authMiddleware, func(c *gin.Context) {
+		file, _, ok := authorizeFileDownload(c)
+		if !ok {
+			return
+		}
+
+		if file.S3Key == "" {
+			if _, err := os.Stat(filepath.Join(cfg.UploadPath, file.Filename)); err != nil {
+				c.JSON(404, gin.H{"error": "File not found on storage"})
+				return
+			}
+		}
+
+		services.SetFileValidators(c.Writer.Header(), file)
+		if services.NotModified(c.Request, file) {
+			c.Status(304)
 			return
 		}
 
-		userModel, ok := user.(*models.User)
+		services.SetFileDownloadHeaders(c.Writer.Header(), file)
+		c.Status(200)
+	})
+
+	// Simple file download endpoint
+	r.GET("/files/:id/download", authMiddleware, validID, func(c *gin.Context) {
+		file, userModel, ok := authorizeFileDownload(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
 			return
 		}
 
-		// Check if user owns the file
-		if file.UploaderID != userModel.ID {
-			c.JSON(403, gin.H{"error": "Access denied"})
+		if err := fileService.RecordAccess(userModel.ID, file.ID, models.FileAccessDownload); err != nil {
+			log.Printf("Failed to record download of file %s: %v", file.ID, err)
+		}
+
+		services.SetFileValidators(c.Writer.Header(), file)
+		if services.NotModified(c.Request, file) {
+			c.Status(304)
 			return
 		}
 
@@ -393,45 +862,45 @@ func main() {
 			}
 		}
 
-		// Download file from S3 and serve it directly
-		result, err := s3Service.GetClient().GetObject(c.Request.Context(), &s3.GetObjectInput{
-			Bucket: aws.String(cfg.S3BucketName),
-			Key:    aws.String(s3Key),
-		})
+		// Download file from S3 and serve it directly, resuming from the requested range if any
+		download, err := services.GetObjectForDownload(c.Request.Context(), s3Service, cfg.S3BucketName, s3Key, file.Size, c.GetHeader("Range"), services.FileIfRange(c.GetHeader("If-Range"), file))
 		if err != nil {
+			if errors.Is(err, services.ErrRangeNotSatisfiable) {
+				c.Header("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+				c.JSON(416, gin.H{"error": "Requested range not satisfiable"})
+				return
+			}
 			c.JSON(500, gin.H{"error": "Failed to download file from S3"})
 			return
 		}
-		defer result.Body.Close()
+		services.VerifyDownload(download, file, downloadVerifyMaxSize)
+		defer download.Body.Close()
 
 		// Set appropriate headers
-		c.Header("Content-Type", file.MimeType)
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
-		c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
+		services.SetFileDownloadHeaders(c.Writer.Header(), file)
+		download.SetHeaders(c.Writer.Header())
 
 		// Stream the file content
-		io.Copy(c.Writer, result.Body)
+		c.Status(download.StatusCode)
+		io.Copy(c.Writer, download.Body)
 	})
 
 	// Simple file deletion endpoint
-	r.DELETE("/files/:id", authMiddleware, func(c *gin.Context) {
-		fileID := c.Param("id")
-
-		// Get user from context
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
+	r.DELETE("/files/:id", authMiddleware, validID, func(c *gin.Context) {
+		fileID, ok := middleware.UUIDParam(c, "id")
+		if !ok {
 			return
 		}
 
-		userModel, ok := user.(*models.User)
+		// Get user from context
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
 		// Use the file service to delete the file (handles S3 cleanup)
-		if err := fileService.DeleteFile(uuid.MustParse(fileID), userModel.ID); err != nil {
+		if err := fileService.DeleteFile(c.Request.Context(), fileID, userModel.ID); err != nil {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete file: %v", err)})
 			return
 		}
@@ -442,15 +911,9 @@ func main() {
 	// Quota info endpoint
 	r.GET("/quota", authMiddleware, func(c *gin.Context) {
 		// Get user from context
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		userModel, ok := user.(*models.User)
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -470,21 +933,52 @@ func main() {
 	r.GET("/api/ws", wsHandler.HandleWebSocket)
 	api.GET("/ws/status", wsHandler.GetConnectionStatus)
 
+	// Anonymous share routes are limited per client IP, with separate budgets for viewing share
+	// details and downloading. One store backs both; a shared store would go here for
+	// multi-instance deployments.
+	shareRateLimitStore := middleware.NewMemoryRateLimitStore()
+	var shareViewLimiter, shareDownloadLimiter *middleware.RateLimiter
+	if cfg.PublicShareViewRateLimit > 0 {
+		shareViewLimiter = middleware.NewRateLimiterWithStore(shareRateLimitStore, cfg.PublicShareViewRateLimit, time.Minute)
+	}
+	if cfg.PublicShareDownloadRateLimit > 0 {
+		shareDownloadLimiter = middleware.NewRateLimiterWithStore(shareRateLimitStore, cfg.PublicShareDownloadRateLimit, time.Minute)
+	}
+
 	// File sharing routes
-	handlers.RegisterFileShareRoutes(r, fileShareService, authMiddleware)
+	handlers.RegisterFileShareRoutes(r, fileShareService, authMiddleware, graph.OptionalAuthMiddleware(authService), shareViewLimiter, shareDownloadLimiter)
 
-	// User file sharing routes
-	api.POST("/files/:id/share/user", func(c *gin.Context) {
-		fileID := c.Param("id")
-		user, exists := c.Get("user")
-		if !exists {
+	// Spreadsheet of all the user's files, streamed as it is read from the database
+	api.GET("/files/export.csv", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
-		userModel, ok := user.(*models.User)
+		filename := fmt.Sprintf("filevault-files-%s.csv", time.Now().UTC().Format("20060102-150405"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", services.ContentDisposition("attachment", filename))
+		c.Header("Cache-Control", "no-store")
+
+		if err := fileService.ExportFilesCSV(userModel.ID, c.Writer); err != nil {
+			fmt.Printf("ERROR: File export for user %s failed: %v\n", userModel.ID, err)
+			if !c.Writer.Written() {
+				c.Header("Content-Type", "")
+				c.Header("Content-Disposition", "")
+				c.JSON(500, gin.H{"error": "Failed to export files"})
+			}
+			// Once rows have been sent the status can't change; the truncated download is all we can do
+			return
+		}
+	})
+
+	// User file sharing routes
+	api.POST("/files/:id/share/user", validID, func(c *gin.Context) {
+		fileID := c.Param("id")
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -513,17 +1007,40 @@ func main() {
 		c.JSON(200, gin.H{"share": share})
 	})
 
-	// Get incoming shares
-	api.GET("/user-shares/incoming", func(c *gin.Context) {
-		user, exists := c.Get("user")
-		if !exists {
+	// Email a share link for a file, also sharing in-app if the address belongs to a user
+	api.POST("/files/:id/share/email", validID, func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
-		userModel, ok := user.(*models.User)
+		var req models.ShareByEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		fileUUID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid file ID"})
+			return
+		}
+
+		result, err := fileShareService.ShareByEmail(userModel.ID, fileUUID, req.Email, req.Message)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, result)
+	})
+
+	// Get incoming shares
+	api.GET("/user-shares/incoming", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -541,15 +1058,9 @@ func main() {
 
 	// Get outgoing shares
 	api.GET("/user-shares/outgoing", func(c *gin.Context) {
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		userModel, ok := user.(*models.User)
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -566,17 +1077,11 @@ func main() {
 	})
 
 	// Mark share as read
-	api.PUT("/user-shares/:id/read", func(c *gin.Context) {
+	api.PUT("/user-shares/:id/read", validID, func(c *gin.Context) {
 		shareID := c.Param("id")
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		userModel, ok := user.(*models.User)
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -597,15 +1102,9 @@ func main() {
 
 	// Get unread share count
 	api.GET("/user-shares/unread-count", func(c *gin.Context) {
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		userModel, ok := user.(*models.User)
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -619,17 +1118,11 @@ func main() {
 	})
 
 	// Delete user file share
-	api.DELETE("/user-shares/:id", func(c *gin.Context) {
+	api.DELETE("/user-shares/:id", validID, func(c *gin.Context) {
 		shareID := c.Param("id")
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			return
-		}
-
-		userModel, ok := user.(*models.User)
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
@@ -648,103 +1141,281 @@ func main() {
 		c.JSON(200, gin.H{"message": "Share deleted"})
 	})
 
-	// Get all users for sharing
-	api.GET("/users", func(c *gin.Context) {
-		user, exists := c.Get("user")
-		if !exists {
+	// User folder sharing routes
+	api.POST("/folders/:id/share/user", validID, func(c *gin.Context) {
+		folderID := c.Param("id")
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
-		userModel, ok := user.(*models.User)
+		var req models.CreateUserFolderShareRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Parse folder ID from URL
+		folderUUID, err := uuid.Parse(folderID)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid folder ID"})
+			return
+		}
+
+		// Share folder with user
+		share, err := fileShareService.ShareFolderWithUser(userModel.ID, folderUUID, req.ToUserID, req.Message)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"share": share})
+	})
+
+	// Get folders shared with the current user
+	api.GET("/folder-shares/incoming", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Invalid user data"})
+			c.JSON(401, gin.H{"error": "Unauthorized"})
 			return
 		}
 
-		// Get all users except current user
-		users, err := userRepo.GetAllUsers(100, 0)
+		shares, err := fileShareService.GetSharedFolders(userModel.ID)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Filter out current user
-		var otherUsers []*models.User
-		for _, u := range users {
-			if u.ID != userModel.ID {
-				otherUsers = append(otherUsers, u)
-			}
+		c.JSON(200, gin.H{"shares": shares})
+	})
+
+	// Export admin dashboard stats as a CSV or JSON download
+	api.GET("/admin/report", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
 		}
 
-		c.JSON(200, gin.H{"users": otherUsers})
+		isAdmin, err := adminService.IsAdmin(userModel.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check admin status"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(403, gin.H{"error": "Admin privileges required"})
+			return
+		}
+
+		format := strings.ToLower(c.DefaultQuery("format", services.ReportFormatCSV))
+		if format != services.ReportFormatCSV && format != services.ReportFormatJSON {
+			c.JSON(400, gin.H{"error": "format must be csv or json"})
+			return
+		}
+
+		report, err := adminService.ExportStatsReport(format)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		contentType := "text/csv; charset=utf-8"
+		if format == services.ReportFormatJSON {
+			contentType = "application/json"
+		}
+		filename := fmt.Sprintf("filevault-report-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+		c.Header("Content-Disposition", services.ContentDisposition("attachment", filename))
+		c.Data(200, contentType, report)
 	})
 
-	// Public file sharing endpoint with proper headers
-	r.GET("/public/:id", func(c *gin.Context) {
-		fileID := c.Param("id")
+	// Re-download a file's S3 object and compare it with the size and hash recorded at upload
+	api.POST("/admin/files/:id/verify", validID, func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
 
-		// Parse UUID
-		parsedID, err := uuid.Parse(fileID)
+		isAdmin, err := adminService.IsAdmin(userModel.ID)
 		if err != nil {
-			c.JSON(400, gin.H{"error": "Invalid file ID format"})
+			c.JSON(500, gin.H{"error": "Failed to check admin status"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(403, gin.H{"error": "Admin privileges required"})
 			return
 		}
 
-		// Get file from database
-		file, err := fileRepo.GetByID(parsedID)
+		fileID, err := uuid.Parse(c.Param("id"))
 		if err != nil {
-			c.JSON(404, gin.H{"error": "File not found"})
+			c.JSON(400, gin.H{"error": "Invalid file ID"})
 			return
 		}
 
-		// Set CORS headers for public access
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+		report, err := adminService.VerifyFileIntegrity(c.Request.Context(), fileID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Check if file has S3 key (new files) or use filename (legacy files)
-		s3Key := file.S3Key
-		if s3Key == "" {
-			// Legacy file without S3 key, try local file
-			localFilePath := filepath.Join(cfg.UploadPath, file.Filename)
-			if _, err := os.Stat(localFilePath); err == nil {
-				// Set headers for download with original filename
-				c.Header("Content-Type", file.MimeType)
-				c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
-				c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
-				c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
-				c.File(localFilePath)
-				return
-			} else {
-				c.JSON(404, gin.H{"error": "File not found on storage"})
+		c.JSON(200, report)
+	})
+
+	// Report S3 objects with no database reference and file hashes whose S3 object is gone
+	api.GET("/admin/orphans", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		isAdmin, err := adminService.IsAdmin(userModel.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check admin status"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(403, gin.H{"error": "Admin privileges required"})
+			return
+		}
+
+		report, err := adminService.FindOrphans(c.Request.Context())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, report)
+	})
+
+	// Delete orphaned S3 objects and dangling file hashes. Defaults to a dry run unless dryRun=false.
+	api.POST("/admin/orphans/purge", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		isAdmin, err := adminService.IsAdmin(userModel.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check admin status"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(403, gin.H{"error": "Admin privileges required"})
+			return
+		}
+
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "true"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "dryRun must be true or false"})
+			return
+		}
+
+		result, err := adminService.PurgeOrphans(c.Request.Context(), dryRun)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, result)
+	})
+
+	// Run the retention cleanup now instead of waiting for the daily job
+	api.POST("/admin/cleanup", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		isAdmin, err := adminService.IsAdmin(userModel.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check admin status"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(403, gin.H{"error": "Admin privileges required"})
+			return
+		}
+
+		result, err := adminService.CleanupExpiredData(c.Request.Context())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, result)
+	})
+
+	// Re-detect MIME types of files uploaded before content sniffing, correcting mislabelled ones
+	api.POST("/admin/files/redetect-mime", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		isAdmin, err := adminService.IsAdmin(userModel.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check admin status"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(403, gin.H{"error": "Admin privileges required"})
+			return
+		}
+
+		limit := 0
+		if limitStr := c.Query("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 0 {
+				c.JSON(400, gin.H{"error": "limit must be a non-negative integer"})
 				return
 			}
 		}
 
-		// Download file from S3 and serve it with proper headers
-		result, err := s3Service.GetClient().GetObject(c.Request.Context(), &s3.GetObjectInput{
-			Bucket: aws.String(cfg.S3BucketName),
-			Key:    aws.String(s3Key),
-		})
+		updated, err := adminService.RedetectMimeTypes(c.Request.Context(), limit)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to download file from S3"})
+			c.JSON(500, gin.H{"error": err.Error(), "updated": updated})
 			return
 		}
-		defer result.Body.Close()
 
-		// Set appropriate headers for download with original filename
-		c.Header("Content-Type", file.MimeType)
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
-		c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
-		c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+		c.JSON(200, gin.H{"updated": updated})
+	})
 
-		// Stream the file content
-		io.Copy(c.Writer, result.Body)
+	// Get all users for sharing
+	api.GET("/users", func(c *gin.Context) {
+		userModel, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		// Get all users except current user
+		users, err := userRepo.GetAllUsers(100, 0)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Filter out current user
+		var otherUsers []*models.User
+		for _, u := range users {
+			if u.ID != userModel.ID {
+				otherUsers = append(otherUsers, u)
+			}
+		}
+
+		c.JSON(200, gin.H{"users": otherUsers})
 	})
 
+	// Public files; the old /public/:id links redirect to /public/files/:id
+	handlers.RegisterPublicFileRoutes(r, handlers.NewPublicFileHandler(fileRepo, s3Service, cfg.S3BucketName, fileService), shareDownloadLimiter)
+
 	// Download shared file endpoint
-	r.GET("/api/user-shares/:id/download", authMiddleware, func(c *gin.Context) {
+	r.GET("/api/user-shares/:id/download", authMiddleware, validID, func(c *gin.Context) {
 		shareID := c.Param("id")
 
 		// Parse UUID
@@ -755,12 +1426,11 @@ func main() {
 		}
 
 		// Get user from context
-		user, exists := c.Get("user")
-		if !exists {
+		userObj, ok := middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(401, gin.H{"error": "User not authenticated"})
 			return
 		}
-		userObj := user.(*models.User)
 
 		// Get share from database
 		share, err := userFileShareRepo.GetByID(parsedID)
@@ -782,6 +1452,12 @@ func main() {
 			return
 		}
 
+		services.SetFileValidators(c.Writer.Header(), file)
+		if services.NotModified(c.Request, file) {
+			c.Status(304)
+			return
+		}
+
 		// Check if file has S3 key (new files) or use filename (legacy files)
 		s3Key := file.S3Key
 		if s3Key == "" {
@@ -790,7 +1466,7 @@ func main() {
 			if _, err := os.Stat(localFilePath); err == nil {
 				// Set headers for download with original filename
 				c.Header("Content-Type", file.MimeType)
-				c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
+				c.Header("Content-Disposition", services.ContentDisposition("attachment", services.DownloadFilename(file)))
 				c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
 				c.File(localFilePath)
 				return
@@ -800,24 +1476,28 @@ func main() {
 			}
 		}
 
-		// Download file from S3 and serve it with proper headers
-		result, err := s3Service.GetClient().GetObject(c.Request.Context(), &s3.GetObjectInput{
-			Bucket: aws.String(cfg.S3BucketName),
-			Key:    aws.String(s3Key),
-		})
+		// Download file from S3 and serve it with proper headers, resuming from the requested range if any
+		download, err := services.GetObjectForDownload(c.Request.Context(), s3Service, cfg.S3BucketName, s3Key, file.Size, c.GetHeader("Range"), services.FileIfRange(c.GetHeader("If-Range"), file))
 		if err != nil {
+			if errors.Is(err, services.ErrRangeNotSatisfiable) {
+				c.Header("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+				c.JSON(416, gin.H{"error": "Requested range not satisfiable"})
+				return
+			}
 			c.JSON(500, gin.H{"error": "Failed to download file from S3"})
 			return
 		}
-		defer result.Body.Close()
+		services.VerifyDownload(download, file, downloadVerifyMaxSize)
+		defer download.Body.Close()
 
 		// Set appropriate headers for download with original filename
 		c.Header("Content-Type", file.MimeType)
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.OriginalName))
-		c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
+		c.Header("Content-Disposition", services.ContentDisposition("attachment", services.DownloadFilename(file)))
+		download.SetHeaders(c.Writer.Header())
 
 		// Stream the file content
-		io.Copy(c.Writer, result.Body)
+		c.Status(download.StatusCode)
+		io.Copy(c.Writer, download.Body)
 	})
 
 	// Health check endpoint
@@ -831,7 +1511,49 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	log.Println("DEBUG: Server started with updated code")
-	log.Fatal(r.Run(":" + port))
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		log.Println("DEBUG: Server started with updated code")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Server failed:", err)
+		}
+	}()
+
+	// On termination, stop accepting connections and let in-flight requests (uploads in
+	// particular) finish, then tell WebSocket clients when to reconnect and close them cleanly.
+	// Returning from main runs the deferred shutdown of background jobs and the database pool.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+
+	draining := inFlight.Active()
+	log.Printf("Received %s, draining %d in-flight request(s) (timeout %s)", sig, draining, cfg.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown did not finish: %v", err)
+	}
+	remaining := inFlight.Active()
+	log.Printf("Drained %d request(s), %d still in flight", max(draining-remaining, 0), remaining)
+
+	hubCtx, hubCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer hubCancel()
+	if err := hub.Shutdown(hubCtx); err != nil {
+		log.Printf("WebSocket hub shutdown did not finish: %v", err)
+	}
+
+	// Unfinished processing stays pending and resumes on the next start
+	processingCtx, processingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer processingCancel()
+	if err := processingService.Stop(processingCtx); err != nil {
+		log.Printf("Upload processing did not stop in time: %v", err)
+	}
+
+	log.Println("Server stopped, closing database connections")
 }
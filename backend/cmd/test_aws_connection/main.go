@@ -19,7 +19,11 @@ func main() {
 	fmt.Printf("Access Key ID: %s...\n", cfg.AWSAccessKeyID[:10])
 
 	// Initialize S3 service
-	s3Service, err := services.NewS3Service(cfg.AWSRegion, cfg.AWSAccessKeyID, cfg.AWSSecretKey, cfg.S3BucketName, cfg.S3BucketURL)
+	s3Service, err := services.NewS3Service(cfg.AWSRegion, cfg.AWSAccessKeyID, cfg.AWSSecretKey, cfg.S3BucketName, cfg.S3BucketURL, services.S3UploadOptions{
+		StorageClass:         cfg.S3StorageClass,
+		ServerSideEncryption: cfg.S3ServerSideEncryption,
+		SSEKMSKeyID:          cfg.S3SSEKMSKeyID,
+	}, services.DefaultS3RetryPolicy())
 	if err != nil {
 		log.Fatalf("Failed to initialize S3 service: %v", err)
 	}
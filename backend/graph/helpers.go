@@ -1,5 +1,12 @@
 package graph
 
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
 // Helper functions for extracting values from variables
 func getStringPtr(variables map[string]interface{}, key string) *string {
 	if val, ok := variables[key]; ok {
@@ -12,17 +19,39 @@ func getStringPtr(variables map[string]interface{}, key string) *string {
 
 func getIntPtr(variables map[string]interface{}, key string) *int {
 	if val, ok := variables[key]; ok {
-		if i, ok := val.(int); ok {
-			return &i
-		}
-		if f, ok := val.(float64); ok {
-			i := int(f)
+		if i, ok := toInt(val); ok {
 			return &i
 		}
 	}
 	return nil
 }
 
+// toInt coerces a decoded variable to an Int. encoding/json decodes numbers as float64 (or
+// json.Number with UseNumber), and some clients send numbers as strings; values with a
+// fractional part or outside the int range are rejected as GraphQL Int coercion requires.
+func toInt(val interface{}) (int, bool) {
+	switch v := val.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) || v > math.MaxInt || v < math.MinInt {
+			return 0, false
+		}
+		return int(v), true
+	case json.Number:
+		i, err := strconv.Atoi(v.String())
+		return i, err == nil
+	case string:
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		return i, err == nil
+	}
+	return 0, false
+}
+
 func getBoolPtr(variables map[string]interface{}, key string) *bool {
 	if val, ok := variables[key]; ok {
 		if b, ok := val.(bool); ok {
@@ -57,14 +86,5 @@ func getString(variables map[string]interface{}, key string) string {
 }
 
 func getInt(variables map[string]interface{}, key string) *int {
-	if val, ok := variables[key]; ok {
-		if i, ok := val.(int); ok {
-			return &i
-		}
-		if f, ok := val.(float64); ok {
-			i := int(f)
-			return &i
-		}
-	}
-	return nil
+	return getIntPtr(variables, key)
 }
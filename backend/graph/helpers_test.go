@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetIntPtr_DecodedJSONVariables(t *testing.T) {
+	var variables map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"limit": 50, "offset": 0}`), &variables))
+	require.IsType(t, float64(0), variables["limit"])
+
+	limit := getIntPtr(variables, "limit")
+	require.NotNil(t, limit)
+	assert.Equal(t, 50, *limit)
+
+	offset := getInt(variables, "offset")
+	require.NotNil(t, offset)
+	assert.Equal(t, 0, *offset)
+}
+
+func TestGetIntPtr_CoercesNumberTypes(t *testing.T) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(`{"limit": 25}`)))
+	decoder.UseNumber()
+	var numbers map[string]interface{}
+	require.NoError(t, decoder.Decode(&numbers))
+
+	variables := map[string]interface{}{
+		"float":      float64(50),
+		"number":     numbers["limit"],
+		"string":     " 75 ",
+		"int":        5,
+		"fractional": 2.5,
+		"text":       "ten",
+		"bool":       true,
+	}
+
+	tests := []struct {
+		key  string
+		want *int
+	}{
+		{"float", intPtr(50)},
+		{"number", intPtr(25)},
+		{"string", intPtr(75)},
+		{"int", intPtr(5)},
+		{"fractional", nil},
+		{"text", nil},
+		{"bool", nil},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, getIntPtr(variables, tt.key))
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql/introspection"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// maxIntrospectionValues bounds the size of an introspection result. Selections can nest
+// fields { type { fields ... } } arbitrarily, multiplying the output at every level; the
+// standard introspection query stays well below this.
+const maxIntrospectionValues = 100_000
+
+// introspectionTypeNames are the __typename values of the introspection types
+var introspectionTypeNames = map[reflect.Type]string{
+	reflect.TypeOf(introspection.Schema{}):     "__Schema",
+	reflect.TypeOf(introspection.Type{}):       "__Type",
+	reflect.TypeOf(introspection.Field{}):      "__Field",
+	reflect.TypeOf(introspection.InputValue{}): "__InputValue",
+	reflect.TypeOf(introspection.EnumValue{}):  "__EnumValue",
+	reflect.TypeOf(introspection.Directive{}):  "__Directive",
+}
+
+// introspector answers __schema and __type selections from the schema requests are validated
+// against, so client tooling (GraphiQL, code generators) sees the same API the server accepts
+type introspector struct {
+	variables map[string]interface{}
+	values    int
+}
+
+// introspectSchema resolves a __schema field
+func introspectSchema(field *ast.Field, variables map[string]interface{}) (interface{}, error) {
+	in := &introspector{variables: variables}
+	return in.resolve(reflect.ValueOf(introspection.WrapSchema(parsedSchema)), field.SelectionSet)
+}
+
+// introspectType resolves a __type(name:) field, which is null for unknown types
+func introspectType(field *ast.Field, variables map[string]interface{}) (interface{}, error) {
+	name, _ := field.ArgumentMap(variables)["name"].(string)
+	def := parsedSchema.Types[name]
+	if def == nil {
+		return nil, nil
+	}
+	in := &introspector{variables: variables}
+	return in.resolve(reflect.ValueOf(introspection.WrapTypeFromDef(parsedSchema, def)), field.SelectionSet)
+}
+
+// resolve converts an introspection value to JSON-ready data, keeping only the selected fields
+func (in *introspector) resolve(value reflect.Value, selections ast.SelectionSet) (interface{}, error) {
+	in.values++
+	if in.values > maxIntrospectionValues {
+		return nil, fmt.Errorf("introspection result exceeds %d values", maxIntrospectionValues)
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return in.resolve(value.Elem(), selections)
+	case reflect.Slice:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			item, err := in.resolve(value.Index(i), selections)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Struct:
+		// Methods of the introspection types have pointer receivers
+		if !value.CanAddr() {
+			copied := reflect.New(value.Type()).Elem()
+			copied.Set(value)
+			value = copied
+		}
+		result := make(map[string]interface{})
+		if err := in.resolveFields(value.Addr(), selections, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		return value.Interface(), nil
+	}
+}
+
+// resolveFields fills result with the selected fields of an introspection object, expanding
+// fragments (every fragment on an introspection type applies to it)
+func (in *introspector) resolveFields(object reflect.Value, selections ast.SelectionSet, result map[string]interface{}) error {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if sel.Name == "__typename" {
+				result[sel.Alias] = introspectionTypeNames[object.Elem().Type()]
+				continue
+			}
+			value, err := in.lookup(object, sel)
+			if err != nil {
+				return err
+			}
+			resolved, err := in.resolve(value, sel.SelectionSet)
+			if err != nil {
+				return err
+			}
+			result[sel.Alias] = resolved
+		case *ast.InlineFragment:
+			if err := in.resolveFields(object, sel.SelectionSet, result); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			if sel.Definition == nil {
+				return fmt.Errorf("unknown fragment %q", sel.Name)
+			}
+			if err := in.resolveFields(object, sel.Definition.SelectionSet, result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup reads a field of an introspection object from the method or struct field of the same
+// name. The only argument any of these methods takes is includeDeprecated.
+func (in *introspector) lookup(object reflect.Value, field *ast.Field) (reflect.Value, error) {
+	name := exportedName(field.Name)
+
+	if method := object.MethodByName(name); method.IsValid() {
+		var args []reflect.Value
+		if method.Type().NumIn() == 1 {
+			includeDeprecated, _ := field.ArgumentMap(in.variables)["includeDeprecated"].(bool)
+			args = append(args, reflect.ValueOf(includeDeprecated))
+		}
+		return method.Call(args)[0], nil
+	}
+
+	if value := object.Elem().FieldByName(name); value.IsValid() {
+		return value, nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot introspect field %q", field.Name)
+}
+
+// exportedName turns a GraphQL field name such as specifiedByURL into its Go name
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
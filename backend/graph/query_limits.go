@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// QueryLimits bounds the size of an operation before it is executed.
+// Zero values fall back to the defaults.
+type QueryLimits struct {
+	MaxDepth          int
+	MaxFields         int
+	MaxTopLevelFields int
+}
+
+// DefaultQueryLimits returns limits generous enough for the frontend's queries
+func DefaultQueryLimits() QueryLimits {
+	return QueryLimits{
+		MaxDepth:          10,
+		MaxFields:         200,
+		MaxTopLevelFields: 20,
+	}
+}
+
+// withDefaults fills in any unset limit
+func (l QueryLimits) withDefaults() QueryLimits {
+	defaults := DefaultQueryLimits()
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = defaults.MaxDepth
+	}
+	if l.MaxFields <= 0 {
+		l.MaxFields = defaults.MaxFields
+	}
+	if l.MaxTopLevelFields <= 0 {
+		l.MaxTopLevelFields = defaults.MaxTopLevelFields
+	}
+	return l
+}
+
+// maxIntrospectionDepth bounds how deeply __schema and __type selections may nest. They're
+// answered from the static schema rather than by resolvers, so they don't count toward the
+// query limits, but the standard introspection query nests ofType well past MaxDepth.
+const maxIntrospectionDepth = 16
+
+// queryAnalyzer walks a parsed document, expanding fragments, and stops as soon as a
+// limit is exceeded so that abusive documents are rejected without being fully expanded
+type queryAnalyzer struct {
+	doc    *ast.QueryDocument
+	limits QueryLimits
+	fields int
+	// fragments being expanded on the current path, to reject cycles
+	expanding map[string]bool
+}
+
+// checkQueryLimits rejects documents whose operations nest too deeply, select too many
+// fields in total, or have too many top-level selections (each one is a resolver call)
+func checkQueryLimits(doc *ast.QueryDocument, limits QueryLimits) error {
+	a := &queryAnalyzer{
+		doc:       doc,
+		limits:    limits.withDefaults(),
+		expanding: make(map[string]bool),
+	}
+
+	for _, op := range doc.Operations {
+		topLevel, err := a.countTopLevel(op.SelectionSet)
+		if err != nil {
+			return err
+		}
+		if topLevel > a.limits.MaxTopLevelFields {
+			return fmt.Errorf("query has %d top-level fields, exceeding the maximum of %d", topLevel, a.limits.MaxTopLevelFields)
+		}
+
+		if err := a.walk(op.SelectionSet, 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countTopLevel counts the fields of an operation's root selection set, looking through fragments
+func (a *queryAnalyzer) countTopLevel(set ast.SelectionSet) (int, error) {
+	count := 0
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			count++
+		case *ast.InlineFragment:
+			n, err := a.countTopLevel(sel.SelectionSet)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		case *ast.FragmentSpread:
+			fragment, err := a.enterFragment(sel.Name)
+			if err != nil {
+				return 0, err
+			}
+			n, err := a.countTopLevel(fragment.SelectionSet)
+			delete(a.expanding, sel.Name)
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		}
+		if count > a.limits.MaxTopLevelFields {
+			return count, nil
+		}
+	}
+	return count, nil
+}
+
+// walk counts fields and checks the depth of a selection set whose fields sit at depth
+func (a *queryAnalyzer) walk(set ast.SelectionSet, depth int) error {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if depth > a.limits.MaxDepth {
+				return fmt.Errorf("query depth exceeds the maximum of %d", a.limits.MaxDepth)
+			}
+			if sel.Name == "__schema" || sel.Name == "__type" {
+				if err := a.walkIntrospection(sel.SelectionSet, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			a.fields++
+			if a.fields > a.limits.MaxFields {
+				return fmt.Errorf("query selects more than the maximum of %d fields", a.limits.MaxFields)
+			}
+			if err := a.walk(sel.SelectionSet, depth+1); err != nil {
+				return err
+			}
+		case *ast.InlineFragment:
+			if err := a.walk(sel.SelectionSet, depth); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			fragment, err := a.enterFragment(sel.Name)
+			if err != nil {
+				return err
+			}
+			err = a.walk(fragment.SelectionSet, depth)
+			delete(a.expanding, sel.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkIntrospection checks the depth of a selection set inside __schema or __type
+func (a *queryAnalyzer) walkIntrospection(set ast.SelectionSet, depth int) error {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if depth > maxIntrospectionDepth {
+				return fmt.Errorf("introspection query depth exceeds the maximum of %d", maxIntrospectionDepth)
+			}
+			if err := a.walkIntrospection(sel.SelectionSet, depth+1); err != nil {
+				return err
+			}
+		case *ast.InlineFragment:
+			if err := a.walkIntrospection(sel.SelectionSet, depth); err != nil {
+				return err
+			}
+		case *ast.FragmentSpread:
+			fragment, err := a.enterFragment(sel.Name)
+			if err != nil {
+				return err
+			}
+			err = a.walkIntrospection(fragment.SelectionSet, depth)
+			delete(a.expanding, sel.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enterFragment looks up a named fragment and marks it as being expanded
+func (a *queryAnalyzer) enterFragment(name string) (*ast.FragmentDefinition, error) {
+	fragment := a.doc.Fragments.ForName(name)
+	if fragment == nil {
+		return nil, fmt.Errorf("unknown fragment %q", name)
+	}
+	if a.expanding[name] {
+		return nil, fmt.Errorf("fragment %q spreads itself", name)
+	}
+	a.expanding[name] = true
+	return fragment, nil
+}
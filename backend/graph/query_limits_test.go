@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+func parseTestQuery(t *testing.T, query string) *ast.QueryDocument {
+	t.Helper()
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	require.NoError(t, err)
+	return doc
+}
+
+// nestedQuery builds { me { a { a { ... } } } } with the given number of levels
+func nestedQuery(levels int) string {
+	return "{ me " + strings.Repeat("{ a ", levels-1) + "{ id }" + strings.Repeat(" }", levels-1) + " }"
+}
+
+func TestCheckQueryLimits_AllowsNormalQuery(t *testing.T) {
+	doc := parseTestQuery(t, `
+		query Dashboard($limit: Int) {
+			me { id email username }
+			files(limit: $limit) { id originalName size uploader { id username } }
+			unreadNotificationCount
+		}
+	`)
+
+	assert.NoError(t, checkQueryLimits(doc, DefaultQueryLimits()))
+}
+
+func TestCheckQueryLimits_RejectsDeepNesting(t *testing.T) {
+	doc := parseTestQuery(t, nestedQuery(50))
+
+	err := checkQueryLimits(doc, DefaultQueryLimits())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "depth")
+}
+
+func TestCheckQueryLimits_RejectsTooManyFields(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("{ files { ")
+	for i := 0; i < 300; i++ {
+		b.WriteString("f")
+		b.WriteString(strings.Repeat("x", i%5+1))
+		b.WriteString(": id ")
+	}
+	b.WriteString("} }")
+
+	err := checkQueryLimits(parseTestQuery(t, b.String()), DefaultQueryLimits())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fields")
+}
+
+func TestCheckQueryLimits_RejectsTooManyTopLevelAliases(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("{ ")
+	for i := 0; i < 25; i++ {
+		b.WriteString("m")
+		b.WriteString(strings.Repeat("e", i+1))
+		b.WriteString(": me { id } ")
+	}
+	b.WriteString("}")
+
+	err := checkQueryLimits(parseTestQuery(t, b.String()), DefaultQueryLimits())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "top-level")
+}
+
+func TestCheckQueryLimits_ExpandsFragments(t *testing.T) {
+	// Each fragment doubles the fields of the one before it
+	query := `
+		{ files { ...F5 } }
+		fragment F0 on File { id originalName }
+		fragment F1 on File { ...F0 a: uploader { ...F0 } }
+		fragment F2 on File { ...F1 b: uploader { ...F1 } }
+		fragment F3 on File { ...F2 c: uploader { ...F2 } }
+		fragment F4 on File { ...F3 d: uploader { ...F3 } }
+		fragment F5 on File { ...F4 e: uploader { ...F4 } }
+	`
+
+	err := checkQueryLimits(parseTestQuery(t, query), QueryLimits{MaxDepth: 20, MaxFields: 50})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fields")
+}
+
+func TestCheckQueryLimits_RejectsFragmentCycles(t *testing.T) {
+	query := `
+		{ files { ...A } }
+		fragment A on File { id ...B }
+		fragment B on File { size ...A }
+	`
+
+	assert.Error(t, checkQueryLimits(parseTestQuery(t, query), DefaultQueryLimits()))
+}
+
+func TestHandleGraphQL_RejectsAbusiveQueryBeforeExecution(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := &SimpleGraphQLServer{resolver: &Resolver{}, limits: DefaultQueryLimits()}
+
+	post := func(query string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(GraphQLRequest{Query: query})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		server.HandleGraphQL(c)
+		return w
+	}
+
+	w := post(nestedQuery(50))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "depth")
+
+	w = post("{ me { id } }")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"me":null}}`, w.Body.String())
+}
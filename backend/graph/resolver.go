@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"filevault/internal/middleware"
 	"filevault/internal/models"
 	"filevault/internal/services"
 
@@ -16,30 +17,40 @@ import (
 
 // Resolver handles GraphQL queries and mutations
 type Resolver struct {
-	AuthService      *services.AuthService
-	FileService      *services.FileService
-	SearchService    *services.SearchService
-	AdminService     *services.AdminService
-	FileShareService *services.FileShareService
-	FolderService    *services.FolderService
+	AuthService         *services.AuthService
+	FileService         *services.FileService
+	SearchService       *services.SearchService
+	AdminService        *services.AdminService
+	FileShareService    *services.FileShareService
+	FolderService       *services.FolderService
+	NotificationService *services.NotificationService
+	FileAccessService   *services.FileAccessService
+	SettingsService     *services.SystemSettingsService
+	QuotaService        *services.QuotaService
+	CommentService      *services.CommentService
 }
 
 // NewResolver creates a new GraphQL resolver with all required services
-func NewResolver(authService *services.AuthService, fileService *services.FileService, searchService *services.SearchService, adminService *services.AdminService, fileShareService *services.FileShareService, folderService *services.FolderService) *Resolver {
+func NewResolver(authService *services.AuthService, fileService *services.FileService, searchService *services.SearchService, adminService *services.AdminService, fileShareService *services.FileShareService, folderService *services.FolderService, notificationService *services.NotificationService, fileAccessService *services.FileAccessService, settingsService *services.SystemSettingsService, quotaService *services.QuotaService, commentService *services.CommentService) *Resolver {
 	return &Resolver{
-		AuthService:      authService,
-		FileService:      fileService,
-		SearchService:    searchService,
-		AdminService:     adminService,
-		FileShareService: fileShareService,
-		FolderService:    folderService,
+		AuthService:         authService,
+		FileService:         fileService,
+		SearchService:       searchService,
+		AdminService:        adminService,
+		FileShareService:    fileShareService,
+		FolderService:       folderService,
+		NotificationService: notificationService,
+		FileAccessService:   fileAccessService,
+		SettingsService:     settingsService,
+		QuotaService:        quotaService,
+		CommentService:      commentService,
 	}
 }
 
 // getCurrentUser extracts the current authenticated user from context
 func (r *Resolver) getCurrentUser(ctx context.Context) (*models.User, error) {
-	user, ok := ctx.Value("user").(*models.User)
-	if !ok || user == nil {
+	user, ok := middleware.UserFromContext(ctx)
+	if !ok {
 		return nil, fmt.Errorf("user not authenticated")
 	}
 	return user, nil
@@ -50,8 +61,56 @@ func (r *Resolver) Me(ctx context.Context) (*models.User, error) {
 	return r.getCurrentUser(ctx)
 }
 
-// Files returns files for the current user
-func (r *Resolver) Files(ctx context.Context, limit *int, offset *int) ([]*models.File, error) {
+// Dashboard assembles the dashboard's initial data in one call. Like separate queries, each
+// part degrades to empty or zero on its own if fetching it fails.
+func (r *Resolver) Dashboard(ctx context.Context, recentLimit *int) (*models.Dashboard, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard := &models.Dashboard{
+		Me:          user,
+		FileStats:   map[string]interface{}{},
+		Folders:     []*models.Folder{},
+		RecentFiles: []*models.File{},
+	}
+
+	if stats, err := r.FileStats(ctx); err != nil {
+		fmt.Printf("ERROR: Dashboard file stats failed: %v\n", err)
+	} else if stats != nil {
+		dashboard.FileStats = stats
+	}
+
+	if folders, err := r.Folders(ctx); err != nil {
+		fmt.Printf("ERROR: Dashboard folders failed: %v\n", err)
+	} else if folders != nil {
+		dashboard.Folders = folders
+	}
+
+	if files, err := r.RecentFiles(ctx, recentLimit); err != nil {
+		fmt.Printf("ERROR: Dashboard recent files failed: %v\n", err)
+	} else if files != nil {
+		dashboard.RecentFiles = files
+	}
+
+	if count, err := r.FileShareService.GetUnreadShareCount(user.ID); err != nil {
+		fmt.Printf("ERROR: Dashboard unread share count failed: %v\n", err)
+	} else {
+		dashboard.UnreadShareCount = count
+	}
+
+	if count, err := r.UnreadNotificationCount(ctx); err != nil {
+		fmt.Printf("ERROR: Dashboard unread notification count failed: %v\n", err)
+	} else {
+		dashboard.UnreadNotificationCount = count
+	}
+
+	return dashboard, nil
+}
+
+// Files returns files for the current user, newest first unless sortBy/sortOrder choose otherwise
+func (r *Resolver) Files(ctx context.Context, limit *int, offset *int, sortBy *string, sortOrder *string, rootOnly *bool) ([]*models.File, error) {
 	fmt.Printf("=== GRAPHQL FILES QUERY DEBUG START ===\n")
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
@@ -71,20 +130,92 @@ func (r *Resolver) Files(ctx context.Context, limit *int, offset *int) ([]*model
 
 	fmt.Printf("DEBUG: Getting files for user: %s, limit: %d, offset: %d\n", user.ID, limitVal, offsetVal)
 
-	// Get files for the user
-	files, err := r.FileService.GetFilesByUserID(user.ID, limitVal, offsetVal)
+	var sortByVal, sortOrderVal string
+	if sortBy != nil {
+		sortByVal = *sortBy
+	}
+	if sortOrder != nil {
+		sortOrderVal = *sortOrder
+	}
+
+	// Get files for the user; rootOnly leaves out files inside folders
+	var files []*models.File
+	if rootOnly != nil && *rootOnly {
+		files, err = r.FileService.GetRootFilesByUserIDSorted(user.ID, sortByVal, sortOrderVal, limitVal, offsetVal)
+	} else {
+		files, err = r.FileService.GetFilesByUserIDSorted(user.ID, sortByVal, sortOrderVal, limitVal, offsetVal)
+	}
 	if err != nil {
 		fmt.Printf("ERROR: Failed to get files: %v\n", err)
 		return nil, err
 	}
 
+	r.attachShareCounts(files)
+
 	fmt.Printf("SUCCESS: Retrieved %d files\n", len(files))
 	fmt.Printf("=== GRAPHQL FILES QUERY DEBUG END ===\n")
 	return files, nil
 }
 
+// Default and maximum page sizes for cursor-paginated file listings
+const (
+	defaultFilesPageLimit = 20
+	maxFilesPageLimit     = 100
+)
+
+// FilesPage returns a cursor-paginated page of the current user's files, newest first.
+// Unlike Files it stays stable when files are added or deleted between page loads.
+func (r *Resolver) FilesPage(ctx context.Context, limit *int, after *string) (*models.FilePage, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limitVal := defaultFilesPageLimit
+	if limit != nil && *limit > 0 {
+		limitVal = *limit
+	}
+	if limitVal > maxFilesPageLimit {
+		limitVal = maxFilesPageLimit
+	}
+
+	afterVal := ""
+	if after != nil {
+		afterVal = *after
+	}
+
+	page, err := r.FileService.GetFilesPageByUserID(user.ID, afterVal, limitVal)
+	if err != nil {
+		return nil, err
+	}
+
+	r.attachShareCounts(page.Files)
+	return page, nil
+}
+
+// RecentFiles returns the files the current user most recently previewed or downloaded
+func (r *Resolver) RecentFiles(ctx context.Context, limit *int) ([]*models.File, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limitVal := 0
+	if limit != nil {
+		limitVal = *limit
+	}
+
+	files, err := r.FileService.GetRecentlyAccessed(user.ID, limitVal)
+	if err != nil {
+		return nil, err
+	}
+
+	r.attachShareCounts(files)
+	return files, nil
+}
+
 // FilesByFolder returns files in a specific folder for the current user
-func (r *Resolver) FilesByFolder(ctx context.Context, folderID string, limit *int, offset *int) ([]*models.File, error) {
+func (r *Resolver) FilesByFolder(ctx context.Context, folderID string, recursive *bool, limit *int, offset *int) ([]*models.File, error) {
 	fmt.Printf("=== GRAPHQL FILES BY FOLDER QUERY DEBUG START ===\n")
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
@@ -109,16 +240,46 @@ func (r *Resolver) FilesByFolder(ctx context.Context, folderID string, limit *in
 	}
 
 	fmt.Printf("DEBUG: Getting files for user: %s in folder: %s\n", user.ID, folderUUID)
-	files, err := r.FileService.GetFilesByFolderID(user.ID, folderUUID, limitVal, offsetVal)
+	var files []*models.File
+	if recursive != nil && *recursive {
+		files, err = r.FileService.GetFilesByFolderRecursive(user.ID, folderUUID, limitVal, offsetVal)
+	} else {
+		files, err = r.FileService.GetFilesByFolderID(user.ID, folderUUID, limitVal, offsetVal)
+	}
 	if err != nil {
 		fmt.Printf("ERROR: Failed to get files by folder: %v\n", err)
 		return nil, err
 	}
+	r.attachShareCounts(files)
+
 	fmt.Printf("SUCCESS: Retrieved %d files from folder\n", len(files))
 	fmt.Printf("=== GRAPHQL FILES BY FOLDER QUERY DEBUG END ===\n")
 	return files, nil
 }
 
+// attachShareCounts fills in ActiveShareCount on listed files with one grouped query.
+// A failure only leaves the counts at zero, since the badge is not worth failing the listing for.
+func (r *Resolver) attachShareCounts(files []*models.File) {
+	if r.FileShareService == nil || len(files) == 0 {
+		return
+	}
+
+	fileIDs := make([]uuid.UUID, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.ID
+	}
+
+	counts, err := r.FileShareService.GetShareCountsForFiles(fileIDs)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to get share counts: %v\n", err)
+		return
+	}
+
+	for _, file := range files {
+		file.ActiveShareCount = counts[file.ID]
+	}
+}
+
 // File returns a specific file by ID
 func (r *Resolver) File(ctx context.Context, id string) (*models.File, error) {
 	user, err := r.getCurrentUser(ctx)
@@ -136,14 +297,159 @@ func (r *Resolver) File(ctx context.Context, id string) (*models.File, error) {
 		return nil, err
 	}
 
-	// Check if user has access to this file
-	if file.UploaderID != user.ID {
+	// Check if user owns this file or holds an access grant for it
+	hasAccess, err := r.canViewFile(user.ID, file)
+	if err != nil {
+		return nil, err
+	}
+	if !hasAccess {
 		return nil, fmt.Errorf("unauthorized: you don't have access to this file")
 	}
 
 	return file, nil
 }
 
+// canViewFile reports whether the user uploaded the file or holds an access grant for it
+func (r *Resolver) canViewFile(userID uuid.UUID, file *models.File) (bool, error) {
+	if file.UploaderID == userID {
+		return true, nil
+	}
+	if r.FileAccessService == nil {
+		return false, nil
+	}
+	return r.FileAccessService.HasAccess(userID, file.ID, models.FilePermissionView)
+}
+
+// OriginalFile returns the file whose content a deduplicated file reuses, so the UI can say
+// "copy of X". It is nil when the file stored its own content, or when the original belongs to
+// someone else and isn't shared with the current user.
+func (r *Resolver) OriginalFile(ctx context.Context, fileID string) (*models.File, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checks the current user can see the copy itself
+	file, err := r.File(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := r.FileService.GetOriginal(file.ID)
+	if err != nil || original == nil {
+		return nil, err
+	}
+
+	hasAccess, err := r.canViewFile(user.ID, original)
+	if err != nil {
+		return nil, err
+	}
+	if !hasAccess {
+		return nil, nil
+	}
+	return original, nil
+}
+
+// GrantFileAccess gives another user read-only access to one of the current user's files
+func (r *Resolver) GrantFileAccess(ctx context.Context, fileID string, userID string, permission string) (*models.FileAccessGrant, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	granteeUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	return r.FileAccessService.GrantAccess(user.ID, fileUUID, granteeUUID, permission)
+}
+
+// FileComments returns a page of comments on a file the current user can access
+func (r *Resolver) FileComments(ctx context.Context, fileID string, limit, offset *int) ([]*models.FileComment, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	l, o := 50, 0
+	if limit != nil {
+		l = *limit
+	}
+	if offset != nil {
+		o = *offset
+	}
+
+	return r.CommentService.ListComments(fileUUID, user.ID, l, o)
+}
+
+// AddFileComment leaves a comment on a file the current user can access
+func (r *Resolver) AddFileComment(ctx context.Context, fileID string, body string) (*models.FileComment, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	return r.CommentService.AddComment(fileUUID, user.ID, body)
+}
+
+// DeleteFileComment removes a comment written by the current user or left on one of their files
+func (r *Resolver) DeleteFileComment(ctx context.Context, commentID string) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	commentUUID, err := uuid.Parse(commentID)
+	if err != nil {
+		return false, fmt.Errorf("invalid comment ID")
+	}
+
+	if err := r.CommentService.DeleteComment(commentUUID, user.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RevokeFileAccess removes another user's access grant on one of the current user's files
+func (r *Resolver) RevokeFileAccess(ctx context.Context, fileID string, userID string) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return false, fmt.Errorf("invalid file ID")
+	}
+
+	granteeUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID")
+	}
+
+	if err := r.FileAccessService.RevokeAccess(user.ID, fileUUID, granteeUUID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // SearchFiles searches files for the current user
 func (r *Resolver) SearchFiles(ctx context.Context, searchTerm string, limit *int, offset *int) ([]*models.File, error) {
 	user, err := r.getCurrentUser(ctx)
@@ -178,7 +484,7 @@ func (r *Resolver) DeleteFile(ctx context.Context, id string) (bool, error) {
 		return false, fmt.Errorf("invalid file ID")
 	}
 
-	err = r.FileService.DeleteFile(fileID, user.ID)
+	err = r.FileService.DeleteFile(ctx, fileID, user.ID)
 	if err != nil {
 		return false, err
 	}
@@ -186,6 +492,36 @@ func (r *Resolver) DeleteFile(ctx context.Context, id string) (bool, error) {
 	return true, nil
 }
 
+// UpdateFile renames a file and/or edits its description and download name
+func (r *Resolver) UpdateFile(ctx context.Context, id string, name *string, description *string, downloadName *string) (*models.File, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	return r.FileService.UpdateFileMetadata(fileID, user.ID, description, name, downloadName)
+}
+
+// SetFilePublic toggles whether a file can be downloaded from its public URL
+func (r *Resolver) SetFilePublic(ctx context.Context, id string, public bool) (*models.File, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	return r.FileService.SetPublic(fileID, user.ID, public)
+}
+
 // RegisterUser registers a new user
 func (r *Resolver) RegisterUser(ctx context.Context, email string, username string, password string) (*models.AuthPayload, error) {
 	user, err := r.AuthService.RegisterUser(email, username, password)
@@ -204,9 +540,33 @@ func (r *Resolver) RegisterUser(ctx context.Context, email string, username stri
 	}, nil
 }
 
-// LoginUser authenticates a user
+// LoginUser authenticates a user. The email argument also accepts a username.
 func (r *Resolver) LoginUser(ctx context.Context, email string, password string) (*models.AuthPayload, error) {
-	token, user, err := r.AuthService.LoginUser(email, password)
+	token, user, err := r.AuthService.LoginUser(email, password, middleware.ClientIPFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthPayload{
+		Token: token,
+		User:  user,
+	}, nil
+}
+
+// ChangePassword changes the current user's password and returns a fresh token
+func (r *Resolver) ChangePassword(ctx context.Context, oldPassword string, newPassword string, revokeOtherSessions *bool) (*models.AuthPayload, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	revoke := revokeOtherSessions != nil && *revokeOtherSessions
+	if err := r.AuthService.ChangePassword(user.ID, oldPassword, newPassword, revoke); err != nil {
+		return nil, err
+	}
+
+	// Issue a new token so the current session survives a revocation
+	token, err := r.AuthService.GenerateToken(user)
 	if err != nil {
 		return nil, err
 	}
@@ -217,8 +577,32 @@ func (r *Resolver) LoginUser(ctx context.Context, email string, password string)
 	}, nil
 }
 
+// UpdateProfile updates the current user's username and deduplication opt-out and returns a
+// token with the new claims
+func (r *Resolver) UpdateProfile(ctx context.Context, username string, dedupOptOut *bool) (*models.AuthPayload, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedUser, err := r.AuthService.UpdateProfile(user.ID, username, dedupOptOut)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := r.AuthService.GenerateToken(updatedUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthPayload{
+		Token: token,
+		User:  updatedUser,
+	}, nil
+}
+
 // AdvancedSearch performs advanced search with multiple filters
-func (r *Resolver) AdvancedSearch(ctx context.Context, searchTerm *string, mimeTypes []string, minSize *int, maxSize *int, dateFrom *string, dateTo *string, sortBy *string, sortOrder *string, limit *int, offset *int) (*services.SearchResult, error) {
+func (r *Resolver) AdvancedSearch(ctx context.Context, searchTerm *string, mimeTypes []string, minSize *int, maxSize *int, dateFrom *string, dateTo *string, folderID *string, recursive *bool, sortBy *string, sortOrder *string, limit *int, offset *int) (*services.SearchResult, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
 		return nil, err
@@ -264,6 +648,14 @@ func (r *Resolver) AdvancedSearch(ctx context.Context, searchTerm *string, mimeT
 			filters.DateTo = &date
 		}
 	}
+	if folderID != nil && *folderID != "" {
+		folderUUID, err := uuid.Parse(*folderID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid folder ID")
+		}
+		filters.FolderID = &folderUUID
+		filters.Recursive = recursive != nil && *recursive
+	}
 	if sortBy != nil {
 		filters.SortBy = *sortBy
 	}
@@ -284,21 +676,115 @@ func (r *Resolver) FileStats(ctx context.Context) (map[string]interface{}, error
 	return r.SearchService.GetFileStats(user.ID)
 }
 
-// MimeTypeCategories returns categorized MIME types
-func (r *Resolver) MimeTypeCategories(ctx context.Context) (map[string][]string, error) {
-	return r.SearchService.GetMimeTypeCategories(), nil
+// MyMimeTypes returns the distinct MIME types in the current user's library with counts
+func (r *Resolver) MyMimeTypes(ctx context.Context) ([]models.MimeTypeCount, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.SearchService.GetUserMimeTypes(user.ID)
 }
 
-// AuthMiddleware creates a Gin middleware for JWT authentication
-func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get the Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
+// CleanupSuggestions suggests files the current user could delete to free storage
+func (r *Resolver) CleanupSuggestions(ctx context.Context) ([]services.CleanupSuggestion, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.QuotaService.GetCleanupSuggestions(user.ID)
+}
+
+// MyDedupSavings reports the storage the current user saved by uploading content that was already stored
+func (r *Resolver) MyDedupSavings(ctx context.Context) (*models.DedupSavings, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	count, bytesSaved, err := r.QuotaService.GetUserDedupSavings(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DedupSavings{DuplicateCount: count, BytesSaved: bytesSaved}, nil
+}
+
+// CheckFileExists reports whether the current user already has a file with the given SHA-256
+// hash, so a client can skip uploading it
+func (r *Resolver) CheckFileExists(ctx context.Context, hash string) (*models.FileExistsResult, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, existingFileID, err := r.FileService.CheckHashExists(user.ID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FileExistsResult{Exists: exists, ExistingFileID: existingFileID}, nil
+}
+
+// FileTextContent returns the content of one of the current user's text or code files for preview
+func (r *Resolver) FileTextContent(ctx context.Context, id string, maxBytes *int) (*models.FileTextContent, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	limit := 0
+	if maxBytes != nil {
+		limit = *maxBytes
+	}
+	content, truncated, language, err := r.FileService.GetTextContent(ctx, fileID, user.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.FileTextContent{Content: content, Truncated: truncated, Language: language}, nil
+}
+
+// FindSimilarImages returns images that look like the given one. Admins search across all users.
+func (r *Resolver) FindSimilarImages(ctx context.Context, fileID string, threshold *int) ([]*models.SimilarImage, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID")
+	}
+
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check admin status: %w", err)
+	}
+
+	return r.FileService.FindSimilarImages(user.ID, fileUUID, threshold, isAdmin)
+}
+
+// MimeTypeCategories returns categorized MIME types
+func (r *Resolver) MimeTypeCategories(ctx context.Context) (map[string][]string, error) {
+	return r.SearchService.GetMimeTypeCategories(), nil
+}
+
+// AuthMiddleware creates a Gin middleware for JWT authentication
+func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get the Authorization header
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.Abort()
+			return
+		}
 
 		// Check if the header starts with "Bearer "
 		if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -318,8 +804,22 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		// Set the user in the context
-		c.Set("user", user)
+		// Set the user in the request context
+		middleware.SetUser(c, user)
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware sets the user when a valid Bearer token is sent and otherwise
+// lets the request through anonymously
+func OptionalAuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			if user, err := authService.ValidateToken(strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+				middleware.SetUser(c, user)
+			}
+		}
 		c.Next()
 	}
 }
@@ -356,132 +856,385 @@ func (r *Resolver) AdminStats(ctx context.Context) (*services.AdminStats, error)
 		fmt.Printf("DEBUG: GetSystemStats failed: %v\n", err)
 		return nil, err
 	}
-	fmt.Printf("DEBUG: GetSystemStats successful: %+v\n", stats)
+	fmt.Printf("DEBUG: GetSystemStats successful: %+v\n", stats)
+
+	return stats, nil
+}
+
+// AdminUsers returns all users with their statistics
+func (r *Resolver) AdminUsers(ctx context.Context, limit *int, offset *int) ([]*services.UserStats, error) {
+	fmt.Println("DEBUG: AdminUsers resolver called")
+
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to get current user: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("DEBUG: Current user: %+v\n", user)
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to check admin status: %v\n", err)
+		return nil, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	fmt.Printf("DEBUG: Is admin: %v\n", isAdmin)
+
+	if !isAdmin {
+		fmt.Println("DEBUG: Access denied - not admin")
+		return nil, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	limitVal := 20
+	if limit != nil {
+		limitVal = *limit
+	}
+	offsetVal := 0
+	if offset != nil {
+		offsetVal = *offset
+	}
+
+	fmt.Printf("DEBUG: Calling AdminService.GetAllUsers with limit=%d, offset=%d\n", limitVal, offsetVal)
+	users, err := r.AdminService.GetAllUsers(limitVal, offsetVal)
+	if err != nil {
+		fmt.Printf("DEBUG: GetAllUsers failed: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("DEBUG: GetAllUsers successful, returned %d users\n", len(users))
+
+	return users, nil
+}
+
+// AdminUserDetails returns detailed statistics for a specific user
+func (r *Resolver) AdminUserDetails(ctx context.Context, userID string) (*services.UserStats, error) {
+	fmt.Println("DEBUG: AdminUserDetails resolver called")
+
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to get current user: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("DEBUG: Current user: %+v\n", user)
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to check admin status: %v\n", err)
+		return nil, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	fmt.Printf("DEBUG: Is admin: %v\n", isAdmin)
+
+	if !isAdmin {
+		fmt.Println("DEBUG: Access denied - not admin")
+		return nil, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	fmt.Printf("DEBUG: Calling AdminService.GetUserDetails for user %s\n", userID)
+	userStats, err := r.AdminService.GetUserDetails(userUUID)
+	if err != nil {
+		fmt.Printf("DEBUG: GetUserDetails failed: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("DEBUG: GetUserDetails successful: %+v\n", userStats)
+
+	return userStats, nil
+}
+
+// AdminSystemHealth returns system health metrics
+func (r *Resolver) AdminSystemHealth(ctx context.Context) (*services.SystemHealth, error) {
+	fmt.Println("DEBUG: AdminSystemHealth resolver called")
+
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to get current user: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("DEBUG: Current user: %+v\n", user)
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to check admin status: %v\n", err)
+		return nil, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	fmt.Printf("DEBUG: Is admin: %v\n", isAdmin)
+
+	if !isAdmin {
+		fmt.Println("DEBUG: Access denied - not admin")
+		return nil, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	fmt.Println("DEBUG: Calling AdminService.GetSystemHealth()")
+	health, err := r.AdminService.GetSystemHealth(ctx)
+	if err != nil {
+		fmt.Printf("DEBUG: GetSystemHealth failed: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("DEBUG: GetSystemHealth successful: %+v\n", health)
+
+	return health, nil
+}
+
+// AdminDeleteUser deletes a user and all their files
+func (r *Resolver) AdminDeleteUser(ctx context.Context, userID string) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !isAdmin {
+		return false, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	err = r.AdminService.DeleteUser(userUUID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return true, nil
+}
+
+// AdminUpdateUserRole updates a user's role
+func (r *Resolver) AdminUpdateUserRole(ctx context.Context, userID string, role string) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !isAdmin {
+		return false, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	err = r.AdminService.UpdateUserRole(userUUID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return true, nil
+}
+
+// AdminSetUserQuota overrides a user's storage quota in MB (admin only); null restores the role default
+func (r *Resolver) AdminSetUserQuota(ctx context.Context, userID string, quotaMB *int) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !isAdmin {
+		return false, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var quota *int64
+	if quotaMB != nil {
+		value := int64(*quotaMB)
+		quota = &value
+	}
+	if err := r.AdminService.SetUserQuota(userUUID, quota); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AdminTransferFiles reassigns all files of one user to another (admin only)
+func (r *Resolver) AdminTransferFiles(ctx context.Context, fromUserID string, toUserID string) (int, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !isAdmin {
+		return 0, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	fromUUID, err := uuid.Parse(fromUserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid source user ID: %w", err)
+	}
+	toUUID, err := uuid.Parse(toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid target user ID: %w", err)
+	}
+
+	return r.AdminService.TransferFiles(fromUUID, toUUID)
+}
+
+// AdminTransferFile reassigns a single file to another user (admin only)
+func (r *Resolver) AdminTransferFile(ctx context.Context, fileID string, toUserID string) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// Check if user is admin
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !isAdmin {
+		return false, fmt.Errorf("access denied: admin privileges required")
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return false, fmt.Errorf("invalid file ID: %w", err)
+	}
+	toUUID, err := uuid.Parse(toUserID)
+	if err != nil {
+		return false, fmt.Errorf("invalid target user ID: %w", err)
+	}
 
-	return stats, nil
-}
+	if err := r.AdminService.TransferFile(fileUUID, toUUID); err != nil {
+		return false, err
+	}
 
-// AdminUsers returns all users with their statistics
-func (r *Resolver) AdminUsers(ctx context.Context, limit *int, offset *int) ([]*services.UserStats, error) {
-	fmt.Println("DEBUG: AdminUsers resolver called")
+	return true, nil
+}
 
+// RecentUploads lists the latest uploads across all users for the admin activity feed
+func (r *Resolver) RecentUploads(ctx context.Context, limit *int) ([]*models.File, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get current user: %v\n", err)
 		return nil, err
 	}
-	fmt.Printf("DEBUG: Current user: %+v\n", user)
 
-	// Check if user is admin
 	isAdmin, err := r.AdminService.IsAdmin(user.ID)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to check admin status: %v\n", err)
 		return nil, fmt.Errorf("failed to check admin status: %w", err)
 	}
-	fmt.Printf("DEBUG: Is admin: %v\n", isAdmin)
-
 	if !isAdmin {
-		fmt.Println("DEBUG: Access denied - not admin")
 		return nil, fmt.Errorf("access denied: admin privileges required")
 	}
 
-	limitVal := 20
+	limitVal := 0
 	if limit != nil {
 		limitVal = *limit
 	}
-	offsetVal := 0
-	if offset != nil {
-		offsetVal = *offset
-	}
-
-	fmt.Printf("DEBUG: Calling AdminService.GetAllUsers with limit=%d, offset=%d\n", limitVal, offsetVal)
-	users, err := r.AdminService.GetAllUsers(limitVal, offsetVal)
-	if err != nil {
-		fmt.Printf("DEBUG: GetAllUsers failed: %v\n", err)
-		return nil, err
-	}
-	fmt.Printf("DEBUG: GetAllUsers successful, returned %d users\n", len(users))
-
-	return users, nil
+	return r.AdminService.GetRecentUploads(limitVal)
 }
 
-// AdminUserDetails returns detailed statistics for a specific user
-func (r *Resolver) AdminUserDetails(ctx context.Context, userID string) (*services.UserStats, error) {
-	fmt.Println("DEBUG: AdminUserDetails resolver called")
-
+// StorageHeatmap reports stored content by access tier to help plan S3 lifecycle policies
+func (r *Resolver) StorageHeatmap(ctx context.Context) ([]models.FileHeat, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get current user: %v\n", err)
 		return nil, err
 	}
-	fmt.Printf("DEBUG: Current user: %+v\n", user)
 
-	// Check if user is admin
 	isAdmin, err := r.AdminService.IsAdmin(user.ID)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to check admin status: %v\n", err)
 		return nil, fmt.Errorf("failed to check admin status: %w", err)
 	}
-	fmt.Printf("DEBUG: Is admin: %v\n", isAdmin)
-
 	if !isAdmin {
-		fmt.Println("DEBUG: Access denied - not admin")
 		return nil, fmt.Errorf("access denied: admin privileges required")
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	return r.AdminService.GetAccessHeatmap()
+}
+
+// UploadMetrics reports upload successes and failure reasons over the last sinceDays days
+func (r *Resolver) UploadMetrics(ctx context.Context, sinceDays *int) (*services.UploadMetrics, error) {
+	user, err := r.getCurrentUser(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, err
 	}
 
-	fmt.Printf("DEBUG: Calling AdminService.GetUserDetails for user %s\n", userID)
-	userStats, err := r.AdminService.GetUserDetails(userUUID)
+	isAdmin, err := r.AdminService.IsAdmin(user.ID)
 	if err != nil {
-		fmt.Printf("DEBUG: GetUserDetails failed: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !isAdmin {
+		return nil, fmt.Errorf("access denied: admin privileges required")
 	}
-	fmt.Printf("DEBUG: GetUserDetails successful: %+v\n", userStats)
 
-	return userStats, nil
+	days := 0
+	if sinceDays != nil {
+		days = *sinceDays
+	}
+	return r.AdminService.GetUploadMetrics(days)
 }
 
-// AdminSystemHealth returns system health metrics
-func (r *Resolver) AdminSystemHealth(ctx context.Context) (*services.SystemHealth, error) {
-	fmt.Println("DEBUG: AdminSystemHealth resolver called")
-
+// AdminShares lists public shares across all users, optionally filtered by owner, active flag
+// and file name
+func (r *Resolver) AdminShares(ctx context.Context, limit, offset *int, ownerID *string, isActive *bool, fileName *string) ([]*models.AdminFileShare, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get current user: %v\n", err)
 		return nil, err
 	}
-	fmt.Printf("DEBUG: Current user: %+v\n", user)
 
 	// Check if user is admin
 	isAdmin, err := r.AdminService.IsAdmin(user.ID)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to check admin status: %v\n", err)
 		return nil, fmt.Errorf("failed to check admin status: %w", err)
 	}
-	fmt.Printf("DEBUG: Is admin: %v\n", isAdmin)
-
 	if !isAdmin {
-		fmt.Println("DEBUG: Access denied - not admin")
 		return nil, fmt.Errorf("access denied: admin privileges required")
 	}
 
-	fmt.Println("DEBUG: Calling AdminService.GetSystemHealth()")
-	health, err := r.AdminService.GetSystemHealth()
-	if err != nil {
-		fmt.Printf("DEBUG: GetSystemHealth failed: %v\n", err)
-		return nil, err
+	filter := models.AdminShareFilter{IsActive: isActive}
+	if ownerID != nil && *ownerID != "" {
+		ownerUUID, err := uuid.Parse(*ownerID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid owner ID: %w", err)
+		}
+		filter.OwnerID = &ownerUUID
+	}
+	if fileName != nil {
+		filter.FileName = *fileName
 	}
-	fmt.Printf("DEBUG: GetSystemHealth successful: %+v\n", health)
 
-	return health, nil
+	limitVal := 0
+	if limit != nil {
+		limitVal = *limit
+	}
+	offsetVal := 0
+	if offset != nil {
+		offsetVal = *offset
+	}
+
+	return r.AdminService.GetAllShares(limitVal, offsetVal, filter)
 }
 
-// AdminDeleteUser deletes a user and all their files
-func (r *Resolver) AdminDeleteUser(ctx context.Context, userID string) (bool, error) {
+// AdminRevokeShare deactivates any user's share
+func (r *Resolver) AdminRevokeShare(ctx context.Context, shareID string) (bool, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
 		return false, err
@@ -496,21 +1249,29 @@ func (r *Resolver) AdminDeleteUser(ctx context.Context, userID string) (bool, er
 		return false, fmt.Errorf("access denied: admin privileges required")
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	shareUUID, err := uuid.Parse(shareID)
 	if err != nil {
-		return false, fmt.Errorf("invalid user ID: %w", err)
+		return false, fmt.Errorf("invalid share ID: %w", err)
 	}
 
-	err = r.AdminService.DeleteUser(userUUID)
-	if err != nil {
-		return false, fmt.Errorf("failed to delete user: %w", err)
+	if err := r.AdminService.RevokeShare(shareUUID); err != nil {
+		return false, err
 	}
 
 	return true, nil
 }
 
-// AdminUpdateUserRole updates a user's role
-func (r *Resolver) AdminUpdateUserRole(ctx context.Context, userID string, role string) (bool, error) {
+// UploadsEnabled reports whether uploads are currently accepted
+func (r *Resolver) UploadsEnabled(ctx context.Context) (bool, error) {
+	if _, err := r.getCurrentUser(ctx); err != nil {
+		return false, err
+	}
+
+	return r.SettingsService.UploadsEnabled(), nil
+}
+
+// SetUploadsEnabled pauses or resumes uploads for all users (admin only)
+func (r *Resolver) SetUploadsEnabled(ctx context.Context, enabled bool) (bool, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
 		return false, err
@@ -525,23 +1286,46 @@ func (r *Resolver) AdminUpdateUserRole(ctx context.Context, userID string, role
 		return false, fmt.Errorf("access denied: admin privileges required")
 	}
 
-	userUUID, err := uuid.Parse(userID)
+	if err := r.SettingsService.SetUploadsEnabled(enabled, user.ID); err != nil {
+		return false, fmt.Errorf("failed to update upload setting: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// File sharing resolvers
+
+// MyFileShares returns file shares for the current user
+func (r *Resolver) MyFileShares(ctx context.Context, limit *int, offset *int, activeOnly *bool) ([]*models.FileShareResponse, error) {
+	page, err := r.MyFileSharesPage(ctx, limit, offset, activeOnly)
 	if err != nil {
-		return false, fmt.Errorf("invalid user ID: %w", err)
+		return nil, err
 	}
+	return page.Shares, nil
+}
 
-	err = r.AdminService.UpdateUserRole(userUUID, role)
+// MyFileSharesPage returns a page of the current user's file shares with the total count
+func (r *Resolver) MyFileSharesPage(ctx context.Context, limit *int, offset *int, activeOnly *bool) (*models.FileSharePage, error) {
+	user, err := r.getCurrentUser(ctx)
 	if err != nil {
-		return false, fmt.Errorf("failed to update user role: %w", err)
+		return nil, err
 	}
 
-	return true, nil
-}
+	limitVal := 20
+	offsetVal := 0
 
-// File sharing resolvers
+	if limit != nil {
+		limitVal = *limit
+	}
+	if offset != nil {
+		offsetVal = *offset
+	}
 
-// MyFileShares returns file shares for the current user
-func (r *Resolver) MyFileShares(ctx context.Context, limit *int, offset *int) ([]*models.FileShareResponse, error) {
+	return r.FileShareService.GetUserFileShares(user.ID, limitVal, offsetVal, activeOnly != nil && *activeOnly)
+}
+
+// SharedWithMe returns a page of the files other users shared with the current user
+func (r *Resolver) SharedWithMe(ctx context.Context, limit *int, offset *int) (*models.SharedWithMePage, error) {
 	user, err := r.getCurrentUser(ctx)
 	if err != nil {
 		return nil, err
@@ -557,7 +1341,37 @@ func (r *Resolver) MyFileShares(ctx context.Context, limit *int, offset *int) ([
 		offsetVal = *offset
 	}
 
-	return r.FileShareService.GetUserFileShares(user.ID, limitVal, offsetVal)
+	return r.FileShareService.GetAllSharedWithMe(user.ID, limitVal, offsetVal)
+}
+
+// FileShare returns a single file share owned by the current user
+func (r *Resolver) FileShare(ctx context.Context, id string) (*models.FileShareResponse, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	shareUUID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share ID: %w", err)
+	}
+
+	return r.FileShareService.GetShareByIDForOwner(user.ID, shareUUID)
+}
+
+// FileShareHistory returns all shares of one of the current user's files with download totals
+func (r *Resolver) FileShareHistory(ctx context.Context, fileID string) (*models.FileShareHistory, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	return r.FileShareService.GetFileShareHistory(user.ID, fileUUID)
 }
 
 // FileShareStats returns statistics for a file share
@@ -576,7 +1390,7 @@ func (r *Resolver) FileShareStats(ctx context.Context, shareID string) (map[stri
 }
 
 // CreateFileShare creates a new file share
-func (r *Resolver) CreateFileShare(ctx context.Context, fileID string, expiresAt *string, maxDownloads *int) (*models.FileShareResponse, error) {
+func (r *Resolver) CreateFileShare(ctx context.Context, fileID string, expiresAt *string, maxDownloads *int, maxBandwidthBps *int, forceDownload *bool, allowedEmailDomains []string, burnAfterDownload *bool) (*models.FileShareResponse, error) {
 	fmt.Printf("DEBUG: CreateFileShare called with fileID=%s, expiresAt=%v, maxDownloads=%v\n", fileID, expiresAt, maxDownloads)
 
 	// Validate input
@@ -603,8 +1417,15 @@ func (r *Resolver) CreateFileShare(ctx context.Context, fileID string, expiresAt
 	}
 
 	req := &models.CreateFileShareRequest{
-		FileID:       fileUUID,
-		MaxDownloads: maxDownloads,
+		FileID:              fileUUID,
+		MaxDownloads:        maxDownloads,
+		ForceDownload:       forceDownload != nil && *forceDownload,
+		AllowedEmailDomains: allowedEmailDomains,
+		BurnAfterDownload:   burnAfterDownload != nil && *burnAfterDownload,
+	}
+	if maxBandwidthBps != nil {
+		bps := int64(*maxBandwidthBps)
+		req.MaxBandwidthBps = &bps
 	}
 
 	if expiresAt != nil && *expiresAt != "" {
@@ -652,16 +1473,7 @@ func (r *Resolver) UpdateFileShare(ctx context.Context, shareID string, isActive
 		expires = &parsed
 	}
 
-	err = r.FileShareService.UpdateFileShare(user.ID, shareUUID, isActive, expires, maxDownloads)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the updated share (this is a simplified response)
-	// In a real implementation, we'd fetch the updated share from the database
-	return &models.FileShareResponse{
-		ID: shareUUID,
-	}, nil
+	return r.FileShareService.UpdateFileShare(user.ID, shareUUID, isActive, expires, maxDownloads)
 }
 
 // DeleteFileShare deletes a file share
@@ -684,6 +1496,36 @@ func (r *Resolver) DeleteFileShare(ctx context.Context, shareID string) (bool, e
 	return true, nil
 }
 
+// RegenerateShareToken issues a new token for a share owned by the current user
+func (r *Resolver) RegenerateShareToken(ctx context.Context, shareID string) (*models.FileShareResponse, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	shareUUID, err := uuid.Parse(shareID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share ID: %w", err)
+	}
+
+	return r.FileShareService.RegenerateToken(user.ID, shareUUID)
+}
+
+// ShareFileByEmail emails a share link for a file owned by the current user
+func (r *Resolver) ShareFileByEmail(ctx context.Context, fileID string, email string, message *string) (*services.ShareByEmailResult, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fileUUID, err := uuid.Parse(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	return r.FileShareService.ShareByEmail(user.ID, fileUUID, email, message)
+}
+
 // Folders returns all folders for the current user
 func (r *Resolver) Folders(ctx context.Context) ([]*models.Folder, error) {
 	fmt.Printf("=== GRAPHQL FOLDERS QUERY DEBUG START ===\n")
@@ -701,6 +1543,9 @@ func (r *Resolver) Folders(ctx context.Context) ([]*models.Folder, error) {
 		fmt.Printf("ERROR: Failed to get user folders: %v\n", err)
 		return nil, err
 	}
+	if err := r.FolderService.FillFolderSizes(folders, user.ID); err != nil {
+		fmt.Printf("WARNING: Failed to get folder sizes: %v\n", err)
+	}
 
 	fmt.Printf("SUCCESS: Retrieved %d folders\n", len(folders))
 	fmt.Printf("=== GRAPHQL FOLDERS QUERY DEBUG END ===\n")
@@ -730,14 +1575,50 @@ func (r *Resolver) Folder(ctx context.Context, id string) (*models.Folder, error
 		fmt.Printf("ERROR: Failed to get folder: %v\n", err)
 		return nil, err
 	}
+	if size, err := r.FolderService.GetFolderSize(folderUUID, user.ID, true); err == nil {
+		folder.SizeBytes = size
+	} else {
+		fmt.Printf("WARNING: Failed to get folder size: %v\n", err)
+	}
 
 	fmt.Printf("SUCCESS: Retrieved folder: %+v\n", folder)
 	fmt.Printf("=== GRAPHQL FOLDER QUERY DEBUG END ===\n")
 	return folder, nil
 }
 
+// FolderAncestors returns the breadcrumb chain from the root to a folder
+func (r *Resolver) FolderAncestors(ctx context.Context, id string) ([]*models.Folder, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folderUUID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid folder ID")
+	}
+
+	return r.FolderService.GetAncestors(folderUUID, user.ID)
+}
+
+// FolderSize returns the bytes used by a folder, including its subfolders when recursive
+// (the default)
+func (r *Resolver) FolderSize(ctx context.Context, id string, recursive *bool) (int64, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	folderUUID, err := uuid.Parse(id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid folder ID")
+	}
+
+	return r.FolderService.GetFolderSize(folderUUID, user.ID, recursive == nil || *recursive)
+}
+
 // CreateFolder creates a new folder
-func (r *Resolver) CreateFolder(ctx context.Context, name string, parentID *string) (*models.Folder, error) {
+func (r *Resolver) CreateFolder(ctx context.Context, name string, parentID *string, color *string, icon *string) (*models.Folder, error) {
 	fmt.Printf("=== GRAPHQL CREATE FOLDER MUTATION DEBUG START ===\n")
 
 	user, err := r.getCurrentUser(ctx)
@@ -749,7 +1630,9 @@ func (r *Resolver) CreateFolder(ctx context.Context, name string, parentID *stri
 	fmt.Printf("DEBUG: Creating folder with name='%s', parentID=%v for user: %s\n", name, parentID, user.ID)
 
 	req := &models.CreateFolderRequest{
-		Name: name,
+		Name:  name,
+		Color: color,
+		Icon:  icon,
 	}
 
 	if parentID != nil {
@@ -773,7 +1656,7 @@ func (r *Resolver) CreateFolder(ctx context.Context, name string, parentID *stri
 }
 
 // UpdateFolder updates an existing folder
-func (r *Resolver) UpdateFolder(ctx context.Context, id string, name string) (*models.Folder, error) {
+func (r *Resolver) UpdateFolder(ctx context.Context, id string, name string, color *string, icon *string) (*models.Folder, error) {
 	fmt.Printf("=== GRAPHQL UPDATE FOLDER MUTATION DEBUG START ===\n")
 
 	user, err := r.getCurrentUser(ctx)
@@ -791,7 +1674,9 @@ func (r *Resolver) UpdateFolder(ctx context.Context, id string, name string) (*m
 	fmt.Printf("DEBUG: Updating folder %s with name='%s' for user: %s\n", folderUUID, name, user.ID)
 
 	req := &models.UpdateFolderRequest{
-		Name: name,
+		Name:  name,
+		Color: color,
+		Icon:  icon,
 	}
 
 	folder, err := r.FolderService.UpdateFolder(folderUUID, user.ID, req)
@@ -833,3 +1718,66 @@ func (r *Resolver) DeleteFolder(ctx context.Context, id string) (bool, error) {
 	fmt.Printf("=== GRAPHQL DELETE FOLDER MUTATION DEBUG END ===\n")
 	return true, nil
 }
+
+// Notifications returns the current user's stored notifications with their unread count
+func (r *Resolver) Notifications(ctx context.Context, unreadOnly *bool, limit *int, offset *int) (*models.NotificationList, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limitVal := 20
+	offsetVal := 0
+	if limit != nil {
+		limitVal = *limit
+	}
+	if offset != nil {
+		offsetVal = *offset
+	}
+
+	return r.NotificationService.ListForUser(user.ID, unreadOnly != nil && *unreadOnly, limitVal, offsetVal)
+}
+
+// UnreadNotificationCount returns how many unread notifications the current user has
+func (r *Resolver) UnreadNotificationCount(ctx context.Context) (int, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.NotificationService.UnreadCount(user.ID)
+}
+
+// MarkNotificationRead marks one of the current user's notifications as read
+func (r *Resolver) MarkNotificationRead(ctx context.Context, id string) (bool, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	notificationID, err := uuid.Parse(id)
+	if err != nil {
+		return false, fmt.Errorf("invalid notification ID: %w", err)
+	}
+
+	if err := r.NotificationService.MarkRead(notificationID, user.ID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// MarkAllNotificationsRead marks all of the current user's notifications as read
+func (r *Resolver) MarkAllNotificationsRead(ctx context.Context) (int, error) {
+	user, err := r.getCurrentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := r.NotificationService.MarkAllRead(user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
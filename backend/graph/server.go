@@ -1,12 +1,15 @@
 package graph
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
+	"filevault/internal/middleware"
 	"filevault/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -17,12 +20,14 @@ import (
 // SimpleGraphQLServer provides a basic GraphQL server
 type SimpleGraphQLServer struct {
 	resolver *Resolver
+	limits   QueryLimits
 }
 
 // NewSimpleGraphQLServer creates a new simple GraphQL server
-func NewSimpleGraphQLServer(authService *services.AuthService, fileService *services.FileService, searchService *services.SearchService, adminService *services.AdminService, fileShareService *services.FileShareService, folderService *services.FolderService) *SimpleGraphQLServer {
+func NewSimpleGraphQLServer(authService *services.AuthService, fileService *services.FileService, searchService *services.SearchService, adminService *services.AdminService, fileShareService *services.FileShareService, folderService *services.FolderService, notificationService *services.NotificationService, fileAccessService *services.FileAccessService, settingsService *services.SystemSettingsService, quotaService *services.QuotaService, commentService *services.CommentService, queryLimits QueryLimits) *SimpleGraphQLServer {
 	return &SimpleGraphQLServer{
-		resolver: NewResolver(authService, fileService, searchService, adminService, fileShareService, folderService),
+		resolver: NewResolver(authService, fileService, searchService, adminService, fileShareService, folderService, notificationService, fileAccessService, settingsService, quotaService, commentService),
+		limits:   queryLimits.withDefaults(),
 	}
 }
 
@@ -39,90 +44,168 @@ type GraphQLResponse struct {
 	Errors []string    `json:"errors,omitempty"`
 }
 
-// HandleGraphQL handles GraphQL requests
+// maxBatchOperations limits how many operations a single batched request may contain
+const maxBatchOperations = 20
+
+// HandleGraphQL handles GraphQL requests. The body is either a single operation or a
+// JSON array of operations ([{query, variables}, ...]) executed in order with the same
+// authenticated context; batches get an array of responses in the same order.
 func (s *SimpleGraphQLServer) HandleGraphQL(c *gin.Context) {
 	// Handle JSON requests only (no file uploads)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, GraphQLResponse{
+			Errors: []string{"Invalid JSON: " + err.Error()},
+		})
+		return
+	}
+
+	// The request context already carries the user set by the auth middleware
+	ctx := c.Request.Context()
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []GraphQLRequest
+		if err := json.Unmarshal(trimmed, &reqs); err != nil {
+			c.JSON(http.StatusBadRequest, GraphQLResponse{
+				Errors: []string{"Invalid JSON: " + err.Error()},
+			})
+			return
+		}
+		if len(reqs) == 0 {
+			c.JSON(http.StatusBadRequest, GraphQLResponse{
+				Errors: []string{"Batch must contain at least one operation"},
+			})
+			return
+		}
+		if len(reqs) > maxBatchOperations {
+			c.JSON(http.StatusBadRequest, GraphQLResponse{
+				Errors: []string{fmt.Sprintf("Batch may contain at most %d operations", maxBatchOperations)},
+			})
+			return
+		}
+
+		responses := make([]GraphQLResponse, len(reqs))
+		for i, req := range reqs {
+			_, responses[i] = s.executeRequest(req, c, ctx)
+		}
+		c.JSON(http.StatusOK, responses)
+		return
+	}
+
 	var req GraphQLRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := json.Unmarshal(trimmed, &req); err != nil {
 		c.JSON(http.StatusBadRequest, GraphQLResponse{
 			Errors: []string{"Invalid JSON: " + err.Error()},
 		})
 		return
 	}
 
+	statusCode, response := s.executeRequest(req, c, ctx)
+	c.JSON(statusCode, response)
+}
+
+// executeRequest validates, parses and executes a single GraphQL operation
+func (s *SimpleGraphQLServer) executeRequest(req GraphQLRequest, c *gin.Context, ctx context.Context) (int, GraphQLResponse) {
 	// Validate request
 	if req.Query == "" {
-		c.JSON(http.StatusBadRequest, GraphQLResponse{
+		return http.StatusBadRequest, GraphQLResponse{
 			Errors: []string{"Query is required"},
-		})
-		return
+		}
 	}
 
 	// Parse the query
 	doc, err := parser.ParseQuery(&ast.Source{Input: req.Query})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, GraphQLResponse{
+		return http.StatusBadRequest, GraphQLResponse{
 			Errors: []string{err.Error()},
-		})
-		return
+		}
 	}
 
-	// Create context with user
-	ctx := c.Request.Context()
-	if user, exists := c.Get("user"); exists {
-		ctx = context.WithValue(ctx, "user", user)
+	// Reject oversized queries before running any resolvers
+	if err := checkQueryLimits(doc, s.limits); err != nil {
+		return http.StatusBadRequest, GraphQLResponse{
+			Errors: []string{err.Error()},
+		}
 	}
 
-	// Execute the query
-	result, err := s.executeQuery(doc, req.Variables, c, ctx)
+	// Reject unknown fields and arguments and mistyped variables before running any resolvers
+	if errs := validateDocument(doc); errs != nil {
+		return http.StatusBadRequest, GraphQLResponse{Errors: errs}
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
 	if err != nil {
-		// For authentication errors, return 200 with error in GraphQL response
-		// For other errors, return 500
-		statusCode := http.StatusInternalServerError
-		if strings.Contains(err.Error(), "Invalid email or password") ||
-			strings.Contains(err.Error(), "already exists") ||
-			strings.Contains(err.Error(), "already taken") ||
-			strings.Contains(err.Error(), "Failed to create account") {
-			statusCode = http.StatusOK
+		return http.StatusBadRequest, GraphQLResponse{
+			Errors: []string{err.Error()},
 		}
+	}
 
-		c.JSON(statusCode, GraphQLResponse{
+	if errs := validateVariables(op, req.Variables); errs != nil {
+		return http.StatusBadRequest, GraphQLResponse{Errors: errs}
+	}
+
+	// Execute the query
+	result, err := s.executeQuery(op, req.Variables, c, ctx)
+	if err != nil {
+		return errorStatusCode(err), GraphQLResponse{
 			Errors: []string{err.Error()},
-		})
-		return
+		}
 	}
 
-	c.JSON(http.StatusOK, GraphQLResponse{
+	return http.StatusOK, GraphQLResponse{
 		Data: result,
-	})
+	}
 }
 
-// executeQuery executes a GraphQL query
-func (s *SimpleGraphQLServer) executeQuery(doc *ast.QueryDocument, variables map[string]interface{}, c *gin.Context, ctx context.Context) (interface{}, error) {
-	result := make(map[string]interface{})
+// errorStatusCode maps an execution error to an HTTP status.
+// For authentication and validation errors, return 200 with error in GraphQL response
+// For other errors, return 500
+func errorStatusCode(err error) int {
+	if strings.Contains(err.Error(), "Invalid email, username or password") ||
+		strings.Contains(err.Error(), "already exists") ||
+		strings.Contains(err.Error(), "already taken") ||
+		strings.Contains(err.Error(), "Current password is incorrect") ||
+		strings.Contains(err.Error(), "Password must") ||
+		strings.Contains(err.Error(), "New password must") ||
+		strings.Contains(err.Error(), "Username must") ||
+		strings.Contains(err.Error(), "Failed to create account") {
+		return http.StatusOK
+	}
+	return http.StatusInternalServerError
+}
 
-	for _, op := range doc.Operations {
-		switch op.Operation {
-		case ast.Query:
-			queryResult, err := s.executeQueryOperation(op, variables, c, ctx)
-			if err != nil {
-				return nil, err
-			}
-			for k, v := range queryResult {
-				result[k] = v
-			}
-		case ast.Mutation:
-			mutationResult, err := s.executeMutationOperation(op, variables, c, ctx)
-			if err != nil {
-				return nil, err
-			}
-			for k, v := range mutationResult {
-				result[k] = v
-			}
+// selectOperation picks the operation to execute, as the GraphQL spec's GetOperation does:
+// the one named by operationName, or the only operation when no name is given
+func selectOperation(doc *ast.QueryDocument, operationName string) (*ast.OperationDefinition, error) {
+	if operationName == "" {
+		switch len(doc.Operations) {
+		case 0:
+			return nil, fmt.Errorf("document contains no operations")
+		case 1:
+			return doc.Operations[0], nil
+		default:
+			return nil, fmt.Errorf("operationName is required when the document contains multiple operations")
 		}
 	}
 
-	return result, nil
+	op := doc.Operations.ForName(operationName)
+	if op == nil {
+		return nil, fmt.Errorf("unknown operation %q", operationName)
+	}
+	return op, nil
+}
+
+// executeQuery executes a single GraphQL operation
+func (s *SimpleGraphQLServer) executeQuery(op *ast.OperationDefinition, variables map[string]interface{}, c *gin.Context, ctx context.Context) (interface{}, error) {
+	switch op.Operation {
+	case ast.Query:
+		return s.executeQueryOperation(op, variables, c, ctx)
+	case ast.Mutation:
+		return s.executeMutationOperation(op, variables, c, ctx)
+	default:
+		return nil, fmt.Errorf("unsupported operation type %q", op.Operation)
+	}
 }
 
 // executeQueryOperation executes a query operation
@@ -132,6 +215,20 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 	for _, sel := range op.SelectionSet {
 		if field, ok := sel.(*ast.Field); ok {
 			switch field.Name {
+			case "__typename":
+				result[field.Alias] = "Query"
+			case "__schema":
+				schema, err := introspectSchema(field, variables)
+				if err != nil {
+					return nil, err
+				}
+				result[field.Alias] = schema
+			case "__type":
+				typ, err := introspectType(field, variables)
+				if err != nil {
+					return nil, err
+				}
+				result[field.Alias] = typ
 			case "me":
 				user, err := s.resolver.Me(ctx)
 				if err != nil {
@@ -140,26 +237,43 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 					continue
 				}
 				result["me"] = user
+			case "dashboard":
+				dashboard, err := s.resolver.Dashboard(ctx, getIntPtr(variables, "recentLimit"))
+				if err != nil {
+					result["dashboard"] = nil
+					continue
+				}
+				result["dashboard"] = dashboard
 			case "files":
 				limit := 10
 				offset := 0
-				if limitVal, ok := variables["limit"]; ok {
-					if l, ok := limitVal.(int); ok {
-						limit = l
-					}
+				if l := getIntPtr(variables, "limit"); l != nil {
+					limit = *l
 				}
-				if offsetVal, ok := variables["offset"]; ok {
-					if o, ok := offsetVal.(int); ok {
-						offset = o
-					}
+				if o := getIntPtr(variables, "offset"); o != nil {
+					offset = *o
 				}
-				files, err := s.resolver.Files(ctx, &limit, &offset)
+				files, err := s.resolver.Files(ctx, &limit, &offset, getStringPtr(variables, "sortBy"), getStringPtr(variables, "sortOrder"), getBoolPtr(variables, "rootOnly"))
 				if err != nil {
 					// Return empty array for files query if user is not authenticated
 					result["files"] = []interface{}{}
 					continue
 				}
 				result["files"] = files
+			case "filesPage":
+				page, err := s.resolver.FilesPage(ctx, getIntPtr(variables, "limit"), getStringPtr(variables, "after"))
+				if err != nil {
+					result["filesPage"] = nil
+					continue
+				}
+				result["filesPage"] = page
+			case "recentFiles":
+				files, err := s.resolver.RecentFiles(ctx, getIntPtr(variables, "limit"))
+				if err != nil {
+					result["recentFiles"] = []interface{}{}
+					continue
+				}
+				result["recentFiles"] = files
 			case "file":
 				if id, ok := variables["id"]; ok {
 					if idStr, ok := id.(string); ok {
@@ -171,20 +285,23 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 						result["file"] = file
 					}
 				}
+			case "originalFile":
+				file, err := s.resolver.OriginalFile(ctx, getString(variables, "fileId"))
+				if err != nil {
+					result["originalFile"] = nil
+					continue
+				}
+				result["originalFile"] = file
 			case "searchFiles":
 				if searchTerm, ok := variables["searchTerm"]; ok {
 					if term, ok := searchTerm.(string); ok {
 						limit := 10
 						offset := 0
-						if limitVal, ok := variables["limit"]; ok {
-							if l, ok := limitVal.(int); ok {
-								limit = l
-							}
+						if l := getIntPtr(variables, "limit"); l != nil {
+							limit = *l
 						}
-						if offsetVal, ok := variables["offset"]; ok {
-							if o, ok := offsetVal.(int); ok {
-								offset = o
-							}
+						if o := getIntPtr(variables, "offset"); o != nil {
+							offset = *o
 						}
 						files, err := s.resolver.SearchFiles(ctx, term, &limit, &offset)
 						if err != nil {
@@ -203,6 +320,8 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 					getIntPtr(variables, "maxSize"),
 					getStringPtr(variables, "dateFrom"),
 					getStringPtr(variables, "dateTo"),
+					getStringPtr(variables, "folderId"),
+					getBoolPtr(variables, "recursive"),
 					getStringPtr(variables, "sortBy"),
 					getStringPtr(variables, "sortOrder"),
 					getIntPtr(variables, "limit"),
@@ -230,6 +349,55 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 					continue
 				}
 				result["mimeTypeCategories"] = categories
+			case "myMimeTypes":
+				mimeTypes, err := s.resolver.MyMimeTypes(ctx)
+				if err != nil {
+					result["myMimeTypes"] = []interface{}{}
+					continue
+				}
+				result["myMimeTypes"] = mimeTypes
+			case "checkFileExists":
+				check, err := s.resolver.CheckFileExists(ctx, getString(variables, "hash"))
+				if err != nil {
+					result["checkFileExists"] = nil
+					continue
+				}
+				result["checkFileExists"] = check
+			case "fileTextContent":
+				textContent, err := s.resolver.FileTextContent(ctx, getString(variables, "id"), getIntPtr(variables, "maxBytes"))
+				if err != nil {
+					result["fileTextContent"] = nil
+					continue
+				}
+				result["fileTextContent"] = textContent
+			case "fileComments":
+				comments, err := s.resolver.FileComments(ctx, getString(variables, "fileId"), getIntPtr(variables, "limit"), getIntPtr(variables, "offset"))
+				if err != nil {
+					result["fileComments"] = []interface{}{}
+					continue
+				}
+				result["fileComments"] = comments
+			case "findSimilarImages":
+				similar, err := s.resolver.FindSimilarImages(ctx, getString(variables, "fileId"), getIntPtr(variables, "threshold"))
+				if err != nil {
+					result["findSimilarImages"] = []interface{}{}
+					continue
+				}
+				result["findSimilarImages"] = similar
+			case "cleanupSuggestions":
+				suggestions, err := s.resolver.CleanupSuggestions(ctx)
+				if err != nil {
+					result["cleanupSuggestions"] = []interface{}{}
+					continue
+				}
+				result["cleanupSuggestions"] = suggestions
+			case "myDedupSavings":
+				savings, err := s.resolver.MyDedupSavings(ctx)
+				if err != nil {
+					result["myDedupSavings"] = nil
+					continue
+				}
+				result["myDedupSavings"] = savings
 			case "adminStats":
 				stats, err := s.resolver.AdminStats(ctx)
 				if err != nil {
@@ -246,6 +414,39 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 					continue
 				}
 				result["adminUsers"] = users
+			case "adminShares":
+				shares, err := s.resolver.AdminShares(ctx,
+					getIntPtr(variables, "limit"),
+					getIntPtr(variables, "offset"),
+					getStringPtr(variables, "ownerId"),
+					getBoolPtr(variables, "isActive"),
+					getStringPtr(variables, "fileName"))
+				if err != nil {
+					result["adminShares"] = []interface{}{}
+					continue
+				}
+				result["adminShares"] = shares
+			case "recentUploads":
+				files, err := s.resolver.RecentUploads(ctx, getIntPtr(variables, "limit"))
+				if err != nil {
+					result["recentUploads"] = []interface{}{}
+					continue
+				}
+				result["recentUploads"] = files
+			case "storageHeatmap":
+				heatmap, err := s.resolver.StorageHeatmap(ctx)
+				if err != nil {
+					result["storageHeatmap"] = []interface{}{}
+					continue
+				}
+				result["storageHeatmap"] = heatmap
+			case "uploadMetrics":
+				metrics, err := s.resolver.UploadMetrics(ctx, getIntPtr(variables, "sinceDays"))
+				if err != nil {
+					result["uploadMetrics"] = nil
+					continue
+				}
+				result["uploadMetrics"] = metrics
 			case "adminUserDetails":
 				userDetails, err := s.resolver.AdminUserDetails(ctx,
 					getString(variables, "userId"))
@@ -261,15 +462,58 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 					continue
 				}
 				result["adminSystemHealth"] = health
+			case "uploadsEnabled":
+				enabled, err := s.resolver.UploadsEnabled(ctx)
+				if err != nil {
+					result["uploadsEnabled"] = nil
+					continue
+				}
+				result["uploadsEnabled"] = enabled
 			case "myFileShares":
 				shares, err := s.resolver.MyFileShares(ctx,
 					getIntPtr(variables, "limit"),
-					getIntPtr(variables, "offset"))
+					getIntPtr(variables, "offset"),
+					getBoolPtr(variables, "activeOnly"))
 				if err != nil {
 					result["myFileShares"] = []interface{}{}
 					continue
 				}
 				result["myFileShares"] = shares
+			case "myFileSharesPage":
+				page, err := s.resolver.MyFileSharesPage(ctx,
+					getIntPtr(variables, "limit"),
+					getIntPtr(variables, "offset"),
+					getBoolPtr(variables, "activeOnly"))
+				if err != nil {
+					result["myFileSharesPage"] = nil
+					continue
+				}
+				result["myFileSharesPage"] = page
+			case "sharedWithMe":
+				page, err := s.resolver.SharedWithMe(ctx,
+					getIntPtr(variables, "limit"),
+					getIntPtr(variables, "offset"))
+				if err != nil {
+					result["sharedWithMe"] = nil
+					continue
+				}
+				result["sharedWithMe"] = page
+			case "fileShare":
+				share, err := s.resolver.FileShare(ctx,
+					getString(variables, "id"))
+				if err != nil {
+					result["fileShare"] = nil
+					continue
+				}
+				result["fileShare"] = share
+			case "fileShareHistory":
+				history, err := s.resolver.FileShareHistory(ctx,
+					getString(variables, "fileId"))
+				if err != nil {
+					result["fileShareHistory"] = nil
+					continue
+				}
+				result["fileShareHistory"] = history
 			case "fileShareStats":
 				stats, err := s.resolver.FileShareStats(ctx,
 					getString(variables, "shareId"))
@@ -293,9 +537,44 @@ func (s *SimpleGraphQLServer) executeQueryOperation(op *ast.OperationDefinition,
 					continue
 				}
 				result["folder"] = folder
+			case "notifications":
+				notifications, err := s.resolver.Notifications(ctx,
+					getBoolPtr(variables, "unreadOnly"),
+					getInt(variables, "limit"),
+					getInt(variables, "offset"))
+				if err != nil {
+					result["notifications"] = nil
+					continue
+				}
+				result["notifications"] = notifications
+			case "unreadNotificationCount":
+				count, err := s.resolver.UnreadNotificationCount(ctx)
+				if err != nil {
+					result["unreadNotificationCount"] = 0
+					continue
+				}
+				result["unreadNotificationCount"] = count
+			case "folderAncestors":
+				ancestors, err := s.resolver.FolderAncestors(ctx,
+					getString(variables, "id"))
+				if err != nil {
+					result["folderAncestors"] = []interface{}{}
+					continue
+				}
+				result["folderAncestors"] = ancestors
+			case "folderSize":
+				size, err := s.resolver.FolderSize(ctx,
+					getString(variables, "id"),
+					getBoolPtr(variables, "recursive"))
+				if err != nil {
+					result["folderSize"] = nil
+					continue
+				}
+				result["folderSize"] = size
 			case "filesByFolder":
 				files, err := s.resolver.FilesByFolder(ctx,
 					getString(variables, "folderId"),
+					getBoolPtr(variables, "recursive"),
 					getInt(variables, "limit"),
 					getInt(variables, "offset"))
 				if err != nil {
@@ -317,6 +596,8 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 	for _, sel := range op.SelectionSet {
 		if field, ok := sel.(*ast.Field); ok {
 			switch field.Name {
+			case "__typename":
+				result[field.Alias] = "Mutation"
 			case "registerUser":
 				if email, ok := variables["email"]; ok {
 					if username, ok := variables["username"]; ok {
@@ -353,6 +634,18 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 					}
 				} else {
 				}
+			case "changePassword":
+				authPayload, err := s.resolver.ChangePassword(ctx, getString(variables, "oldPassword"), getString(variables, "newPassword"), getBoolPtr(variables, "revokeOtherSessions"))
+				if err != nil {
+					return nil, err
+				}
+				result["changePassword"] = authPayload
+			case "updateProfile":
+				authPayload, err := s.resolver.UpdateProfile(ctx, getString(variables, "username"), getBoolPtr(variables, "dedupOptOut"))
+				if err != nil {
+					return nil, err
+				}
+				result["updateProfile"] = authPayload
 			// uploadFile mutation removed - will be rebuilt later
 			case "deleteFile":
 				if id, ok := variables["id"]; ok {
@@ -365,6 +658,84 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 						result["deleteFile"] = success
 					}
 				}
+			case "updateFile":
+				if id, ok := variables["id"]; ok {
+					if idStr, ok := id.(string); ok {
+						name := getStringPtr(variables, "name")
+						description := getStringPtr(variables, "description")
+						downloadName := getStringPtr(variables, "downloadName")
+
+						file, err := s.resolver.UpdateFile(ctx, idStr, name, description, downloadName)
+						if err != nil {
+							result["updateFile"] = nil
+							continue
+						}
+						result["updateFile"] = file
+					}
+				}
+			case "setFilePublic":
+				public := getBoolPtr(variables, "public")
+				if public == nil {
+					result["setFilePublic"] = nil
+					continue
+				}
+				file, err := s.resolver.SetFilePublic(ctx, getString(variables, "id"), *public)
+				if err != nil {
+					result["setFilePublic"] = nil
+					continue
+				}
+				result["setFilePublic"] = file
+			case "grantFileAccess":
+				grant, err := s.resolver.GrantFileAccess(ctx,
+					getString(variables, "fileId"),
+					getString(variables, "userId"),
+					getString(variables, "permission"))
+				if err != nil {
+					result["grantFileAccess"] = nil
+					continue
+				}
+				result["grantFileAccess"] = grant
+			case "addFileComment":
+				comment, err := s.resolver.AddFileComment(ctx, getString(variables, "fileId"), getString(variables, "body"))
+				if err != nil {
+					result["addFileComment"] = nil
+					continue
+				}
+				result["addFileComment"] = comment
+			case "deleteFileComment":
+				success, err := s.resolver.DeleteFileComment(ctx, getString(variables, "commentId"))
+				if err != nil {
+					result["deleteFileComment"] = false
+					continue
+				}
+				result["deleteFileComment"] = success
+			case "revokeFileAccess":
+				success, err := s.resolver.RevokeFileAccess(ctx,
+					getString(variables, "fileId"),
+					getString(variables, "userId"))
+				if err != nil {
+					result["revokeFileAccess"] = false
+					continue
+				}
+				result["revokeFileAccess"] = success
+			case "markNotificationRead":
+				if id, ok := variables["id"]; ok {
+					if idStr, ok := id.(string); ok {
+						success, err := s.resolver.MarkNotificationRead(ctx, idStr)
+						if err != nil {
+							result["markNotificationRead"] = false
+							continue
+						}
+						result["markNotificationRead"] = success
+					}
+				}
+			case "markAllNotificationsRead":
+				count, err := s.resolver.MarkAllNotificationsRead(ctx)
+				if err != nil {
+					result["markAllNotificationsRead"] = 0
+					continue
+				}
+				result["markAllNotificationsRead"] = count
 			case "adminDeleteUser":
 				if userID, ok := variables["userId"]; ok {
 					if userIDStr, ok := userID.(string); ok {
@@ -391,6 +762,47 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 						}
 					}
 				}
+			case "adminTransferFiles":
+				fromUserID := getString(variables, "fromUserId")
+				toUserID := getString(variables, "toUserId")
+				count, err := s.resolver.AdminTransferFiles(ctx, fromUserID, toUserID)
+				if err != nil {
+					result["adminTransferFiles"] = nil
+					continue
+				}
+				result["adminTransferFiles"] = count
+			case "adminTransferFile":
+				fileID := getString(variables, "fileId")
+				toUserID := getString(variables, "toUserId")
+				success, err := s.resolver.AdminTransferFile(ctx, fileID, toUserID)
+				if err != nil {
+					result["adminTransferFile"] = false
+					continue
+				}
+				result["adminTransferFile"] = success
+			case "adminSetUserQuota":
+				success, err := s.resolver.AdminSetUserQuota(ctx, getString(variables, "userId"), getIntPtr(variables, "quotaMb"))
+				if err != nil {
+					result["adminSetUserQuota"] = false
+					continue
+				}
+				result["adminSetUserQuota"] = success
+			case "adminRevokeShare":
+				success, err := s.resolver.AdminRevokeShare(ctx, getString(variables, "shareId"))
+				if err != nil {
+					result["adminRevokeShare"] = false
+					continue
+				}
+				result["adminRevokeShare"] = success
+			case "setUploadsEnabled":
+				if enabled := getBoolPtr(variables, "enabled"); enabled != nil {
+					current, err := s.resolver.SetUploadsEnabled(ctx, *enabled)
+					if err != nil {
+						result["setUploadsEnabled"] = nil
+						continue
+					}
+					result["setUploadsEnabled"] = current
+				}
 			case "createFileShare":
 				fmt.Printf("DEBUG: Processing createFileShare mutation\n")
 				if fileID, ok := variables["fileId"]; ok {
@@ -398,9 +810,13 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 						fmt.Printf("DEBUG: FileID: %s\n", fileIDStr)
 						expiresAt := getStringPtr(variables, "expiresAt")
 						maxDownloads := getIntPtr(variables, "maxDownloads")
+						maxBandwidthBps := getIntPtr(variables, "maxBandwidthBps")
+						forceDownload := getBoolPtr(variables, "forceDownload")
+						allowedEmailDomains := getStringSlice(variables, "allowedEmailDomains")
+						burnAfterDownload := getBoolPtr(variables, "burnAfterDownload")
 
 						fmt.Printf("DEBUG: Calling resolver.CreateFileShare\n")
-						fileShare, err := s.resolver.CreateFileShare(ctx, fileIDStr, expiresAt, maxDownloads)
+						fileShare, err := s.resolver.CreateFileShare(ctx, fileIDStr, expiresAt, maxDownloads, maxBandwidthBps, forceDownload, allowedEmailDomains, burnAfterDownload)
 						if err != nil {
 							fmt.Printf("DEBUG: CreateFileShare error: %v\n", err)
 							result["createFileShare"] = nil
@@ -440,11 +856,30 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 						result["deleteFileShare"] = success
 					}
 				}
+			case "regenerateShareToken":
+				fileShare, err := s.resolver.RegenerateShareToken(ctx, getString(variables, "shareId"))
+				if err != nil {
+					result["regenerateShareToken"] = nil
+					continue
+				}
+				result["regenerateShareToken"] = fileShare
+			case "shareFileByEmail":
+				shared, err := s.resolver.ShareFileByEmail(ctx,
+					getString(variables, "fileId"),
+					getString(variables, "email"),
+					getStringPtr(variables, "message"))
+				if err != nil {
+					result["shareFileByEmail"] = nil
+					continue
+				}
+				result["shareFileByEmail"] = shared
 			case "createFolder":
 				if name, ok := variables["name"]; ok {
 					if nameStr, ok := name.(string); ok {
 						parentID := getStringPtr(variables, "parentId")
-						folder, err := s.resolver.CreateFolder(ctx, nameStr, parentID)
+						folder, err := s.resolver.CreateFolder(ctx, nameStr, parentID,
+							getStringPtr(variables, "color"),
+							getStringPtr(variables, "icon"))
 						if err != nil {
 							result["createFolder"] = nil
 							continue
@@ -455,16 +890,15 @@ func (s *SimpleGraphQLServer) executeMutationOperation(op *ast.OperationDefiniti
 			case "updateFolder":
 				if id, ok := variables["id"]; ok {
 					if idStr, ok := id.(string); ok {
-						if name, ok := variables["name"]; ok {
-							if nameStr, ok := name.(string); ok {
-								folder, err := s.resolver.UpdateFolder(ctx, idStr, nameStr)
-								if err != nil {
-									result["updateFolder"] = nil
-									continue
-								}
-								result["updateFolder"] = folder
-							}
+						folder, err := s.resolver.UpdateFolder(ctx, idStr,
+							getString(variables, "name"),
+							getStringPtr(variables, "color"),
+							getStringPtr(variables, "icon"))
+						if err != nil {
+							result["updateFolder"] = nil
+							continue
 						}
+						result["updateFolder"] = folder
 					}
 				}
 			case "deleteFolder":
@@ -490,10 +924,10 @@ func (s *SimpleGraphQLServer) handleMultipartRequest(c *gin.Context) {
 	fmt.Println("DEBUG: Starting multipart request handling")
 
 	// Debug: Check if user is in context
-	if user, exists := c.Get("user"); exists {
-		fmt.Printf("DEBUG: User found in Gin context (multipart): %+v\n", user)
+	if user, ok := middleware.CurrentUser(c); ok {
+		fmt.Printf("DEBUG: User found in request context (multipart): %+v\n", user)
 	} else {
-		fmt.Println("DEBUG: No user found in Gin context (multipart)")
+		fmt.Println("DEBUG: No user found in request context (multipart)")
 	}
 	// Parse the multipart form
 	err := c.Request.ParseMultipartForm(32 << 20) // 32 MB max
@@ -590,16 +1024,33 @@ func (s *SimpleGraphQLServer) handleMultipartRequest(c *gin.Context) {
 	}
 	fmt.Println("DEBUG: Query parsed successfully")
 
-	// Create context with user
+	// The request context already carries the user set by the auth middleware
 	ctx := c.Request.Context()
-	if user, exists := c.Get("user"); exists {
-		ctx = context.WithValue(ctx, "user", user)
+	if user, ok := middleware.UserFromContext(ctx); ok {
 		fmt.Printf("DEBUG: User context set: %+v\n", user)
 	}
 
+	if errs := validateDocument(doc); errs != nil {
+		c.JSON(http.StatusBadRequest, GraphQLResponse{Errors: errs})
+		return
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, GraphQLResponse{
+			Errors: []string{err.Error()},
+		})
+		return
+	}
+
+	if errs := validateVariables(op, req.Variables); errs != nil {
+		c.JSON(http.StatusBadRequest, GraphQLResponse{Errors: errs})
+		return
+	}
+
 	// Execute the query
 	fmt.Printf("DEBUG: Executing query with variables: %+v\n", req.Variables)
-	result, err := s.executeQuery(doc, req.Variables, c, ctx)
+	result, err := s.executeQuery(op, req.Variables, c, ctx)
 	if err != nil {
 		fmt.Printf("ERROR: Query execution failed: %v\n", err)
 		c.JSON(http.StatusInternalServerError, GraphQLResponse{
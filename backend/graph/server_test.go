@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const twoOperationDocument = `
+	query CurrentUser { me { id } }
+	query Unread { unreadNotificationCount }
+`
+
+func TestSelectOperation(t *testing.T) {
+	doc := parseTestQuery(t, twoOperationDocument)
+
+	op, err := selectOperation(doc, "Unread")
+	require.NoError(t, err)
+	assert.Equal(t, "Unread", op.Name)
+
+	op, err = selectOperation(doc, "CurrentUser")
+	require.NoError(t, err)
+	assert.Equal(t, "CurrentUser", op.Name)
+
+	_, err = selectOperation(doc, "")
+	assert.ErrorContains(t, err, "operationName is required")
+
+	_, err = selectOperation(doc, "Missing")
+	assert.ErrorContains(t, err, "unknown operation")
+}
+
+func TestSelectOperation_SingleOperation(t *testing.T) {
+	doc := parseTestQuery(t, "{ me { id } }")
+
+	op, err := selectOperation(doc, "")
+	require.NoError(t, err)
+	assert.Same(t, doc.Operations[0], op)
+
+	_, err = selectOperation(doc, "Other")
+	assert.Error(t, err)
+}
+
+func TestHandleGraphQL_OperationName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := &SimpleGraphQLServer{resolver: &Resolver{}, limits: DefaultQueryLimits()}
+
+	post := func(req GraphQLRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+		server.HandleGraphQL(c)
+		return w
+	}
+
+	// Only the named operation runs; Unread would fail without a user
+	w := post(GraphQLRequest{Query: twoOperationDocument, OperationName: "CurrentUser"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"me":null}}`, w.Body.String())
+
+	w = post(GraphQLRequest{Query: twoOperationDocument})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "operationName is required")
+
+	w = post(GraphQLRequest{Query: twoOperationDocument, OperationName: "Missing"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown operation")
+}
+
+func TestHandleGraphQL_RecentUploadsRequiresUser(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{
+		Query:     `query($limit: Int) { recentUploads(limit: $limit) { id originalName uploader { username } } }`,
+		Variables: map[string]interface{}{"limit": float64(5)},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":{"recentUploads":[]}}`, w.Body.String())
+}
+
+func TestHandleGraphQL_StorageHeatmapRequiresUser(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{
+		Query: `{ storageHeatmap { tier fileCount objectCount totalBytes } }`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":{"storageHeatmap":[]}}`, w.Body.String())
+}
+
+func TestHandleGraphQL_UploadMetricsRequiresUser(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{
+		Query:     `query($days: Int) { uploadMetrics(sinceDays: $days) { attempts failures failureReasons { outcome count } } }`,
+		Variables: map[string]interface{}{"days": float64(30)},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":{"uploadMetrics":null}}`, w.Body.String())
+}
+
+func TestHandleGraphQL_FolderSizeRequiresUser(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{
+		Query:     `query($id: ID!) { folderSize(id: $id, recursive: true) }`,
+		Variables: map[string]interface{}{"id": "00000000-0000-0000-0000-000000000001"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":{"folderSize":null}}`, w.Body.String())
+}
+
+func TestHandleGraphQL_SharedWithMeRequiresUser(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{
+		Query:     `query($limit: Int) { sharedWithMe(limit: $limit) { files { sources } totalCount hasMore } }`,
+		Variables: map[string]interface{}{"limit": float64(20)},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":{"sharedWithMe":null}}`, w.Body.String())
+}
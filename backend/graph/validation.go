@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"errors"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+// validateDocument checks a parsed document against schema.graphqls (parsedSchema, embedded
+// by generated.go): unknown fields or arguments, missing required arguments, variables used
+// with the wrong type, selections on scalars and so on. The executor looks fields up by name
+// and skips any it doesn't know, so without this typos would silently return nothing.
+func validateDocument(doc *ast.QueryDocument) []string {
+	return errorMessages(validator.ValidateWithRules(parsedSchema, doc, nil))
+}
+
+// validateVariables checks the request's variable values against the operation's variable
+// definitions: required variables must be set and values must suit their declared types. The
+// document must already have passed validateDocument, which resolves the declared types.
+func validateVariables(op *ast.OperationDefinition, variables map[string]interface{}) []string {
+	_, err := validator.VariableValues(parsedSchema, op, variables)
+	if err == nil {
+		return nil
+	}
+
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) {
+		return errorMessages(gqlerror.List{gqlErr})
+	}
+	return []string{err.Error()}
+}
+
+// errorMessages formats validation errors with their position, like parse errors
+func errorMessages(errs gqlerror.List) []string {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return messages
+}
@@ -0,0 +1,163 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/introspection"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postGraphQL(t *testing.T, req GraphQLRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := &SimpleGraphQLServer{resolver: &Resolver{}, limits: DefaultQueryLimits()}
+
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(string(body)))
+	server.HandleGraphQL(c)
+	return w
+}
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		error string
+	}{
+		{"unknown top-level field", `{ filez { id } }`, `Cannot query field "filez" on type "Query"`},
+		{"unknown nested field", `{ me { id emial } }`, `Cannot query field "emial" on type "User"`},
+		{"unknown argument", `query($id: ID!) { file(fileId: $id) { id } }`, `Unknown argument "fileId"`},
+		{"missing required argument", `{ file { id } }`, `argument "id" of type "ID!" is required`},
+		{"variable of the wrong type", `query($limit: String) { files(limit: $limit) { id } }`, `Variable "$limit" of type "String" used in position expecting type "Int"`},
+		{"undefined variable", `{ files(limit: $limit) { id } }`, `Variable "$limit" is not defined`},
+		{"selection on a scalar", `{ unreadNotificationCount { id } }`, `must not have a selection`},
+		{"object without selection", `{ me }`, `must have a selection of subfields`},
+		{"unknown mutation", `mutation { uploadFile { id } }`, `Cannot query field "uploadFile" on type "Mutation"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateDocument(parseTestQuery(t, tt.query))
+			require.NotEmpty(t, errs)
+			assert.Contains(t, strings.Join(errs, "\n"), tt.error)
+		})
+	}
+}
+
+func TestValidateDocument_AcceptsValidQueries(t *testing.T) {
+	queries := []string{
+		`query GetFiles($limit: Int, $offset: Int) { files(limit: $limit, offset: $offset) { id originalName uploader { username } } }`,
+		`mutation DeleteFileShare($shareId: ID!) { deleteFileShare(shareId: $shareId) }`,
+		`{ me { ...UserFields } } fragment UserFields on User { id email }`,
+		`{ __typename }`,
+	}
+
+	for _, query := range queries {
+		assert.Empty(t, validateDocument(parseTestQuery(t, query)), query)
+	}
+}
+
+func TestValidateVariables(t *testing.T) {
+	doc := parseTestQuery(t, `query($id: ID!, $limit: Int) { fileComments(fileId: $id, limit: $limit) { id } }`)
+	require.Empty(t, validateDocument(doc))
+	op := doc.Operations[0]
+
+	assert.Empty(t, validateVariables(op, map[string]interface{}{"id": "abc", "limit": float64(5)}))
+	assert.Contains(t, strings.Join(validateVariables(op, map[string]interface{}{"limit": float64(5)}), "\n"), "must be defined")
+	assert.Contains(t, strings.Join(validateVariables(op, map[string]interface{}{"id": "abc", "limit": "five"}), "\n"), "limit")
+	assert.NotEmpty(t, validateVariables(op, map[string]interface{}{"id": nil}))
+}
+
+func TestHandleGraphQL_RejectsInvalidQueries(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{Query: `{ me { id username emial } }`})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `Cannot query field \"emial\" on type \"User\". Did you mean \"email\"?`)
+
+	w = postGraphQL(t, GraphQLRequest{
+		Query:     `query($limit: Int) { recentFiles(limit: $limit) { id } }`,
+		Variables: map[string]interface{}{"limit": "ten"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postGraphQL(t, GraphQLRequest{Query: `{ me { id } __typename }`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"me":null,"__typename":"Query"}}`, w.Body.String())
+}
+
+func TestHandleGraphQL_Introspection(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{Query: introspection.Query})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Data struct {
+			Schema struct {
+				QueryType    struct{ Name string }
+				MutationType struct{ Name string }
+				Types        []struct {
+					Kind   string
+					Name   string
+					Fields []struct {
+						Name string
+						Args []struct{ Name string }
+						Type struct {
+							Kind   string
+							OfType *struct{ Name string }
+						}
+					}
+				}
+			} `json:"__schema"`
+		}
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Query", response.Data.Schema.QueryType.Name)
+	assert.Equal(t, "Mutation", response.Data.Schema.MutationType.Name)
+
+	found := false
+	for _, typ := range response.Data.Schema.Types {
+		if typ.Name != "Query" {
+			continue
+		}
+		for _, field := range typ.Fields {
+			if field.Name == "file" {
+				found = true
+				require.Len(t, field.Args, 1)
+				assert.Equal(t, "id", field.Args[0].Name)
+				assert.Equal(t, "OBJECT", typ.Kind)
+			}
+		}
+	}
+	assert.True(t, found, "Query.file should be introspectable")
+}
+
+func TestHandleGraphQL_IntrospectType(t *testing.T) {
+	w := postGraphQL(t, GraphQLRequest{
+		Query:     `query($name: String!) { __type(name: $name) { __typename name kind fields { name } } }`,
+		Variables: map[string]interface{}{"name": "DedupSavings"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"data":{"__type":{
+		"__typename":"__Type",
+		"name":"DedupSavings",
+		"kind":"OBJECT",
+		"fields":[{"name":"duplicateCount"},{"name":"bytesSaved"}]
+	}}}`, w.Body.String())
+
+	w = postGraphQL(t, GraphQLRequest{Query: `{ __type(name: "Missing") { name } }`})
+	assert.JSONEq(t, `{"data":{"__type":null}}`, w.Body.String())
+}
+
+func TestCheckQueryLimits_AllowsIntrospectionQuery(t *testing.T) {
+	assert.NoError(t, checkQueryLimits(parseTestQuery(t, introspection.Query), DefaultQueryLimits()))
+
+	deep := "{ __schema { types " + strings.Repeat("{ fields { type ", 10) + "{ name }" + strings.Repeat(" } }", 10) + " } }"
+	assert.ErrorContains(t, checkQueryLimits(parseTestQuery(t, deep), DefaultQueryLimits()), "introspection query depth")
+}
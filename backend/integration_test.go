@@ -14,6 +14,7 @@ import (
 
 	"filevault/internal/database"
 	"filevault/internal/handlers"
+	"filevault/internal/middleware"
 	"filevault/internal/models"
 	"filevault/internal/repositories"
 	"filevault/internal/services"
@@ -124,8 +125,12 @@ func TestFileSharingIntegration(t *testing.T) {
 		userFileShareRepo,
 		fileRepo,
 		userRepo,
+		nil, // user folder share repository
+		nil, // folder repository
 		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
 		nil, // websocket service
+		nil, // share expiry service
+		0,   // default presigned URL expiry
 	)
 	require.NoError(t, err)
 
@@ -218,6 +223,410 @@ func TestFileSharingIntegration(t *testing.T) {
 	})
 }
 
+func TestFolderSizeIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	user := createTestUser(t, testDB.db, "sizeuser", "sizeuser@test.com")
+	folderService := services.NewFolderService(repositories.NewFolderRepository(testDB.db))
+	fileRepo := repositories.NewFileRepository(testDB.db)
+
+	// Projects (100) > Reports (200, plus a deduplicated copy of it) > Archive (400)
+	projects, err := folderService.CreateFolder(user.ID, &models.CreateFolderRequest{Name: "Projects"})
+	require.NoError(t, err)
+	reports, err := folderService.CreateFolder(user.ID, &models.CreateFolderRequest{Name: "Reports", ParentID: &projects.ID})
+	require.NoError(t, err)
+	archive, err := folderService.CreateFolder(user.ID, &models.CreateFolderRequest{Name: "Archive", ParentID: &reports.ID})
+	require.NoError(t, err)
+
+	addFile := func(folderID uuid.UUID, name string, size int64, s3Key string) {
+		file := &models.File{
+			ID:           uuid.New(),
+			Filename:     name,
+			OriginalName: name,
+			MimeType:     "application/pdf",
+			Size:         size,
+			Hash:         "hash-" + s3Key,
+			S3Key:        s3Key,
+			UploaderID:   user.ID,
+			FolderID:     &folderID,
+		}
+		require.NoError(t, fileRepo.Create(file))
+	}
+	addFile(projects.ID, "plan.pdf", 100, "test/plan")
+	addFile(reports.ID, "q1.pdf", 200, "test/q1")
+	addFile(reports.ID, "q1 copy.pdf", 200, "test/q1")
+	addFile(archive.ID, "old.pdf", 400, "test/old")
+	addFile(archive.ID, "q1 again.pdf", 200, "test/q1")
+
+	size, err := folderService.GetFolderSize(projects.ID, user.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), size)
+
+	size, err = folderService.GetFolderSize(projects.ID, user.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(700), size)
+
+	size, err = folderService.GetFolderSize(reports.ID, user.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), size)
+
+	folders, err := folderService.GetUserFolders(user.ID)
+	require.NoError(t, err)
+	require.NoError(t, folderService.FillFolderSizes(folders, user.ID))
+	sizes := make(map[uuid.UUID]int64)
+	for _, folder := range folders {
+		sizes[folder.ID] = folder.SizeBytes
+	}
+	assert.Equal(t, map[uuid.UUID]int64{projects.ID: 700, reports.ID: 600, archive.ID: 600}, sizes)
+
+	other := createTestUser(t, testDB.db, "sizeother", "sizeother@test.com")
+	_, err = folderService.GetFolderSize(projects.ID, other.ID, true)
+	assert.Error(t, err)
+}
+
+func TestBurnAfterDownloadShareIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	user := createTestUser(t, testDB.db, "burnuser", "burnuser@test.com")
+	file := createTestFile(t, testDB.db, user.ID, "one-time.pdf")
+	shareRepo := repositories.NewFileShareRepository(testDB.db)
+
+	share := &models.FileShare{
+		ID:                uuid.New(),
+		FileID:            file.ID,
+		ShareToken:        "temp",
+		IsActive:          true,
+		BurnAfterDownload: true,
+	}
+	require.NoError(t, shareRepo.Create(share))
+	token := share.ShareToken
+
+	count, ok, err := shareRepo.IncrementDownloadCount(share.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, count)
+
+	// The first download deactivated the share and retired its token
+	_, err = shareRepo.GetByTokenWithFile(token)
+	assert.Error(t, err)
+	_, ok, err = shareRepo.IncrementDownloadCount(share.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	burned, err := shareRepo.GetByID(share.ID)
+	require.NoError(t, err)
+	assert.False(t, burned.IsActive)
+	assert.NotEqual(t, token, burned.ShareToken)
+}
+
+func TestDownloadLogRetentionIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	user := createTestUser(t, testDB.db, "retentionuser", "retentionuser@test.com")
+	file := createTestFile(t, testDB.db, user.ID, "retained.pdf")
+	shareRepo := repositories.NewFileShareRepository(testDB.db)
+	share := &models.FileShare{ID: uuid.New(), FileID: file.ID, ShareToken: "temp", IsActive: true}
+	require.NoError(t, shareRepo.Create(share))
+
+	// Three downloads 100 days ago (two on the same day), one 99 days ago and one today
+	now := time.Now()
+	noon := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, now.Location())
+	for _, at := range []time.Time{
+		noon.AddDate(0, 0, -100), noon.AddDate(0, 0, -100).Add(time.Minute), noon.AddDate(0, 0, -99), now,
+	} {
+		_, err := testDB.db.Exec(`INSERT INTO download_logs (id, share_id, downloaded_at) VALUES ($1, $2, $3)`, uuid.New(), share.ID, at)
+		require.NoError(t, err)
+	}
+
+	removed, err := shareRepo.RollUpDownloadLogs(now.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), removed)
+
+	var days, summarized int
+	err = testDB.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(download_count), 0) FROM download_log_daily WHERE share_id = $1`, share.ID).Scan(&days, &summarized)
+	require.NoError(t, err)
+	assert.Equal(t, 2, days)
+	assert.Equal(t, 3, summarized)
+
+	recent, err := shareRepo.GetRecentDownloads(share.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, recent, 1)
+
+	// Share statistics still count the rolled-up downloads
+	count, err := shareRepo.GetDownloadStats(share.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+}
+
+func TestUploadIdempotencyKeyIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	user := createTestUser(t, testDB.db, "idempotencyuser", "idempotencyuser@test.com")
+	file := createTestFile(t, testDB.db, user.ID, "retried.pdf")
+	repo := repositories.NewUploadIdempotencyRepository(testDB.db)
+	now := time.Now()
+	since, pendingSince := now.Add(-time.Hour), now.Add(-15*time.Minute)
+
+	reserved, fileID, err := repo.Reserve(user.ID, "retry-1", since, pendingSince)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// An overlapping retry sees the upload in progress
+	reserved, fileID, err = repo.Reserve(user.ID, "retry-1", since, pendingSince)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Nil(t, fileID)
+
+	// A failed upload hands the key to the next retry
+	require.NoError(t, repo.Release(user.ID, "retry-1"))
+	reserved, _, err = repo.Reserve(user.ID, "retry-1", since, pendingSince)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	require.NoError(t, repo.Complete(user.ID, "retry-1", file.ID))
+	require.NoError(t, repo.Release(user.ID, "retry-1"))
+	reserved, fileID, err = repo.Reserve(user.ID, "retry-1", since, pendingSince)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	require.NotNil(t, fileID)
+	assert.Equal(t, file.ID, *fileID)
+
+	// A reservation abandoned past the pending timeout is taken over
+	_, err = testDB.db.Exec(`INSERT INTO upload_idempotency_keys (user_id, idempotency_key, created_at) VALUES ($1, 'abandoned', $2)`, user.ID, now.Add(-time.Hour/2))
+	require.NoError(t, err)
+	reserved, _, err = repo.Reserve(user.ID, "abandoned", since, pendingSince)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// Keys past the TTL can be reused and are pruned
+	_, err = testDB.db.Exec(`UPDATE upload_idempotency_keys SET created_at = $2 WHERE user_id = $1 AND idempotency_key = 'retry-1'`, user.ID, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	deleted, err := repo.DeleteExpired(since)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	reserved, _, err = repo.Reserve(user.ID, "retry-1", since, pendingSince)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+}
+
+func TestLoginLockoutDoesNotRevealAccountsIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	createTestUser(t, testDB.db, "lockeduser", "lockeduser@test.com")
+	authService := services.NewAuthService(repositories.NewUserRepository(testDB.db), "test-secret", services.TokenConfig{})
+	authService.SetLoginLockout(services.LoginLockoutPolicy{MaxFailures: 3, Window: 15 * time.Minute}, nil, nil)
+
+	// An existing and an unknown account answer the same sequence of failed logins identically
+	attempts := func(identifier string) []string {
+		var messages []string
+		for i := 0; i < 4; i++ {
+			_, _, err := authService.LoginUser(identifier, "wrong-password", "203.0.113.7")
+			require.Error(t, err)
+			messages = append(messages, err.Error())
+		}
+		return messages
+	}
+	existing := attempts("lockeduser@test.com")
+	assert.Equal(t, services.ErrAccountLocked.Error(), existing[3])
+	assert.Equal(t, existing, attempts("nobody@test.com"))
+}
+
+func TestTransferFilesIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	leaver := createTestUser(t, testDB.db, "leaver", "leaver@test.com")
+	recipient := createTestUser(t, testDB.db, "successor", "successor@test.com")
+	viewer := createTestUser(t, testDB.db, "colleague", "colleague@test.com")
+	userRepo := repositories.NewUserRepository(testDB.db)
+	fileRepo := repositories.NewFileRepository(testDB.db)
+	folderRepo := repositories.NewFolderRepository(testDB.db)
+	folderService := services.NewFolderService(folderRepo)
+	fileShareRepo := repositories.NewUserFileShareRepository(testDB.db)
+	folderShareRepo := repositories.NewUserFolderShareRepository(testDB.db)
+	grantRepo := repositories.NewFileAccessGrantRepository(testDB.db)
+	adminService := services.NewAdminService(userRepo, fileRepo, repositories.NewFileHashRepository(testDB.db), repositories.NewFileShareRepository(testDB.db), nil, nil, nil)
+
+	// The recipient already has a folder with the container's name
+	_, err := folderService.CreateFolder(recipient.ID, &models.CreateFolderRequest{Name: "Transferred from leaver"})
+	require.NoError(t, err)
+
+	// Projects > Specs holds spec.pdf; notes.pdf is at the leaver's root
+	projects, err := folderService.CreateFolder(leaver.ID, &models.CreateFolderRequest{Name: "Projects"})
+	require.NoError(t, err)
+	specs, err := folderService.CreateFolder(leaver.ID, &models.CreateFolderRequest{Name: "Specs", ParentID: &projects.ID})
+	require.NoError(t, err)
+	notes := createTestFile(t, testDB.db, leaver.ID, "transfer-notes.pdf")
+	spec := &models.File{ID: uuid.New(), Filename: "spec.pdf", OriginalName: "spec.pdf", MimeType: "application/pdf", Size: 1024, Hash: "hash-spec", S3Key: "test/spec.pdf", UploaderID: leaver.ID, FolderID: &specs.ID}
+	require.NoError(t, fileRepo.Create(spec))
+
+	// Shares and grants the leaver made to a colleague, and to the recipient
+	now := time.Now()
+	for _, to := range []uuid.UUID{viewer.ID, recipient.ID} {
+		require.NoError(t, fileShareRepo.Create(&models.UserFileShare{ID: uuid.New(), FileID: notes.ID, FromUserID: leaver.ID, ToUserID: to, CreatedAt: now, UpdatedAt: now}))
+		require.NoError(t, folderShareRepo.Create(&models.UserFolderShare{ID: uuid.New(), FolderID: projects.ID, FromUserID: leaver.ID, ToUserID: to, CreatedAt: now, UpdatedAt: now}))
+		require.NoError(t, grantRepo.Upsert(&models.FileAccessGrant{ID: uuid.New(), FileID: spec.ID, GranteeID: to, GrantedBy: leaver.ID, Permission: models.FilePermissionView}))
+	}
+
+	count, err := adminService.TransferFiles(leaver.ID, recipient.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// The items land in a container named after the leaver, with a suffix since the name is taken
+	var containerID uuid.UUID
+	err = testDB.db.QueryRow(`SELECT id FROM folders WHERE owner_id = $1 AND parent_id IS NULL AND name = 'Transferred from leaver (2)'`, recipient.ID).Scan(&containerID)
+	require.NoError(t, err)
+
+	movedProjects, err := folderRepo.GetByID(projects.ID)
+	require.NoError(t, err)
+	assert.Equal(t, recipient.ID, movedProjects.OwnerID)
+	require.NotNil(t, movedProjects.ParentID)
+	assert.Equal(t, containerID, *movedProjects.ParentID)
+	assert.Equal(t, "Transferred from leaver (2)/Projects", movedProjects.Path)
+	movedSpecs, err := folderRepo.GetByID(specs.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Transferred from leaver (2)/Projects/Specs", movedSpecs.Path)
+
+	movedNotes, err := fileRepo.GetByID(notes.ID)
+	require.NoError(t, err)
+	assert.Equal(t, recipient.ID, movedNotes.UploaderID)
+	require.NotNil(t, movedNotes.FolderID)
+	assert.Equal(t, containerID, *movedNotes.FolderID)
+	movedSpec, err := fileRepo.GetByID(spec.ID)
+	require.NoError(t, err)
+	assert.Equal(t, recipient.ID, movedSpec.UploaderID)
+	require.NotNil(t, movedSpec.FolderID)
+	assert.Equal(t, specs.ID, *movedSpec.FolderID)
+
+	// The colleague's shares and grant now come from the recipient; the recipient's own are gone
+	for _, table := range []struct{ name, from, to string }{
+		{"user_file_shares", "from_user_id", "to_user_id"},
+		{"user_folder_shares", "from_user_id", "to_user_id"},
+		{"file_access_grants", "granted_by", "grantee_id"},
+	} {
+		var fromRecipient, toRecipient, fromLeaver int
+		err = testDB.db.QueryRow(fmt.Sprintf(`
+			SELECT COUNT(*) FILTER (WHERE %[1]s = $1 AND %[2]s = $2),
+			       COUNT(*) FILTER (WHERE %[2]s = $1),
+			       COUNT(*) FILTER (WHERE %[1]s = $3)
+			FROM %[3]s
+		`, table.from, table.to, table.name), recipient.ID, viewer.ID, leaver.ID).Scan(&fromRecipient, &toRecipient, &fromLeaver)
+		require.NoError(t, err)
+		assert.Equal(t, 1, fromRecipient, table.name)
+		assert.Zero(t, toRecipient, table.name)
+		assert.Zero(t, fromLeaver, table.name)
+	}
+}
+
+// deleteRecordingS3 records the objects deleted through it
+type deleteRecordingS3 struct {
+	services.S3ServiceInterface
+	deleted []string
+}
+
+func (s *deleteRecordingS3) DeleteFile(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestTransferPerUserHashRecordsIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	leaver := createTestUser(t, testDB.db, "hashleaver", "hashleaver@test.com")
+	recipient := createTestUser(t, testDB.db, "hashrecipient", "hashrecipient@test.com")
+	fileRepo := repositories.NewFileRepository(testDB.db)
+	hashRepo := repositories.NewFileHashRepository(testDB.db)
+	userRepo := repositories.NewUserRepository(testDB.db)
+
+	storeOwned := func(owner *models.User, filename, hash, s3Key string) *models.File {
+		require.NoError(t, hashRepo.Create(&models.FileHash{ID: uuid.New(), Hash: hash, S3Key: s3Key, Size: 1024, MimeType: "application/pdf", OwnerID: &owner.ID}))
+		file := &models.File{ID: uuid.New(), Filename: filename, OriginalName: filename, MimeType: "application/pdf", Size: 1024, Hash: hash, S3Key: s3Key, UploaderID: owner.ID}
+		require.NoError(t, fileRepo.Create(file))
+		return file
+	}
+	report := storeOwned(leaver, "report.pdf", "hash-report", "files/leaver-report")
+	// Both users stored the same manual, each under their own hash record
+	manual := storeOwned(leaver, "manual.pdf", "hash-manual", "files/leaver-manual")
+	storeOwned(recipient, "manual.pdf", "hash-manual", "files/recipient-manual")
+
+	count, unusedKeys, err := fileRepo.TransferAllFiles(leaver.ID, recipient.ID, "Transferred from hashleaver")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	// The leaver's copy of the manual gave way to the recipient's
+	assert.Equal(t, []string{"files/leaver-manual"}, unusedKeys)
+	moved, err := fileRepo.GetByID(manual.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "files/recipient-manual", moved.S3Key)
+
+	record, err := hashRepo.GetByOwnerAndHash(recipient.ID, "hash-report")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, "files/leaver-report", record.S3Key)
+
+	// Removing the old owner no longer takes the transferred content's hash record with it
+	require.NoError(t, userRepo.Delete(leaver.ID))
+	record, err = hashRepo.GetByOwnerAndHash(recipient.ID, "hash-report")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+
+	s3 := &deleteRecordingS3{}
+	fileService := services.NewFileService(fileRepo, hashRepo, nil, nil, s3, services.NewMimeValidationService(), nil, nil)
+	fileService.SetDedupScope(services.DedupScopePerUser)
+	require.NoError(t, fileService.DeleteFile(context.Background(), report.ID, recipient.ID))
+	assert.Equal(t, []string{"files/leaver-report"}, s3.deleted)
+	record, err = hashRepo.GetByOwnerAndHash(recipient.ID, "hash-report")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
 func TestFileSharingAPIEndpoints(t *testing.T) {
 	// Skip if not in CI environment
 	if os.Getenv("CI") == "" {
@@ -246,8 +655,12 @@ func TestFileSharingAPIEndpoints(t *testing.T) {
 		userFileShareRepo,
 		fileRepo,
 		userRepo,
+		nil, // user folder share repository
+		nil, // folder repository
 		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
 		nil, // websocket service
+		nil, // share expiry service
+		0,   // default presigned URL expiry
 	)
 	require.NoError(t, err)
 
@@ -257,14 +670,15 @@ func TestFileSharingAPIEndpoints(t *testing.T) {
 
 	// Add authentication middleware (simplified for testing)
 	router.Use(func(c *gin.Context) {
-		c.Set("user", user1) // Set user1 as authenticated user
+		middleware.SetUser(c, user1) // Set user1 as authenticated user
 		c.Next()
 	})
 
 	// Register routes
-	handlers.RegisterFileShareRoutes(router, fileShareService, func(c *gin.Context) {
+	skipAuth := func(c *gin.Context) {
 		c.Next() // Skip auth for testing
-	})
+	}
+	handlers.RegisterFileShareRoutes(router, fileShareService, skipAuth, skipAuth, nil, nil)
 
 	// Test 1: Share file with user via API
 	t.Run("ShareFileWithUserAPI", func(t *testing.T) {
@@ -293,7 +707,7 @@ func TestFileSharingAPIEndpoints(t *testing.T) {
 	t.Run("GetIncomingSharesAPI", func(t *testing.T) {
 		// Switch to user2 context
 		router.Use(func(c *gin.Context) {
-			c.Set("user", user2)
+			middleware.SetUser(c, user2)
 			c.Next()
 		})
 
@@ -316,7 +730,7 @@ func TestFileSharingAPIEndpoints(t *testing.T) {
 	t.Run("GetOutgoingSharesAPI", func(t *testing.T) {
 		// Switch back to user1 context
 		router.Use(func(c *gin.Context) {
-			c.Set("user", user1)
+			middleware.SetUser(c, user1)
 			c.Next()
 		})
 
@@ -336,6 +750,92 @@ func TestFileSharingAPIEndpoints(t *testing.T) {
 	})
 }
 
+func TestSharedWithMeIntegration(t *testing.T) {
+	// Skip if not in CI environment
+	if os.Getenv("CI") == "" {
+		t.Skip("Skipping integration test in non-CI environment")
+	}
+
+	// Setup test database
+	testDB := setupTestDatabase(t)
+	defer testDB.cleanup(t)
+
+	owner := createTestUser(t, testDB.db, "shareowner", "shareowner@test.com")
+	viewer := createTestUser(t, testDB.db, "sharedviewer", "sharedviewer@test.com")
+	folderService := services.NewFolderService(repositories.NewFolderRepository(testDB.db))
+	fileRepo := repositories.NewFileRepository(testDB.db)
+	userShareRepo := repositories.NewUserFileShareRepository(testDB.db)
+
+	// Team > Drafts, shared as a folder; direct.pdf is shared directly, granted.pdf by an
+	// access grant, and drafts/both.pdf both through the folder and by a grant
+	team, err := folderService.CreateFolder(owner.ID, &models.CreateFolderRequest{Name: "Team"})
+	require.NoError(t, err)
+	drafts, err := folderService.CreateFolder(owner.ID, &models.CreateFolderRequest{Name: "Drafts", ParentID: &team.ID})
+	require.NoError(t, err)
+
+	addFile := func(uploaderID uuid.UUID, folderID *uuid.UUID, name string) *models.File {
+		file := &models.File{
+			ID:           uuid.New(),
+			Filename:     name,
+			OriginalName: name,
+			MimeType:     "application/pdf",
+			Size:         1024,
+			Hash:         "hash-" + name,
+			S3Key:        "test/" + name,
+			UploaderID:   uploaderID,
+			FolderID:     folderID,
+		}
+		require.NoError(t, fileRepo.Create(file))
+		return file
+	}
+	direct := addFile(owner.ID, nil, "direct.pdf")
+	granted := addFile(owner.ID, nil, "granted.pdf")
+	both := addFile(owner.ID, &drafts.ID, "both.pdf")
+	// The viewer's own upload in the shared folder isn't something shared with them
+	addFile(viewer.ID, &team.ID, "mine.pdf")
+	addFile(owner.ID, nil, "private.pdf")
+
+	base := time.Now().Add(-time.Hour)
+	require.NoError(t, userShareRepo.Create(&models.UserFileShare{
+		ID: uuid.New(), FileID: direct.ID, FromUserID: owner.ID, ToUserID: viewer.ID, CreatedAt: base, UpdatedAt: base,
+	}))
+	require.NoError(t, repositories.NewUserFolderShareRepository(testDB.db).Create(&models.UserFolderShare{
+		ID: uuid.New(), FolderID: team.ID, FromUserID: owner.ID, ToUserID: viewer.ID, CreatedAt: base.Add(time.Minute), UpdatedAt: base.Add(time.Minute),
+	}))
+	grantRepo := repositories.NewFileAccessGrantRepository(testDB.db)
+	for _, file := range []*models.File{granted, both} {
+		require.NoError(t, grantRepo.Upsert(&models.FileAccessGrant{
+			ID: uuid.New(), FileID: file.ID, GranteeID: viewer.ID, GrantedBy: owner.ID, Permission: models.FilePermissionView,
+		}))
+	}
+
+	files, total, err := userShareRepo.GetSharedWithMe(viewer.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, files, 3)
+
+	sources := map[uuid.UUID][]string{}
+	for _, shared := range files {
+		sources[shared.File.ID] = shared.Sources
+		assert.Equal(t, owner.ID, shared.SharedBy.ID)
+	}
+	assert.Equal(t, []string{models.SharedWithMeSourceUserShare}, sources[direct.ID])
+	assert.Equal(t, []string{models.SharedWithMeSourceAccessGrant}, sources[granted.ID])
+	assert.Equal(t, []string{models.SharedWithMeSourceAccessGrant, models.SharedWithMeSourceFolderShare}, sources[both.ID])
+	// The share made longest ago comes last
+	assert.Equal(t, direct.ID, files[2].File.ID)
+
+	page, total, err := userShareRepo.GetSharedWithMe(viewer.ID, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, page, 1)
+	assert.Equal(t, direct.ID, page[0].File.ID)
+
+	_, total, err = userShareRepo.GetSharedWithMe(owner.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
+
 // MockS3Service for testing
 type MockS3Service struct{}
 
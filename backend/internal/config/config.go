@@ -1,10 +1,22 @@
 package config
 
 import (
+	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// defaultCORSAllowedOrigins are used when CORS_ALLOWED_ORIGINS is not set
+var defaultCORSAllowedOrigins = []string{
+	"http://localhost:3000",
+	"http://127.0.0.1:3000",
+	"https://file-vault-balkan-id.vercel.app",
+}
+
 // Config holds all configuration for our application
 type Config struct {
 	DatabaseURL    string
@@ -13,12 +25,140 @@ type Config struct {
 	Port           string
 	RateLimitRPS   int
 	StorageQuotaMB int64
+	// Per-role default quotas such as "admin=unlimited,user=1024", between user overrides and StorageQuotaMB
+	RoleQuotas     string
 	AWSRegion      string
 	AWSAccessKeyID string
 	AWSSecretKey   string
 	S3BucketName   string
 	S3BucketURL    string
 	BaseURL        string
+
+	// JWT lifetime and the iss/aud claims stamped on and required of tokens
+	JWTExpiry   time.Duration
+	JWTIssuer   string
+	JWTAudience string
+	// Accept tokens issued before iss/aud were added; disable once those have expired
+	JWTAllowLegacyTokens bool
+	// Sessions unused for this long are rejected even if their token hasn't expired (0 disables)
+	SessionIdleTimeout time.Duration
+
+	// Rules for new passwords; common passwords are always rejected
+	PasswordMinLength    int
+	PasswordRequireMixed bool
+
+	// Accounts are locked for LoginLockoutMinutes after this many failed logins within that
+	// time (0 disables the lockout); LoginLockoutNotify tells the owner when it happens
+	LoginMaxFailedAttempts int
+	LoginLockoutMinutes    int
+	LoginLockoutNotify     bool
+
+	// How many levels deep folders may be nested, a root folder being level 1 (0 disables the limit)
+	MaxFolderDepth int
+
+	// Comma-separated folder paths created for every new user, e.g. "Documents,Projects/Active"
+	DefaultFolders string
+
+	// How long shutdown waits for in-flight requests before closing connections
+	ShutdownTimeout time.Duration
+
+	// Apply pending migrations when the server starts; off when deploys run cmd/migrate instead
+	MigrateOnStart bool
+
+	// Deadline for each request's S3 and other context-aware work; streaming routes are exempt
+	RequestTimeout time.Duration
+
+	// Comma-separated list of origins allowed by CORS (CORS_ALLOWED_ORIGINS)
+	CORSAllowedOrigins string
+
+	// Comma-separated origins allowed to fetch public share links (PUBLIC_SHARE_CORS_ORIGINS, "*" for any)
+	PublicShareCORSOrigins string
+
+	// Comma-separated IPs or CIDRs of reverse proxies whose X-Forwarded-For is believed (TRUSTED_PROXIES)
+	TrustedProxies string
+
+	// Requests per minute per client IP on public share links: viewing share details and
+	// downloading are limited separately (0 disables)
+	PublicShareViewRateLimit     int
+	PublicShareDownloadRateLimit int
+
+	// Comma-separated MIME types shown inline by the preview endpoint, e.g. "image/png,video/*"
+	// (empty uses the built-in list); anything else is sent as a download
+	PreviewableMimeTypes string
+
+	// Storage class and server-side encryption for uploaded objects (empty uses the bucket defaults)
+	S3StorageClass         string
+	S3ServerSideEncryption string
+	S3SSEKMSKeyID          string
+
+	// Storage price in USD per GB-month, used to estimate deduplication savings
+	StorageCostPerGBMonth float64
+
+	// Retries for transient S3 failures (exponential backoff with jitter between attempts)
+	S3RetryMaxAttempts int
+	S3RetryBaseDelayMS int
+	S3RetryMaxDelayMS  int
+
+	// Re-uploads of a file into the same folder: "reference" adds another record, "reuse" returns the existing one
+	DuplicateUploadMode string
+	// Whose uploads are deduplicated against each other: "global" (everyone's) or "per-user"
+	DedupScope string
+
+	// Compute perceptual hashes of image uploads so visually similar images can be found
+	PerceptualHashEnabled bool
+
+	// Thumbnail sizes in pixels that may be requested, comma separated (e.g. "128,256,512")
+	ThumbnailSizes string
+
+	// Background processing of new uploads: concurrent workers and how many files may wait
+	ProcessingWorkers   int
+	ProcessingQueueSize int
+
+	// Multipart uploads are buffered in memory up to this size; larger files spill to a temp file on disk
+	UploadMemoryLimitMB int64
+
+	// Most files one request may upload as files[] parts
+	UploadMaxBatchFiles int
+
+	// How long an upload's Idempotency-Key returns the file it created (0 disables)
+	UploadIdempotencyTTL time.Duration
+
+	// ZIP-based uploads listing more than this ratio or total size uncompressed are rejected (0 disables each)
+	ArchiveMaxCompressionRatio int64
+	ArchiveMaxUncompressedMB   int64
+
+	// Full downloads up to this size are hashed and checked against the stored SHA-256 (0 disables)
+	DownloadVerifyMaxSizeMB int64
+
+	// Limits on GraphQL operations, checked before execution
+	GraphQLMaxDepth          int
+	GraphQLMaxFields         int
+	GraphQLMaxTopLevelFields int
+
+	// Share expiry notifications
+	ShareExpiryCheckIntervalMinutes int
+
+	// Days share download logs are kept before being rolled up into daily totals (0 keeps them)
+	DownloadLogRetentionDays int
+
+	// Upper bound for presigned share URL lifetime (S3 allows at most 168 hours)
+	ShareURLMaxExpiryHours int
+
+	// Public share links: "direct" presigned S3 URLs or "proxy" backend URLs under BASE_URL
+	ShareURLMode string
+
+	// Optional CloudFront distribution for direct share links: its domain, the ID of the public
+	// key trusted by the distribution and the path of the matching PEM private key
+	CDNDomain         string
+	CDNKeyPairID      string
+	CDNPrivateKeyPath string
+
+	// Optional SMTP settings for email notifications
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 // LoadConfig loads configuration from environment variables
@@ -30,13 +170,193 @@ func LoadConfig() *Config {
 		Port:           getEnv("PORT", "8080"),
 		RateLimitRPS:   getEnvInt("RATE_LIMIT_RPS", 2),
 		StorageQuotaMB: getEnvInt64("STORAGE_QUOTA_MB", 10),
+		RoleQuotas:     getEnv("ROLE_QUOTAS", "admin=unlimited"),
 		AWSRegion:      getEnv("AWS_REGION", "eu-north-1"),
 		AWSAccessKeyID: getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretKey:   getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		S3BucketName:   getEnv("S3_BUCKET_NAME", "filevaultbalkan"),
 		S3BucketURL:    getEnv("S3_BUCKET_URL", "https://filevaultbalkan.s3.amazonaws.com"),
 		BaseURL:        getEnv("BASE_URL", "http://localhost:8080"),
+
+		JWTExpiry:            getEnvDuration("JWT_EXPIRY", 24*time.Hour),
+		JWTIssuer:            getEnv("JWT_ISSUER", "filevault"),
+		JWTAudience:          getEnv("JWT_AUDIENCE", "filevault"),
+		JWTAllowLegacyTokens: getEnvBool("JWT_ALLOW_LEGACY_TOKENS", true),
+		SessionIdleTimeout:   getEnvDuration("SESSION_IDLE_TIMEOUT", 0),
+
+		PasswordMinLength:    getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordRequireMixed: getEnvBool("PASSWORD_REQUIRE_MIXED", true),
+
+		LoginMaxFailedAttempts: getEnvInt("LOGIN_MAX_FAILED_ATTEMPTS", 10),
+		LoginLockoutMinutes:    getEnvInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LoginLockoutNotify:     getEnvBool("LOGIN_LOCKOUT_NOTIFY", true),
+
+		MaxFolderDepth: getEnvInt("MAX_FOLDER_DEPTH", 20),
+		DefaultFolders: getEnv("DEFAULT_FOLDERS", ""),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		MigrateOnStart: getEnvBool("MIGRATE_ON_START", true),
+
+		RequestTimeout: getEnvDuration("REQUEST_TIMEOUT", 60*time.Second),
+
+		CORSAllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", ""),
+
+		PublicShareCORSOrigins: getEnv("PUBLIC_SHARE_CORS_ORIGINS", "*"),
+
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
+
+		PublicShareViewRateLimit:     getEnvInt("PUBLIC_SHARE_VIEW_RATE_LIMIT", 60),
+		PublicShareDownloadRateLimit: getEnvInt("PUBLIC_SHARE_DOWNLOAD_RATE_LIMIT", 30),
+
+		PreviewableMimeTypes: getEnv("PREVIEWABLE_MIME_TYPES", ""),
+
+		S3StorageClass:         getEnv("S3_STORAGE_CLASS", ""),
+		S3ServerSideEncryption: getEnv("S3_SERVER_SIDE_ENCRYPTION", ""),
+		S3SSEKMSKeyID:          getEnv("S3_SSE_KMS_KEY_ID", ""),
+
+		StorageCostPerGBMonth: getEnvFloat("STORAGE_COST_PER_GB_MONTH", 0.023),
+
+		S3RetryMaxAttempts: getEnvInt("S3_RETRY_MAX_ATTEMPTS", 3),
+		S3RetryBaseDelayMS: getEnvInt("S3_RETRY_BASE_DELAY_MS", 200),
+		S3RetryMaxDelayMS:  getEnvInt("S3_RETRY_MAX_DELAY_MS", 5000),
+
+		DuplicateUploadMode: getEnv("DUPLICATE_UPLOAD_MODE", "reference"),
+		DedupScope:          getEnv("DEDUP_SCOPE", "global"),
+		UploadMemoryLimitMB: getEnvInt64("UPLOAD_MEMORY_LIMIT_MB", 8),
+		UploadMaxBatchFiles: getEnvInt("UPLOAD_MAX_BATCH_FILES", 50),
+
+		UploadIdempotencyTTL: getEnvDurationOrZero("UPLOAD_IDEMPOTENCY_TTL", 24*time.Hour),
+
+		ArchiveMaxCompressionRatio: getEnvInt64("ARCHIVE_MAX_COMPRESSION_RATIO", 100),
+		ArchiveMaxUncompressedMB:   getEnvInt64("ARCHIVE_MAX_UNCOMPRESSED_MB", 1024),
+
+		PerceptualHashEnabled: getEnvBool("PERCEPTUAL_HASH_ENABLED", true),
+
+		ThumbnailSizes: getEnv("THUMBNAIL_SIZES", "128,256,512"),
+
+		ProcessingWorkers:   getEnvInt("PROCESSING_WORKERS", 2),
+		ProcessingQueueSize: getEnvInt("PROCESSING_QUEUE_SIZE", 100),
+
+		DownloadVerifyMaxSizeMB: getEnvInt64("DOWNLOAD_VERIFY_MAX_SIZE_MB", 0),
+
+		GraphQLMaxDepth:          getEnvInt("GRAPHQL_MAX_DEPTH", 10),
+		GraphQLMaxFields:         getEnvInt("GRAPHQL_MAX_FIELDS", 200),
+		GraphQLMaxTopLevelFields: getEnvInt("GRAPHQL_MAX_TOP_LEVEL_FIELDS", 20),
+
+		ShareExpiryCheckIntervalMinutes: getEnvInt("SHARE_EXPIRY_CHECK_INTERVAL_MINUTES", 15),
+
+		DownloadLogRetentionDays: getEnvInt("DOWNLOAD_LOG_RETENTION_DAYS", 0),
+
+		ShareURLMaxExpiryHours: getEnvInt("SHARE_URL_MAX_EXPIRY_HOURS", 168),
+		ShareURLMode:           getEnv("SHARE_URL_MODE", "direct"),
+
+		CDNDomain:         getEnv("CDN_DOMAIN", ""),
+		CDNKeyPairID:      getEnv("CDN_KEY_PAIR_ID", ""),
+		CDNPrivateKeyPath: getEnv("CDN_PRIVATE_KEY_PATH", ""),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
+	}
+}
+
+// GetCORSAllowedOrigins parses and validates the configured CORS origins.
+// It falls back to the local development origins when none are configured.
+func (c *Config) GetCORSAllowedOrigins() ([]string, error) {
+	if strings.TrimSpace(c.CORSAllowedOrigins) == "" {
+		return defaultCORSAllowedOrigins, nil
+	}
+
+	var origins []string
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(c.CORSAllowedOrigins, ",") {
+		origin := strings.TrimRight(strings.TrimSpace(raw), "/")
+		if origin == "" {
+			continue
+		}
+		if err := validateOrigin(origin); err != nil {
+			return nil, err
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS does not contain any origins")
+	}
+
+	return origins, nil
+}
+
+// GetPublicShareCORSOrigins parses the origins allowed to fetch public share links.
+// A nil slice means any origin; that's safe here because the public policy never allows credentials.
+func (c *Config) GetPublicShareCORSOrigins() ([]string, error) {
+	var origins []string
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(c.PublicShareCORSOrigins, ",") {
+		origin := strings.TrimRight(strings.TrimSpace(raw), "/")
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			return nil, nil
+		}
+		if err := validateOrigin(origin); err != nil {
+			return nil, fmt.Errorf("PUBLIC_SHARE_CORS_ORIGINS: %w", err)
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
 	}
+	return origins, nil
+}
+
+// GetTrustedProxies parses the reverse proxies allowed to report the client IP. A nil slice
+// means none, so the client IP is always the address the request came from.
+func (c *Config) GetTrustedProxies() ([]string, error) {
+	var proxies []string
+	for _, raw := range strings.Split(c.TrustedProxies, ",") {
+		proxy := strings.TrimSpace(raw)
+		if proxy == "" {
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: must be an IP address or CIDR", proxy)
+			}
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// validateOrigin checks that an origin is a bare scheme://host[:port] URL
+func validateOrigin(origin string) error {
+	if origin == "*" {
+		return fmt.Errorf("invalid CORS origin %q: wildcard is not allowed because credentials are enabled", origin)
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid CORS origin %q: %w", origin, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid CORS origin %q: scheme must be http or https", origin)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid CORS origin %q: missing host", origin)
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("invalid CORS origin %q: must not contain a path, query, fragment or credentials", origin)
+	}
+
+	return nil
 }
 
 // getEnv gets an environment variable or returns a default value
@@ -66,3 +386,44 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+// getEnvDuration gets an environment variable as a duration (e.g. "24h", "90m") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFloat gets an environment variable as a non-negative float or returns a default value
+// getEnvDurationOrZero gets an environment variable as a duration like getEnvDuration, but also
+// accepts 0, for settings that 0 disables
+func getEnvDurationOrZero(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil && floatValue >= 0 {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvBool gets an environment variable as a boolean or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
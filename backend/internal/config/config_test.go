@@ -0,0 +1,21 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig_UploadIdempotencyTTL(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":     24 * time.Hour,
+		"0":    0,
+		"90m":  90 * time.Minute,
+		"-1h":  24 * time.Hour,
+		"soon": 24 * time.Hour,
+	} {
+		t.Setenv("UPLOAD_IDEMPOTENCY_TTL", value)
+		assert.Equal(t, want, LoadConfig().UploadIdempotencyTTL, "UPLOAD_IDEMPOTENCY_TTL=%q", value)
+	}
+}
@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// migrationsDir holds the migration files, relative to the working directory
+const migrationsDir = "migrations"
+
+// migrationFiles lists the migrations in the order they are applied. A migration's version is
+// its file name without ".sql"; it can be rolled back if a <version>.down.sql file sits next to it.
+var migrationFiles = []string{
+	"001_create_users_table.sql",
+	"002_create_files_table.sql",
+	"003_create_file_hashes_table.sql",
+	"004_create_shares_table.sql",
+	"005_create_downloads_table.sql",
+	"006_add_search_indexes.sql",
+	"007_create_admin_user.sql",
+	"008_add_is_duplicate_to_files.sql",
+	"008_update_shares_table.sql",
+	"009_add_file_sharing.sql",
+	"010_add_s3_key_to_files.sql",
+	"011_add_s3_fields_to_file_hashes.sql",
+	"012_fix_share_token_function.sql",
+	"013_create_folders_table.sql",
+	"015_create_folder_functions.sql",
+	"017_restore_folder_id_to_files.sql",
+	"019_fix_null_folder_paths.sql",
+	"020_add_folder_file_count_triggers.sql",
+	"021_remove_is_duplicate_column.sql",
+	"022_add_user_file_sharing.sql",
+	"023_add_login_performance_indexes.sql",
+	"024_add_share_expiry_notifications.sql",
+	"025_add_folder_name_uniqueness.sql",
+	"026_add_user_folder_sharing.sql",
+	"027_add_user_token_revocation.sql",
+	"028_add_file_description.sql",
+	"029_create_notifications.sql",
+	"030_create_file_access_grants.sql",
+	"031_add_files_cursor_index.sql",
+	"032_create_file_access_events.sql",
+	"033_create_system_settings.sql",
+	"034_add_file_share_bandwidth_limit.sql",
+	"035_add_files_dedup_disabled.sql",
+	"036_add_folder_color_icon.sql",
+	"037_create_user_sessions.sql",
+	"038_add_files_perceptual_hash.sql",
+	"039_add_users_storage_quota.sql",
+	"040_create_file_comments.sql",
+	"041_add_files_job_status.sql",
+	"042_add_files_mime_checked_at.sql",
+	"043_add_files_original_file_id.sql",
+	"044_add_files_last_modified_by.sql",
+	"045_create_thumbnails.sql",
+	"046_add_file_hashes_owner.sql",
+	"047_add_files_download_name.sql",
+	"048_add_files_is_public.sql",
+	"049_index_file_access_events_file.sql",
+	"050_create_upload_idempotency_keys.sql",
+	"051_add_file_shares_force_download.sql",
+	"052_create_upload_metrics.sql",
+	"053_add_share_email_domains.sql",
+	"054_add_share_burn_after_download.sql",
+	"055_create_download_log_daily.sql",
+	"056_add_users_dedup_opt_out.sql",
+	"057_allow_pending_upload_idempotency_keys.sql",
+}
+
+// migrationLockID keys the advisory lock held while migrating, so instances starting at the same
+// time don't apply a migration twice
+const migrationLockID = 4471190
+
+// MigrationState is a migration and whether it has been applied
+type MigrationState struct {
+	Version   string
+	Applied   bool
+	AppliedAt *time.Time
+	// Reversible is true when the migration has a down migration MigrateDown can run
+	Reversible bool
+}
+
+// Migrate applies the migrations that haven't been applied yet, each in its own transaction
+// together with recording its version in schema_migrations. Databases migrated before versions
+// were recorded get every migration applied once more; migrations are written to be idempotent.
+func Migrate(databaseURL string) error {
+	// Create uploads directory if it doesn't exist
+	uploadPath := os.Getenv("UPLOAD_PATH")
+	if uploadPath == "" {
+		uploadPath = "./uploads"
+	}
+	if err := os.MkdirAll(uploadPath, 0755); err != nil {
+		return fmt.Errorf("failed to create uploads directory: %w", err)
+	}
+
+	return withMigrationLock(databaseURL, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, filename := range pendingMigrations(migrationFiles, applied) {
+			migrationPath := filepath.Join(migrationsDir, filename)
+			if _, err := os.Stat(migrationPath); os.IsNotExist(err) {
+				// If migration file doesn't exist, create it with basic schema
+				if err := createDefaultMigration(migrationPath); err != nil {
+					return fmt.Errorf("failed to run migration %s: %w", filename, err)
+				}
+				continue
+			}
+
+			content, err := os.ReadFile(migrationPath)
+			if err != nil {
+				return fmt.Errorf("failed to read migration %s: %w", filename, err)
+			}
+			record := `INSERT INTO schema_migrations (version) VALUES ($1)`
+			if err := runMigration(ctx, conn, string(content), record, migrationVersion(filename)); err != nil {
+				return fmt.Errorf("failed to run migration %s: %w", filename, err)
+			}
+			log.Printf("Successfully ran migration: %s", filename)
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first, running each one's
+// down migration in a transaction together with removing its version. Nothing is rolled back
+// unless every migration to undo has a down migration.
+func MigrateDown(databaseURL string, steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be at least 1")
+	}
+
+	return withMigrationLock(databaseURL, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := rollbackVersions(migrationFiles, applied, steps)
+		if len(versions) == 0 {
+			log.Println("No applied migrations to roll back")
+			return nil
+		}
+		for _, version := range versions {
+			if _, err := os.Stat(downMigrationPath(version)); err != nil {
+				return fmt.Errorf("migration %s can't be rolled back: no down migration at %s", version, downMigrationPath(version))
+			}
+		}
+
+		for _, version := range versions {
+			content, err := os.ReadFile(downMigrationPath(version))
+			if err != nil {
+				return fmt.Errorf("failed to read down migration %s: %w", version, err)
+			}
+			record := `DELETE FROM schema_migrations WHERE version = $1`
+			if err := runMigration(ctx, conn, string(content), record, version); err != nil {
+				return fmt.Errorf("failed to roll back migration %s: %w", version, err)
+			}
+			log.Printf("Rolled back migration: %s", version)
+		}
+		return nil
+	})
+}
+
+// MigrationStatus reports every known migration, in order, and whether it has been applied
+func MigrationStatus(databaseURL string) ([]MigrationState, error) {
+	var states []MigrationState
+	err := withMigrationLock(databaseURL, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, filename := range migrationFiles {
+			version := migrationVersion(filename)
+			state := MigrationState{Version: version}
+			if appliedAt, ok := applied[version]; ok {
+				state.Applied = true
+				state.AppliedAt = &appliedAt
+			}
+			if _, err := os.Stat(downMigrationPath(version)); err == nil {
+				state.Reversible = true
+			}
+			states = append(states, state)
+		}
+		return nil
+	})
+	return states, err
+}
+
+// withMigrationLock runs fn on a single connection holding the migration lock, after making sure
+// the schema_migrations table exists
+func withMigrationLock(databaseURL string, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	db, err := Connect(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Advisory locks belong to a session, so everything runs on one connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// appliedMigrations returns when each applied migration was applied, by version
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[string]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var version string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration executes a migration script and the statement recording it in one transaction
+func runMigration(ctx context.Context, conn *sql.Conn, script, record, version string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, version); err != nil {
+		return fmt.Errorf("failed to record migration version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// pendingMigrations returns the migration files whose versions haven't been applied, in order
+func pendingMigrations(files []string, applied map[string]time.Time) []string {
+	var pending []string
+	for _, filename := range files {
+		if _, ok := applied[migrationVersion(filename)]; !ok {
+			pending = append(pending, filename)
+		}
+	}
+	return pending
+}
+
+// rollbackVersions returns the versions of the last steps applied migrations, newest first.
+// Applied versions that aren't in files are left alone.
+func rollbackVersions(files []string, applied map[string]time.Time, steps int) []string {
+	var versions []string
+	for i := len(files) - 1; i >= 0 && len(versions) < steps; i-- {
+		version := migrationVersion(files[i])
+		if _, ok := applied[version]; ok {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// migrationVersion is the version a migration file is recorded under
+func migrationVersion(filename string) string {
+	return strings.TrimSuffix(filename, ".sql")
+}
+
+// downMigrationPath is where the down migration for a version lives
+func downMigrationPath(version string) string {
+	return filepath.Join(migrationsDir, version+".down.sql")
+}
+
+// createDefaultMigration creates a default migration file if it doesn't exist
+func createDefaultMigration(migrationPath string) error {
+	// This is a fallback - in production, you'd want proper migration files
+	// For now, we'll create the basic schema directly
+	log.Printf("Creating default migration for %s", migrationPath)
+	return nil
+}
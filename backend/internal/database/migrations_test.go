@@ -0,0 +1,52 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	files := []string{"001_a.sql", "002_b.sql", "002_c.sql", "003_d.sql"}
+	applied := map[string]time.Time{"001_a": time.Now(), "002_c": time.Now()}
+
+	assert.Equal(t, []string{"002_b.sql", "003_d.sql"}, pendingMigrations(files, applied))
+	assert.Empty(t, pendingMigrations(files[:1], applied))
+}
+
+func TestRollbackVersions(t *testing.T) {
+	files := []string{"001_a.sql", "002_b.sql", "003_c.sql", "004_d.sql"}
+	applied := map[string]time.Time{"001_a": time.Now(), "002_b": time.Now(), "003_c": time.Now(), "999_unknown": time.Now()}
+
+	assert.Equal(t, []string{"003_c"}, rollbackVersions(files, applied, 1), "pending migrations are skipped")
+	assert.Equal(t, []string{"003_c", "002_b"}, rollbackVersions(files, applied, 2))
+	assert.Equal(t, []string{"003_c", "002_b", "001_a"}, rollbackVersions(files, applied, 10))
+	assert.Empty(t, rollbackVersions(files, map[string]time.Time{}, 1))
+}
+
+func TestMigrationFiles_MatchMigrationsDirectory(t *testing.T) {
+	dir := filepath.Join("..", "..", migrationsDir)
+
+	versions := make(map[string]bool)
+	for _, filename := range migrationFiles {
+		version := migrationVersion(filename)
+		assert.False(t, versions[version], "migration %s is listed twice", version)
+		versions[version] = true
+
+		_, err := os.Stat(filepath.Join(dir, filename))
+		assert.NoError(t, err, "listed migration %s is missing", filename)
+	}
+
+	downFiles, err := filepath.Glob(filepath.Join(dir, "*.down.sql"))
+	require.NoError(t, err)
+	require.NotEmpty(t, downFiles)
+	for _, path := range downFiles {
+		version := strings.TrimSuffix(filepath.Base(path), ".down.sql")
+		assert.True(t, versions[version], "down migration %s has no listed up migration", filepath.Base(path))
+	}
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"filevault/internal/middleware"
 	"filevault/internal/models"
 	"filevault/internal/services"
 
@@ -15,11 +20,12 @@ import (
 // FileShareServiceInterface defines the interface for file share service
 type FileShareServiceInterface interface {
 	CreateFileShare(userID uuid.UUID, req *models.CreateFileShareRequest) (*models.FileShareResponse, error)
-	UpdateFileShare(userID, shareID uuid.UUID, isActive *bool, expiresAt *time.Time, maxDownloads *int) error
+	UpdateFileShare(userID, shareID uuid.UUID, isActive *bool, expiresAt *time.Time, maxDownloads *int) (*models.FileShareResponse, error)
 	DeleteFileShare(userID, id uuid.UUID) error
 	GetFileShareStats(userID, shareID uuid.UUID) (map[string]interface{}, error)
-	DownloadSharedFile(token, ipAddress, userAgent string) (*models.File, *http.Response, error)
+	DownloadSharedFile(ctx context.Context, token, viewerEmail, ipAddress, userAgent, rangeHeader, ifRange string) (*models.File, *http.Response, error)
 	GetFileShare(token string) (*models.FileShare, error)
+	GetShareQRCodeWithSize(token string, size int) ([]byte, error)
 	ShareFileWithUser(fromUserID, fileID, toUserID uuid.UUID, message *string) (*models.UserFileShareResponse, error)
 	GetIncomingShares(userID uuid.UUID, limit, offset int) ([]*models.UserFileShareResponse, error)
 	GetOutgoingShares(userID uuid.UUID, limit, offset int) ([]*models.UserFileShareResponse, error)
@@ -48,16 +54,38 @@ func (h *FileShareHandler) DownloadSharedFile(c *gin.Context) {
 		return
 	}
 
+	viewerEmail := shareViewerEmail(c)
+
+	// A client revalidating its cached copy gets a 304 without using up a download, as long as
+	// it may download the share at all
+	if services.HasConditionalHeaders(c.Request) {
+		share, err := h.fileShareService.GetFileShare(token)
+		if err == nil && services.CheckShareEmail(share, viewerEmail) == nil && services.NotModified(c.Request, share.File) {
+			services.SetFileValidators(c.Writer.Header(), share.File)
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
 	// Get client IP and user agent
 	ipAddress := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
 
-	// Download the file
-	_, response, err := h.fileShareService.DownloadSharedFile(token, ipAddress, userAgent)
+	// Download the file, resuming from the requested range if any
+	file, response, err := h.fileShareService.DownloadSharedFile(c.Request.Context(), token, viewerEmail, ipAddress, userAgent, c.GetHeader("Range"), c.GetHeader("If-Range"))
 	if err != nil {
+		if errors.Is(err, services.ErrRangeNotSatisfiable) && file != nil {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"error": err.Error()})
+			return
+		}
+		if writeShareEmailError(c, err) {
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	defer response.Body.Close()
 
 	// Set response headers
 	for key, values := range response.Header {
@@ -67,9 +95,63 @@ func (h *FileShareHandler) DownloadSharedFile(c *gin.Context) {
 	}
 
 	// Stream the file content directly
+	c.Status(response.StatusCode)
 	io.Copy(c.Writer, response.Body)
 }
 
+// HeadSharedFile returns the headers of a shared file download without the body. The share is
+// checked the same way as for a download, including its allowed email domains, but nothing is
+// counted against its download limit.
+func (h *FileShareHandler) HeadSharedFile(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Share token is required"})
+		return
+	}
+
+	share, err := h.fileShareService.GetFileShare(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.CheckShareEmail(share, shareViewerEmail(c)); err != nil {
+		writeShareEmailError(c, err)
+		return
+	}
+
+	services.SetFileValidators(c.Writer.Header(), share.File)
+	if services.NotModified(c.Request, share.File) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	services.SetFileDownloadHeaders(c.Writer.Header(), share.File)
+	c.Status(http.StatusOK)
+}
+
+// shareViewerEmail is the email a share is downloaded as, for shares limited to email domains:
+// the signed-in user's email, or one given as ?email=
+func shareViewerEmail(c *gin.Context) string {
+	if user, ok := middleware.CurrentUser(c); ok {
+		return user.Email
+	}
+	return c.Query("email")
+}
+
+// writeShareEmailError answers a viewer whose email a domain-restricted share doesn't accept and
+// reports whether err was such an error
+func writeShareEmailError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrShareEmailRequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "emailRequired": true})
+	case errors.Is(err, services.ErrShareEmailNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "emailRequired": true})
+	default:
+		return false
+	}
+	return true
+}
+
 // GetSharedFileInfo returns information about a shared file without downloading
 func (h *FileShareHandler) GetSharedFileInfo(c *gin.Context) {
 	token := c.Param("token")
@@ -100,29 +182,61 @@ func (h *FileShareHandler) GetSharedFileInfo(c *gin.Context) {
 			"maxDownloads":  share.MaxDownloads,
 			"expiresAt":     share.ExpiresAt,
 			"isActive":      share.IsActive,
+			// Downloads need an email at one of these domains; null when anyone can download
+			"allowedEmailDomains": share.AllowedEmailDomains,
 		},
 	})
 }
 
-// CreateFileShare creates a new file share
-func (h *FileShareHandler) CreateFileShare(c *gin.Context) {
-	// Get user from context (set by auth middleware)
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// GetShareQRCode serves a PNG QR code of a share's public link; ?size= sets its width in pixels
+func (h *FileShareHandler) GetShareQRCode(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Share token is required"})
+		return
+	}
+
+	size := services.DefaultShareQRCodeSize
+	if raw := c.Query("size"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidQRCodeSize.Error()})
+			return
+		}
+		size = parsed
+	}
+
+	png, err := h.fileShareService.GetShareQRCodeWithSize(token, size)
+	if errors.Is(err, services.ErrInvalidQRCodeSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Short-lived caching, since the share may expire or be revoked
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "image/png", png)
+}
 
-	userModel, ok := user.(*models.User)
+// CreateFileShare creates a new file share
+func (h *FileShareHandler) CreateFileShare(c *gin.Context) {
+	// Get user from context (set by auth middleware)
+	userModel, ok := middleware.CurrentUser(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
 	var req struct {
-		FileID       string  `json:"fileId" binding:"required"`
-		ExpiresAt    *string `json:"expiresAt"`
-		MaxDownloads *int    `json:"maxDownloads"`
+		FileID              string   `json:"fileId" binding:"required"`
+		ExpiresAt           *string  `json:"expiresAt"`
+		MaxDownloads        *int     `json:"maxDownloads"`
+		ForceDownload       bool     `json:"forceDownload"`
+		AllowedEmailDomains []string `json:"allowedEmailDomains"`
+		BurnAfterDownload   bool     `json:"burnAfterDownload"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -138,7 +252,10 @@ func (h *FileShareHandler) CreateFileShare(c *gin.Context) {
 
 	// Create the share request
 	shareReq := &models.CreateFileShareRequest{
-		FileID: fileID,
+		FileID:              fileID,
+		ForceDownload:       req.ForceDownload,
+		AllowedEmailDomains: req.AllowedEmailDomains,
+		BurnAfterDownload:   req.BurnAfterDownload,
 	}
 
 	// Parse expiration date if provided
@@ -184,15 +301,21 @@ func (h *FileShareHandler) GetFileShareStats(c *gin.Context) {
 	c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Use GraphQL endpoint for file share statistics"})
 }
 
-// RegisterFileShareRoutes registers file sharing routes
-func RegisterFileShareRoutes(router *gin.Engine, fileShareService *services.FileShareService, authMiddleware gin.HandlerFunc) {
+// RegisterFileShareRoutes registers file sharing routes. The public routes are limited per
+// client IP by viewLimiter (share info) and downloadLimiter (downloads); nil disables a limit.
+// optionalAuth identifies signed-in viewers of shares limited to email domains.
+func RegisterFileShareRoutes(router *gin.Engine, fileShareService FileShareServiceInterface, authMiddleware, optionalAuth gin.HandlerFunc, viewLimiter, downloadLimiter *middleware.RateLimiter) {
 	handler := NewFileShareHandler(fileShareService)
+	viewLimit := middleware.RateLimitByIP(viewLimiter, "share-view")
+	downloadLimit := middleware.RateLimitByIP(downloadLimiter, "share-download")
 
 	// Public routes (no authentication required)
 	public := router.Group("/api/files")
 	{
-		public.GET("/share/:token", handler.DownloadSharedFile)
-		public.GET("/share/:token/info", handler.GetSharedFileInfo)
+		public.GET("/share/:token", downloadLimit, optionalAuth, handler.DownloadSharedFile)
+		public.HEAD("/share/:token", downloadLimit, optionalAuth, handler.HeadSharedFile)
+		public.GET("/share/:token/info", viewLimit, handler.GetSharedFileInfo)
+		public.GET("/share/:token/qr", viewLimit, handler.GetShareQRCode)
 	}
 
 	// Protected routes (authentication required)
@@ -200,8 +323,9 @@ func RegisterFileShareRoutes(router *gin.Engine, fileShareService *services.File
 	protected.Use(authMiddleware)
 	{
 		protected.POST("/", handler.CreateFileShare)
-		protected.PUT("/:id", handler.UpdateFileShare)
-		protected.DELETE("/:id", handler.DeleteFileShare)
-		protected.GET("/:id/stats", handler.GetFileShareStats)
+		validID := middleware.ValidateUUIDParams("id")
+		protected.PUT("/:id", validID, handler.UpdateFileShare)
+		protected.DELETE("/:id", validID, handler.DeleteFileShare)
+		protected.GET("/:id/stats", validID, handler.GetFileShareStats)
 	}
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,7 +10,9 @@ import (
 	"testing"
 	"time"
 
+	"filevault/internal/middleware"
 	"filevault/internal/models"
+	"filevault/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -27,9 +30,9 @@ func (m *MockFileShareService) CreateFileShare(userID uuid.UUID, req *models.Cre
 	return args.Get(0).(*models.FileShareResponse), args.Error(1)
 }
 
-func (m *MockFileShareService) UpdateFileShare(userID, shareID uuid.UUID, isActive *bool, expiresAt *time.Time, maxDownloads *int) error {
+func (m *MockFileShareService) UpdateFileShare(userID, shareID uuid.UUID, isActive *bool, expiresAt *time.Time, maxDownloads *int) (*models.FileShareResponse, error) {
 	args := m.Called(userID, shareID, isActive, expiresAt, maxDownloads)
-	return args.Error(0)
+	return args.Get(0).(*models.FileShareResponse), args.Error(1)
 }
 
 func (m *MockFileShareService) DeleteFileShare(userID, id uuid.UUID) error {
@@ -42,8 +45,8 @@ func (m *MockFileShareService) GetFileShareStats(userID, shareID uuid.UUID) (map
 	return args.Get(0).(map[string]interface{}), args.Error(1)
 }
 
-func (m *MockFileShareService) DownloadSharedFile(token, ipAddress, userAgent string) (*models.File, *http.Response, error) {
-	args := m.Called(token, ipAddress, userAgent)
+func (m *MockFileShareService) DownloadSharedFile(ctx context.Context, token, viewerEmail, ipAddress, userAgent, rangeHeader, ifRange string) (*models.File, *http.Response, error) {
+	args := m.Called(token, viewerEmail, ipAddress, userAgent, rangeHeader, ifRange)
 	return args.Get(0).(*models.File), args.Get(1).(*http.Response), args.Error(2)
 }
 
@@ -52,6 +55,11 @@ func (m *MockFileShareService) GetFileShare(token string) (*models.FileShare, er
 	return args.Get(0).(*models.FileShare), args.Error(1)
 }
 
+func (m *MockFileShareService) GetShareQRCodeWithSize(token string, size int) ([]byte, error) {
+	args := m.Called(token, size)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 func (m *MockFileShareService) ShareFileWithUser(fromUserID, fileID, toUserID uuid.UUID, message *string) (*models.UserFileShareResponse, error) {
 	args := m.Called(fromUserID, fileID, toUserID, message)
 	return args.Get(0).(*models.UserFileShareResponse), args.Error(1)
@@ -173,7 +181,7 @@ func TestFileShareHandler_UpdateFileShare(t *testing.T) {
 	reqJSON, _ := json.Marshal(reqBody)
 
 	// Mock expectations
-	mockService.On("UpdateFileShare", mock.AnythingOfType("uuid.UUID"), shareID, &isActive, &expiresAt, &maxDownloads).Return(nil)
+	mockService.On("UpdateFileShare", mock.AnythingOfType("uuid.UUID"), shareID, &isActive, &expiresAt, &maxDownloads).Return(&models.FileShareResponse{ID: shareID}, nil)
 
 	// Execute
 	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/shares/%s", shareID.String()), bytes.NewBuffer(reqJSON))
@@ -338,3 +346,262 @@ func TestFileShareHandler_CreateFileShare_ServiceError(t *testing.T) {
 
 	mockService.AssertExpectations(t)
 }
+
+func TestFileShareHandler_HeadSharedFile(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+	handler := &FileShareHandler{
+		fileShareService: mockService,
+	}
+
+	router := gin.New()
+	router.HEAD("/api/files/share/:token", handler.HeadSharedFile)
+
+	share := &models.FileShare{
+		ID:       uuid.New(),
+		IsActive: true,
+		File: &models.File{
+			ID:           uuid.New(),
+			OriginalName: "report.pdf",
+			Size:         2048,
+			MimeType:     "application/pdf",
+		},
+	}
+	mockService.On("GetFileShare", "test-token").Return(share, nil)
+
+	// Execute
+	req, _ := http.NewRequest("HEAD", "/api/files/share/test-token", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert: download headers, no body, and no download counted
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, "2048", w.Header().Get("Content-Length"))
+	assert.Equal(t, `attachment; filename="report.pdf"; filename*=UTF-8''report.pdf`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Empty(t, w.Body.Bytes())
+	mockService.AssertNotCalled(t, "DownloadSharedFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileShareHandler_HeadSharedFile_Unavailable(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+	handler := &FileShareHandler{
+		fileShareService: mockService,
+	}
+
+	router := gin.New()
+	router.HEAD("/api/files/share/:token", handler.HeadSharedFile)
+
+	mockService.On("GetFileShare", "expired-token").Return((*models.FileShare)(nil), fmt.Errorf("file share is no longer available"))
+
+	// Execute
+	req, _ := http.NewRequest("HEAD", "/api/files/share/expired-token", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFileShareHandler_HeadSharedFile_EmailRestricted(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+	handler := &FileShareHandler{
+		fileShareService: mockService,
+	}
+
+	router := gin.New()
+	router.HEAD("/api/files/share/:token", handler.HeadSharedFile)
+
+	share := &models.FileShare{
+		ID:                  uuid.New(),
+		IsActive:            true,
+		AllowedEmailDomains: []string{"example.com"},
+		File: &models.File{
+			ID:           uuid.New(),
+			OriginalName: "report.pdf",
+			Size:         2048,
+			MimeType:     "application/pdf",
+			Hash:         "abc123",
+		},
+	}
+	mockService.On("GetFileShare", "test-token").Return(share, nil)
+
+	// Without an allowed email nothing about the file is revealed
+	for url, status := range map[string]int{
+		"/api/files/share/test-token":                       http.StatusUnauthorized,
+		"/api/files/share/test-token?email=eve@attacker.io": http.StatusForbidden,
+	} {
+		req, _ := http.NewRequest("HEAD", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, status, w.Code, url)
+		assert.Empty(t, w.Header().Get("Content-Disposition"), url)
+		assert.Empty(t, w.Header().Get("Content-Length"), url)
+		assert.Empty(t, w.Header().Get("ETag"), url)
+	}
+
+	req, _ := http.NewRequest("HEAD", "/api/files/share/test-token?email=alice@example.com", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2048", w.Header().Get("Content-Length"))
+}
+
+func TestRegisterFileShareRoutes_HeadIdentifiesSignedInViewer(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+
+	// optionalAuth stands in for the real middleware and signs in an allowed viewer
+	optionalAuth := func(c *gin.Context) {
+		middleware.SetUser(c, &models.User{ID: uuid.New(), Email: "alice@example.com"})
+		c.Next()
+	}
+	noAuth := func(c *gin.Context) { c.AbortWithStatus(http.StatusUnauthorized) }
+
+	router := gin.New()
+	RegisterFileShareRoutes(router, mockService, noAuth, optionalAuth, nil, nil)
+
+	share := &models.FileShare{
+		ID:                  uuid.New(),
+		IsActive:            true,
+		AllowedEmailDomains: []string{"example.com"},
+		File: &models.File{
+			ID:           uuid.New(),
+			OriginalName: "report.pdf",
+			Size:         2048,
+			MimeType:     "application/pdf",
+			Hash:         "abc123",
+		},
+	}
+	mockService.On("GetFileShare", "test-token").Return(share, nil)
+
+	// Execute: no ?email=, so only the signed-in user can satisfy the domain restriction
+	req, _ := http.NewRequest("HEAD", "/api/files/share/test-token", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2048", w.Header().Get("Content-Length"))
+}
+
+func TestFileShareHandler_DownloadSharedFile_NotModifiedNeedsAllowedEmail(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+	handler := &FileShareHandler{
+		fileShareService: mockService,
+	}
+
+	router := gin.New()
+	router.GET("/api/files/share/:token", handler.DownloadSharedFile)
+
+	share := &models.FileShare{
+		ID:                  uuid.New(),
+		IsActive:            true,
+		AllowedEmailDomains: []string{"example.com"},
+		File: &models.File{
+			ID:           uuid.New(),
+			OriginalName: "report.pdf",
+			Size:         2048,
+			MimeType:     "application/pdf",
+			Hash:         "abc123",
+		},
+	}
+	mockService.On("GetFileShare", "test-token").Return(share, nil)
+	mockService.On("DownloadSharedFile", "test-token", "", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return((*models.File)(nil), (*http.Response)(nil), services.ErrShareEmailRequired)
+
+	// Execute: a matching ETag without an email doesn't get the validators back
+	req, _ := http.NewRequest("GET", "/api/files/share/test-token", nil)
+	req.Header.Set("If-None-Match", `"abc123"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+func TestFileShareHandler_DownloadSharedFile_NotModified(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+	handler := &FileShareHandler{
+		fileShareService: mockService,
+	}
+
+	router := gin.New()
+	router.GET("/api/files/share/:token", handler.DownloadSharedFile)
+
+	share := &models.FileShare{
+		ID:       uuid.New(),
+		IsActive: true,
+		File: &models.File{
+			ID:           uuid.New(),
+			OriginalName: "report.pdf",
+			Size:         2048,
+			MimeType:     "application/pdf",
+			Hash:         "abc123",
+			CreatedAt:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}
+	mockService.On("GetFileShare", "test-token").Return(share, nil)
+
+	// Execute
+	req, _ := http.NewRequest("GET", "/api/files/share/test-token", nil)
+	req.Header.Set("If-None-Match", `"abc123"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert: a 304 with the validators, and no download counted
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, `"abc123"`, w.Header().Get("ETag"))
+	assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Empty(t, w.Body.Bytes())
+	mockService.AssertNotCalled(t, "DownloadSharedFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileShareHandler_GetShareQRCode(t *testing.T) {
+	// Setup
+	gin.SetMode(gin.TestMode)
+	mockService := new(MockFileShareService)
+	handler := &FileShareHandler{
+		fileShareService: mockService,
+	}
+
+	router := gin.New()
+	router.GET("/api/files/share/:token/qr", handler.GetShareQRCode)
+
+	png := []byte("\x89PNG\r\n\x1a\n")
+	mockService.On("GetShareQRCodeWithSize", "test-token", services.DefaultShareQRCodeSize).Return(png, nil)
+	mockService.On("GetShareQRCodeWithSize", "test-token", 512).Return(png, nil)
+	mockService.On("GetShareQRCodeWithSize", "test-token", 4096).Return([]byte(nil), services.ErrInvalidQRCodeSize)
+	mockService.On("GetShareQRCodeWithSize", "expired-token", services.DefaultShareQRCodeSize).Return([]byte(nil), fmt.Errorf("file share is no longer available"))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Assert
+	w := get("/api/files/share/test-token/qr")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, png, w.Body.Bytes())
+
+	assert.Equal(t, http.StatusOK, get("/api/files/share/test-token/qr?size=512").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/files/share/test-token/qr?size=4096").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/files/share/test-token/qr?size=big").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/files/share/expired-token/qr").Code)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"filevault/internal/middleware"
+	"filevault/internal/models"
+	"filevault/internal/services"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PublicFileRepository is the file lookup used by the public file routes
+type PublicFileRepository interface {
+	GetByID(id uuid.UUID) (*models.File, error)
+}
+
+// PublicDownloadRecorder logs anonymous downloads of public files
+type PublicDownloadRecorder interface {
+	RecordPublicDownload(fileID uuid.UUID, ipAddress, userAgent string) error
+}
+
+// ObjectGetter fetches file content from S3
+type ObjectGetter interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// PublicFileHandler serves files their owner has marked public, without authentication
+type PublicFileHandler struct {
+	files     PublicFileRepository
+	objects   ObjectGetter
+	bucket    string
+	downloads PublicDownloadRecorder
+}
+
+// NewPublicFileHandler creates a new public file handler
+func NewPublicFileHandler(files PublicFileRepository, objects ObjectGetter, bucket string, downloads PublicDownloadRecorder) *PublicFileHandler {
+	return &PublicFileHandler{
+		files:     files,
+		objects:   objects,
+		bucket:    bucket,
+		downloads: downloads,
+	}
+}
+
+// DownloadPublicFile serves a public file. Private and missing files get the same 404 so the
+// route can't be used to probe for file IDs.
+func (h *PublicFileHandler) DownloadPublicFile(c *gin.Context) {
+	fileID, ok := middleware.UUIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	file, err := h.files.GetByID(fileID)
+	if err != nil || file == nil || !file.IsPublic {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	services.SetFileValidators(c.Writer.Header(), file)
+	if services.NotModified(c.Request, file) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if file.S3Key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found on storage"})
+		return
+	}
+
+	result, err := h.objects.GetObject(c.Request.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(h.bucket),
+		Key:    aws.String(file.S3Key),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file from S3"})
+		return
+	}
+	defer result.Body.Close()
+
+	if h.downloads != nil {
+		if err := h.downloads.RecordPublicDownload(file.ID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+			log.Printf("WARNING: Failed to record public download of file %s: %v", file.ID, err)
+		}
+	}
+
+	// Visibility can be revoked at any time, so shared caches must revalidate
+	c.Header("Content-Type", file.MimeType)
+	c.Header("Content-Disposition", services.ContentDisposition("attachment", services.DownloadFilename(file)))
+	c.Header("Content-Length", fmt.Sprintf("%d", file.Size))
+	c.Header("Cache-Control", "public, no-cache")
+
+	io.Copy(c.Writer, result.Body)
+}
+
+// RedirectLegacyPublicURL sends the old /public/:id links to the canonical public file URL, so
+// they keep working for public files and 404 like it for everything else
+func (h *PublicFileHandler) RedirectLegacyPublicURL(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, "/public/files/"+c.Param("id"))
+}
+
+// RegisterPublicFileRoutes registers the public file routes, limited per client IP by
+// downloadLimiter (nil disables the limit)
+func RegisterPublicFileRoutes(router *gin.Engine, handler *PublicFileHandler, downloadLimiter *middleware.RateLimiter) {
+	downloadLimit := middleware.RateLimitByIP(downloadLimiter, "public-download")
+	validID := middleware.ValidateUUIDParams("id")
+
+	router.GET("/public/:id", downloadLimit, validID, handler.RedirectLegacyPublicURL)
+	router.GET("/public/files/:id", downloadLimit, validID, handler.DownloadPublicFile)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublicFiles serves files from a map
+type fakePublicFiles map[uuid.UUID]*models.File
+
+func (f fakePublicFiles) GetByID(id uuid.UUID) (*models.File, error) {
+	if file, ok := f[id]; ok {
+		return file, nil
+	}
+	return nil, errors.New("file not found")
+}
+
+// fakeObjects returns the same content for every key
+type fakeObjects struct{ content string }
+
+func (f fakeObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(f.content))}, nil
+}
+
+// recordedDownloads counts public downloads by file
+type recordedDownloads map[uuid.UUID]int
+
+func (r recordedDownloads) RecordPublicDownload(fileID uuid.UUID, ipAddress, userAgent string) error {
+	r[fileID]++
+	return nil
+}
+
+func newPublicFileRouter(files fakePublicFiles, downloads recordedDownloads) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterPublicFileRoutes(router, NewPublicFileHandler(files, fakeObjects{content: "hello"}, "test-bucket", downloads), nil)
+	return router
+}
+
+func getPublic(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestPublicFileRoutes_ServePublicFile(t *testing.T) {
+	file := &models.File{ID: uuid.New(), OriginalName: "hello.txt", MimeType: "text/plain", Size: 5, S3Key: "files/hello", IsPublic: true}
+	downloads := recordedDownloads{}
+	router := newPublicFileRouter(fakePublicFiles{file.ID: file}, downloads)
+
+	w := getPublic(router, "/public/files/"+file.ID.String())
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "hello.txt")
+	assert.Equal(t, 1, downloads[file.ID])
+
+	// Old links redirect to the canonical URL
+	w = getPublic(router, "/public/"+file.ID.String())
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/public/files/"+file.ID.String(), w.Header().Get("Location"))
+}
+
+func TestPublicFileRoutes_PrivateFileNotFoundOnBothRoutes(t *testing.T) {
+	file := &models.File{ID: uuid.New(), OriginalName: "secret.txt", MimeType: "text/plain", Size: 5, S3Key: "files/secret"}
+	downloads := recordedDownloads{}
+	router := newPublicFileRouter(fakePublicFiles{file.ID: file}, downloads)
+
+	w := getPublic(router, "/public/files/"+file.ID.String())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "hello")
+
+	w = getPublic(router, "/public/"+file.ID.String())
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	w = getPublic(router, w.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "hello")
+	assert.Zero(t, downloads[file.ID])
+
+	// A missing file looks the same as a private one
+	w = getPublic(router, "/public/files/"+uuid.New().String())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPublicFileRoutes_RejectNonUUIDs(t *testing.T) {
+	router := newPublicFileRouter(fakePublicFiles{}, recordedDownloads{})
+
+	assert.Equal(t, http.StatusBadRequest, getPublic(router, "/public/files/not-a-uuid").Code)
+	assert.Equal(t, http.StatusBadRequest, getPublic(router, "/public/not-a-uuid").Code)
+}
@@ -51,7 +51,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	// Validate the token
-	user, err := h.authService.ValidateToken(token)
+	identity, err := h.AuthenticateToken(token)
 	if err != nil {
 		log.Printf("WebSocket authentication failed: %v", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -59,10 +59,20 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	// Log the WebSocket connection attempt
-	log.Printf("WebSocket connection attempt from user: %s (role: %s)", user.Username, user.Role)
+	log.Printf("WebSocket connection attempt from user: %s (role: %s)", identity.UserID, identity.Role)
+
+	// Upgrade the connection to WebSocket; it stays open past the token's expiry only if the
+	// client sends a fresh one in an auth_refresh message
+	websocket.ServeAuthenticatedWS(h.hub, c.Writer, c.Request, identity, h)
+}
 
-	// Upgrade the connection to WebSocket
-	websocket.ServeWS(h.hub, c.Writer, c.Request, user.ID.String(), user.Role)
+// AuthenticateToken checks a token sent when connecting or in an auth_refresh message
+func (h *WebSocketHandler) AuthenticateToken(token string) (websocket.Identity, error) {
+	user, expiresAt, err := h.authService.ValidateTokenWithExpiry(token)
+	if err != nil {
+		return websocket.Identity{}, err
+	}
+	return websocket.Identity{UserID: user.ID.String(), Role: user.Role, ExpiresAt: expiresAt}, nil
 }
 
 // GetConnectionStatus returns the current WebSocket connection status
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+
+	"filevault/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey is an unexported type for context keys to avoid collisions with other packages
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	requestIDContextKey
+	clientIPContextKey
+)
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user stored in ctx, if any
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*models.User)
+	return user, ok && user != nil
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// WithClientIP returns a copy of ctx carrying the address the request came from
+func WithClientIP(ctx context.Context, clientIP string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey, clientIP)
+}
+
+// ClientIPFromContext returns the client address stored in ctx, or an empty string
+func ClientIPFromContext(ctx context.Context) string {
+	clientIP, _ := ctx.Value(clientIPContextKey).(string)
+	return clientIP
+}
+
+// SetUser stores the authenticated user on the request context of a Gin request
+func SetUser(c *gin.Context, user *models.User) {
+	c.Request = c.Request.WithContext(WithUser(c.Request.Context(), user))
+}
+
+// CurrentUser returns the authenticated user of a Gin request, if any
+func CurrentUser(c *gin.Context) (*models.User, bool) {
+	return UserFromContext(c.Request.Context())
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// PublicSharePathPrefixes are the unauthenticated share download routes that get the
+// permissive public CORS policy instead of the credentialed API policy
+var PublicSharePathPrefixes = []string{"/api/files/share/", "/public/"}
+
+// PublicCORS allows cross-origin GET and HEAD requests to public share links so they can be
+// fetched or embedded from other sites. Credentials are never allowed: the routes don't use
+// cookies or auth headers, and allowing them with a wildcard origin would be unsafe.
+// An empty origin list allows any origin.
+func PublicCORS(origins []string) gin.HandlerFunc {
+	config := cors.Config{
+		AllowMethods:     []string{"GET", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Accept", "Range", "If-Range", "If-None-Match", "If-Modified-Since", RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Content-Disposition", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", RequestIDHeader},
+		AllowCredentials: false,
+		MaxAge:           12 * time.Hour,
+	}
+	if len(origins) == 0 {
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOrigins = origins
+	}
+	return cors.New(config)
+}
+
+// ScopedCORS applies the public CORS handler to requests under any of the public path
+// prefixes and the app handler to everything else. It runs as global middleware so preflight
+// requests are answered even though the routes only register GET and HEAD.
+func ScopedCORS(app, public gin.HandlerFunc, publicPrefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, prefix := range publicPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				public(c)
+				return
+			}
+		}
+		app(c)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newScopedCORSRouter(publicOrigins []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	app := cors.New(cors.Config{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Authorization"},
+		AllowCredentials: true,
+	})
+	r.Use(ScopedCORS(app, PublicCORS(publicOrigins), PublicSharePathPrefixes))
+	r.GET("/api/files/share/:token", func(c *gin.Context) { c.String(http.StatusOK, "shared") })
+	r.GET("/api/files", func(c *gin.Context) { c.String(http.StatusOK, "private") })
+	return r
+}
+
+func corsRequest(r *gin.Engine, method, path, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Origin", origin)
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestScopedCORS_PublicShareAllowsAnyOriginWithoutCredentials(t *testing.T) {
+	r := newScopedCORSRouter(nil)
+
+	w := corsRequest(r, http.MethodGet, "/api/files/share/abc", "https://elsewhere.example.org")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = corsRequest(r, http.MethodOptions, "/api/files/share/abc", "https://elsewhere.example.org")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestScopedCORS_PublicShareOnlyAdvertisesReads(t *testing.T) {
+	r := newScopedCORSRouter(nil)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/files/share/abc", nil)
+	req.Header.Set("Origin", "https://elsewhere.example.org")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET,HEAD,OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestScopedCORS_APIStaysLockedDown(t *testing.T) {
+	r := newScopedCORSRouter(nil)
+
+	w := corsRequest(r, http.MethodGet, "/api/files", "https://elsewhere.example.org")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(r, http.MethodGet, "/api/files", "https://app.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestScopedCORS_PublicShareRestrictedOrigins(t *testing.T) {
+	r := newScopedCORSRouter([]string{"https://partner.example.net"})
+
+	w := corsRequest(r, http.MethodGet, "/api/files/share/abc", "https://partner.example.net")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://partner.example.net", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = corsRequest(r, http.MethodGet, "/api/files/share/abc", "https://elsewhere.example.org")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InFlightCounter tracks how many requests are being handled, so shutdown can report how many it
+// waited for
+type InFlightCounter struct {
+	active atomic.Int64
+}
+
+// NewInFlightCounter creates a counter with no requests in flight
+func NewInFlightCounter() *InFlightCounter {
+	return &InFlightCounter{}
+}
+
+// Middleware counts a request from when it reaches the router until its handler returns
+func (c *InFlightCounter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.active.Add(1)
+		defer c.active.Add(-1)
+		ctx.Next()
+	}
+}
+
+// Active returns the number of requests currently being handled
+func (c *InFlightCounter) Active() int64 {
+	return c.active.Load()
+}
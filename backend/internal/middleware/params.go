@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ValidateUUIDParams rejects requests whose named path parameters aren't UUIDs with a 400,
+// before the handler runs
+func ValidateUUIDParams(names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range names {
+			if _, ok := UUIDParam(c, name); !ok {
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// UUIDParam parses a path parameter as a UUID, writing a 400 response and returning
+// ok=false when it isn't one
+func UUIDParam(c *gin.Context, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s: must be a UUID", name)})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUUIDParamRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// MustParse panics on bad input, so this only stays up if the middleware runs first
+	r.GET("/files/:id/download", ValidateUUIDParams("id"), func(c *gin.Context) {
+		c.String(http.StatusOK, uuid.MustParse(c.Param("id")).String())
+	})
+	return r
+}
+
+func TestValidateUUIDParams_RejectsMalformedID(t *testing.T) {
+	r := newUUIDParamRouter()
+
+	for _, id := range []string{"not-a-uuid", "123", "00000000-0000-0000-0000-00000000000g"} {
+		w := httptest.NewRecorder()
+		assert.NotPanics(t, func() {
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/"+id+"/download", nil))
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, id)
+		assert.JSONEq(t, `{"error":"Invalid id: must be a UUID"}`, w.Body.String())
+	}
+}
+
+func TestValidateUUIDParams_AllowsValidID(t *testing.T) {
+	r := newUUIDParamRouter()
+	id := uuid.New()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/"+id.String()+"/download", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, id.String(), w.Body.String())
+}
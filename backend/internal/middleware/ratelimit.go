@@ -2,57 +2,125 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
-	"filevault/internal/models"
-
 	"github.com/gin-gonic/gin"
 )
 
-// RateLimiter implements a simple in-memory rate limiter
+// RateLimitStore records request hits per key. The in-memory store suits a single instance;
+// a shared store (such as Redis) lets several instances enforce the same limit.
+type RateLimitStore interface {
+	// Hit records a request for key if fewer than limit were recorded within window. It
+	// reports whether the request is allowed and, if not, how long until one would be.
+	Hit(key string, limit int, window time.Duration) (bool, time.Duration)
+}
+
+// rateLimitEntry is one key's sliding window of request times
+type rateLimitEntry struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// MemoryRateLimitStore keeps a sliding window of request times per key in memory
+type MemoryRateLimitStore struct {
+	entries   map[string]*rateLimitEntry
+	mutex     sync.Mutex
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: make(map[string]*rateLimitEntry),
+		now:     time.Now,
+	}
+}
+
+// Hit implements RateLimitStore
+func (s *MemoryRateLimitStore) Hit(key string, limit int, window time.Duration) (bool, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now, window)
+
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &rateLimitEntry{window: window}
+		s.entries[key] = entry
+	}
+	entry.window = window
+	entry.hits = pruneHits(entry.hits, now.Add(-window))
+
+	if len(entry.hits) < limit {
+		entry.hits = append(entry.hits, now)
+		return true, 0
+	}
+
+	retryAfter := entry.hits[0].Add(window).Sub(now)
+	return false, retryAfter
+}
+
+// sweep drops keys with no hits left in their window, at most once per window, so addresses
+// that stop sending requests don't stay in memory
+func (s *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		entry.hits = pruneHits(entry.hits, now.Add(-entry.window))
+		if len(entry.hits) == 0 {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// pruneHits removes request times at or before cutoff; hits are in ascending order
+func pruneHits(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
+
+// RateLimiter allows up to limit requests per key within a sliding window
 type RateLimiter struct {
-	requests map[string][]time.Time
-	mutex    sync.RWMutex
-	limit    int
-	window   time.Duration
+	store  RateLimitStore
+	limit  int
+	window time.Duration
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates a new rate limiter backed by its own in-memory store
 func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return NewRateLimiterWithStore(NewMemoryRateLimitStore(), limit, window)
+}
+
+// NewRateLimiterWithStore creates a rate limiter that records hits in store. Limiters sharing
+// a store must use distinct key prefixes.
+func NewRateLimiterWithStore(store RateLimitStore, limit int, window time.Duration) *RateLimiter {
 	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+		store:  store,
+		limit:  limit,
+		window: window,
 	}
 }
 
 // Allow checks if a request is allowed for the given key
 func (rl *RateLimiter) Allow(key string) bool {
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
-
-	now := time.Now()
-	cutoff := now.Add(-rl.window)
-
-	// Clean up old requests
-	if requests, exists := rl.requests[key]; exists {
-		var validRequests []time.Time
-		for _, reqTime := range requests {
-			if reqTime.After(cutoff) {
-				validRequests = append(validRequests, reqTime)
-			}
-		}
-		rl.requests[key] = validRequests
-	}
-
-	// Check if under limit
-	if len(rl.requests[key]) < rl.limit {
-		rl.requests[key] = append(rl.requests[key], now)
-		return true
-	}
+	allowed, _ := rl.Check(key)
+	return allowed
+}
 
-	return false
+// Check records a request for key and reports whether it is allowed and, if not, how long
+// the client should wait before retrying
+func (rl *RateLimiter) Check(key string) (bool, time.Duration) {
+	return rl.store.Hit(key, rl.limit, rl.window)
 }
 
 // RateLimitMiddleware creates a rate limiting middleware
@@ -61,18 +129,12 @@ func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		// Get user from context (set by auth middleware)
-		user, exists := c.Get("user")
 		var key string
-		if !exists {
+		if user, ok := CurrentUser(c); ok {
+			key = "user:" + user.ID.String()
+		} else {
 			// If no user, use IP address as fallback
 			key = "ip:" + c.ClientIP()
-		} else {
-			// Extract user ID from user object
-			if userModel, ok := user.(*models.User); ok {
-				key = "user:" + userModel.ID.String()
-			} else {
-				key = "ip:" + c.ClientIP()
-			}
 		}
 		if !limiter.Allow(key) {
 			c.JSON(http.StatusTooManyRequests, gin.H{
@@ -87,3 +149,32 @@ func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RateLimitByIP limits requests per client IP, for anonymous routes such as public share
+// links. scope separates the keys of limiters sharing a store. Rejected requests get a 429
+// with Retry-After. A nil limiter lets every request through.
+func RateLimitByIP(limiter *RateLimiter, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := limiter.Check(scope + ":ip:" + c.ClientIP())
+		if !allowed {
+			seconds := int((retryAfter + time.Second - 1) / time.Second)
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Rate limit exceeded",
+				"message":     "Too many requests. Please try again later.",
+				"retry_after": seconds,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
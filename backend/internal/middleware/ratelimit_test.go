@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock lets tests move the store's time forward without sleeping
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestStore(clock *fakeClock) *MemoryRateLimitStore {
+	store := NewMemoryRateLimitStore()
+	store.now = clock.Now
+	return store
+}
+
+func newShareRouter(view, download *RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/share/:token", RateLimitByIP(download, "share-download"), ok)
+	r.GET("/share/:token/info", RateLimitByIP(view, "share-view"), ok)
+	return r
+}
+
+func getFrom(r *gin.Engine, path, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMemoryRateLimitStore_SlidingWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := newTestStore(clock)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := store.Hit("k", 3, time.Minute)
+		assert.True(t, allowed)
+		clock.now = clock.now.Add(10 * time.Second)
+	}
+
+	allowed, retryAfter := store.Hit("k", 3, time.Minute)
+	assert.False(t, allowed)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// The first hit leaves the window after a minute
+	clock.now = clock.now.Add(30 * time.Second)
+	allowed, _ = store.Hit("k", 3, time.Minute)
+	assert.True(t, allowed)
+}
+
+func TestMemoryRateLimitStore_SweepsIdleKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	store := newTestStore(clock)
+
+	store.Hit("idle", 5, time.Minute)
+	clock.now = clock.now.Add(2 * time.Minute)
+	store.Hit("active", 5, time.Minute)
+
+	assert.NotContains(t, store.entries, "idle")
+	assert.Contains(t, store.entries, "active")
+}
+
+func TestRateLimitByIP_ThrottlesBurstFromOneIP(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	r := newShareRouter(
+		NewRateLimiterWithStore(store, 10, time.Minute),
+		NewRateLimiterWithStore(store, 5, time.Minute),
+	)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc", "203.0.113.7").Code)
+	}
+
+	w := getFrom(r, "/share/abc", "203.0.113.7")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Rate limit exceeded")
+
+	// Another client is unaffected
+	assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc", "198.51.100.2").Code)
+
+	// Viewing has its own budget
+	assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc/info", "203.0.113.7").Code)
+}
+
+func TestRateLimitByIP_IgnoresForwardedForFromUntrustedClients(t *testing.T) {
+	r := newShareRouter(NewRateLimiter(100, time.Minute), NewRateLimiter(3, time.Minute))
+	require.NoError(t, r.SetTrustedProxies(nil))
+
+	// Changing X-Forwarded-For on every request doesn't reset the client's budget
+	codes := make([]int, 0, 5)
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/share/abc", nil)
+		req.RemoteAddr = "203.0.113.7:12345"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimitByIP_TrustedProxyForwardsClientIP(t *testing.T) {
+	r := newShareRouter(NewRateLimiter(100, time.Minute), NewRateLimiter(1, time.Minute))
+	require.NoError(t, r.SetTrustedProxies([]string{"10.0.0.0/8"}))
+
+	// Behind the proxy, each forwarded client has its own budget
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/share/abc", nil)
+		req.RemoteAddr = "10.0.0.2:12345"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestRateLimitByIP_SeparateViewLimit(t *testing.T) {
+	r := newShareRouter(NewRateLimiter(2, time.Minute), NewRateLimiter(100, time.Minute))
+
+	assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc/info", "203.0.113.7").Code)
+	assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc/info", "203.0.113.7").Code)
+	assert.Equal(t, http.StatusTooManyRequests, getFrom(r, "/share/abc/info", "203.0.113.7").Code)
+	assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc", "203.0.113.7").Code)
+}
+
+func TestRateLimitByIP_NilLimiterAllowsAll(t *testing.T) {
+	r := newShareRouter(nil, nil)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, http.StatusOK, getFrom(r, "/share/abc", "203.0.113.7").Code)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header used to pass request IDs between clients and the server
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware assigns every request an ID, stores it in the request context
+// and echoes it in the response headers. A valid UUID sent by the client is reused.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if _, err := uuid.Parse(requestID); err != nil {
+			requestID = uuid.New().String()
+		}
+
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
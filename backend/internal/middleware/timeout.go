@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeout puts a deadline on each request's context, so S3 calls made with
+// c.Request.Context() are cancelled instead of tying up the goroutine when storage hangs.
+// Routes in exemptRoutes, matched against the route pattern (e.g. "/files/:id/download"), keep
+// only the client's own cancellation: uploads and downloads stream bodies that can legitimately
+// take longer than any fixed limit. A timeout of zero or less disables the deadline.
+//
+// If the deadline passes before the handler has written a response, the client gets a 504.
+func RequestTimeout(timeout time.Duration, exemptRoutes ...string) gin.HandlerFunc {
+	exempt := make(map[string]bool, len(exemptRoutes))
+	for _, route := range exemptRoutes {
+		exempt[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if timeout <= 0 || exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		}
+	}
+}
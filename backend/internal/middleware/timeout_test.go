@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTimeoutRouter(timeout time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestTimeout(timeout, "/stream/:id"))
+
+	// Blocks like a hung S3 call until the request context is cancelled
+	stuck := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+			c.String(http.StatusOK, "finished")
+		}
+	}
+	r.GET("/stuck", stuck)
+	r.GET("/stream/:id", stuck)
+	r.GET("/deadline", func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": ok})
+	})
+	return r
+}
+
+func TestRequestTimeout_CancelsStuckHandler(t *testing.T) {
+	r := newTimeoutRouter(20 * time.Millisecond)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stuck", nil))
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestRequestTimeout_ExemptRoutesHaveNoDeadline(t *testing.T) {
+	r := newTimeoutRouter(20 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream/abc", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "finished", w.Body.String())
+}
+
+func TestRequestTimeout_SetsDeadline(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTimeoutRouter(time.Minute).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/deadline", nil))
+	assert.JSONEq(t, `{"deadline": true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	newTimeoutRouter(0).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/deadline", nil))
+	assert.JSONEq(t, `{"deadline": false}`, w.Body.String(), "a zero timeout disables the deadline")
+}
@@ -0,0 +1,12 @@
+package models
+
+// Dashboard bundles what the dashboard shows on first load so it takes a single request.
+// Each part is fetched independently and left empty or zero if it fails.
+type Dashboard struct {
+	Me                      *User                  `json:"me"`
+	FileStats               map[string]interface{} `json:"fileStats"`
+	Folders                 []*Folder              `json:"folders"`
+	RecentFiles             []*File                `json:"recentFiles"`
+	UnreadShareCount        int                    `json:"unreadShareCount"`
+	UnreadNotificationCount int                    `json:"unreadNotificationCount"`
+}
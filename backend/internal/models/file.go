@@ -17,21 +17,80 @@ type File struct {
 	S3Key        string     `json:"s3Key" db:"s3_key"`
 	UploaderID   uuid.UUID  `json:"uploaderId" db:"uploader_id"`
 	FolderID     *uuid.UUID `json:"folderId" db:"folder_id"`
+	Description  *string    `json:"description" db:"description"`
 	Uploader     *User      `json:"uploader,omitempty"`
 	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`
+
+	// DownloadName overrides the filename downloads are served under without renaming the file;
+	// nil serves downloads under OriginalName
+	DownloadName *string `json:"downloadName" db:"download_name"`
+
+	// IsPublic lets anyone download the file from its canonical public URL without a share link
+	IsPublic bool `json:"isPublic" db:"is_public"`
+
+	// LastModifiedBy is the user who last renamed or re-described the file; nil if it hasn't
+	// been edited since upload
+	LastModifiedBy *uuid.UUID `json:"lastModifiedBy" db:"last_modified_by"`
+
+	// DedupDisabled marks a private copy whose S3 object is never shared with other files
+	DedupDisabled bool `json:"dedupDisabled" db:"dedup_disabled"`
+
+	// OriginalFileID points a deduplicated upload at the file whose stored content it reuses;
+	// nil for files that stored their own content or whose original has since been deleted
+	OriginalFileID *uuid.UUID `json:"originalFileId" db:"original_file_id"`
+
+	// JobStatus tracks background processing of a new upload (see the JobStatus* constants);
+	// nil when there was nothing to process
+	JobStatus *string `json:"jobStatus" db:"job_status"`
+
+	// PerceptualHash is the 64-bit pHash of an image upload, nil for other files
+	PerceptualHash *int64 `json:"-" db:"perceptual_hash"`
+
+	// ActiveShareCount is the number of downloadable public shares, populated when files are listed
+	ActiveShareCount int `json:"activeShareCount" db:"-"`
+
+	// IsDuplicate is set on upload when the content was already stored and no new object was written
+	IsDuplicate bool `json:"isDuplicate" db:"-"`
+
+	// LastAccessedAt is when the requesting user last previewed or downloaded the file,
+	// populated only for the recently accessed list
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty" db:"-"`
+}
+
+// Background processing states of a file
+const (
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusCompleted  = "completed"
+	JobStatusFailed     = "failed"
+)
+
+// File access types recorded for the recently accessed list
+const (
+	FileAccessPreview  = "preview"
+	FileAccessDownload = "download"
+)
+
+// DedupSavings is the storage a user saved by uploading content that was already stored
+type DedupSavings struct {
+	DuplicateCount int   `json:"duplicateCount"`
+	BytesSaved     int64 `json:"bytesSaved"`
 }
 
 // FileHash represents a unique file hash for deduplication
 type FileHash struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Hash      string    `json:"hash" db:"hash"`
-	FilePath  string    `json:"filePath" db:"file_path"` // Legacy field for local files
-	S3Key     string    `json:"s3Key" db:"s3_key"`       // S3 key for cloud storage
-	S3URL     string    `json:"s3Url" db:"s3_url"`       // S3 URL for cloud storage
-	Size      int64     `json:"size" db:"size"`
-	MimeType  string    `json:"mimeType" db:"mime_type"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	ID       uuid.UUID `json:"id" db:"id"`
+	Hash     string    `json:"hash" db:"hash"`
+	FilePath string    `json:"filePath" db:"file_path"` // Legacy field for local files
+	S3Key    string    `json:"s3Key" db:"s3_key"`       // S3 key for cloud storage
+	S3URL    string    `json:"s3Url" db:"s3_url"`       // S3 URL for cloud storage
+	Size     int64     `json:"size" db:"size"`
+	MimeType string    `json:"mimeType" db:"mime_type"`
+	// OwnerID is set for content stored under the per-user deduplication scope, which only
+	// that user's uploads reuse; nil for content shared by all users
+	OwnerID   *uuid.UUID `json:"ownerId,omitempty" db:"owner_id"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
 }
 
 // Share represents a file share
@@ -66,6 +125,79 @@ type FileStats struct {
 	FilesByMimeType []MimeTypeCount `json:"filesByMimeType"`
 }
 
+// CleanupCandidate is one of a user's files with what is needed to work out how much
+// storage deleting it would release
+type CleanupCandidate struct {
+	File *File
+	// LastAccessedAt is the latest preview or download by anyone, nil if never accessed
+	LastAccessedAt *time.Time
+	// SharedReferences counts the file records, this one included, that use the
+	// deduplicated object for the file's hash
+	SharedReferences int
+}
+
+// Access tiers of stored content, from most to least recently used
+const (
+	AccessTierHot  = "hot"
+	AccessTierWarm = "warm"
+	AccessTierCold = "cold"
+)
+
+// FileHeat aggregates the stored objects whose most recent use falls in one access tier
+type FileHeat struct {
+	Tier string `json:"tier"`
+	// FileCount counts file records, including deduplicated copies
+	FileCount int64 `json:"fileCount"`
+	// ObjectCount counts stored objects, each shared deduplicated object once
+	ObjectCount int64 `json:"objectCount"`
+	// TotalBytes is the stored size of those objects
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// UploadOutcomeCount is how many uploads ended with one outcome
+type UploadOutcomeCount struct {
+	Outcome string `json:"outcome"`
+	Count   int64  `json:"count"`
+}
+
+// FileExportRow is one file in an export of a user's file list
+type FileExportRow struct {
+	ID        uuid.UUID
+	Name      string
+	Size      int64
+	MimeType  string
+	CreatedAt time.Time
+	// FolderPath is the path of the file's folder, empty for files at the root
+	FolderPath string
+	// SharedPublicly is set while the file has a usable public share link
+	SharedPublicly bool
+	// SharedWithUsers is set when the file was shared with, or access granted to, other users
+	SharedWithUsers bool
+}
+
+// FileExistsResult answers whether the user already has a file with a given hash
+type FileExistsResult struct {
+	Exists bool `json:"exists"`
+	// ExistingFileID is the user's own file with that content; set whenever Exists is true
+	ExistingFileID *uuid.UUID `json:"existingFileId"`
+}
+
+// FileTextContent is the start of a text or code file for previewing it inline
+type FileTextContent struct {
+	Content string `json:"content"`
+	// Truncated is set when the file is longer than the returned content
+	Truncated bool `json:"truncated"`
+	// Language is guessed from the file name for syntax highlighting, "plaintext" if unknown
+	Language string `json:"language"`
+}
+
+// SimilarImage is an image that looks like another one, with the Hamming distance between their
+// perceptual hashes (0 means visually identical)
+type SimilarImage struct {
+	File     *File `json:"file"`
+	Distance int   `json:"distance"`
+}
+
 // MimeTypeCount represents a count of files by MIME type
 type MimeTypeCount struct {
 	MimeType string `json:"mimeType"`
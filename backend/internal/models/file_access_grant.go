@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// File access grant permissions. Download implies view.
+const (
+	FilePermissionView     = "view"
+	FilePermissionDownload = "download"
+)
+
+// FileAccessGrant gives another user persistent read-only access to a file
+type FileAccessGrant struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	FileID     uuid.UUID `json:"fileId" db:"file_id"`
+	GranteeID  uuid.UUID `json:"granteeId" db:"grantee_id"`
+	GrantedBy  uuid.UUID `json:"grantedBy" db:"granted_by"`
+	Permission string    `json:"permission" db:"permission"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// IsValidFilePermission reports whether permission is a known grant permission
+func IsValidFilePermission(permission string) bool {
+	return permission == FilePermissionView || permission == FilePermissionDownload
+}
+
+// Allows reports whether the grant covers the requested permission
+func (g *FileAccessGrant) Allows(permission string) bool {
+	if g.Permission == FilePermissionDownload {
+		return IsValidFilePermission(permission)
+	}
+	return g.Permission == permission
+}
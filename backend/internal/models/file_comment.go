@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileComment is a note left on a file by someone who can access it
+type FileComment struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	FileID         uuid.UUID `json:"fileId" db:"file_id"`
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	AuthorUsername string    `json:"authorUsername" db:"-"`
+	Body           string    `json:"body" db:"body"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
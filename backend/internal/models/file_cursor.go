@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FileCursor marks a position in a newest-first file listing ordered by (created_at, id)
+type FileCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// FilePage is one page of a cursor-paginated file listing
+type FilePage struct {
+	Files       []*File `json:"files"`
+	EndCursor   *string `json:"endCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+// CursorForFile returns the cursor positioned at the given file
+func CursorForFile(file *File) FileCursor {
+	return FileCursor{CreatedAt: file.CreatedAt, ID: file.ID}
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c FileCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeFileCursor parses a cursor produced by FileCursor.Encode
+func DecodeFileCursor(encoded string) (*FileCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAtStr, idStr, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &FileCursor{CreatedAt: createdAt, ID: id}, nil
+}
@@ -15,13 +15,41 @@ type FileShare struct {
 	ExpiresAt     *time.Time `json:"expiresAt" db:"expires_at"`
 	DownloadCount int        `json:"downloadCount" db:"download_count"`
 	MaxDownloads  *int       `json:"maxDownloads" db:"max_downloads"`
-	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
-	UpdatedAt     time.Time  `json:"updatedAt" db:"updated_at"`
+	// MaxBandwidthBps caps the download speed of the share in bytes per second; nil means no cap
+	MaxBandwidthBps *int64 `json:"maxBandwidthBps" db:"max_bandwidth_bps"`
+	// ForceDownload makes presigned links save the file even when its type could open inline
+	ForceDownload bool      `json:"forceDownload" db:"force_download"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+
+	// AllowedEmailDomains restricts downloads to viewers with an email address at one of these
+	// domains; empty means anyone with the link
+	AllowedEmailDomains []string `json:"allowedEmailDomains" db:"allowed_email_domains"`
+	// BurnAfterDownload deactivates the share and retires its token on the first download
+	BurnAfterDownload bool `json:"burnAfterDownload" db:"burn_after_download"`
 
 	// Related data (populated by joins)
 	File *File `json:"file,omitempty" db:"-"`
 }
 
+// AdminFileShare is a share as listed for admins, with the name of its file and its owner
+type AdminFileShare struct {
+	FileShare
+	FileName      string    `json:"fileName"`
+	OwnerID       uuid.UUID `json:"ownerId"`
+	OwnerUsername string    `json:"ownerUsername"`
+	OwnerEmail    string    `json:"ownerEmail"`
+}
+
+// AdminShareFilter narrows the admin share listing; zero values match everything
+type AdminShareFilter struct {
+	OwnerID *uuid.UUID
+	// IsActive matches shares by their active flag, regardless of expiry
+	IsActive *bool
+	// FileName matches shares whose file name contains it, case-insensitively
+	FileName string
+}
+
 // DownloadLog represents a download event for a shared file
 type DownloadLog struct {
 	ID           uuid.UUID `json:"id" db:"id"`
@@ -29,6 +57,9 @@ type DownloadLog struct {
 	IPAddress    *string   `json:"ipAddress" db:"ip_address"`
 	UserAgent    *string   `json:"userAgent" db:"user_agent"`
 	DownloadedAt time.Time `json:"downloadedAt" db:"downloaded_at"`
+
+	// Email is the address given to download a domain-restricted share
+	Email *string `json:"email" db:"email"`
 }
 
 // CreateFileShareRequest represents the request to create a file share
@@ -36,6 +67,14 @@ type CreateFileShareRequest struct {
 	FileID       uuid.UUID  `json:"fileId" validate:"required"`
 	ExpiresAt    *time.Time `json:"expiresAt"`
 	MaxDownloads *int       `json:"maxDownloads"`
+	// MaxBandwidthBps optionally caps the download speed in bytes per second
+	MaxBandwidthBps *int64 `json:"maxBandwidthBps"`
+	// ForceDownload makes the share's link download the file instead of opening it inline
+	ForceDownload bool `json:"forceDownload"`
+	// AllowedEmailDomains optionally limits downloads to viewers with an email at these domains
+	AllowedEmailDomains []string `json:"allowedEmailDomains"`
+	// BurnAfterDownload makes the link stop working after its first download
+	BurnAfterDownload bool `json:"burnAfterDownload"`
 }
 
 // UserFileShare represents a file shared directly with a specific user
@@ -57,16 +96,63 @@ type UserFileShare struct {
 
 // FileShareResponse represents the response for a file share
 type FileShareResponse struct {
-	ID            uuid.UUID  `json:"id"`
-	FileID        uuid.UUID  `json:"fileId"`
-	ShareToken    string     `json:"shareToken"`
-	ShareURL      string     `json:"shareUrl"`
-	IsActive      bool       `json:"isActive"`
-	ExpiresAt     *time.Time `json:"expiresAt"`
-	DownloadCount int        `json:"downloadCount"`
-	MaxDownloads  *int       `json:"maxDownloads"`
-	CreatedAt     time.Time  `json:"createdAt"`
-	File          *File      `json:"file"`
+	ID              uuid.UUID  `json:"id"`
+	FileID          uuid.UUID  `json:"fileId"`
+	ShareToken      string     `json:"shareToken"`
+	ShareURL        string     `json:"shareUrl"`
+	IsActive        bool       `json:"isActive"`
+	ExpiresAt       *time.Time `json:"expiresAt"`
+	DownloadCount   int        `json:"downloadCount"`
+	MaxDownloads    *int       `json:"maxDownloads"`
+	MaxBandwidthBps *int64     `json:"maxBandwidthBps"`
+	ForceDownload   bool       `json:"forceDownload"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	File            *File      `json:"file"`
+
+	// AllowedEmailDomains is nil for shares anyone with the link can download
+	AllowedEmailDomains []string `json:"allowedEmailDomains"`
+	BurnAfterDownload   bool     `json:"burnAfterDownload"`
+}
+
+// FileSharePage is one page of a user's file shares with the total across all pages
+type FileSharePage struct {
+	Shares     []*FileShareResponse `json:"shares"`
+	TotalCount int                  `json:"totalCount"`
+	HasMore    bool                 `json:"hasMore"`
+}
+
+// Ways a file can reach a user, as listed in SharedWithMeFile.Sources
+const (
+	SharedWithMeSourceUserShare   = "user_share"
+	SharedWithMeSourceFolderShare = "folder_share"
+	SharedWithMeSourceAccessGrant = "access_grant"
+)
+
+// SharedWithMeFile is a file another user made available to the current user, listed once
+// however many ways it was shared
+type SharedWithMeFile struct {
+	File *File `json:"file"`
+	// Sources lists every way the file was shared with the user
+	Sources []string `json:"sources"`
+	// SharedBy and SharedAt describe the most recent of those shares
+	SharedBy *User     `json:"sharedBy"`
+	SharedAt time.Time `json:"sharedAt"`
+}
+
+// SharedWithMePage is one page of the files shared with a user, newest share first
+type SharedWithMePage struct {
+	Files      []*SharedWithMeFile `json:"files"`
+	TotalCount int                 `json:"totalCount"`
+	HasMore    bool                `json:"hasMore"`
+}
+
+// FileShareHistory lists every share of one file, active or not, with download totals
+type FileShareHistory struct {
+	FileID         uuid.UUID            `json:"fileId"`
+	Shares         []*FileShareResponse `json:"shares"`
+	TotalShares    int                  `json:"totalShares"`
+	ActiveShares   int                  `json:"activeShares"`
+	TotalDownloads int                  `json:"totalDownloads"`
 }
 
 // CreateUserFileShareRequest represents the request to share a file with a user
@@ -76,6 +162,12 @@ type CreateUserFileShareRequest struct {
 	Message  *string   `json:"message"`
 }
 
+// ShareByEmailRequest represents the request to email a share link for a file
+type ShareByEmailRequest struct {
+	Email   string  `json:"email" validate:"required"`
+	Message *string `json:"message"`
+}
+
 // UserFileShareResponse represents the response for a user file share
 type UserFileShareResponse struct {
 	ID         uuid.UUID `json:"id"`
@@ -89,6 +181,43 @@ type UserFileShareResponse struct {
 	FromUser   *User     `json:"fromUser"`
 }
 
+// UserFolderShare represents a folder shared directly with a specific user
+type UserFolderShare struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	FolderID   uuid.UUID `json:"folderId" db:"folder_id"`
+	FromUserID uuid.UUID `json:"fromUserId" db:"from_user_id"`
+	ToUserID   uuid.UUID `json:"toUserId" db:"to_user_id"`
+	Message    *string   `json:"message" db:"message"`
+	IsRead     bool      `json:"isRead" db:"is_read"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+
+	// Related data (populated by joins)
+	Folder   *Folder `json:"folder,omitempty" db:"-"`
+	FromUser *User   `json:"fromUser,omitempty" db:"-"`
+	ToUser   *User   `json:"toUser,omitempty" db:"-"`
+}
+
+// CreateUserFolderShareRequest represents the request to share a folder with a user
+type CreateUserFolderShareRequest struct {
+	ToUserID uuid.UUID `json:"toUserId" validate:"required"`
+	Message  *string   `json:"message"`
+}
+
+// UserFolderShareResponse represents the response for a user folder share
+type UserFolderShareResponse struct {
+	ID         uuid.UUID `json:"id"`
+	FolderID   uuid.UUID `json:"folderId"`
+	FromUserID uuid.UUID `json:"fromUserId"`
+	ToUserID   uuid.UUID `json:"toUserId"`
+	Message    *string   `json:"message"`
+	IsRead     bool      `json:"isRead"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Folder     *Folder   `json:"folder"`
+	FromUser   *User     `json:"fromUser"`
+	Files      []*File   `json:"files"`
+}
+
 // IsExpired checks if the file share has expired
 func (fs *FileShare) IsExpired() bool {
 	if fs.ExpiresAt == nil {
@@ -14,6 +14,9 @@ type Folder struct {
 	ParentID  *uuid.UUID `json:"parentId,omitempty" db:"parent_id"`
 	OwnerID   uuid.UUID  `json:"ownerId" db:"owner_id"`
 	FileCount int        `json:"fileCount" db:"file_count"`
+	SizeBytes int64      `json:"sizeBytes" db:"-"`
+	Color     *string    `json:"color" db:"color"`
+	Icon      *string    `json:"icon" db:"icon"`
 	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time  `json:"updatedAt" db:"updated_at"`
 
@@ -27,11 +30,16 @@ type Folder struct {
 type CreateFolderRequest struct {
 	Name     string     `json:"name" validate:"required,min=1,max=255"`
 	ParentID *uuid.UUID `json:"parentId,omitempty"`
+	Color    *string    `json:"color,omitempty"`
+	Icon     *string    `json:"icon,omitempty"`
 }
 
-// UpdateFolderRequest represents the request to update a folder
+// UpdateFolderRequest represents the request to update a folder. An empty name keeps the
+// current one; a nil color or icon is left unchanged and an empty one clears it.
 type UpdateFolderRequest struct {
-	Name string `json:"name" validate:"required,min=1,max=255"`
+	Name  string  `json:"name" validate:"omitempty,min=1,max=255"`
+	Color *string `json:"color,omitempty"`
+	Icon  *string `json:"icon,omitempty"`
 }
 
 // FolderResponse represents the response for folder operations
@@ -42,6 +50,8 @@ type FolderResponse struct {
 	ParentID   *uuid.UUID        `json:"parentId,omitempty"`
 	OwnerID    uuid.UUID         `json:"ownerId"`
 	FileCount  int               `json:"fileCount"`
+	Color      *string           `json:"color"`
+	Icon       *string           `json:"icon"`
 	CreatedAt  time.Time         `json:"createdAt"`
 	UpdatedAt  time.Time         `json:"updatedAt"`
 	Subfolders []*FolderResponse `json:"subfolders,omitempty"`
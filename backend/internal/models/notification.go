@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification is an in-app notification stored for a user
+type Notification struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"userId" db:"user_id"`
+	Type      string     `json:"type" db:"type"`
+	Title     string     `json:"title" db:"title"`
+	Message   string     `json:"message" db:"message"`
+	IsRead    bool       `json:"isRead" db:"is_read"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	ReadAt    *time.Time `json:"readAt" db:"read_at"`
+}
+
+// NotificationList is a page of notifications together with the user's unread count
+type NotificationList struct {
+	Notifications []*Notification `json:"notifications"`
+	UnreadCount   int             `json:"unreadCount"`
+}
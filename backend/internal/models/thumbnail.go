@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Thumbnail is a scaled-down copy of an image file's content at one size. Thumbnails are keyed
+// by content hash, so deduplicated files share them.
+type Thumbnail struct {
+	Hash string `json:"hash" db:"hash"`
+	// Size is the requested bounding box side in pixels; Width and Height are the actual
+	// dimensions, which keep the source's aspect ratio
+	Size        int       `json:"size" db:"size"`
+	Width       int       `json:"width" db:"width"`
+	Height      int       `json:"height" db:"height"`
+	S3Key       string    `json:"-" db:"s3_key"`
+	ContentType string    `json:"contentType" db:"content_type"`
+	ByteSize    int64     `json:"byteSize" db:"byte_size"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
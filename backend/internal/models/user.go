@@ -8,13 +8,14 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Email     string    `json:"email" db:"email"`
-	Username  string    `json:"username" db:"username"`
-	Password  string    `json:"-" db:"password"` // Never expose password in JSON
-	Role      string    `json:"role" db:"role"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID          uuid.UUID `json:"id" db:"id"`
+	Email       string    `json:"email" db:"email"`
+	Username    string    `json:"username" db:"username"`
+	Password    string    `json:"-" db:"password"` // Never expose password in JSON
+	Role        string    `json:"role" db:"role"`
+	DedupOptOut bool      `json:"dedupOptOut" db:"dedup_opt_out"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
 }
 
 // UserRole constants
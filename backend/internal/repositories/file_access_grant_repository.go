@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// FileAccessGrantRepository handles database operations for file access grants
+type FileAccessGrantRepository struct {
+	db *sql.DB
+}
+
+// NewFileAccessGrantRepository creates a new file access grant repository
+func NewFileAccessGrantRepository(db *sql.DB) *FileAccessGrantRepository {
+	return &FileAccessGrantRepository{db: db}
+}
+
+// Upsert creates a grant, or updates the permission if the grantee already has one for the file
+func (r *FileAccessGrantRepository) Upsert(grant *models.FileAccessGrant) error {
+	query := `
+		INSERT INTO file_access_grants (id, file_id, grantee_id, granted_by, permission)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (file_id, grantee_id)
+		DO UPDATE SET permission = EXCLUDED.permission, granted_by = EXCLUDED.granted_by, updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(query,
+		grant.ID,
+		grant.FileID,
+		grant.GranteeID,
+		grant.GrantedBy,
+		grant.Permission,
+	).Scan(&grant.ID, &grant.CreatedAt, &grant.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save file access grant: %w", err)
+	}
+
+	return nil
+}
+
+// GetByFileAndGrantee retrieves the grant a user holds for a file, or nil if there is none
+func (r *FileAccessGrantRepository) GetByFileAndGrantee(fileID, granteeID uuid.UUID) (*models.FileAccessGrant, error) {
+	query := `
+		SELECT id, file_id, grantee_id, granted_by, permission, created_at, updated_at
+		FROM file_access_grants
+		WHERE file_id = $1 AND grantee_id = $2
+	`
+
+	grant := &models.FileAccessGrant{}
+	err := r.db.QueryRow(query, fileID, granteeID).Scan(
+		&grant.ID,
+		&grant.FileID,
+		&grant.GranteeID,
+		&grant.GrantedBy,
+		&grant.Permission,
+		&grant.CreatedAt,
+		&grant.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file access grant: %w", err)
+	}
+
+	return grant, nil
+}
+
+// Delete removes a user's grant for a file. It returns false if there was no grant.
+func (r *FileAccessGrantRepository) Delete(fileID, granteeID uuid.UUID) (bool, error) {
+	query := `DELETE FROM file_access_grants WHERE file_id = $1 AND grantee_id = $2`
+	result, err := r.db.Exec(query, fileID, granteeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete file access grant: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete file access grant: %w", err)
+	}
+
+	return rows > 0, nil
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// FileCommentRepository handles database operations for file comments
+type FileCommentRepository struct {
+	db *sql.DB
+}
+
+// NewFileCommentRepository creates a new file comment repository
+func NewFileCommentRepository(db *sql.DB) *FileCommentRepository {
+	return &FileCommentRepository{db: db}
+}
+
+// Create stores a new comment
+func (r *FileCommentRepository) Create(comment *models.FileComment) error {
+	query := `
+		INSERT INTO file_comments (id, file_id, user_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRow(query, comment.ID, comment.FileID, comment.UserID, comment.Body).Scan(&comment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create file comment: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a comment, or nil if it doesn't exist
+func (r *FileCommentRepository) GetByID(id uuid.UUID) (*models.FileComment, error) {
+	query := `
+		SELECT c.id, c.file_id, c.user_id, u.username, c.body, c.created_at
+		FROM file_comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1
+	`
+
+	comment := &models.FileComment{}
+	err := r.db.QueryRow(query, id).Scan(
+		&comment.ID,
+		&comment.FileID,
+		&comment.UserID,
+		&comment.AuthorUsername,
+		&comment.Body,
+		&comment.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// ListByFile returns a page of a file's comments, oldest first
+func (r *FileCommentRepository) ListByFile(fileID uuid.UUID, limit, offset int) ([]*models.FileComment, error) {
+	query := `
+		SELECT c.id, c.file_id, c.user_id, u.username, c.body, c.created_at
+		FROM file_comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.file_id = $1
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(query, fileID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments := []*models.FileComment{}
+	for rows.Next() {
+		comment := &models.FileComment{}
+		err := rows.Scan(
+			&comment.ID,
+			&comment.FileID,
+			&comment.UserID,
+			&comment.AuthorUsername,
+			&comment.Body,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+// Delete removes a comment
+func (r *FileCommentRepository) Delete(id uuid.UUID) error {
+	_, err := r.db.Exec(`DELETE FROM file_comments WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete file comment: %w", err)
+	}
+
+	return nil
+}
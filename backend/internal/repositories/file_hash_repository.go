@@ -5,6 +5,9 @@ import (
 	"fmt"
 
 	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // FileHashRepository handles file hash-related database operations
@@ -20,8 +23,8 @@ func NewFileHashRepository(db *sql.DB) *FileHashRepository {
 // Create creates a new file hash record
 func (r *FileHashRepository) Create(fileHash *models.FileHash) error {
 	query := `
-		INSERT INTO file_hashes (id, hash, file_path, s3_key, s3_url, size, mime_type)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO file_hashes (id, hash, file_path, s3_key, s3_url, size, mime_type, owner_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING created_at
 	`
 
@@ -34,6 +37,7 @@ func (r *FileHashRepository) Create(fileHash *models.FileHash) error {
 		fileHash.S3URL,
 		fileHash.Size,
 		fileHash.MimeType,
+		fileHash.OwnerID,
 	).Scan(&fileHash.CreatedAt)
 
 	if err != nil {
@@ -43,16 +47,31 @@ func (r *FileHashRepository) Create(fileHash *models.FileHash) error {
 	return nil
 }
 
-// GetByHash retrieves a file hash by hash
+// GetByHash retrieves the shared file hash for a hash, ignoring hashes owned by a user
 func (r *FileHashRepository) GetByHash(hash string) (*models.FileHash, error) {
 	query := `
-		SELECT id, hash, file_path, s3_key, s3_url, size, mime_type, created_at
+		SELECT id, hash, file_path, s3_key, s3_url, size, mime_type, owner_id, created_at
 		FROM file_hashes
-		WHERE hash = $1
+		WHERE hash = $1 AND owner_id IS NULL
 	`
+	return r.scanOne(r.db.QueryRow(query, hash))
+}
 
+// GetByOwnerAndHash retrieves the file hash a user owns for a hash under the per-user
+// deduplication scope
+func (r *FileHashRepository) GetByOwnerAndHash(ownerID uuid.UUID, hash string) (*models.FileHash, error) {
+	query := `
+		SELECT id, hash, file_path, s3_key, s3_url, size, mime_type, owner_id, created_at
+		FROM file_hashes
+		WHERE hash = $1 AND owner_id = $2
+	`
+	return r.scanOne(r.db.QueryRow(query, hash, ownerID))
+}
+
+// scanOne scans a single file hash row, returning nil, nil when there is none
+func (r *FileHashRepository) scanOne(row *sql.Row) (*models.FileHash, error) {
 	fileHash := &models.FileHash{}
-	err := r.db.QueryRow(query, hash).Scan(
+	err := row.Scan(
 		&fileHash.ID,
 		&fileHash.Hash,
 		&fileHash.FilePath,
@@ -60,6 +79,7 @@ func (r *FileHashRepository) GetByHash(hash string) (*models.FileHash, error) {
 		&fileHash.S3URL,
 		&fileHash.Size,
 		&fileHash.MimeType,
+		&fileHash.OwnerID,
 		&fileHash.CreatedAt,
 	)
 
@@ -73,10 +93,11 @@ func (r *FileHashRepository) GetByHash(hash string) (*models.FileHash, error) {
 	return fileHash, nil
 }
 
-// Delete deletes a file hash
-func (r *FileHashRepository) Delete(hash string) error {
-	query := `DELETE FROM file_hashes WHERE hash = $1`
-	_, err := r.db.Exec(query, hash)
+// Delete deletes a file hash. Hashes are deleted by ID since the same content may be stored
+// more than once under the per-user deduplication scope.
+func (r *FileHashRepository) Delete(id uuid.UUID) error {
+	query := `DELETE FROM file_hashes WHERE id = $1`
+	_, err := r.db.Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete file hash: %w", err)
 	}
@@ -84,7 +105,7 @@ func (r *FileHashRepository) Delete(hash string) error {
 	return nil
 }
 
-// Exists checks if a file hash exists
+// Exists checks if a file hash exists under any scope
 func (r *FileHashRepository) Exists(hash string) (bool, error) {
 	query := `SELECT EXISTS(SELECT 1 FROM file_hashes WHERE hash = $1)`
 	var exists bool
@@ -95,7 +116,7 @@ func (r *FileHashRepository) Exists(hash string) (bool, error) {
 	return exists, nil
 }
 
-// GetTotalHashes returns the total number of unique file hashes
+// GetTotalHashes returns the total number of file hashes, one per stored object
 func (r *FileHashRepository) GetTotalHashes() (int64, error) {
 	query := `SELECT COUNT(*) FROM file_hashes`
 	var count int64
@@ -116,3 +137,78 @@ func (r *FileHashRepository) GetTotalStorage() (int64, error) {
 	}
 	return totalSize, nil
 }
+
+// ListPage retrieves file hashes ordered by creation time for batch processing
+func (r *FileHashRepository) ListPage(limit, offset int) ([]*models.FileHash, error) {
+	query := `
+		SELECT id, hash, file_path, COALESCE(s3_key, ''), COALESCE(s3_url, ''), size, mime_type, owner_id, created_at
+		FROM file_hashes
+		ORDER BY created_at ASC, id ASC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []*models.FileHash
+	for rows.Next() {
+		fileHash := &models.FileHash{}
+		if err := rows.Scan(
+			&fileHash.ID,
+			&fileHash.Hash,
+			&fileHash.FilePath,
+			&fileHash.S3Key,
+			&fileHash.S3URL,
+			&fileHash.Size,
+			&fileHash.MimeType,
+			&fileHash.OwnerID,
+			&fileHash.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan file hash: %w", err)
+		}
+		hashes = append(hashes, fileHash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list file hashes: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// FindReferencedS3Keys returns which of the given S3 keys are referenced by a file hash or file record
+func (r *FileHashRepository) FindReferencedS3Keys(keys []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	if len(keys) == 0 {
+		return referenced, nil
+	}
+
+	query := `
+		SELECT s3_key FROM file_hashes WHERE s3_key = ANY($1)
+		UNION
+		SELECT s3_key FROM files WHERE s3_key = ANY($1)
+	`
+
+	rows, err := r.db.Query(query, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find referenced S3 keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan S3 key: %w", err)
+		}
+		referenced[key] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find referenced S3 keys: %w", err)
+	}
+
+	return referenced, nil
+}
@@ -3,6 +3,8 @@ package repositories
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"filevault/internal/models"
 
@@ -20,8 +22,8 @@ func NewFileRepository(db *sql.DB) *FileRepository {
 // Create creates a new file record
 func (r *FileRepository) Create(file *models.File) error {
 	query := `
-	INSERT INTO files (id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	INSERT INTO files (id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id, dedup_disabled, perceptual_hash, job_status, original_file_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		RETURNING created_at, updated_at
 	`
 
@@ -36,6 +38,10 @@ func (r *FileRepository) Create(file *models.File) error {
 		file.S3Key,
 		file.UploaderID,
 		file.FolderID,
+		file.DedupDisabled,
+		file.PerceptualHash,
+		file.JobStatus,
+		file.OriginalFileID,
 	).Scan(&file.CreatedAt, &file.UpdatedAt)
 
 	if err != nil {
@@ -48,7 +54,7 @@ func (r *FileRepository) Create(file *models.File) error {
 // GetByID retrieves a file by ID
 func (r *FileRepository) GetByID(id uuid.UUID) (*models.File, error) {
 	query := `
-		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.created_at, f.updated_at,
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.download_name, f.is_public, f.dedup_disabled, f.perceptual_hash, f.job_status, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
 		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
 		FROM files f
 		LEFT JOIN users u ON f.uploader_id = u.id
@@ -68,6 +74,14 @@ func (r *FileRepository) GetByID(id uuid.UUID) (*models.File, error) {
 		&file.S3Key,
 		&file.UploaderID,
 		&file.FolderID,
+		&file.Description,
+		&file.DownloadName,
+		&file.IsPublic,
+		&file.DedupDisabled,
+		&file.PerceptualHash,
+		&file.JobStatus,
+		&file.OriginalFileID,
+		&file.LastModifiedBy,
 		&file.CreatedAt,
 		&file.UpdatedAt,
 		&uploader.ID,
@@ -89,18 +103,60 @@ func (r *FileRepository) GetByID(id uuid.UUID) (*models.File, error) {
 	return file, nil
 }
 
-// GetByUserID retrieves files for a specific user
+// FileOrderClause builds the ORDER BY clause for file listings aliased as f. sortBy is "name",
+// "size", "type" or "date" and sortOrder "asc" or "desc"; anything else falls back to the
+// default, newest first, so user input never reaches the SQL.
+func FileOrderClause(sortBy, sortOrder string) string {
+	var orderBy string
+	switch strings.ToLower(strings.TrimSpace(sortBy)) {
+	case "name":
+		orderBy = "f.original_name"
+	case "size":
+		orderBy = "f.size"
+	case "type":
+		orderBy = "f.mime_type"
+	default:
+		orderBy = "f.created_at"
+	}
+
+	if strings.ToLower(strings.TrimSpace(sortOrder)) == "asc" {
+		return fmt.Sprintf("ORDER BY %s ASC", orderBy)
+	}
+	return fmt.Sprintf("ORDER BY %s DESC", orderBy)
+}
+
+// GetByUserID retrieves files for a specific user, newest first
 func (r *FileRepository) GetByUserID(userID uuid.UUID, limit, offset int) ([]*models.File, error) {
-	fmt.Printf("DEBUG: FileRepository.GetByUserID called - User: %s, Limit: %d, Offset: %d\n", userID, limit, offset)
-	query := `
-		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.created_at, f.updated_at,
+	return r.GetByUserIDSorted(userID, "", "", limit, offset)
+}
+
+// GetByUserIDSorted retrieves files for a specific user in the order chosen by FileOrderClause
+func (r *FileRepository) GetByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	return r.listByUploader(userID, false, sortBy, sortOrder, limit, offset)
+}
+
+// GetRootByUserIDSorted retrieves a user's files that aren't in any folder, in the order chosen
+// by FileOrderClause
+func (r *FileRepository) GetRootByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	return r.listByUploader(userID, true, sortBy, sortOrder, limit, offset)
+}
+
+// listByUploader lists a user's files, only those outside every folder if rootOnly is set
+func (r *FileRepository) listByUploader(userID uuid.UUID, rootOnly bool, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	fmt.Printf("DEBUG: FileRepository.GetByUserID called - User: %s, Root only: %t, Limit: %d, Offset: %d\n", userID, rootOnly, limit, offset)
+	folderFilter := ""
+	if rootOnly {
+		folderFilter = "AND f.folder_id IS NULL"
+	}
+	query := fmt.Sprintf(`
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
 		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
 		FROM files f
 		LEFT JOIN users u ON f.uploader_id = u.id
-		WHERE f.uploader_id = $1
-		ORDER BY f.created_at DESC
+		WHERE f.uploader_id = $1 %s
+		%s
 		LIMIT $2 OFFSET $3
-	`
+	`, folderFilter, FileOrderClause(sortBy, sortOrder))
 
 	fmt.Printf("DEBUG: Executing query: %s\n", query)
 	fmt.Printf("DEBUG: Query parameters: userID=%s, limit=%d, offset=%d\n", userID, limit, offset)
@@ -127,6 +183,291 @@ func (r *FileRepository) GetByUserID(userID uuid.UUID, limit, offset int) ([]*mo
 			&file.S3Key,
 			&file.UploaderID,
 			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+			&uploader.ID,
+			&uploader.Email,
+			&uploader.Username,
+			&uploader.Role,
+			&uploader.CreatedAt,
+			&uploader.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+
+		file.Uploader = uploader
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// StreamForExport calls fn with each of a user's files, oldest first, as rows are read, so even
+// very large file lists are never held in memory. Folder paths are built from the folder tree
+// rather than the stored path, which isn't updated when a parent folder is renamed. Iteration
+// stops at the first error fn returns.
+func (r *FileRepository) StreamForExport(userID uuid.UUID, fn func(row *models.FileExportRow) error) error {
+	query := `
+		WITH RECURSIVE folder_paths AS (
+			SELECT id, name::text AS path
+			FROM folders
+			WHERE owner_id = $1 AND parent_id IS NULL
+			UNION ALL
+			SELECT child.id, parent.path || '/' || child.name
+			FROM folders child
+			JOIN folder_paths parent ON child.parent_id = parent.id
+		)
+		SELECT f.id, f.original_name, f.size, f.mime_type, f.created_at, COALESCE(fp.path, ''),
+		       EXISTS (
+		           SELECT 1 FROM file_shares s
+		           WHERE s.file_id = f.id AND s.is_active = true
+		             AND (s.expires_at IS NULL OR s.expires_at > NOW())
+		             AND (s.max_downloads IS NULL OR s.download_count < s.max_downloads)
+		       ),
+		       EXISTS (SELECT 1 FROM user_file_shares us WHERE us.file_id = f.id)
+		           OR EXISTS (SELECT 1 FROM file_access_grants g WHERE g.file_id = f.id)
+		FROM files f
+		LEFT JOIN folder_paths fp ON fp.id = f.folder_id
+		WHERE f.uploader_id = $1
+		ORDER BY f.created_at, f.id
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to export files: %w", err)
+	}
+	defer rows.Close()
+
+	var row models.FileExportRow
+	for rows.Next() {
+		err := rows.Scan(
+			&row.ID,
+			&row.Name,
+			&row.Size,
+			&row.MimeType,
+			&row.CreatedAt,
+			&row.FolderPath,
+			&row.SharedPublicly,
+			&row.SharedWithUsers,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan exported file: %w", err)
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export files: %w", err)
+	}
+	return nil
+}
+
+// GetByUserIDAfter retrieves a user's files newest first, starting after the cursor.
+// Keyset pagination on (created_at, id) keeps pages stable while files are added or deleted.
+// A nil cursor starts from the newest file.
+func (r *FileRepository) GetByUserIDAfter(userID uuid.UUID, cursor *models.FileCursor, limit int) ([]*models.File, error) {
+	query := `
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
+		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
+		FROM files f
+		LEFT JOIN users u ON f.uploader_id = u.id
+		WHERE f.uploader_id = $1
+		  AND ($2::timestamptz IS NULL OR (f.created_at, f.id) < ($2::timestamptz, $3::uuid))
+		ORDER BY f.created_at DESC, f.id DESC
+		LIMIT $4
+	`
+
+	var createdAt *time.Time
+	var id *uuid.UUID
+	if cursor != nil {
+		createdAt = &cursor.CreatedAt
+		id = &cursor.ID
+	}
+
+	rows, err := r.db.Query(query, userID, createdAt, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		uploader := &models.User{}
+
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+			&uploader.ID,
+			&uploader.Email,
+			&uploader.Username,
+			&uploader.Role,
+			&uploader.CreatedAt,
+			&uploader.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+
+		file.Uploader = uploader
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	return files, nil
+}
+
+// RecordAccess logs that a user previewed or downloaded a file. Repeated reads of the same
+// kind within a minute (e.g. range requests while streaming a video) are only logged once.
+func (r *FileRepository) RecordAccess(userID, fileID uuid.UUID, accessType string) error {
+	query := `
+		INSERT INTO file_access_events (user_id, file_id, access_type)
+		SELECT $1, $2, $3
+		WHERE NOT EXISTS (
+			SELECT 1 FROM file_access_events
+			WHERE user_id = $1 AND file_id = $2 AND access_type = $3
+			  AND accessed_at > NOW() - INTERVAL '1 minute'
+		)
+	`
+
+	if _, err := r.db.Exec(query, userID, fileID, accessType); err != nil {
+		return fmt.Errorf("failed to record file access: %w", err)
+	}
+	return nil
+}
+
+// GetRecentUploads retrieves the latest files uploaded by any user, newest first, with their uploaders
+func (r *FileRepository) GetRecentUploads(limit int) ([]*models.File, error) {
+	query := `
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
+		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
+		FROM files f
+		JOIN users u ON f.uploader_id = u.id
+		ORDER BY f.created_at DESC, f.id DESC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		uploader := &models.User{}
+
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+			&uploader.ID,
+			&uploader.Email,
+			&uploader.Username,
+			&uploader.Role,
+			&uploader.CreatedAt,
+			&uploader.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+
+		file.Uploader = uploader
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get recent uploads: %w", err)
+	}
+
+	return files, nil
+}
+
+// GetRecentlyAccessedByUser retrieves the distinct files a user most recently previewed or
+// downloaded, ordered by their latest access. Files the user can no longer read through
+// ownership, an access grant or a shared folder are left out.
+func (r *FileRepository) GetRecentlyAccessedByUser(userID uuid.UUID, limit int) ([]*models.File, error) {
+	query := `
+		WITH RECURSIVE shared_tree AS (
+			SELECT folder_id AS id FROM user_folder_shares WHERE to_user_id = $1
+			UNION
+			SELECT fo.id FROM folders fo INNER JOIN shared_tree st ON fo.parent_id = st.id
+		),
+		recent AS (
+			SELECT file_id, MAX(accessed_at) AS last_accessed_at
+			FROM file_access_events
+			WHERE user_id = $1
+			GROUP BY file_id
+		)
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
+		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at,
+		       recent.last_accessed_at
+		FROM recent
+		JOIN files f ON f.id = recent.file_id
+		LEFT JOIN users u ON f.uploader_id = u.id
+		WHERE f.uploader_id = $1
+		   OR EXISTS (SELECT 1 FROM file_access_grants g WHERE g.file_id = f.id AND g.grantee_id = $1)
+		   OR f.folder_id IN (SELECT id FROM shared_tree)
+		ORDER BY recent.last_accessed_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recently accessed files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		uploader := &models.User{}
+		var lastAccessedAt time.Time
+
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
 			&file.CreatedAt,
 			&file.UpdatedAt,
 			&uploader.ID,
@@ -135,22 +476,28 @@ func (r *FileRepository) GetByUserID(userID uuid.UUID, limit, offset int) ([]*mo
 			&uploader.Role,
 			&uploader.CreatedAt,
 			&uploader.UpdatedAt,
+			&lastAccessedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan file: %w", err)
 		}
 
 		file.Uploader = uploader
+		file.LastAccessedAt = &lastAccessedAt
 		files = append(files, file)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get recently accessed files: %w", err)
+	}
+
 	return files, nil
 }
 
 // SearchByUserID searches files for a specific user
 func (r *FileRepository) SearchByUserID(userID uuid.UUID, searchTerm string, limit, offset int) ([]*models.File, error) {
 	query := `
-		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.created_at, f.updated_at,
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
 		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
 		FROM files f
 		LEFT JOIN users u ON f.uploader_id = u.id
@@ -181,6 +528,9 @@ func (r *FileRepository) SearchByUserID(userID uuid.UUID, searchTerm string, lim
 			&file.S3Key,
 			&file.UploaderID,
 			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
 			&file.CreatedAt,
 			&file.UpdatedAt,
 			&uploader.ID,
@@ -204,7 +554,7 @@ func (r *FileRepository) SearchByUserID(userID uuid.UUID, searchTerm string, lim
 // GetByHash retrieves files by hash
 func (r *FileRepository) GetByHash(hash string) ([]*models.File, error) {
 	query := `
-		SELECT id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id, created_at, updated_at
+		SELECT id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id, description, dedup_disabled, created_at, updated_at
 		FROM files
 		WHERE hash = $1
 	`
@@ -228,6 +578,8 @@ func (r *FileRepository) GetByHash(hash string) ([]*models.File, error) {
 			&file.S3Key,
 			&file.UploaderID,
 			&file.FolderID,
+			&file.Description,
+			&file.DedupDisabled,
 			&file.CreatedAt,
 			&file.UpdatedAt,
 		)
@@ -240,9 +592,411 @@ func (r *FileRepository) GetByHash(hash string) ([]*models.File, error) {
 	return files, nil
 }
 
-// Delete deletes a file by ID
+// GetWithPerceptualHash returns the images that have a perceptual hash, limited to one uploader
+// unless uploaderID is nil
+func (r *FileRepository) GetWithPerceptualHash(uploaderID *uuid.UUID) ([]*models.File, error) {
+	query := `
+		SELECT id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id, description, dedup_disabled, perceptual_hash, created_at, updated_at
+		FROM files
+		WHERE perceptual_hash IS NOT NULL AND ($1::uuid IS NULL OR uploader_id = $1)
+	`
+
+	rows, err := r.db.Query(query, uploaderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hashed images: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.DedupDisabled,
+			&file.PerceptualHash,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// GetUnfinishedProcessing returns files whose background processing is pending or was interrupted,
+// oldest first
+func (r *FileRepository) GetUnfinishedProcessing(limit int) ([]*models.File, error) {
+	query := `
+		SELECT id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id, description, dedup_disabled, job_status, created_at, updated_at
+		FROM files
+		WHERE job_status IN ('pending', 'processing')
+		ORDER BY created_at ASC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unfinished processing: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.DedupDisabled,
+			&file.JobStatus,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// UpdateJobStatus records the background processing state of a file
+func (r *FileRepository) UpdateJobStatus(id uuid.UUID, status string) error {
+	_, err := r.db.Exec(`UPDATE files SET job_status = $2 WHERE id = $1`, id, status)
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+	return nil
+}
+
+// GetMimeUnchecked returns stored files whose MIME type hasn't been checked against their
+// content yet, oldest first
+func (r *FileRepository) GetMimeUnchecked(limit int) ([]*models.File, error) {
+	query := `
+		SELECT id, original_name, mime_type, size, hash, s3_key, created_at
+		FROM files
+		WHERE mime_checked_at IS NULL AND s3_key IS NOT NULL AND s3_key <> ''
+		ORDER BY created_at ASC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files for MIME check: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		if err := rows.Scan(&file.ID, &file.OriginalName, &file.MimeType, &file.Size, &file.Hash, &file.S3Key, &file.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// MarkMimeChecked records that a file's MIME type was checked, setting it to mimeType when
+// that is non-empty
+func (r *FileRepository) MarkMimeChecked(id uuid.UUID, mimeType string) error {
+	query := `UPDATE files SET mime_checked_at = NOW(), mime_type = COALESCE(NULLIF($2, ''), mime_type) WHERE id = $1`
+	if _, err := r.db.Exec(query, id, mimeType); err != nil {
+		return fmt.Errorf("failed to update MIME type: %w", err)
+	}
+	return nil
+}
+
+// UpdatePerceptualHash stores the perceptual hash computed for an image
+func (r *FileRepository) UpdatePerceptualHash(id uuid.UUID, hash int64) error {
+	_, err := r.db.Exec(`UPDATE files SET perceptual_hash = $2 WHERE id = $1`, id, hash)
+	if err != nil {
+		return fmt.Errorf("failed to update perceptual hash: %w", err)
+	}
+	return nil
+}
+
+// GetByUploaderFolderAndHash finds a user's file with the given content and name in a folder
+// (nil for the root), returning nil if there is none
+func (r *FileRepository) GetByUploaderFolderAndHash(uploaderID uuid.UUID, folderID *uuid.UUID, hash, originalName string) (*models.File, error) {
+	query := `
+		SELECT id, filename, original_name, mime_type, size, hash, s3_key, uploader_id, folder_id, description, created_at, updated_at
+		FROM files
+		WHERE uploader_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND hash = $3 AND original_name = $4
+		ORDER BY created_at ASC
+		LIMIT 1
+	`
+
+	file := &models.File{}
+	err := r.db.QueryRow(query, uploaderID, folderID, hash, originalName).Scan(
+		&file.ID,
+		&file.Filename,
+		&file.OriginalName,
+		&file.MimeType,
+		&file.Size,
+		&file.Hash,
+		&file.S3Key,
+		&file.UploaderID,
+		&file.FolderID,
+		&file.Description,
+		&file.CreatedAt,
+		&file.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate file: %w", err)
+	}
+
+	return file, nil
+}
+
+// GetMimeTypeCounts returns each distinct MIME type among a user's files with how many files have it,
+// most common first
+func (r *FileRepository) GetMimeTypeCounts(userID uuid.UUID) ([]models.MimeTypeCount, error) {
+	query := `
+		SELECT mime_type, COUNT(*) AS count
+		FROM files
+		WHERE uploader_id = $1
+		GROUP BY mime_type
+		ORDER BY count DESC, mime_type ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MIME type counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []models.MimeTypeCount{}
+	for rows.Next() {
+		var count models.MimeTypeCount
+		if err := rows.Scan(&count.MimeType, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan MIME type count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// GetDedupSavings counts a user's files that reuse content stored by an earlier file, and the
+// bytes they would otherwise have taken. Private copies store their own content, so they neither
+// count nor serve as the stored copy.
+func (r *FileRepository) GetDedupSavings(userID uuid.UUID) (int, int64, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(f.size), 0)
+		FROM files f
+		WHERE f.uploader_id = $1
+		  AND NOT f.dedup_disabled
+		  AND EXISTS (
+			SELECT 1 FROM files o
+			WHERE o.hash = f.hash AND NOT o.dedup_disabled AND (o.created_at, o.id) < (f.created_at, f.id)
+		  )
+	`
+
+	var count int
+	var bytesSaved int64
+	if err := r.db.QueryRow(query, userID).Scan(&count, &bytesSaved); err != nil {
+		return 0, 0, fmt.Errorf("failed to get dedup savings: %w", err)
+	}
+	return count, bytesSaved, nil
+}
+
+// GetAccessHeat buckets stored objects into access tiers by when any file using them was last
+// previewed or downloaded, falling back to upload time for files never accessed. Objects used
+// at or after hotSince are hot, at or after warmSince warm, and the rest cold. Only tiers with
+// at least one object are returned.
+func (r *FileRepository) GetAccessHeat(hotSince, warmSince time.Time) ([]models.FileHeat, error) {
+	query := `
+		WITH last_access AS (
+			SELECT file_id, MAX(accessed_at) AS last_accessed_at
+			FROM file_access_events
+			GROUP BY file_id
+		),
+		objects AS (
+			SELECT COUNT(*) AS files, MAX(f.size) AS size,
+			       MAX(COALESCE(la.last_accessed_at, f.created_at)) AS last_used
+			FROM files f
+			LEFT JOIN last_access la ON la.file_id = f.id
+			GROUP BY COALESCE(NULLIF(f.s3_key, ''), f.id::text)
+		)
+		SELECT CASE
+		           WHEN last_used >= $1 THEN 'hot'
+		           WHEN last_used >= $2 THEN 'warm'
+		           ELSE 'cold'
+		       END AS tier,
+		       SUM(files), COUNT(*), SUM(size)
+		FROM objects
+		GROUP BY tier
+	`
+
+	rows, err := r.db.Query(query, hotSince, warmSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access heat: %w", err)
+	}
+	defer rows.Close()
+
+	var tiers []models.FileHeat
+	for rows.Next() {
+		var heat models.FileHeat
+		if err := rows.Scan(&heat.Tier, &heat.FileCount, &heat.ObjectCount, &heat.TotalBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan access heat: %w", err)
+		}
+		tiers = append(tiers, heat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read access heat: %w", err)
+	}
+
+	return tiers, nil
+}
+
+// GetCleanupCandidates returns all of a user's files with their last access time and how many
+// file records across all users share each file's deduplicated content
+func (r *FileRepository) GetCleanupCandidates(userID uuid.UUID) ([]*models.CleanupCandidate, error) {
+	query := `
+		WITH last_access AS (
+			SELECT file_id, MAX(accessed_at) AS last_accessed_at
+			FROM file_access_events
+			GROUP BY file_id
+		),
+		shared_refs AS (
+			SELECT hash, COUNT(*) AS refs
+			FROM files
+			WHERE NOT dedup_disabled
+			GROUP BY hash
+		)
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.dedup_disabled, f.created_at, f.updated_at,
+		       la.last_accessed_at, COALESCE(sr.refs, 0)
+		FROM files f
+		LEFT JOIN last_access la ON la.file_id = f.id
+		LEFT JOIN shared_refs sr ON sr.hash = f.hash
+		WHERE f.uploader_id = $1
+		ORDER BY f.created_at ASC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cleanup candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*models.CleanupCandidate
+	for rows.Next() {
+		file := &models.File{}
+		var lastAccessedAt sql.NullTime
+		var sharedRefs int
+
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.DedupDisabled,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+			&lastAccessedAt,
+			&sharedRefs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan cleanup candidate: %w", err)
+		}
+
+		candidate := &models.CleanupCandidate{File: file, SharedReferences: sharedRefs}
+		if lastAccessedAt.Valid {
+			candidate.LastAccessedAt = &lastAccessedAt.Time
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, rows.Err()
+}
+
+// UpdateMetadata updates the user-facing name, description and download name of a file,
+// recording modifiedBy as the user who last changed it. The stored filename, hash and S3 object
+// are left untouched.
+func (r *FileRepository) UpdateMetadata(id uuid.UUID, originalName string, description, downloadName *string, modifiedBy uuid.UUID) error {
+	query := `
+		UPDATE files
+		SET original_name = $2, description = $3, download_name = $4, last_modified_by = $5, updated_at = NOW()
+		WHERE id = $1
+	`
+	result, err := r.db.Exec(query, id, originalName, description, downloadName, modifiedBy)
+	if err != nil {
+		return fmt.Errorf("failed to update file metadata: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("file not found")
+	}
+
+	return nil
+}
+
+// SetPublic marks a file as publicly downloadable or private again
+func (r *FileRepository) SetPublic(id uuid.UUID, public bool) error {
+	query := `UPDATE files SET is_public = $2, updated_at = NOW() WHERE id = $1`
+	result, err := r.db.Exec(query, id, public)
+	if err != nil {
+		return fmt.Errorf("failed to update file visibility: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("file not found")
+	}
+
+	return nil
+}
+
+// Delete deletes a file by ID. Files recorded as copies of it are repointed at the earliest of
+// them, which becomes the new original.
 func (r *FileRepository) Delete(id uuid.UUID) error {
-	query := `DELETE FROM files WHERE id = $1`
+	query := `
+		WITH successor AS (
+			SELECT id FROM files WHERE original_file_id = $1 ORDER BY created_at, id LIMIT 1
+		), repointed AS (
+			UPDATE files SET original_file_id = NULLIF((SELECT id FROM successor), id)
+			WHERE original_file_id = $1
+		)
+		DELETE FROM files WHERE id = $1
+	`
 	_, err := r.db.Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
@@ -254,7 +1008,7 @@ func (r *FileRepository) Delete(id uuid.UUID) error {
 func (r *FileRepository) GetByUserIDAndFolderID(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error) {
 	fmt.Printf("DEBUG: FileRepository.GetByUserIDAndFolderID called - User: %s, Folder: %s\n", userID, folderID)
 	query := `
-		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.created_at, f.updated_at,
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
 		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
 		FROM files f
 		LEFT JOIN users u ON f.uploader_id = u.id
@@ -285,6 +1039,9 @@ func (r *FileRepository) GetByUserIDAndFolderID(userID uuid.UUID, folderID uuid.
 			&file.S3Key,
 			&file.UploaderID,
 			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
 			&file.CreatedAt,
 			&file.UpdatedAt,
 			&uploader.ID,
@@ -306,6 +1063,70 @@ func (r *FileRepository) GetByUserIDAndFolderID(userID uuid.UUID, folderID uuid.
 	return files, nil
 }
 
+// GetByUserIDAndFolderIDRecursive retrieves files for a user in a folder and all of its subfolders.
+// UNION (rather than UNION ALL) keeps the walk finite even if parent links form a cycle.
+func (r *FileRepository) GetByUserIDAndFolderIDRecursive(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error) {
+	query := `
+		WITH RECURSIVE folder_tree AS (
+			SELECT id FROM folders WHERE id = $2 AND owner_id = $1
+			UNION
+			SELECT fo.id FROM folders fo INNER JOIN folder_tree ft ON fo.parent_id = ft.id
+			WHERE fo.owner_id = $1
+		)
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.original_file_id, f.last_modified_by, f.created_at, f.updated_at,
+		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
+		FROM files f
+		LEFT JOIN users u ON f.uploader_id = u.id
+		WHERE f.uploader_id = $1 AND f.folder_id IN (SELECT id FROM folder_tree)
+		ORDER BY f.created_at DESC, f.id
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := r.db.Query(query, userID, folderID, limit, offset)
+	if err != nil {
+		fmt.Printf("ERROR: FileRepository.GetByUserIDAndFolderIDRecursive failed: %v\n", err)
+		return nil, fmt.Errorf("failed to get files by folder tree: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		uploader := &models.User{}
+
+		err := rows.Scan(
+			&file.ID,
+			&file.Filename,
+			&file.OriginalName,
+			&file.MimeType,
+			&file.Size,
+			&file.Hash,
+			&file.S3Key,
+			&file.UploaderID,
+			&file.FolderID,
+			&file.Description,
+			&file.OriginalFileID,
+			&file.LastModifiedBy,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+			&uploader.ID,
+			&uploader.Email,
+			&uploader.Username,
+			&uploader.Role,
+			&uploader.CreatedAt,
+			&uploader.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file row: %w", err)
+		}
+
+		file.Uploader = uploader
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
 // GetDB returns the database connection
 func (r *FileRepository) GetDB() *sql.DB {
 	return r.db
@@ -1,9 +1,12 @@
 package repositories
 
 import (
+	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Admin-specific methods for FileRepository
@@ -72,3 +75,269 @@ func (r *FileRepository) DeleteByUserID(userID uuid.UUID) error {
 	}
 	return nil
 }
+
+// TransferAllFiles reassigns every file and folder owned by fromUserID to toUserID in one
+// transaction. The transferred root folders and root files are placed in a new root folder of the
+// recipient named folderName (with a numeric suffix if the name is taken), so they can't clash with
+// the recipient's own folder names. User-to-user shares and access grants made by the old owner
+// are re-attributed to the recipient, and shares or grants the recipient held on the transferred
+// items are dropped since they now own them. Public share links follow the files unchanged.
+// Per-user hash records move along as in transferHashRecords. It returns the number of files
+// transferred and the S3 keys of objects no file uses any more, which the caller deletes.
+func (r *FileRepository) TransferAllFiles(fromUserID, toUserID uuid.UUID, folderName string) (int, []string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to start transfer: %w", err)
+	}
+	defer tx.Rollback()
+
+	var hasContent bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM files WHERE uploader_id = $1)
+		    OR EXISTS (SELECT 1 FROM folders WHERE owner_id = $1)
+	`, fromUserID).Scan(&hasContent)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to check files to transfer: %w", err)
+	}
+	if !hasContent {
+		return 0, nil, nil
+	}
+
+	containerID, err := createTransferFolder(tx, toUserID, folderName)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Folders keep their hierarchy; the old owner's root folders move under the new folder
+	_, err = tx.Exec(`
+		UPDATE folders
+		SET owner_id = $2, parent_id = COALESCE(parent_id, $3), updated_at = NOW()
+		WHERE owner_id = $1
+	`, fromUserID, toUserID, containerID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to transfer folders: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		WITH RECURSIVE moved AS (
+			SELECT id FROM folders WHERE parent_id = $1
+			UNION ALL
+			SELECT f.id FROM folders f JOIN moved m ON f.parent_id = m.id
+		)
+		UPDATE folders SET path = get_folder_path(id) WHERE id IN (SELECT id FROM moved)
+	`, containerID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to update transferred folder paths: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		UPDATE files
+		SET uploader_id = $2, folder_id = COALESCE(folder_id, $3), updated_at = NOW()
+		WHERE uploader_id = $1
+		RETURNING id
+	`, fromUserID, toUserID, containerID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to transfer files: %w", err)
+	}
+	var fileIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("failed to scan transferred file: %w", err)
+		}
+		fileIDs = append(fileIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to transfer files: %w", err)
+	}
+
+	unusedKeys, err := transferHashRecords(tx, fromUserID, toUserID, fileIDs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	statements := []string{
+		`DELETE FROM user_file_shares WHERE from_user_id = $1 AND to_user_id = $2`,
+		`UPDATE user_file_shares SET from_user_id = $2 WHERE from_user_id = $1`,
+		`DELETE FROM user_folder_shares WHERE from_user_id = $1 AND to_user_id = $2`,
+		`UPDATE user_folder_shares SET from_user_id = $2 WHERE from_user_id = $1`,
+		`DELETE FROM file_access_grants WHERE granted_by = $1 AND grantee_id = $2`,
+		`UPDATE file_access_grants SET granted_by = $2 WHERE granted_by = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, fromUserID, toUserID); err != nil {
+			return 0, nil, fmt.Errorf("failed to transfer shares: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit transfer: %w", err)
+	}
+
+	return len(fileIDs), unusedKeys, nil
+}
+
+// TransferFile reassigns a single file to toUserID and moves it to the recipient's root, since its
+// folder stays with the old owner. Shares and grants on the file are re-attributed the same way
+// as in TransferAllFiles, and so is the file's hash record unless the old owner still has another
+// file using the object. It returns the S3 keys of objects no file uses any more.
+func (r *FileRepository) TransferFile(fileID, toUserID uuid.UUID) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transfer: %w", err)
+	}
+	defer tx.Rollback()
+
+	var fromUserID uuid.UUID
+	err = tx.QueryRow(`
+		UPDATE files f
+		SET uploader_id = $2, folder_id = NULL, updated_at = NOW()
+		FROM files old
+		WHERE f.id = $1 AND old.id = f.id
+		RETURNING old.uploader_id
+	`, fileID, toUserID).Scan(&fromUserID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer file: %w", err)
+	}
+
+	unusedKeys, err := transferHashRecords(tx, fromUserID, toUserID, []uuid.UUID{fileID})
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		`DELETE FROM user_file_shares WHERE file_id = $1 AND to_user_id = $2`,
+		`UPDATE user_file_shares SET from_user_id = $2 WHERE file_id = $1`,
+		`DELETE FROM file_access_grants WHERE file_id = $1 AND grantee_id = $2`,
+		`UPDATE file_access_grants SET granted_by = $2 WHERE file_id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, fileID, toUserID); err != nil {
+			return nil, fmt.Errorf("failed to transfer file shares: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transfer: %w", err)
+	}
+
+	return unusedKeys, nil
+}
+
+// transferHashRecords hands the recipient the per-user hash records (see the per-user
+// deduplication scope) of the objects the transferred files use, so deleting those files later
+// finds the record and removes the object, and deleting the old owner doesn't cascade it away.
+// A record stays with the old owner while another of their files still uses the object. Where
+// the recipient already has a record for the same content, the transferred files are pointed at
+// the recipient's copy instead, and records of old copies no file uses any more are deleted; their
+// S3 keys are returned so the objects can be removed once the transaction commits.
+func transferHashRecords(tx *sql.Tx, fromUserID, toUserID uuid.UUID, fileIDs []uuid.UUID) ([]string, error) {
+	rows, err := tx.Query(`
+		UPDATE files f
+		SET s3_key = mine.s3_key
+		FROM file_hashes old, file_hashes mine
+		WHERE f.id = ANY($3) AND old.owner_id = $1 AND old.s3_key = f.s3_key
+		  AND mine.owner_id = $2 AND mine.hash = old.hash
+		RETURNING old.id
+	`, fromUserID, toUserID, pq.Array(fileIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to point transferred files at the recipient's content: %w", err)
+	}
+	var replaced []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan replaced hash record: %w", err)
+		}
+		replaced = append(replaced, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to point transferred files at the recipient's content: %w", err)
+	}
+
+	rows, err = tx.Query(`
+		DELETE FROM file_hashes h
+		WHERE h.id = ANY($1)
+		  AND NOT EXISTS (SELECT 1 FROM files f WHERE f.s3_key = h.s3_key)
+		RETURNING h.s3_key
+	`, pq.Array(replaced))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete unused hash records: %w", err)
+	}
+	var unusedKeys []string
+	for rows.Next() {
+		var key sql.NullString
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan unused hash record: %w", err)
+		}
+		if key.String != "" {
+			unusedKeys = append(unusedKeys, key.String)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete unused hash records: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE file_hashes h
+		SET owner_id = $2
+		WHERE h.owner_id = $1
+		  AND h.s3_key IN (SELECT s3_key FROM files WHERE id = ANY($3))
+		  AND NOT EXISTS (SELECT 1 FROM files f WHERE f.uploader_id = $1 AND f.s3_key = h.s3_key)
+	`, fromUserID, toUserID, pq.Array(fileIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer hash records: %w", err)
+	}
+
+	return unusedKeys, nil
+}
+
+// createTransferFolder creates a root folder for transferred items, picking the first free name
+// among folderName, "folderName (2)", "folderName (3)", ...
+func createTransferFolder(tx *sql.Tx, ownerID uuid.UUID, folderName string) (uuid.UUID, error) {
+	rows, err := tx.Query(`
+		SELECT lower(name) FROM folders WHERE owner_id = $1 AND parent_id IS NULL
+	`, ownerID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to list root folders: %w", err)
+	}
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return uuid.Nil, fmt.Errorf("failed to scan root folder: %w", err)
+		}
+		taken[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to list root folders: %w", err)
+	}
+
+	name := folderName
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s (%d)", folderName, n)
+	}
+
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO folders (name, path, parent_id, owner_id)
+		VALUES ($1, $1, NULL, $2)
+		RETURNING id
+	`, name, ownerID).Scan(&id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create transfer folder: %w", err)
+	}
+
+	return id, nil
+}
@@ -3,10 +3,13 @@ package repositories
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"filevault/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // FileShareRepository handles file share database operations
@@ -24,8 +27,8 @@ func (r *FileShareRepository) Create(share *models.FileShare) error {
 	fmt.Printf("DEBUG: FileShareRepository.Create called with share: %+v\n", share)
 
 	query := `
-		INSERT INTO file_shares (id, file_id, share_token, is_active, expires_at, max_downloads)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO file_shares (id, file_id, share_token, is_active, expires_at, max_downloads, max_bandwidth_bps, force_download, allowed_email_domains, burn_after_download)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING share_token, created_at, updated_at, download_count
 	`
 
@@ -40,6 +43,10 @@ func (r *FileShareRepository) Create(share *models.FileShare) error {
 		share.IsActive,
 		share.ExpiresAt,
 		share.MaxDownloads,
+		share.MaxBandwidthBps,
+		share.ForceDownload,
+		pq.Array(share.AllowedEmailDomains),
+		share.BurnAfterDownload,
 	).Scan(&share.ShareToken, &share.CreatedAt, &share.UpdatedAt, &share.DownloadCount)
 
 	if err != nil {
@@ -56,7 +63,7 @@ func (r *FileShareRepository) Create(share *models.FileShare) error {
 func (r *FileShareRepository) GetByToken(token string) (*models.FileShare, error) {
 	query := `
 		SELECT fs.id, fs.file_id, fs.share_token, fs.is_active, fs.expires_at, 
-		       fs.download_count, fs.max_downloads, fs.created_at, fs.updated_at
+		       fs.download_count, fs.max_downloads, fs.max_bandwidth_bps, fs.force_download, fs.allowed_email_domains, fs.burn_after_download, fs.created_at, fs.updated_at
 		FROM file_shares fs
 		WHERE fs.share_token = $1
 	`
@@ -70,6 +77,10 @@ func (r *FileShareRepository) GetByToken(token string) (*models.FileShare, error
 		&share.ExpiresAt,
 		&share.DownloadCount,
 		&share.MaxDownloads,
+		&share.MaxBandwidthBps,
+		&share.ForceDownload,
+		pq.Array(&share.AllowedEmailDomains),
+		&share.BurnAfterDownload,
 		&share.CreatedAt,
 		&share.UpdatedAt,
 	)
@@ -88,7 +99,7 @@ func (r *FileShareRepository) GetByToken(token string) (*models.FileShare, error
 func (r *FileShareRepository) GetByID(id uuid.UUID) (*models.FileShare, error) {
 	query := `
 		SELECT id, file_id, share_token, is_active, expires_at, 
-		       download_count, max_downloads, created_at, updated_at
+		       download_count, max_downloads, max_bandwidth_bps, force_download, allowed_email_domains, burn_after_download, created_at, updated_at
 		FROM file_shares
 		WHERE id = $1
 	`
@@ -102,6 +113,10 @@ func (r *FileShareRepository) GetByID(id uuid.UUID) (*models.FileShare, error) {
 		&share.ExpiresAt,
 		&share.DownloadCount,
 		&share.MaxDownloads,
+		&share.MaxBandwidthBps,
+		&share.ForceDownload,
+		pq.Array(&share.AllowedEmailDomains),
+		&share.BurnAfterDownload,
 		&share.CreatedAt,
 		&share.UpdatedAt,
 	)
@@ -120,8 +135,8 @@ func (r *FileShareRepository) GetByID(id uuid.UUID) (*models.FileShare, error) {
 func (r *FileShareRepository) GetByTokenWithFile(token string) (*models.FileShare, error) {
 	query := `
 		SELECT fs.id, fs.file_id, fs.share_token, fs.is_active, fs.expires_at, 
-		       fs.download_count, fs.max_downloads, fs.created_at, fs.updated_at,
-		       f.id, f.original_name, f.filename, f.size, f.mime_type, 
+		       fs.download_count, fs.max_downloads, fs.max_bandwidth_bps, fs.force_download, fs.allowed_email_domains, fs.burn_after_download, fs.created_at, fs.updated_at,
+		       f.id, f.original_name, f.download_name, f.filename, f.size, f.mime_type, 
 		       f.hash, f.s3_key, f.uploader_id, f.created_at, f.updated_at
 		FROM file_shares fs
 		JOIN files f ON fs.file_id = f.id
@@ -140,10 +155,15 @@ func (r *FileShareRepository) GetByTokenWithFile(token string) (*models.FileShar
 		&share.ExpiresAt,
 		&share.DownloadCount,
 		&share.MaxDownloads,
+		&share.MaxBandwidthBps,
+		&share.ForceDownload,
+		pq.Array(&share.AllowedEmailDomains),
+		&share.BurnAfterDownload,
 		&share.CreatedAt,
 		&share.UpdatedAt,
 		&file.ID,
 		&file.OriginalName,
+		&file.DownloadName,
 		&file.Filename,
 		&file.Size,
 		&file.MimeType,
@@ -177,7 +197,7 @@ func (r *FileShareRepository) GetByTokenWithFile(token string) (*models.FileShar
 func (r *FileShareRepository) GetByFileID(fileID uuid.UUID) ([]*models.FileShare, error) {
 	query := `
 		SELECT id, file_id, share_token, is_active, expires_at, 
-		       download_count, max_downloads, created_at, updated_at
+		       download_count, max_downloads, max_bandwidth_bps, force_download, allowed_email_domains, burn_after_download, created_at, updated_at
 		FROM file_shares
 		WHERE file_id = $1
 		ORDER BY created_at DESC
@@ -200,6 +220,10 @@ func (r *FileShareRepository) GetByFileID(fileID uuid.UUID) ([]*models.FileShare
 			&share.ExpiresAt,
 			&share.DownloadCount,
 			&share.MaxDownloads,
+			&share.MaxBandwidthBps,
+			&share.ForceDownload,
+			pq.Array(&share.AllowedEmailDomains),
+			&share.BurnAfterDownload,
 			&share.CreatedAt,
 			&share.UpdatedAt,
 		)
@@ -229,20 +253,185 @@ func (r *FileShareRepository) Update(share *models.FileShare) error {
 	return nil
 }
 
-// IncrementDownloadCount increments the download count for a file share
-func (r *FileShareRepository) IncrementDownloadCount(shareID uuid.UUID) error {
+// Deactivate turns a share off regardless of who owns it
+func (r *FileShareRepository) Deactivate(id uuid.UUID) error {
+	result, err := r.db.Exec(`UPDATE file_shares SET is_active = FALSE, updated_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate file share: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to deactivate file share: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("file share not found")
+	}
+
+	return nil
+}
+
+// GetByOwner lists the shares of a user's files, newest first, with their files and the total
+// number of matching shares. With activeOnly, only shares that can still be downloaded are
+// included: active, unexpired and below their download limit, mirroring CanBeDownloaded.
+func (r *FileShareRepository) GetByOwner(ownerID uuid.UUID, activeOnly bool, limit, offset int) ([]*models.FileShare, int, error) {
+	where := "WHERE f.uploader_id = $1"
+	if activeOnly {
+		where += `
+		  AND fs.is_active = true
+		  AND (fs.expires_at IS NULL OR fs.expires_at > NOW())
+		  AND (fs.max_downloads IS NULL OR fs.download_count < fs.max_downloads)`
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM file_shares fs JOIN files f ON fs.file_id = f.id ` + where
+	if err := r.db.QueryRow(countQuery, ownerID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count file shares: %w", err)
+	}
+
+	query := `
+		SELECT fs.id, fs.file_id, fs.share_token, fs.is_active, fs.expires_at,
+		       fs.download_count, fs.max_downloads, fs.max_bandwidth_bps, fs.force_download, fs.allowed_email_domains, fs.burn_after_download, fs.created_at, fs.updated_at,
+		       f.id, f.original_name, f.filename, f.size, f.mime_type,
+		       f.hash, f.s3_key, f.uploader_id, f.created_at, f.updated_at
+		FROM file_shares fs
+		JOIN files f ON fs.file_id = f.id
+		` + where + `
+		ORDER BY fs.created_at DESC, fs.id
+		LIMIT $2 OFFSET $3
+	`
+
+	shares, err := r.querySharesWithFile(query, ownerID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return shares, total, nil
+}
+
+// GetAllForAdmin lists shares across all users, newest first, with their file and owner
+func (r *FileShareRepository) GetAllForAdmin(filter models.AdminShareFilter, limit, offset int) ([]*models.AdminFileShare, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.OwnerID != nil {
+		args = append(args, *filter.OwnerID)
+		conditions = append(conditions, fmt.Sprintf("f.uploader_id = $%d", len(args)))
+	}
+	if filter.IsActive != nil {
+		args = append(args, *filter.IsActive)
+		conditions = append(conditions, fmt.Sprintf("fs.is_active = $%d", len(args)))
+	}
+	if filter.FileName != "" {
+		args = append(args, "%"+filter.FileName+"%")
+		conditions = append(conditions, fmt.Sprintf("f.original_name ILIKE $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(`
+		SELECT fs.id, fs.file_id, fs.share_token, fs.is_active, fs.expires_at,
+		       fs.download_count, fs.max_downloads, fs.max_bandwidth_bps, fs.force_download, fs.allowed_email_domains, fs.burn_after_download, fs.created_at, fs.updated_at,
+		       f.original_name, u.id, u.username, u.email
+		FROM file_shares fs
+		JOIN files f ON f.id = fs.file_id
+		JOIN users u ON u.id = f.uploader_id
+		%s
+		ORDER BY fs.created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []*models.AdminFileShare{}
+	for rows.Next() {
+		share := &models.AdminFileShare{}
+		err := rows.Scan(
+			&share.ID,
+			&share.FileID,
+			&share.ShareToken,
+			&share.IsActive,
+			&share.ExpiresAt,
+			&share.DownloadCount,
+			&share.MaxDownloads,
+			&share.MaxBandwidthBps,
+			&share.ForceDownload,
+			pq.Array(&share.AllowedEmailDomains),
+			&share.BurnAfterDownload,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+			&share.FileName,
+			&share.OwnerID,
+			&share.OwnerUsername,
+			&share.OwnerEmail,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// RegenerateToken gives a share a new random token, so links with the old token stop resolving.
+// Everything else about the share, including its download count and logs, is kept.
+func (r *FileShareRepository) RegenerateToken(id uuid.UUID) (string, error) {
 	query := `
 		UPDATE file_shares
-		SET download_count = download_count + 1, updated_at = NOW()
+		SET share_token = generate_share_token(), updated_at = NOW()
 		WHERE id = $1
+		RETURNING share_token
 	`
 
-	_, err := r.db.Exec(query, shareID)
+	var token string
+	err := r.db.QueryRow(query, id).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("file share not found")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to increment download count: %w", err)
+		return "", fmt.Errorf("failed to regenerate share token: %w", err)
 	}
 
-	return nil
+	return token, nil
+}
+
+// IncrementDownloadCount counts a download against a file share, but only while the share is
+// active, unexpired and under its download limit. The check and the increment happen in one
+// statement so concurrent downloads can't both take the last allowed download. It returns the
+// new count, and ok is false when the share could no longer be downloaded. A burn-after-download
+// share is deactivated and its token replaced in the same statement, so its link dies with the
+// first download.
+func (r *FileShareRepository) IncrementDownloadCount(shareID uuid.UUID) (int, bool, error) {
+	query := `
+		UPDATE file_shares
+		SET download_count = download_count + 1, updated_at = NOW(),
+		    is_active = is_active AND NOT burn_after_download,
+		    share_token = CASE WHEN burn_after_download THEN 'burned-' || gen_random_uuid() ELSE share_token END
+		WHERE id = $1
+		  AND is_active = true
+		  AND (expires_at IS NULL OR expires_at > NOW())
+		  AND (max_downloads IS NULL OR download_count < max_downloads)
+		RETURNING download_count
+	`
+
+	var count int
+	err := r.db.QueryRow(query, shareID).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to increment download count: %w", err)
+	}
+
+	return count, true, nil
 }
 
 // Delete deletes a file share
@@ -267,14 +456,186 @@ func (r *FileShareRepository) DeleteByFileID(fileID uuid.UUID) error {
 	return nil
 }
 
+// GetSharesExpiringBefore retrieves active shares with their files that expire between now and the given time
+// and whose owner has not yet been warned about the upcoming expiry
+func (r *FileShareRepository) GetSharesExpiringBefore(before time.Time) ([]*models.FileShare, error) {
+	query := `
+		SELECT fs.id, fs.file_id, fs.share_token, fs.is_active, fs.expires_at,
+		       fs.download_count, fs.max_downloads, fs.max_bandwidth_bps, fs.force_download, fs.allowed_email_domains, fs.burn_after_download, fs.created_at, fs.updated_at,
+		       f.id, f.original_name, f.filename, f.size, f.mime_type,
+		       f.hash, f.s3_key, f.uploader_id, f.created_at, f.updated_at
+		FROM file_shares fs
+		JOIN files f ON fs.file_id = f.id
+		WHERE fs.is_active = true
+		  AND fs.expiry_notified_at IS NULL
+		  AND fs.expires_at IS NOT NULL
+		  AND fs.expires_at > NOW()
+		  AND fs.expires_at <= $1
+		ORDER BY fs.expires_at ASC
+	`
+
+	return r.querySharesWithFile(query, before)
+}
+
+// GetUnavailableUnnotifiedShares retrieves active shares with their files that have expired or reached
+// their download limit and whose owner has not yet been told the link stopped working
+func (r *FileShareRepository) GetUnavailableUnnotifiedShares() ([]*models.FileShare, error) {
+	query := `
+		SELECT fs.id, fs.file_id, fs.share_token, fs.is_active, fs.expires_at,
+		       fs.download_count, fs.max_downloads, fs.max_bandwidth_bps, fs.force_download, fs.allowed_email_domains, fs.burn_after_download, fs.created_at, fs.updated_at,
+		       f.id, f.original_name, f.filename, f.size, f.mime_type,
+		       f.hash, f.s3_key, f.uploader_id, f.created_at, f.updated_at
+		FROM file_shares fs
+		JOIN files f ON fs.file_id = f.id
+		WHERE fs.is_active = true
+		  AND fs.unavailable_notified_at IS NULL
+		  AND ((fs.expires_at IS NOT NULL AND fs.expires_at <= NOW())
+		       OR (fs.max_downloads IS NOT NULL AND fs.download_count >= fs.max_downloads))
+		ORDER BY fs.updated_at ASC
+	`
+
+	return r.querySharesWithFile(query)
+}
+
+// CountActiveSharesByFileIDs counts the downloadable shares of each file in a single grouped query.
+// A share counts when it is active, unexpired and below its download limit, mirroring CanBeDownloaded.
+// Files without any such share are absent from the result.
+func (r *FileShareRepository) CountActiveSharesByFileIDs(fileIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int)
+	if len(fileIDs) == 0 {
+		return counts, nil
+	}
+
+	ids := make([]string, len(fileIDs))
+	for i, id := range fileIDs {
+		ids[i] = id.String()
+	}
+
+	query := `
+		SELECT file_id, COUNT(*)
+		FROM file_shares
+		WHERE file_id = ANY($1::uuid[])
+		  AND is_active = true
+		  AND (expires_at IS NULL OR expires_at > NOW())
+		  AND (max_downloads IS NULL OR download_count < max_downloads)
+		GROUP BY file_id
+	`
+
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active shares: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fileID uuid.UUID
+		var count int
+		if err := rows.Scan(&fileID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan share count: %w", err)
+		}
+		counts[fileID] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count active shares: %w", err)
+	}
+
+	return counts, nil
+}
+
+// MarkExpiryNotified records that the owner was warned about an upcoming expiry.
+// It returns false if the share had already been marked, so callers can skip duplicate notifications.
+func (r *FileShareRepository) MarkExpiryNotified(id uuid.UUID) (bool, error) {
+	query := `UPDATE file_shares SET expiry_notified_at = NOW() WHERE id = $1 AND expiry_notified_at IS NULL`
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark share expiry notified: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark share expiry notified: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// MarkUnavailableNotified records that the owner was told the share became unavailable.
+// It returns false if the share had already been marked, so callers can skip duplicate notifications.
+func (r *FileShareRepository) MarkUnavailableNotified(id uuid.UUID) (bool, error) {
+	query := `UPDATE file_shares SET unavailable_notified_at = NOW() WHERE id = $1 AND unavailable_notified_at IS NULL`
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark share unavailable notified: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark share unavailable notified: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// querySharesWithFile runs a query selecting share columns followed by file columns
+func (r *FileShareRepository) querySharesWithFile(query string, args ...interface{}) ([]*models.FileShare, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file shares: %w", err)
+	}
+	defer rows.Close()
+
+	var shares []*models.FileShare
+	for rows.Next() {
+		share := &models.FileShare{}
+		file := &models.File{}
+		var s3Key sql.NullString
+		err := rows.Scan(
+			&share.ID,
+			&share.FileID,
+			&share.ShareToken,
+			&share.IsActive,
+			&share.ExpiresAt,
+			&share.DownloadCount,
+			&share.MaxDownloads,
+			&share.MaxBandwidthBps,
+			&share.ForceDownload,
+			pq.Array(&share.AllowedEmailDomains),
+			&share.BurnAfterDownload,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+			&file.ID,
+			&file.OriginalName,
+			&file.Filename,
+			&file.Size,
+			&file.MimeType,
+			&file.Hash,
+			&s3Key,
+			&file.UploaderID,
+			&file.CreatedAt,
+			&file.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file share: %w", err)
+		}
+		if s3Key.Valid {
+			file.S3Key = s3Key.String
+		}
+		share.File = file
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
 // LogDownload logs a download event
 func (r *FileShareRepository) LogDownload(log *models.DownloadLog) error {
 	query := `
-		INSERT INTO download_logs (id, share_id, ip_address, user_agent)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO download_logs (id, share_id, ip_address, user_agent, email)
+		VALUES ($1, $2, $3, $4, $5)
 	`
 
-	_, err := r.db.Exec(query, log.ID, log.ShareID, log.IPAddress, log.UserAgent)
+	_, err := r.db.Exec(query, log.ID, log.ShareID, log.IPAddress, log.UserAgent, log.Email)
 	if err != nil {
 		return fmt.Errorf("failed to log download: %w", err)
 	}
@@ -282,9 +643,31 @@ func (r *FileShareRepository) LogDownload(log *models.DownloadLog) error {
 	return nil
 }
 
-// GetDownloadStats retrieves download statistics for a file share
+// HasDownloadFrom reports whether a download of the share from this IP address and user agent
+// has been logged since the given time
+func (r *FileShareRepository) HasDownloadFrom(shareID uuid.UUID, ipAddress, userAgent string, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM download_logs
+			WHERE share_id = $1 AND host(ip_address) = $2 AND user_agent = $3 AND downloaded_at >= $4
+		)
+	`
+	var exists bool
+	err := r.db.QueryRow(query, shareID, ipAddress, userAgent, since).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check share downloads: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetDownloadStats retrieves download statistics for a file share, counting both logged
+// downloads and those already rolled up into daily totals
 func (r *FileShareRepository) GetDownloadStats(shareID uuid.UUID) (int, error) {
-	query := `SELECT COUNT(*) FROM download_logs WHERE share_id = $1`
+	query := `
+		SELECT (SELECT COUNT(*) FROM download_logs WHERE share_id = $1)
+		     + (SELECT COALESCE(SUM(download_count), 0) FROM download_log_daily WHERE share_id = $1)
+	`
 	var count int
 	err := r.db.QueryRow(query, shareID).Scan(&count)
 	if err != nil {
@@ -293,10 +676,47 @@ func (r *FileShareRepository) GetDownloadStats(shareID uuid.UUID) (int, error) {
 	return count, nil
 }
 
+// RollUpDownloadLogs adds download_logs rows older than before to the per-share daily totals
+// and deletes them, in one transaction. It returns the number of rows removed.
+func (r *FileShareRepository) RollUpDownloadLogs(before time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start download log roll-up: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO download_log_daily (share_id, day, download_count)
+		SELECT share_id, downloaded_at::date, COUNT(*)
+		FROM download_logs
+		WHERE downloaded_at < $1
+		GROUP BY share_id, downloaded_at::date
+		ON CONFLICT (share_id, day)
+		DO UPDATE SET download_count = download_log_daily.download_count + EXCLUDED.download_count
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to summarize download logs: %w", err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM download_logs WHERE downloaded_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete download logs: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted download logs: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit download log roll-up: %w", err)
+	}
+	return removed, nil
+}
+
 // GetRecentDownloads retrieves recent download logs for a file share
 func (r *FileShareRepository) GetRecentDownloads(shareID uuid.UUID, limit int) ([]*models.DownloadLog, error) {
 	query := `
-		SELECT id, share_id, ip_address, user_agent, downloaded_at
+		SELECT id, share_id, ip_address, user_agent, email, downloaded_at
 		FROM download_logs
 		WHERE share_id = $1
 		ORDER BY downloaded_at DESC
@@ -317,6 +737,7 @@ func (r *FileShareRepository) GetRecentDownloads(shareID uuid.UUID, limit int) (
 			&log.ShareID,
 			&log.IPAddress,
 			&log.UserAgent,
+			&log.Email,
 			&log.DownloadedAt,
 		)
 		if err != nil {
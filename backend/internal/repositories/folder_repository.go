@@ -2,19 +2,34 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"filevault/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// ErrDuplicateFolderName is returned when a folder with the same name already exists in the parent
+var ErrDuplicateFolderName = errors.New("a folder with that name already exists here")
+
+// isDuplicateFolderNameError reports whether err violates one of the folder name unique indexes
+func isDuplicateFolderNameError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint == "idx_folders_unique_name_in_parent" || pqErr.Constraint == "idx_folders_unique_name_at_root"
+	}
+	return false
+}
+
 // FolderRepositoryInterface defines the interface for folder operations
 type FolderRepositoryInterface interface {
 	Create(folder *models.Folder) error
 	GetByID(id uuid.UUID) (*models.Folder, error)
 	GetByOwnerID(ownerID uuid.UUID) ([]*models.Folder, error)
 	GetByParentID(parentID uuid.UUID) ([]*models.Folder, error)
+	GetAncestors(folderID uuid.UUID, maxDepth int) ([]*models.Folder, error)
 	Update(folder *models.Folder) error
 	Delete(id uuid.UUID) error
 	GetDB() *sql.DB
@@ -37,32 +52,47 @@ func (r *FolderRepository) GetDB() *sql.DB {
 	return r.db
 }
 
+// Execer runs statements against the database or within a transaction (*sql.DB and *sql.Tx)
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // Create creates a new folder
 func (r *FolderRepository) Create(folder *models.Folder) error {
+	return r.CreateWith(r.db, folder)
+}
+
+// CreateWith creates a new folder through exec, such as a transaction the folder belongs to
+func (r *FolderRepository) CreateWith(exec Execer, folder *models.Folder) error {
 	fmt.Printf("DEBUG: FolderRepository.Create called with folder: %+v\n", folder)
 
 	query := `
-		INSERT INTO folders (id, name, path, parent_id, owner_id, file_count, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO folders (id, name, path, parent_id, owner_id, file_count, color, icon, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	fmt.Printf("DEBUG: Executing query: %s\n", query)
 	fmt.Printf("DEBUG: Parameters: id=%s, name=%s, path=%s, parent_id=%v, owner_id=%s, file_count=%d\n",
 		folder.ID, folder.Name, folder.Path, folder.ParentID, folder.OwnerID, folder.FileCount)
 
-	_, err := r.db.Exec(query,
+	_, err := exec.Exec(query,
 		folder.ID,
 		folder.Name,
 		folder.Path,
 		folder.ParentID,
 		folder.OwnerID,
 		folder.FileCount,
+		folder.Color,
+		folder.Icon,
 		folder.CreatedAt,
 		folder.UpdatedAt,
 	)
 
 	if err != nil {
 		fmt.Printf("ERROR: Failed to create folder: %v\n", err)
+		if isDuplicateFolderNameError(err) {
+			return ErrDuplicateFolderName
+		}
 		return fmt.Errorf("failed to create folder: %w", err)
 	}
 
@@ -75,7 +105,7 @@ func (r *FolderRepository) GetByID(id uuid.UUID) (*models.Folder, error) {
 	fmt.Printf("DEBUG: FolderRepository.GetByID called with id: %s\n", id)
 
 	query := `
-		SELECT id, name, path, parent_id, owner_id, file_count, created_at, updated_at
+		SELECT id, name, path, parent_id, owner_id, file_count, color, icon, created_at, updated_at
 		FROM folders
 		WHERE id = $1
 	`
@@ -95,6 +125,8 @@ func (r *FolderRepository) GetByID(id uuid.UUID) (*models.Folder, error) {
 		&parentID,
 		&folder.OwnerID,
 		&folder.FileCount,
+		&folder.Color,
+		&folder.Icon,
 		&folder.CreatedAt,
 		&folder.UpdatedAt,
 	)
@@ -134,7 +166,7 @@ func (r *FolderRepository) GetByOwnerID(ownerID uuid.UUID) ([]*models.Folder, er
 	fmt.Printf("DEBUG: FolderRepository.GetByOwnerID called with ownerID: %s\n", ownerID)
 
 	query := `
-		SELECT id, name, path, parent_id, owner_id, file_count, created_at, updated_at
+		SELECT id, name, path, parent_id, owner_id, file_count, color, icon, created_at, updated_at
 		FROM folders
 		WHERE owner_id = $1
 		ORDER BY name ASC
@@ -162,6 +194,8 @@ func (r *FolderRepository) GetByOwnerID(ownerID uuid.UUID) ([]*models.Folder, er
 			&parentID,
 			&folder.OwnerID,
 			&folder.FileCount,
+			&folder.Color,
+			&folder.Icon,
 			&folder.CreatedAt,
 			&folder.UpdatedAt,
 		)
@@ -195,12 +229,93 @@ func (r *FolderRepository) GetByOwnerID(ownerID uuid.UUID) ([]*models.Folder, er
 	return folders, nil
 }
 
+// GetAncestors returns the chain of folders from the root down to and including folderID.
+// The walk follows parent_id within the same owner and stops after maxDepth levels or when a
+// folder repeats, so corrupted parent links cannot loop forever.
+func (r *FolderRepository) GetAncestors(folderID uuid.UUID, maxDepth int) ([]*models.Folder, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, name, path, parent_id, owner_id, file_count, color, icon, created_at, updated_at,
+			       0 AS depth, ARRAY[id] AS visited
+			FROM folders
+			WHERE id = $1
+
+			UNION ALL
+
+			SELECT f.id, f.name, f.path, f.parent_id, f.owner_id, f.file_count, f.color, f.icon, f.created_at, f.updated_at,
+			       a.depth + 1, a.visited || f.id
+			FROM folders f
+			JOIN ancestors a ON f.id = a.parent_id
+			WHERE a.depth < $2
+			  AND f.owner_id = a.owner_id
+			  AND NOT f.id = ANY(a.visited)
+		)
+		SELECT id, name, path, parent_id, owner_id, file_count, color, icon, created_at, updated_at
+		FROM ancestors
+		ORDER BY depth DESC
+	`
+
+	rows, err := r.db.Query(query, folderID, maxDepth)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to query folder ancestors: %v\n", err)
+		return nil, fmt.Errorf("failed to get folder ancestors: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []*models.Folder
+	for rows.Next() {
+		folder := &models.Folder{}
+		var parentID sql.NullString
+		var path sql.NullString
+
+		err := rows.Scan(
+			&folder.ID,
+			&folder.Name,
+			&path,
+			&parentID,
+			&folder.OwnerID,
+			&folder.FileCount,
+			&folder.Color,
+			&folder.Icon,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+		)
+
+		if err != nil {
+			fmt.Printf("ERROR: Failed to scan folder: %v\n", err)
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+
+		// Handle nullable parent_id
+		if parentID.Valid {
+			parentUUID, err := uuid.Parse(parentID.String)
+			if err != nil {
+				fmt.Printf("WARNING: Invalid parent_id UUID: %s\n", parentID.String)
+			} else {
+				folder.ParentID = &parentUUID
+			}
+		}
+
+		// Handle nullable path
+		if path.Valid {
+			folder.Path = path.String
+		} else {
+			folder.Path = folder.Name // Use name as path if path is NULL
+		}
+
+		folders = append(folders, folder)
+	}
+
+	fmt.Printf("SUCCESS: Retrieved %d ancestors for folder %s\n", len(folders), folderID)
+	return folders, nil
+}
+
 // GetByParentID retrieves all subfolders for a specific parent
 func (r *FolderRepository) GetByParentID(parentID uuid.UUID) ([]*models.Folder, error) {
 	fmt.Printf("DEBUG: FolderRepository.GetByParentID called with parentID: %s\n", parentID)
 
 	query := `
-		SELECT id, name, path, parent_id, owner_id, file_count, created_at, updated_at
+		SELECT id, name, path, parent_id, owner_id, file_count, color, icon, created_at, updated_at
 		FROM folders
 		WHERE parent_id = $1
 		ORDER BY name ASC
@@ -228,6 +343,8 @@ func (r *FolderRepository) GetByParentID(parentID uuid.UUID) ([]*models.Folder,
 			&parentID,
 			&folder.OwnerID,
 			&folder.FileCount,
+			&folder.Color,
+			&folder.Icon,
 			&folder.CreatedAt,
 			&folder.UpdatedAt,
 		)
@@ -267,7 +384,7 @@ func (r *FolderRepository) Update(folder *models.Folder) error {
 
 	query := `
 		UPDATE folders 
-		SET name = $2, path = $3, parent_id = $4, file_count = $5, updated_at = $6
+		SET name = $2, path = $3, parent_id = $4, file_count = $5, color = $6, icon = $7, updated_at = $8
 		WHERE id = $1
 	`
 
@@ -279,11 +396,16 @@ func (r *FolderRepository) Update(folder *models.Folder) error {
 		folder.Path,
 		folder.ParentID,
 		folder.FileCount,
+		folder.Color,
+		folder.Icon,
 		folder.UpdatedAt,
 	)
 
 	if err != nil {
 		fmt.Printf("ERROR: Failed to update folder: %v\n", err)
+		if isDuplicateFolderNameError(err) {
+			return ErrDuplicateFolderName
+		}
 		return fmt.Errorf("failed to update folder: %w", err)
 	}
 
@@ -322,3 +444,70 @@ func (r *FolderRepository) Delete(id uuid.UUID) error {
 	fmt.Printf("SUCCESS: Folder deleted successfully\n")
 	return nil
 }
+
+// GetSize returns the bytes stored by an owner's files directly in a folder, or in it and all of
+// its subfolders when recursive. Files sharing one S3 object (deduplicated uploads) count once.
+func (r *FolderRepository) GetSize(folderID, ownerID uuid.UUID, recursive bool) (int64, error) {
+	query := `
+		WITH RECURSIVE folder_tree AS (
+			SELECT id FROM folders WHERE id = $1 AND owner_id = $2
+			UNION
+			SELECT fo.id FROM folders fo INNER JOIN folder_tree ft ON fo.parent_id = ft.id
+			WHERE fo.owner_id = $2 AND $3
+		),
+		objects AS (
+			SELECT MAX(f.size) AS size
+			FROM files f
+			WHERE f.uploader_id = $2 AND f.folder_id IN (SELECT id FROM folder_tree)
+			GROUP BY COALESCE(NULLIF(f.s3_key, ''), f.id::text)
+		)
+		SELECT COALESCE(SUM(size), 0) FROM objects
+	`
+
+	var size int64
+	if err := r.db.QueryRow(query, folderID, ownerID, recursive).Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to get folder size: %w", err)
+	}
+	return size, nil
+}
+
+// GetSizes returns the recursive size of each of an owner's folders, as GetSize computes it, in
+// one query. Folders holding no files are left out of the map.
+func (r *FolderRepository) GetSizes(ownerID uuid.UUID) (map[uuid.UUID]int64, error) {
+	query := `
+		WITH RECURSIVE folder_tree AS (
+			SELECT id AS root_id, id FROM folders WHERE owner_id = $1
+			UNION
+			SELECT ft.root_id, fo.id FROM folders fo INNER JOIN folder_tree ft ON fo.parent_id = ft.id
+			WHERE fo.owner_id = $1
+		),
+		objects AS (
+			SELECT ft.root_id, MAX(f.size) AS size
+			FROM folder_tree ft
+			INNER JOIN files f ON f.folder_id = ft.id AND f.uploader_id = $1
+			GROUP BY ft.root_id, COALESCE(NULLIF(f.s3_key, ''), f.id::text)
+		)
+		SELECT root_id, SUM(size) FROM objects GROUP BY root_id
+	`
+
+	rows, err := r.db.Query(query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder sizes: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[uuid.UUID]int64)
+	for rows.Next() {
+		var folderID uuid.UUID
+		var size int64
+		if err := rows.Scan(&folderID, &size); err != nil {
+			return nil, fmt.Errorf("failed to scan folder size: %w", err)
+		}
+		sizes[folderID] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read folder sizes: %w", err)
+	}
+
+	return sizes, nil
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"database/sql"
 	"filevault/internal/models"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,9 +13,20 @@ type FileRepositoryInterface interface {
 	Create(file *models.File) error
 	GetByID(id uuid.UUID) (*models.File, error)
 	GetByUserID(userID uuid.UUID, limit, offset int) ([]*models.File, error)
+	GetByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error)
+	GetRootByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error)
+	GetByUserIDAfter(userID uuid.UUID, cursor *models.FileCursor, limit int) ([]*models.File, error)
+	StreamForExport(userID uuid.UUID, fn func(row *models.FileExportRow) error) error
 	GetByUserIDAndFolderID(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error)
+	GetByUserIDAndFolderIDRecursive(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error)
 	SearchByUserID(userID uuid.UUID, searchTerm string, limit, offset int) ([]*models.File, error)
 	GetByHash(hash string) ([]*models.File, error)
+	GetByUploaderFolderAndHash(uploaderID uuid.UUID, folderID *uuid.UUID, hash, originalName string) (*models.File, error)
+	GetWithPerceptualHash(uploaderID *uuid.UUID) ([]*models.File, error)
+	RecordAccess(userID, fileID uuid.UUID, accessType string) error
+	GetRecentlyAccessedByUser(userID uuid.UUID, limit int) ([]*models.File, error)
+	UpdateMetadata(id uuid.UUID, originalName string, description, downloadName *string, modifiedBy uuid.UUID) error
+	SetPublic(id uuid.UUID, public bool) error
 	Delete(id uuid.UUID) error
 	GetDB() *sql.DB
 }
@@ -23,7 +35,8 @@ type FileRepositoryInterface interface {
 type FileHashRepositoryInterface interface {
 	Create(fileHash *models.FileHash) error
 	GetByHash(hash string) (*models.FileHash, error)
-	Delete(hash string) error
+	GetByOwnerAndHash(ownerID uuid.UUID, hash string) (*models.FileHash, error)
+	Delete(id uuid.UUID) error
 }
 
 // ShareRepositoryInterface defines the interface for share repository operations
@@ -34,6 +47,18 @@ type ShareRepositoryInterface interface {
 	Delete(id uuid.UUID) error
 }
 
+// UploadIdempotencyRepositoryInterface defines the interface for upload idempotency key operations
+type UploadIdempotencyRepositoryInterface interface {
+	Reserve(userID uuid.UUID, key string, since, pendingSince time.Time) (reserved bool, fileID *uuid.UUID, err error)
+	Complete(userID uuid.UUID, key string, fileID uuid.UUID) error
+	Release(userID uuid.UUID, key string) error
+}
+
+// UploadMetricsRepositoryInterface defines the interface for recording upload outcomes
+type UploadMetricsRepositoryInterface interface {
+	Increment(outcome string) error
+}
+
 // DownloadRepositoryInterface defines the interface for download repository operations
 type DownloadRepositoryInterface interface {
 	Create(download *models.Download) error
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// NotificationRepository handles database operations for notifications
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Create stores a new notification
+func (r *NotificationRepository) Create(notification *models.Notification) error {
+	query := `
+		INSERT INTO notifications (id, user_id, type, title, message, is_read)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRow(query,
+		notification.ID,
+		notification.UserID,
+		notification.Type,
+		notification.Title,
+		notification.Message,
+		notification.IsRead,
+	).Scan(&notification.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUserID retrieves a user's notifications, newest first
+func (r *NotificationRepository) ListByUserID(userID uuid.UUID, unreadOnly bool, limit, offset int) ([]*models.Notification, error) {
+	query := `
+		SELECT id, user_id, type, title, message, is_read, created_at, read_at
+		FROM notifications
+		WHERE user_id = $1 AND ($2 = FALSE OR is_read = FALSE)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := r.db.Query(query, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		notification := &models.Notification{}
+		err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Type,
+			&notification.Title,
+			&notification.Message,
+			&notification.IsRead,
+			&notification.CreatedAt,
+			&notification.ReadAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// CountUnread returns the number of unread notifications for a user
+func (r *NotificationRepository) CountUnread(userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = FALSE`
+
+	var count int
+	if err := r.db.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkRead marks a single notification belonging to the user as read.
+// Returns false if no such notification exists for the user.
+func (r *NotificationRepository) MarkRead(id, userID uuid.UUID) (bool, error) {
+	query := `
+		UPDATE notifications
+		SET is_read = TRUE, read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// MarkAllRead marks all of a user's unread notifications as read and returns how many changed
+func (r *NotificationRepository) MarkAllRead(userID uuid.UUID) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET is_read = TRUE, read_at = NOW()
+		WHERE user_id = $1 AND is_read = FALSE
+	`
+
+	result, err := r.db.Exec(query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionRepository tracks the last activity of issued tokens
+type SessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// GetLastSeen returns when the session was last used, or nil if it isn't tracked
+func (r *SessionRepository) GetLastSeen(tokenID string) (*time.Time, error) {
+	var lastSeen time.Time
+	err := r.db.QueryRow(`SELECT last_seen_at FROM user_sessions WHERE token_id = $1`, tokenID).Scan(&lastSeen)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &lastSeen, nil
+}
+
+// Touch records activity on a session, starting to track it if needed
+func (r *SessionRepository) Touch(tokenID string, userID uuid.UUID, seenAt time.Time) error {
+	query := `
+		INSERT INTO user_sessions (token_id, user_id, last_seen_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token_id)
+		DO UPDATE SET last_seen_at = GREATEST(user_sessions.last_seen_at, EXCLUDED.last_seen_at)
+	`
+	if _, err := r.db.Exec(query, tokenID, userID, seenAt); err != nil {
+		return fmt.Errorf("failed to record session activity: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessionsNotSeenSince removes a user's sessions idle since before the given time
+func (r *SessionRepository) DeleteUserSessionsNotSeenSince(userID uuid.UUID, before time.Time) error {
+	_, err := r.db.Exec(`DELETE FROM user_sessions WHERE user_id = $1 AND last_seen_at < $2`, userID, before)
+	if err != nil {
+		return fmt.Errorf("failed to delete stale sessions: %w", err)
+	}
+	return nil
+}
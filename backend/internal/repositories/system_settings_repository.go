@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// SystemSettingsRepository handles database operations for system-wide settings
+type SystemSettingsRepository struct {
+	db *sql.DB
+}
+
+// NewSystemSettingsRepository creates a new system settings repository
+func NewSystemSettingsRepository(db *sql.DB) *SystemSettingsRepository {
+	return &SystemSettingsRepository{db: db}
+}
+
+// Get returns a setting's value; found is false if it has never been set
+func (r *SystemSettingsRepository) Get(key string) (string, bool, error) {
+	var value string
+	err := r.db.QueryRow(`SELECT value FROM system_settings WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get system setting %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Set stores a setting's value and who changed it
+func (r *SystemSettingsRepository) Set(key, value string, updatedBy uuid.UUID) error {
+	query := `
+		INSERT INTO system_settings (key, value, updated_by, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (key)
+		DO UPDATE SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`
+
+	if _, err := r.db.Exec(query, key, value, updatedBy); err != nil {
+		return fmt.Errorf("failed to set system setting %s: %w", key, err)
+	}
+	return nil
+}
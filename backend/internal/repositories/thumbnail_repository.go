@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"filevault/internal/models"
+)
+
+// ThumbnailRepository handles thumbnail-related database operations
+type ThumbnailRepository struct {
+	db *sql.DB
+}
+
+// NewThumbnailRepository creates a new thumbnail repository
+func NewThumbnailRepository(db *sql.DB) *ThumbnailRepository {
+	return &ThumbnailRepository{db: db}
+}
+
+// GetThumbnail returns the thumbnail of the content at the given size, or nil if none was generated
+func (r *ThumbnailRepository) GetThumbnail(hash string, size int) (*models.Thumbnail, error) {
+	query := `
+		SELECT hash, size, width, height, s3_key, content_type, byte_size, created_at
+		FROM thumbnails
+		WHERE hash = $1 AND size = $2
+	`
+
+	thumb := &models.Thumbnail{}
+	err := r.db.QueryRow(query, hash, size).Scan(
+		&thumb.Hash,
+		&thumb.Size,
+		&thumb.Width,
+		&thumb.Height,
+		&thumb.S3Key,
+		&thumb.ContentType,
+		&thumb.ByteSize,
+		&thumb.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get thumbnail: %w", err)
+	}
+	return thumb, nil
+}
+
+// CreateThumbnail records a generated thumbnail. Thumbnail keys are derived from the hash and
+// size, so if another request stored the same one first its row is simply kept.
+func (r *ThumbnailRepository) CreateThumbnail(thumb *models.Thumbnail) error {
+	query := `
+		INSERT INTO thumbnails (hash, size, width, height, s3_key, content_type, byte_size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (hash, size) DO NOTHING
+	`
+
+	_, err := r.db.Exec(
+		query,
+		thumb.Hash,
+		thumb.Size,
+		thumb.Width,
+		thumb.Height,
+		thumb.S3Key,
+		thumb.ContentType,
+		thumb.ByteSize,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail: %w", err)
+	}
+	return nil
+}
+
+// DeleteByHash removes the thumbnail records of some content and returns their S3 keys
+func (r *ThumbnailRepository) DeleteByHash(hash string) ([]string, error) {
+	rows, err := r.db.Query(`DELETE FROM thumbnails WHERE hash = $1 RETURNING s3_key`, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete thumbnails: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan thumbnail key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadIdempotencyRepository records which file each upload Idempotency-Key produced
+type UploadIdempotencyRepository struct {
+	db *sql.DB
+}
+
+// NewUploadIdempotencyRepository creates a new upload idempotency repository
+func NewUploadIdempotencyRepository(db *sql.DB) *UploadIdempotencyRepository {
+	return &UploadIdempotencyRepository{db: db}
+}
+
+// Reserve claims the user's key for a new upload. reserved is true when the caller now holds
+// the key, either because it was unused or because its last use was before since, or was left
+// pending by an upload that never finished before pendingSince. Otherwise fileID is the file an
+// earlier upload with the key created, or nil while that upload is still in progress.
+func (r *UploadIdempotencyRepository) Reserve(userID uuid.UUID, key string, since, pendingSince time.Time) (reserved bool, fileID *uuid.UUID, err error) {
+	query := `
+		INSERT INTO upload_idempotency_keys (user_id, idempotency_key, file_id)
+		VALUES ($1, $2, NULL)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE
+		SET file_id = NULL, created_at = NOW()
+		WHERE upload_idempotency_keys.created_at < $3
+		   OR (upload_idempotency_keys.file_id IS NULL AND upload_idempotency_keys.created_at < $4)
+		RETURNING TRUE
+	`
+
+	err = r.db.QueryRow(query, userID, key, since, pendingSince).Scan(&reserved)
+	if err == nil {
+		return true, nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, nil, fmt.Errorf("failed to reserve upload idempotency key: %w", err)
+	}
+
+	// Someone else holds the key
+	var existing uuid.NullUUID
+	err = r.db.QueryRow(
+		`SELECT file_id FROM upload_idempotency_keys WHERE user_id = $1 AND idempotency_key = $2`,
+		userID, key,
+	).Scan(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return false, nil, fmt.Errorf("failed to get upload idempotency key: %w", err)
+	}
+	if !existing.Valid {
+		return false, nil, nil
+	}
+	return false, &existing.UUID, nil
+}
+
+// Complete records the file the upload holding the key created
+func (r *UploadIdempotencyRepository) Complete(userID uuid.UUID, key string, fileID uuid.UUID) error {
+	query := `
+		UPDATE upload_idempotency_keys
+		SET file_id = $3, created_at = NOW()
+		WHERE user_id = $1 AND idempotency_key = $2
+	`
+
+	if _, err := r.db.Exec(query, userID, key, fileID); err != nil {
+		return fmt.Errorf("failed to save upload idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release gives up a key reserved by an upload that failed, so a retry can use it
+func (r *UploadIdempotencyRepository) Release(userID uuid.UUID, key string) error {
+	query := `DELETE FROM upload_idempotency_keys WHERE user_id = $1 AND idempotency_key = $2 AND file_id IS NULL`
+
+	if _, err := r.db.Exec(query, userID, key); err != nil {
+		return fmt.Errorf("failed to release upload idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes keys last used before before and returns how many were removed
+func (r *UploadIdempotencyRepository) DeleteExpired(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM upload_idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired upload idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
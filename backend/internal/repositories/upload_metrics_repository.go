@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"filevault/internal/models"
+)
+
+// UploadMetricsRepository keeps daily counts of upload outcomes
+type UploadMetricsRepository struct {
+	db *sql.DB
+}
+
+// NewUploadMetricsRepository creates a new upload metrics repository
+func NewUploadMetricsRepository(db *sql.DB) *UploadMetricsRepository {
+	return &UploadMetricsRepository{db: db}
+}
+
+// Increment counts one upload with the given outcome today
+func (r *UploadMetricsRepository) Increment(outcome string) error {
+	query := `
+		INSERT INTO upload_metrics (day, outcome, count)
+		VALUES (CURRENT_DATE, $1, 1)
+		ON CONFLICT (day, outcome) DO UPDATE SET count = upload_metrics.count + 1
+	`
+
+	if _, err := r.db.Exec(query, outcome); err != nil {
+		return fmt.Errorf("failed to increment upload metric: %w", err)
+	}
+	return nil
+}
+
+// GetOutcomeCounts totals uploads by outcome over the days from since onwards
+func (r *UploadMetricsRepository) GetOutcomeCounts(since time.Time) ([]models.UploadOutcomeCount, error) {
+	query := `
+		SELECT outcome, SUM(count)
+		FROM upload_metrics
+		WHERE day >= $1::date
+		GROUP BY outcome
+		ORDER BY outcome
+	`
+
+	rows, err := r.db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []models.UploadOutcomeCount
+	for rows.Next() {
+		var count models.UploadOutcomeCount
+		if err := rows.Scan(&count.Outcome, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan upload metric: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read upload metrics: %w", err)
+	}
+
+	return counts, nil
+}
@@ -2,10 +2,12 @@ package repositories
 
 import (
 	"database/sql"
+	"fmt"
 
 	"filevault/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // UserFileShareRepository handles database operations for user file shares
@@ -148,6 +150,87 @@ func (r *UserFileShareRepository) GetIncomingShares(userID uuid.UUID, limit, off
 	return shares, nil
 }
 
+// sharedWithMeQuery collects one row per file shared with the user ($1) directly, through a
+// shared folder or any of its subfolders, or by an access grant. Files the user uploaded
+// themselves are left out.
+const sharedWithMeQuery = `
+	WITH RECURSIVE shared_tree AS (
+		SELECT folder_id AS id, from_user_id, created_at FROM user_folder_shares WHERE to_user_id = $1
+		UNION
+		SELECT fo.id, st.from_user_id, st.created_at FROM folders fo INNER JOIN shared_tree st ON fo.parent_id = st.id
+	),
+	sources AS (
+		SELECT file_id, '` + models.SharedWithMeSourceUserShare + `' AS source, from_user_id AS shared_by, created_at AS shared_at
+		FROM user_file_shares WHERE to_user_id = $1
+		UNION ALL
+		SELECT f.id, '` + models.SharedWithMeSourceFolderShare + `', st.from_user_id, st.created_at
+		FROM files f INNER JOIN shared_tree st ON f.folder_id = st.id
+		UNION ALL
+		SELECT file_id, '` + models.SharedWithMeSourceAccessGrant + `', granted_by, created_at
+		FROM file_access_grants WHERE grantee_id = $1
+	),
+	shared AS (
+		SELECT file_id,
+			array_agg(DISTINCT source ORDER BY source) AS sources,
+			(array_agg(shared_by ORDER BY shared_at DESC))[1] AS shared_by,
+			MAX(shared_at) AS shared_at
+		FROM sources
+		GROUP BY file_id
+	)
+`
+
+// GetSharedWithMe retrieves a page of the files shared with a user by any means, newest share
+// first, with the total number of such files
+func (r *UserFileShareRepository) GetSharedWithMe(userID uuid.UUID, limit, offset int) ([]*models.SharedWithMeFile, int, error) {
+	var total int
+	countQuery := sharedWithMeQuery + `
+		SELECT COUNT(*) FROM shared sh JOIN files f ON sh.file_id = f.id WHERE f.uploader_id <> $1
+	`
+	if err := r.db.QueryRow(countQuery, userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count files shared with user: %w", err)
+	}
+
+	query := sharedWithMeQuery + `
+		SELECT
+			sh.sources, sh.shared_at,
+			f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, COALESCE(f.s3_key, ''), f.uploader_id, f.folder_id, f.created_at, f.updated_at,
+			u.id, u.email, u.username, u.role, u.created_at, u.updated_at
+		FROM shared sh
+		JOIN files f ON sh.file_id = f.id
+		JOIN users u ON sh.shared_by = u.id
+		WHERE f.uploader_id <> $1
+		ORDER BY sh.shared_at DESC, f.id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get files shared with user: %w", err)
+	}
+	defer rows.Close()
+
+	files := []*models.SharedWithMeFile{}
+	for rows.Next() {
+		shared := &models.SharedWithMeFile{File: &models.File{}, SharedBy: &models.User{}}
+		file, sharedBy := shared.File, shared.SharedBy
+
+		err := rows.Scan(
+			pq.Array(&shared.Sources), &shared.SharedAt,
+			&file.ID, &file.Filename, &file.OriginalName, &file.MimeType, &file.Size, &file.Hash, &file.S3Key, &file.UploaderID, &file.FolderID, &file.CreatedAt, &file.UpdatedAt,
+			&sharedBy.ID, &sharedBy.Email, &sharedBy.Username, &sharedBy.Role, &sharedBy.CreatedAt, &sharedBy.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan file shared with user: %w", err)
+		}
+		files = append(files, shared)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to get files shared with user: %w", err)
+	}
+
+	return files, total, nil
+}
+
 // GetOutgoingShares retrieves all files shared by a user
 func (r *UserFileShareRepository) GetOutgoingShares(userID uuid.UUID, limit, offset int) ([]*models.UserFileShare, error) {
 	query := `
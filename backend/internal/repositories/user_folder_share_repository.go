@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// UserFolderShareRepository handles database operations for user folder shares
+type UserFolderShareRepository struct {
+	db *sql.DB
+}
+
+// NewUserFolderShareRepository creates a new user folder share repository
+func NewUserFolderShareRepository(db *sql.DB) *UserFolderShareRepository {
+	return &UserFolderShareRepository{db: db}
+}
+
+// Create creates a new user folder share
+func (r *UserFolderShareRepository) Create(share *models.UserFolderShare) error {
+	query := `
+		INSERT INTO user_folder_shares (id, folder_id, from_user_id, to_user_id, message, is_read, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.Exec(query,
+		share.ID,
+		share.FolderID,
+		share.FromUserID,
+		share.ToUserID,
+		share.Message,
+		share.IsRead,
+		share.CreatedAt,
+		share.UpdatedAt,
+	)
+
+	return err
+}
+
+// GetIncomingShares retrieves all folders shared with a user
+func (r *UserFolderShareRepository) GetIncomingShares(userID uuid.UUID) ([]*models.UserFolderShare, error) {
+	query := `
+		SELECT 
+			ufs.id, ufs.folder_id, ufs.from_user_id, ufs.to_user_id, ufs.message, ufs.is_read, ufs.created_at, ufs.updated_at,
+			fo.id, fo.name, fo.path, fo.parent_id, fo.owner_id, fo.file_count, fo.created_at, fo.updated_at,
+			from_user.id, from_user.email, from_user.username, from_user.role, from_user.created_at, from_user.updated_at
+		FROM user_folder_shares ufs
+		JOIN folders fo ON ufs.folder_id = fo.id
+		JOIN users from_user ON ufs.from_user_id = from_user.id
+		WHERE ufs.to_user_id = $1
+		ORDER BY ufs.created_at DESC
+	`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*models.UserFolderShare
+	for rows.Next() {
+		share := &models.UserFolderShare{}
+		folder := &models.Folder{}
+		fromUser := &models.User{}
+
+		err := rows.Scan(
+			&share.ID, &share.FolderID, &share.FromUserID, &share.ToUserID, &share.Message, &share.IsRead, &share.CreatedAt, &share.UpdatedAt,
+			&folder.ID, &folder.Name, &folder.Path, &folder.ParentID, &folder.OwnerID, &folder.FileCount, &folder.CreatedAt, &folder.UpdatedAt,
+			&fromUser.ID, &fromUser.Email, &fromUser.Username, &fromUser.Role, &fromUser.CreatedAt, &fromUser.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		share.Folder = folder
+		share.FromUser = fromUser
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// CheckIfAlreadyShared checks if a folder is already shared with a user
+func (r *UserFolderShareRepository) CheckIfAlreadyShared(folderID, toUserID uuid.UUID) (bool, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM user_folder_shares
+		WHERE folder_id = $1 AND to_user_id = $2
+	`
+
+	var count int
+	err := r.db.QueryRow(query, folderID, toUserID).Scan(&count)
+	return count > 0, err
+}
+
+// GetFilesInFolderTree retrieves all files in a folder and its subfolders
+func (r *UserFolderShareRepository) GetFilesInFolderTree(folderID uuid.UUID) ([]*models.File, error) {
+	query := `
+		WITH RECURSIVE folder_tree AS (
+			SELECT id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT fo.id FROM folders fo INNER JOIN folder_tree ft ON fo.parent_id = ft.id
+		)
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, COALESCE(f.s3_key, ''), f.uploader_id, f.folder_id, f.created_at, f.updated_at
+		FROM files f
+		WHERE f.folder_id IN (SELECT id FROM folder_tree)
+		ORDER BY f.created_at DESC
+	`
+
+	rows, err := r.db.Query(query, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file := &models.File{}
+		err := rows.Scan(
+			&file.ID, &file.Filename, &file.OriginalName, &file.MimeType, &file.Size, &file.Hash, &file.S3Key, &file.UploaderID, &file.FolderID, &file.CreatedAt, &file.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// HasFileAccess checks if a file lives in a folder (or subfolder of a folder) shared with the user
+func (r *UserFolderShareRepository) HasFileAccess(userID, fileID uuid.UUID) (bool, error) {
+	query := `
+		WITH RECURSIVE shared_tree AS (
+			SELECT folder_id AS id FROM user_folder_shares WHERE to_user_id = $1
+			UNION
+			SELECT fo.id FROM folders fo INNER JOIN shared_tree st ON fo.parent_id = st.id
+		)
+		SELECT EXISTS (
+			SELECT 1 FROM files f
+			WHERE f.id = $2 AND f.folder_id IN (SELECT id FROM shared_tree)
+		)
+	`
+
+	var hasAccess bool
+	err := r.db.QueryRow(query, userID, fileID).Scan(&hasAccess)
+	return hasAccess, err
+}
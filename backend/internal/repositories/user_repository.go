@@ -3,6 +3,7 @@ package repositories
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"filevault/internal/models"
 
@@ -22,6 +23,35 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 
 // Create creates a new user
 func (r *UserRepository) Create(user *models.User) error {
+	return insertUser(r.db, user)
+}
+
+// CreateWithSetup creates a new user and runs setup in the same transaction, so the user is
+// only created if setup succeeds too
+func (r *UserRepository) CreateWithSetup(user *models.User, setup func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(tx, user); err != nil {
+		return err
+	}
+	if err := setup(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// insertUser stores a new user with a hashed password, filling in its timestamps
+func insertUser(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, user *models.User) error {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -34,7 +64,7 @@ func (r *UserRepository) Create(user *models.User) error {
 		RETURNING created_at, updated_at
 	`
 
-	err = r.db.QueryRow(
+	err = q.QueryRow(
 		query,
 		user.ID,
 		user.Email,
@@ -53,7 +83,7 @@ func (r *UserRepository) Create(user *models.User) error {
 // GetByID retrieves a user by ID
 func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, email, username, password, role, created_at, updated_at
+		SELECT id, email, username, password, role, dedup_opt_out, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -65,6 +95,7 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 		&user.Username,
 		&user.Password,
 		&user.Role,
+		&user.DedupOptOut,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -82,7 +113,7 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, email, username, password, role, created_at, updated_at
+		SELECT id, email, username, password, role, dedup_opt_out, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -94,6 +125,40 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 		&user.Username,
 		&user.Password,
 		&user.Role,
+		&user.DedupOptOut,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetByEmailOrUsername retrieves a user whose email or username matches the identifier.
+// An email match wins if the identifier happens to match one user's email and another's username.
+func (r *UserRepository) GetByEmailOrUsername(identifier string) (*models.User, error) {
+	query := `
+		SELECT id, email, username, password, role, dedup_opt_out, created_at, updated_at
+		FROM users
+		WHERE email = $1 OR username = $1
+		ORDER BY (email = $1) DESC
+		LIMIT 1
+	`
+
+	user := &models.User{}
+	err := r.db.QueryRow(query, identifier).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.DedupOptOut,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -111,7 +176,7 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 // GetByUsername retrieves a user by username
 func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 	query := `
-		SELECT id, email, username, password, role, created_at, updated_at
+		SELECT id, email, username, password, role, dedup_opt_out, created_at, updated_at
 		FROM users
 		WHERE username = $1
 	`
@@ -123,6 +188,7 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 		&user.Username,
 		&user.Password,
 		&user.Role,
+		&user.DedupOptOut,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -141,12 +207,12 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 func (r *UserRepository) Update(user *models.User) error {
 	query := `
 		UPDATE users
-		SET email = $2, username = $3, role = $4, updated_at = NOW()
+		SET email = $2, username = $3, role = $4, dedup_opt_out = $5, updated_at = NOW()
 		WHERE id = $1
 		RETURNING updated_at
 	`
 
-	err := r.db.QueryRow(query, user.ID, user.Email, user.Username, user.Role).Scan(&user.UpdatedAt)
+	err := r.db.QueryRow(query, user.ID, user.Email, user.Username, user.Role, user.DedupOptOut).Scan(&user.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -154,6 +220,106 @@ func (r *UserRepository) Update(user *models.User) error {
 	return nil
 }
 
+// UpdatePassword hashes and stores a new password for a user
+func (r *UserRepository) UpdatePassword(userID uuid.UUID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	query := `UPDATE users SET password = $2, updated_at = NOW() WHERE id = $1`
+	_, err = r.db.Exec(query, userID, string(hashedPassword))
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeTokens invalidates every token issued to the user up to now
+func (r *UserRepository) RevokeTokens(userID uuid.UUID) error {
+	query := `UPDATE users SET tokens_invalid_before = NOW() WHERE id = $1`
+	_, err := r.db.Exec(query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetTokensInvalidBefore returns the time before which the user's tokens are revoked, or nil if none are
+func (r *UserRepository) GetTokensInvalidBefore(userID uuid.UUID) (*time.Time, error) {
+	query := `SELECT tokens_invalid_before FROM users WHERE id = $1`
+
+	var invalidBefore sql.NullTime
+	err := r.db.QueryRow(query, userID).Scan(&invalidBefore)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get token revocation: %w", err)
+	}
+
+	if !invalidBefore.Valid {
+		return nil, nil
+	}
+	return &invalidBefore.Time, nil
+}
+
+// GetDedupOptOut reports whether the user keeps their uploads out of deduplication with others
+func (r *UserRepository) GetDedupOptOut(userID uuid.UUID) (bool, error) {
+	query := `SELECT dedup_opt_out FROM users WHERE id = $1`
+
+	var optOut bool
+	err := r.db.QueryRow(query, userID).Scan(&optOut)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, fmt.Errorf("user not found")
+		}
+		return false, fmt.Errorf("failed to get dedup preference: %w", err)
+	}
+
+	return optOut, nil
+}
+
+// GetStorageQuotaOverride returns the user's own storage quota in MB, or nil if they use the default
+func (r *UserRepository) GetStorageQuotaOverride(userID uuid.UUID) (*int64, error) {
+	query := `SELECT storage_quota_mb FROM users WHERE id = $1`
+
+	var quotaMB sql.NullInt64
+	err := r.db.QueryRow(query, userID).Scan(&quotaMB)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get storage quota: %w", err)
+	}
+
+	if !quotaMB.Valid {
+		return nil, nil
+	}
+	return &quotaMB.Int64, nil
+}
+
+// SetStorageQuotaOverride sets the user's own storage quota in MB; nil clears it
+func (r *UserRepository) SetStorageQuotaOverride(userID uuid.UUID, quotaMB *int64) error {
+	query := `UPDATE users SET storage_quota_mb = $2, updated_at = NOW() WHERE id = $1`
+	result, err := r.db.Exec(query, userID, quotaMB)
+	if err != nil {
+		return fmt.Errorf("failed to set storage quota: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set storage quota: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
 // Delete deletes a user
 func (r *UserRepository) Delete(id uuid.UUID) error {
 	query := `DELETE FROM users WHERE id = $1`
@@ -173,7 +339,7 @@ func (r *UserRepository) VerifyPassword(user *models.User, password string) erro
 // GetAllUsers retrieves all users with pagination
 func (r *UserRepository) GetAllUsers(limit, offset int) ([]*models.User, error) {
 	query := `
-		SELECT id, email, username, password, role, created_at, updated_at
+		SELECT id, email, username, password, role, dedup_opt_out, created_at, updated_at
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -194,6 +360,7 @@ func (r *UserRepository) GetAllUsers(limit, offset int) ([]*models.User, error)
 			&user.Username,
 			&user.Password,
 			&user.Role,
+			&user.DedupOptOut,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"time"
+
+	"filevault/internal/models"
+)
+
+// Stored content used within hotAccessWindow is hot and within warmAccessWindow warm; anything
+// older is cold. The windows match the minimum storage durations of S3 Standard-IA (30 days)
+// and Glacier Instant Retrieval (90 days), the classes warm and cold content would move to.
+const (
+	hotAccessWindow  = 30 * 24 * time.Hour
+	warmAccessWindow = 90 * 24 * time.Hour
+)
+
+// GetAccessHeatmap classifies stored content as hot, warm or cold by how recently it was
+// previewed or downloaded, with file, object and byte totals per tier, to inform S3 lifecycle
+// policies. Every tier is listed, hottest first, even when empty.
+func (s *AdminService) GetAccessHeatmap() ([]models.FileHeat, error) {
+	now := time.Now()
+	tiers, err := s.fileRepo.GetAccessHeat(now.Add(-hotAccessWindow), now.Add(-warmAccessWindow))
+	if err != nil {
+		return nil, err
+	}
+	return orderHeatTiers(tiers), nil
+}
+
+// orderHeatTiers returns one entry per access tier in hot, warm, cold order, filling in tiers
+// that had no content
+func orderHeatTiers(tiers []models.FileHeat) []models.FileHeat {
+	byTier := make(map[string]models.FileHeat, len(tiers))
+	for _, heat := range tiers {
+		byTier[heat.Tier] = heat
+	}
+
+	ordered := make([]models.FileHeat, 0, 3)
+	for _, tier := range []string{models.AccessTierHot, models.AccessTierWarm, models.AccessTierCold} {
+		heat := byTier[tier]
+		heat.Tier = tier
+		ordered = append(ordered, heat)
+	}
+	return ordered
+}
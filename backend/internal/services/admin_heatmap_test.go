@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderHeatTiers(t *testing.T) {
+	tiers := orderHeatTiers([]models.FileHeat{
+		{Tier: models.AccessTierCold, FileCount: 5, ObjectCount: 4, TotalBytes: 4000},
+		{Tier: models.AccessTierHot, FileCount: 2, ObjectCount: 2, TotalBytes: 200},
+	})
+
+	assert.Equal(t, []models.FileHeat{
+		{Tier: models.AccessTierHot, FileCount: 2, ObjectCount: 2, TotalBytes: 200},
+		{Tier: models.AccessTierWarm},
+		{Tier: models.AccessTierCold, FileCount: 5, ObjectCount: 4, TotalBytes: 4000},
+	}, tiers)
+}
+
+func TestOrderHeatTiers_Empty(t *testing.T) {
+	tiers := orderHeatTiers(nil)
+
+	assert.Len(t, tiers, 3)
+	for _, heat := range tiers {
+		assert.Zero(t, heat.TotalBytes)
+	}
+}
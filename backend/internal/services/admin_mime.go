@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	// DefaultMimeRedetectLimit is how many files RedetectMimeTypes checks when no limit is given
+	DefaultMimeRedetectLimit = 500
+	// MaxMimeRedetectLimit caps the files checked in one run
+	MaxMimeRedetectLimit = 5000
+
+	// mimeRedetectBatchSize files are read from S3 before pausing for mimeRedetectBatchPause,
+	// so a large run doesn't monopolize the bucket's request rate
+	mimeRedetectBatchSize  = 50
+	mimeRedetectBatchPause = 500 * time.Millisecond
+)
+
+// genericMimeTypes say nothing about the content; browsers send them when they don't know better
+var genericMimeTypes = map[string]bool{
+	"":                           true,
+	"application/octet-stream":   true,
+	"binary/octet-stream":        true,
+	"application/unknown":        true,
+	"application/x-unknown":      true,
+	"application/force-download": true,
+	"application/x-download":     true,
+}
+
+// RedetectMimeTypes checks up to limit files whose MIME type hasn't been verified yet, reading
+// the first bytes of each S3 object and correcting the stored type where the content says
+// otherwise. Files are handled oldest first in small batches with a pause in between; each is
+// marked as checked so the next run continues where this one stopped. It returns how many
+// files had their MIME type changed.
+func (s *AdminService) RedetectMimeTypes(ctx context.Context, limit int) (int, error) {
+	if s.s3Service == nil {
+		return 0, fmt.Errorf("S3 service not initialized")
+	}
+	if limit <= 0 {
+		limit = DefaultMimeRedetectLimit
+	}
+	if limit > MaxMimeRedetectLimit {
+		limit = MaxMimeRedetectLimit
+	}
+
+	// Deduplicated files share an object, so each is only read once per run
+	detectedByKey := make(map[string]*mimetype.MIME)
+
+	updated, checked := 0, 0
+	for checked < limit {
+		batchSize := min(mimeRedetectBatchSize, limit-checked)
+		files, err := s.fileRepo.GetMimeUnchecked(batchSize)
+		if err != nil {
+			return updated, err
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return updated, err
+			}
+
+			detected, ok := detectedByKey[file.S3Key]
+			if !ok && file.Size > 0 {
+				prefix, err := s.s3Service.DownloadPrefix(ctx, file.S3Key, mimeSniffLen)
+				if err != nil {
+					// Leave the file unchecked so a later run retries it
+					fmt.Printf("MIME re-detection: failed to read %s: %v\n", file.S3Key, err)
+					continue
+				}
+				detected = mimetype.Detect(prefix)
+				detectedByKey[file.S3Key] = detected
+			}
+
+			corrected := ""
+			if detected != nil {
+				if mimeType, changed := correctedMimeType(file.MimeType, detected); changed {
+					corrected = mimeType
+				}
+			}
+			if err := s.fileRepo.MarkMimeChecked(file.ID, corrected); err != nil {
+				return updated, err
+			}
+			if corrected != "" {
+				fmt.Printf("MIME re-detection: %s %s -> %s\n", file.ID, file.MimeType, corrected)
+				updated++
+			}
+		}
+		checked += len(files)
+
+		if len(files) < batchSize {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return updated, ctx.Err()
+		case <-time.After(mimeRedetectBatchPause):
+		}
+	}
+
+	return updated, nil
+}
+
+// correctedMimeType decides whether detected content should replace a stored MIME type. It does
+// when the stored type is missing or generic, or names a kind of content incompatible with what
+// was detected. A detection that finds nothing specific, or a stored type the detector doesn't
+// know, keeps the stored type.
+func correctedMimeType(stored string, detected *mimetype.MIME) (string, bool) {
+	if detected.Is("application/octet-stream") {
+		return "", false
+	}
+
+	storedMediaType, _, err := mime.ParseMediaType(stored)
+	if err != nil {
+		storedMediaType = strings.ToLower(strings.TrimSpace(stored))
+	}
+
+	if !genericMimeTypes[storedMediaType] {
+		expected := mimetype.Lookup(storedMediaType)
+		if expected == nil || mimeTypesCompatible(detected, expected) {
+			return "", false
+		}
+	}
+
+	return detected.String(), true
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrectedMimeType(t *testing.T) {
+	png := mimetype.Detect([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	pdf := mimetype.Detect([]byte("%PDF-1.4\n"))
+	unknown := mimetype.Detect([]byte{0x00, 0x01, 0x02, 0xff, 0xfe})
+
+	tests := []struct {
+		name     string
+		stored   string
+		detected *mimetype.MIME
+		want     string
+		changed  bool
+	}{
+		{"empty stored type", "", png, "image/png", true},
+		{"generic stored type", "application/octet-stream", pdf, "application/pdf", true},
+		{"force-download", "application/force-download", pdf, "application/pdf", true},
+		{"mismatched type", "image/jpeg", png, "image/png", true},
+		{"matching type", "image/png", png, "", false},
+		{"matching type with parameters", "application/pdf; name=x.pdf", pdf, "", false},
+		{"nothing specific detected", "image/png", unknown, "", false},
+		{"unknown stored type kept", "application/x-custom-format", png, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := correctedMimeType(tt.stored, tt.detected)
+			assert.Equal(t, tt.changed, changed)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRedetectMimeTypes_RequiresS3(t *testing.T) {
+	service := &AdminService{}
+
+	_, err := service.RedetectMimeTypes(context.Background(), 10)
+	assert.Error(t, err)
+}
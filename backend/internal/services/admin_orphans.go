@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// orphanGracePeriod skips S3 objects uploaded recently, since an upload writes the object
+// before its database rows and would otherwise look orphaned while it is in flight
+const orphanGracePeriod = time.Hour
+
+// orphanHashPageSize is the number of file hashes checked against S3 per query
+const orphanHashPageSize = 500
+
+// OrphanedObject is an S3 object that no file hash or file record references
+type OrphanedObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// DanglingHash is a file hash whose S3 object no longer exists
+type DanglingHash struct {
+	ID          uuid.UUID `json:"id"`
+	Hash        string    `json:"hash"`
+	S3Key       string    `json:"s3Key"`
+	Size        int64     `json:"size"`
+	FileRecords int       `json:"fileRecords"`
+}
+
+// OrphanReport lists storage and database entries that are out of sync
+type OrphanReport struct {
+	GeneratedAt     time.Time        `json:"generatedAt"`
+	ScannedObjects  int              `json:"scannedObjects"`
+	ScannedHashes   int              `json:"scannedHashes"`
+	OrphanedObjects []OrphanedObject `json:"orphanedObjects"`
+	OrphanedBytes   int64            `json:"orphanedBytes"`
+	DanglingHashes  []DanglingHash   `json:"danglingHashes"`
+}
+
+// OrphanPurgeResult describes what PurgeOrphans removed, or would remove on a dry run
+type OrphanPurgeResult struct {
+	DryRun             bool         `json:"dryRun"`
+	Report             OrphanReport `json:"report"`
+	DeletedObjects     int          `json:"deletedObjects"`
+	DeletedHashes      int          `json:"deletedHashes"`
+	DeletedFileRecords int          `json:"deletedFileRecords"`
+	Errors             []string     `json:"errors"`
+}
+
+// FindOrphans reconciles S3 with the database. It reports S3 objects under the upload prefix
+// that nothing references, and file hashes whose S3 object is missing along with the number
+// of file records that point at them.
+func (s *AdminService) FindOrphans(ctx context.Context) (OrphanReport, error) {
+	report := OrphanReport{
+		GeneratedAt:     time.Now(),
+		OrphanedObjects: []OrphanedObject{},
+		DanglingHashes:  []DanglingHash{},
+	}
+
+	if s.s3Service == nil {
+		return report, fmt.Errorf("S3 service not initialized")
+	}
+
+	cutoff := report.GeneratedAt.Add(-orphanGracePeriod)
+
+	err := s.s3Service.ListObjects(ctx, S3FileKeyPrefix, func(objects []S3Object) error {
+		report.ScannedObjects += len(objects)
+
+		keys := make([]string, len(objects))
+		for i, obj := range objects {
+			keys[i] = obj.Key
+		}
+
+		referenced, err := s.fileHashRepo.FindReferencedS3Keys(keys)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range unreferencedObjects(objects, referenced, cutoff) {
+			report.OrphanedObjects = append(report.OrphanedObjects, obj)
+			report.OrphanedBytes += obj.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to scan S3 objects: %w", err)
+	}
+
+	for offset := 0; ; offset += orphanHashPageSize {
+		hashes, err := s.fileHashRepo.ListPage(orphanHashPageSize, offset)
+		if err != nil {
+			return report, fmt.Errorf("failed to scan file hashes: %w", err)
+		}
+		report.ScannedHashes += len(hashes)
+
+		for _, fileHash := range hashes {
+			// Hashes without a key predate S3 storage and are served from local disk
+			if fileHash.S3Key == "" {
+				continue
+			}
+
+			exists, err := s.s3Service.FileExists(ctx, fileHash.S3Key)
+			if err != nil {
+				return report, fmt.Errorf("failed to check S3 object %s: %w", fileHash.S3Key, err)
+			}
+			if exists {
+				continue
+			}
+
+			files, err := s.fileRepo.GetByHash(fileHash.Hash)
+			if err != nil {
+				return report, fmt.Errorf("failed to get files for hash %s: %w", fileHash.Hash, err)
+			}
+			// Private copies and other stored copies of the content keep their own objects and
+			// aren't affected by the missing one
+			files = copiesOfObject(files, fileHash.S3Key)
+
+			report.DanglingHashes = append(report.DanglingHashes, DanglingHash{
+				ID:          fileHash.ID,
+				Hash:        fileHash.Hash,
+				S3Key:       fileHash.S3Key,
+				Size:        fileHash.Size,
+				FileRecords: len(files),
+			})
+		}
+
+		if len(hashes) < orphanHashPageSize {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// PurgeOrphans deletes the entries found by FindOrphans: unreferenced S3 objects, dangling
+// file hashes, and the file records that point at missing content and can no longer be
+// downloaded. With dryRun set nothing is deleted and the result only reports what would be.
+// Individual failures are collected in the result so one bad entry doesn't stop the cleanup.
+func (s *AdminService) PurgeOrphans(ctx context.Context, dryRun bool) (OrphanPurgeResult, error) {
+	report, err := s.FindOrphans(ctx)
+	result := OrphanPurgeResult{
+		DryRun: dryRun,
+		Report: report,
+		Errors: []string{},
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if dryRun {
+		result.DeletedObjects = len(report.OrphanedObjects)
+		result.DeletedHashes = len(report.DanglingHashes)
+		for _, dangling := range report.DanglingHashes {
+			result.DeletedFileRecords += dangling.FileRecords
+		}
+		return result, nil
+	}
+
+	for _, obj := range report.OrphanedObjects {
+		if err := s.s3Service.DeleteFile(ctx, obj.Key); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.DeletedObjects++
+	}
+
+	for _, dangling := range report.DanglingHashes {
+		files, err := s.fileRepo.GetByHash(dangling.Hash)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		purged := true
+		for _, file := range copiesOfObject(files, dangling.S3Key) {
+			if err := s.fileRepo.Delete(file.ID); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				purged = false
+				continue
+			}
+			result.DeletedFileRecords++
+		}
+		if !purged {
+			continue
+		}
+
+		if err := s.fileHashRepo.Delete(dangling.ID); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.DeletedHashes++
+	}
+
+	return result, nil
+}
+
+// unreferencedObjects returns the objects missing from referenced that were last modified
+// before cutoff
+func unreferencedObjects(objects []S3Object, referenced map[string]bool, cutoff time.Time) []OrphanedObject {
+	var orphans []OrphanedObject
+	for _, obj := range objects {
+		if referenced[obj.Key] || obj.LastModified.After(cutoff) {
+			continue
+		}
+		orphans = append(orphans, OrphanedObject{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+	}
+	return orphans
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnreferencedObjects(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-orphanGracePeriod)
+
+	objects := []S3Object{
+		{Key: "files/2024/01/01/referenced.pdf", Size: 10, LastModified: now.Add(-48 * time.Hour)},
+		{Key: "files/2024/01/01/orphan.pdf", Size: 20, LastModified: now.Add(-48 * time.Hour)},
+		{Key: "files/2024/01/01/uploading.pdf", Size: 30, LastModified: now.Add(-time.Minute)},
+	}
+	referenced := map[string]bool{"files/2024/01/01/referenced.pdf": true}
+
+	orphans := unreferencedObjects(objects, referenced, cutoff)
+
+	assert.Len(t, orphans, 1)
+	assert.Equal(t, "files/2024/01/01/orphan.pdf", orphans[0].Key)
+	assert.Equal(t, int64(20), orphans[0].Size)
+}
+
+func TestFindOrphans_RequiresS3(t *testing.T) {
+	service := &AdminService{}
+
+	report, err := service.FindOrphans(context.Background())
+	assert.Error(t, err)
+	assert.Empty(t, report.OrphanedObjects)
+
+	result, err := service.PurgeOrphans(context.Background(), true)
+	assert.Error(t, err)
+	assert.True(t, result.DryRun)
+	assert.Zero(t, result.DeletedObjects)
+}
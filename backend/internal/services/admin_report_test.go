@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "0 B", formatBytes(0))
+	assert.Equal(t, "1023 B", formatBytes(1023))
+	assert.Equal(t, "1.0 KB", formatBytes(1024))
+	assert.Equal(t, "1.5 MB", formatBytes(1536*1024))
+	assert.Equal(t, "2.0 GB", formatBytes(2*1024*1024*1024))
+}
+
+func TestMonthlyStorageCostUSD(t *testing.T) {
+	assert.InDelta(t, 0.023, monthlyStorageCostUSD(1024*1024*1024, DefaultStorageCostPerGBMonth), 1e-9)
+	assert.InDelta(t, 0.05, monthlyStorageCostUSD(5*1024*1024*1024, 0.01), 1e-9)
+	assert.Zero(t, monthlyStorageCostUSD(0, 0.023))
+}
+
+func TestSetStorageCostPerGBMonth_IgnoresNegativeRates(t *testing.T) {
+	service := &AdminService{storageCostPerGBMonth: DefaultStorageCostPerGBMonth}
+
+	service.SetStorageCostPerGBMonth(0.0125)
+	assert.Equal(t, 0.0125, service.storageCostPerGBMonth)
+
+	service.SetStorageCostPerGBMonth(-1)
+	assert.Equal(t, 0.0125, service.storageCostPerGBMonth)
+}
+
+func TestEncodeStatsReportCSV(t *testing.T) {
+	stats := &AdminStats{
+		TotalUsers:   2,
+		TotalFiles:   3,
+		TotalStorage: 3 * 1024 * 1024,
+		DeduplicationStats: DeduplicationStats{
+			StorageSaved:      1024 * 1024,
+			CostPerGBMonthUSD: 0.0125,
+		},
+	}
+	report := &AdminStatsReport{
+		GeneratedAt:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		SystemStats:        stats,
+		DeduplicationStats: stats.DeduplicationStats,
+		UserStorage: []*UserStats{
+			{UserID: uuid.New(), Username: "alice", Email: "alice@example.com", TotalFiles: 3, StorageUsed: 3 * 1024 * 1024},
+		},
+	}
+
+	data, err := encodeStatsReportCSV(report)
+	assert.NoError(t, err)
+
+	out := string(data)
+	assert.Contains(t, out, "Report generated at,2024-01-02T03:04:05Z")
+	assert.Contains(t, out, "Total storage,3.0 MB")
+	assert.Contains(t, out, "Storage saved,1.0 MB")
+	assert.Contains(t, out, "Assumed storage cost (USD per GB-month),0.0125")
+	assert.True(t, strings.Contains(out, "alice,alice@example.com,3,3.0 MB"))
+}
+
+func TestExportStatsReport_RejectsUnknownFormat(t *testing.T) {
+	service := &AdminService{}
+
+	_, err := service.ExportStatsReport("xml")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported report format")
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DataCleanupResult reports what one CleanupExpiredData run removed
+type DataCleanupResult struct {
+	// Cutoff is the time before which download logs were rolled up; nil when retention is off
+	Cutoff *time.Time `json:"cutoff"`
+	// DownloadLogsSummarized counts download log rows moved into the daily totals
+	DownloadLogsSummarized int64 `json:"downloadLogsSummarized"`
+	// IdempotencyKeysDeleted counts upload idempotency keys removed after their TTL
+	IdempotencyKeysDeleted int64 `json:"idempotencyKeysDeleted"`
+}
+
+// UploadIdempotencyPruner deletes upload idempotency keys last used before a time
+type UploadIdempotencyPruner interface {
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// SetDownloadLogRetention sets how many days of individual download logs are kept; 0 or less
+// keeps them forever
+func (s *AdminService) SetDownloadLogRetention(days int) {
+	if days < 0 {
+		days = 0
+	}
+	s.downloadLogRetentionDays = days
+}
+
+// SetUploadIdempotencyPruning makes the data cleanup delete upload idempotency keys older than
+// ttl, which can no longer be replayed
+func (s *AdminService) SetUploadIdempotencyPruning(keys UploadIdempotencyPruner, ttl time.Duration) {
+	s.idempotencyKeys = keys
+	s.idempotencyTTL = ttl
+}
+
+// cleanupEnabled reports whether CleanupExpiredData has anything to do
+func (s *AdminService) cleanupEnabled() bool {
+	return s.downloadLogRetentionDays > 0 || s.idempotencyKeys != nil
+}
+
+// downloadLogCutoff returns the time before which download logs are past retention
+func downloadLogCutoff(now time.Time, retentionDays int) time.Time {
+	return now.AddDate(0, 0, -retentionDays)
+}
+
+// CleanupExpiredData removes data past its retention period. Download logs older than the
+// retention window are rolled up into per-share daily totals before deletion, so share
+// statistics keep counting them. Upload idempotency keys past their TTL are deleted.
+func (s *AdminService) CleanupExpiredData(ctx context.Context) (*DataCleanupResult, error) {
+	result := &DataCleanupResult{}
+	if !s.cleanupEnabled() {
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.idempotencyKeys != nil {
+		deleted, err := s.idempotencyKeys.DeleteExpired(time.Now().Add(-s.idempotencyTTL))
+		if err != nil {
+			return nil, err
+		}
+		result.IdempotencyKeysDeleted = deleted
+	}
+
+	if s.downloadLogRetentionDays > 0 {
+		cutoff := downloadLogCutoff(time.Now(), s.downloadLogRetentionDays)
+		summarized, err := s.fileShareRepo.RollUpDownloadLogs(cutoff)
+		if err != nil {
+			return nil, err
+		}
+		result.Cutoff = &cutoff
+		result.DownloadLogsSummarized = summarized
+	}
+	return result, nil
+}
+
+// StartDataCleanup runs CleanupExpiredData now and then on every interval until the returned
+// stop function is called. Nothing runs while there is nothing to clean up.
+func (s *AdminService) StartDataCleanup(interval time.Duration) (stop func()) {
+	if !s.cleanupEnabled() || interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+
+	run := func() {
+		result, err := s.CleanupExpiredData(context.Background())
+		if err != nil {
+			log.Printf("Data cleanup failed: %v", err)
+			return
+		}
+		if result.DownloadLogsSummarized > 0 {
+			log.Printf("Data cleanup: rolled up %d download logs older than %s", result.DownloadLogsSummarized, result.Cutoff.Format(time.RFC3339))
+		}
+		if result.IdempotencyKeysDeleted > 0 {
+			log.Printf("Data cleanup: deleted %d expired upload idempotency keys", result.IdempotencyKeysDeleted)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		run()
+		for {
+			select {
+			case <-ticker.C:
+				run()
+			case <-done:
+				return
+			}
+		}
+	}()
+	log.Printf("Data cleanup job started: download log retention=%d days, upload idempotency TTL=%s, interval=%s", s.downloadLogRetentionDays, s.idempotencyTTL, interval)
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
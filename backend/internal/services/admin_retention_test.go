@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadLogCutoff(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 1, 30, 12, 0, 0, 0, time.UTC), downloadLogCutoff(now, 60))
+}
+
+func TestAdminService_CleanupExpiredData_RetentionOff(t *testing.T) {
+	// With no retention configured the repository is never touched
+	service := &AdminService{}
+	service.SetDownloadLogRetention(-5)
+
+	result, err := service.CleanupExpiredData(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, result.Cutoff)
+	assert.Zero(t, result.DownloadLogsSummarized)
+
+	stop := service.StartDataCleanup(time.Hour)
+	stop()
+}
+
+// recordingPruner records the cutoff it was asked to delete idempotency keys before
+type recordingPruner struct {
+	before time.Time
+}
+
+func (p *recordingPruner) DeleteExpired(before time.Time) (int64, error) {
+	p.before = before
+	return 3, nil
+}
+
+func TestAdminService_CleanupExpiredData_PrunesIdempotencyKeys(t *testing.T) {
+	// Pruning runs even with download log retention off
+	pruner := &recordingPruner{}
+	service := &AdminService{}
+	service.SetUploadIdempotencyPruning(pruner, 24*time.Hour)
+
+	result, err := service.CleanupExpiredData(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.IdempotencyKeysDeleted)
+	assert.Nil(t, result.Cutoff)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), pruner.before, time.Minute)
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"filevault/internal/models"
@@ -33,6 +34,8 @@ type DeduplicationStats struct {
 	StorageSaved        int64   `json:"storageSaved"`
 	StorageSavedPercent float64 `json:"storageSavedPercent"`
 	CostSavingsUSD      float64 `json:"costSavingsUSD"`
+	// CostPerGBMonthUSD is the storage price the savings estimate assumes
+	CostPerGBMonthUSD float64 `json:"costPerGBMonthUSD"`
 }
 
 // UserStats represents statistics for a specific user
@@ -62,18 +65,43 @@ type AdminService struct {
 	userRepo         *repositories.UserRepository
 	fileRepo         *repositories.FileRepository
 	fileHashRepo     *repositories.FileHashRepository
+	fileShareRepo    *repositories.FileShareRepository
+	uploadMetrics    *repositories.UploadMetricsRepository
 	s3Service        *S3Service
 	websocketService *WebSocketService
+
+	// Storage price used to estimate deduplication savings
+	storageCostPerGBMonth float64
+	// Days download logs are kept before being rolled up into daily totals; 0 keeps them forever
+	downloadLogRetentionDays int
+	// Upload idempotency keys removed once older than idempotencyTTL; nil keeps them
+	idempotencyKeys UploadIdempotencyPruner
+	idempotencyTTL  time.Duration
 }
 
+// DefaultStorageCostPerGBMonth is the S3 Standard price in USD per GB-month
+const DefaultStorageCostPerGBMonth = 0.023
+
 // NewAdminService creates a new admin service
-func NewAdminService(userRepo *repositories.UserRepository, fileRepo *repositories.FileRepository, fileHashRepo *repositories.FileHashRepository, s3Service *S3Service, websocketService *WebSocketService) *AdminService {
+func NewAdminService(userRepo *repositories.UserRepository, fileRepo *repositories.FileRepository, fileHashRepo *repositories.FileHashRepository, fileShareRepo *repositories.FileShareRepository, uploadMetrics *repositories.UploadMetricsRepository, s3Service *S3Service, websocketService *WebSocketService) *AdminService {
 	return &AdminService{
 		userRepo:         userRepo,
 		fileRepo:         fileRepo,
 		fileHashRepo:     fileHashRepo,
+		fileShareRepo:    fileShareRepo,
+		uploadMetrics:    uploadMetrics,
 		s3Service:        s3Service,
 		websocketService: websocketService,
+
+		storageCostPerGBMonth: DefaultStorageCostPerGBMonth,
+	}
+}
+
+// SetStorageCostPerGBMonth sets the storage price in USD per GB-month used to estimate
+// deduplication savings, since it varies by region and storage class
+func (s *AdminService) SetStorageCostPerGBMonth(rate float64) {
+	if rate >= 0 {
+		s.storageCostPerGBMonth = rate
 	}
 }
 
@@ -244,6 +272,68 @@ func (s *AdminService) DeleteUser(userID uuid.UUID) error {
 	return nil
 }
 
+// TransferFiles reassigns all of a user's files and folders to another user, for example when an
+// employee leaves. The items land in a "Transferred from <username>" folder in the recipient's
+// library and any shares the old owner made stay manageable by the recipient.
+func (s *AdminService) TransferFiles(fromUserID, toUserID uuid.UUID) (int, error) {
+	if fromUserID == toUserID {
+		return 0, fmt.Errorf("cannot transfer files to the same user")
+	}
+
+	fromUser, err := s.userRepo.GetByID(fromUserID)
+	if err != nil {
+		return 0, fmt.Errorf("source user not found: %w", err)
+	}
+	if _, err := s.userRepo.GetByID(toUserID); err != nil {
+		return 0, fmt.Errorf("target user not found: %w", err)
+	}
+
+	count, unusedKeys, err := s.fileRepo.TransferAllFiles(fromUserID, toUserID, "Transferred from "+fromUser.Username)
+	if err != nil {
+		return 0, err
+	}
+	s.deleteUnusedObjects(unusedKeys)
+
+	log.Printf("Transferred %d files from user %s to user %s", count, fromUserID, toUserID)
+	return count, nil
+}
+
+// TransferFile reassigns a single file to another user, placing it in their root folder
+func (s *AdminService) TransferFile(fileID, toUserID uuid.UUID) error {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return fmt.Errorf("file not found: %w", err)
+	}
+	if file.UploaderID == toUserID {
+		return fmt.Errorf("file is already owned by this user")
+	}
+	if _, err := s.userRepo.GetByID(toUserID); err != nil {
+		return fmt.Errorf("target user not found: %w", err)
+	}
+
+	unusedKeys, err := s.fileRepo.TransferFile(fileID, toUserID)
+	if err != nil {
+		return err
+	}
+	s.deleteUnusedObjects(unusedKeys)
+
+	log.Printf("Transferred file %s from user %s to user %s", fileID, file.UploaderID, toUserID)
+	return nil
+}
+
+// deleteUnusedObjects removes S3 objects a transfer left without any file, because the recipient
+// already stored the same content
+func (s *AdminService) deleteUnusedObjects(keys []string) {
+	if s.s3Service == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := s.s3Service.DeleteFile(context.Background(), key); err != nil {
+			log.Printf("ERROR: Failed to delete unused S3 object %s: %v", key, err)
+		}
+	}
+}
+
 // UpdateUserRole updates a user's role
 func (s *AdminService) UpdateUserRole(userID uuid.UUID, role string) error {
 	if role != models.RoleUser && role != models.RoleAdmin {
@@ -258,8 +348,22 @@ func (s *AdminService) UpdateUserRole(userID uuid.UUID, role string) error {
 	return nil
 }
 
+// SetUserQuota overrides a user's storage quota in MB, taking precedence over their role's
+// default. A negative quota means unlimited and nil returns the user to the role default.
+func (s *AdminService) SetUserQuota(userID uuid.UUID, quotaMB *int64) error {
+	if quotaMB != nil && *quotaMB < 0 {
+		unlimited := UnlimitedQuotaMB
+		quotaMB = &unlimited
+	}
+
+	if err := s.userRepo.SetStorageQuotaOverride(userID, quotaMB); err != nil {
+		return fmt.Errorf("failed to update user quota: %w", err)
+	}
+	return nil
+}
+
 // GetSystemHealth returns system health metrics
-func (s *AdminService) GetSystemHealth() (*SystemHealth, error) {
+func (s *AdminService) GetSystemHealth(ctx context.Context) (*SystemHealth, error) {
 	health := &SystemHealth{}
 
 	// Check database health
@@ -271,7 +375,7 @@ func (s *AdminService) GetSystemHealth() (*SystemHealth, error) {
 	}
 
 	// Check AWS S3 storage health
-	if err := s.checkStorageHealth(); err != nil {
+	if err := s.checkStorageHealth(ctx); err != nil {
 		health.StorageStatus = "unhealthy"
 		fmt.Printf("Storage health check failed: %v\n", err)
 	} else {
@@ -298,14 +402,14 @@ func (s *AdminService) checkDatabaseHealth() error {
 }
 
 // checkStorageHealth verifies AWS S3 connectivity
-func (s *AdminService) checkStorageHealth() error {
+func (s *AdminService) checkStorageHealth(ctx context.Context) error {
 	if s.s3Service == nil {
 		return fmt.Errorf("S3 service not initialized")
 	}
 
 	// Try to check if a non-existent file exists as a health check
 	// This is a lightweight operation that verifies connectivity
-	_, err := s.s3Service.FileExists(context.Background(), "health-check-test-file-that-does-not-exist")
+	_, err := s.s3Service.FileExists(ctx, "health-check-test-file-that-does-not-exist")
 	// We expect this to return false with no error, which means S3 is accessible
 	return err
 }
@@ -322,7 +426,7 @@ func (s *AdminService) IsAdmin(userID uuid.UUID) (bool, error) {
 
 // calculateDeduplicationStats calculates deduplication savings metrics
 func (s *AdminService) calculateDeduplicationStats() (*DeduplicationStats, error) {
-	stats := &DeduplicationStats{}
+	stats := &DeduplicationStats{CostPerGBMonthUSD: s.storageCostPerGBMonth}
 
 	// Get total file records
 	totalFileRecords, err := s.fileRepo.GetTotalFiles()
@@ -363,10 +467,14 @@ func (s *AdminService) calculateDeduplicationStats() (*DeduplicationStats, error
 			stats.StorageSavedPercent = float64(stats.StorageSaved) / float64(totalStorage) * 100
 		}
 
-		// Calculate cost savings (assuming $0.023 per GB per month for S3)
-		storageSavedGB := float64(stats.StorageSaved) / (1024 * 1024 * 1024)
-		stats.CostSavingsUSD = storageSavedGB * 0.023 // $0.023 per GB per month
+		// Calculate monthly cost savings at the configured storage price
+		stats.CostSavingsUSD = monthlyStorageCostUSD(stats.StorageSaved, s.storageCostPerGBMonth)
 	}
 
 	return stats, nil
 }
+
+// monthlyStorageCostUSD prices a number of bytes at a rate in USD per GB-month
+func monthlyStorageCostUSD(bytes int64, ratePerGBMonth float64) float64 {
+	return float64(bytes) / (1024 * 1024 * 1024) * ratePerGBMonth
+}
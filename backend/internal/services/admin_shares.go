@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAdminSharesLimit = 20
+	maxAdminSharesLimit     = 100
+)
+
+// GetAllShares lists public shares across all users, newest first, so admins can find and
+// take down abusive links
+func (s *AdminService) GetAllShares(limit, offset int, filter models.AdminShareFilter) ([]*models.AdminFileShare, error) {
+	if limit <= 0 {
+		limit = defaultAdminSharesLimit
+	}
+	if limit > maxAdminSharesLimit {
+		limit = maxAdminSharesLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.fileShareRepo.GetAllForAdmin(filter, limit, offset)
+}
+
+// RevokeShare deactivates any user's share. The share is kept, so its owner can still see
+// it and its download history.
+func (s *AdminService) RevokeShare(shareID uuid.UUID) error {
+	if err := s.fileShareRepo.Deactivate(shareID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Admin revoked file share %s\n", shareID)
+	return nil
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferFiles_RejectsSameUser(t *testing.T) {
+	service := &AdminService{}
+	userID := uuid.New()
+
+	count, err := service.TransferFiles(userID, userID)
+	assert.EqualError(t, err, "cannot transfer files to the same user")
+	assert.Zero(t, count)
+}
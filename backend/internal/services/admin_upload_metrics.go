@@ -0,0 +1,63 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"filevault/internal/models"
+)
+
+const (
+	defaultUploadMetricsDays = 7
+	maxUploadMetricsDays     = 365
+)
+
+// UploadMetrics summarizes upload attempts over the last SinceDays days, today included
+type UploadMetrics struct {
+	SinceDays          int     `json:"sinceDays"`
+	Attempts           int64   `json:"attempts"`
+	Successes          int64   `json:"successes"`
+	Failures           int64   `json:"failures"`
+	FailureRatePercent float64 `json:"failureRatePercent"`
+	// FailureReasons counts failures by reason, most frequent first
+	FailureReasons []models.UploadOutcomeCount `json:"failureReasons"`
+}
+
+// GetUploadMetrics reports how many uploads succeeded and why the rest failed over the last
+// sinceDays days, so spikes in S3 errors or MIME rejections stand out
+func (s *AdminService) GetUploadMetrics(sinceDays int) (*UploadMetrics, error) {
+	if sinceDays <= 0 {
+		sinceDays = defaultUploadMetricsDays
+	}
+	if sinceDays > maxUploadMetricsDays {
+		sinceDays = maxUploadMetricsDays
+	}
+
+	counts, err := s.uploadMetrics.GetOutcomeCounts(time.Now().AddDate(0, 0, -(sinceDays - 1)))
+	if err != nil {
+		return nil, err
+	}
+	return summarizeUploadMetrics(sinceDays, counts), nil
+}
+
+// summarizeUploadMetrics totals outcome counts into successes, failures and a failure rate
+func summarizeUploadMetrics(sinceDays int, counts []models.UploadOutcomeCount) *UploadMetrics {
+	metrics := &UploadMetrics{SinceDays: sinceDays, FailureReasons: []models.UploadOutcomeCount{}}
+	for _, count := range counts {
+		metrics.Attempts += count.Count
+		if count.Outcome == UploadOutcomeSuccess {
+			metrics.Successes += count.Count
+			continue
+		}
+		metrics.Failures += count.Count
+		metrics.FailureReasons = append(metrics.FailureReasons, count)
+	}
+
+	sort.SliceStable(metrics.FailureReasons, func(i, j int) bool {
+		return metrics.FailureReasons[i].Count > metrics.FailureReasons[j].Count
+	})
+	if metrics.Attempts > 0 {
+		metrics.FailureRatePercent = float64(metrics.Failures) / float64(metrics.Attempts) * 100
+	}
+	return metrics
+}
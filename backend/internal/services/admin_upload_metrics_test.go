@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeUploadMetrics(t *testing.T) {
+	metrics := summarizeUploadMetrics(7, []models.UploadOutcomeCount{
+		{Outcome: UploadFailureMimeRejected, Count: 2},
+		{Outcome: UploadFailureStorageError, Count: 6},
+		{Outcome: UploadOutcomeSuccess, Count: 32},
+	})
+
+	assert.Equal(t, 7, metrics.SinceDays)
+	assert.EqualValues(t, 40, metrics.Attempts)
+	assert.EqualValues(t, 32, metrics.Successes)
+	assert.EqualValues(t, 8, metrics.Failures)
+	assert.InDelta(t, 20.0, metrics.FailureRatePercent, 0.001)
+	assert.Equal(t, []models.UploadOutcomeCount{
+		{Outcome: UploadFailureStorageError, Count: 6},
+		{Outcome: UploadFailureMimeRejected, Count: 2},
+	}, metrics.FailureReasons)
+}
+
+func TestSummarizeUploadMetrics_NoUploads(t *testing.T) {
+	metrics := summarizeUploadMetrics(1, nil)
+
+	assert.Zero(t, metrics.Attempts)
+	assert.Zero(t, metrics.FailureRatePercent)
+	assert.NotNil(t, metrics.FailureReasons)
+}
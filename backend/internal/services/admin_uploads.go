@@ -0,0 +1,28 @@
+package services
+
+import "filevault/internal/models"
+
+const (
+	defaultRecentUploadsLimit = 20
+	maxRecentUploadsLimit     = 100
+)
+
+// GetRecentUploads lists the latest uploads across all users, newest first, for the admin
+// activity feed
+func (s *AdminService) GetRecentUploads(limit int) ([]*models.File, error) {
+	if limit <= 0 {
+		limit = defaultRecentUploadsLimit
+	}
+	if limit > maxRecentUploadsLimit {
+		limit = maxRecentUploadsLimit
+	}
+
+	files, err := s.fileRepo.GetRecentUploads(limit)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		files = []*models.File{}
+	}
+	return files, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ErrArchiveRejected is returned for uploaded archives that look like decompression bombs
+var ErrArchiveRejected = errors.New("archive rejected as a possible decompression bomb")
+
+// archiveRatioMinBytes is how much an archive must expand to before its compression ratio is
+// checked, so small archives of very compressible files aren't rejected
+const archiveRatioMinBytes = 1 << 20
+
+// ArchiveLimits bounds what a ZIP-based upload (zip, docx, jar, ...) may expand to, going by the
+// sizes listed in its central directory. A zero field disables that check.
+type ArchiveLimits struct {
+	// MaxCompressionRatio is the largest allowed total uncompressed size over compressed size
+	MaxCompressionRatio int64
+	// MaxUncompressedBytes is the largest allowed total uncompressed size of all entries
+	MaxUncompressedBytes int64
+}
+
+// Enabled reports whether any archive check is configured
+func (l ArchiveLimits) Enabled() bool {
+	return l.MaxCompressionRatio > 0 || l.MaxUncompressedBytes > 0
+}
+
+// SetArchiveLimits enables inspecting ZIP-based uploads for decompression bombs
+func (s *FileService) SetArchiveLimits(limits ArchiveLimits) {
+	s.archiveLimits = limits
+}
+
+// isZipArchive reports whether detected content is a ZIP or a format built on it
+func isZipArchive(detected *mimetype.MIME) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is("application/zip") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckArchive reads the central directory of a ZIP-based file and rejects it when the listed
+// entries would expand past the limits. Nothing is decompressed, and since the directory can
+// understate sizes, anything that later extracts the archive must still cap what it reads.
+// Content that isn't a readable ZIP is left to the other upload checks.
+func CheckArchive(r io.ReaderAt, size int64, detected *mimetype.MIME, limits ArchiveLimits) error {
+	if !limits.Enabled() || !isZipArchive(detected) {
+		return nil
+	}
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		fmt.Printf("WARNING: Could not read ZIP central directory: %v\n", err)
+		return nil
+	}
+
+	var compressed, uncompressed uint64
+	for _, entry := range archive.File {
+		compressed += entry.CompressedSize64
+		uncompressed += entry.UncompressedSize64
+		if uncompressed < entry.UncompressedSize64 {
+			return fmt.Errorf("%w: entry sizes overflow", ErrArchiveRejected)
+		}
+	}
+
+	if limits.MaxUncompressedBytes > 0 && uncompressed > uint64(limits.MaxUncompressedBytes) {
+		return fmt.Errorf("%w: expands to %d bytes (max: %d bytes)", ErrArchiveRejected, uncompressed, limits.MaxUncompressedBytes)
+	}
+	if limits.MaxCompressionRatio > 0 && uncompressed > archiveRatioMinBytes {
+		// An entry claiming content with no compressed bytes has an unbounded ratio
+		if compressed == 0 || uncompressed/compressed > uint64(limits.MaxCompressionRatio) {
+			return fmt.Errorf("%w: compression ratio exceeds %d:1", ErrArchiveRejected, limits.MaxCompressionRatio)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testArchiveLimits = ArchiveLimits{MaxCompressionRatio: 100, MaxUncompressedBytes: 1 << 30}
+
+// craftedBombZip returns a ZIP whose central directory claims 100 bytes inflate to 10 GB
+func craftedBombZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	entry, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "bomb.bin",
+		Method:             zip.Deflate,
+		CompressedSize64:   100,
+		UncompressedSize64: 10 << 30,
+	})
+	require.NoError(t, err)
+	_, err = entry.Write(make([]byte, 100))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// buildZip compresses the given entries into a ZIP
+func buildZip(t *testing.T, entries map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range entries {
+		entry, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = entry.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func checkArchiveBytes(content []byte, limits ArchiveLimits) error {
+	return CheckArchive(bytes.NewReader(content), int64(len(content)), mimetype.Detect(content), limits)
+}
+
+func TestCheckArchive_RejectsCraftedHighRatioHeader(t *testing.T) {
+	bomb := craftedBombZip(t)
+
+	assert.ErrorIs(t, checkArchiveBytes(bomb, testArchiveLimits), ErrArchiveRejected)
+	assert.ErrorIs(t, checkArchiveBytes(bomb, ArchiveLimits{MaxCompressionRatio: 100}), ErrArchiveRejected)
+	assert.ErrorIs(t, checkArchiveBytes(bomb, ArchiveLimits{MaxUncompressedBytes: 1 << 30}), ErrArchiveRejected)
+	assert.NoError(t, checkArchiveBytes(bomb, ArchiveLimits{}))
+}
+
+func TestCheckArchive_RejectsHighlyCompressedContent(t *testing.T) {
+	zeros := buildZip(t, map[string][]byte{"zeros.bin": make([]byte, 8<<20)})
+
+	assert.ErrorIs(t, checkArchiveBytes(zeros, testArchiveLimits), ErrArchiveRejected)
+	assert.NoError(t, checkArchiveBytes(zeros, ArchiveLimits{MaxUncompressedBytes: 1 << 30}))
+}
+
+func TestCheckArchive_AllowsOrdinaryArchivesAndOtherFiles(t *testing.T) {
+	ordinary := buildZip(t, map[string][]byte{
+		"readme.txt": []byte("quarterly figures attached"),
+		"empty.txt":  {},
+	})
+	assert.NoError(t, checkArchiveBytes(ordinary, testArchiveLimits))
+	assert.NoError(t, checkArchiveBytes([]byte("just some notes"), testArchiveLimits))
+}
+
+func TestFileService_UploadFile_RejectsArchiveBomb(t *testing.T) {
+	service := NewFileService(new(MockFileRepository), new(MockFileHashRepository), nil, nil, nil, NewMimeValidationService(), nil, nil)
+	service.SetArchiveLimits(testArchiveLimits)
+
+	file, header, _ := newUploadFixture("bomb.zip", craftedBombZip(t))
+	header.Header.Set("Content-Type", "application/zip")
+
+	// Nothing is looked up or stored, or the mocks would panic on unexpected calls
+	_, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrArchiveRejected)
+	assert.Equal(t, UploadFailureArchiveRejected, UploadFailureReason(err))
+}
@@ -1,9 +1,14 @@
 package services
 
 import (
+	"database/sql"
+	_ "embed"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
+	"unicode"
 
 	"filevault/internal/models"
 	"filevault/internal/repositories"
@@ -12,22 +17,113 @@ import (
 	"github.com/google/uuid"
 )
 
+// invalidCredentialsMessage is returned for any failed login, whether the account was
+// missing or the password was wrong
+const invalidCredentialsMessage = "Invalid email, username or password. Please check your credentials and try again."
+
+// defaultTokenExpiry is used when TokenConfig.Expiry is not set
+const defaultTokenExpiry = 24 * time.Hour
+
+// TokenConfig controls the lifetime and standard claims of issued JWTs
+type TokenConfig struct {
+	Expiry   time.Duration
+	Issuer   string
+	Audience string
+	// AllowLegacyTokens accepts tokens without iss/aud claims, issued before they were added
+	AllowLegacyTokens bool
+	// IdleTimeout rejects tokens that haven't been used for this long, even before they
+	// expire; each use slides the window forward. Zero disables the check.
+	IdleTimeout time.Duration
+}
+
+// ErrSessionIdle is returned for a token whose session has been inactive longer than the idle timeout
+var ErrSessionIdle = errors.New("session expired due to inactivity")
+
+// sessionTouchInterval limits how often a session's last activity is written, so a burst of
+// requests doesn't cost a database write each
+const sessionTouchInterval = time.Minute
+
+// SessionStore tracks the last activity of each issued token by its jti claim
+type SessionStore interface {
+	GetLastSeen(tokenID string) (*time.Time, error)
+	Touch(tokenID string, userID uuid.UUID, seenAt time.Time) error
+	DeleteUserSessionsNotSeenSince(userID uuid.UUID, before time.Time) error
+}
+
+// DefaultFolderCreator creates a new user's default folders within the transaction creating the user
+type DefaultFolderCreator interface {
+	CreateDefaultFolders(exec repositories.Execer, ownerID uuid.UUID, paths []string) ([]*models.Folder, error)
+}
+
 // AuthService handles authentication and authorization
 type AuthService struct {
-	userRepo  *repositories.UserRepository
-	jwtSecret string
+	userRepo    *repositories.UserRepository
+	jwtSecret   string
+	tokenConfig TokenConfig
+	sessions    SessionStore
+	now         func() time.Time
+
+	passwordPolicy PasswordPolicy
+
+	folderCreator  DefaultFolderCreator
+	defaultFolders []string
+
+	lockout          *loginLockout
+	securityNotifier SecurityNotifier
+	emailSender      EmailSender
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo *repositories.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo *repositories.UserRepository, jwtSecret string, tokenConfig TokenConfig) *AuthService {
+	if tokenConfig.Expiry <= 0 {
+		tokenConfig.Expiry = defaultTokenExpiry
+	}
+
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:    userRepo,
+		jwtSecret:   jwtSecret,
+		tokenConfig: tokenConfig,
+		now:         time.Now,
+
+		passwordPolicy: DefaultPasswordPolicy,
 	}
 }
 
-// RegisterUser registers a new user
+// SetSessionStore enables the idle timeout, tracking token activity in the given store
+func (s *AuthService) SetSessionStore(store SessionStore) {
+	s.sessions = store
+}
+
+// SetPasswordPolicy sets the rules new passwords must meet at registration and password change
+func (s *AuthService) SetPasswordPolicy(policy PasswordPolicy) {
+	s.passwordPolicy = policy
+}
+
+// SetLoginLockout locks accounts after repeated failed logins. When the policy asks for it, the
+// owner is told through notifier and emailSender, either of which may be nil.
+func (s *AuthService) SetLoginLockout(policy LoginLockoutPolicy, notifier SecurityNotifier, emailSender EmailSender) {
+	if policy.MaxFailures <= 0 || policy.Window <= 0 {
+		s.lockout = nil
+		return
+	}
+	s.lockout = newLoginLockout(policy)
+	s.securityNotifier = notifier
+	s.emailSender = emailSender
+}
+
+// SetDefaultFolders makes registration create the given folders (paths from ParseDefaultFolders)
+// for every new user; no paths means new users start without folders
+func (s *AuthService) SetDefaultFolders(creator DefaultFolderCreator, paths []string) {
+	s.folderCreator = creator
+	s.defaultFolders = paths
+}
+
+// RegisterUser registers a new user, along with the default folders if any are configured
 func (s *AuthService) RegisterUser(email, username, password string) (*models.User, error) {
+	if err := s.passwordPolicy.Validate(password); err != nil {
+		return nil, err
+	}
+
 	// Check if user already exists
 	existingUser, _ := s.userRepo.GetByEmail(email)
 	if existingUser != nil {
@@ -50,9 +146,18 @@ func (s *AuthService) RegisterUser(email, username, password string) (*models.Us
 		UpdatedAt: time.Now(),
 	}
 
-	// Save user to database
-	err := s.userRepo.Create(user)
+	// Save user to database; the user isn't created if its default folders can't be
+	var err error
+	if len(s.defaultFolders) > 0 && s.folderCreator != nil {
+		err = s.userRepo.CreateWithSetup(user, func(tx *sql.Tx) error {
+			_, err := s.folderCreator.CreateDefaultFolders(tx, user.ID, s.defaultFolders)
+			return err
+		})
+	} else {
+		err = s.userRepo.Create(user)
+	}
 	if err != nil {
+		log.Printf("Failed to register user %s: %v", username, err)
 		return nil, fmt.Errorf("Failed to create account. Please try again.")
 	}
 
@@ -62,18 +167,44 @@ func (s *AuthService) RegisterUser(email, username, password string) (*models.Us
 	return user, nil
 }
 
-// LoginUser authenticates a user and returns a JWT token
-func (s *AuthService) LoginUser(email, password string) (string, *models.User, error) {
-	// Get user by email
-	user, err := s.userRepo.GetByEmail(email)
+// LoginUser authenticates a user by email or username and returns a JWT token. clientIP is
+// where the attempt came from, reported to the owner if it locks their account.
+func (s *AuthService) LoginUser(identifier, password, clientIP string) (string, *models.User, error) {
+	// Get user by email or username; the error is the same either way so it doesn't reveal
+	// whether the account exists or which field matched
+	identifier = strings.TrimSpace(identifier)
+	now := s.now()
+	user, err := s.userRepo.GetByEmailOrUsername(identifier)
 	if err != nil {
-		return "", nil, fmt.Errorf("Invalid email or password. Please check your credentials and try again.")
+		// Unknown identifiers are locked out after as many failures as accounts are, so the lock
+		// message doesn't reveal which accounts exist either
+		if s.lockout != nil {
+			if s.lockout.locked(unknownLoginID(identifier), now) {
+				return "", nil, ErrAccountLocked
+			}
+			s.lockout.recordFailure(unknownLoginID(identifier), now)
+		}
+		return "", nil, errors.New(invalidCredentialsMessage)
+	}
+
+	// A locked account refuses even the right password until the lock runs out
+	if s.lockout != nil && s.lockout.locked(user.ID, now) {
+		return "", nil, ErrAccountLocked
 	}
 
 	// Verify password
 	err = s.userRepo.VerifyPassword(user, password)
 	if err != nil {
-		return "", nil, fmt.Errorf("Invalid email or password. Please check your credentials and try again.")
+		if s.lockout != nil && s.lockout.recordFailure(user.ID, now) {
+			log.Printf("Locked account %s after repeated failed logins, last from %s", user.ID, clientIP)
+			if s.lockout.policy.Notify {
+				go s.notifyLockout(user.ID, user.Email, clientIP, now)
+			}
+		}
+		return "", nil, errors.New(invalidCredentialsMessage)
+	}
+	if s.lockout != nil {
+		s.lockout.reset(user.ID)
 	}
 
 	// Generate JWT token
@@ -90,13 +221,22 @@ func (s *AuthService) LoginUser(email, password string) (string, *models.User, e
 
 // GenerateToken generates a JWT token for a user
 func (s *AuthService) GenerateToken(user *models.User) (string, error) {
+	now := s.now()
+	tokenID := uuid.New().String()
 	claims := jwt.MapClaims{
 		"user_id":  user.ID.String(),
 		"email":    user.Email,
 		"username": user.Username,
 		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
-		"iat":      time.Now().Unix(),
+		"exp":      now.Add(s.tokenConfig.Expiry).Unix(),
+		"iat":      now.Unix(),
+		"jti":      tokenID, // Unique per token for auditing, revocation and idle tracking
+	}
+	if s.tokenConfig.Issuer != "" {
+		claims["iss"] = s.tokenConfig.Issuer
+	}
+	if s.tokenConfig.Audience != "" {
+		claims["aud"] = s.tokenConfig.Audience
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -105,11 +245,43 @@ func (s *AuthService) GenerateToken(user *models.User) (string, error) {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
 
+	if s.idleTimeoutEnabled() {
+		if err := s.sessions.Touch(tokenID, user.ID, now); err != nil {
+			return "", fmt.Errorf("failed to start session: %w", err)
+		}
+		// Sessions idle past the timeout or whose tokens have expired can't be used again
+		staleBefore := now.Add(-(s.tokenConfig.Expiry + s.tokenConfig.IdleTimeout))
+		if err := s.sessions.DeleteUserSessionsNotSeenSince(user.ID, staleBefore); err != nil {
+			log.Printf("WARNING: Failed to prune stale sessions for user %s: %v", user.ID, err)
+		}
+	}
+
 	return tokenString, nil
 }
 
 // ValidateToken validates a JWT token and returns the user
 func (s *AuthService) ValidateToken(tokenString string) (*models.User, error) {
+	user, _, err := s.validateToken(tokenString)
+	return user, err
+}
+
+// ValidateTokenWithExpiry validates a token like ValidateToken and also returns when it expires,
+// the zero time if it doesn't. Long-lived connections use it to know when to ask for a new token.
+func (s *AuthService) ValidateTokenWithExpiry(tokenString string) (*models.User, time.Time, error) {
+	user, claims, err := s.validateToken(tokenString)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var expiresAt time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expiresAt = exp.Time
+	}
+	return user, expiresAt, nil
+}
+
+// validateToken validates a token and returns its user along with its claims
+func (s *AuthService) validateToken(tokenString string) (*models.User, jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -119,26 +291,40 @@ func (s *AuthService) ValidateToken(tokenString string) (*models.User, error) {
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("invalid token: %w", err)
+		return nil, nil, fmt.Errorf("invalid token: %w", err)
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return nil, errors.New("invalid token claims")
+		return nil, nil, errors.New("invalid token claims")
+	}
+
+	if err := s.checkIssuerAndAudience(claims); err != nil {
+		return nil, nil, err
 	}
 
-	// Extract user data directly from JWT claims to avoid database query
+	// The user comes from the claims; only the revocation and idle checks below read the database
 	userIDStr, ok := claims["user_id"].(string)
 	if !ok {
-		return nil, errors.New("invalid user ID in token")
+		return nil, nil, errors.New("invalid user ID in token")
 	}
 
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID format: %w", err)
+		return nil, nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	// Create user object from JWT claims instead of database query
+	// Reject tokens issued before the user's sessions were revoked
+	if err := s.checkTokenNotRevoked(userID, claims); err != nil {
+		return nil, nil, err
+	}
+
+	// Reject sessions left idle too long, and slide the window forward for active ones
+	if err := s.checkSessionActive(userID, claims); err != nil {
+		return nil, nil, err
+	}
+
+	// Create user object from JWT claims instead of loading the user
 	user := &models.User{
 		ID:       userID,
 		Email:    claims["email"].(string),
@@ -147,10 +333,253 @@ func (s *AuthService) ValidateToken(tokenString string) (*models.User, error) {
 		Password: "", // Never include password in response
 	}
 
+	return user, claims, nil
+}
+
+// ChangePassword changes a user's password after verifying the current one.
+// When revokeSessions is true, all previously issued tokens stop working.
+func (s *AuthService) ChangePassword(userID uuid.UUID, oldPassword, newPassword string, revokeSessions bool) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	if err := s.userRepo.VerifyPassword(user, oldPassword); err != nil {
+		return fmt.Errorf("Current password is incorrect.")
+	}
+
+	if err := s.passwordPolicy.Validate(newPassword); err != nil {
+		return err
+	}
+
+	if oldPassword == newPassword {
+		return fmt.Errorf("New password must be different from the current password.")
+	}
+
+	if err := s.userRepo.UpdatePassword(userID, newPassword); err != nil {
+		return fmt.Errorf("Failed to change password. Please try again.")
+	}
+
+	if revokeSessions {
+		if err := s.userRepo.RevokeTokens(userID); err != nil {
+			return fmt.Errorf("password changed but failed to sign out other sessions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateProfile changes a user's username, ensuring it is not taken by someone else, and their
+// deduplication opt-out when dedupOptOut is given
+func (s *AuthService) UpdateProfile(userID uuid.UUID, username string, dedupOptOut *bool) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if len(username) < 3 || len(username) > 100 {
+		return nil, fmt.Errorf("Username must be between 3 and 100 characters.")
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if username != user.Username {
+		existingUser, _ := s.userRepo.GetByUsername(username)
+		if existingUser != nil && existingUser.ID != userID {
+			return nil, fmt.Errorf("This username is already taken. Please choose a different username.")
+		}
+	}
+
+	user.Username = username
+	if dedupOptOut != nil {
+		user.DedupOptOut = *dedupOptOut
+	}
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, fmt.Errorf("Failed to update profile. Please try again.")
+	}
+
+	// Clear password from response
+	user.Password = ""
+
 	return user, nil
 }
 
-// RefreshToken generates a new token for an existing user
-func (s *AuthService) RefreshToken(user *models.User) (string, error) {
+// maxPasswordLength is the most bcrypt uses; everything past 72 bytes is ignored
+const maxPasswordLength = 72
+
+// PasswordPolicy is the set of rules a new password must meet
+type PasswordPolicy struct {
+	MinLength int
+	// RequireMixed requires at least one letter and one number
+	RequireMixed bool
+}
+
+// DefaultPasswordPolicy is used unless SetPasswordPolicy configures another
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, RequireMixed: true}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords holds the embedded list, lowercased, for case-insensitive lookups
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+// parseCommonPasswords reads one password per line, skipping blank lines and # comments
+func parseCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+	return passwords
+}
+
+// IsCommonPassword reports whether a password is on the embedded list of frequently used passwords
+func IsCommonPassword(password string) bool {
+	return commonPasswords[strings.ToLower(password)]
+}
+
+// Validate checks a new password against the policy
+func (p PasswordPolicy) Validate(password string) error {
+	minLength := p.MinLength
+	if minLength < 1 {
+		minLength = 1
+	}
+	if len(password) < minLength {
+		return fmt.Errorf("Password must be at least %d characters long.", minLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("Password must be at most %d characters long.", maxPasswordLength)
+	}
+
+	if p.RequireMixed {
+		var hasLetter, hasDigit bool
+		for _, r := range password {
+			switch {
+			case unicode.IsLetter(r):
+				hasLetter = true
+			case unicode.IsDigit(r):
+				hasDigit = true
+			}
+		}
+		if !hasLetter || !hasDigit {
+			return fmt.Errorf("Password must contain at least one letter and one number.")
+		}
+	}
+
+	if IsCommonPassword(password) {
+		return fmt.Errorf("This password is too common. Please choose a less predictable one.")
+	}
+
+	return nil
+}
+
+// ValidatePasswordStrength checks a password against the default policy
+func ValidatePasswordStrength(password string) error {
+	return DefaultPasswordPolicy.Validate(password)
+}
+
+// RefreshToken exchanges a valid token for a new one. Tokens that are expired, revoked or whose
+// session has been idle past the timeout can't be refreshed.
+func (s *AuthService) RefreshToken(tokenString string) (string, error) {
+	user, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return "", err
+	}
 	return s.GenerateToken(user)
 }
+
+// checkIssuerAndAudience rejects tokens minted for another issuer or audience
+func (s *AuthService) checkIssuerAndAudience(claims jwt.MapClaims) error {
+	issuer, err := claims.GetIssuer()
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+	audience, err := claims.GetAudience()
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+
+	// Tokens issued before iss/aud were added carry neither claim
+	if issuer == "" && len(audience) == 0 && s.tokenConfig.AllowLegacyTokens {
+		return nil
+	}
+
+	if s.tokenConfig.Issuer != "" && issuer != s.tokenConfig.Issuer {
+		return errors.New("invalid token issuer")
+	}
+
+	if s.tokenConfig.Audience != "" {
+		for _, aud := range audience {
+			if aud == s.tokenConfig.Audience {
+				return nil
+			}
+		}
+		return errors.New("invalid token audience")
+	}
+
+	return nil
+}
+
+// checkTokenNotRevoked rejects tokens issued before the user's tokens_invalid_before timestamp
+func (s *AuthService) checkTokenNotRevoked(userID uuid.UUID, claims jwt.MapClaims) error {
+	invalidBefore, err := s.userRepo.GetTokensInvalidBefore(userID)
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+	if invalidBefore == nil {
+		return nil
+	}
+
+	issuedAt, ok := claims["iat"].(float64)
+	if !ok || int64(issuedAt) < invalidBefore.Unix() {
+		return errors.New("token has been revoked")
+	}
+
+	return nil
+}
+
+func (s *AuthService) idleTimeoutEnabled() bool {
+	return s.tokenConfig.IdleTimeout > 0 && s.sessions != nil
+}
+
+// checkSessionActive rejects a token whose session hasn't been used within the idle timeout and
+// records the current use. Sessions that aren't tracked yet (tokens issued before the timeout
+// was enabled) count as last used when the token was issued.
+func (s *AuthService) checkSessionActive(userID uuid.UUID, claims jwt.MapClaims) error {
+	if !s.idleTimeoutEnabled() {
+		return nil
+	}
+
+	tokenID, ok := claims["jti"].(string)
+	if !ok || tokenID == "" {
+		return errors.New("invalid token: missing token ID")
+	}
+
+	lastSeen, err := s.sessions.GetLastSeen(tokenID)
+	if err != nil {
+		return fmt.Errorf("invalid token: %w", err)
+	}
+	tracked := lastSeen != nil
+	if !tracked {
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil || issuedAt == nil {
+			return errors.New("invalid token: missing issue time")
+		}
+		lastSeen = &issuedAt.Time
+	}
+
+	now := s.now()
+	if now.Sub(*lastSeen) > s.tokenConfig.IdleTimeout {
+		return ErrSessionIdle
+	}
+
+	if !tracked || now.Sub(*lastSeen) >= sessionTouchInterval {
+		if err := s.sessions.Touch(tokenID, userID, now); err != nil {
+			log.Printf("WARNING: Failed to record activity for session %s: %v", tokenID, err)
+		}
+	}
+
+	return nil
+}
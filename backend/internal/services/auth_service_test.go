@@ -0,0 +1,263 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePasswordStrength(t *testing.T) {
+	assert.NoError(t, ValidatePasswordStrength("correct1horse"))
+
+	assert.Error(t, ValidatePasswordStrength("short1"))
+	assert.Error(t, ValidatePasswordStrength("onlyletters"))
+	assert.Error(t, ValidatePasswordStrength("1234567890"))
+	assert.Error(t, ValidatePasswordStrength(strings.Repeat("a1", 40)))
+}
+
+func TestValidatePasswordStrength_RejectsCommonPasswords(t *testing.T) {
+	assert.Error(t, ValidatePasswordStrength("password1"))
+	assert.Error(t, ValidatePasswordStrength("Password123"), "the list is compared case-insensitively")
+	assert.Error(t, ValidatePasswordStrength("1q2w3e4r"))
+	assert.True(t, IsCommonPassword("QWERTY123"))
+	assert.False(t, IsCommonPassword("# Frequently used passwords"), "comment lines aren't entries")
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	relaxed := PasswordPolicy{MinLength: 6, RequireMixed: false}
+	assert.NoError(t, relaxed.Validate("plainwords"))
+	assert.NoError(t, relaxed.Validate("tigers"))
+	assert.Error(t, relaxed.Validate("tiger"))
+	assert.Error(t, relaxed.Validate("123456"), "common passwords are rejected even without mixed characters")
+
+	strict := PasswordPolicy{MinLength: 12, RequireMixed: true}
+	assert.NoError(t, strict.Validate("correct1horse"))
+	err := strict.Validate("short1horse")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "at least 12 characters")
+	assert.Error(t, strict.Validate("correcthorsebattery"))
+
+	assert.Error(t, PasswordPolicy{}.Validate(""), "an empty password is never allowed")
+}
+
+func TestAuthService_RegisterUser_RejectsWeakPassword(t *testing.T) {
+	// The password is checked before the repository is touched
+	service := NewAuthService(nil, "test-secret", testTokenConfig())
+
+	_, err := service.RegisterUser("user@example.com", "user", "1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "at least 8 characters")
+
+	_, err = service.RegisterUser("user@example.com", "user", "password123")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too common")
+}
+
+func testTokenConfig() TokenConfig {
+	return TokenConfig{Expiry: time.Hour, Issuer: "filevault", Audience: "filevault-web", AllowLegacyTokens: true}
+}
+
+func testUser() *models.User {
+	return &models.User{ID: uuid.New(), Email: "user@example.com", Username: "user", Role: models.RoleUser}
+}
+
+func TestAuthService_GenerateToken_Claims(t *testing.T) {
+	service := NewAuthService(nil, "test-secret", testTokenConfig())
+
+	before := time.Now()
+	tokenString, err := service.GenerateToken(testUser())
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(tokenString, claims)
+	require.NoError(t, err)
+
+	assert.Equal(t, "filevault", claims["iss"])
+	assert.Equal(t, "filevault-web", claims["aud"])
+	assert.NotEmpty(t, claims["jti"])
+
+	exp, err := claims.GetExpirationTime()
+	require.NoError(t, err)
+	assert.WithinDuration(t, before.Add(time.Hour), exp.Time, 2*time.Second)
+
+	other, err := service.GenerateToken(testUser())
+	require.NoError(t, err)
+	otherClaims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(other, otherClaims)
+	require.NoError(t, err)
+	assert.NotEqual(t, claims["jti"], otherClaims["jti"])
+}
+
+func TestAuthService_ValidateTokenWithExpiry_RejectsInvalidToken(t *testing.T) {
+	service := NewAuthService(nil, "test-secret", testTokenConfig())
+	tokenString, err := NewAuthService(nil, "other-secret", testTokenConfig()).GenerateToken(testUser())
+	require.NoError(t, err)
+
+	user, expiresAt, err := service.ValidateTokenWithExpiry(tokenString)
+	assert.Error(t, err)
+	assert.Nil(t, user)
+	assert.True(t, expiresAt.IsZero())
+}
+
+func TestAuthService_ValidateToken_RejectsExpired(t *testing.T) {
+	cfg := testTokenConfig()
+	service := NewAuthService(nil, "test-secret", cfg)
+
+	claims := jwt.MapClaims{
+		"user_id":  uuid.New().String(),
+		"email":    "user@example.com",
+		"username": "user",
+		"role":     models.RoleUser,
+		"iss":      cfg.Issuer,
+		"aud":      cfg.Audience,
+		"iat":      time.Now().Add(-2 * time.Hour).Unix(),
+		"exp":      time.Now().Add(-time.Hour).Unix(),
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+
+	_, err = service.ValidateToken(tokenString)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestAuthService_ValidateToken_RejectsWrongIssuerOrAudience(t *testing.T) {
+	tokenString, err := NewAuthService(nil, "test-secret", TokenConfig{Issuer: "someone-else", Audience: "filevault-web"}).GenerateToken(testUser())
+	require.NoError(t, err)
+	_, err = NewAuthService(nil, "test-secret", testTokenConfig()).ValidateToken(tokenString)
+	assert.EqualError(t, err, "invalid token issuer")
+
+	tokenString, err = NewAuthService(nil, "test-secret", TokenConfig{Issuer: "filevault", Audience: "another-app"}).GenerateToken(testUser())
+	require.NoError(t, err)
+	_, err = NewAuthService(nil, "test-secret", testTokenConfig()).ValidateToken(tokenString)
+	assert.EqualError(t, err, "invalid token audience")
+}
+
+func TestAuthService_ValidateToken_LegacyTokens(t *testing.T) {
+	// Tokens from before iss/aud were added carry neither claim
+	legacy, err := NewAuthService(nil, "test-secret", TokenConfig{}).GenerateToken(testUser())
+	require.NoError(t, err)
+
+	strict := testTokenConfig()
+	strict.AllowLegacyTokens = false
+	_, err = NewAuthService(nil, "test-secret", strict).ValidateToken(legacy)
+	assert.EqualError(t, err, "invalid token issuer")
+
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(legacy, claims)
+	require.NoError(t, err)
+	assert.NoError(t, NewAuthService(nil, "test-secret", testTokenConfig()).checkIssuerAndAudience(claims))
+}
+
+// memorySessionStore is an in-memory SessionStore
+type memorySessionStore struct {
+	lastSeen map[string]time.Time
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{lastSeen: map[string]time.Time{}}
+}
+
+func (m *memorySessionStore) GetLastSeen(tokenID string) (*time.Time, error) {
+	seen, ok := m.lastSeen[tokenID]
+	if !ok {
+		return nil, nil
+	}
+	return &seen, nil
+}
+
+func (m *memorySessionStore) Touch(tokenID string, userID uuid.UUID, seenAt time.Time) error {
+	m.lastSeen[tokenID] = seenAt
+	return nil
+}
+
+func (m *memorySessionStore) DeleteUserSessionsNotSeenSince(userID uuid.UUID, before time.Time) error {
+	return nil
+}
+
+// idleTestService returns a service with a 30 minute idle timeout on a controllable clock
+func idleTestService(clock *time.Time) (*AuthService, *memorySessionStore) {
+	cfg := testTokenConfig()
+	cfg.Expiry = 24 * time.Hour
+	cfg.IdleTimeout = 30 * time.Minute
+	service := NewAuthService(nil, "test-secret", cfg)
+	store := newMemorySessionStore()
+	service.SetSessionStore(store)
+	service.now = func() time.Time { return *clock }
+	return service, store
+}
+
+func tokenClaims(t *testing.T, tokenString string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
+	require.NoError(t, err)
+	return claims
+}
+
+func TestAuthService_CheckSessionActive_RejectsIdleSession(t *testing.T) {
+	clock := time.Now()
+	service, store := idleTestService(&clock)
+	user := testUser()
+
+	tokenString, err := service.GenerateToken(user)
+	require.NoError(t, err)
+	claims := tokenClaims(t, tokenString)
+	assert.Contains(t, store.lastSeen, claims["jti"], "issuing a token starts tracking its session")
+
+	clock = clock.Add(31 * time.Minute)
+	assert.ErrorIs(t, service.checkSessionActive(user.ID, claims), ErrSessionIdle)
+}
+
+func TestAuthService_CheckSessionActive_ActivitySlidesWindow(t *testing.T) {
+	clock := time.Now()
+	service, store := idleTestService(&clock)
+	user := testUser()
+
+	tokenString, err := service.GenerateToken(user)
+	require.NoError(t, err)
+	claims := tokenClaims(t, tokenString)
+
+	// Used every 20 minutes, the session outlives the 30 minute idle window
+	for i := 0; i < 4; i++ {
+		clock = clock.Add(20 * time.Minute)
+		require.NoError(t, service.checkSessionActive(user.ID, claims))
+	}
+	assert.Equal(t, clock, store.lastSeen[claims["jti"].(string)])
+
+	clock = clock.Add(45 * time.Minute)
+	assert.ErrorIs(t, service.checkSessionActive(user.ID, claims), ErrSessionIdle)
+}
+
+func TestAuthService_CheckSessionActive_UntrackedSessionUsesIssueTime(t *testing.T) {
+	clock := time.Now()
+	service, store := idleTestService(&clock)
+	user := testUser()
+
+	// A token issued before the idle timeout was enabled has no session row
+	tokenString, err := NewAuthService(nil, "test-secret", testTokenConfig()).GenerateToken(user)
+	require.NoError(t, err)
+	claims := tokenClaims(t, tokenString)
+
+	require.NoError(t, service.checkSessionActive(user.ID, claims))
+	assert.Contains(t, store.lastSeen, claims["jti"])
+
+	delete(store.lastSeen, claims["jti"].(string))
+	clock = clock.Add(time.Hour)
+	assert.ErrorIs(t, service.checkSessionActive(user.ID, claims), ErrSessionIdle)
+}
+
+func TestAuthService_CheckSessionActive_DisabledWithoutTimeout(t *testing.T) {
+	service := NewAuthService(nil, "test-secret", testTokenConfig())
+	service.SetSessionStore(newMemorySessionStore())
+
+	claims := jwt.MapClaims{"iat": time.Now().Add(-48 * time.Hour).Unix()}
+	assert.NoError(t, service.checkSessionActive(uuid.New(), claims))
+}
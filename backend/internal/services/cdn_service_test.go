@@ -0,0 +1,108 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCDNKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// verifyCloudFrontURL checks a signed URL's canned policy signature as CloudFront would
+func verifyCloudFrontURL(t *testing.T, signedURL string, public *rsa.PublicKey) url.Values {
+	parsed, err := url.Parse(signedURL)
+	require.NoError(t, err)
+	query := parsed.Query()
+
+	cut := strings.Index(signedURL, "Expires=")
+	require.Positive(t, cut)
+	resource := strings.TrimRight(signedURL[:cut], "?&")
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%s}}}]}`, resource, query.Get("Expires"))
+
+	signature, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Signature")))
+	require.NoError(t, err)
+	digest := sha1.Sum([]byte(policy))
+	require.NoError(t, rsa.VerifyPKCS1v15(public, crypto.SHA1, digest[:], signature))
+	return query
+}
+
+func TestCDNService_SignedURL(t *testing.T) {
+	key, keyPEM := newTestCDNKey(t)
+	cdn, err := NewCDNService("https://cdn.example.com/", "K2JCJMDEHXQW5F", keyPEM)
+	require.NoError(t, err)
+
+	expires := time.Unix(1893456000, 0)
+	params := url.Values{"response-content-type": {"application/pdf"}}
+	signedURL, err := cdn.SignedURL("files/ab/Q1 report.pdf", params, expires)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(signedURL, "https://cdn.example.com/files/ab/Q1%20report.pdf?response-content-type="), signedURL)
+	query := verifyCloudFrontURL(t, signedURL, &key.PublicKey)
+	assert.Equal(t, "1893456000", query.Get("Expires"))
+	assert.Equal(t, "K2JCJMDEHXQW5F", query.Get("Key-Pair-Id"))
+	assert.Equal(t, "application/pdf", query.Get("response-content-type"))
+}
+
+func TestNewCDNService_KeyFormats(t *testing.T) {
+	key, pkcs1 := newTestCDNKey(t)
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes})
+
+	_, err = NewCDNService("cdn.example.com", "KEY", pkcs1)
+	assert.NoError(t, err)
+	_, err = NewCDNService("cdn.example.com", "KEY", pkcs8)
+	assert.NoError(t, err)
+
+	_, err = NewCDNService("cdn.example.com", "KEY", []byte("not a key"))
+	assert.Error(t, err)
+	_, err = NewCDNService("cdn.example.com", "", pkcs1)
+	assert.Error(t, err)
+	_, err = NewCDNService("cdn.example.com/files", "KEY", pkcs1)
+	assert.Error(t, err)
+}
+
+func TestFileShareService_DirectShareURL_PrefersCDN(t *testing.T) {
+	key, keyPEM := newTestCDNKey(t)
+	cdn, err := NewCDNService("cdn.example.com", "KEY", keyPEM)
+	require.NoError(t, err)
+
+	service, err := NewFileShareService(
+		nil, nil, nil, nil, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
+		nil, nil, 0,
+	)
+	require.NoError(t, err)
+	file := &models.File{ID: uuid.New(), S3Key: "files/pdf", OriginalName: "report.pdf", MimeType: "application/pdf"}
+	share := &models.FileShare{ID: uuid.New(), ShareToken: "token", IsActive: true}
+
+	presigned, err := service.directShareURL(share, file)
+	require.NoError(t, err)
+	assert.Contains(t, presigned, "X-Amz-Signature=")
+
+	service.SetCDN(cdn)
+	signedURL, err := service.directShareURL(share, file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signedURL, "https://cdn.example.com/files/pdf?"), signedURL)
+	query := verifyCloudFrontURL(t, signedURL, &key.PublicKey)
+	assert.Equal(t, ContentDisposition("inline", "report.pdf"), query.Get("response-content-disposition"))
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"filevault/internal/models"
+	"filevault/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// maxCommentLength caps the size of a single file comment, in characters
+const maxCommentLength = 5000
+
+// FileCommentRepositoryInterface defines the comment storage used by CommentService
+type FileCommentRepositoryInterface interface {
+	Create(comment *models.FileComment) error
+	GetByID(id uuid.UUID) (*models.FileComment, error)
+	ListByFile(fileID uuid.UUID, limit, offset int) ([]*models.FileComment, error)
+	Delete(id uuid.UUID) error
+}
+
+// FileAccessChecker reports whether a user holds an access grant on a file
+type FileAccessChecker interface {
+	HasAccess(userID, fileID uuid.UUID, permission string) (bool, error)
+}
+
+// UserFileShareChecker reports whether a file has been shared in-app with a user
+type UserFileShareChecker interface {
+	CheckIfAlreadyShared(fileID, toUserID uuid.UUID) (bool, error)
+}
+
+// FolderShareAccessChecker reports whether a file lives in a folder shared in-app with a user
+type FolderShareAccessChecker interface {
+	CanAccessFileViaFolderShare(userID, fileID uuid.UUID) (bool, error)
+}
+
+// CommentService manages comments on files. Everyone who can see a file - its owner, users
+// with an access grant and users it was shared with, directly or through a folder - can read
+// and add comments.
+type CommentService struct {
+	commentRepo        FileCommentRepositoryInterface
+	fileRepo           repositories.FileRepositoryInterface
+	accessChecker      FileAccessChecker
+	shareChecker       UserFileShareChecker
+	folderShareChecker FolderShareAccessChecker
+	websocketService   *WebSocketService
+}
+
+// NewCommentService creates a new comment service
+func NewCommentService(commentRepo FileCommentRepositoryInterface, fileRepo repositories.FileRepositoryInterface, accessChecker FileAccessChecker, shareChecker UserFileShareChecker, websocketService *WebSocketService) *CommentService {
+	return &CommentService{
+		commentRepo:      commentRepo,
+		fileRepo:         fileRepo,
+		accessChecker:    accessChecker,
+		shareChecker:     shareChecker,
+		websocketService: websocketService,
+	}
+}
+
+// SetFolderShareChecker lets users comment on files in folders shared with them, the same
+// check file previews and downloads use
+func (s *CommentService) SetFolderShareChecker(checker FolderShareAccessChecker) {
+	s.folderShareChecker = checker
+}
+
+// AddComment leaves a comment on a file and notifies the owner when someone else commented
+func (s *CommentService) AddComment(fileID, userID uuid.UUID, body string) (*models.FileComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("comment is required")
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return nil, fmt.Errorf("comment must be at most %d characters", maxCommentLength)
+	}
+
+	file, err := s.requireAccess(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &models.FileComment{
+		ID:     uuid.New(),
+		FileID: fileID,
+		UserID: userID,
+		Body:   body,
+	}
+	if err := s.commentRepo.Create(comment); err != nil {
+		return nil, err
+	}
+
+	// Read the comment back for its author's username
+	if stored, err := s.commentRepo.GetByID(comment.ID); err == nil && stored != nil {
+		comment = stored
+	}
+
+	if s.websocketService != nil && file.UploaderID != userID {
+		s.websocketService.BroadcastFileCommentAdded(
+			file.UploaderID.String(),
+			file.ID.String(),
+			file.OriginalName,
+			comment.ID.String(),
+			comment.AuthorUsername,
+			comment.Body,
+		)
+	}
+
+	return comment, nil
+}
+
+// ListComments returns a page of a file's comments, oldest first
+func (s *CommentService) ListComments(fileID, userID uuid.UUID, limit, offset int) ([]*models.FileComment, error) {
+	if _, err := s.requireAccess(fileID, userID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.commentRepo.ListByFile(fileID, limit, offset)
+}
+
+// DeleteComment removes a comment; its author and the file's owner may delete it
+func (s *CommentService) DeleteComment(commentID, userID uuid.UUID) error {
+	comment, err := s.commentRepo.GetByID(commentID)
+	if err != nil {
+		return err
+	}
+	if comment == nil {
+		return fmt.Errorf("comment not found")
+	}
+
+	if comment.UserID != userID {
+		file, err := s.fileRepo.GetByID(comment.FileID)
+		if err != nil {
+			return fmt.Errorf("file not found: %w", err)
+		}
+		if file == nil || file.UploaderID != userID {
+			return fmt.Errorf("unauthorized: only the author or the file owner can delete this comment")
+		}
+	}
+
+	return s.commentRepo.Delete(commentID)
+}
+
+// requireAccess checks that the user owns the file, can read it through a shared folder, holds a
+// grant on it or had it shared with them
+func (s *CommentService) requireAccess(fileID, userID uuid.UUID) (*models.File, error) {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+	if file.UploaderID == userID {
+		return file, nil
+	}
+
+	if s.folderShareChecker != nil {
+		shared, err := s.folderShareChecker.CanAccessFileViaFolderShare(userID, fileID)
+		if err != nil {
+			return nil, err
+		}
+		if shared {
+			return file, nil
+		}
+	}
+
+	if s.accessChecker != nil {
+		granted, err := s.accessChecker.HasAccess(userID, fileID, models.FilePermissionView)
+		if err != nil {
+			return nil, err
+		}
+		if granted {
+			return file, nil
+		}
+	}
+
+	if s.shareChecker != nil {
+		shared, err := s.shareChecker.CheckIfAlreadyShared(fileID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check file share: %w", err)
+		}
+		if shared {
+			return file, nil
+		}
+	}
+
+	// Files the user can't see are reported as missing rather than forbidden
+	return nil, fmt.Errorf("file not found")
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCommentRepository keeps comments in memory, in insertion order
+type memoryCommentRepository struct {
+	comments []*models.FileComment
+}
+
+func (r *memoryCommentRepository) Create(comment *models.FileComment) error {
+	stored := *comment
+	stored.AuthorUsername = "user-" + comment.UserID.String()[:8]
+	r.comments = append(r.comments, &stored)
+	return nil
+}
+
+func (r *memoryCommentRepository) GetByID(id uuid.UUID) (*models.FileComment, error) {
+	for _, comment := range r.comments {
+		if comment.ID == id {
+			return comment, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryCommentRepository) ListByFile(fileID uuid.UUID, limit, offset int) ([]*models.FileComment, error) {
+	comments := []*models.FileComment{}
+	for _, comment := range r.comments {
+		if comment.FileID == fileID {
+			comments = append(comments, comment)
+		}
+	}
+	if offset > len(comments) {
+		offset = len(comments)
+	}
+	comments = comments[offset:]
+	if len(comments) > limit {
+		comments = comments[:limit]
+	}
+	return comments, nil
+}
+
+func (r *memoryCommentRepository) Delete(id uuid.UUID) error {
+	for i, comment := range r.comments {
+		if comment.ID == id {
+			r.comments = append(r.comments[:i], r.comments[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// fakeCommentAccess answers grant, in-app share and folder share lookups from fixed sets of users
+type fakeCommentAccess struct {
+	grantees       map[uuid.UUID]bool
+	sharedTo       map[uuid.UUID]bool
+	folderSharedTo map[uuid.UUID]bool
+}
+
+func (f *fakeCommentAccess) CanAccessFileViaFolderShare(userID, fileID uuid.UUID) (bool, error) {
+	return f.folderSharedTo[userID], nil
+}
+
+func (f *fakeCommentAccess) HasAccess(userID, fileID uuid.UUID, permission string) (bool, error) {
+	return f.grantees[userID], nil
+}
+
+func (f *fakeCommentAccess) CheckIfAlreadyShared(fileID, toUserID uuid.UUID) (bool, error) {
+	return f.sharedTo[toUserID], nil
+}
+
+type commentFixture struct {
+	service        *CommentService
+	repo           *memoryCommentRepository
+	file           *models.File
+	owner          uuid.UUID
+	grantee        uuid.UUID
+	sharedTo       uuid.UUID
+	folderSharedTo uuid.UUID
+	stranger       uuid.UUID
+}
+
+func newCommentFixture() *commentFixture {
+	f := &commentFixture{
+		repo:           &memoryCommentRepository{},
+		owner:          uuid.New(),
+		grantee:        uuid.New(),
+		sharedTo:       uuid.New(),
+		folderSharedTo: uuid.New(),
+		stranger:       uuid.New(),
+	}
+	f.file = &models.File{ID: uuid.New(), OriginalName: "design.pdf", UploaderID: f.owner}
+
+	fileRepo := new(MockFileRepository)
+	fileRepo.On("GetByID", f.file.ID).Return(f.file, nil)
+	access := &fakeCommentAccess{
+		grantees:       map[uuid.UUID]bool{f.grantee: true},
+		sharedTo:       map[uuid.UUID]bool{f.sharedTo: true},
+		folderSharedTo: map[uuid.UUID]bool{f.folderSharedTo: true},
+	}
+	f.service = NewCommentService(f.repo, fileRepo, access, access, nil)
+	f.service.SetFolderShareChecker(access)
+	return f
+}
+
+func TestCommentService_AddComment_AllowsOwnerGranteesAndRecipients(t *testing.T) {
+	f := newCommentFixture()
+
+	for _, userID := range []uuid.UUID{f.owner, f.grantee, f.sharedTo, f.folderSharedTo} {
+		comment, err := f.service.AddComment(f.file.ID, userID, "  looks good  ")
+		require.NoError(t, err)
+		assert.Equal(t, "looks good", comment.Body)
+		assert.Equal(t, userID, comment.UserID)
+		assert.NotEmpty(t, comment.AuthorUsername)
+	}
+
+	comments, err := f.service.ListComments(f.file.ID, f.folderSharedTo, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, comments, 4)
+}
+
+func TestCommentService_RejectsUsersWithoutAccess(t *testing.T) {
+	f := newCommentFixture()
+
+	_, err := f.service.AddComment(f.file.ID, f.stranger, "hello")
+	assert.Error(t, err)
+
+	_, err = f.service.ListComments(f.file.ID, f.stranger, 10, 0)
+	assert.Error(t, err)
+	assert.Empty(t, f.repo.comments)
+}
+
+func TestCommentService_AddComment_ValidatesBody(t *testing.T) {
+	f := newCommentFixture()
+
+	_, err := f.service.AddComment(f.file.ID, f.owner, "   ")
+	assert.Error(t, err)
+
+	long := make([]rune, maxCommentLength+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	_, err = f.service.AddComment(f.file.ID, f.owner, string(long))
+	assert.Error(t, err)
+}
+
+func TestCommentService_DeleteComment(t *testing.T) {
+	f := newCommentFixture()
+
+	byGrantee, err := f.service.AddComment(f.file.ID, f.grantee, "first")
+	require.NoError(t, err)
+	byRecipient, err := f.service.AddComment(f.file.ID, f.sharedTo, "second")
+	require.NoError(t, err)
+
+	// Other commenters can't delete someone else's comment
+	assert.Error(t, f.service.DeleteComment(byGrantee.ID, f.sharedTo))
+
+	// Authors can delete their own and owners can delete any comment on their file
+	require.NoError(t, f.service.DeleteComment(byGrantee.ID, f.grantee))
+	require.NoError(t, f.service.DeleteComment(byRecipient.ID, f.owner))
+	assert.Empty(t, f.repo.comments)
+
+	assert.Error(t, f.service.DeleteComment(uuid.New(), f.owner))
+}
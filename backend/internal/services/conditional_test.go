@@ -0,0 +1,80 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func conditionalTestFile() *models.File {
+	return &models.File{
+		Hash:      "deadbeef",
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC),
+	}
+}
+
+func TestSetFileValidators(t *testing.T) {
+	header := http.Header{}
+	SetFileValidators(header, conditionalTestFile())
+
+	assert.Equal(t, `"deadbeef"`, header.Get("ETag"))
+	assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", header.Get("Last-Modified"))
+
+	header = http.Header{}
+	SetFileValidators(header, &models.File{CreatedAt: time.Now()})
+	assert.Empty(t, header.Get("ETag"), "legacy files without a hash have no ETag")
+	assert.NotEmpty(t, header.Get("Last-Modified"))
+}
+
+func TestNotModified(t *testing.T) {
+	file := conditionalTestFile()
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"no validators", "GET", nil, false},
+		{"matching etag", "GET", map[string]string{"If-None-Match": `"deadbeef"`}, true},
+		{"weak matching etag", "GET", map[string]string{"If-None-Match": `W/"deadbeef"`}, true},
+		{"etag in list", "GET", map[string]string{"If-None-Match": `"other", "deadbeef"`}, true},
+		{"wildcard", "GET", map[string]string{"If-None-Match": "*"}, true},
+		{"different etag", "GET", map[string]string{"If-None-Match": `"other"`}, false},
+		{"head request", "HEAD", map[string]string{"If-None-Match": `"deadbeef"`}, true},
+		{"not a read", "POST", map[string]string{"If-None-Match": `"deadbeef"`}, false},
+		{"modified since earlier", "GET", map[string]string{"If-Modified-Since": "Tue, 30 Apr 2024 12:00:00 GMT"}, false},
+		{"not modified since upload", "GET", map[string]string{"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"}, true},
+		{"invalid date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{
+			"etag takes precedence over date", "GET",
+			map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/files/1/preview", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, NotModified(req, file))
+		})
+	}
+}
+
+func TestFileIfRange(t *testing.T) {
+	file := conditionalTestFile()
+
+	assert.Equal(t, "", FileIfRange("", file))
+	assert.Equal(t, "", FileIfRange(`"deadbeef"`, file), "our own ETag means the range can be served")
+	assert.Equal(t, "", FileIfRange("Wed, 01 May 2024 12:00:00 GMT", file))
+	assert.Equal(t, `"s3etag"`, FileIfRange(`"s3etag"`, file), "other validators are left for S3 to check")
+	assert.Equal(t, "Tue, 30 Apr 2024 12:00:00 GMT", FileIfRange("Tue, 30 Apr 2024 12:00:00 GMT", file))
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"filevault/internal/models"
+)
+
+// ContentDisposition builds a Content-Disposition header value for serving a file under its
+// original name. The plain filename parameter carries an ASCII fallback for old clients and
+// filename* (RFC 5987) carries the full UTF-8 name, so quotes, line breaks or non-ASCII in
+// user-supplied names can neither break the header nor inject new ones.
+func ContentDisposition(disposition, name string) string {
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s",
+		disposition, sanitizeFilename(name), encodeRFC5987(cleanFilename(name)))
+}
+
+// DownloadFilename is the name a file is downloaded as: its download name override if it has
+// one, otherwise its original name
+func DownloadFilename(file *models.File) string {
+	if file.DownloadName != nil && *file.DownloadName != "" {
+		return *file.DownloadName
+	}
+	return file.OriginalName
+}
+
+// sanitizeFilename returns an ASCII-only version of name that is safe inside a quoted
+// header parameter, replacing anything else with an underscore
+func sanitizeFilename(name string) string {
+	cleaned := cleanFilename(name)
+
+	var b strings.Builder
+	for _, r := range cleaned {
+		if r > unicode.MaxASCII || r == '"' || r == '\\' {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// cleanFilename drops control characters and path separators from a user-supplied name,
+// falling back to a generic name if nothing is left
+func cleanFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r):
+			continue
+		case r == '/' || r == '\\':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	cleaned := strings.TrimSpace(b.String())
+	if cleaned == "" || cleaned == "." || cleaned == ".." {
+		return "download"
+	}
+	return cleaned
+}
+
+// encodeRFC5987 percent-encodes every byte of s that isn't an RFC 5987 attr-char
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
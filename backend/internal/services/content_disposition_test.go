@@ -0,0 +1,56 @@
+package services
+
+import (
+	"mime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentDisposition_QuotesSpacesAndUnicode(t *testing.T) {
+	header := ContentDisposition("attachment", `Ünïcödé "final" report.pdf`)
+
+	assert.Equal(t,
+		`attachment; filename="_n_c_d_ _final_ report.pdf"; filename*=UTF-8''%C3%9Cn%C3%AFc%C3%B6d%C3%A9%20%22final%22%20report.pdf`,
+		header)
+
+	// Clients that understand filename* get the original name back
+	disposition, params, err := mime.ParseMediaType(header)
+	require.NoError(t, err)
+	assert.Equal(t, "attachment", disposition)
+	assert.Equal(t, `Ünïcödé "final" report.pdf`, params["filename"])
+}
+
+func TestContentDisposition_StripsHeaderInjection(t *testing.T) {
+	header := ContentDisposition("inline", "evil.txt\r\nSet-Cookie: session=stolen")
+
+	assert.NotContains(t, header, "\r")
+	assert.NotContains(t, header, "\n")
+	assert.Equal(t,
+		`inline; filename="evil.txtSet-Cookie: session=stolen"; filename*=UTF-8''evil.txtSet-Cookie%3A%20session%3Dstolen`,
+		header)
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"spaces kept", "my report.pdf", "my report.pdf"},
+		{"quotes and backslashes", `a"b\c.txt`, "a_b_c.txt"},
+		{"path separators", "../../etc/passwd", ".._.._etc_passwd"},
+		{"non-ASCII", "日本.txt", "__.txt"},
+		{"control characters", "tab\there.txt", "tabhere.txt"},
+		{"empty", "  ", "download"},
+		{"invalid UTF-8", "\xff\xfe", "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeFilename(tt.input))
+		})
+	}
+}
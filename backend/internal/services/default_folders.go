@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"filevault/internal/models"
+	"filevault/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// maxFolderNameLength matches the limit CreateFolderRequest puts on folder names
+const maxFolderNameLength = 255
+
+// ParseDefaultFolders parses a comma-separated list of folders to create for every new user,
+// such as "Documents,Photos,Projects/Active". Subfolders are written as paths and imply their
+// parents. The result lists each folder's path once, parents before their subfolders; an
+// empty value gives no folders. Paths nested deeper than maxDepth are rejected unless it is 0.
+func ParseDefaultFolders(value string, maxDepth int) ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, raw := range strings.Split(value, ",") {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+
+		var names []string
+		for _, name := range strings.Split(raw, "/") {
+			name = strings.TrimSpace(name)
+			if name == "" || utf8.RuneCountInString(name) > maxFolderNameLength {
+				return nil, fmt.Errorf("invalid default folder %q: folder names must be 1 to %d characters", strings.TrimSpace(raw), maxFolderNameLength)
+			}
+			names = append(names, name)
+		}
+		if err := checkFolderDepth(len(names), maxDepth); err != nil {
+			return nil, fmt.Errorf("invalid default folder %q: %w", strings.TrimSpace(raw), err)
+		}
+
+		// Names are compared like sibling folders are, so "Photos" and "photos" are one folder
+		for depth := 1; depth <= len(names); depth++ {
+			key := folderNameKey(strings.Join(names[:depth], "/"))
+			if !seen[key] {
+				seen[key] = true
+				paths = append(paths, strings.Join(names[:depth], "/"))
+			}
+		}
+	}
+	return paths, nil
+}
+
+// CreateDefaultFolders creates a new user's default folders through exec, normally the
+// transaction that creates the user. paths come from ParseDefaultFolders, which lists parents
+// before their subfolders.
+func (s *FolderService) CreateDefaultFolders(exec repositories.Execer, ownerID uuid.UUID, paths []string) ([]*models.Folder, error) {
+	created := make(map[string]*models.Folder, len(paths))
+	folders := make([]*models.Folder, 0, len(paths))
+	for _, path := range paths {
+		name, fullPath := path, path
+		var parentID *uuid.UUID
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent := created[folderNameKey(path[:i])]
+			if parent == nil {
+				return nil, fmt.Errorf("default folder %q is listed before its parent", path)
+			}
+			name = path[i+1:]
+			fullPath = parent.Path + "/" + name
+			parentID = &parent.ID
+		}
+
+		now := time.Now()
+		folder := &models.Folder{
+			ID:        uuid.New(),
+			Name:      name,
+			Path:      fullPath,
+			ParentID:  parentID,
+			OwnerID:   ownerID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.folderRepo.CreateWith(exec, folder); err != nil {
+			return nil, fmt.Errorf("failed to create default folder %q: %w", path, err)
+		}
+		created[folderNameKey(path)] = folder
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"filevault/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingExecer records the arguments of each statement, standing in for a transaction
+type recordingExecer struct {
+	calls  [][]interface{}
+	failAt int
+}
+
+func (e *recordingExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	e.calls = append(e.calls, args)
+	if len(e.calls) == e.failAt {
+		return nil, errors.New("insert failed")
+	}
+	return nil, nil
+}
+
+func TestParseDefaultFolders(t *testing.T) {
+	paths, err := ParseDefaultFolders(" Documents, Projects/Active ,photos,Photos, projects / Archive", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Documents", "Projects", "Projects/Active", "photos", "projects/Archive"}, paths)
+
+	paths, err = ParseDefaultFolders("", 20)
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+
+	for _, invalid := range []string{"Projects//Active", "/Documents", "Documents/"} {
+		_, err := ParseDefaultFolders(invalid, 20)
+		assert.Error(t, err, invalid)
+	}
+
+	_, err = ParseDefaultFolders("a/b/c", 2)
+	assert.ErrorIs(t, err, ErrFolderTooDeep)
+	_, err = ParseDefaultFolders("a/b/c", 0)
+	assert.NoError(t, err)
+}
+
+func TestFolderService_CreateDefaultFolders(t *testing.T) {
+	service := NewFolderService(repositories.NewFolderRepository(nil))
+	paths, err := ParseDefaultFolders("Documents,Projects/Active,projects/Archive", DefaultMaxFolderDepth)
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	tx := &recordingExecer{}
+	folders, err := service.CreateDefaultFolders(tx, userID, paths)
+	require.NoError(t, err)
+	require.Len(t, folders, 4)
+	assert.Len(t, tx.calls, 4, "every folder is inserted through the transaction")
+
+	byPath := make(map[string]uuid.UUID)
+	for _, folder := range folders {
+		assert.Equal(t, userID, folder.OwnerID)
+		byPath[folder.Path] = folder.ID
+	}
+	assert.Equal(t, "Documents", folders[0].Name)
+	assert.Nil(t, folders[0].ParentID)
+	assert.Nil(t, folders[1].ParentID)
+
+	// Subfolders hang under their parent, using the parent's spelling in their path
+	assert.Equal(t, "Active", folders[2].Name)
+	assert.Equal(t, byPath["Projects"], *folders[2].ParentID)
+	assert.Equal(t, "Projects/Archive", folders[3].Path)
+	assert.Equal(t, byPath["Projects"], *folders[3].ParentID)
+}
+
+func TestFolderService_CreateDefaultFolders_StopsOnError(t *testing.T) {
+	service := NewFolderService(repositories.NewFolderRepository(nil))
+
+	tx := &recordingExecer{failAt: 2}
+	_, err := service.CreateDefaultFolders(tx, uuid.New(), []string{"Documents", "Photos", "Music"})
+	assert.ErrorContains(t, err, `"Photos"`)
+	assert.Len(t, tx.calls, 2)
+
+	_, err = service.CreateDefaultFolders(&recordingExecer{}, uuid.New(), []string{"Projects/Active"})
+	assert.ErrorContains(t, err, "before its parent")
+}
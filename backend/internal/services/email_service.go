@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// EmailSender sends plain-text emails. EmailService is the SMTP implementation; services take
+// this interface so they can be tested without a mail server.
+type EmailSender interface {
+	SendEmail(to, subject, body string) error
+}
+
+// EmailService sends plain-text emails over SMTP
+type EmailService struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewEmailService creates a new email service. It returns nil when no SMTP host is configured,
+// so callers can treat email as an optional channel.
+func NewEmailService(host, port, username, password, from string) *EmailService {
+	if host == "" || from == "" {
+		return nil
+	}
+
+	return &EmailService{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// SendEmail sends a plain-text email to a single recipient
+func (s *EmailService) SendEmail(to, subject, body string) error {
+	if to == "" {
+		return fmt.Errorf("recipient email is required")
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + s.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+		"",
+		body,
+	}, "\r\n")
+
+	addr := fmt.Sprintf("%s:%s", s.host, s.port)
+	if err := smtp.SendMail(addr, auth, s.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+
+	"filevault/internal/models"
+	"filevault/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// FileAccessGrantRepositoryInterface defines the grant storage used by FileAccessService
+type FileAccessGrantRepositoryInterface interface {
+	Upsert(grant *models.FileAccessGrant) error
+	GetByFileAndGrantee(fileID, granteeID uuid.UUID) (*models.FileAccessGrant, error)
+	Delete(fileID, granteeID uuid.UUID) (bool, error)
+}
+
+// FileAccessService manages persistent read-only collaborator access to files.
+// Owners keep full control; grantees can only view or download.
+type FileAccessService struct {
+	grantRepo FileAccessGrantRepositoryInterface
+	fileRepo  repositories.FileRepositoryInterface
+	userRepo  UserRepositoryInterface
+}
+
+// NewFileAccessService creates a new file access service
+func NewFileAccessService(grantRepo FileAccessGrantRepositoryInterface, fileRepo repositories.FileRepositoryInterface, userRepo UserRepositoryInterface) *FileAccessService {
+	return &FileAccessService{
+		grantRepo: grantRepo,
+		fileRepo:  fileRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// GrantAccess gives another user view or download access to a file the owner uploaded.
+// Granting again to the same user replaces the previous permission.
+func (s *FileAccessService) GrantAccess(ownerID, fileID, granteeID uuid.UUID, permission string) (*models.FileAccessGrant, error) {
+	if !models.IsValidFilePermission(permission) {
+		return nil, fmt.Errorf("invalid permission: must be %s or %s", models.FilePermissionView, models.FilePermissionDownload)
+	}
+
+	if err := s.requireOwner(ownerID, fileID); err != nil {
+		return nil, err
+	}
+
+	if granteeID == ownerID {
+		return nil, fmt.Errorf("cannot grant access to yourself")
+	}
+
+	if _, err := s.userRepo.GetByID(granteeID); err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	grant := &models.FileAccessGrant{
+		ID:         uuid.New(),
+		FileID:     fileID,
+		GranteeID:  granteeID,
+		GrantedBy:  ownerID,
+		Permission: permission,
+	}
+
+	if err := s.grantRepo.Upsert(grant); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// RevokeAccess removes a user's grant on a file the owner uploaded
+func (s *FileAccessService) RevokeAccess(ownerID, fileID, granteeID uuid.UUID) error {
+	if err := s.requireOwner(ownerID, fileID); err != nil {
+		return err
+	}
+
+	deleted, err := s.grantRepo.Delete(fileID, granteeID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("access grant not found")
+	}
+
+	return nil
+}
+
+// HasAccess reports whether a user holds a grant on the file covering the permission.
+// Ownership is checked separately by callers, since owners need no grant.
+func (s *FileAccessService) HasAccess(userID, fileID uuid.UUID, permission string) (bool, error) {
+	grant, err := s.grantRepo.GetByFileAndGrantee(fileID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file access grant: %w", err)
+	}
+
+	return grant != nil && grant.Allows(permission), nil
+}
+
+// requireOwner checks that the user uploaded the file
+func (s *FileAccessService) requireOwner(userID, fileID uuid.UUID) error {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return fmt.Errorf("file not found: %w", err)
+	}
+
+	if file.UploaderID != userID {
+		return fmt.Errorf("unauthorized: only the owner can manage access to this file")
+	}
+
+	return nil
+}
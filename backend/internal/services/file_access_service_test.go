@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockFileAccessGrantRepository is a mock implementation of FileAccessGrantRepositoryInterface
+type MockFileAccessGrantRepository struct {
+	mock.Mock
+}
+
+func (m *MockFileAccessGrantRepository) Upsert(grant *models.FileAccessGrant) error {
+	args := m.Called(grant)
+	return args.Error(0)
+}
+
+func (m *MockFileAccessGrantRepository) GetByFileAndGrantee(fileID, granteeID uuid.UUID) (*models.FileAccessGrant, error) {
+	args := m.Called(fileID, granteeID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FileAccessGrant), args.Error(1)
+}
+
+func (m *MockFileAccessGrantRepository) Delete(fileID, granteeID uuid.UUID) (bool, error) {
+	args := m.Called(fileID, granteeID)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestFileAccessService_GrantAccess(t *testing.T) {
+	grantRepo := new(MockFileAccessGrantRepository)
+	fileRepo := new(MockFileRepository)
+	userRepo := new(MockUserRepository)
+	service := NewFileAccessService(grantRepo, fileRepo, userRepo)
+
+	ownerID := uuid.New()
+	granteeID := uuid.New()
+	fileID := uuid.New()
+
+	fileRepo.On("GetByID", fileID).Return(&models.File{ID: fileID, UploaderID: ownerID}, nil)
+	userRepo.On("GetByID", granteeID).Return(&models.User{ID: granteeID}, nil)
+	grantRepo.On("Upsert", mock.AnythingOfType("*models.FileAccessGrant")).Return(nil)
+
+	grant, err := service.GrantAccess(ownerID, fileID, granteeID, models.FilePermissionDownload)
+	require.NoError(t, err)
+	assert.Equal(t, fileID, grant.FileID)
+	assert.Equal(t, granteeID, grant.GranteeID)
+	assert.Equal(t, ownerID, grant.GrantedBy)
+	assert.Equal(t, models.FilePermissionDownload, grant.Permission)
+	grantRepo.AssertExpectations(t)
+}
+
+func TestFileAccessService_GrantAccess_Rejected(t *testing.T) {
+	ownerID := uuid.New()
+	otherID := uuid.New()
+	fileID := uuid.New()
+
+	fileRepo := new(MockFileRepository)
+	fileRepo.On("GetByID", fileID).Return(&models.File{ID: fileID, UploaderID: ownerID}, nil)
+	grantRepo := new(MockFileAccessGrantRepository)
+	service := NewFileAccessService(grantRepo, fileRepo, new(MockUserRepository))
+
+	_, err := service.GrantAccess(ownerID, fileID, otherID, "edit")
+	assert.Error(t, err, "unknown permissions are rejected")
+
+	_, err = service.GrantAccess(otherID, fileID, uuid.New(), models.FilePermissionView)
+	assert.Error(t, err, "only the owner can grant access")
+
+	_, err = service.GrantAccess(ownerID, fileID, ownerID, models.FilePermissionView)
+	assert.Error(t, err, "owners cannot grant themselves")
+
+	grantRepo.AssertNotCalled(t, "Upsert", mock.Anything)
+}
+
+func TestFileAccessService_RevokeAccess(t *testing.T) {
+	ownerID := uuid.New()
+	granteeID := uuid.New()
+	fileID := uuid.New()
+
+	fileRepo := new(MockFileRepository)
+	fileRepo.On("GetByID", fileID).Return(&models.File{ID: fileID, UploaderID: ownerID}, nil)
+	grantRepo := new(MockFileAccessGrantRepository)
+	grantRepo.On("Delete", fileID, granteeID).Return(true, nil).Once()
+	grantRepo.On("Delete", fileID, granteeID).Return(false, nil).Once()
+	service := NewFileAccessService(grantRepo, fileRepo, new(MockUserRepository))
+
+	assert.NoError(t, service.RevokeAccess(ownerID, fileID, granteeID))
+	assert.Error(t, service.RevokeAccess(ownerID, fileID, granteeID), "revoking a missing grant fails")
+	assert.Error(t, service.RevokeAccess(granteeID, fileID, granteeID), "grantees cannot revoke")
+}
+
+func TestFileAccessService_HasAccess(t *testing.T) {
+	fileID := uuid.New()
+	viewer := uuid.New()
+	downloader := uuid.New()
+	stranger := uuid.New()
+
+	grantRepo := new(MockFileAccessGrantRepository)
+	grantRepo.On("GetByFileAndGrantee", fileID, viewer).Return(&models.FileAccessGrant{Permission: models.FilePermissionView}, nil)
+	grantRepo.On("GetByFileAndGrantee", fileID, downloader).Return(&models.FileAccessGrant{Permission: models.FilePermissionDownload}, nil)
+	grantRepo.On("GetByFileAndGrantee", fileID, stranger).Return(nil, nil)
+	service := NewFileAccessService(grantRepo, nil, nil)
+
+	tests := []struct {
+		name       string
+		userID     uuid.UUID
+		permission string
+		want       bool
+	}{
+		{"viewer can view", viewer, models.FilePermissionView, true},
+		{"viewer cannot download", viewer, models.FilePermissionDownload, false},
+		{"downloader can view", downloader, models.FilePermissionView, true},
+		{"downloader can download", downloader, models.FilePermissionDownload, true},
+		{"no grant", stranger, models.FilePermissionView, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasAccess, err := service.HasAccess(tt.userID, fileID, tt.permission)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, hasAccess)
+		})
+	}
+}
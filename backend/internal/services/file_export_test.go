@@ -0,0 +1,53 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileService_ExportFilesCSV(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+	userID := uuid.New()
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	rows := []*models.FileExportRow{
+		{ID: uuid.New(), Name: "report.pdf", Size: 2048, MimeType: "application/pdf", CreatedAt: created},
+		{ID: uuid.New(), Name: "a, \"quoted\" name.txt", Size: 5, MimeType: "text/plain", CreatedAt: created, FolderPath: "Projects/Active", SharedPublicly: true},
+		{ID: uuid.New(), Name: "=HYPERLINK(\"x\")", Size: 1, MimeType: "text/plain", CreatedAt: created, SharedWithUsers: true},
+	}
+	mockFileRepo.On("StreamForExport", userID, mock.Anything).Return(rows, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, service.ExportFilesCSV(userID, &buf))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, fileExportHeader, records[0])
+	assert.Equal(t, []string{rows[0].ID.String(), "report.pdf", "2048", "application/pdf", "/", "2024-03-01T12:30:00Z", "private"}, records[1])
+	assert.Equal(t, []string{rows[1].ID.String(), "a, \"quoted\" name.txt", "5", "text/plain", "/Projects/Active", "2024-03-01T12:30:00Z", "public link"}, records[2])
+	assert.Equal(t, "'=HYPERLINK(\"x\")", records[3][1], "formulas are not evaluated by spreadsheets")
+	assert.Equal(t, "users", records[3][6])
+}
+
+func TestFileService_ExportFilesCSV_NothingWrittenOnQueryError(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+	userID := uuid.New()
+	mockFileRepo.On("StreamForExport", userID, mock.Anything).Return(nil, errors.New("connection lost"))
+
+	var buf bytes.Buffer
+	assert.Error(t, service.ExportFilesCSV(userID, &buf))
+	assert.Zero(t, buf.Len())
+}
@@ -1,16 +1,19 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"filevault/internal/models"
 	"filevault/internal/repositories"
@@ -28,6 +31,112 @@ type FileService struct {
 	s3Service             S3ServiceInterface
 	mimeValidationService *MimeValidationService
 	websocketService      *WebSocketService
+	folderRepo            repositories.FolderRepositoryInterface
+	duplicateMode         DuplicateUploadMode
+	dedupScope            DedupScope
+	uploadGate            UploadGate
+	quota                 QuotaChecker
+	dedupPreferences      DedupPreferences
+	idempotencyRepo       repositories.UploadIdempotencyRepositoryInterface
+	idempotencyTTL        time.Duration
+	uploadMetricsRepo     repositories.UploadMetricsRepositoryInterface
+	processingService     *ProcessingService
+	thumbnailService      *ThumbnailService
+	archiveLimits         ArchiveLimits
+}
+
+// UploadGate reports whether uploads are currently allowed
+type UploadGate interface {
+	UploadsEnabled() bool
+}
+
+// QuotaChecker reports whether a user has room for another fileSize bytes, returning an error
+// wrapping ErrQuotaExceeded when they don't
+type QuotaChecker interface {
+	CheckQuota(userID uuid.UUID, fileSize int64) error
+}
+
+// DedupPreferences reports whether a user has opted their uploads out of deduplication
+type DedupPreferences interface {
+	GetDedupOptOut(userID uuid.UUID) (bool, error)
+}
+
+// s3CleanupTimeout bounds deleting an object left behind by a removed or failed record
+const s3CleanupTimeout = 30 * time.Second
+
+// ErrUploadInProgress is returned for an upload whose Idempotency-Key is still held by another
+// upload after waiting idempotencyMaxWait for it to finish
+var ErrUploadInProgress = errors.New("an upload with this idempotency key is still in progress")
+
+const (
+	// idempotencyPendingTimeout is how long a key stays reserved by an upload that never finished,
+	// e.g. because the server stopped mid-upload, before a retry may take it over
+	idempotencyPendingTimeout = 15 * time.Minute
+	// idempotencyMaxWait bounds how long a retry waits for the upload holding its key
+	idempotencyMaxWait = 2 * time.Minute
+	// idempotencyPollInterval is how often a waiting retry checks whether that upload finished
+	idempotencyPollInterval = 100 * time.Millisecond
+)
+
+// DuplicateUploadMode controls what an upload of already-stored content produces
+type DuplicateUploadMode string
+
+const (
+	// DuplicateUploadReference always creates a new file record that references the stored content
+	DuplicateUploadReference DuplicateUploadMode = "reference"
+	// DuplicateUploadReuse returns the user's existing record when the same file (content and
+	// name) is uploaded into the same folder again, and references the content otherwise
+	DuplicateUploadReuse DuplicateUploadMode = "reuse"
+)
+
+// ParseDuplicateUploadMode validates a configured duplicate upload mode; empty means reference
+func ParseDuplicateUploadMode(value string) (DuplicateUploadMode, error) {
+	switch mode := DuplicateUploadMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "", DuplicateUploadReference:
+		return DuplicateUploadReference, nil
+	case DuplicateUploadReuse:
+		return DuplicateUploadReuse, nil
+	default:
+		return "", fmt.Errorf("invalid duplicate upload mode %q: must be %q or %q", value, DuplicateUploadReference, DuplicateUploadReuse)
+	}
+}
+
+// DedupScope controls whose uploads an upload is deduplicated against
+type DedupScope string
+
+const (
+	// DedupScopeGlobal stores each distinct content once across all users
+	DedupScopeGlobal DedupScope = "global"
+	// DedupScopePerUser only deduplicates a user's uploads against their own, so the same content
+	// is stored once per user. This costs storage but keeps uploads from revealing, through
+	// deduplication, that another user already stored the same content.
+	DedupScopePerUser DedupScope = "per-user"
+)
+
+// ParseDedupScope validates a configured deduplication scope; empty means global
+func ParseDedupScope(value string) (DedupScope, error) {
+	switch scope := DedupScope(strings.ToLower(strings.TrimSpace(value))); scope {
+	case "", DedupScopeGlobal:
+		return DedupScopeGlobal, nil
+	case DedupScopePerUser:
+		return DedupScopePerUser, nil
+	default:
+		return "", fmt.Errorf("invalid deduplication scope %q: must be %q or %q", value, DedupScopeGlobal, DedupScopePerUser)
+	}
+}
+
+// UploadResult is an uploaded file along with what deduplication did for it
+type UploadResult struct {
+	File *models.File
+	// Deduplicated is true when the content was already stored and nothing new was written to S3
+	Deduplicated bool
+	// Replayed is true when the upload repeated an earlier request's Idempotency-Key and that
+	// request's file was returned without storing anything
+	Replayed bool
+	// ExistingFile is true when the user's existing record was returned instead of a new one
+	ExistingFile bool
+	// BytesSaved is the storage not used thanks to deduplication
+	BytesSaved int64
 }
 
 // NewFileService creates a new file service with all required dependencies
@@ -39,6 +148,7 @@ func NewFileService(
 	s3Service S3ServiceInterface,
 	mimeValidationService *MimeValidationService,
 	websocketService *WebSocketService,
+	folderRepo repositories.FolderRepositoryInterface,
 ) *FileService {
 	return &FileService{
 		fileRepo:              fileRepo,
@@ -48,36 +158,205 @@ func NewFileService(
 		s3Service:             s3Service,
 		mimeValidationService: mimeValidationService,
 		websocketService:      websocketService,
+		folderRepo:            folderRepo,
+	}
+}
+
+// SetDuplicateUploadMode chooses whether re-uploading a file returns the existing record
+func (s *FileService) SetDuplicateUploadMode(mode DuplicateUploadMode) {
+	s.duplicateMode = mode
+}
+
+// SetDedupScope chooses whether uploads are deduplicated across all users or per user. Content
+// stored under one scope stays in place when the scope changes; it just isn't reused by uploads
+// made under the other.
+func (s *FileService) SetDedupScope(scope DedupScope) {
+	s.dedupScope = scope
+}
+
+// SetDedupPreferences makes uploads by users who opted out of deduplication store a private
+// copy, as uploads with DisableDedup do, whatever the deduplication scope
+func (s *FileService) SetDedupPreferences(preferences DedupPreferences) {
+	s.dedupPreferences = preferences
+}
+
+// dedupOptedOut reports whether uploaderID opted out of deduplication. If the preference can't
+// be read the upload is kept private, which only costs storage.
+func (s *FileService) dedupOptedOut(uploaderID uuid.UUID) bool {
+	if s.dedupPreferences == nil {
+		return false
+	}
+	optOut, err := s.dedupPreferences.GetDedupOptOut(uploaderID)
+	if err != nil {
+		log.Printf("WARNING: Could not read dedup preference of user %s, storing a private copy: %v", uploaderID, err)
+		return true
 	}
+	return optOut
+}
+
+// findStoredContent looks up already-stored content an upload by uploaderID can reuse
+func (s *FileService) findStoredContent(uploaderID uuid.UUID, hash string) (*models.FileHash, error) {
+	if s.dedupScope == DedupScopePerUser {
+		return s.fileHashRepo.GetByOwnerAndHash(uploaderID, hash)
+	}
+	return s.fileHashRepo.GetByHash(hash)
+}
+
+// hashRecordFor returns the file hash of the object a deduplicated file references, which is
+// either shared by all users or owned by the file's uploader, depending on the scope in effect
+// when the content was stored
+func (s *FileService) hashRecordFor(file *models.File) (*models.FileHash, error) {
+	shared, err := s.fileHashRepo.GetByHash(file.Hash)
+	if err != nil || (shared != nil && shared.S3Key == file.S3Key) {
+		return shared, err
+	}
+	return s.fileHashRepo.GetByOwnerAndHash(file.UploaderID, file.Hash)
+}
+
+// SetUploadGate makes UploadFile refuse uploads while the gate reports them disabled
+func (s *FileService) SetUploadGate(gate UploadGate) {
+	s.uploadGate = gate
+}
+
+// SetQuotaChecker makes UploadFile refuse uploads that would take the uploader over their quota
+func (s *FileService) SetQuotaChecker(checker QuotaChecker) {
+	s.quota = checker
+}
+
+// SetIdempotencyStore makes uploads with an Idempotency-Key remember the file they created, so
+// repeating the key within ttl returns that file instead of uploading again
+func (s *FileService) SetIdempotencyStore(repo repositories.UploadIdempotencyRepositoryInterface, ttl time.Duration) {
+	s.idempotencyRepo = repo
+	s.idempotencyTTL = ttl
+}
+
+// SetProcessingService hands new uploads to background processing (hashing, thumbnails, ...)
+// once their record exists, so the upload response doesn't wait for it
+func (s *FileService) SetProcessingService(service *ProcessingService) {
+	s.processingService = service
+}
+
+// SetThumbnailService removes the thumbnails of content once no file references it any more
+func (s *FileService) SetThumbnailService(service *ThumbnailService) {
+	s.thumbnailService = service
+}
+
+// UploadOptions tunes how a single upload is stored
+type UploadOptions struct {
+	// DisableDedup stores the upload as a private S3 object even if the same content already
+	// exists, and keeps that object out of the deduplication index so no other file reuses it
+	DisableDedup bool
+	// IdempotencyKey identifies a client's upload request across retries; a key the uploader
+	// already used within the idempotency TTL returns the file that request created
+	IdempotencyKey string
 }
 
 // UploadFile uploads a file with deduplication to S3
-// Returns the file record or an error if upload fails
-func (s *FileService) UploadFile(file multipart.File, fileHeader *multipart.FileHeader, uploaderID uuid.UUID, folderID *uuid.UUID) (*models.File, error) {
+// Returns the file record and how it was deduplicated, or an error if upload fails
+func (s *FileService) UploadFile(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, uploaderID uuid.UUID, folderID *uuid.UUID) (*UploadResult, error) {
+	return s.UploadFileWithOptions(ctx, file, fileHeader, uploaderID, folderID, UploadOptions{})
+}
+
+// UploadFileWithOptions uploads a file like UploadFile, with per-upload storage options
+func (s *FileService) UploadFileWithOptions(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, uploaderID uuid.UUID, folderID *uuid.UUID, opts UploadOptions) (*UploadResult, error) {
+	idempotent := opts.IdempotencyKey != "" && s.idempotencyRepo != nil
+	if idempotent {
+		previous, err := s.claimIdempotencyKey(ctx, uploaderID, opts.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			return &UploadResult{File: previous, Replayed: true}, nil
+		}
+	}
+
+	result, err := s.uploadFile(ctx, file, fileHeader, uploaderID, folderID, opts)
+	s.recordUploadOutcome(err)
+	if err != nil {
+		if idempotent {
+			// Nothing was created, so a retry with the key may upload again
+			if err := s.idempotencyRepo.Release(uploaderID, opts.IdempotencyKey); err != nil {
+				log.Printf("WARNING: Failed to release upload idempotency key: %v", err)
+			}
+		}
+		return nil, err
+	}
+	if !idempotent {
+		return result, nil
+	}
+	// The file exists either way; a key that couldn't be completed only keeps retries waiting
+	// until its reservation times out, after which they upload again
+	if err := s.idempotencyRepo.Complete(uploaderID, opts.IdempotencyKey, result.File.ID); err != nil {
+		log.Printf("WARNING: Failed to save upload idempotency key for file %s: %v", result.File.ID, err)
+	}
+	return result, nil
+}
+
+// claimIdempotencyKey reserves the key for an upload by uploaderID. It returns nil when the
+// caller now holds the key and should upload, or the file an earlier upload with the key created.
+// While another upload holds the key it waits for that upload to finish, for up to
+// idempotencyMaxWait, so overlapping retries never both create a file.
+func (s *FileService) claimIdempotencyKey(ctx context.Context, uploaderID uuid.UUID, key string) (*models.File, error) {
+	deadline := time.Now().Add(idempotencyMaxWait)
+	for {
+		now := time.Now()
+		reserved, fileID, err := s.idempotencyRepo.Reserve(uploaderID, key, now.Add(-s.idempotencyTTL), now.Add(-idempotencyPendingTimeout))
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+		if fileID != nil {
+			return s.fileRepo.GetByID(*fileID)
+		}
+		if now.After(deadline) {
+			return nil, ErrUploadInProgress
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+// uploadFile stores one upload, deduplicating its content
+func (s *FileService) uploadFile(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, uploaderID uuid.UUID, folderID *uuid.UUID, opts UploadOptions) (*UploadResult, error) {
 	fmt.Println("=== FILE SERVICE UPLOAD DEBUG START ===")
 	fmt.Printf("DEBUG: FileService.UploadFile called - File: %s, Size: %d, Uploader: %s, FolderID: %v\n",
 		fileHeader.Filename, fileHeader.Size, uploaderID.String(), folderID)
 
+	if s.uploadGate != nil && !s.uploadGate.UploadsEnabled() {
+		return nil, ErrUploadsDisabled
+	}
+
 	// Validate file size (max 100MB)
 	const maxFileSize = 100 * 1024 * 1024
 	if fileHeader.Size > maxFileSize {
 		fmt.Printf("ERROR: File too large: %d bytes (max: %d bytes)\n", fileHeader.Size, maxFileSize)
-		return nil, fmt.Errorf("file too large: %d bytes (max: %d bytes)", fileHeader.Size, maxFileSize)
+		return nil, failUpload(UploadFailureTooLarge, fmt.Errorf("file too large: %d bytes (max: %d bytes)", fileHeader.Size, maxFileSize))
 	}
 	fmt.Printf("DEBUG: File size validation passed: %d bytes\n", fileHeader.Size)
 
-	// Read file content for hash calculation
-	fmt.Println("DEBUG: Reading file content...")
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
+	if s.quota != nil {
+		if err := s.quota.CheckQuota(uploaderID, fileHeader.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	// The upload is hashed as a stream and only a sample is kept in memory for MIME checks. Large
+	// multipart files are already spilled to a temp file, which is then streamed to S3 as well.
+	fmt.Println("DEBUG: Calculating file hash...")
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
 		fmt.Printf("ERROR: Failed to read file content: %v\n", err)
-		return nil, fmt.Errorf("failed to read file content: %w", err)
+		return nil, failUpload(UploadFailureReadError, fmt.Errorf("failed to read file content: %w", err))
 	}
-	fmt.Printf("DEBUG: File content read successfully: %d bytes\n", len(fileContent))
+	hashString := hex.EncodeToString(hasher.Sum(nil))
+	fmt.Printf("DEBUG: File hash calculated: %s\n", hashString)
 
-	// Validate MIME type for security
-	fmt.Println("DEBUG: Detecting MIME type...")
-	detectedMimeType := mimetype.Detect(fileContent)
 	declaredMimeType := fileHeader.Header.Get("Content-Type")
 
 	// Set default MIME type if not provided
@@ -85,16 +364,36 @@ func (s *FileService) UploadFile(file multipart.File, fileHeader *multipart.File
 		declaredMimeType = "application/octet-stream"
 	}
 
+	sampleLimit := int64(mimeSniffLen)
+	if s.mimeValidationService.RequiresFullContent(declaredMimeType) {
+		sampleLimit = fileHeader.Size
+	}
+	sample, err := readUploadSample(file, sampleLimit)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to read file content: %v\n", err)
+		return nil, failUpload(UploadFailureReadError, fmt.Errorf("failed to read file content: %w", err))
+	}
+
+	// Validate MIME type for security
+	fmt.Println("DEBUG: Detecting MIME type...")
+	detectedMimeType := mimetype.Detect(sample)
+
 	fmt.Printf("DEBUG: MIME types - Declared: %s, Detected: %s\n", declaredMimeType, detectedMimeType.String())
 
 	// Validate MIME type against file content using the validation service
 	fmt.Println("DEBUG: Validating MIME type against file content...")
-	if err := s.mimeValidationService.ValidateMimeType(fileContent, declaredMimeType); err != nil {
+	if err := s.mimeValidationService.ValidateMimeType(sample, declaredMimeType); err != nil {
 		fmt.Printf("ERROR: MIME type validation failed: %v\n", err)
-		return nil, fmt.Errorf("file content does not match declared MIME type '%s': %w", declaredMimeType, err)
+		return nil, failUpload(UploadFailureMimeRejected, fmt.Errorf("file content does not match declared MIME type '%s': %w", declaredMimeType, err))
 	}
 	fmt.Println("DEBUG: MIME type validation passed")
 
+	// Archives that would expand far beyond their size are refused before they're stored
+	if err := CheckArchive(file, fileHeader.Size, detectedMimeType, s.archiveLimits); err != nil {
+		fmt.Printf("ERROR: Archive check failed: %v\n", err)
+		return nil, failUpload(UploadFailureArchiveRejected, err)
+	}
+
 	// Log MIME type mismatches for security monitoring
 	if declaredMimeType != "" && detectedMimeType.String() != declaredMimeType {
 		log.Printf("WARNING: MIME type mismatch for file %s - declared: %s, detected: %s",
@@ -102,71 +401,119 @@ func (s *FileService) UploadFile(file multipart.File, fileHeader *multipart.File
 		fmt.Printf("WARNING: MIME type mismatch detected but validation passed...\n")
 	}
 
-	// Calculate SHA-256 hash
-	fmt.Println("DEBUG: Calculating file hash...")
-	hash := sha256.Sum256(fileContent)
-	hashString := fmt.Sprintf("%x", hash)
-	fmt.Printf("DEBUG: File hash calculated: %s\n", hashString)
+	// Rewind so the upload streams the file from the start
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, failUpload(UploadFailureReadError, fmt.Errorf("failed to rewind file content: %w", err))
+	}
 
-	// Create a new reader from the content
-	contentReader := bytes.NewReader(fileContent)
+	if !opts.DisableDedup && s.dedupOptedOut(uploaderID) {
+		opts.DisableDedup = true
+	}
+	if opts.DisableDedup {
+		result, err := s.saveNewFileToS3(ctx, fileHeader, uploaderID, hashString, file, folderID, true)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to save private copy to S3: %v\n", err)
+			return nil, err
+		}
+		s.broadcastUploadComplete(uploaderID, result)
+		s.enqueueProcessing(result)
+		return &UploadResult{File: result}, nil
+	}
 
-	// Check if file with this hash already exists (cross-user deduplication)
-	fmt.Println("DEBUG: Checking for existing file with same hash across all users...")
-	existingFileHash, err := s.fileHashRepo.GetByHash(hashString)
+	// Check if file with this hash already exists within the deduplication scope
+	fmt.Println("DEBUG: Checking for existing file with same hash...")
+	existingFileHash, err := s.findStoredContent(uploaderID, hashString)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to check for existing file hash: %v\n", err)
-		return nil, err
+		return nil, failUpload(UploadFailureDatabaseError, err)
 	}
 
 	if existingFileHash != nil {
+		// The same file uploaded into the same folder again can return the record the user already has
+		if s.duplicateMode == DuplicateUploadReuse {
+			existing, err := s.fileRepo.GetByUploaderFolderAndHash(uploaderID, folderID, hashString, fileHeader.Filename)
+			if err != nil {
+				fmt.Printf("ERROR: Failed to check for an existing copy: %v\n", err)
+				return nil, failUpload(UploadFailureDatabaseError, err)
+			}
+			if existing != nil {
+				existing.IsDuplicate = true
+				s.broadcastUploadComplete(uploaderID, existing)
+
+				fmt.Printf("SUCCESS: Returning existing file record for re-upload: %s\n", existing.ID)
+				fmt.Println("=== FILE SERVICE UPLOAD DEBUG END (EXISTING RECORD) ===")
+				return &UploadResult{File: existing, Deduplicated: true, ExistingFile: true, BytesSaved: fileHeader.Size}, nil
+			}
+		}
+
 		fmt.Println("DEBUG: File content already exists, creating file record without S3 upload...")
 		// File content already exists, create a file record that references the existing hash
 		result, err := s.createFileRecord(fileHeader, uploaderID, existingFileHash, folderID)
 		if err != nil {
 			fmt.Printf("ERROR: Failed to create file record: %v\n", err)
-			return nil, err
-		}
-
-		// Broadcast file upload complete event
-		if s.websocketService != nil {
-			s.websocketService.BroadcastFileUploadComplete(
-				uploaderID.String(),
-				result.ID.String(),
-				result.OriginalName,
-				result.Size,
-				false, // No longer using isDuplicate parameter
-			)
+			return nil, failUpload(UploadFailureDatabaseError, err)
 		}
+		result.IsDuplicate = true
+		s.broadcastUploadComplete(uploaderID, result)
+		s.enqueueProcessing(result)
 
 		fmt.Printf("SUCCESS: File record created (content already exists): %s\n", result.ID)
 		fmt.Println("=== FILE SERVICE UPLOAD DEBUG END (CONTENT EXISTS) ===")
-		return result, nil
+		return &UploadResult{File: result, Deduplicated: true, BytesSaved: fileHeader.Size}, nil
 	}
 	fmt.Println("DEBUG: New file content detected, proceeding with S3 upload...")
 
 	// New file content, upload to S3
-	result, err := s.saveNewFileToS3(fileHeader, uploaderID, hashString, contentReader, folderID)
+	result, err := s.saveNewFileToS3(ctx, fileHeader, uploaderID, hashString, file, folderID, false)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to save new file to S3: %v\n", err)
 		fmt.Println("=== FILE SERVICE UPLOAD DEBUG END (ERROR) ===")
 		return nil, err
 	}
 
-	// Broadcast file upload complete event
-	if s.websocketService != nil {
-		s.websocketService.BroadcastFileUploadComplete(
-			uploaderID.String(),
-			result.ID.String(),
-			result.OriginalName,
-			result.Size,
-			false, // No longer using isDuplicate parameter
-		)
-	}
+	s.broadcastUploadComplete(uploaderID, result)
+	s.enqueueProcessing(result)
 
 	fmt.Printf("SUCCESS: New file uploaded to S3: %s\n", result.ID)
 	fmt.Println("=== FILE SERVICE UPLOAD DEBUG END (SUCCESS) ===")
-	return result, nil
+	return &UploadResult{File: result}, nil
+}
+
+// markForProcessing flags a new file record as pending background processing if any task applies
+func (s *FileService) markForProcessing(file *models.File) {
+	if s.processingService != nil && s.processingService.Applies(file) {
+		status := models.JobStatusPending
+		file.JobStatus = &status
+	}
+}
+
+// enqueueProcessing queues a newly created file flagged by markForProcessing
+func (s *FileService) enqueueProcessing(file *models.File) {
+	if s.processingService != nil && file.JobStatus != nil {
+		s.processingService.Enqueue(file)
+	}
+}
+
+// readUploadSample rewinds an upload and reads up to limit bytes of it
+func readUploadSample(file io.ReadSeeker, limit int64) ([]byte, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(file, limit))
+}
+
+// broadcastUploadComplete sends the file upload complete event to the uploader
+func (s *FileService) broadcastUploadComplete(uploaderID uuid.UUID, file *models.File) {
+	if s.websocketService == nil {
+		return
+	}
+	s.websocketService.BroadcastFileUploadComplete(
+		uploaderID.String(),
+		file.ID.String(),
+		file.OriginalName,
+		file.Size,
+		file.IsDuplicate,
+	)
 }
 
 // createFileRecord creates a file record that references existing content
@@ -185,6 +532,14 @@ func (s *FileService) createFileRecord(fileHeader *multipart.FileHeader, uploade
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	s.markForProcessing(file)
+
+	// Record which file this is a copy of; a failed lookup only loses the pointer
+	if copies, err := s.fileRepo.GetByHash(existingFileHash.Hash); err != nil {
+		fmt.Printf("WARNING: Failed to look up the original of a duplicate upload: %v\n", err)
+	} else if original := pickOriginal(copiesOfObject(copies, existingFileHash.S3Key), uploaderID, file.ID); original != nil {
+		file.OriginalFileID = &original.ID
+	}
 
 	fmt.Printf("DEBUG: File record struct created: %+v\n", file)
 	if err := s.fileRepo.Create(file); err != nil {
@@ -196,17 +551,18 @@ func (s *FileService) createFileRecord(fileHeader *multipart.FileHeader, uploade
 	return file, nil
 }
 
-// saveNewFileToS3 saves a new file to S3 and database
-func (s *FileService) saveNewFileToS3(fileHeader *multipart.FileHeader, uploaderID uuid.UUID, hashString string, src io.Reader, folderID *uuid.UUID) (*models.File, error) {
+// saveNewFileToS3 saves a new file to S3 and database. A private copy gets its own object
+// (S3 keys are unique per upload) and no file hash record, so it is never deduplicated against.
+func (s *FileService) saveNewFileToS3(ctx context.Context, fileHeader *multipart.FileHeader, uploaderID uuid.UUID, hashString string, src io.Reader, folderID *uuid.UUID, private bool) (*models.File, error) {
 	fmt.Println("DEBUG: Starting S3 upload process...")
 
 	// Upload file to S3
 	fmt.Printf("DEBUG: Uploading file to S3 - Filename: %s, ContentType: %s\n",
 		fileHeader.Filename, fileHeader.Header.Get("Content-Type"))
-	s3URL, err := s.s3Service.UploadFile(context.Background(), src, fileHeader.Filename, fileHeader.Header.Get("Content-Type"))
+	s3URL, err := s.s3Service.UploadFile(ctx, src, fileHeader.Filename, fileHeader.Header.Get("Content-Type"))
 	if err != nil {
 		fmt.Printf("ERROR: S3 upload failed: %v\n", err)
-		return nil, fmt.Errorf("failed to upload file to S3: %w", err)
+		return nil, failUpload(UploadFailureStorageError, fmt.Errorf("failed to upload file to S3: %w", err))
 	}
 	fmt.Printf("DEBUG: S3 upload successful - URL: %s\n", s3URL)
 
@@ -228,16 +584,21 @@ func (s *FileService) saveNewFileToS3(fileHeader *multipart.FileHeader, uploader
 		MimeType:  fileHeader.Header.Get("Content-Type"),
 		CreatedAt: time.Now(),
 	}
+	if s.dedupScope == DedupScopePerUser {
+		fileHash.OwnerID = &uploaderID
+	}
 	fmt.Printf("DEBUG: FileHash struct created: %+v\n", fileHash)
 
-	if err := s.fileHashRepo.Create(fileHash); err != nil {
-		fmt.Printf("ERROR: Failed to create file hash record: %v\n", err)
-		// Clean up S3 file on error
-		fmt.Println("DEBUG: Cleaning up S3 file due to database error...")
-		s.s3Service.DeleteFile(context.Background(), s3Key)
-		return nil, fmt.Errorf("failed to create file hash: %w", err)
+	if !private {
+		if err := s.fileHashRepo.Create(fileHash); err != nil {
+			fmt.Printf("ERROR: Failed to create file hash record: %v\n", err)
+			// Clean up S3 file on error
+			fmt.Println("DEBUG: Cleaning up S3 file due to database error...")
+			s.cleanupObject(ctx, s3Key)
+			return nil, failUpload(UploadFailureDatabaseError, fmt.Errorf("failed to create file hash: %w", err))
+		}
+		fmt.Println("DEBUG: FileHash record created successfully in database")
 	}
-	fmt.Println("DEBUG: FileHash record created successfully in database")
 
 	// Create file record
 	file := &models.File{
@@ -253,15 +614,19 @@ func (s *FileService) saveNewFileToS3(fileHeader *multipart.FileHeader, uploader
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	file.DedupDisabled = private
+	s.markForProcessing(file)
 	fmt.Printf("DEBUG: File struct created: %+v\n", file)
 
 	if err := s.fileRepo.Create(file); err != nil {
 		fmt.Printf("ERROR: Failed to create file record: %v\n", err)
 		// Clean up S3 file and hash record on error
 		fmt.Println("DEBUG: Cleaning up S3 file and hash record due to database error...")
-		s.s3Service.DeleteFile(context.Background(), s3Key)
-		s.fileHashRepo.Delete(hashString)
-		return nil, fmt.Errorf("failed to create file record: %w", err)
+		s.cleanupObject(ctx, s3Key)
+		if !private {
+			s.fileHashRepo.Delete(fileHash.ID)
+		}
+		return nil, failUpload(UploadFailureDatabaseError, fmt.Errorf("failed to create file record: %w", err))
 	}
 	fmt.Println("DEBUG: File record created successfully in database")
 
@@ -280,12 +645,114 @@ func (s *FileService) GetFilesByUserID(userID uuid.UUID, limit, offset int) ([]*
 	return files, nil
 }
 
+// GetFilesByUserIDSorted retrieves a user's files sorted by "name", "size", "type" or "date",
+// "asc" or "desc". Unknown values fall back to the default order, newest first.
+func (s *FileService) GetFilesByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	return s.fileRepo.GetByUserIDSorted(userID, sortBy, sortOrder, limit, offset)
+}
+
+// GetRootFilesByUserIDSorted retrieves a user's files that aren't in any folder, sorted like
+// GetFilesByUserIDSorted
+func (s *FileService) GetRootFilesByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	return s.fileRepo.GetRootByUserIDSorted(userID, sortBy, sortOrder, limit, offset)
+}
+
+// GetFilesPageByUserID retrieves a page of a user's files newest first, continuing after the
+// opaque cursor from a previous page. An empty cursor starts at the newest file.
+func (s *FileService) GetFilesPageByUserID(userID uuid.UUID, after string, limit int) (*models.FilePage, error) {
+	var cursor *models.FileCursor
+	if after != "" {
+		decoded, err := models.DecodeFileCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		cursor = decoded
+	}
+
+	// Fetch one extra file to learn whether another page follows
+	files, err := s.fileRepo.GetByUserIDAfter(userID, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.FilePage{Files: files}
+	if len(files) > limit {
+		page.Files = files[:limit]
+		page.HasNextPage = true
+	}
+	if len(page.Files) > 0 {
+		endCursor := models.CursorForFile(page.Files[len(page.Files)-1]).Encode()
+		page.EndCursor = &endCursor
+	}
+	if page.Files == nil {
+		page.Files = []*models.File{}
+	}
+
+	return page, nil
+}
+
+// Default and maximum sizes of the recently accessed list
+const (
+	defaultRecentFilesLimit = 10
+	maxRecentFilesLimit     = 50
+)
+
+// RecordAccess notes that a user previewed or downloaded a file for their recently accessed list
+func (s *FileService) RecordAccess(userID, fileID uuid.UUID, accessType string) error {
+	if accessType != models.FileAccessPreview && accessType != models.FileAccessDownload {
+		return fmt.Errorf("invalid access type: %s", accessType)
+	}
+	return s.fileRepo.RecordAccess(userID, fileID, accessType)
+}
+
+// GetRecentlyAccessed returns the distinct files a user most recently previewed or downloaded,
+// each with the time of its latest access
+func (s *FileService) GetRecentlyAccessed(userID uuid.UUID, limit int) ([]*models.File, error) {
+	if limit <= 0 {
+		limit = defaultRecentFilesLimit
+	}
+	if limit > maxRecentFilesLimit {
+		limit = maxRecentFilesLimit
+	}
+
+	files, err := s.fileRepo.GetRecentlyAccessedByUser(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		files = []*models.File{}
+	}
+
+	return files, nil
+}
+
 // GetFilesByFolderID retrieves files in a specific folder for a user
 func (s *FileService) GetFilesByFolderID(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error) {
 	fmt.Printf("DEBUG: FileService.GetFilesByFolderID called - User: %s, Folder: %s\n", userID, folderID)
 	return s.fileRepo.GetByUserIDAndFolderID(userID, folderID, limit, offset)
 }
 
+// GetFilesByFolderRecursive retrieves files in a folder and all of its subfolders for a user,
+// paginated across the combined set (newest first)
+func (s *FileService) GetFilesByFolderRecursive(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error) {
+	if s.folderRepo == nil {
+		return nil, fmt.Errorf("folder repository not configured")
+	}
+
+	folder, err := s.folderRepo.GetByID(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder: %w", err)
+	}
+	if folder == nil {
+		return nil, fmt.Errorf("folder not found")
+	}
+	if folder.OwnerID != userID {
+		return nil, fmt.Errorf("folder does not belong to you")
+	}
+
+	return s.fileRepo.GetByUserIDAndFolderIDRecursive(userID, folderID, limit, offset)
+}
+
 // SearchFilesByUserID searches files for a specific user
 func (s *FileService) SearchFilesByUserID(userID uuid.UUID, searchTerm string, limit, offset int) ([]*models.File, error) {
 	return s.fileRepo.SearchByUserID(userID, searchTerm, limit, offset)
@@ -296,8 +763,212 @@ func (s *FileService) GetFileByID(fileID uuid.UUID) (*models.File, error) {
 	return s.fileRepo.GetByID(fileID)
 }
 
+// CheckHashExists tells a client that hashed a file locally whether the user already has a file
+// with that content, so the upload can be skipped. Only the user's own files count: content other
+// users stored is never reported, whatever the deduplication scope. Private copies uploaded
+// without deduplication don't count either.
+func (s *FileService) CheckHashExists(userID uuid.UUID, hash string) (bool, *uuid.UUID, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if len(hash) != sha256.Size*2 {
+		return false, nil, fmt.Errorf("invalid hash: expected a hex-encoded SHA-256 digest")
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return false, nil, fmt.Errorf("invalid hash: expected a hex-encoded SHA-256 digest")
+	}
+
+	files, err := s.fileRepo.GetByHash(hash)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to check existing files: %w", err)
+	}
+	for _, file := range files {
+		if file.UploaderID == userID && !file.DedupDisabled {
+			return true, &file.ID, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
+// FindSimilarImages returns images whose perceptual hash is within threshold bits of the given
+// image's, closest first. Users search their own images; admins search every user's. A nil
+// threshold uses DefaultSimilarImageThreshold.
+func (s *FileService) FindSimilarImages(userID, fileID uuid.UUID, threshold *int, isAdmin bool) ([]*models.SimilarImage, error) {
+	maxDistance := DefaultSimilarImageThreshold
+	if threshold != nil {
+		maxDistance = *threshold
+	}
+	if maxDistance < 0 || maxDistance > 64 {
+		return nil, fmt.Errorf("threshold must be between 0 and 64")
+	}
+
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil || (!isAdmin && file.UploaderID != userID) {
+		return nil, fmt.Errorf("file not found")
+	}
+	if file.PerceptualHash == nil {
+		return nil, fmt.Errorf("file has no perceptual hash: only JPEG, PNG and GIF images are hashed")
+	}
+
+	var scope *uuid.UUID
+	if !isAdmin {
+		scope = &userID
+	}
+	candidates, err := s.fileRepo.GetWithPerceptualHash(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	similar := []*models.SimilarImage{}
+	for _, candidate := range candidates {
+		if candidate.ID == file.ID || candidate.PerceptualHash == nil {
+			continue
+		}
+		distance := HammingDistance(uint64(*file.PerceptualHash), uint64(*candidate.PerceptualHash))
+		if distance <= maxDistance {
+			similar = append(similar, &models.SimilarImage{File: candidate, Distance: distance})
+		}
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Distance < similar[j].Distance
+	})
+
+	return similar, nil
+}
+
+// sanitizeDownloadName drops control characters from a download name override and trims it,
+// rejecting names that are too long or contain path separators. An empty result clears the override.
+func sanitizeDownloadName(name string) (string, error) {
+	cleaned := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(name, "")))
+	if len(cleaned) > 255 {
+		return "", fmt.Errorf("download name must be at most 255 characters")
+	}
+	if strings.ContainsAny(cleaned, "/\\") {
+		return "", fmt.Errorf("download name must not contain path separators")
+	}
+	if cleaned == "." || cleaned == ".." {
+		return "", fmt.Errorf("invalid download name")
+	}
+	return cleaned, nil
+}
+
+// maxFileDescriptionLength caps the size of the free-text description attached to a file
+const maxFileDescriptionLength = 2000
+
+// UpdateFileMetadata renames a file and/or edits its description and download name (only if user
+// is the uploader). A nil argument leaves the field unchanged; an empty description or download
+// name clears it. Renaming only changes original_name - the stored filename, hash and S3 object
+// are left as they are. The download name only changes what downloads are saved as, not the name
+// the file is listed and searched under.
+func (s *FileService) UpdateFileMetadata(fileID uuid.UUID, userID uuid.UUID, description *string, originalName *string, downloadName *string) (*models.File, error) {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+
+	if file.UploaderID != userID {
+		return nil, fmt.Errorf("unauthorized: only the uploader can edit this file")
+	}
+
+	newName := file.OriginalName
+	if originalName != nil {
+		newName = strings.TrimSpace(*originalName)
+		if newName == "" {
+			return nil, fmt.Errorf("file name is required")
+		}
+		if len(newName) > 255 {
+			return nil, fmt.Errorf("file name must be at most 255 characters")
+		}
+		if strings.ContainsAny(newName, "/\\") {
+			return nil, fmt.Errorf("file name must not contain path separators")
+		}
+	}
+
+	newDescription := file.Description
+	if description != nil {
+		trimmed := strings.TrimSpace(*description)
+		if len(trimmed) > maxFileDescriptionLength {
+			return nil, fmt.Errorf("description must be at most %d characters", maxFileDescriptionLength)
+		}
+		if trimmed == "" {
+			newDescription = nil
+		} else {
+			newDescription = &trimmed
+		}
+	}
+
+	newDownloadName := file.DownloadName
+	if downloadName != nil {
+		cleaned, err := sanitizeDownloadName(*downloadName)
+		if err != nil {
+			return nil, err
+		}
+		if cleaned == "" {
+			newDownloadName = nil
+		} else {
+			newDownloadName = &cleaned
+		}
+	}
+
+	if err := s.fileRepo.UpdateMetadata(fileID, newName, newDescription, newDownloadName, userID); err != nil {
+		fmt.Printf("ERROR: FileService.UpdateFileMetadata failed: %v\n", err)
+		return nil, err
+	}
+
+	updated, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file: %w", err)
+	}
+
+	fmt.Printf("SUCCESS: FileService.UpdateFileMetadata updated file %s\n", fileID)
+	return updated, nil
+}
+
+// SetPublic makes a file downloadable by anyone from its canonical public URL, or private again.
+// Only the uploader can change a file's visibility.
+func (s *FileService) SetPublic(fileID uuid.UUID, userID uuid.UUID, public bool) (*models.File, error) {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+
+	if file.UploaderID != userID {
+		return nil, fmt.Errorf("unauthorized: only the uploader can change file visibility")
+	}
+
+	if err := s.fileRepo.SetPublic(fileID, public); err != nil {
+		return nil, err
+	}
+
+	file.IsPublic = public
+	return file, nil
+}
+
+// RecordPublicDownload logs an anonymous download of a public file
+func (s *FileService) RecordPublicDownload(fileID uuid.UUID, ipAddress, userAgent string) error {
+	return s.downloadRepo.Create(&models.Download{
+		ID:        uuid.New(),
+		FileID:    fileID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+}
+
 // DeleteFile deletes a file (only if user is the uploader)
-func (s *FileService) DeleteFile(fileID uuid.UUID, userID uuid.UUID) error {
+func (s *FileService) DeleteFile(ctx context.Context, fileID uuid.UUID, userID uuid.UUID) error {
 	// Get file to verify ownership
 	file, err := s.fileRepo.GetByID(fileID)
 	if err != nil {
@@ -323,22 +994,131 @@ func (s *FileService) DeleteFile(fileID uuid.UUID, userID uuid.UUID) error {
 		return fmt.Errorf("failed to delete file record: %w", err)
 	}
 
+	// A private copy owns its object, so it goes with the record
+	if file.DedupDisabled {
+		if file.S3Key != "" {
+			s.cleanupObject(ctx, file.S3Key)
+		}
+		return nil
+	}
+
 	// Check if there are other references to this file
 	otherFiles, err := s.fileRepo.GetByHash(file.Hash)
-	if err != nil || len(otherFiles) == 0 {
+	if err != nil || len(copiesOfObject(otherFiles, file.S3Key)) == 0 {
 		// No other references, delete the S3 file and hash record
-		fileHash, err := s.fileHashRepo.GetByHash(file.Hash)
-		if err == nil {
+		fileHash, err := s.hashRecordFor(file)
+		if err == nil && fileHash != nil {
 			if fileHash.S3Key != "" {
-				s.s3Service.DeleteFile(context.Background(), fileHash.S3Key) // Remove S3 file
+				s.cleanupObject(ctx, fileHash.S3Key) // Remove S3 file
 			}
-			s.fileHashRepo.Delete(file.Hash) // Remove hash record
+			s.fileHashRepo.Delete(fileHash.ID) // Remove hash record
 		}
 	}
+	// Thumbnails are kept per hash, so they stay while another stored copy of the content remains
+	if s.thumbnailService != nil && (err != nil || len(sharedCopies(otherFiles)) == 0) {
+		s.thumbnailService.DeleteForHash(ctx, file.Hash)
+	}
 
 	return nil
 }
 
+// cleanupObject deletes an S3 object whose database record is already gone. It runs even if the
+// request was cancelled, since skipping it would orphan the object, but with its own time limit.
+func (s *FileService) cleanupObject(ctx context.Context, s3Key string) {
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s3CleanupTimeout)
+	defer cancel()
+	if err := s.s3Service.DeleteFile(cleanupCtx, s3Key); err != nil {
+		fmt.Printf("ERROR: Failed to delete S3 object %s: %v\n", s3Key, err)
+	}
+}
+
+// GetOriginal returns the file whose stored content a deduplicated file reuses, or nil if the
+// file stored its own content. If the recorded original has been deleted, the earliest other
+// file still referencing the same content is returned instead.
+func (s *FileService) GetOriginal(fileID uuid.UUID) (*models.File, error) {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+	if file.OriginalFileID == nil || file.DedupDisabled {
+		return nil, nil
+	}
+
+	original, err := s.fileRepo.GetByID(*file.OriginalFileID)
+	if err != nil {
+		return nil, err
+	}
+	if original != nil {
+		return original, nil
+	}
+
+	copies, err := s.fileRepo.GetByHash(file.Hash)
+	if err != nil {
+		return nil, err
+	}
+	fallback := pickOriginal(copiesOfObject(copies, file.S3Key), file.UploaderID, file.ID)
+	if fallback == nil {
+		return nil, nil
+	}
+	// GetByHash doesn't load the uploader, so return the full record
+	return s.fileRepo.GetByID(fallback.ID)
+}
+
+// pickOriginal chooses which of the files sharing some content another file should point to as
+// its original: the uploader's own earliest copy if there is one, otherwise the earliest overall.
+// The file itself (excludeID) is never chosen.
+func pickOriginal(candidates []*models.File, uploaderID, excludeID uuid.UUID) *models.File {
+	var best *models.File
+	for _, candidate := range candidates {
+		if candidate.ID == excludeID {
+			continue
+		}
+		if best == nil {
+			best = candidate
+			continue
+		}
+		sameUploader, bestSameUploader := candidate.UploaderID == uploaderID, best.UploaderID == uploaderID
+		if sameUploader != bestSameUploader {
+			if sameUploader {
+				best = candidate
+			}
+			continue
+		}
+		if candidate.CreatedAt.Before(best.CreatedAt) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// sharedCopies filters files down to those referencing the deduplicated object for their hash,
+// leaving out private copies that store their own
+func sharedCopies(files []*models.File) []*models.File {
+	shared := make([]*models.File, 0, len(files))
+	for _, file := range files {
+		if !file.DedupDisabled {
+			shared = append(shared, file)
+		}
+	}
+	return shared
+}
+
+// copiesOfObject filters files down to those referencing the deduplicated object s3Key. Under
+// the per-user deduplication scope other users' copies of the same content have objects of
+// their own.
+func copiesOfObject(files []*models.File, s3Key string) []*models.File {
+	copies := make([]*models.File, 0, len(files))
+	for _, file := range sharedCopies(files) {
+		if file.S3Key == s3Key {
+			copies = append(copies, file)
+		}
+	}
+	return copies
+}
+
 // generateFilename generates a unique filename
 func (s *FileService) generateFilename(originalName string) string {
 	ext := filepath.Ext(originalName)
@@ -0,0 +1,1103 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileService_UpdateFileMetadata_RenamesAndSetsDescription(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "old.txt", Filename: "stored.txt", Hash: "abc"}
+	name := "  new.txt "
+	description := "quarterly numbers"
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+	mockFileRepo.On("UpdateMetadata", fileID, "new.txt", mock.MatchedBy(func(d *string) bool {
+		return d != nil && *d == "quarterly numbers"
+	}), (*string)(nil), userID).Return(nil)
+
+	_, err := service.UpdateFileMetadata(fileID, userID, &description, &name, nil)
+
+	assert.NoError(t, err)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_UpdateFileMetadata_EmptyDescriptionClears(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	existing := "old notes"
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "report.pdf", Description: &existing}
+	empty := "   "
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+	mockFileRepo.On("UpdateMetadata", fileID, "report.pdf", (*string)(nil), (*string)(nil), userID).Return(nil)
+
+	_, err := service.UpdateFileMetadata(fileID, userID, &empty, nil, nil)
+
+	assert.NoError(t, err)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_UpdateFileMetadata_RejectsNonOwner(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: uuid.New(), OriginalName: "report.pdf"}
+	name := "renamed.pdf"
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+
+	_, err := service.UpdateFileMetadata(fileID, uuid.New(), nil, &name, nil)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	mockFileRepo.AssertNotCalled(t, "UpdateMetadata", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileService_UpdateFileMetadata_RejectsInvalidName(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "report.pdf"}
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+
+	for _, name := range []string{"", "   ", "../etc/passwd", "a\\b"} {
+		n := name
+		_, err := service.UpdateFileMetadata(fileID, userID, nil, &n, nil)
+		assert.Error(t, err, "name %q should be rejected", name)
+	}
+	mockFileRepo.AssertNotCalled(t, "UpdateMetadata", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileService_UpdateFileMetadata_SetsDownloadName(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "scan_0042.pdf"}
+	downloadName := " Invoice\n 2024.pdf "
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+	mockFileRepo.On("UpdateMetadata", fileID, "scan_0042.pdf", (*string)(nil), mock.MatchedBy(func(d *string) bool {
+		return d != nil && *d == "Invoice 2024.pdf"
+	}), userID).Return(nil)
+
+	_, err := service.UpdateFileMetadata(fileID, userID, nil, nil, &downloadName)
+
+	assert.NoError(t, err, "control characters are dropped and the listed name is unchanged")
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_UpdateFileMetadata_EmptyDownloadNameClears(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	existing := "Invoice 2024.pdf"
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "scan_0042.pdf", DownloadName: &existing}
+	empty := " "
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+	mockFileRepo.On("UpdateMetadata", fileID, "scan_0042.pdf", (*string)(nil), (*string)(nil), userID).Return(nil)
+
+	_, err := service.UpdateFileMetadata(fileID, userID, nil, nil, &empty)
+
+	assert.NoError(t, err)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_UpdateFileMetadata_RejectsInvalidDownloadName(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "report.pdf"}
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+
+	for _, name := range []string{"../report.pdf", "a\\b", "..", strings.Repeat("x", 256)} {
+		n := name
+		_, err := service.UpdateFileMetadata(fileID, userID, nil, nil, &n)
+		assert.Error(t, err, "download name %q should be rejected", name)
+	}
+	mockFileRepo.AssertNotCalled(t, "UpdateMetadata", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileService_SetPublic(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "poster.png"}
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+	mockFileRepo.On("SetPublic", fileID, true).Return(nil)
+
+	updated, err := service.SetPublic(fileID, userID, true)
+
+	require.NoError(t, err)
+	assert.True(t, updated.IsPublic)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_SetPublic_RejectsNonOwner(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	fileID := uuid.New()
+	file := &models.File{ID: fileID, UploaderID: uuid.New(), OriginalName: "poster.png"}
+
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+
+	_, err := service.SetPublic(fileID, uuid.New(), true)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+	mockFileRepo.AssertNotCalled(t, "SetPublic", mock.Anything, mock.Anything)
+}
+
+func TestFileService_GetFilesByFolderRecursive_VerifiesFolderOwner(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockFolderRepo := new(MockFolderRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, mockFolderRepo)
+
+	folderID := uuid.New()
+	mockFolderRepo.On("GetByID", folderID).Return(&models.Folder{ID: folderID, OwnerID: uuid.New()}, nil)
+
+	_, err := service.GetFilesByFolderRecursive(uuid.New(), folderID, 10, 0)
+
+	assert.Error(t, err)
+	mockFileRepo.AssertNotCalled(t, "GetByUserIDAndFolderIDRecursive", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileService_GetFilesByFolderRecursive_ReturnsFolderTreeFiles(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockFolderRepo := new(MockFolderRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, mockFolderRepo)
+
+	userID := uuid.New()
+	folderID := uuid.New()
+	files := []*models.File{{ID: uuid.New()}, {ID: uuid.New()}}
+	mockFolderRepo.On("GetByID", folderID).Return(&models.Folder{ID: folderID, OwnerID: userID}, nil)
+	mockFileRepo.On("GetByUserIDAndFolderIDRecursive", userID, folderID, 10, 20).Return(files, nil)
+
+	result, err := service.GetFilesByFolderRecursive(userID, folderID, 10, 20)
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_GetFilesPageByUserID(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	now := time.Now().UTC()
+	files := []*models.File{
+		{ID: uuid.New(), CreatedAt: now},
+		{ID: uuid.New(), CreatedAt: now.Add(-time.Minute)},
+		{ID: uuid.New(), CreatedAt: now.Add(-2 * time.Minute)},
+	}
+
+	// First page: one extra row comes back, so another page follows
+	mockFileRepo.On("GetByUserIDAfter", userID, (*models.FileCursor)(nil), 3).Return(files, nil).Once()
+
+	page, err := service.GetFilesPageByUserID(userID, "", 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Files, 2)
+	assert.True(t, page.HasNextPage)
+	require.NotNil(t, page.EndCursor)
+
+	cursor, err := models.DecodeFileCursor(*page.EndCursor)
+	require.NoError(t, err)
+	assert.Equal(t, files[1].ID, cursor.ID)
+	assert.True(t, files[1].CreatedAt.Equal(cursor.CreatedAt))
+
+	// Second page continues after the cursor and is the last one
+	mockFileRepo.On("GetByUserIDAfter", userID, cursor, 3).Return(files[2:], nil).Once()
+
+	page, err = service.GetFilesPageByUserID(userID, *page.EndCursor, 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Files, 1)
+	assert.False(t, page.HasNextPage)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_GetFilesPageByUserID_InvalidCursor(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	_, err := service.GetFilesPageByUserID(uuid.New(), "not-a-cursor", 10)
+	assert.ErrorIs(t, err, models.ErrInvalidCursor)
+	mockFileRepo.AssertNotCalled(t, "GetByUserIDAfter", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileService_GetFilesPageByUserID_Empty(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	mockFileRepo.On("GetByUserIDAfter", userID, (*models.FileCursor)(nil), 11).Return([]*models.File(nil), nil)
+
+	page, err := service.GetFilesPageByUserID(userID, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, page.Files)
+	assert.NotNil(t, page.Files)
+	assert.Nil(t, page.EndCursor)
+	assert.False(t, page.HasNextPage)
+}
+
+func TestFileService_GetRecentlyAccessed_ClampsLimit(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	accessed := time.Now()
+	recent := []*models.File{{ID: uuid.New(), LastAccessedAt: &accessed}}
+	mockFileRepo.On("GetRecentlyAccessedByUser", userID, 10).Return(recent, nil).Once()
+	mockFileRepo.On("GetRecentlyAccessedByUser", userID, 50).Return([]*models.File(nil), nil).Once()
+
+	files, err := service.GetRecentlyAccessed(userID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, recent, files)
+
+	files, err = service.GetRecentlyAccessed(userID, 500)
+	require.NoError(t, err)
+	assert.NotNil(t, files)
+	assert.Empty(t, files)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_RecordAccess(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID, fileID := uuid.New(), uuid.New()
+	mockFileRepo.On("RecordAccess", userID, fileID, models.FileAccessDownload).Return(nil).Once()
+
+	require.NoError(t, service.RecordAccess(userID, fileID, models.FileAccessDownload))
+	assert.Error(t, service.RecordAccess(userID, fileID, "edit"))
+	mockFileRepo.AssertExpectations(t)
+}
+
+// MockFileHashRepository is a mock implementation of FileHashRepositoryInterface
+type MockFileHashRepository struct {
+	mock.Mock
+}
+
+func (m *MockFileHashRepository) Create(fileHash *models.FileHash) error {
+	args := m.Called(fileHash)
+	return args.Error(0)
+}
+
+func (m *MockFileHashRepository) GetByHash(hash string) (*models.FileHash, error) {
+	args := m.Called(hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FileHash), args.Error(1)
+}
+
+func (m *MockFileHashRepository) GetByOwnerAndHash(ownerID uuid.UUID, hash string) (*models.FileHash, error) {
+	args := m.Called(ownerID, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FileHash), args.Error(1)
+}
+
+func (m *MockFileHashRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+// uploadFixture is an in-memory multipart upload
+type uploadFixture struct {
+	*bytes.Reader
+}
+
+func (uploadFixture) Close() error { return nil }
+
+func newUploadFixture(name string, content []byte) (multipart.File, *multipart.FileHeader, string) {
+	header := &multipart.FileHeader{
+		Filename: name,
+		Size:     int64(len(content)),
+		Header:   textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}},
+	}
+	sum := sha256.Sum256(content)
+	return uploadFixture{bytes.NewReader(content)}, header, hex.EncodeToString(sum[:])
+}
+
+func TestFileService_UploadFile_DuplicateContentCreatesReference(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	file, header, hash := newUploadFixture("notes.txt", []byte("the same notes as before"))
+	original := &models.File{ID: uuid.New(), Hash: hash, S3Key: "files/existing", UploaderID: uuid.New(), CreatedAt: time.Now().Add(-time.Hour)}
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{original}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, userID, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Deduplicated)
+	assert.False(t, result.ExistingFile)
+	assert.Equal(t, header.Size, result.BytesSaved)
+	assert.True(t, result.File.IsDuplicate)
+	assert.Equal(t, "files/existing", result.File.S3Key)
+	require.NotNil(t, result.File.OriginalFileID)
+	assert.Equal(t, original.ID, *result.File.OriginalFileID)
+	mockFileRepo.AssertNotCalled(t, "GetByUploaderFolderAndHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFileService_UploadFile_ReuseModeReturnsExistingRecord(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	service.SetDuplicateUploadMode(DuplicateUploadReuse)
+
+	userID := uuid.New()
+	folderID := uuid.New()
+	file, header, hash := newUploadFixture("notes.txt", []byte("the same notes as before"))
+	existing := &models.File{ID: uuid.New(), OriginalName: "notes.txt", Hash: hash, UploaderID: userID, FolderID: &folderID}
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByUploaderFolderAndHash", userID, &folderID, hash, "notes.txt").Return(existing, nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, userID, &folderID)
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, result.File.ID)
+	assert.True(t, result.Deduplicated)
+	assert.True(t, result.ExistingFile)
+	assert.Equal(t, header.Size, result.BytesSaved)
+	mockFileRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestFileService_UploadFile_ReuseModeWithoutCopyCreatesReference(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	service.SetDuplicateUploadMode(DuplicateUploadReuse)
+
+	userID := uuid.New()
+	file, header, hash := newUploadFixture("copy.txt", []byte("the same notes as before"))
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByUploaderFolderAndHash", userID, (*uuid.UUID)(nil), hash, "copy.txt").Return(nil, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, userID, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Deduplicated)
+	assert.False(t, result.ExistingFile)
+	mockFileRepo.AssertCalled(t, "Create", mock.AnythingOfType("*models.File"))
+}
+
+// streamingS3Stub records the body handed to S3 for an upload
+type streamingS3Stub struct {
+	S3ServiceInterface
+	body     io.Reader
+	uploaded []byte
+	deleted  []string
+}
+
+func (s *streamingS3Stub) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	s.body = file
+	data, err := io.ReadAll(file)
+	s.uploaded = data
+	return "https://bucket.s3.amazonaws.com/files/" + filename, err
+}
+
+func (s *streamingS3Stub) ExtractKeyFromURL(url string) string {
+	return strings.TrimPrefix(url, "https://bucket.s3.amazonaws.com/")
+}
+
+func (s *streamingS3Stub) DeleteFile(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestFileService_UploadFile_StreamsSpilledFileToS3(t *testing.T) {
+	const memoryLimit = 1024
+
+	// A PNG signature followed by more data than the multipart memory limit
+	content := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0x42}, 64*1024)...)
+	sum := sha256.Sum256(content)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="file"; filename="image.png"`},
+		"Content-Type":        {"image/png"},
+	})
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	require.NoError(t, req.ParseMultipartForm(memoryLimit))
+	defer req.MultipartForm.RemoveAll()
+
+	header := req.MultipartForm.File["file"][0]
+	file, err := header.Open()
+	require.NoError(t, err)
+	defer file.Close()
+	_, onDisk := file.(*os.File)
+	require.True(t, onDisk, "upload larger than the memory limit should be spilled to disk")
+
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+	mockHashRepo.On("GetByHash", hex.EncodeToString(sum[:])).Return(nil, nil)
+	mockHashRepo.On("Create", mock.AnythingOfType("*models.FileHash")).Return(nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, hex.EncodeToString(sum[:]), result.File.Hash)
+	assert.Equal(t, io.Reader(file), s3Stub.body, "the temp file should be streamed rather than buffered")
+	assert.Equal(t, content, s3Stub.uploaded)
+}
+
+func TestFileService_UploadFileWithOptions_DedupDisabledStoresPrivateCopy(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+
+	content := []byte("the same notes as before")
+	file, header, hash := newUploadFixture("notes.txt", content)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFileWithOptions(context.Background(), file, header, uuid.New(), nil, UploadOptions{DisableDedup: true})
+	require.NoError(t, err)
+	assert.False(t, result.Deduplicated)
+	assert.True(t, result.File.DedupDisabled)
+	assert.Equal(t, hash, result.File.Hash)
+	assert.Equal(t, "files/notes.txt", result.File.S3Key)
+	assert.Equal(t, content, s3Stub.uploaded)
+	// Existing content is neither looked up nor indexed for others to reuse
+	mockHashRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+	mockHashRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestFileService_UploadFileWithOptions_DedupEnabledByDefault(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	file, header, hash := newUploadFixture("notes.txt", []byte("the same notes as before"))
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFileWithOptions(context.Background(), file, header, uuid.New(), nil, UploadOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Deduplicated)
+	assert.False(t, result.File.DedupDisabled)
+	assert.Equal(t, "files/existing", result.File.S3Key)
+}
+
+// fakeDedupPreferences reports the users in optedOut as opted out of deduplication
+type fakeDedupPreferences struct {
+	optedOut map[uuid.UUID]bool
+	err      error
+}
+
+func (f *fakeDedupPreferences) GetDedupOptOut(userID uuid.UUID) (bool, error) {
+	return f.optedOut[userID], f.err
+}
+
+func TestFileService_UploadFile_DedupOptOutStoresDistinctObject(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+
+	optedOut, other := uuid.New(), uuid.New()
+	service.SetDedupPreferences(&fakeDedupPreferences{optedOut: map[uuid.UUID]bool{optedOut: true}})
+
+	content := []byte("the same notes as before")
+	_, _, hash := newUploadFixture("notes.txt", content)
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	file, header, _ := newUploadFixture("notes.txt", content)
+	shared, err := service.UploadFile(context.Background(), file, header, other, nil)
+	require.NoError(t, err)
+	assert.True(t, shared.Deduplicated)
+	assert.Equal(t, "files/existing", shared.File.S3Key)
+
+	file, header, _ = newUploadFixture("notes.txt", content)
+	private, err := service.UploadFile(context.Background(), file, header, optedOut, nil)
+	require.NoError(t, err)
+	assert.False(t, private.Deduplicated)
+	assert.True(t, private.File.DedupDisabled)
+	assert.Equal(t, hash, private.File.Hash)
+	assert.NotEqual(t, shared.File.S3Key, private.File.S3Key)
+	assert.Equal(t, content, s3Stub.uploaded)
+	// The private object is not indexed, so later uploads by others can't reuse it
+	mockHashRepo.AssertNotCalled(t, "Create", mock.Anything)
+	mockHashRepo.AssertNumberOfCalls(t, "GetByHash", 1)
+}
+
+func TestFileService_UploadFile_UnreadableDedupPreferenceStoresPrivateCopy(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+	service.SetDedupPreferences(&fakeDedupPreferences{err: assert.AnError})
+
+	file, header, _ := newUploadFixture("notes.txt", []byte("the same notes as before"))
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.NoError(t, err)
+	assert.True(t, result.File.DedupDisabled)
+	mockHashRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+}
+
+func TestFileService_DeleteFile_PrivateCopyRemovesOwnObject(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	private := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/private", UploaderID: userID, DedupDisabled: true}
+	mockFileRepo.On("GetByID", private.ID).Return(private, nil)
+	mockFileRepo.On("Delete", private.ID).Return(nil)
+
+	require.NoError(t, service.DeleteFile(context.Background(), private.ID, userID))
+	assert.Equal(t, []string{"files/private"}, s3Stub.deleted)
+	mockFileRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+	mockHashRepo.AssertNotCalled(t, "Delete", mock.Anything)
+}
+
+func TestFileService_DeleteFile_IgnoresPrivateCopiesWhenCountingReferences(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	shared := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/shared", UploaderID: userID}
+	private := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/private", DedupDisabled: true}
+	mockFileRepo.On("GetByID", shared.ID).Return(shared, nil)
+	mockFileRepo.On("Delete", shared.ID).Return(nil)
+	mockFileRepo.On("GetByHash", "abc").Return([]*models.File{private}, nil)
+	hashID := uuid.New()
+	mockHashRepo.On("GetByHash", "abc").Return(&models.FileHash{ID: hashID, Hash: "abc", S3Key: "files/shared"}, nil)
+	mockHashRepo.On("Delete", hashID).Return(nil)
+
+	require.NoError(t, service.DeleteFile(context.Background(), shared.ID, userID))
+	assert.Equal(t, []string{"files/shared"}, s3Stub.deleted, "the private copy's object must survive")
+	mockHashRepo.AssertCalled(t, "Delete", hashID)
+}
+
+func TestFileService_DeleteFile_KeepsObjectWhileSharedReferencesRemain(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	deleted := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/shared", UploaderID: userID}
+	other := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/shared"}
+	mockFileRepo.On("GetByID", deleted.ID).Return(deleted, nil)
+	mockFileRepo.On("Delete", deleted.ID).Return(nil)
+	mockFileRepo.On("GetByHash", "abc").Return([]*models.File{other}, nil)
+
+	require.NoError(t, service.DeleteFile(context.Background(), deleted.ID, userID))
+	assert.Empty(t, s3Stub.deleted)
+	mockHashRepo.AssertNotCalled(t, "Delete", mock.Anything)
+}
+
+func TestFileService_DeleteFile_PerUserCopyKeepsOtherUsersObjects(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	deleted := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/mine", UploaderID: userID}
+	others := &models.File{ID: uuid.New(), Hash: "abc", S3Key: "files/theirs", UploaderID: uuid.New()}
+	hashID := uuid.New()
+	mockFileRepo.On("GetByID", deleted.ID).Return(deleted, nil)
+	mockFileRepo.On("Delete", deleted.ID).Return(nil)
+	mockFileRepo.On("GetByHash", "abc").Return([]*models.File{others}, nil)
+	mockHashRepo.On("GetByHash", "abc").Return(&models.FileHash{Hash: "abc", S3Key: "files/theirs"}, nil)
+	mockHashRepo.On("GetByOwnerAndHash", userID, "abc").Return(&models.FileHash{ID: hashID, Hash: "abc", S3Key: "files/mine", OwnerID: &userID}, nil)
+	mockHashRepo.On("Delete", hashID).Return(nil)
+
+	require.NoError(t, service.DeleteFile(context.Background(), deleted.ID, userID))
+	assert.Equal(t, []string{"files/mine"}, s3Stub.deleted, "another user's copy of the content must survive")
+	mockHashRepo.AssertCalled(t, "Delete", hashID)
+}
+
+type staticUploadGate bool
+
+func (g staticUploadGate) UploadsEnabled() bool { return bool(g) }
+
+func TestFileService_UploadFile_RejectedWhileUploadsDisabled(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	service.SetUploadGate(staticUploadGate(false))
+
+	file, header, _ := newUploadFixture("notes.txt", []byte("paused"))
+	result, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrUploadsDisabled)
+	assert.Nil(t, result)
+	mockHashRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+	mockFileRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+type quotaCheckerFunc func(userID uuid.UUID, fileSize int64) error
+
+func (f quotaCheckerFunc) CheckQuota(userID uuid.UUID, fileSize int64) error {
+	return f(userID, fileSize)
+}
+
+func TestFileService_UploadFile_RejectedOverQuota(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	uploaderID := uuid.New()
+	var checkedUser uuid.UUID
+	var checkedSize int64
+	service.SetQuotaChecker(quotaCheckerFunc(func(userID uuid.UUID, fileSize int64) error {
+		checkedUser, checkedSize = userID, fileSize
+		return ErrQuotaExceeded
+	}))
+
+	file, header, _ := newUploadFixture("notes.txt", []byte("too much"))
+	result, err := service.UploadFile(context.Background(), file, header, uploaderID, nil)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Nil(t, result)
+	assert.Equal(t, uploaderID, checkedUser)
+	assert.Equal(t, header.Size, checkedSize)
+	mockHashRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+	mockFileRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+// memoryIdempotencyStore keeps upload idempotency keys in memory; a key reserved by an upload
+// that hasn't finished maps to uuid.Nil
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]uuid.UUID
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: map[string]uuid.UUID{}}
+}
+
+func (m *memoryIdempotencyStore) Reserve(userID uuid.UUID, key string, since, pendingSince time.Time) (bool, *uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fileID, ok := m.keys[userID.String()+"/"+key]
+	if !ok {
+		m.keys[userID.String()+"/"+key] = uuid.Nil
+		return true, nil, nil
+	}
+	if fileID == uuid.Nil {
+		return false, nil, nil
+	}
+	return false, &fileID, nil
+}
+
+func (m *memoryIdempotencyStore) Complete(userID uuid.UUID, key string, fileID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[userID.String()+"/"+key] = fileID
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Release(userID uuid.UUID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keys[userID.String()+"/"+key] == uuid.Nil {
+		delete(m.keys, userID.String()+"/"+key)
+	}
+	return nil
+}
+
+func (m *memoryIdempotencyStore) pending(userID uuid.UUID, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fileID, ok := m.keys[userID.String()+"/"+key]
+	return ok && fileID == uuid.Nil
+}
+
+func TestFileService_UploadFileWithOptions_RepeatedIdempotencyKeyReturnsOriginal(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	service.SetIdempotencyStore(newMemoryIdempotencyStore(), time.Hour)
+
+	userID := uuid.New()
+	content := []byte("uploaded over a flaky network")
+	file, header, hash := newUploadFixture("notes.txt", content)
+	original := &models.File{ID: uuid.New(), Hash: hash, S3Key: "files/existing", UploaderID: uuid.New(), CreatedAt: time.Now().Add(-time.Hour)}
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{original}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+	opts := UploadOptions{IdempotencyKey: "retry-1"}
+
+	first, err := service.UploadFileWithOptions(context.Background(), file, header, userID, nil, opts)
+	require.NoError(t, err)
+	assert.False(t, first.Replayed)
+	mockFileRepo.On("GetByID", first.File.ID).Return(first.File, nil)
+
+	file, header, _ = newUploadFixture("notes.txt", content)
+	second, err := service.UploadFileWithOptions(context.Background(), file, header, userID, nil, opts)
+	require.NoError(t, err)
+	assert.True(t, second.Replayed)
+	assert.Equal(t, first.File.ID, second.File.ID)
+	mockFileRepo.AssertNumberOfCalls(t, "Create", 1)
+
+	// Another user's key with the same value is independent
+	file, header, _ = newUploadFixture("notes.txt", content)
+	other, err := service.UploadFileWithOptions(context.Background(), file, header, uuid.New(), nil, opts)
+	require.NoError(t, err)
+	assert.False(t, other.Replayed)
+	mockFileRepo.AssertNumberOfCalls(t, "Create", 2)
+}
+
+func TestFileService_UploadFileWithOptions_OverlappingRetriesCreateOneFile(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	store := newMemoryIdempotencyStore()
+	service.SetIdempotencyStore(store, time.Hour)
+
+	userID := uuid.New()
+	content := []byte("sent twice by an impatient client")
+	_, _, hash := newUploadFixture("notes.txt", content)
+	existing := &models.File{ID: uuid.New(), Hash: hash, S3Key: "files/existing", UploaderID: uuid.New()}
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{existing}, nil)
+
+	// The first upload stalls while creating its record
+	created := &models.File{}
+	finishCreate := make(chan time.Time)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).WaitUntil(finishCreate).Run(func(args mock.Arguments) {
+		*created = *args.Get(0).(*models.File)
+	}).Return(nil)
+	mockFileRepo.On("GetByID", mock.Anything).Return(created, nil)
+	opts := UploadOptions{IdempotencyKey: "retry-1"}
+
+	upload := func(results chan<- *UploadResult) {
+		file, header, _ := newUploadFixture("notes.txt", content)
+		result, err := service.UploadFileWithOptions(context.Background(), file, header, userID, nil, opts)
+		assert.NoError(t, err)
+		results <- result
+	}
+
+	firstDone := make(chan *UploadResult, 1)
+	go upload(firstDone)
+	require.Eventually(t, func() bool { return store.pending(userID, "retry-1") }, time.Second, 5*time.Millisecond)
+
+	secondDone := make(chan *UploadResult, 1)
+	go upload(secondDone)
+	select {
+	case <-secondDone:
+		t.Fatal("retry finished while the original upload was still running")
+	case <-time.After(3 * idempotencyPollInterval):
+	}
+
+	close(finishCreate)
+	first := <-firstDone
+	second := <-secondDone
+	require.NotNil(t, first)
+	require.NotNil(t, second)
+	assert.False(t, first.Replayed)
+	assert.True(t, second.Replayed)
+	assert.Equal(t, first.File.ID, second.File.ID)
+	mockFileRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestFileService_UploadFileWithOptions_FailedUploadReleasesIdempotencyKey(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	gate := staticUploadGate(false)
+	service.SetUploadGate(&gate)
+	service.SetIdempotencyStore(newMemoryIdempotencyStore(), time.Hour)
+
+	userID := uuid.New()
+	content := []byte("retried after the outage")
+	_, _, hash := newUploadFixture("notes.txt", content)
+	opts := UploadOptions{IdempotencyKey: "retry-1"}
+
+	file, header, _ := newUploadFixture("notes.txt", content)
+	_, err := service.UploadFileWithOptions(context.Background(), file, header, userID, nil, opts)
+	require.ErrorIs(t, err, ErrUploadsDisabled)
+
+	// The retry isn't stuck behind the failed attempt and uploads normally
+	gate = true
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{{ID: uuid.New(), Hash: hash, S3Key: "files/existing", UploaderID: uuid.New()}}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	file, header, _ = newUploadFixture("notes.txt", content)
+	result, err := service.UploadFileWithOptions(context.Background(), file, header, userID, nil, opts)
+	require.NoError(t, err)
+	assert.False(t, result.Replayed)
+	mockFileRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestParseDuplicateUploadMode(t *testing.T) {
+	mode, err := ParseDuplicateUploadMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, DuplicateUploadReference, mode)
+
+	mode, err = ParseDuplicateUploadMode("REUSE")
+	assert.NoError(t, err)
+	assert.Equal(t, DuplicateUploadReuse, mode)
+
+	_, err = ParseDuplicateUploadMode("skip")
+	assert.Error(t, err)
+}
+
+func TestParseDedupScope(t *testing.T) {
+	scope, err := ParseDedupScope("")
+	assert.NoError(t, err)
+	assert.Equal(t, DedupScopeGlobal, scope)
+
+	scope, err = ParseDedupScope(" Per-User ")
+	assert.NoError(t, err)
+	assert.Equal(t, DedupScopePerUser, scope)
+
+	_, err = ParseDedupScope("tenant")
+	assert.Error(t, err)
+}
+
+func TestFileService_UploadFile_GlobalScopeStoresSharedContent(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, &streamingS3Stub{}, NewMimeValidationService(), nil, nil)
+	service.SetDedupScope(DedupScopeGlobal)
+
+	file, header, hash := newUploadFixture("notes.txt", []byte("brand new notes"))
+	mockHashRepo.On("GetByHash", hash).Return(nil, nil)
+	mockHashRepo.On("Create", mock.AnythingOfType("*models.FileHash")).Return(nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	_, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.NoError(t, err)
+	stored := mockHashRepo.Calls[1].Arguments.Get(0).(*models.FileHash)
+	assert.Nil(t, stored.OwnerID, "content stored under the global scope is shared with all users")
+	mockHashRepo.AssertNotCalled(t, "GetByOwnerAndHash", mock.Anything, mock.Anything)
+}
+
+func TestFileService_UploadFile_PerUserScopeOnlyReusesOwnContent(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	s3Stub := &streamingS3Stub{}
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, s3Stub, NewMimeValidationService(), nil, nil)
+	service.SetDedupScope(DedupScopePerUser)
+
+	userID := uuid.New()
+	content := []byte("notes someone else already uploaded")
+	file, header, hash := newUploadFixture("notes.txt", content)
+	mockHashRepo.On("GetByOwnerAndHash", userID, hash).Return(nil, nil)
+	mockHashRepo.On("Create", mock.AnythingOfType("*models.FileHash")).Return(nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, userID, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Deduplicated)
+	assert.Equal(t, content, s3Stub.uploaded, "the user's first copy is stored even if others have it")
+	stored := mockHashRepo.Calls[1].Arguments.Get(0).(*models.FileHash)
+	require.NotNil(t, stored.OwnerID)
+	assert.Equal(t, userID, *stored.OwnerID)
+	mockHashRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+
+	// The user's second upload of the same content reuses their copy
+	file, header, _ = newUploadFixture("notes-again.txt", content)
+	mockHashRepo.On("GetByOwnerAndHash", userID, hash).Unset()
+	mockHashRepo.On("GetByOwnerAndHash", userID, hash).Return(stored, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{result.File}, nil)
+
+	again, err := service.UploadFile(context.Background(), file, header, userID, nil)
+	require.NoError(t, err)
+	assert.True(t, again.Deduplicated)
+	assert.Equal(t, result.File.S3Key, again.File.S3Key)
+	require.NotNil(t, again.File.OriginalFileID)
+	assert.Equal(t, result.File.ID, *again.File.OriginalFileID)
+}
+
+func TestFileService_CheckHashExists(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	ownFile := &models.File{ID: uuid.New(), UploaderID: userID}
+	othersFile := &models.File{ID: uuid.New(), UploaderID: uuid.New()}
+	privateCopy := &models.File{ID: uuid.New(), UploaderID: userID, DedupDisabled: true}
+	_, _, ownHash := newUploadFixture("mine.txt", []byte("mine"))
+	_, _, othersHash := newUploadFixture("theirs.txt", []byte("theirs"))
+	_, _, privateHash := newUploadFixture("private.txt", []byte("private"))
+	_, _, unknownHash := newUploadFixture("new.txt", []byte("new"))
+
+	mockFileRepo.On("GetByHash", ownHash).Return([]*models.File{othersFile, ownFile}, nil)
+	mockFileRepo.On("GetByHash", othersHash).Return([]*models.File{othersFile}, nil)
+	mockFileRepo.On("GetByHash", privateHash).Return([]*models.File{privateCopy}, nil)
+	mockFileRepo.On("GetByHash", unknownHash).Return([]*models.File{}, nil)
+
+	exists, fileID, err := service.CheckHashExists(userID, strings.ToUpper(ownHash))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, &ownFile.ID, fileID)
+
+	// Content only someone else stored isn't reported, so the check reveals nothing about them
+	exists, fileID, err = service.CheckHashExists(userID, othersHash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, fileID)
+
+	exists, fileID, err = service.CheckHashExists(userID, privateHash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, fileID)
+
+	exists, fileID, err = service.CheckHashExists(userID, unknownHash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, fileID)
+	mockHashRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+}
+
+func TestFileService_CheckHashExists_RejectsInvalidHash(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, new(MockFileHashRepository), nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	for _, hash := range []string{"", "abc", strings.Repeat("z", 64)} {
+		_, _, err := service.CheckHashExists(uuid.New(), hash)
+		assert.Error(t, err, hash)
+	}
+	mockFileRepo.AssertNotCalled(t, "GetByHash", mock.Anything)
+}
+
+func TestFileService_GetFilesByUserIDSorted_PassesSortToRepository(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	files := []*models.File{{ID: uuid.New(), OriginalName: "a.txt"}}
+	mockFileRepo.On("GetByUserIDSorted", userID, "name", "asc", 10, 20).Return(files, nil)
+
+	result, err := service.GetFilesByUserIDSorted(userID, "name", "asc", 10, 20)
+	require.NoError(t, err)
+	assert.Equal(t, files, result)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileService_GetRootFilesByUserIDSorted_UsesRootListing(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	files := []*models.File{{ID: uuid.New(), OriginalName: "notes.txt"}}
+	mockFileRepo.On("GetRootByUserIDSorted", userID, "date", "desc", 10, 0).Return(files, nil)
+
+	result, err := service.GetRootFilesByUserIDSorted(userID, "date", "desc", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, files, result)
+	mockFileRepo.AssertNotCalled(t, "GetByUserIDSorted", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPickOriginal_PrefersUploadersEarliestCopy(t *testing.T) {
+	userID := uuid.New()
+	now := time.Now()
+	self := &models.File{ID: uuid.New(), UploaderID: userID, CreatedAt: now}
+	globalFirst := &models.File{ID: uuid.New(), UploaderID: uuid.New(), CreatedAt: now.Add(-3 * time.Hour)}
+	ownLater := &models.File{ID: uuid.New(), UploaderID: userID, CreatedAt: now.Add(-time.Hour)}
+	ownFirst := &models.File{ID: uuid.New(), UploaderID: userID, CreatedAt: now.Add(-2 * time.Hour)}
+
+	assert.Equal(t, ownFirst, pickOriginal([]*models.File{self, globalFirst, ownLater, ownFirst}, userID, self.ID))
+	assert.Equal(t, globalFirst, pickOriginal([]*models.File{self, globalFirst}, userID, self.ID))
+	assert.Nil(t, pickOriginal([]*models.File{self}, userID, self.ID))
+}
+
+func TestFileService_GetOriginal(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	original := &models.File{ID: uuid.New(), Hash: "abc", UploaderID: userID}
+	copyOf := &models.File{ID: uuid.New(), Hash: "abc", UploaderID: userID, OriginalFileID: &original.ID}
+	standalone := &models.File{ID: uuid.New(), Hash: "def", UploaderID: userID}
+	mockFileRepo.On("GetByID", copyOf.ID).Return(copyOf, nil)
+	mockFileRepo.On("GetByID", original.ID).Return(original, nil)
+	mockFileRepo.On("GetByID", standalone.ID).Return(standalone, nil)
+
+	result, err := service.GetOriginal(copyOf.ID)
+	require.NoError(t, err)
+	assert.Equal(t, original, result)
+
+	result, err = service.GetOriginal(standalone.ID)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestFileService_GetOriginal_FallsBackWhenOriginalDeleted(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	userID := uuid.New()
+	deletedID := uuid.New()
+	now := time.Now()
+	copyOf := &models.File{ID: uuid.New(), Hash: "abc", UploaderID: userID, OriginalFileID: &deletedID, CreatedAt: now}
+	remaining := &models.File{ID: uuid.New(), Hash: "abc", UploaderID: uuid.New(), CreatedAt: now.Add(-time.Hour)}
+	private := &models.File{ID: uuid.New(), Hash: "abc", UploaderID: userID, DedupDisabled: true, CreatedAt: now.Add(-2 * time.Hour)}
+	mockFileRepo.On("GetByID", copyOf.ID).Return(copyOf, nil)
+	mockFileRepo.On("GetByID", deletedID).Return((*models.File)(nil), nil)
+	mockFileRepo.On("GetByHash", "abc").Return([]*models.File{copyOf, remaining, private}, nil)
+	mockFileRepo.On("GetByID", remaining.ID).Return(remaining, nil)
+
+	result, err := service.GetOriginal(copyOf.ID)
+	require.NoError(t, err)
+	assert.Equal(t, remaining, result)
+}
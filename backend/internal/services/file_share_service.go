@@ -2,8 +2,12 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
 	"time"
 
 	"filevault/internal/models"
@@ -16,6 +20,28 @@ import (
 	"github.com/google/uuid"
 )
 
+// FileShareRepositoryInterface defines the interface for file share repository
+type FileShareRepositoryInterface interface {
+	Create(share *models.FileShare) error
+	GetByID(id uuid.UUID) (*models.FileShare, error)
+	GetByTokenWithFile(token string) (*models.FileShare, error)
+	GetByFileID(fileID uuid.UUID) ([]*models.FileShare, error)
+	GetByOwner(ownerID uuid.UUID, activeOnly bool, limit, offset int) ([]*models.FileShare, int, error)
+	Update(share *models.FileShare) error
+	RegenerateToken(id uuid.UUID) (string, error)
+	IncrementDownloadCount(shareID uuid.UUID) (int, bool, error)
+	Delete(id uuid.UUID) error
+	LogDownload(log *models.DownloadLog) error
+	HasDownloadFrom(shareID uuid.UUID, ipAddress, userAgent string, since time.Time) (bool, error)
+	GetDownloadStats(shareID uuid.UUID) (int, error)
+	GetRecentDownloads(shareID uuid.UUID, limit int) ([]*models.DownloadLog, error)
+	GetSharesExpiringBefore(before time.Time) ([]*models.FileShare, error)
+	GetUnavailableUnnotifiedShares() ([]*models.FileShare, error)
+	MarkExpiryNotified(id uuid.UUID) (bool, error)
+	MarkUnavailableNotified(id uuid.UUID) (bool, error)
+	CountActiveSharesByFileIDs(fileIDs []uuid.UUID) (map[uuid.UUID]int, error)
+}
+
 // UserFileShareRepositoryInterface defines the interface for user file share repository
 type UserFileShareRepositoryInterface interface {
 	Create(share *models.UserFileShare) error
@@ -26,6 +52,16 @@ type UserFileShareRepositoryInterface interface {
 	GetUnreadCount(userID uuid.UUID) (int, error)
 	Delete(id uuid.UUID) error
 	CheckIfAlreadyShared(fileID, toUserID uuid.UUID) (bool, error)
+	GetSharedWithMe(userID uuid.UUID, limit, offset int) ([]*models.SharedWithMeFile, int, error)
+}
+
+// UserFolderShareRepositoryInterface defines the interface for user folder share repository
+type UserFolderShareRepositoryInterface interface {
+	Create(share *models.UserFolderShare) error
+	GetIncomingShares(userID uuid.UUID) ([]*models.UserFolderShare, error)
+	CheckIfAlreadyShared(folderID, toUserID uuid.UUID) (bool, error)
+	GetFilesInFolderTree(folderID uuid.UUID) ([]*models.File, error)
+	HasFileAccess(userID, fileID uuid.UUID) (bool, error)
 }
 
 // UserRepositoryInterface defines the interface for user repository
@@ -40,24 +76,69 @@ type UserRepositoryInterface interface {
 
 // FileShareService handles file sharing business logic
 type FileShareService struct {
-	fileShareRepo     *repositories.FileShareRepository
-	userFileShareRepo UserFileShareRepositoryInterface
-	fileRepo          repositories.FileRepositoryInterface
-	userRepo          UserRepositoryInterface
-	s3Client          *s3.Client
-	bucketName        string
-	baseURL           string
-	websocketService  *WebSocketService
+	fileShareRepo       FileShareRepositoryInterface
+	userFileShareRepo   UserFileShareRepositoryInterface
+	fileRepo            repositories.FileRepositoryInterface
+	userRepo            UserRepositoryInterface
+	userFolderShareRepo UserFolderShareRepositoryInterface
+	folderRepo          repositories.FolderRepositoryInterface
+	s3Client            *s3.Client
+	bucketName          string
+	baseURL             string
+	websocketService    *WebSocketService
+	shareExpiry         *ShareExpiryService
+	maxPresignedExpiry  time.Duration
+	// full downloads up to this many bytes are hashed and checked; zero disables hashing
+	verifyMaxSize int64
+	urlMode       ShareURLMode
+	emailSender   EmailSender
+	// previewPolicy decides which types presigned share links may open inline
+	previewPolicy PreviewPolicy
+	// cdn, when set, signs direct share links for the CDN instead of presigning them on S3
+	cdn *CDNService
+}
+
+// ShareURLMode selects the kind of link handed out for public file shares
+type ShareURLMode string
+
+const (
+	// ShareURLModeDirect links to a presigned S3 URL, falling back to the backend when one can't be issued
+	ShareURLModeDirect ShareURLMode = "direct"
+	// ShareURLModeProxy always links to the backend, which checks the share and streams the file
+	ShareURLModeProxy ShareURLMode = "proxy"
+)
+
+// ParseShareURLMode validates a configured share URL mode; empty means direct
+func ParseShareURLMode(value string) (ShareURLMode, error) {
+	switch mode := ShareURLMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "", ShareURLModeDirect:
+		return ShareURLModeDirect, nil
+	case ShareURLModeProxy:
+		return ShareURLModeProxy, nil
+	default:
+		return "", fmt.Errorf("invalid share URL mode %q: must be %q or %q", value, ShareURLModeDirect, ShareURLModeProxy)
+	}
 }
 
+// maxS3PresignExpiry is the longest lifetime S3 accepts for a SigV4 presigned URL
+const maxS3PresignExpiry = 7 * 24 * time.Hour
+
+// shareResumeWindow is how long after a counted share download the same client may resume it
+// without using up another download
+const shareResumeWindow = time.Hour
+
 // NewFileShareService creates a new file share service
 func NewFileShareService(
-	fileShareRepo *repositories.FileShareRepository,
+	fileShareRepo FileShareRepositoryInterface,
 	userFileShareRepo UserFileShareRepositoryInterface,
 	fileRepo repositories.FileRepositoryInterface,
 	userRepo UserRepositoryInterface,
+	userFolderShareRepo UserFolderShareRepositoryInterface,
+	folderRepo repositories.FolderRepositoryInterface,
 	awsRegion, awsAccessKey, awsSecretKey, bucketName, baseURL string,
 	websocketService *WebSocketService,
+	shareExpiry *ShareExpiryService,
+	maxPresignedExpiry time.Duration,
 ) (*FileShareService, error) {
 	fmt.Printf("DEBUG: NewFileShareService called with region=%s, bucket=%s, baseURL=%s\n", awsRegion, bucketName, baseURL)
 
@@ -77,14 +158,19 @@ func NewFileShareService(
 	fmt.Printf("DEBUG: S3 client created successfully\n")
 
 	service := &FileShareService{
-		fileShareRepo:     fileShareRepo,
-		userFileShareRepo: userFileShareRepo,
-		fileRepo:          fileRepo,
-		userRepo:          userRepo,
-		s3Client:          s3Client,
-		bucketName:        bucketName,
-		baseURL:           baseURL,
-		websocketService:  websocketService,
+		fileShareRepo:       fileShareRepo,
+		userFileShareRepo:   userFileShareRepo,
+		fileRepo:            fileRepo,
+		userRepo:            userRepo,
+		userFolderShareRepo: userFolderShareRepo,
+		folderRepo:          folderRepo,
+		s3Client:            s3Client,
+		bucketName:          bucketName,
+		baseURL:             baseURL,
+		websocketService:    websocketService,
+		shareExpiry:         shareExpiry,
+		maxPresignedExpiry:  maxPresignedExpiry,
+		previewPolicy:       DefaultPreviewPolicy,
 	}
 
 	fmt.Printf("DEBUG: FileShareService created successfully\n")
@@ -102,6 +188,13 @@ func (s *FileShareService) CreateFileShare(userID uuid.UUID, req *models.CreateF
 	if req.FileID == uuid.Nil {
 		return nil, fmt.Errorf("file ID is required")
 	}
+	if req.MaxBandwidthBps != nil && *req.MaxBandwidthBps <= 0 {
+		return nil, fmt.Errorf("max bandwidth must be greater than 0")
+	}
+	allowedDomains, err := normalizeEmailDomains(req.AllowedEmailDomains)
+	if err != nil {
+		return nil, err
+	}
 
 	// Verify the user owns the file
 	fmt.Printf("DEBUG: Looking up file with ID: %s\n", req.FileID)
@@ -124,12 +217,17 @@ func (s *FileShareService) CreateFileShare(userID uuid.UUID, req *models.CreateF
 	shareID := uuid.New()
 	fmt.Printf("DEBUG: Creating file share with ID: %s\n", shareID)
 	share := &models.FileShare{
-		ID:           shareID,
-		FileID:       req.FileID,
-		ShareToken:   "temp", // Temporary value, will be replaced by database trigger
-		IsActive:     true,
-		ExpiresAt:    req.ExpiresAt,
-		MaxDownloads: req.MaxDownloads,
+		ID:              shareID,
+		FileID:          req.FileID,
+		ShareToken:      "temp", // Temporary value, will be replaced by database trigger
+		IsActive:        true,
+		ExpiresAt:       req.ExpiresAt,
+		MaxDownloads:    req.MaxDownloads,
+		MaxBandwidthBps: req.MaxBandwidthBps,
+		ForceDownload:   req.ForceDownload,
+
+		AllowedEmailDomains: allowedDomains,
+		BurnAfterDownload:   req.BurnAfterDownload,
 	}
 
 	fmt.Printf("DEBUG: Calling fileShareRepo.Create with share: %+v\n", share)
@@ -140,40 +238,8 @@ func (s *FileShareService) CreateFileShare(userID uuid.UUID, req *models.CreateF
 	}
 	fmt.Printf("DEBUG: File share created successfully with token: %s\n", share.ShareToken)
 
-	// Generate a direct S3 presigned URL for the share
-	var shareURL string
-	if file.S3Key != "" {
-		// New file with S3 key - generate direct S3 presigned URL
-		presignClient := s3.NewPresignClient(s.s3Client)
-		request, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
-			Bucket: aws.String(s.bucketName),
-			Key:    aws.String(file.S3Key),
-		}, func(opts *s3.PresignOptions) {
-			opts.Expires = time.Duration(7 * 24 * time.Hour) // URL expires in 7 days
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
-		}
-		shareURL = request.URL
-		fmt.Printf("DEBUG: Generated direct S3 share URL: %s\n", shareURL)
-	} else {
-		// Legacy file without S3 key - use backend endpoint
-		shareURL = fmt.Sprintf("%s/api/files/share/%s", s.baseURL, share.ShareToken)
-		fmt.Printf("DEBUG: Generated backend share URL for legacy file: %s\n", shareURL)
-	}
-
-	response := &models.FileShareResponse{
-		ID:            share.ID,
-		FileID:        share.FileID,
-		ShareToken:    share.ShareToken,
-		ShareURL:      shareURL,
-		IsActive:      share.IsActive,
-		ExpiresAt:     share.ExpiresAt,
-		DownloadCount: share.DownloadCount,
-		MaxDownloads:  share.MaxDownloads,
-		CreatedAt:     share.CreatedAt,
-		File:          file,
-	}
+	response := s.buildShareResponse(share, file)
+	fmt.Printf("DEBUG: Generated share URL: %s\n", response.ShareURL)
 
 	// Broadcast file shared event to user
 	if s.websocketService != nil {
@@ -204,25 +270,147 @@ func (s *FileShareService) GetFileShare(token string) (*models.FileShare, error)
 
 	// Check if the share is still valid
 	if !share.CanBeDownloaded() {
+		s.notifyShareUnavailable(share)
 		return nil, fmt.Errorf("file share is no longer available")
 	}
 
 	return share, nil
 }
 
-// DownloadSharedFile handles downloading a shared file
-func (s *FileShareService) DownloadSharedFile(token string, ipAddress, userAgent string) (*models.File, *http.Response, error) {
+// notifyShareUnavailable notifies the owner of an active share that has expired or hit its download limit
+func (s *FileShareService) notifyShareUnavailable(share *models.FileShare) {
+	if s.shareExpiry == nil || !share.IsActive {
+		return
+	}
+	s.shareExpiry.NotifyShareUnavailable(share, ShareUnavailableReason(share))
+}
+
+// DownloadSharedFile handles downloading a shared file. viewerEmail is the address the viewer
+// gave, checked against the share's allowed email domains if it has any.
+func (s *FileShareService) DownloadSharedFile(ctx context.Context, token string, viewerEmail, ipAddress, userAgent, rangeHeader, ifRange string) (*models.File, *http.Response, error) {
 	// Get the file share
 	share, err := s.fileShareRepo.GetByTokenWithFile(token)
 	if err != nil {
 		return nil, nil, fmt.Errorf("file share not found: %w", err)
 	}
 
+	// A range past the first byte is only free when it resumes a download counted for this client
+	// within shareResumeWindow. Such a resume is served even once the download limit is reached,
+	// so the last allowed download can still finish; any other range is counted like a full
+	// download, so ranges can't be used to fetch the file around the share's download limit.
+	rng, rangeErr := ParseRangeHeader(rangeHeader, share.File.Size)
+	resuming := false
+	if rangeErr == nil && rng != nil && rng.Start > 0 && share.IsActive && !share.IsExpired() {
+		resuming, err = s.fileShareRepo.HasDownloadFrom(share.ID, ipAddress, userAgent, time.Now().Add(-shareResumeWindow))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Check if the share is still valid
-	if !share.CanBeDownloaded() {
+	if !resuming && !share.CanBeDownloaded() {
+		s.notifyShareUnavailable(share)
 		return nil, nil, fmt.Errorf("file share is no longer available")
 	}
 
+	if err := CheckShareEmail(share, viewerEmail); err != nil {
+		return nil, nil, err
+	}
+	if rangeErr != nil {
+		return share.File, nil, rangeErr
+	}
+
+	// Check if file has S3 key (new files) or use filename (legacy files)
+	s3Key := share.File.S3Key
+	if s3Key == "" {
+		// Legacy file without S3 key, use filename as fallback
+		s3Key = share.File.Filename
+		fmt.Printf("DEBUG: Using filename as S3 key for legacy file: %s\n", s3Key)
+	}
+
+	// Download file from S3 and return it directly, honoring any requested range
+	download, err := GetObjectForDownload(ctx, s.s3Client, s.bucketName, s3Key, share.File.Size, rangeHeader, FileIfRange(ifRange, share.File))
+	if err != nil {
+		if errors.Is(err, ErrRangeNotSatisfiable) {
+			return share.File, nil, err
+		}
+		return nil, nil, err
+	}
+
+	// Count the download once the object is on its way. A full response is always counted, even
+	// for a ranged request that S3 answered in full because its If-Range didn't match.
+	if !resuming || download.StatusCode != http.StatusPartialContent {
+		if err := s.recordShareDownload(share, viewerEmail, ipAddress, userAgent); err != nil {
+			download.Body.Close()
+			return nil, nil, err
+		}
+	}
+	VerifyDownload(download, share.File, s.verifyMaxSize)
+
+	// Pace the stream when the share has a bandwidth cap
+	body := download.Body
+	if share.MaxBandwidthBps != nil && *share.MaxBandwidthBps > 0 {
+		body = NewThrottledReader(body, *share.MaxBandwidthBps)
+	}
+
+	// Create HTTP response with the file content
+	response := &http.Response{
+		StatusCode: download.StatusCode,
+		Header:     make(http.Header),
+		Body:       body,
+	}
+	SetFileDownloadHeaders(response.Header, share.File)
+	SetFileValidators(response.Header, share.File)
+	download.SetHeaders(response.Header)
+
+	return share.File, response, nil
+}
+
+// SetEmailSender enables emailing share links; without one ShareByEmail only creates the shares
+func (s *FileShareService) SetEmailSender(sender EmailSender) {
+	s.emailSender = sender
+}
+
+// SetShareURLMode chooses between presigned S3 links and backend links for public shares
+func (s *FileShareService) SetShareURLMode(mode ShareURLMode) {
+	s.urlMode = mode
+}
+
+// SetCDN makes direct share links point at the CDN, signed by cdn; nil goes back to S3
+func (s *FileShareService) SetCDN(cdn *CDNService) {
+	s.cdn = cdn
+}
+
+// SetPreviewPolicy sets which file types presigned share links may open inline
+func (s *FileShareService) SetPreviewPolicy(policy PreviewPolicy) {
+	s.previewPolicy = policy
+}
+
+// SetDownloadVerification enables hashing of full shared-file downloads of at most maxSize
+// bytes against the hash recorded at upload. Zero leaves only the size check in place.
+func (s *FileShareService) SetDownloadVerification(maxSize int64) {
+	s.verifyMaxSize = maxSize
+}
+
+// recordShareDownload counts a share download if the share still allows one, logs it and
+// notifies the owner. It fails without counting when the share has been used up. It is only
+// called once S3 has returned the object, so a failed fetch neither uses up a download nor
+// burns a burn-after-download share.
+func (s *FileShareService) recordShareDownload(share *models.FileShare, viewerEmail, ipAddress, userAgent string) error {
+	// Count the download first: this is the authoritative availability check, since another
+	// request may have used up the share since it was loaded
+	count, ok, err := s.fileShareRepo.IncrementDownloadCount(share.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("file share is no longer available")
+	}
+	if share.BurnAfterDownload {
+		// The increment also deactivated the share and replaced its token
+		share.IsActive = false
+	}
+
 	// Log the download
 	downloadLog := &models.DownloadLog{
 		ID:        uuid.New(),
@@ -230,6 +418,9 @@ func (s *FileShareService) DownloadSharedFile(token string, ipAddress, userAgent
 		IPAddress: &ipAddress,
 		UserAgent: &userAgent,
 	}
+	if len(share.AllowedEmailDomains) > 0 {
+		downloadLog.Email = &viewerEmail
+	}
 
 	err = s.fileShareRepo.LogDownload(downloadLog)
 	if err != nil {
@@ -237,105 +428,205 @@ func (s *FileShareService) DownloadSharedFile(token string, ipAddress, userAgent
 		fmt.Printf("Failed to log download: %v\n", err)
 	}
 
-	// Increment download count
-	err = s.fileShareRepo.IncrementDownloadCount(share.ID)
-	if err != nil {
-		// Log error but don't fail the download
-		fmt.Printf("Failed to increment download count: %v\n", err)
-	}
-
 	// Broadcast download count update to file owner
 	if s.websocketService != nil {
 		s.websocketService.BroadcastDownloadCountUpdate(
 			share.File.ID.String(),
 			share.ID.String(),
 			share.File.UploaderID.String(),
-			share.DownloadCount+1, // +1 because we just incremented
+			count,
 		)
 	}
 
-	// Check if file has S3 key (new files) or use filename (legacy files)
-	s3Key := share.File.S3Key
-	if s3Key == "" {
-		// Legacy file without S3 key, use filename as fallback
-		s3Key = share.File.Filename
-		fmt.Printf("DEBUG: Using filename as S3 key for legacy file: %s\n", s3Key)
+	// Tell the owner right away if this download used up the last allowed one
+	if s.shareExpiry != nil && share.MaxDownloads != nil && count >= *share.MaxDownloads {
+		s.shareExpiry.NotifyShareUnavailable(share, ShareUnavailableReasonDownloadLimit)
 	}
 
-	// Download file from S3 and return it directly
-	result, err := s.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(s3Key),
-	})
+	return nil
+}
+
+// GetUserFileShares retrieves a page of the shares of a user's files, newest first, with the
+// total across all pages. With activeOnly, only shares that can still be downloaded are listed.
+func (s *FileShareService) GetUserFileShares(userID uuid.UUID, limit, offset int, activeOnly bool) (*models.FileSharePage, error) {
+	shares, total, err := s.fileShareRepo.GetByOwner(userID, activeOnly, limit, offset)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to download file from S3: %w", err)
+		return nil, fmt.Errorf("failed to get file shares: %w", err)
 	}
 
-	// Create HTTP response with the file content
-	response := &http.Response{
-		StatusCode: http.StatusOK,
-		Header:     make(http.Header),
-		Body:       result.Body,
+	responses := make([]*models.FileShareResponse, 0, len(shares))
+	for _, share := range shares {
+		responses = append(responses, s.buildShareResponse(share, share.File))
 	}
-	response.Header.Set("Content-Type", share.File.MimeType)
-	response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", share.File.OriginalName))
-	response.Header.Set("Content-Length", fmt.Sprintf("%d", share.File.Size))
 
-	return share.File, response, nil
+	return &models.FileSharePage{
+		Shares:     responses,
+		TotalCount: total,
+		HasMore:    offset+len(responses) < total,
+	}, nil
 }
 
-// GetUserFileShares retrieves all file shares for a user
-func (s *FileShareService) GetUserFileShares(userID uuid.UUID, limit, offset int) ([]*models.FileShareResponse, error) {
-	// Get user's files
-	files, err := s.fileRepo.GetByUserID(userID, limit, offset)
+// GetShareByIDForOwner retrieves a single file share, verifying the user owns the shared file
+func (s *FileShareService) GetShareByIDForOwner(userID uuid.UUID, shareID uuid.UUID) (*models.FileShareResponse, error) {
+	// Get the share
+	share, err := s.fileShareRepo.GetByID(shareID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user files: %w", err)
+		return nil, fmt.Errorf("file share not found: %w", err)
 	}
 
-	var responses []*models.FileShareResponse
-	for _, file := range files {
-		// Get shares for this file
-		shares, err := s.fileShareRepo.GetByFileID(file.ID)
-		if err != nil {
-			continue // Skip files with errors
-		}
+	// Verify the user owns the file
+	file, err := s.fileRepo.GetByID(share.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
 
-		for _, share := range shares {
-			response := &models.FileShareResponse{
-				ID:            share.ID,
-				FileID:        share.FileID,
-				ShareToken:    share.ShareToken,
-				ShareURL:      fmt.Sprintf("%s/api/files/share/%s", s.baseURL, share.ShareToken),
-				IsActive:      share.IsActive,
-				ExpiresAt:     share.ExpiresAt,
-				DownloadCount: share.DownloadCount,
-				MaxDownloads:  share.MaxDownloads,
-				CreatedAt:     share.CreatedAt,
-				File:          file,
-			}
-			responses = append(responses, response)
+	if file.UploaderID != userID {
+		return nil, fmt.Errorf("unauthorized: you can only view your own file shares")
+	}
+
+	return s.buildShareResponse(share, file), nil
+}
+
+// buildShareResponse converts a stored file share into its API response
+func (s *FileShareService) buildShareResponse(share *models.FileShare, file *models.File) *models.FileShareResponse {
+	return &models.FileShareResponse{
+		ID:              share.ID,
+		FileID:          share.FileID,
+		ShareToken:      share.ShareToken,
+		ShareURL:        s.buildShareURL(share, file),
+		IsActive:        share.IsActive,
+		ExpiresAt:       share.ExpiresAt,
+		DownloadCount:   share.DownloadCount,
+		MaxDownloads:    share.MaxDownloads,
+		MaxBandwidthBps: share.MaxBandwidthBps,
+		ForceDownload:   share.ForceDownload,
+		CreatedAt:       share.CreatedAt,
+		File:            file,
+
+		AllowedEmailDomains: share.AllowedEmailDomains,
+		BurnAfterDownload:   share.BurnAfterDownload,
+	}
+}
+
+// buildShareURL returns the link handed out for a share. Every response that includes a share
+// URL goes through here so the same share gets the same kind of link everywhere. Shares limited
+// to email domains, burned after download or capped in bandwidth always link to the backend,
+// since a presigned URL would skip the check, outlive the first download or bypass the cap.
+func (s *FileShareService) buildShareURL(share *models.FileShare, file *models.File) string {
+	if s.urlMode == ShareURLModeProxy || file == nil || len(share.AllowedEmailDomains) > 0 || share.BurnAfterDownload || share.MaxBandwidthBps != nil {
+		return s.proxyShareURL(share)
+	}
+
+	directURL, err := s.directShareURL(share, file)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to presign URL for share %s, using backend URL: %v\n", share.ID, err)
+		return s.proxyShareURL(share)
+	}
+	return directURL
+}
+
+// proxyShareURL returns the backend URL for a share, rooted at the configured base URL
+func (s *FileShareService) proxyShareURL(share *models.FileShare) string {
+	return fmt.Sprintf("%s/api/files/share/%s", strings.TrimRight(s.baseURL, "/"), share.ShareToken)
+}
+
+// directShareURL returns a signed CDN URL, or without a CDN a presigned S3 URL, for an available
+// share. The URL never outlives the share itself; legacy files without an S3 key and unavailable
+// shares fall back to the backend URL.
+func (s *FileShareService) directShareURL(share *models.FileShare, file *models.File) (string, error) {
+	backendURL := s.proxyShareURL(share)
+	if file.S3Key == "" || (s.s3Client == nil && s.cdn == nil) || !share.CanBeDownloaded() {
+		return backendURL, nil
+	}
+
+	expiry, ok := presignedURLExpiry(time.Now(), share.ExpiresAt, s.maxPresignedExpiry)
+	if !ok {
+		return backendURL, nil
+	}
+
+	if s.cdn != nil {
+		params := url.Values{}
+		params.Set("response-content-disposition", ContentDisposition(s.shareDisposition(share, file), DownloadFilename(file)))
+		if file.MimeType != "" {
+			params.Set("response-content-type", file.MimeType)
 		}
+		return s.cdn.SignedURL(file.S3Key, params, time.Now().Add(expiry))
 	}
 
-	return responses, nil
+	// S3 answers with these headers instead of the stored ones, so the browser opens or saves
+	// the file as the share asks and under its download name
+	input := &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucketName),
+		Key:                        aws.String(file.S3Key),
+		ResponseContentDisposition: aws.String(ContentDisposition(s.shareDisposition(share, file), DownloadFilename(file))),
+	}
+	if file.MimeType != "" {
+		input.ResponseContentType = aws.String(file.MimeType)
+	}
+
+	presignClient := s3.NewPresignClient(s.s3Client)
+	request, err := presignClient.PresignGetObject(context.TODO(), input, func(opts *s3.PresignOptions) {
+		opts.Expires = expiry
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return request.URL, nil
 }
 
-// UpdateFileShare updates a file share
-func (s *FileShareService) UpdateFileShare(userID uuid.UUID, shareID uuid.UUID, isActive *bool, expiresAt *time.Time, maxDownloads *int) error {
+// shareDisposition is how a share's presigned link asks the browser to handle the file: inline
+// when the share allows it and the preview policy considers the type safe, otherwise attachment
+func (s *FileShareService) shareDisposition(share *models.FileShare, file *models.File) string {
+	if share.ForceDownload || !s.previewPolicy.Allows(file.MimeType) {
+		return "attachment"
+	}
+	return "inline"
+}
+
+// presignedURLExpiry returns the lifetime for a share's presigned URL: the configured maximum
+// (capped at what S3 allows), shortened to the time left until the share expires.
+// ok is false when the share has already expired.
+func presignedURLExpiry(now time.Time, expiresAt *time.Time, max time.Duration) (time.Duration, bool) {
+	if max <= 0 || max > maxS3PresignExpiry {
+		max = maxS3PresignExpiry
+	}
+	if expiresAt == nil {
+		return max, true
+	}
+
+	remaining := expiresAt.Sub(now)
+	if remaining < time.Second {
+		return 0, false
+	}
+	if remaining < max {
+		return remaining, true
+	}
+	return max, true
+}
+
+// UpdateFileShare updates a file share and returns the refreshed share
+func (s *FileShareService) UpdateFileShare(userID uuid.UUID, shareID uuid.UUID, isActive *bool, expiresAt *time.Time, maxDownloads *int) (*models.FileShareResponse, error) {
 	// Get the share
 	share, err := s.fileShareRepo.GetByID(shareID)
 	if err != nil {
-		return fmt.Errorf("file share not found: %w", err)
+		return nil, fmt.Errorf("file share not found: %w", err)
 	}
 
 	// Verify the user owns the file
 	file, err := s.fileRepo.GetByID(share.FileID)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
 	}
 
 	if file.UploaderID != userID {
-		return fmt.Errorf("unauthorized: you can only modify shares for your own files")
+		return nil, fmt.Errorf("unauthorized: you can only modify shares for your own files")
 	}
 
 	// Update the share
@@ -351,10 +642,47 @@ func (s *FileShareService) UpdateFileShare(userID uuid.UUID, shareID uuid.UUID,
 
 	err = s.fileShareRepo.Update(share)
 	if err != nil {
-		return fmt.Errorf("failed to update file share: %w", err)
+		return nil, fmt.Errorf("failed to update file share: %w", err)
 	}
 
-	return nil
+	// Re-read the share so the response reflects what was persisted
+	updated, err := s.fileShareRepo.GetByID(shareID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file share: %w", err)
+	}
+
+	return s.buildShareResponse(updated, file), nil
+}
+
+// RegenerateToken replaces a share's token, e.g. after a link leaked. Backend links with the old
+// token stop working at once while the share keeps its settings, download count and logs.
+// Presigned S3 links handed out in direct mode don't carry the token and stay valid until they expire.
+func (s *FileShareService) RegenerateToken(userID, shareID uuid.UUID) (*models.FileShareResponse, error) {
+	share, err := s.fileShareRepo.GetByID(shareID)
+	if err != nil {
+		return nil, fmt.Errorf("file share not found: %w", err)
+	}
+
+	// Verify the user owns the file
+	file, err := s.fileRepo.GetByID(share.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+
+	if file.UploaderID != userID {
+		return nil, fmt.Errorf("unauthorized: you can only modify shares for your own files")
+	}
+
+	token, err := s.fileShareRepo.RegenerateToken(shareID)
+	if err != nil {
+		return nil, err
+	}
+	share.ShareToken = token
+
+	return s.buildShareResponse(share, file), nil
 }
 
 // DeleteFileShare deletes a file share
@@ -431,8 +759,138 @@ func (s *FileShareService) GetFileShareStats(userID uuid.UUID, shareID uuid.UUID
 	return stats, nil
 }
 
+// GetFileShareHistory returns every share of a file owned by the user, newest first, with
+// per-share download counts and totals. Shares that can still be downloaded count as active.
+func (s *FileShareService) GetFileShareHistory(userID, fileID uuid.UUID) (*models.FileShareHistory, error) {
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+	if file.UploaderID != userID {
+		return nil, fmt.Errorf("unauthorized: you can only view the share history of your own files")
+	}
+
+	shares, err := s.fileShareRepo.GetByFileID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file shares: %w", err)
+	}
+
+	history := &models.FileShareHistory{
+		FileID: fileID,
+		Shares: make([]*models.FileShareResponse, 0, len(shares)),
+	}
+	for _, share := range shares {
+		history.Shares = append(history.Shares, s.buildShareResponse(share, file))
+		history.TotalDownloads += share.DownloadCount
+		if share.CanBeDownloaded() {
+			history.ActiveShares++
+		}
+	}
+	history.TotalShares = len(history.Shares)
+
+	return history, nil
+}
+
+// GetShareCountsForFiles returns the number of downloadable public shares for each file.
+// Files without an active share are omitted from the map.
+func (s *FileShareService) GetShareCountsForFiles(fileIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	if len(fileIDs) == 0 {
+		return map[uuid.UUID]int{}, nil
+	}
+
+	counts, err := s.fileShareRepo.CountActiveSharesByFileIDs(fileIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share counts: %w", err)
+	}
+
+	return counts, nil
+}
+
 // User File Sharing Methods
 
+// ShareByEmailResult describes what ShareByEmail created and whether the link was emailed
+type ShareByEmailResult struct {
+	Share     *models.FileShareResponse     `json:"share"`
+	UserShare *models.UserFileShareResponse `json:"userShare,omitempty"`
+	EmailSent bool                          `json:"emailSent"`
+}
+
+// ShareByEmail creates a public share link for a file and emails it to an address. When the
+// address belongs to an existing user, the file is also shared with them in-app. Sending the
+// email is best-effort: the shares are kept and the outcome is logged if delivery fails.
+func (s *FileShareService) ShareByEmail(fromUserID, fileID uuid.UUID, email string, message *string) (*ShareByEmailResult, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email address: %w", err)
+	}
+	email = strings.ToLower(address.Address)
+
+	fromUser, err := s.userRepo.GetByID(fromUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user details: %w", err)
+	}
+
+	share, err := s.CreateFileShare(fromUserID, &models.CreateFileShareRequest{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	result := &ShareByEmailResult{Share: share}
+
+	if recipient, err := s.userRepo.GetByEmail(email); err == nil && recipient != nil && recipient.ID != fromUserID {
+		alreadyShared, err := s.userFileShareRepo.CheckIfAlreadyShared(fileID, recipient.ID)
+		if err != nil {
+			fmt.Printf("WARNING: failed to check existing in-app share of file %s with %s: %v\n", fileID, recipient.ID, err)
+		} else if !alreadyShared {
+			userShare, err := s.ShareFileWithUser(fromUserID, fileID, recipient.ID, message)
+			if err != nil {
+				fmt.Printf("WARNING: failed to share file %s in-app with %s: %v\n", fileID, recipient.ID, err)
+			} else {
+				result.UserShare = userShare
+			}
+		}
+	}
+
+	if s.emailSender == nil {
+		fmt.Printf("Share email for file %s to %s not sent: email is not configured\n", fileID, email)
+		return result, nil
+	}
+
+	subject, body := shareEmailContent(fromUser.Username, share, message)
+	if err := s.emailSender.SendEmail(email, subject, body); err != nil {
+		fmt.Printf("WARNING: failed to send share email for file %s to %s: %v\n", fileID, email, err)
+		return result, nil
+	}
+
+	fmt.Printf("Share email for file %s sent to %s\n", fileID, email)
+	result.EmailSent = true
+	return result, nil
+}
+
+// shareEmailContent builds the subject and body of a share link email
+func shareEmailContent(senderName string, share *models.FileShareResponse, message *string) (string, string) {
+	fileName := "a file"
+	if share.File != nil {
+		fileName = share.File.OriginalName
+	}
+
+	subject := fmt.Sprintf("%s shared \"%s\" with you", senderName, fileName)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s shared \"%s\" with you on FileVault.\n\n", senderName, fileName)
+	if message != nil && strings.TrimSpace(*message) != "" {
+		fmt.Fprintf(&body, "Message: %s\n\n", strings.TrimSpace(*message))
+	}
+	fmt.Fprintf(&body, "Download it here: %s\n", share.ShareURL)
+	if share.ExpiresAt != nil {
+		fmt.Fprintf(&body, "\nThis link expires on %s.\n", share.ExpiresAt.Format(time.RFC1123))
+	}
+
+	return subject, body.String()
+}
+
 // ShareFileWithUser shares a file directly with another user
 func (s *FileShareService) ShareFileWithUser(fromUserID, fileID, toUserID uuid.UUID, message *string) (*models.UserFileShareResponse, error) {
 	// Check if file exists and belongs to the user
@@ -536,6 +994,22 @@ func (s *FileShareService) GetIncomingShares(userID uuid.UUID, limit, offset int
 	return responses, nil
 }
 
+// GetAllSharedWithMe retrieves a page of the files other users shared with the user, whether
+// directly, through a shared folder or by an access grant. A file shared several ways is listed
+// once with all of its sources, ordered by its most recent share.
+func (s *FileShareService) GetAllSharedWithMe(userID uuid.UUID, limit, offset int) (*models.SharedWithMePage, error) {
+	files, total, err := s.userFileShareRepo.GetSharedWithMe(userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files shared with you: %w", err)
+	}
+
+	return &models.SharedWithMePage{
+		Files:      files,
+		TotalCount: total,
+		HasMore:    offset+len(files) < total,
+	}, nil
+}
+
 // GetOutgoingShares retrieves files shared by the user
 func (s *FileShareService) GetOutgoingShares(userID uuid.UUID, limit, offset int) ([]*models.UserFileShareResponse, error) {
 	shares, err := s.userFileShareRepo.GetOutgoingShares(userID, limit, offset)
@@ -606,3 +1080,135 @@ func (s *FileShareService) DeleteUserFileShare(shareID, userID uuid.UUID) error
 
 	return nil
 }
+
+// User Folder Sharing Methods
+
+// ShareFolderWithUser shares a folder and everything in it with another user
+func (s *FileShareService) ShareFolderWithUser(fromUserID, folderID, toUserID uuid.UUID, message *string) (*models.UserFolderShareResponse, error) {
+	if fromUserID == toUserID {
+		return nil, fmt.Errorf("you cannot share a folder with yourself")
+	}
+
+	// Check if folder exists and belongs to the user
+	folder, err := s.folderRepo.GetByID(folderID)
+	if err != nil {
+		return nil, fmt.Errorf("folder not found: %w", err)
+	}
+	if folder == nil {
+		return nil, fmt.Errorf("folder not found")
+	}
+
+	if folder.OwnerID != fromUserID {
+		return nil, fmt.Errorf("access denied: you can only share your own folders")
+	}
+
+	// Check if target user exists
+	_, err = s.userRepo.GetByID(toUserID)
+	if err != nil {
+		return nil, fmt.Errorf("target user not found: %w", err)
+	}
+
+	// Check if already shared
+	alreadyShared, err := s.userFolderShareRepo.CheckIfAlreadyShared(folderID, toUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing shares: %w", err)
+	}
+
+	if alreadyShared {
+		return nil, fmt.Errorf("folder is already shared with this user")
+	}
+
+	// Get from user details
+	fromUser, err := s.userRepo.GetByID(fromUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user details: %w", err)
+	}
+
+	// Create user folder share
+	share := &models.UserFolderShare{
+		ID:         uuid.New(),
+		FolderID:   folderID,
+		FromUserID: fromUserID,
+		ToUserID:   toUserID,
+		Message:    message,
+		IsRead:     false,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	err = s.userFolderShareRepo.Create(share)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user folder share: %w", err)
+	}
+
+	// Broadcast notification to target user via WebSocket
+	if s.websocketService != nil {
+		s.websocketService.BroadcastFolderSharedWithUser(
+			toUserID.String(),
+			fromUser.Username,
+			folder.Name,
+			share.ID.String(),
+		)
+	}
+
+	response := &models.UserFolderShareResponse{
+		ID:         share.ID,
+		FolderID:   share.FolderID,
+		FromUserID: share.FromUserID,
+		ToUserID:   share.ToUserID,
+		Message:    share.Message,
+		IsRead:     share.IsRead,
+		CreatedAt:  share.CreatedAt,
+		Folder:     folder,
+		FromUser:   fromUser,
+	}
+
+	return response, nil
+}
+
+// GetSharedFolders retrieves folders shared with the user, including the files they currently contain
+func (s *FileShareService) GetSharedFolders(userID uuid.UUID) ([]*models.UserFolderShareResponse, error) {
+	shares, err := s.userFolderShareRepo.GetIncomingShares(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared folders: %w", err)
+	}
+
+	var responses []*models.UserFolderShareResponse
+	for _, share := range shares {
+		// Files are resolved at read time so files added after sharing are included
+		files, err := s.userFolderShareRepo.GetFilesInFolderTree(share.FolderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files in shared folder: %w", err)
+		}
+
+		response := &models.UserFolderShareResponse{
+			ID:         share.ID,
+			FolderID:   share.FolderID,
+			FromUserID: share.FromUserID,
+			ToUserID:   share.ToUserID,
+			Message:    share.Message,
+			IsRead:     share.IsRead,
+			CreatedAt:  share.CreatedAt,
+			Folder:     share.Folder,
+			FromUser:   share.FromUser,
+			Files:      files,
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// CanAccessFileViaFolderShare checks if a file is readable by the user through a shared folder
+func (s *FileShareService) CanAccessFileViaFolderShare(userID, fileID uuid.UUID) (bool, error) {
+	if s.userFolderShareRepo == nil {
+		return false, nil
+	}
+
+	hasAccess, err := s.userFolderShareRepo.HasFileAccess(userID, fileID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check folder share access: %w", err)
+	}
+
+	return hasAccess, nil
+}
@@ -1,15 +1,28 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"filevault/internal/models"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockUserFileShareRepository is a mock implementation of UserFileShareRepositoryInterface
@@ -57,6 +70,11 @@ func (m *MockUserFileShareRepository) CheckIfAlreadyShared(fileID, toUserID uuid
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockUserFileShareRepository) GetSharedWithMe(userID uuid.UUID, limit, offset int) ([]*models.SharedWithMeFile, int, error) {
+	args := m.Called(userID, limit, offset)
+	return args.Get(0).([]*models.SharedWithMeFile), args.Int(1), args.Error(2)
+}
+
 // MockUserRepository is a mock implementation of UserRepositoryInterface
 type MockUserRepository struct {
 	mock.Mock
@@ -92,6 +110,290 @@ func (m *MockUserRepository) GetAllUsers(limit, offset int) ([]*models.User, err
 	return args.Get(0).([]*models.User), args.Error(1)
 }
 
+// MockFileShareRepository is a mock implementation of FileShareRepositoryInterface
+type MockFileShareRepository struct {
+	mock.Mock
+}
+
+func (m *MockFileShareRepository) Create(share *models.FileShare) error {
+	args := m.Called(share)
+	return args.Error(0)
+}
+
+func (m *MockFileShareRepository) GetByID(id uuid.UUID) (*models.FileShare, error) {
+	args := m.Called(id)
+	return args.Get(0).(*models.FileShare), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetByTokenWithFile(token string) (*models.FileShare, error) {
+	args := m.Called(token)
+	return args.Get(0).(*models.FileShare), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetByFileID(fileID uuid.UUID) ([]*models.FileShare, error) {
+	args := m.Called(fileID)
+	return args.Get(0).([]*models.FileShare), args.Error(1)
+}
+
+func (m *MockFileShareRepository) Update(share *models.FileShare) error {
+	args := m.Called(share)
+	return args.Error(0)
+}
+
+func (m *MockFileShareRepository) RegenerateToken(id uuid.UUID) (string, error) {
+	args := m.Called(id)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockFileShareRepository) IncrementDownloadCount(shareID uuid.UUID) (int, bool, error) {
+	args := m.Called(shareID)
+	return args.Int(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockFileShareRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockFileShareRepository) LogDownload(log *models.DownloadLog) error {
+	args := m.Called(log)
+	return args.Error(0)
+}
+
+func (m *MockFileShareRepository) HasDownloadFrom(shareID uuid.UUID, ipAddress, userAgent string, since time.Time) (bool, error) {
+	args := m.Called(shareID, ipAddress, userAgent, since)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetDownloadStats(shareID uuid.UUID) (int, error) {
+	args := m.Called(shareID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetRecentDownloads(shareID uuid.UUID, limit int) ([]*models.DownloadLog, error) {
+	args := m.Called(shareID, limit)
+	return args.Get(0).([]*models.DownloadLog), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetSharesExpiringBefore(before time.Time) ([]*models.FileShare, error) {
+	args := m.Called(before)
+	return args.Get(0).([]*models.FileShare), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetUnavailableUnnotifiedShares() ([]*models.FileShare, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.FileShare), args.Error(1)
+}
+
+func (m *MockFileShareRepository) MarkExpiryNotified(id uuid.UUID) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockFileShareRepository) MarkUnavailableNotified(id uuid.UUID) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockFileShareRepository) GetByOwner(ownerID uuid.UUID, activeOnly bool, limit, offset int) ([]*models.FileShare, int, error) {
+	args := m.Called(ownerID, activeOnly, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]*models.FileShare), args.Int(1), args.Error(2)
+}
+
+func (m *MockFileShareRepository) CountActiveSharesByFileIDs(fileIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	args := m.Called(fileIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uuid.UUID]int), args.Error(1)
+}
+
+// MockFileRepository is a mock implementation of repositories.FileRepositoryInterface
+type MockFileRepository struct {
+	mock.Mock
+}
+
+func (m *MockFileRepository) Create(file *models.File) error {
+	args := m.Called(file)
+	return args.Error(0)
+}
+
+func (m *MockFileRepository) GetByID(id uuid.UUID) (*models.File, error) {
+	args := m.Called(id)
+	return args.Get(0).(*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetByUserID(userID uuid.UUID, limit, offset int) ([]*models.File, error) {
+	args := m.Called(userID, limit, offset)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetByUploaderFolderAndHash(uploaderID uuid.UUID, folderID *uuid.UUID, hash, originalName string) (*models.File, error) {
+	args := m.Called(uploaderID, folderID, hash, originalName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) RecordAccess(userID, fileID uuid.UUID, accessType string) error {
+	args := m.Called(userID, fileID, accessType)
+	return args.Error(0)
+}
+
+func (m *MockFileRepository) GetRecentlyAccessedByUser(userID uuid.UUID, limit int) ([]*models.File, error) {
+	args := m.Called(userID, limit)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	args := m.Called(userID, sortBy, sortOrder, limit, offset)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetRootByUserIDSorted(userID uuid.UUID, sortBy, sortOrder string, limit, offset int) ([]*models.File, error) {
+	args := m.Called(userID, sortBy, sortOrder, limit, offset)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) StreamForExport(userID uuid.UUID, fn func(row *models.FileExportRow) error) error {
+	args := m.Called(userID, fn)
+	if rows, ok := args.Get(0).([]*models.FileExportRow); ok {
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockFileRepository) GetByUserIDAfter(userID uuid.UUID, cursor *models.FileCursor, limit int) ([]*models.File, error) {
+	args := m.Called(userID, cursor, limit)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetByUserIDAndFolderID(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error) {
+	args := m.Called(userID, folderID, limit, offset)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetByUserIDAndFolderIDRecursive(userID uuid.UUID, folderID uuid.UUID, limit, offset int) ([]*models.File, error) {
+	args := m.Called(userID, folderID, limit, offset)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) SearchByUserID(userID uuid.UUID, searchTerm string, limit, offset int) ([]*models.File, error) {
+	args := m.Called(userID, searchTerm, limit, offset)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetByHash(hash string) ([]*models.File, error) {
+	args := m.Called(hash)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) GetWithPerceptualHash(uploaderID *uuid.UUID) ([]*models.File, error) {
+	args := m.Called(uploaderID)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockFileRepository) UpdateMetadata(id uuid.UUID, originalName string, description, downloadName *string, modifiedBy uuid.UUID) error {
+	args := m.Called(id, originalName, description, downloadName, modifiedBy)
+	return args.Error(0)
+}
+
+func (m *MockFileRepository) SetPublic(id uuid.UUID, public bool) error {
+	args := m.Called(id, public)
+	return args.Error(0)
+}
+
+func (m *MockFileRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockFileRepository) GetDB() *sql.DB {
+	return nil
+}
+
+// MockFolderRepository is a mock implementation of repositories.FolderRepositoryInterface
+type MockFolderRepository struct {
+	mock.Mock
+}
+
+func (m *MockFolderRepository) Create(folder *models.Folder) error {
+	args := m.Called(folder)
+	return args.Error(0)
+}
+
+func (m *MockFolderRepository) GetByID(id uuid.UUID) (*models.Folder, error) {
+	args := m.Called(id)
+	return args.Get(0).(*models.Folder), args.Error(1)
+}
+
+func (m *MockFolderRepository) GetByOwnerID(ownerID uuid.UUID) ([]*models.Folder, error) {
+	args := m.Called(ownerID)
+	return args.Get(0).([]*models.Folder), args.Error(1)
+}
+
+func (m *MockFolderRepository) GetByParentID(parentID uuid.UUID) ([]*models.Folder, error) {
+	args := m.Called(parentID)
+	return args.Get(0).([]*models.Folder), args.Error(1)
+}
+
+func (m *MockFolderRepository) GetAncestors(folderID uuid.UUID, maxDepth int) ([]*models.Folder, error) {
+	args := m.Called(folderID, maxDepth)
+	return args.Get(0).([]*models.Folder), args.Error(1)
+}
+
+func (m *MockFolderRepository) Update(folder *models.Folder) error {
+	args := m.Called(folder)
+	return args.Error(0)
+}
+
+func (m *MockFolderRepository) Delete(id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockFolderRepository) GetDB() *sql.DB {
+	return nil
+}
+
+// MockUserFolderShareRepository is a mock implementation of UserFolderShareRepositoryInterface
+type MockUserFolderShareRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserFolderShareRepository) Create(share *models.UserFolderShare) error {
+	args := m.Called(share)
+	return args.Error(0)
+}
+
+func (m *MockUserFolderShareRepository) GetIncomingShares(userID uuid.UUID) ([]*models.UserFolderShare, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]*models.UserFolderShare), args.Error(1)
+}
+
+func (m *MockUserFolderShareRepository) CheckIfAlreadyShared(folderID, toUserID uuid.UUID) (bool, error) {
+	args := m.Called(folderID, toUserID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserFolderShareRepository) GetFilesInFolderTree(folderID uuid.UUID) ([]*models.File, error) {
+	args := m.Called(folderID)
+	return args.Get(0).([]*models.File), args.Error(1)
+}
+
+func (m *MockUserFolderShareRepository) HasFileAccess(userID, fileID uuid.UUID) (bool, error) {
+	args := m.Called(userID, fileID)
+	return args.Bool(0), args.Error(1)
+}
+
 // MockS3Service is a mock implementation of S3Service
 type MockS3Service struct {
 	mock.Mock
@@ -220,7 +522,912 @@ func TestFileShareService_DeleteUserFileShare(t *testing.T) {
 	assert.NotNil(t, service)
 }
 
+func TestFileShareService_UpdateFileShare_ReturnsUpdatedShare(t *testing.T) {
+	mockFileShareRepo := new(MockFileShareRepository)
+	mockFileRepo := new(MockFileRepository)
+
+	service := &FileShareService{
+		fileShareRepo: mockFileShareRepo,
+		fileRepo:      mockFileRepo,
+		bucketName:    "test-bucket",
+		baseURL:       "http://localhost:8080",
+	}
+
+	userID := uuid.New()
+	fileID := uuid.New()
+	shareID := uuid.New()
+	oldExpiry := time.Now().Add(24 * time.Hour)
+	oldMax := 5
+
+	existing := &models.FileShare{
+		ID:           shareID,
+		FileID:       fileID,
+		ShareToken:   "token123",
+		IsActive:     true,
+		ExpiresAt:    &oldExpiry,
+		MaxDownloads: &oldMax,
+	}
+	file := &models.File{ID: fileID, UploaderID: userID, OriginalName: "report.pdf"}
+
+	isActive := false
+	newExpiry := time.Now().Add(72 * time.Hour).Truncate(time.Second)
+	newMax := 20
+
+	updated := &models.FileShare{
+		ID:           shareID,
+		FileID:       fileID,
+		ShareToken:   "token123",
+		IsActive:     isActive,
+		ExpiresAt:    &newExpiry,
+		MaxDownloads: &newMax,
+	}
+
+	mockFileShareRepo.On("GetByID", shareID).Return(existing, nil).Once()
+	mockFileRepo.On("GetByID", fileID).Return(file, nil)
+	mockFileShareRepo.On("Update", mock.AnythingOfType("*models.FileShare")).Return(nil)
+	mockFileShareRepo.On("GetByID", shareID).Return(updated, nil).Once()
+
+	result, err := service.UpdateFileShare(userID, shareID, &isActive, &newExpiry, &newMax)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, shareID, result.ID)
+	assert.False(t, result.IsActive)
+	assert.NotNil(t, result.ExpiresAt)
+	assert.True(t, newExpiry.Equal(*result.ExpiresAt))
+	assert.NotNil(t, result.MaxDownloads)
+	assert.Equal(t, newMax, *result.MaxDownloads)
+	assert.Equal(t, "http://localhost:8080/api/files/share/token123", result.ShareURL)
+	assert.Equal(t, file, result.File)
+	mockFileShareRepo.AssertExpectations(t)
+	mockFileRepo.AssertExpectations(t)
+}
+
+func TestFileShareService_UpdateFileShare_RejectsNonOwner(t *testing.T) {
+	mockFileShareRepo := new(MockFileShareRepository)
+	mockFileRepo := new(MockFileRepository)
+
+	service := &FileShareService{
+		fileShareRepo: mockFileShareRepo,
+		fileRepo:      mockFileRepo,
+		baseURL:       "http://localhost:8080",
+	}
+
+	fileID := uuid.New()
+	shareID := uuid.New()
+
+	mockFileShareRepo.On("GetByID", shareID).Return(&models.FileShare{ID: shareID, FileID: fileID}, nil)
+	mockFileRepo.On("GetByID", fileID).Return(&models.File{ID: fileID, UploaderID: uuid.New()}, nil)
+
+	isActive := false
+	result, err := service.UpdateFileShare(uuid.New(), shareID, &isActive, nil, nil)
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), "unauthorized")
+	mockFileShareRepo.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestFileShareService_ShareFolderWithUser(t *testing.T) {
+	mockFolderRepo := new(MockFolderRepository)
+	mockUserRepo := new(MockUserRepository)
+	mockFolderShareRepo := new(MockUserFolderShareRepository)
+
+	service := &FileShareService{
+		folderRepo:          mockFolderRepo,
+		userRepo:            mockUserRepo,
+		userFolderShareRepo: mockFolderShareRepo,
+	}
+
+	ownerID := uuid.New()
+	recipientID := uuid.New()
+	folder := &models.Folder{ID: uuid.New(), Name: "Designs", OwnerID: ownerID}
+	owner := &models.User{ID: ownerID, Username: "owner"}
+
+	mockFolderRepo.On("GetByID", folder.ID).Return(folder, nil)
+	mockUserRepo.On("GetByID", recipientID).Return(&models.User{ID: recipientID}, nil)
+	mockUserRepo.On("GetByID", ownerID).Return(owner, nil)
+	mockFolderShareRepo.On("CheckIfAlreadyShared", folder.ID, recipientID).Return(false, nil)
+	mockFolderShareRepo.On("Create", mock.AnythingOfType("*models.UserFolderShare")).Return(nil)
+
+	message := "Latest mockups"
+	result, err := service.ShareFolderWithUser(ownerID, folder.ID, recipientID, &message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, folder.ID, result.FolderID)
+	assert.Equal(t, recipientID, result.ToUserID)
+	assert.Equal(t, folder, result.Folder)
+	assert.Equal(t, owner, result.FromUser)
+	mockFolderShareRepo.AssertExpectations(t)
+}
+
+func TestFileShareService_ShareFolderWithUser_RejectsSelfAndNonOwner(t *testing.T) {
+	mockFolderRepo := new(MockFolderRepository)
+	mockFolderShareRepo := new(MockUserFolderShareRepository)
+
+	service := &FileShareService{
+		folderRepo:          mockFolderRepo,
+		userFolderShareRepo: mockFolderShareRepo,
+	}
+
+	ownerID := uuid.New()
+	folder := &models.Folder{ID: uuid.New(), Name: "Designs", OwnerID: ownerID}
+	mockFolderRepo.On("GetByID", folder.ID).Return(folder, nil)
+
+	_, err := service.ShareFolderWithUser(ownerID, folder.ID, ownerID, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "yourself")
+
+	_, err = service.ShareFolderWithUser(uuid.New(), folder.ID, ownerID, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "access denied")
+
+	mockFolderShareRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
 // Helper function to create string pointer
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestPresignedURLExpiry(t *testing.T) {
+	now := time.Now()
+	inOneHour := now.Add(time.Hour)
+	inTenDays := now.Add(10 * 24 * time.Hour)
+	expired := now.Add(-time.Minute)
+
+	expiry, ok := presignedURLExpiry(now, nil, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 7*24*time.Hour, expiry)
+
+	expiry, ok = presignedURLExpiry(now, &inOneHour, 0)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, expiry)
+
+	expiry, ok = presignedURLExpiry(now, &inTenDays, 24*time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, 24*time.Hour, expiry)
+
+	expiry, ok = presignedURLExpiry(now, nil, 30*24*time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, 7*24*time.Hour, expiry, "configured maximum is capped at the S3 limit")
+
+	_, ok = presignedURLExpiry(now, &expired, 0)
+	assert.False(t, ok)
+}
+
+func TestFileShareService_DirectShareURL_ShareExpiringInOneHour(t *testing.T) {
+	service, err := NewFileShareService(
+		nil, nil, nil, nil, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
+		nil, nil, 0,
+	)
+	assert.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	share := &models.FileShare{ID: uuid.New(), ShareToken: "token", IsActive: true, ExpiresAt: &expiresAt}
+	file := &models.File{ID: uuid.New(), S3Key: "files/abc"}
+
+	shareURL, err := service.directShareURL(share, file)
+	assert.NoError(t, err)
+
+	parsed, err := url.Parse(shareURL)
+	assert.NoError(t, err)
+	seconds, err := strconv.Atoi(parsed.Query().Get("X-Amz-Expires"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 3600, seconds, 5, "presigned URL should last about as long as the share, not 7 days")
+}
+
+func TestFileShareService_DirectShareURL_ResponseHeaders(t *testing.T) {
+	service, err := NewFileShareService(
+		nil, nil, nil, nil, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
+		nil, nil, 0,
+	)
+	require.NoError(t, err)
+
+	pdf := &models.File{ID: uuid.New(), S3Key: "files/pdf", OriginalName: "report.pdf", MimeType: "application/pdf"}
+	page := &models.File{ID: uuid.New(), S3Key: "files/html", OriginalName: "page.html", MimeType: "text/html"}
+
+	cases := []struct {
+		name          string
+		file          *models.File
+		forceDownload bool
+		disposition   string
+	}{
+		{"previewable type opens inline", pdf, false, "inline"},
+		{"force download saves previewable type", pdf, true, "attachment"},
+		{"risky type always downloads", page, false, "attachment"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			share := &models.FileShare{ID: uuid.New(), ShareToken: "token", IsActive: true, ForceDownload: tc.forceDownload}
+
+			shareURL, err := service.directShareURL(share, tc.file)
+			require.NoError(t, err)
+
+			parsed, err := url.Parse(shareURL)
+			require.NoError(t, err)
+			assert.Equal(t, ContentDisposition(tc.disposition, tc.file.OriginalName), parsed.Query().Get("response-content-disposition"))
+			assert.Equal(t, tc.file.MimeType, parsed.Query().Get("response-content-type"))
+		})
+	}
+}
+
+func TestFileShareService_DirectShareURL_FallsBackForUnavailableShares(t *testing.T) {
+	service, err := NewFileShareService(
+		nil, nil, nil, nil, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
+		nil, nil, 0,
+	)
+	assert.NoError(t, err)
+
+	file := &models.File{ID: uuid.New(), S3Key: "files/abc"}
+	expired := time.Now().Add(-time.Hour)
+
+	for _, share := range []*models.FileShare{
+		{ShareToken: "inactive", IsActive: false},
+		{ShareToken: "expired", IsActive: true, ExpiresAt: &expired},
+	} {
+		shareURL, err := service.directShareURL(share, file)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://localhost:8080/api/files/share/"+share.ShareToken, shareURL)
+	}
+}
+
+func TestFileShareService_GetShareCountsForFiles(t *testing.T) {
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo}
+
+	shared := uuid.New()
+	unshared := uuid.New()
+	shareRepo.On("CountActiveSharesByFileIDs", []uuid.UUID{shared, unshared}).
+		Return(map[uuid.UUID]int{shared: 2}, nil)
+
+	counts, err := service.GetShareCountsForFiles([]uuid.UUID{shared, unshared})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, counts[shared])
+	assert.Equal(t, 0, counts[unshared])
+	shareRepo.AssertExpectations(t)
+}
+
+func TestFileShareService_GetShareCountsForFiles_Empty(t *testing.T) {
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo}
+
+	counts, err := service.GetShareCountsForFiles(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+	shareRepo.AssertNotCalled(t, "CountActiveSharesByFileIDs", mock.Anything)
+}
+
+func TestFileShareService_ShareURLConsistentAcrossQueries(t *testing.T) {
+	userID := uuid.New()
+	file := &models.File{ID: uuid.New(), UploaderID: userID, S3Key: "files/abc", OriginalName: "report.pdf"}
+
+	for _, mode := range []ShareURLMode{ShareURLModeProxy, ShareURLModeDirect} {
+		t.Run(string(mode), func(t *testing.T) {
+			fileRepo := new(MockFileRepository)
+			shareRepo := new(MockFileShareRepository)
+			service, err := NewFileShareService(
+				shareRepo, nil, fileRepo, nil, nil, nil,
+				"us-east-1", "test-key", "test-secret", "test-bucket", "https://files.example.com/",
+				nil, nil, 0,
+			)
+			require.NoError(t, err)
+			service.SetShareURLMode(mode)
+
+			var created *models.FileShare
+			fileRepo.On("GetByID", file.ID).Return(file, nil)
+			shareRepo.On("Create", mock.AnythingOfType("*models.FileShare")).Run(func(args mock.Arguments) {
+				created = args.Get(0).(*models.FileShare)
+				created.ShareToken = "tok123"
+			}).Return(nil)
+
+			response, err := service.CreateFileShare(userID, &models.CreateFileShareRequest{FileID: file.ID})
+			require.NoError(t, err)
+
+			// The same share read back through myFileShares
+			created.File = file
+			shareRepo.On("GetByOwner", userID, false, 10, 0).Return([]*models.FileShare{created}, 1, nil)
+			page, err := service.GetUserFileShares(userID, 10, 0, false)
+			require.NoError(t, err)
+			listed := page.Shares
+			require.Len(t, listed, 1)
+
+			if mode == ShareURLModeProxy {
+				assert.Equal(t, "https://files.example.com/api/files/share/tok123", response.ShareURL)
+				assert.Equal(t, response.ShareURL, listed[0].ShareURL)
+				return
+			}
+
+			// Presigned URLs carry a signing timestamp, so compare everything but the query
+			createdURL, err := url.Parse(response.ShareURL)
+			require.NoError(t, err)
+			listedURL, err := url.Parse(listed[0].ShareURL)
+			require.NoError(t, err)
+			assert.NotEmpty(t, createdURL.Query().Get("X-Amz-Signature"))
+			assert.NotEmpty(t, listedURL.Query().Get("X-Amz-Signature"))
+			assert.Equal(t, createdURL.Host, listedURL.Host)
+			assert.Equal(t, createdURL.Path, listedURL.Path)
+		})
+	}
+}
+
+func TestFileShareService_GetUserFileShares_PagesShares(t *testing.T) {
+	userID := uuid.New()
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo, baseURL: "https://files.example.com", urlMode: ShareURLModeProxy}
+
+	file := &models.File{ID: uuid.New(), UploaderID: userID, OriginalName: "a.txt"}
+	shares := []*models.FileShare{
+		{ID: uuid.New(), FileID: file.ID, ShareToken: "one", IsActive: true, File: file},
+		{ID: uuid.New(), FileID: file.ID, ShareToken: "two", IsActive: true, File: file},
+	}
+	shareRepo.On("GetByOwner", userID, true, 2, 2).Return(shares, 5, nil)
+
+	page, err := service.GetUserFileShares(userID, 2, 2, true)
+	require.NoError(t, err)
+	require.Len(t, page.Shares, 2)
+	assert.Equal(t, 5, page.TotalCount)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, file, page.Shares[0].File)
+	assert.Equal(t, "https://files.example.com/api/files/share/two", page.Shares[1].ShareURL)
+
+	shareRepo.On("GetByOwner", userID, true, 2, 4).Return(shares[:1], 5, nil)
+	page, err = service.GetUserFileShares(userID, 2, 4, true)
+	require.NoError(t, err)
+	assert.False(t, page.HasMore)
+}
+
+func TestFileShareService_GetFileShareHistory(t *testing.T) {
+	ownerID := uuid.New()
+	file := &models.File{ID: uuid.New(), UploaderID: ownerID, OriginalName: "report.pdf"}
+	expired := time.Now().Add(-time.Hour)
+	limit := 2
+
+	fileRepo := new(MockFileRepository)
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileRepo: fileRepo, fileShareRepo: shareRepo, baseURL: "https://files.example.com", urlMode: ShareURLModeProxy}
+
+	fileRepo.On("GetByID", file.ID).Return(file, nil)
+	shareRepo.On("GetByFileID", file.ID).Return([]*models.FileShare{
+		{ID: uuid.New(), FileID: file.ID, ShareToken: "live", IsActive: true, DownloadCount: 3},
+		{ID: uuid.New(), FileID: file.ID, ShareToken: "off", IsActive: false, DownloadCount: 4},
+		{ID: uuid.New(), FileID: file.ID, ShareToken: "old", IsActive: true, ExpiresAt: &expired, DownloadCount: 1},
+		{ID: uuid.New(), FileID: file.ID, ShareToken: "used", IsActive: true, MaxDownloads: &limit, DownloadCount: 2},
+	}, nil)
+
+	history, err := service.GetFileShareHistory(ownerID, file.ID)
+	require.NoError(t, err)
+	assert.Equal(t, file.ID, history.FileID)
+	assert.Equal(t, 4, history.TotalShares)
+	assert.Equal(t, 1, history.ActiveShares)
+	assert.Equal(t, 10, history.TotalDownloads)
+	require.Len(t, history.Shares, 4)
+	assert.Equal(t, 4, history.Shares[1].DownloadCount)
+	assert.Equal(t, file, history.Shares[0].File)
+
+	_, err = service.GetFileShareHistory(uuid.New(), file.ID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+}
+
+func TestParseShareURLMode(t *testing.T) {
+	mode, err := ParseShareURLMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, ShareURLModeDirect, mode)
+
+	mode, err = ParseShareURLMode(" Proxy ")
+	assert.NoError(t, err)
+	assert.Equal(t, ShareURLModeProxy, mode)
+
+	_, err = ParseShareURLMode("cdn")
+	assert.Error(t, err)
+}
+
+func TestFileShareService_RecordShareDownload_ConcurrentLastDownload(t *testing.T) {
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo}
+
+	maxDownloads := 1
+	share := &models.FileShare{
+		ID:           uuid.New(),
+		IsActive:     true,
+		MaxDownloads: &maxDownloads,
+		File:         &models.File{ID: uuid.New(), UploaderID: uuid.New()},
+	}
+
+	// The conditional UPDATE lets exactly one caller take the last download
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(1, true, nil).Once()
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(0, false, nil)
+	shareRepo.On("LogDownload", mock.AnythingOfType("*models.DownloadLog")).Return(nil)
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := service.recordShareDownload(share, "", "127.0.0.1", "test"); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, succeeded)
+	shareRepo.AssertNumberOfCalls(t, "IncrementDownloadCount", attempts)
+	shareRepo.AssertNumberOfCalls(t, "LogDownload", 1)
+}
+
+// recordingEmailSender captures sent emails and optionally fails delivery
+type recordingEmailSender struct {
+	to, subject, body string
+	err               error
+}
+
+func (s *recordingEmailSender) SendEmail(to, subject, body string) error {
+	s.to, s.subject, s.body = to, subject, body
+	return s.err
+}
+
+func newShareByEmailFixture(t *testing.T) (*FileShareService, *MockFileRepository, *MockFileShareRepository, *MockUserRepository, *MockUserFileShareRepository, *models.User, *models.File) {
+	t.Helper()
+
+	fileRepo := new(MockFileRepository)
+	shareRepo := new(MockFileShareRepository)
+	userRepo := new(MockUserRepository)
+	userShareRepo := new(MockUserFileShareRepository)
+	service, err := NewFileShareService(
+		shareRepo, userShareRepo, fileRepo, userRepo, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "https://files.example.com",
+		nil, nil, 0,
+	)
+	require.NoError(t, err)
+	service.SetShareURLMode(ShareURLModeProxy)
+
+	owner := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com"}
+	file := &models.File{ID: uuid.New(), UploaderID: owner.ID, S3Key: "files/abc", OriginalName: "report.pdf"}
+	userRepo.On("GetByID", owner.ID).Return(owner, nil)
+	fileRepo.On("GetByID", file.ID).Return(file, nil)
+	shareRepo.On("Create", mock.AnythingOfType("*models.FileShare")).Run(func(args mock.Arguments) {
+		args.Get(0).(*models.FileShare).ShareToken = "tok123"
+	}).Return(nil)
+
+	return service, fileRepo, shareRepo, userRepo, userShareRepo, owner, file
+}
+
+func TestFileShareService_ShareByEmail_ExternalAddress(t *testing.T) {
+	service, _, _, userRepo, userShareRepo, owner, file := newShareByEmailFixture(t)
+	sender := &recordingEmailSender{}
+	service.SetEmailSender(sender)
+	userRepo.On("GetByEmail", "bob@external.com").Return((*models.User)(nil), errors.New("user not found"))
+
+	message := "Here is the report"
+	result, err := service.ShareByEmail(owner.ID, file.ID, " Bob <Bob@External.com> ", &message)
+	require.NoError(t, err)
+
+	assert.True(t, result.EmailSent)
+	assert.Nil(t, result.UserShare)
+	assert.Equal(t, "https://files.example.com/api/files/share/tok123", result.Share.ShareURL)
+	assert.Equal(t, "bob@external.com", sender.to)
+	assert.Contains(t, sender.subject, "report.pdf")
+	assert.Contains(t, sender.body, result.Share.ShareURL)
+	assert.Contains(t, sender.body, message)
+	userShareRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestFileShareService_ShareByEmail_ExistingUserAlsoSharedInApp(t *testing.T) {
+	service, _, _, userRepo, userShareRepo, owner, file := newShareByEmailFixture(t)
+	service.SetEmailSender(&recordingEmailSender{})
+	recipient := &models.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com"}
+	userRepo.On("GetByEmail", "bob@example.com").Return(recipient, nil)
+	userRepo.On("GetByID", recipient.ID).Return(recipient, nil)
+	userShareRepo.On("CheckIfAlreadyShared", file.ID, recipient.ID).Return(false, nil)
+	userShareRepo.On("Create", mock.AnythingOfType("*models.UserFileShare")).Return(nil)
+
+	result, err := service.ShareByEmail(owner.ID, file.ID, "bob@example.com", nil)
+	require.NoError(t, err)
+
+	require.NotNil(t, result.UserShare)
+	assert.Equal(t, recipient.ID, result.UserShare.ToUserID)
+	assert.True(t, result.EmailSent)
+}
+
+func TestFileShareService_ShareByEmail_DeliveryFailureKeepsShare(t *testing.T) {
+	service, _, shareRepo, userRepo, _, owner, file := newShareByEmailFixture(t)
+	service.SetEmailSender(&recordingEmailSender{err: errors.New("connection refused")})
+	userRepo.On("GetByEmail", "bob@external.com").Return((*models.User)(nil), errors.New("user not found"))
+
+	result, err := service.ShareByEmail(owner.ID, file.ID, "bob@external.com", nil)
+	require.NoError(t, err)
+
+	assert.False(t, result.EmailSent)
+	assert.NotNil(t, result.Share)
+	shareRepo.AssertCalled(t, "Create", mock.AnythingOfType("*models.FileShare"))
+}
+
+func TestFileShareService_ShareByEmail_InvalidAddress(t *testing.T) {
+	service, _, shareRepo, _, _, owner, file := newShareByEmailFixture(t)
+
+	_, err := service.ShareByEmail(owner.ID, file.ID, "not-an-email", nil)
+	assert.ErrorContains(t, err, "invalid email address")
+	shareRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestFileShareService_RegenerateToken_KeepsStats(t *testing.T) {
+	fileRepo := new(MockFileRepository)
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo, fileRepo: fileRepo, baseURL: "https://files.example.com", urlMode: ShareURLModeProxy}
+
+	userID := uuid.New()
+	maxDownloads := 10
+	file := &models.File{ID: uuid.New(), UploaderID: userID, OriginalName: "report.pdf"}
+	share := &models.FileShare{ID: uuid.New(), FileID: file.ID, ShareToken: "leaked", IsActive: true, DownloadCount: 4, MaxDownloads: &maxDownloads}
+	shareRepo.On("GetByID", share.ID).Return(share, nil)
+	fileRepo.On("GetByID", file.ID).Return(file, nil)
+	shareRepo.On("RegenerateToken", share.ID).Return("fresh", nil)
+
+	response, err := service.RegenerateToken(userID, share.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, "fresh", response.ShareToken)
+	assert.Equal(t, "https://files.example.com/api/files/share/fresh", response.ShareURL)
+	assert.Equal(t, 4, response.DownloadCount)
+	assert.Equal(t, &maxDownloads, response.MaxDownloads)
+}
+
+func TestFileShareService_RegenerateToken_RejectsNonOwner(t *testing.T) {
+	fileRepo := new(MockFileRepository)
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo, fileRepo: fileRepo}
+
+	file := &models.File{ID: uuid.New(), UploaderID: uuid.New()}
+	share := &models.FileShare{ID: uuid.New(), FileID: file.ID, ShareToken: "leaked"}
+	shareRepo.On("GetByID", share.ID).Return(share, nil)
+	fileRepo.On("GetByID", file.ID).Return(file, nil)
+
+	_, err := service.RegenerateToken(uuid.New(), share.ID)
+	assert.ErrorContains(t, err, "unauthorized")
+	shareRepo.AssertNotCalled(t, "RegenerateToken", mock.Anything)
+}
+
+func TestFileShareService_GetShareQRCode(t *testing.T) {
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{fileShareRepo: shareRepo, baseURL: "https://files.example.com"}
+
+	share := &models.FileShare{ID: uuid.New(), ShareToken: "tok123", IsActive: true, File: &models.File{ID: uuid.New()}}
+	expired := time.Now().Add(-time.Hour)
+	expiredShare := &models.FileShare{ID: uuid.New(), ShareToken: "old", IsActive: true, ExpiresAt: &expired}
+	shareRepo.On("GetByTokenWithFile", "tok123").Return(share, nil)
+	shareRepo.On("GetByTokenWithFile", "old").Return(expiredShare, nil)
+	shareRepo.On("GetByTokenWithFile", "missing").Return((*models.FileShare)(nil), errors.New("file share not found"))
+
+	code, err := service.GetShareQRCode("tok123")
+	require.NoError(t, err)
+	img, format, err := image.Decode(bytes.NewReader(code))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, DefaultShareQRCodeSize, img.Bounds().Dx())
+
+	code, err = service.GetShareQRCodeWithSize("tok123", 512)
+	require.NoError(t, err)
+	img, _, err = image.Decode(bytes.NewReader(code))
+	require.NoError(t, err)
+	assert.Equal(t, 512, img.Bounds().Dx())
+
+	_, err = service.GetShareQRCodeWithSize("tok123", 64)
+	assert.ErrorIs(t, err, ErrInvalidQRCodeSize)
+	_, err = service.GetShareQRCodeWithSize("tok123", 5000)
+	assert.ErrorIs(t, err, ErrInvalidQRCodeSize)
+
+	_, err = service.GetShareQRCode("old")
+	assert.Error(t, err)
+	_, err = service.GetShareQRCode("missing")
+	assert.Error(t, err)
+}
+
+func TestFileShareService_DownloadSharedFile_BurnAfterDownload(t *testing.T) {
+	// Stand-in S3 endpoint that counts object reads
+	var s3Reads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s3Reads++
+		w.Header().Set("Content-Length", "5")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{
+		fileShareRepo: shareRepo,
+		s3Client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(srv.URL),
+			UsePathStyle: true,
+			Credentials:  aws.AnonymousCredentials{},
+		}),
+		bucketName: "test-bucket",
+		baseURL:    "http://localhost:8080",
+	}
+
+	share := &models.FileShare{
+		ID:                uuid.New(),
+		ShareToken:        "onetime",
+		IsActive:          true,
+		BurnAfterDownload: true,
+		File:              &models.File{ID: uuid.New(), UploaderID: uuid.New(), S3Key: "files/note", OriginalName: "note.txt", Size: 5},
+	}
+	assert.Equal(t, "http://localhost:8080/api/files/share/onetime", service.buildShareURL(share, share.File))
+
+	// The counted download retires the token, so later lookups by it find nothing
+	shareRepo.On("GetByTokenWithFile", "onetime").Return(share, nil).Once()
+	shareRepo.On("GetByTokenWithFile", "onetime").Return((*models.FileShare)(nil), errors.New("file share not found"))
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(1, true, nil).Once()
+	shareRepo.On("LogDownload", mock.AnythingOfType("*models.DownloadLog")).Return(nil)
+
+	_, response, err := service.DownloadSharedFile(context.Background(), "onetime", "", "127.0.0.1", "test", "", "")
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.False(t, share.IsActive)
+
+	_, _, err = service.DownloadSharedFile(context.Background(), "onetime", "", "127.0.0.1", "test", "", "")
+	assert.Error(t, err)
+	assert.Equal(t, 1, s3Reads)
+	shareRepo.AssertNumberOfCalls(t, "IncrementDownloadCount", 1)
+}
+
+func TestFileShareService_GetAllSharedWithMe(t *testing.T) {
+	userShareRepo := new(MockUserFileShareRepository)
+	service := &FileShareService{userFileShareRepo: userShareRepo}
+
+	userID := uuid.New()
+	shared := []*models.SharedWithMeFile{
+		{File: &models.File{ID: uuid.New()}, Sources: []string{models.SharedWithMeSourceAccessGrant, models.SharedWithMeSourceFolderShare}},
+		{File: &models.File{ID: uuid.New()}, Sources: []string{models.SharedWithMeSourceUserShare}},
+	}
+	userShareRepo.On("GetSharedWithMe", userID, 2, 0).Return(shared, 3, nil)
+	userShareRepo.On("GetSharedWithMe", userID, 2, 2).Return(shared[:1], 3, nil)
+
+	page, err := service.GetAllSharedWithMe(userID, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, shared, page.Files)
+	assert.Equal(t, 3, page.TotalCount)
+	assert.True(t, page.HasMore)
+
+	page, err = service.GetAllSharedWithMe(userID, 2, 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Files, 1)
+	assert.False(t, page.HasMore)
+}
+
+func TestFileShareService_GetAllSharedWithMe_RepositoryError(t *testing.T) {
+	userShareRepo := new(MockUserFileShareRepository)
+	service := &FileShareService{userFileShareRepo: userShareRepo}
+
+	userID := uuid.New()
+	userShareRepo.On("GetSharedWithMe", userID, 20, 0).Return([]*models.SharedWithMeFile(nil), 0, assert.AnError)
+
+	_, err := service.GetAllSharedWithMe(userID, 20, 0)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+// newRangeS3Server stands in for S3 serving content with the ETag "v1": it honors Range and
+// fails If-Match preconditions for any other ETag with 412, as S3 does
+func newRangeS3Server(t *testing.T, content string) (*s3.Client, *int) {
+	reads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads++
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != `"v1"` {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = w.Write([]byte(`<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`))
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		rng, _ := ParseRangeHeader(r.Header.Get("Range"), int64(len(content)))
+		if rng == nil {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		w.Header().Set("Content-Range", rng.ContentRange(int64(len(content))))
+		w.Header().Set("Content-Length", strconv.FormatInt(rng.Length(), 10))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(content[rng.Start : rng.End+1]))
+	}))
+	t.Cleanup(srv.Close)
+
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	}), &reads
+}
+
+func newRangeShareService(t *testing.T, share *models.FileShare) (*FileShareService, *MockFileShareRepository, *int) {
+	client, reads := newRangeS3Server(t, "hello world")
+	shareRepo := new(MockFileShareRepository)
+	shareRepo.On("GetByTokenWithFile", share.ShareToken).Return(share, nil)
+	shareRepo.On("LogDownload", mock.AnythingOfType("*models.DownloadLog")).Return(nil)
+	return &FileShareService{fileShareRepo: shareRepo, s3Client: client, bucketName: "test-bucket"}, shareRepo, reads
+}
+
+func newRangeShare(token string) *models.FileShare {
+	return &models.FileShare{
+		ID:         uuid.New(),
+		ShareToken: token,
+		IsActive:   true,
+		File:       &models.File{ID: uuid.New(), UploaderID: uuid.New(), S3Key: "files/hello", OriginalName: "hello.txt", Size: 11},
+	}
+}
+
+func TestFileShareService_DownloadSharedFile_RangeCountedForNewClient(t *testing.T) {
+	share := newRangeShare("ranged")
+	service, shareRepo, _ := newRangeShareService(t, share)
+	shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.1", "curl", mock.Anything).Return(false, nil)
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(1, true, nil)
+
+	_, response, err := service.DownloadSharedFile(context.Background(), "ranged", "", "10.0.0.1", "curl", "bytes=1-", "")
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+	assert.Equal(t, "ello world", string(body))
+	shareRepo.AssertNumberOfCalls(t, "IncrementDownloadCount", 1)
+}
+
+func TestFileShareService_DownloadSharedFile_RangeRefusedOnceLimitUsed(t *testing.T) {
+	share := newRangeShare("limited")
+	service, shareRepo, _ := newRangeShareService(t, share)
+	shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.2", "curl", mock.Anything).Return(false, nil)
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(0, false, nil)
+
+	_, response, err := service.DownloadSharedFile(context.Background(), "limited", "", "10.0.0.2", "curl", "bytes=1-", "")
+	assert.Error(t, err)
+	assert.Nil(t, response)
+}
+
+func TestFileShareService_DownloadSharedFile_ResumeNotCountedAgain(t *testing.T) {
+	share := newRangeShare("resume")
+	service, shareRepo, _ := newRangeShareService(t, share)
+	shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.3", "browser", mock.Anything).Return(true, nil)
+
+	_, response, err := service.DownloadSharedFile(context.Background(), "resume", "", "10.0.0.3", "browser", "bytes=6-", `"v1"`)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+	assert.Equal(t, "world", string(body))
+	shareRepo.AssertNotCalled(t, "IncrementDownloadCount", mock.Anything)
+}
+
+func TestFileShareService_DownloadSharedFile_ResumeAllowedAfterLimitReached(t *testing.T) {
+	// The only download of a single-download share was interrupted
+	share := newRangeShare("last")
+	maxDownloads := 1
+	share.MaxDownloads = &maxDownloads
+	share.DownloadCount = 1
+	service, shareRepo, _ := newRangeShareService(t, share)
+	shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.7", "browser", mock.Anything).Return(true, nil)
+
+	_, response, err := service.DownloadSharedFile(context.Background(), "last", "", "10.0.0.7", "browser", "bytes=6-", `"v1"`)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+	assert.Equal(t, "world", string(body))
+	shareRepo.AssertNotCalled(t, "IncrementDownloadCount", mock.Anything)
+
+	// A fresh download, or a resume of an expired share, is still refused
+	_, _, err = service.DownloadSharedFile(context.Background(), "last", "", "10.0.0.7", "browser", "", "")
+	assert.Error(t, err)
+	expired := time.Now().Add(-time.Minute)
+	share.ExpiresAt = &expired
+	_, _, err = service.DownloadSharedFile(context.Background(), "last", "", "10.0.0.7", "browser", "bytes=6-", `"v1"`)
+	assert.Error(t, err)
+}
+
+func TestFileShareService_DownloadSharedFile_RepeatedRangesCountedOutsideResumeWindow(t *testing.T) {
+	share := newRangeShare("repeated")
+	maxDownloads := 2
+	share.MaxDownloads = &maxDownloads
+	service, shareRepo, _ := newRangeShareService(t, share)
+	// Only downloads logged within the resume window make a range free; this client's last
+	// counted download is older than that
+	inWindow := mock.MatchedBy(func(since time.Time) bool {
+		return time.Since(since) > shareResumeWindow-time.Minute && time.Since(since) < shareResumeWindow+time.Minute
+	})
+	shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.8", "curl", inWindow).Return(false, nil)
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(1, true, nil).Once()
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(2, true, nil).Once()
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(2, false, nil)
+
+	for i := 0; i < 2; i++ {
+		_, response, err := service.DownloadSharedFile(context.Background(), "repeated", "", "10.0.0.8", "curl", "bytes=1-", "")
+		require.NoError(t, err)
+		response.Body.Close()
+	}
+	_, _, err := service.DownloadSharedFile(context.Background(), "repeated", "", "10.0.0.8", "curl", "bytes=1-", "")
+	assert.Error(t, err, "repeated ranges use up the download limit")
+	shareRepo.AssertNumberOfCalls(t, "IncrementDownloadCount", 3)
+}
+
+func TestFileShareService_DownloadSharedFile_IfRangeMismatchCountsFullResponse(t *testing.T) {
+	share := newRangeShare("ifrange")
+	service, shareRepo, reads := newRangeShareService(t, share)
+	// Even a client with a counted download gets the full file counted when If-Range fails
+	shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.4", "curl", mock.Anything).Return(true, nil)
+	shareRepo.On("IncrementDownloadCount", share.ID).Return(2, true, nil)
+
+	_, response, err := service.DownloadSharedFile(context.Background(), "ifrange", "", "10.0.0.4", "curl", "bytes=1-", `"x"`)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, 2, *reads)
+	shareRepo.AssertNumberOfCalls(t, "IncrementDownloadCount", 1)
+}
+
+func TestFileShareService_DownloadSharedFile_RangedRequestsBurnShare(t *testing.T) {
+	for name, req := range map[string]struct{ rangeHeader, ifRange string }{
+		"range":    {"bytes=1-", ""},
+		"if-range": {"bytes=1-", `"x"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			share := newRangeShare("burn-" + name)
+			share.BurnAfterDownload = true
+			service, shareRepo, _ := newRangeShareService(t, share)
+			shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.5", "curl", mock.Anything).Return(false, nil)
+			shareRepo.On("IncrementDownloadCount", share.ID).Return(1, true, nil).Once()
+			shareRepo.On("IncrementDownloadCount", share.ID).Return(0, false, nil)
+
+			_, response, err := service.DownloadSharedFile(context.Background(), share.ShareToken, "", "10.0.0.5", "curl", req.rangeHeader, req.ifRange)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.False(t, share.IsActive, "the first ranged download burns the share")
+
+			// A repeat from another client, even ranged, finds the share used up
+			shareRepo.On("HasDownloadFrom", share.ID, "10.0.0.6", "curl", mock.Anything).Return(false, nil)
+			_, _, err = service.DownloadSharedFile(context.Background(), share.ShareToken, "", "10.0.0.6", "curl", req.rangeHeader, req.ifRange)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFileShareService_DownloadSharedFile_S3ErrorDoesNotBurnShare(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	shareRepo := new(MockFileShareRepository)
+	service := &FileShareService{
+		fileShareRepo: shareRepo,
+		s3Client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(srv.URL),
+			UsePathStyle: true,
+			Credentials:  aws.AnonymousCredentials{},
+		}),
+		bucketName: "test-bucket",
+	}
+	share := newRangeShare("missing-object")
+	share.BurnAfterDownload = true
+	shareRepo.On("GetByTokenWithFile", share.ShareToken).Return(share, nil)
+
+	_, _, err := service.DownloadSharedFile(context.Background(), share.ShareToken, "", "127.0.0.1", "test", "", "")
+	assert.Error(t, err)
+	assert.True(t, share.IsActive)
+	shareRepo.AssertNotCalled(t, "IncrementDownloadCount", mock.Anything)
+}
@@ -1,26 +1,73 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
+	"unicode"
 
 	"filevault/internal/models"
 	"filevault/internal/repositories"
 
 	"github.com/google/uuid"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
+// DefaultMaxFolderDepth is how many levels deep folders may be nested unless configured otherwise
+const DefaultMaxFolderDepth = 20
+
+// ErrFolderTooDeep is returned when a folder would be nested deeper than the configured maximum
+var ErrFolderTooDeep = errors.New("folder nesting limit reached")
+
 // FolderService handles folder business logic
 type FolderService struct {
 	folderRepo *repositories.FolderRepository
+	// maxDepth is the deepest a folder may be nested, counting a root folder as 1; 0 means no limit
+	maxDepth int
 }
 
 // NewFolderService creates a new folder service
 func NewFolderService(folderRepo *repositories.FolderRepository) *FolderService {
 	return &FolderService{
 		folderRepo: folderRepo,
+		maxDepth:   DefaultMaxFolderDepth,
+	}
+}
+
+// SetMaxFolderDepth sets how many levels deep folders may be nested; 0 or less removes the limit
+func (s *FolderService) SetMaxFolderDepth(depth int) {
+	if depth < 0 {
+		depth = 0
+	}
+	s.maxDepth = depth
+}
+
+// checkFolderDepth rejects placing a folder tree so that its deepest folder would end up at
+// depth (a root folder is at depth 1). Moving a folder must check the new parent's depth plus
+// the height of the subtree being moved.
+func checkFolderDepth(depth, maxDepth int) error {
+	if maxDepth > 0 && depth > maxDepth {
+		return fmt.Errorf("%w: folders can be nested at most %d levels deep", ErrFolderTooDeep, maxDepth)
+	}
+	return nil
+}
+
+// folderDepth returns how deep a folder is nested, counting a root folder as 1. The walk stops
+// one level past the limit, which is enough to tell the limit is exceeded.
+func (s *FolderService) folderDepth(folderID uuid.UUID) (int, error) {
+	walk := maxFolderAncestryDepth
+	if s.maxDepth > 0 {
+		walk = s.maxDepth
 	}
+	ancestors, err := s.folderRepo.GetAncestors(folderID, walk)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get folder depth: %w", err)
+	}
+	return len(ancestors), nil
 }
 
 // CreateFolder creates a new folder
@@ -62,6 +109,17 @@ func (s *FolderService) CreateFolder(ownerID uuid.UUID, req *models.CreateFolder
 		}
 		parentPath = parentFolder.Path
 		fmt.Printf("DEBUG: Parent folder found, path: %s\n", parentPath)
+
+		if s.maxDepth > 0 {
+			parentDepth, err := s.folderDepth(parentFolder.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkFolderDepth(parentDepth+1, s.maxDepth); err != nil {
+				fmt.Printf("ERROR: Folder would be nested too deeply: %v\n", err)
+				return nil, err
+			}
+		}
 	} else {
 		parentPath = ""
 		fmt.Printf("DEBUG: No parent folder, creating root folder\n")
@@ -77,16 +135,22 @@ func (s *FolderService) CreateFolder(ownerID uuid.UUID, req *models.CreateFolder
 	fmt.Printf("DEBUG: Full path will be: %s\n", fullPath)
 
 	// Check if folder with same name already exists in the same parent
-	existingFolders, err := s.folderRepo.GetByOwnerID(ownerID)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to get existing folders: %v\n", err)
-		return nil, fmt.Errorf("failed to check existing folders: %w", err)
+	// (ignoring case and accents, so "Reports" and "réports" conflict)
+	if err := s.checkFolderNameAvailable(ownerID, req.ParentID, folderName, nil); err != nil {
+		fmt.Printf("ERROR: Folder name check failed for '%s': %v\n", fullPath, err)
+		return nil, err
 	}
 
-	for _, existing := range existingFolders {
-		if existing.Path == fullPath {
-			fmt.Printf("ERROR: Folder with same path already exists: %s\n", fullPath)
-			return nil, fmt.Errorf("folder with name '%s' already exists in this location", folderName)
+	var color, icon *string
+	var err error
+	if req.Color != nil {
+		if color, err = normalizeFolderColor(*req.Color); err != nil {
+			return nil, err
+		}
+	}
+	if req.Icon != nil {
+		if icon, err = normalizeFolderIcon(*req.Icon); err != nil {
+			return nil, err
 		}
 	}
 
@@ -98,6 +162,8 @@ func (s *FolderService) CreateFolder(ownerID uuid.UUID, req *models.CreateFolder
 		ParentID:  req.ParentID,
 		OwnerID:   ownerID,
 		FileCount: 0,
+		Color:     color,
+		Icon:      icon,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -108,6 +174,9 @@ func (s *FolderService) CreateFolder(ownerID uuid.UUID, req *models.CreateFolder
 	err = s.folderRepo.Create(folder)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to create folder in database: %v\n", err)
+		if errors.Is(err, repositories.ErrDuplicateFolderName) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to create folder: %w", err)
 	}
 
@@ -161,6 +230,55 @@ func (s *FolderService) GetFolderByID(folderID uuid.UUID, userID uuid.UUID) (*mo
 	return folder, nil
 }
 
+// maxFolderAncestryDepth bounds how far GetAncestors walks up the folder tree
+const maxFolderAncestryDepth = 64
+
+// GetAncestors returns the path from the root folder down to the given folder, for breadcrumbs
+func (s *FolderService) GetAncestors(folderID uuid.UUID, userID uuid.UUID) ([]*models.Folder, error) {
+	// Verify ownership of the target folder
+	if _, err := s.GetFolderByID(folderID, userID); err != nil {
+		return nil, err
+	}
+
+	ancestors, err := s.folderRepo.GetAncestors(folderID, maxFolderAncestryDepth)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to get folder ancestors: %v\n", err)
+		return nil, fmt.Errorf("failed to get folder ancestors: %w", err)
+	}
+
+	return ancestors, nil
+}
+
+// GetFolderSize returns how many bytes the user's files take up in a folder, including every
+// subfolder when recursive. Deduplicated files stored as one object are counted once.
+func (s *FolderService) GetFolderSize(folderID uuid.UUID, userID uuid.UUID, recursive bool) (int64, error) {
+	if _, err := s.GetFolderByID(folderID, userID); err != nil {
+		return 0, err
+	}
+
+	size, err := s.folderRepo.GetSize(folderID, userID, recursive)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get folder size: %w", err)
+	}
+	return size, nil
+}
+
+// FillFolderSizes sets SizeBytes on the user's folders to their recursive size, in one query
+func (s *FolderService) FillFolderSizes(folders []*models.Folder, userID uuid.UUID) error {
+	if len(folders) == 0 {
+		return nil
+	}
+
+	sizes, err := s.folderRepo.GetSizes(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get folder sizes: %w", err)
+	}
+	for _, folder := range folders {
+		folder.SizeBytes = sizes[folder.ID]
+	}
+	return nil
+}
+
 // UpdateFolder updates a folder
 func (s *FolderService) UpdateFolder(folderID uuid.UUID, userID uuid.UUID, req *models.UpdateFolderRequest) (*models.Folder, error) {
 	fmt.Printf("=== FOLDER SERVICE UPDATE DEBUG START ===\n")
@@ -173,32 +291,54 @@ func (s *FolderService) UpdateFolder(folderID uuid.UUID, userID uuid.UUID, req *
 		return nil, err
 	}
 
-	// Validate new name
-	if strings.TrimSpace(req.Name) == "" {
+	// Validate new name; it may be left out when only the color or icon changes
+	newName := strings.TrimSpace(req.Name)
+	if newName == "" && req.Color == nil && req.Icon == nil {
 		fmt.Printf("ERROR: New folder name is empty\n")
 		return nil, fmt.Errorf("folder name is required")
 	}
 
-	newName := strings.TrimSpace(req.Name)
-	fmt.Printf("DEBUG: Updating folder name from '%s' to '%s'\n", folder.Name, newName)
+	if req.Color != nil {
+		if folder.Color, err = normalizeFolderColor(*req.Color); err != nil {
+			return nil, err
+		}
+	}
+	if req.Icon != nil {
+		if folder.Icon, err = normalizeFolderIcon(*req.Icon); err != nil {
+			return nil, err
+		}
+	}
 
-	// Update the folder
-	folder.Name = newName
-	folder.UpdatedAt = time.Now()
+	if newName != "" {
+		fmt.Printf("DEBUG: Updating folder name from '%s' to '%s'\n", folder.Name, newName)
+
+		if err := s.checkFolderNameAvailable(userID, folder.ParentID, newName, &folder.ID); err != nil {
+			fmt.Printf("ERROR: Folder name check failed for '%s': %v\n", newName, err)
+			return nil, err
+		}
 
-	// Update path if needed (for now, just update the name part)
-	// TODO: Implement proper path updating logic
-	pathParts := strings.Split(folder.Path, "/")
-	if len(pathParts) > 0 {
-		pathParts[len(pathParts)-1] = newName
-		folder.Path = strings.Join(pathParts, "/")
+		folder.Name = newName
+
+		// Update path if needed (for now, just update the name part)
+		// TODO: Implement proper path updating logic
+		pathParts := strings.Split(folder.Path, "/")
+		if len(pathParts) > 0 {
+			pathParts[len(pathParts)-1] = newName
+			folder.Path = strings.Join(pathParts, "/")
+		}
 	}
 
+	// Update the folder
+	folder.UpdatedAt = time.Now()
+
 	fmt.Printf("DEBUG: Updated folder struct: %+v\n", folder)
 
 	err = s.folderRepo.Update(folder)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to update folder in database: %v\n", err)
+		if errors.Is(err, repositories.ErrDuplicateFolderName) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to update folder: %w", err)
 	}
 
@@ -249,6 +389,95 @@ func (s *FolderService) DeleteFolder(folderID uuid.UUID, userID uuid.UUID) error
 	return nil
 }
 
+// checkFolderNameAvailable returns ErrDuplicateFolderName if a sibling folder already uses the name.
+// excludeID skips the folder being renamed.
+func (s *FolderService) checkFolderNameAvailable(ownerID uuid.UUID, parentID *uuid.UUID, name string, excludeID *uuid.UUID) error {
+	existingFolders, err := s.folderRepo.GetByOwnerID(ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to check existing folders: %w", err)
+	}
+
+	key := folderNameKey(name)
+	for _, existing := range existingFolders {
+		if excludeID != nil && existing.ID == *excludeID {
+			continue
+		}
+		if sameParentFolder(existing.ParentID, parentID) && folderNameKey(existing.Name) == key {
+			return repositories.ErrDuplicateFolderName
+		}
+	}
+
+	return nil
+}
+
+// folderIcons are the icon names the UI can show for a folder
+var folderIcons = map[string]bool{
+	"folder":    true,
+	"archive":   true,
+	"briefcase": true,
+	"code":      true,
+	"document":  true,
+	"heart":     true,
+	"home":      true,
+	"image":     true,
+	"lock":      true,
+	"music":     true,
+	"star":      true,
+	"video":     true,
+}
+
+// folderColorPattern matches #rgb and #rrggbb hex colors
+var folderColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// normalizeFolderColor validates a hex color and returns it as lowercase #rrggbb, or nil
+// for an empty value, which clears the color
+func normalizeFolderColor(color string) (*string, error) {
+	color = strings.TrimSpace(color)
+	if color == "" {
+		return nil, nil
+	}
+	if !folderColorPattern.MatchString(color) {
+		return nil, fmt.Errorf("invalid folder color %q: must be a hex color like #1e90ff", color)
+	}
+
+	color = strings.ToLower(color)
+	if len(color) == 4 {
+		color = string([]byte{'#', color[1], color[1], color[2], color[2], color[3], color[3]})
+	}
+	return &color, nil
+}
+
+// normalizeFolderIcon validates an icon name against the allowed set, returning nil for an
+// empty value, which clears the icon
+func normalizeFolderIcon(icon string) (*string, error) {
+	icon = strings.ToLower(strings.TrimSpace(icon))
+	if icon == "" {
+		return nil, nil
+	}
+	if !folderIcons[icon] {
+		return nil, fmt.Errorf("invalid folder icon %q", icon)
+	}
+	return &icon, nil
+}
+
+// folderNameKey normalizes a folder name for comparison by lowercasing it and stripping accents
+func folderNameKey(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, name)
+	if err != nil {
+		stripped = name
+	}
+	return strings.ToLower(strings.TrimSpace(stripped))
+}
+
+// sameParentFolder reports whether two optional parent IDs refer to the same location
+func sameParentFolder(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
 
 
 
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolderNameKey_IgnoresCaseAndAccents(t *testing.T) {
+	assert.Equal(t, folderNameKey("Reports"), folderNameKey("reports"))
+	assert.Equal(t, folderNameKey("Résumé"), folderNameKey("resume"))
+	assert.Equal(t, folderNameKey("  Photos "), folderNameKey("PHOTOS"))
+	assert.NotEqual(t, folderNameKey("Reports"), folderNameKey("Reports 2024"))
+}
+
+func TestSameParentFolder(t *testing.T) {
+	a := uuid.New()
+	b := uuid.New()
+	aCopy := a
+
+	assert.True(t, sameParentFolder(nil, nil))
+	assert.True(t, sameParentFolder(&a, &aCopy))
+	assert.False(t, sameParentFolder(&a, &b))
+	assert.False(t, sameParentFolder(&a, nil))
+	assert.False(t, sameParentFolder(nil, &b))
+}
+
+func TestNormalizeFolderColor(t *testing.T) {
+	color, err := normalizeFolderColor("#1E90FF")
+	assert.NoError(t, err)
+	assert.Equal(t, "#1e90ff", *color)
+
+	color, err = normalizeFolderColor(" #f0a ")
+	assert.NoError(t, err)
+	assert.Equal(t, "#ff00aa", *color)
+
+	color, err = normalizeFolderColor("")
+	assert.NoError(t, err)
+	assert.Nil(t, color)
+
+	for _, invalid := range []string{"red", "1e90ff", "#1e90f", "#gggggg", "#1e90ff; x"} {
+		_, err := normalizeFolderColor(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNormalizeFolderIcon(t *testing.T) {
+	icon, err := normalizeFolderIcon("Star")
+	assert.NoError(t, err)
+	assert.Equal(t, "star", *icon)
+
+	icon, err = normalizeFolderIcon("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, icon)
+
+	_, err = normalizeFolderIcon("skull")
+	assert.Error(t, err)
+}
+
+func TestCheckFolderDepth(t *testing.T) {
+	const maxDepth = 3
+
+	// Creating folders one below the other: root, child, grandchild fit, a fourth level doesn't
+	for depth := 1; depth <= maxDepth; depth++ {
+		assert.NoError(t, checkFolderDepth(depth, maxDepth), "depth %d", depth)
+	}
+
+	err := checkFolderDepth(maxDepth+1, maxDepth)
+	assert.True(t, errors.Is(err, ErrFolderTooDeep))
+	assert.Contains(t, err.Error(), "at most 3 levels")
+
+	// No limit
+	assert.NoError(t, checkFolderDepth(500, 0))
+}
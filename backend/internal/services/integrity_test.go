@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func integrityTestFile(content []byte) *models.File {
+	sum := sha256.Sum256(content)
+	return &models.File{
+		ID:    uuid.New(),
+		S3Key: "files/test",
+		Size:  int64(len(content)),
+		Hash:  hex.EncodeToString(sum[:]),
+	}
+}
+
+func TestCheckObjectIntegrity(t *testing.T) {
+	content := []byte("hello integrity")
+	file := integrityTestFile(content)
+
+	report, err := checkObjectIntegrity(file, bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, IntegrityOK, report.Status)
+	assert.Equal(t, file.Hash, report.ActualHash)
+
+	// Truncated object
+	report, err = checkObjectIntegrity(file, bytes.NewReader(content[:5]))
+	require.NoError(t, err)
+	assert.Equal(t, IntegrityCorrupt, report.Status)
+	assert.Equal(t, int64(5), report.ActualSize)
+
+	// Same length, different bytes
+	corrupted := append([]byte{}, content...)
+	corrupted[0] ^= 0xff
+	report, err = checkObjectIntegrity(file, bytes.NewReader(corrupted))
+	require.NoError(t, err)
+	assert.Equal(t, IntegrityCorrupt, report.Status)
+}
+
+func TestVerifyDownload_HashesSmallFullDownloads(t *testing.T) {
+	content := []byte("small file body")
+	file := integrityTestFile(content)
+
+	download := &ObjectDownload{
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		StatusCode:    http.StatusOK,
+		ContentLength: file.Size,
+	}
+	VerifyDownload(download, file, 1024)
+
+	reader, ok := download.Body.(*verifyingReader)
+	require.True(t, ok)
+
+	// The body still streams unchanged
+	got, err := io.ReadAll(download.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.True(t, reader.checked)
+	assert.Equal(t, file.Size, reader.read)
+}
+
+func TestVerifyDownload_SkipsRangesAndLargeFiles(t *testing.T) {
+	content := []byte("0123456789")
+	file := integrityTestFile(content)
+
+	partial := &ObjectDownload{
+		Body:          io.NopCloser(bytes.NewReader(content[2:])),
+		StatusCode:    http.StatusPartialContent,
+		ContentLength: 8,
+	}
+	VerifyDownload(partial, file, 1024)
+	_, wrapped := partial.Body.(*verifyingReader)
+	assert.False(t, wrapped)
+
+	large := &ObjectDownload{
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		StatusCode:    http.StatusOK,
+		ContentLength: file.Size,
+	}
+	VerifyDownload(large, file, 5)
+	_, wrapped = large.Body.(*verifyingReader)
+	assert.False(t, wrapped)
+
+	disabled := &ObjectDownload{
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		StatusCode:    http.StatusOK,
+		ContentLength: file.Size,
+	}
+	VerifyDownload(disabled, file, 0)
+	_, wrapped = disabled.Body.(*verifyingReader)
+	assert.False(t, wrapped)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrAccountLocked is returned for logins to an account locked after too many failed attempts
+var ErrAccountLocked = errors.New("Too many failed login attempts. Please try again later.")
+
+// LoginLockoutPolicy locks an account for Window once MaxFailures logins with a wrong password
+// were attempted within Window. A MaxFailures of 0 disables the lockout.
+type LoginLockoutPolicy struct {
+	MaxFailures int
+	Window      time.Duration
+	// Notify tells the account owner, in the app and by email, when their account is locked
+	Notify bool
+}
+
+// SecurityNotifier shows a notification to a user, live and in their notification list
+type SecurityNotifier interface {
+	BroadcastNotification(userID, notificationType, title, message string, duration int)
+}
+
+// loginFailures is one account's recent failed logins and any lock on it
+type loginFailures struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+// loginLockout tracks failed logins per account in memory
+type loginLockout struct {
+	policy    LoginLockoutPolicy
+	mutex     sync.Mutex
+	accounts  map[uuid.UUID]*loginFailures
+	lastSweep time.Time
+}
+
+func newLoginLockout(policy LoginLockoutPolicy) *loginLockout {
+	return &loginLockout{
+		policy:   policy,
+		accounts: make(map[uuid.UUID]*loginFailures),
+	}
+}
+
+// unknownLoginNamespace derives the IDs failed logins to unknown identifiers are tracked under
+var unknownLoginNamespace = uuid.MustParse("6f1c3b0e-2f4d-4c55-9a61-0d3e8b7a2c19")
+
+// unknownLoginID is the ID failed logins with an identifier that matches no account are tracked
+// under, the same for every attempt with that identifier
+func unknownLoginID(identifier string) uuid.UUID {
+	return uuid.NewSHA1(unknownLoginNamespace, []byte(identifier))
+}
+
+// locked reports whether the account is locked at now
+func (l *loginLockout) locked(userID uuid.UUID, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	account := l.accounts[userID]
+	return account != nil && now.Before(account.lockedUntil)
+}
+
+// recordFailure counts a failed login and reports whether it locked the account. Only the
+// failure that starts a lock reports true, so each lock is announced once.
+func (l *loginLockout) recordFailure(userID uuid.UUID, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	account := l.accounts[userID]
+	if account == nil {
+		account = &loginFailures{}
+		l.accounts[userID] = account
+	}
+	if now.Before(account.lockedUntil) {
+		return false
+	}
+	account.failures = pruneLoginFailures(account.failures, now.Add(-l.policy.Window))
+	account.failures = append(account.failures, now)
+
+	if len(account.failures) < l.policy.MaxFailures {
+		return false
+	}
+	account.failures = nil
+	account.lockedUntil = now.Add(l.policy.Window)
+	return true
+}
+
+// reset forgets the failed logins of an account after a successful login
+func (l *loginLockout) reset(userID uuid.UUID) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.accounts, userID)
+}
+
+// sweep drops accounts with neither a lock nor failures left in the window, at most once per
+// window so a stream of failed logins doesn't scan every account each time
+func (l *loginLockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.policy.Window {
+		return
+	}
+	l.lastSweep = now
+
+	cutoff := now.Add(-l.policy.Window)
+	for userID, account := range l.accounts {
+		if now.Before(account.lockedUntil) {
+			continue
+		}
+		account.failures = pruneLoginFailures(account.failures, cutoff)
+		if len(account.failures) == 0 {
+			delete(l.accounts, userID)
+		}
+	}
+}
+
+// pruneLoginFailures drops failures at or before cutoff; failures are in time order
+func pruneLoginFailures(failures []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(failures) && !failures[i].After(cutoff) {
+		i++
+	}
+	return failures[i:]
+}
+
+// lockoutNotice is the text of the notification sent when an account is locked
+func lockoutNotice(clientIP string, lockedAt time.Time, window time.Duration) string {
+	if clientIP == "" {
+		clientIP = "an unknown address"
+	}
+	return fmt.Sprintf(
+		"Your account was locked for %d minutes after repeated failed login attempts. The last attempt came from %s at %s. "+
+			"If this wasn't you, someone may be trying to guess your password; consider changing it.",
+		int(window.Round(time.Minute).Minutes()), clientIP, lockedAt.UTC().Format(time.RFC1123),
+	)
+}
+
+// notifyLockout tells the owner of a locked account about it; failures are logged, not returned
+func (s *AuthService) notifyLockout(userID uuid.UUID, email, clientIP string, lockedAt time.Time) {
+	message := lockoutNotice(clientIP, lockedAt, s.lockout.policy.Window)
+
+	if s.securityNotifier != nil {
+		s.securityNotifier.BroadcastNotification(userID.String(), "warning", "Failed login attempts", message, 10000)
+	}
+	if s.emailSender != nil && email != "" {
+		if err := s.emailSender.SendEmail(email, "Your FileVault account was locked", message); err != nil {
+			log.Printf("Failed to email user %s about account lockout: %v", userID, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSecurityNotifier captures notifications shown to users
+type recordingSecurityNotifier struct {
+	userIDs  []string
+	messages []string
+}
+
+func (n *recordingSecurityNotifier) BroadcastNotification(userID, notificationType, title, message string, duration int) {
+	n.userIDs = append(n.userIDs, userID)
+	n.messages = append(n.messages, message)
+}
+
+func TestLoginLockout_LocksAfterMaxFailures(t *testing.T) {
+	lockout := newLoginLockout(LoginLockoutPolicy{MaxFailures: 3, Window: 15 * time.Minute})
+	userID := uuid.New()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.False(t, lockout.recordFailure(userID, now))
+	assert.False(t, lockout.recordFailure(userID, now.Add(time.Minute)))
+	assert.False(t, lockout.locked(userID, now.Add(time.Minute)))
+
+	assert.True(t, lockout.recordFailure(userID, now.Add(2*time.Minute)), "the third failure starts the lock")
+	assert.True(t, lockout.locked(userID, now.Add(10*time.Minute)))
+
+	// Further failures during the lock don't announce it again
+	assert.False(t, lockout.recordFailure(userID, now.Add(5*time.Minute)))
+	assert.False(t, lockout.recordFailure(userID, now.Add(6*time.Minute)))
+
+	assert.False(t, lockout.locked(userID, now.Add(17*time.Minute)), "the lock runs out after the window")
+	assert.False(t, lockout.locked(uuid.New(), now), "other accounts are unaffected")
+}
+
+func TestLoginLockout_OldFailuresExpire(t *testing.T) {
+	lockout := newLoginLockout(LoginLockoutPolicy{MaxFailures: 3, Window: 10 * time.Minute})
+	userID := uuid.New()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	lockout.recordFailure(userID, now)
+	lockout.recordFailure(userID, now.Add(time.Minute))
+	assert.False(t, lockout.recordFailure(userID, now.Add(12*time.Minute)), "the first two failures are outside the window")
+}
+
+func TestLoginLockout_SuccessfulLoginResetsFailures(t *testing.T) {
+	lockout := newLoginLockout(LoginLockoutPolicy{MaxFailures: 2, Window: 10 * time.Minute})
+	userID := uuid.New()
+	now := time.Now()
+
+	lockout.recordFailure(userID, now)
+	lockout.reset(userID)
+	assert.False(t, lockout.recordFailure(userID, now))
+	assert.True(t, lockout.recordFailure(userID, now))
+}
+
+func TestLoginLockout_SweepDropsIdleAccounts(t *testing.T) {
+	lockout := newLoginLockout(LoginLockoutPolicy{MaxFailures: 5, Window: 10 * time.Minute})
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	lockout.recordFailure(uuid.New(), now)
+	lockout.recordFailure(uuid.New(), now.Add(11*time.Minute))
+	assert.Len(t, lockout.accounts, 1)
+}
+
+func TestUnknownLoginID(t *testing.T) {
+	assert.Equal(t, unknownLoginID("nobody@example.com"), unknownLoginID("nobody@example.com"))
+	assert.NotEqual(t, unknownLoginID("nobody@example.com"), unknownLoginID("somebody@example.com"))
+}
+
+func TestAuthService_SetLoginLockout_DisabledWithoutAttempts(t *testing.T) {
+	service := NewAuthService(nil, "test-secret", testTokenConfig())
+	service.SetLoginLockout(LoginLockoutPolicy{MaxFailures: 0, Window: time.Minute}, nil, nil)
+	assert.Nil(t, service.lockout)
+}
+
+func TestAuthService_NotifyLockout(t *testing.T) {
+	service := NewAuthService(nil, "test-secret", testTokenConfig())
+	notifier := &recordingSecurityNotifier{}
+	sender := &recordingEmailSender{}
+	service.SetLoginLockout(LoginLockoutPolicy{MaxFailures: 5, Window: 15 * time.Minute, Notify: true}, notifier, sender)
+
+	userID := uuid.New()
+	lockedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	service.notifyLockout(userID, "owner@example.com", "203.0.113.7", lockedAt)
+
+	require.Len(t, notifier.messages, 1)
+	assert.Equal(t, userID.String(), notifier.userIDs[0])
+	assert.Contains(t, notifier.messages[0], "203.0.113.7")
+	assert.Contains(t, notifier.messages[0], "Wed, 01 May 2024 10:00:00 UTC")
+	assert.Contains(t, notifier.messages[0], "15 minutes")
+
+	assert.Equal(t, "owner@example.com", sender.to)
+	assert.Equal(t, notifier.messages[0], sender.body)
+}
@@ -3,63 +3,19 @@ package services
 import (
 	"bytes"
 	"fmt"
+	"mime"
+
+	"github.com/gabriel-vasile/mimetype"
 )
 
-// MimeValidationService handles MIME type validation
-type MimeValidationService struct {
-	// Common file signatures (magic numbers)
-	fileSignatures map[string][]byte
-}
+// MimeValidationService handles MIME type validation. Content detection is done by the
+// mimetype library so it agrees with FileService; the hand-written checks below are only
+// used for formats that need structural validation beyond a magic number.
+type MimeValidationService struct{}
 
 // NewMimeValidationService creates a new MIME validation service
 func NewMimeValidationService() *MimeValidationService {
-	return &MimeValidationService{
-		fileSignatures: map[string][]byte{
-			// Images
-			"image/jpeg": {0xFF, 0xD8, 0xFF},
-			"image/png":  {0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A},
-			"image/gif":  {0x47, 0x49, 0x46, 0x38},
-			"image/webp": {0x52, 0x49, 0x46, 0x46}, // RIFF header, need to check for WEBP
-			"image/bmp":  {0x42, 0x4D},
-			"image/tiff": {0x49, 0x49, 0x2A, 0x00}, // Little-endian TIFF
-
-			// Documents
-			"application/pdf":    {0x25, 0x50, 0x44, 0x46},                         // %PDF
-			"application/msword": {0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, // OLE2/CFB
-			"application/vnd.openxmlformats-officedocument.wordprocessingml.document": {0x50, 0x4B, 0x03, 0x04}, // ZIP-based
-			"application/vnd.ms-excel": {0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, // OLE2/CFB
-			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {0x50, 0x4B, 0x03, 0x04},                         // ZIP-based
-			"application/vnd.ms-powerpoint":                                             {0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, // OLE2/CFB
-			"application/vnd.openxmlformats-officedocument.presentationml.presentation": {0x50, 0x4B, 0x03, 0x04},                         // ZIP-based
-
-			// Archives
-			"application/zip":              {0x50, 0x4B, 0x03, 0x04},
-			"application/x-rar-compressed": {0x52, 0x61, 0x72, 0x20, 0x1A, 0x07, 0x00}, // RAR v1.5+
-			"application/x-7z-compressed":  {0x37, 0x7A, 0xBC, 0xAF, 0x27, 0x1C},
-			"application/gzip":             {0x1F, 0x8B},
-			"application/x-tar":            {0x75, 0x73, 0x74, 0x61, 0x72}, // ustar
-
-			// Audio
-			"audio/mpeg": {0xFF, 0xFB},             // MP3
-			"audio/wav":  {0x52, 0x49, 0x46, 0x46}, // RIFF header
-			"audio/ogg":  {0x4F, 0x67, 0x67, 0x53}, // OggS
-			"audio/flac": {0x66, 0x4C, 0x61, 0x43}, // fLaC
-
-			// Video
-			"video/mp4":       {0x00, 0x00, 0x00, 0x18, 0x66, 0x74, 0x79, 0x70}, // MP4
-			"video/avi":       {0x52, 0x49, 0x46, 0x46},                         // RIFF header
-			"video/webm":      {0x1A, 0x45, 0xDF, 0xA3},                         // WebM
-			"video/quicktime": {0x00, 0x00, 0x00, 0x14, 0x66, 0x74, 0x79, 0x70}, // QuickTime
-
-			// Text files
-			"text/plain":       {},                                               // No specific signature, will be detected by content
-			"text/html":        {0x3C, 0x68, 0x74, 0x6D, 0x6C},                   // <html
-			"text/css":         {0x40, 0x69, 0x6D, 0x70, 0x6F, 0x72, 0x74},       // @import
-			"text/javascript":  {0x66, 0x75, 0x6E, 0x63, 0x74, 0x69, 0x6F, 0x6E}, // function
-			"application/json": {0x7B},                                           // {
-			"application/xml":  {0x3C, 0x3F, 0x78, 0x6D, 0x6C},                   // <?xml
-		},
-	}
+	return &MimeValidationService{}
 }
 
 // ValidateMimeType validates that the file content matches the declared MIME type
@@ -68,16 +24,13 @@ func (s *MimeValidationService) ValidateMimeType(fileContent []byte, declaredMim
 		return fmt.Errorf("file is empty")
 	}
 
-	// Get the expected signature for the declared MIME type
-	expectedSignature, exists := s.fileSignatures[declaredMimeType]
-	if !exists {
-		// If we don't have a signature for this MIME type, we can't validate it
-		// This is acceptable for some file types
-		return nil
+	declared := declaredMimeType
+	if mediaType, _, err := mime.ParseMediaType(declaredMimeType); err == nil {
+		declared = mediaType
 	}
 
 	// Special cases that need additional validation
-	switch declaredMimeType {
+	switch declared {
 	case "image/webp":
 		return s.validateWebP(fileContent)
 	case "audio/wav":
@@ -92,14 +45,59 @@ func (s *MimeValidationService) ValidateMimeType(fileContent []byte, declaredMim
 		return s.validateXML(fileContent)
 	}
 
-	// Check if the file starts with the expected signature
-	if len(expectedSignature) > 0 && len(fileContent) >= len(expectedSignature) {
-		if !bytes.HasPrefix(fileContent, expectedSignature) {
-			return fmt.Errorf("file content does not match declared MIME type %s", declaredMimeType)
-		}
+	expected := mimetype.Lookup(declared)
+	if expected == nil {
+		// The library doesn't know this MIME type, so we can't validate it
+		// This is acceptable for some file types
+		return nil
 	}
 
-	return nil
+	detected := mimetype.Detect(fileContent)
+	if mimeTypesCompatible(detected, expected) {
+		return nil
+	}
+
+	return fmt.Errorf("file content does not match declared MIME type %s (detected %s)", declaredMimeType, detected.String())
+}
+
+// mimeSniffLen is how much of a file content detection and the format checks look at
+const mimeSniffLen = 3072
+
+// RequiresFullContent reports whether ValidateMimeType needs a file's whole content for the
+// declared type. Text formats are checked throughout; every other type is decided by its first
+// mimeSniffLen bytes, so callers can validate large binary files from a prefix.
+func (s *MimeValidationService) RequiresFullContent(declaredMimeType string) bool {
+	declared := declaredMimeType
+	if mediaType, _, err := mime.ParseMediaType(declaredMimeType); err == nil {
+		declared = mediaType
+	}
+
+	switch declared {
+	case "text/plain", "application/json", "application/xml":
+		return true
+	}
+	return false
+}
+
+// mimeTypesCompatible reports whether detected content is consistent with the expected type.
+// That holds when one is an ancestor of the other in the mimetype hierarchy, e.g. a DOCX
+// declared as application/zip, or a ZIP-based file that could only be identified as a ZIP.
+// Content detected only as application/octet-stream is not accepted for a more specific type.
+func mimeTypesCompatible(detected, expected *mimetype.MIME) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(expected.String()) {
+			return true
+		}
+	}
+	if detected.Parent() == nil {
+		return false
+	}
+	for m := expected.Parent(); m != nil; m = m.Parent() {
+		if m.Is(detected.String()) {
+			return true
+		}
+	}
+	return false
 }
 
 // validateWebP validates WebP format (RIFF with WEBP chunk)
@@ -348,42 +346,11 @@ func (s *MimeValidationService) decodeRune(data []byte) (rune, int) {
 	return 0xFFFD, 1
 }
 
-// DetectMimeTypeFromContent attempts to detect MIME type from file content
+// DetectMimeTypeFromContent detects the MIME type of file content
 func (s *MimeValidationService) DetectMimeTypeFromContent(fileContent []byte) string {
 	if len(fileContent) == 0 {
 		return "application/octet-stream"
 	}
 
-	// Check each signature
-	for mimeType, signature := range s.fileSignatures {
-		if len(signature) > 0 && len(fileContent) >= len(signature) {
-			if bytes.HasPrefix(fileContent, signature) {
-				// Additional validation for special cases
-				switch mimeType {
-				case "image/webp":
-					if s.validateWebP(fileContent) == nil {
-						return mimeType
-					}
-				case "audio/wav":
-					if s.validateWAV(fileContent) == nil {
-						return mimeType
-					}
-				case "video/avi":
-					if s.validateAVI(fileContent) == nil {
-						return mimeType
-					}
-				default:
-					return mimeType
-				}
-			}
-		}
-	}
-
-	// Check for text files
-	if s.validateTextFile(fileContent) == nil {
-		return "text/plain"
-	}
-
-	// Default to binary
-	return "application/octet-stream"
+	return mimetype.Detect(fileContent).String()
 }
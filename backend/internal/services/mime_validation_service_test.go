@@ -0,0 +1,64 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return data
+}
+
+func TestMimeValidationService_AcceptsOfficeDocuments(t *testing.T) {
+	service := NewMimeValidationService()
+	docx := readTestdata(t, "sample.docx")
+	xlsx := readTestdata(t, "sample.xlsx")
+
+	assert.NoError(t, service.ValidateMimeType(docx, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"))
+	assert.NoError(t, service.ValidateMimeType(xlsx, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"))
+
+	// Office documents are ZIP containers, so declaring them as ZIP is consistent too
+	assert.NoError(t, service.ValidateMimeType(docx, "application/zip"))
+}
+
+func TestMimeValidationService_RejectsMismatchedOfficeDocuments(t *testing.T) {
+	service := NewMimeValidationService()
+	docx := readTestdata(t, "sample.docx")
+	xlsx := readTestdata(t, "sample.xlsx")
+
+	assert.Error(t, service.ValidateMimeType(docx, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"))
+	assert.Error(t, service.ValidateMimeType(xlsx, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"))
+	assert.Error(t, service.ValidateMimeType(docx, "application/pdf"))
+}
+
+func TestMimeValidationService_DetectionMatchesLibrary(t *testing.T) {
+	service := NewMimeValidationService()
+
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", service.DetectMimeTypeFromContent(readTestdata(t, "sample.docx")))
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", service.DetectMimeTypeFromContent(readTestdata(t, "sample.xlsx")))
+	assert.Equal(t, "application/zip", service.DetectMimeTypeFromContent(readTestdata(t, "sample.zip")))
+}
+
+func TestMimeValidationService_RejectsUnidentifiedBinaryForSpecificType(t *testing.T) {
+	service := NewMimeValidationService()
+
+	assert.Error(t, service.ValidateMimeType([]byte{0x00, 0x01, 0x02, 0x03, 0x04}, "image/png"))
+	assert.NoError(t, service.ValidateMimeType([]byte{0x00, 0x01, 0x02, 0x03, 0x04}, "application/octet-stream"))
+	assert.NoError(t, service.ValidateMimeType([]byte{0x00, 0x01}, "application/x-unknown-type"))
+}
+
+func TestMimeValidationService_StructuralValidations(t *testing.T) {
+	service := NewMimeValidationService()
+
+	assert.NoError(t, service.ValidateMimeType([]byte(`{"a": [1, 2]}`), "application/json"))
+	assert.Error(t, service.ValidateMimeType([]byte(`{"a": [1, 2}`), "application/json"))
+	assert.NoError(t, service.ValidateMimeType([]byte("hello world"), "text/plain; charset=utf-8"))
+	assert.Error(t, service.ValidateMimeType([]byte("RIFF\x00\x00\x00\x00WAVE"), "image/webp"))
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Default and maximum page sizes for listing notifications
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+// NotificationRepositoryInterface defines the notification storage used by NotificationService
+type NotificationRepositoryInterface interface {
+	Create(notification *models.Notification) error
+	ListByUserID(userID uuid.UUID, unreadOnly bool, limit, offset int) ([]*models.Notification, error)
+	CountUnread(userID uuid.UUID) (int, error)
+	MarkRead(id, userID uuid.UUID) (bool, error)
+	MarkAllRead(userID uuid.UUID) (int64, error)
+}
+
+// NotificationService stores in-app notifications so they survive the user being offline
+type NotificationService struct {
+	notificationRepo NotificationRepositoryInterface
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(notificationRepo NotificationRepositoryInterface) *NotificationService {
+	return &NotificationService{
+		notificationRepo: notificationRepo,
+	}
+}
+
+// Create stores a new unread notification for a user
+func (s *NotificationService) Create(userID uuid.UUID, notificationType, title, message string) (*models.Notification, error) {
+	if title == "" {
+		return nil, fmt.Errorf("notification title is required")
+	}
+
+	notification := &models.Notification{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Type:    notificationType,
+		Title:   title,
+		Message: message,
+	}
+
+	if err := s.notificationRepo.Create(notification); err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// ListForUser returns a page of the user's notifications, newest first, with their unread count
+func (s *NotificationService) ListForUser(userID uuid.UUID, unreadOnly bool, limit, offset int) (*models.NotificationList, error) {
+	if limit <= 0 {
+		limit = defaultNotificationLimit
+	}
+	if limit > maxNotificationLimit {
+		limit = maxNotificationLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	notifications, err := s.notificationRepo.ListByUserID(userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if notifications == nil {
+		notifications = []*models.Notification{}
+	}
+
+	unreadCount, err := s.notificationRepo.CountUnread(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.NotificationList{
+		Notifications: notifications,
+		UnreadCount:   unreadCount,
+	}, nil
+}
+
+// UnreadCount returns how many unread notifications the user has
+func (s *NotificationService) UnreadCount(userID uuid.UUID) (int, error) {
+	return s.notificationRepo.CountUnread(userID)
+}
+
+// MarkRead marks one of the user's notifications as read
+func (s *NotificationService) MarkRead(id, userID uuid.UUID) error {
+	found, err := s.notificationRepo.MarkRead(id, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("notification not found")
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the user's notifications as read and returns how many changed
+func (s *NotificationService) MarkAllRead(userID uuid.UUID) (int64, error) {
+	return s.notificationRepo.MarkAllRead(userID)
+}
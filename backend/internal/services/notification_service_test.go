@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockNotificationRepository is a mock implementation of NotificationRepositoryInterface
+type MockNotificationRepository struct {
+	mock.Mock
+}
+
+func (m *MockNotificationRepository) Create(notification *models.Notification) error {
+	args := m.Called(notification)
+	return args.Error(0)
+}
+
+func (m *MockNotificationRepository) ListByUserID(userID uuid.UUID, unreadOnly bool, limit, offset int) ([]*models.Notification, error) {
+	args := m.Called(userID, unreadOnly, limit, offset)
+	return args.Get(0).([]*models.Notification), args.Error(1)
+}
+
+func (m *MockNotificationRepository) CountUnread(userID uuid.UUID) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockNotificationRepository) MarkRead(id, userID uuid.UUID) (bool, error) {
+	args := m.Called(id, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockNotificationRepository) MarkAllRead(userID uuid.UUID) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestNotificationService_Create(t *testing.T) {
+	mockRepo := new(MockNotificationRepository)
+	service := NewNotificationService(mockRepo)
+	userID := uuid.New()
+
+	mockRepo.On("Create", mock.MatchedBy(func(n *models.Notification) bool {
+		return n.UserID == userID && n.Type == "file_shared_with_user" && n.Title == "File shared with you" && !n.IsRead
+	})).Return(nil)
+
+	notification, err := service.Create(userID, "file_shared_with_user", "File shared with you", "alice shared \"report.pdf\" with you")
+
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, notification.ID)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestNotificationService_ListForUser_ClampsLimitAndIncludesUnreadCount(t *testing.T) {
+	mockRepo := new(MockNotificationRepository)
+	service := NewNotificationService(mockRepo)
+	userID := uuid.New()
+
+	mockRepo.On("ListByUserID", userID, true, maxNotificationLimit, 0).Return([]*models.Notification{{ID: uuid.New()}}, nil)
+	mockRepo.On("CountUnread", userID).Return(3, nil)
+
+	list, err := service.ListForUser(userID, true, 1000, -5)
+
+	assert.NoError(t, err)
+	assert.Len(t, list.Notifications, 1)
+	assert.Equal(t, 3, list.UnreadCount)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestNotificationService_MarkRead_NotFound(t *testing.T) {
+	mockRepo := new(MockNotificationRepository)
+	service := NewNotificationService(mockRepo)
+	id := uuid.New()
+	userID := uuid.New()
+
+	mockRepo.On("MarkRead", id, userID).Return(false, nil)
+
+	err := service.MarkRead(id, userID)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+
+	// Decoders for the formats HashImage accepts
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// phashSampleSize is the side of the grayscale thumbnail the DCT runs on
+	phashSampleSize = 32
+	// phashLowFrequencies is the side of the block of low DCT frequencies that make up the hash
+	phashLowFrequencies = 8
+	// maxPerceptualHashSize skips hashing images larger than this, to bound decode memory
+	maxPerceptualHashSize = 25 * 1024 * 1024
+	// DefaultSimilarImageThreshold is the Hamming distance under which two images count as similar
+	DefaultSimilarImageThreshold = 10
+)
+
+// ErrPerceptualHashUnsupported is returned for content that can't be perceptually hashed
+var ErrPerceptualHashUnsupported = errors.New("perceptual hashing is not supported for this file")
+
+// perceptualHashTypes are the image formats with a registered decoder
+var perceptualHashTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// PerceptualHashService computes DCT-based perceptual hashes (pHash) of images. Unlike the SHA-256
+// used for deduplication, re-encoded, resized or lightly edited copies of a picture end up with
+// hashes a small Hamming distance apart.
+type PerceptualHashService struct {
+	cosines [phashLowFrequencies][phashSampleSize]float64
+}
+
+// NewPerceptualHashService creates a perceptual hash service
+func NewPerceptualHashService() *PerceptualHashService {
+	s := &PerceptualHashService{}
+	for u := 0; u < phashLowFrequencies; u++ {
+		for x := 0; x < phashSampleSize; x++ {
+			s.cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSampleSize))
+		}
+	}
+	return s
+}
+
+// Supports reports whether files of this MIME type and size can be hashed
+func (s *PerceptualHashService) Supports(mimeType string, size int64) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	return perceptualHashTypes[mediaType] && size <= maxPerceptualHashSize
+}
+
+// HashImage decodes an image and returns its 64-bit perceptual hash
+func (s *PerceptualHashService) HashImage(r io.Reader) (uint64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return 0, ErrPerceptualHashUnsupported
+		}
+		return 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	sample := grayscaleThumbnail(img, phashSampleSize)
+
+	// Only the lowest frequencies of the 2D DCT are needed
+	var coefficients [phashLowFrequencies * phashLowFrequencies]float64
+	for u := 0; u < phashLowFrequencies; u++ {
+		for v := 0; v < phashLowFrequencies; v++ {
+			var sum float64
+			for x := 0; x < phashSampleSize; x++ {
+				for y := 0; y < phashSampleSize; y++ {
+					sum += sample[x][y] * s.cosines[u][x] * s.cosines[v][y]
+				}
+			}
+			coefficients[u*phashLowFrequencies+v] = sum
+		}
+	}
+
+	// The DC term only reflects overall brightness, so it's left out of the median
+	sorted := make([]float64, len(coefficients)-1)
+	copy(sorted, coefficients[1:])
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, nil
+}
+
+// HammingDistance counts the bits that differ between two perceptual hashes; 0 means the
+// images look the same
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscaleThumbnail scales an image down to size x size luminance values by averaging the
+// source pixels that fall into each cell
+func grayscaleThumbnail(img image.Image, size int) [][]float64 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	sums := make([][]float64, size)
+	counts := make([][]float64, size)
+	for i := range sums {
+		sums[i] = make([]float64, size)
+		counts[i] = make([]float64, size)
+	}
+
+	for y := 0; y < height; y++ {
+		cy := y * size / height
+		for x := 0; x < width; x++ {
+			cx := x * size / width
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			sums[cx][cy] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cx][cy]++
+		}
+	}
+
+	for x := range sums {
+		for y := range sums[x] {
+			if counts[x][y] > 0 {
+				sums[x][y] /= counts[x][y]
+			}
+		}
+	}
+	return sums
+}
+
+// PerceptualHashStore saves computed perceptual hashes
+type PerceptualHashStore interface {
+	UpdatePerceptualHash(id uuid.UUID, hash int64) error
+}
+
+// PerceptualHashTask hashes image uploads in the background for similar image search
+type PerceptualHashTask struct {
+	hasher    *PerceptualHashService
+	s3Service S3ServiceInterface
+	store     PerceptualHashStore
+}
+
+// NewPerceptualHashTask creates the processing task that fills in files' perceptual hashes
+func NewPerceptualHashTask(hasher *PerceptualHashService, s3Service S3ServiceInterface, store PerceptualHashStore) *PerceptualHashTask {
+	return &PerceptualHashTask{
+		hasher:    hasher,
+		s3Service: s3Service,
+		store:     store,
+	}
+}
+
+// Name identifies the task in logs
+func (t *PerceptualHashTask) Name() string {
+	return "perceptual_hash"
+}
+
+// Applies reports whether the file is an image format the hasher decodes
+func (t *PerceptualHashTask) Applies(file *models.File) bool {
+	return t.hasher.Supports(file.MimeType, file.Size)
+}
+
+// Run downloads the image and stores its hash. Images that can't be decoded are left without a
+// hash rather than failing the job, since retrying won't help.
+func (t *PerceptualHashTask) Run(ctx context.Context, file *models.File) error {
+	body, err := t.s3Service.DownloadFile(ctx, file.S3Key)
+	if err != nil {
+		return fmt.Errorf("failed to download image: %w", err)
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(body, maxPerceptualHashSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+
+	hash, err := t.hasher.HashImage(bytes.NewReader(content))
+	if err != nil {
+		log.Printf("WARNING: Failed to compute perceptual hash for file %s: %v", file.ID, err)
+		return nil
+	}
+
+	stored := int64(hash)
+	if err := t.store.UpdatePerceptualHash(file.ID, stored); err != nil {
+		return err
+	}
+	file.PerceptualHash = &stored
+	return nil
+}
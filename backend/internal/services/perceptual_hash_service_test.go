@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// photoLikeImage draws smooth shapes so the image has the low-frequency structure of a photo
+func photoLikeImage(size int, shift float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			fx, fy := float64(x)/float64(size), float64(y)/float64(size)
+			v := 128 + 60*math.Sin(2*math.Pi*(fx+shift)) + 50*math.Cos(3*math.Pi*fy)
+			if (fx-0.3)*(fx-0.3)+(fy-0.6)*(fy-0.6) < 0.04 {
+				v = 240
+			}
+			img.Set(x, y, color.RGBA{uint8(v), uint8(v * 0.8), uint8(255 - v), 255})
+		}
+	}
+	return img
+}
+
+// resizeNearest scales an image to size x size without any library support
+func resizeNearest(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/size, bounds.Min.Y+y*bounds.Dy()/size))
+		}
+	}
+	return dst
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}))
+	return buf.Bytes()
+}
+
+func TestPerceptualHash_ResizedVariantMatches(t *testing.T) {
+	service := NewPerceptualHashService()
+	original := photoLikeImage(256, 0)
+
+	originalHash, err := service.HashImage(bytes.NewReader(encodePNG(t, original)))
+	require.NoError(t, err)
+
+	// A smaller, re-encoded copy of the same picture
+	resizedHash, err := service.HashImage(bytes.NewReader(encodeJPEG(t, resizeNearest(original, 100))))
+	require.NoError(t, err)
+
+	// A different picture
+	otherHash, err := service.HashImage(bytes.NewReader(encodePNG(t, photoLikeImage(256, 0.5))))
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, HammingDistance(originalHash, resizedHash), DefaultSimilarImageThreshold)
+	assert.Greater(t, HammingDistance(originalHash, otherHash), DefaultSimilarImageThreshold)
+}
+
+func TestPerceptualHash_RejectsNonImages(t *testing.T) {
+	service := NewPerceptualHashService()
+
+	_, err := service.HashImage(bytes.NewReader([]byte("just some text")))
+	assert.ErrorIs(t, err, ErrPerceptualHashUnsupported)
+
+	assert.True(t, service.Supports("image/jpeg", 1024))
+	assert.True(t, service.Supports("IMAGE/PNG; charset=binary", 1024))
+	assert.False(t, service.Supports("image/svg+xml", 1024))
+	assert.False(t, service.Supports("image/png", maxPerceptualHashSize+1))
+}
+
+// recordingHashStore keeps the perceptual hashes saved by the task
+type recordingHashStore struct {
+	hashes map[uuid.UUID]int64
+}
+
+func (s *recordingHashStore) UpdatePerceptualHash(id uuid.UUID, hash int64) error {
+	s.hashes[id] = hash
+	return nil
+}
+
+func TestPerceptualHashTask_StoresHashOfImages(t *testing.T) {
+	content := encodePNG(t, photoLikeImage(64, 0))
+	s3Stub := &contentS3Stub{objects: map[string]string{"files/photo.png": string(content)}}
+	store := &recordingHashStore{hashes: map[uuid.UUID]int64{}}
+	task := NewPerceptualHashTask(NewPerceptualHashService(), s3Stub, store)
+
+	file := &models.File{ID: uuid.New(), MimeType: "image/png", Size: int64(len(content)), S3Key: "files/photo.png"}
+	require.True(t, task.Applies(file))
+	require.NoError(t, task.Run(context.Background(), file))
+
+	expected, err := NewPerceptualHashService().HashImage(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, int64(expected), store.hashes[file.ID])
+	assert.Equal(t, int64(expected), *file.PerceptualHash)
+}
+
+func TestPerceptualHashTask_SkipsUndecodableImages(t *testing.T) {
+	s3Stub := &contentS3Stub{objects: map[string]string{"files/broken.png": "not really a png"}}
+	store := &recordingHashStore{hashes: map[uuid.UUID]int64{}}
+	task := NewPerceptualHashTask(NewPerceptualHashService(), s3Stub, store)
+
+	file := &models.File{ID: uuid.New(), MimeType: "image/png", Size: 16, S3Key: "files/broken.png"}
+	assert.NoError(t, task.Run(context.Background(), file))
+	assert.Empty(t, store.hashes)
+	assert.False(t, task.Applies(&models.File{MimeType: "application/pdf", Size: 16}))
+}
+
+func TestFileService_FindSimilarImages(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	userID := uuid.New()
+	hashOf := func(v uint64) *int64 { h := int64(v); return &h }
+	source := &models.File{ID: uuid.New(), UploaderID: userID, PerceptualHash: hashOf(0xFF00FF00FF00FF00)}
+	near := &models.File{ID: uuid.New(), UploaderID: userID, PerceptualHash: hashOf(0xFF00FF00FF00FF03)}
+	closer := &models.File{ID: uuid.New(), UploaderID: userID, PerceptualHash: hashOf(0xFF00FF00FF00FF01)}
+	far := &models.File{ID: uuid.New(), UploaderID: userID, PerceptualHash: hashOf(0x00FF00FF00FF00FF)}
+
+	mockFileRepo.On("GetByID", source.ID).Return(source, nil)
+	mockFileRepo.On("GetWithPerceptualHash", &userID).Return([]*models.File{source, near, far, closer}, nil)
+
+	similar, err := service.FindSimilarImages(userID, source.ID, nil, false)
+	require.NoError(t, err)
+	require.Len(t, similar, 2)
+	assert.Equal(t, closer.ID, similar[0].File.ID)
+	assert.Equal(t, 1, similar[0].Distance)
+	assert.Equal(t, near.ID, similar[1].File.ID)
+	assert.Equal(t, 2, similar[1].Distance)
+
+	// Someone else's image isn't searchable by a regular user
+	_, err = service.FindSimilarImages(uuid.New(), source.ID, nil, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// DefaultPreviewableMimeTypes are the types shown inline when PREVIEWABLE_MIME_TYPES isn't set:
+// what the frontend previewer renders, all of which browsers display without running script
+var DefaultPreviewableMimeTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/bmp",
+	"image/avif",
+	"video/*",
+	"audio/*",
+	"application/pdf",
+	"text/plain",
+}
+
+// PreviewPolicy decides which MIME types may be shown inline from our origin. Everything else
+// is sent as an attachment, so uploaded executables or documents can't be rendered on our origin.
+type PreviewPolicy struct {
+	// patterns are lowercased "type/subtype" or "type/*" entries
+	patterns []string
+}
+
+// DefaultPreviewPolicy allows DefaultPreviewableMimeTypes
+var DefaultPreviewPolicy = PreviewPolicy{patterns: DefaultPreviewableMimeTypes}
+
+// ParsePreviewPolicy parses a comma-separated list of MIME types such as "image/png,video/*".
+// An empty value gives the default policy.
+func ParsePreviewPolicy(value string) (PreviewPolicy, error) {
+	var patterns []string
+	for _, raw := range strings.Split(value, ",") {
+		pattern := strings.ToLower(strings.TrimSpace(raw))
+		if pattern == "" {
+			continue
+		}
+		mainType, subType, found := strings.Cut(pattern, "/")
+		if !found || mainType == "" || mainType == "*" || subType == "" || strings.Contains(subType, "/") {
+			return PreviewPolicy{}, fmt.Errorf("invalid previewable MIME type %q: expected type/subtype or type/*", raw)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) == 0 {
+		return DefaultPreviewPolicy, nil
+	}
+	return PreviewPolicy{patterns: patterns}, nil
+}
+
+// Allows reports whether a file of this MIME type may be previewed inline. Types that can run
+// script when rendered are never allowed, whatever the configuration says.
+func (p PreviewPolicy) Allows(mimeType string) bool {
+	if !InlinePreviewAllowed(mimeType) {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	for _, pattern := range p.patterns {
+		if pattern == mediaType || pattern == mainType+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviewUnsupportedMessage explains to the user why a file won't be shown inline
+func PreviewUnsupportedMessage(mimeType string) string {
+	if strings.TrimSpace(mimeType) == "" {
+		return "Preview isn't available for files of an unknown type. Download the file to open it."
+	}
+	return fmt.Sprintf("Preview isn't available for %s files. Download the file to open it.", mimeType)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewPolicy_DefaultAllowsMediaAndPDF(t *testing.T) {
+	policy := DefaultPreviewPolicy
+
+	assert.True(t, policy.Allows("image/png"))
+	assert.True(t, policy.Allows("video/mp4"))
+	assert.True(t, policy.Allows("audio/mpeg"))
+	assert.True(t, policy.Allows("application/pdf"))
+	assert.True(t, policy.Allows("text/plain; charset=utf-8"))
+
+	assert.False(t, policy.Allows("application/x-msdownload"))
+	assert.False(t, policy.Allows("application/octet-stream"))
+	assert.False(t, policy.Allows("application/zip"))
+	assert.False(t, policy.Allows(""))
+}
+
+func TestParsePreviewPolicy(t *testing.T) {
+	policy, err := ParsePreviewPolicy(" image/* , Application/PDF ")
+	require.NoError(t, err)
+	assert.True(t, policy.Allows("image/jpeg"))
+	assert.True(t, policy.Allows("application/pdf"))
+	assert.False(t, policy.Allows("video/mp4"))
+
+	policy, err = ParsePreviewPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPreviewPolicy, policy)
+
+	for _, invalid := range []string{"image", "*/*", "image/", "a/b/c"} {
+		_, err := ParsePreviewPolicy(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPreviewPolicy_NeverAllowsActiveContent(t *testing.T) {
+	policy, err := ParsePreviewPolicy("image/*,text/html,application/javascript")
+	require.NoError(t, err)
+
+	assert.True(t, policy.Allows("image/png"))
+	assert.False(t, policy.Allows("image/svg+xml"))
+	assert.False(t, policy.Allows("text/html"))
+	assert.False(t, policy.Allows("application/javascript"))
+}
+
+func TestPreviewUnsupportedMessage(t *testing.T) {
+	assert.Equal(t, "Preview isn't available for application/zip files. Download the file to open it.", PreviewUnsupportedMessage("application/zip"))
+	assert.Contains(t, PreviewUnsupportedMessage(""), "unknown type")
+}
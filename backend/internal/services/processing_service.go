@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultProcessingWorkers is how many files are processed at once when not configured
+	defaultProcessingWorkers = 2
+	// defaultProcessingQueueSize is how many files can wait for a worker when not configured
+	defaultProcessingQueueSize = 100
+	// processingMaxAttempts is how often a failing task is tried before the file is marked failed
+	processingMaxAttempts = 3
+	// processingRetryDelay is the wait before the first retry; it doubles with every attempt
+	processingRetryDelay = 2 * time.Second
+	// processingResumeLimit caps how many unfinished files are picked up again on start
+	processingResumeLimit = 1000
+)
+
+// ProcessingTask is one step of background processing for new uploads, such as hashing or
+// thumbnail generation. Run may be retried, so it must be safe to repeat; it should return nil
+// for files it turns out not to handle, and an error only for failures worth retrying.
+type ProcessingTask interface {
+	Name() string
+	Applies(file *models.File) bool
+	Run(ctx context.Context, file *models.File) error
+}
+
+// ProcessingFileStore persists the processing state of files
+type ProcessingFileStore interface {
+	UpdateJobStatus(id uuid.UUID, status string) error
+	GetUnfinishedProcessing(limit int) ([]*models.File, error)
+}
+
+// ProcessingService runs processing tasks on new uploads in a pool of background workers, so
+// the upload response doesn't wait for them. A file's job_status goes from pending through
+// processing to completed or failed, and the uploader is notified over WebSocket when it's done.
+// Files left pending or processing by a restart are picked up again on Start.
+type ProcessingService struct {
+	store            ProcessingFileStore
+	websocketService *WebSocketService
+	tasks            []ProcessingTask
+	workers          int
+	retryDelay       time.Duration
+	jobs             chan *models.File
+	ctx              context.Context
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+	stopped          atomic.Bool
+	stopOnce         sync.Once
+}
+
+// NewProcessingService creates a processing service; non-positive sizes use the defaults
+func NewProcessingService(store ProcessingFileStore, websocketService *WebSocketService, workers, queueSize int) *ProcessingService {
+	if workers <= 0 {
+		workers = defaultProcessingWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultProcessingQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ProcessingService{
+		store:            store,
+		websocketService: websocketService,
+		workers:          workers,
+		retryDelay:       processingRetryDelay,
+		jobs:             make(chan *models.File, queueSize),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+}
+
+// AddTask registers a task to run on every new upload it applies to; call before Start
+func (s *ProcessingService) AddTask(task ProcessingTask) {
+	s.tasks = append(s.tasks, task)
+}
+
+// Applies reports whether any registered task would process the file
+func (s *ProcessingService) Applies(file *models.File) bool {
+	for _, task := range s.tasks {
+		if task.Applies(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start launches the workers and requeues files whose processing never finished
+func (s *ProcessingService) Start() {
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	log.Printf("Processing workers started: workers=%d, tasks=%d", s.workers, len(s.tasks))
+
+	unfinished, err := s.store.GetUnfinishedProcessing(processingResumeLimit)
+	if err != nil {
+		log.Printf("Processing: failed to get unfinished files: %v", err)
+		return
+	}
+	for _, file := range unfinished {
+		s.Enqueue(file)
+	}
+	if len(unfinished) > 0 {
+		log.Printf("Processing: resumed %d unfinished file(s)", len(unfinished))
+	}
+}
+
+// Enqueue queues a file for processing without blocking. If the queue is full the file is
+// marked failed rather than holding up the upload. Workers get their own copy of the file, so
+// the caller may keep using it.
+func (s *ProcessingService) Enqueue(file *models.File) {
+	if s.stopped.Load() {
+		return // Still pending in the database, so the next start picks it up
+	}
+
+	queued := *file
+	select {
+	case s.jobs <- &queued:
+	default:
+		log.Printf("Processing: queue full, not processing file %s", file.ID)
+		s.finish(&queued, models.JobStatusFailed)
+	}
+}
+
+// Stop stops taking new work and waits for running tasks until ctx is done. Queued files stay
+// pending and are processed after the next start.
+func (s *ProcessingService) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		s.stopped.Store(true)
+		s.cancel()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// worker processes queued files until the service is stopped
+func (s *ProcessingService) worker() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case file := <-s.jobs:
+			s.process(file)
+		}
+	}
+}
+
+// process runs every applicable task on a file and records the outcome
+func (s *ProcessingService) process(file *models.File) {
+	if err := s.store.UpdateJobStatus(file.ID, models.JobStatusProcessing); err != nil {
+		log.Printf("Processing: %v", err)
+	}
+
+	status := models.JobStatusCompleted
+	for _, task := range s.tasks {
+		if !task.Applies(file) {
+			continue
+		}
+		if err := s.runWithRetry(task, file); err != nil {
+			if s.ctx.Err() != nil {
+				return // Interrupted by shutdown; resumed on the next start
+			}
+			log.Printf("Processing: task %s failed for file %s: %v", task.Name(), file.ID, err)
+			status = models.JobStatusFailed
+		}
+	}
+
+	s.finish(file, status)
+}
+
+// runWithRetry runs a task, retrying failures with exponential backoff
+func (s *ProcessingService) runWithRetry(task ProcessingTask, file *models.File) error {
+	delay := s.retryDelay
+	var err error
+	for attempt := 1; attempt <= processingMaxAttempts; attempt++ {
+		if err = task.Run(s.ctx, file); err == nil {
+			return nil
+		}
+		if attempt == processingMaxAttempts {
+			break
+		}
+
+		log.Printf("Processing: task %s attempt %d for file %s failed, retrying in %s: %v", task.Name(), attempt, file.ID, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// finish stores a file's final processing status and tells the uploader
+func (s *ProcessingService) finish(file *models.File, status string) {
+	if err := s.store.UpdateJobStatus(file.ID, status); err != nil {
+		log.Printf("Processing: %v", err)
+	}
+	file.JobStatus = &status
+
+	if s.websocketService != nil {
+		s.websocketService.BroadcastFileProcessed(file.UploaderID.String(), file.ID.String(), file.OriginalName, status)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryProcessingStore records every job status a file goes through
+type memoryProcessingStore struct {
+	mu         sync.Mutex
+	statuses   map[uuid.UUID][]string
+	unfinished []*models.File
+}
+
+func newMemoryProcessingStore() *memoryProcessingStore {
+	return &memoryProcessingStore{statuses: map[uuid.UUID][]string{}}
+}
+
+func (s *memoryProcessingStore) UpdateJobStatus(id uuid.UUID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[id] = append(s.statuses[id], status)
+	return nil
+}
+
+func (s *memoryProcessingStore) GetUnfinishedProcessing(limit int) ([]*models.File, error) {
+	return s.unfinished, nil
+}
+
+func (s *memoryProcessingStore) history(id uuid.UUID) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.statuses[id]...)
+}
+
+// flakyTask fails a set number of times before succeeding
+type flakyTask struct {
+	mu       sync.Mutex
+	failures int
+	runs     int
+}
+
+func (t *flakyTask) Name() string { return "flaky" }
+
+func (t *flakyTask) Applies(file *models.File) bool { return file.MimeType == "image/png" }
+
+func (t *flakyTask) Run(ctx context.Context, file *models.File) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runs++
+	if t.runs <= t.failures {
+		return errors.New("transient failure")
+	}
+	return nil
+}
+
+func (t *flakyTask) runCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.runs
+}
+
+func newTestProcessingService(store ProcessingFileStore, task ProcessingTask) *ProcessingService {
+	service := NewProcessingService(store, nil, 1, 10)
+	service.retryDelay = time.Millisecond
+	service.AddTask(task)
+	return service
+}
+
+func waitForStatus(t *testing.T, store *memoryProcessingStore, id uuid.UUID, status string) []string {
+	require.Eventually(t, func() bool {
+		history := store.history(id)
+		return len(history) > 0 && history[len(history)-1] == status
+	}, time.Second, 5*time.Millisecond)
+	return store.history(id)
+}
+
+func TestProcessingService_RetriesUntilTaskSucceeds(t *testing.T) {
+	store := newMemoryProcessingStore()
+	task := &flakyTask{failures: processingMaxAttempts - 1}
+	service := newTestProcessingService(store, task)
+	service.Start()
+	defer service.Stop(context.Background())
+
+	file := &models.File{ID: uuid.New(), MimeType: "image/png"}
+	service.Enqueue(file)
+
+	history := waitForStatus(t, store, file.ID, models.JobStatusCompleted)
+	assert.Equal(t, []string{models.JobStatusProcessing, models.JobStatusCompleted}, history)
+	assert.Equal(t, processingMaxAttempts, task.runCount())
+}
+
+func TestProcessingService_MarksFailedAfterLastAttempt(t *testing.T) {
+	store := newMemoryProcessingStore()
+	task := &flakyTask{failures: processingMaxAttempts}
+	service := newTestProcessingService(store, task)
+	service.Start()
+	defer service.Stop(context.Background())
+
+	file := &models.File{ID: uuid.New(), MimeType: "image/png"}
+	service.Enqueue(file)
+
+	waitForStatus(t, store, file.ID, models.JobStatusFailed)
+	assert.Equal(t, processingMaxAttempts, task.runCount())
+}
+
+func TestProcessingService_ResumesUnfinishedFilesOnStart(t *testing.T) {
+	store := newMemoryProcessingStore()
+	interrupted := &models.File{ID: uuid.New(), MimeType: "image/png"}
+	store.unfinished = []*models.File{interrupted}
+	service := newTestProcessingService(store, &flakyTask{})
+
+	service.Start()
+	defer service.Stop(context.Background())
+
+	waitForStatus(t, store, interrupted.ID, models.JobStatusCompleted)
+}
+
+func TestFileService_UploadFile_QueuesProcessing(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+
+	// Workers aren't started, so the queued file stays in the channel for inspection
+	processing := NewProcessingService(newMemoryProcessingStore(), nil, 1, 10)
+	processing.AddTask(&flakyTask{})
+	service.SetProcessingService(processing)
+
+	file, header, hash := newUploadFixture("notes.txt", []byte("plain text needs no processing"))
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", mock.Anything).Return([]*models.File{}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+
+	result, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.File.JobStatus)
+	assert.Empty(t, processing.jobs)
+
+	image := encodePNG(t, photoLikeImage(16, 0))
+	file, header, hash = newUploadFixture("photo.png", image)
+	header.Header.Set("Content-Type", "image/png")
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/photo"}, nil)
+
+	result, err = service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.NoError(t, err)
+	require.NotNil(t, result.File.JobStatus)
+	assert.Equal(t, models.JobStatusPending, *result.File.JobStatus)
+	require.Len(t, processing.jobs, 1)
+	assert.Equal(t, result.File.ID, (<-processing.jobs).ID)
+}
@@ -1,16 +1,78 @@
 package services
 
 import (
+	"errors"
+	"filevault/internal/models"
 	"filevault/internal/repositories"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrQuotaExceeded is returned when an upload would take a user past their storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Reasons a file is suggested for cleanup
+const (
+	CleanupReasonDuplicate  = "duplicate"
+	CleanupReasonLargest    = "largest"
+	CleanupReasonUnaccessed = "unaccessed"
+)
+
+const (
+	// cleanupSuggestionsPerReason caps how many files are suggested for each reason
+	cleanupSuggestionsPerReason = 5
+	// cleanupUnaccessedAfter is how long a file must go without being opened to count as unaccessed
+	cleanupUnaccessedAfter = 90 * 24 * time.Hour
+)
+
+// CleanupSuggestion is a file the user could delete to get back under quota
+type CleanupSuggestion struct {
+	Reason string       `json:"reason"`
+	File   *models.File `json:"file"`
+	// BytesFreed is the storage actually released by deleting the file: zero while
+	// other files still reference the same deduplicated content
+	BytesFreed     int64      `json:"bytesFreed"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt"`
+}
+
+// UnlimitedQuotaMB is the quota of users without a storage limit; any negative quota means unlimited
+const UnlimitedQuotaMB int64 = -1
+
+// Where a user's effective quota comes from
+const (
+	QuotaSourceUser   = "user"
+	QuotaSourceRole   = "role"
+	QuotaSourceGlobal = "global"
+)
+
+// EffectiveQuota is the storage limit that applies to a user and the setting it came from
+type EffectiveQuota struct {
+	QuotaMB int64
+	Source  string
+}
+
+// Unlimited reports whether the user has no storage limit
+func (q EffectiveQuota) Unlimited() bool {
+	return q.QuotaMB < 0
+}
+
+// QuotaUserStore looks up the role and the quota override that decide a user's quota
+type QuotaUserStore interface {
+	GetByID(id uuid.UUID) (*models.User, error)
+	GetStorageQuotaOverride(userID uuid.UUID) (*int64, error)
+}
+
 // QuotaService handles storage quota management
 type QuotaService struct {
-	fileRepo *repositories.FileRepository
-	quotaMB  int64
+	fileRepo   *repositories.FileRepository
+	quotaMB    int64
+	users      QuotaUserStore
+	roleQuotas map[string]int64
 }
 
 // NewQuotaService creates a new quota service
@@ -21,6 +83,71 @@ func NewQuotaService(fileRepo *repositories.FileRepository, quotaMB int64) *Quot
 	}
 }
 
+// SetRoleQuotas resolves quotas per user: a user's own override wins, then the default for their
+// role, then the global quota. Roles missing from roleQuotas use the global quota.
+func (s *QuotaService) SetRoleQuotas(users QuotaUserStore, roleQuotas map[string]int64) {
+	s.users = users
+	s.roleQuotas = roleQuotas
+}
+
+// ParseRoleQuotas parses role quotas configured as "admin=unlimited,user=1024" (MB)
+func ParseRoleQuotas(value string) (map[string]int64, error) {
+	quotas := make(map[string]int64)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid role quota %q: expected role=MB", entry)
+		}
+		role := strings.ToLower(strings.TrimSpace(parts[0]))
+		if role != models.RoleUser && role != models.RoleAdmin {
+			return nil, fmt.Errorf("invalid role quota %q: unknown role %q", entry, role)
+		}
+
+		limit := strings.ToLower(strings.TrimSpace(parts[1]))
+		if limit == "unlimited" {
+			quotas[role] = UnlimitedQuotaMB
+			continue
+		}
+		quotaMB, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || quotaMB < 0 {
+			return nil, fmt.Errorf("invalid role quota %q: limit must be a number of MB or \"unlimited\"", entry)
+		}
+		quotas[role] = quotaMB
+	}
+	return quotas, nil
+}
+
+// GetEffectiveQuota resolves the quota that applies to a user. The role is read on every call, so
+// changing a user's role changes their quota without touching any per-user setting.
+func (s *QuotaService) GetEffectiveQuota(userID uuid.UUID) (EffectiveQuota, error) {
+	if s.users == nil {
+		return EffectiveQuota{QuotaMB: s.quotaMB, Source: QuotaSourceGlobal}, nil
+	}
+
+	override, err := s.users.GetStorageQuotaOverride(userID)
+	if err != nil {
+		return EffectiveQuota{}, fmt.Errorf("failed to get quota override: %w", err)
+	}
+	if override != nil {
+		return EffectiveQuota{QuotaMB: *override, Source: QuotaSourceUser}, nil
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return EffectiveQuota{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if roleQuota, ok := s.roleQuotas[user.Role]; ok {
+		return EffectiveQuota{QuotaMB: roleQuota, Source: QuotaSourceRole}, nil
+	}
+
+	return EffectiveQuota{QuotaMB: s.quotaMB, Source: QuotaSourceGlobal}, nil
+}
+
 // GetUserStorageUsage returns the current storage usage for a user in bytes
 func (s *QuotaService) GetUserStorageUsage(userID uuid.UUID) (int64, error) {
 	files, err := s.fileRepo.GetByUserID(userID, 1000, 0) // Get all files for user
@@ -44,16 +171,24 @@ func (s *QuotaService) GetUserStorageUsage(userID uuid.UUID) (int64, error) {
 
 // CheckQuota checks if a user can upload a file of the given size
 func (s *QuotaService) CheckQuota(userID uuid.UUID, fileSize int64) error {
+	quota, err := s.GetEffectiveQuota(userID)
+	if err != nil {
+		return err
+	}
+	if quota.Unlimited() {
+		return nil
+	}
+
 	currentUsage, err := s.GetUserStorageUsage(userID)
 	if err != nil {
 		return fmt.Errorf("failed to get current usage: %w", err)
 	}
 
-	quotaBytes := s.quotaMB * 1024 * 1024 // Convert MB to bytes
+	quotaBytes := quota.QuotaMB * 1024 * 1024 // Convert MB to bytes
 
 	if currentUsage+fileSize > quotaBytes {
-		return fmt.Errorf("storage quota exceeded: %d bytes used, %d bytes quota, %d bytes requested",
-			currentUsage, quotaBytes, fileSize)
+		return fmt.Errorf("%w: %d bytes used, %d bytes quota, %d bytes requested",
+			ErrQuotaExceeded, currentUsage, quotaBytes, fileSize)
 	}
 
 	return nil
@@ -61,20 +196,128 @@ func (s *QuotaService) CheckQuota(userID uuid.UUID, fileSize int64) error {
 
 // GetQuotaInfo returns quota information for a user
 func (s *QuotaService) GetQuotaInfo(userID uuid.UUID) (map[string]interface{}, error) {
+	quota, err := s.GetEffectiveQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	currentUsage, err := s.GetUserStorageUsage(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	quotaBytes := s.quotaMB * 1024 * 1024
-	remainingBytes := quotaBytes - currentUsage
-	usagePercentage := float64(currentUsage) / float64(quotaBytes) * 100
+	// Unlimited quotas report -1 for the quota and what remains of it
+	quotaBytes := UnlimitedQuotaMB
+	remainingBytes := UnlimitedQuotaMB
+	var usagePercentage float64
+	if !quota.Unlimited() {
+		quotaBytes = quota.QuotaMB * 1024 * 1024
+		remainingBytes = quotaBytes - currentUsage
+		if quotaBytes > 0 {
+			usagePercentage = float64(currentUsage) / float64(quotaBytes) * 100
+		}
+	}
 
 	return map[string]interface{}{
 		"used_bytes":       currentUsage,
 		"quota_bytes":      quotaBytes,
 		"remaining_bytes":  remainingBytes,
 		"usage_percentage": usagePercentage,
-		"quota_mb":         s.quotaMB,
+		"quota_mb":         quota.QuotaMB,
+		"quota_source":     quota.Source,
+		"unlimited":        quota.Unlimited(),
 	}, nil
 }
+
+// GetUserDedupSavings returns how many of the user's files reuse content that was already
+// stored, and the bytes of storage those uploads didn't take
+func (s *QuotaService) GetUserDedupSavings(userID uuid.UUID) (int, int64, error) {
+	return s.fileRepo.GetDedupSavings(userID)
+}
+
+// GetCleanupSuggestions suggests files to delete: extra copies of content the user already
+// has, the files whose deletion frees the most storage, and files nobody has opened in a long time.
+// Each file is suggested at most once.
+func (s *QuotaService) GetCleanupSuggestions(userID uuid.UUID) ([]CleanupSuggestion, error) {
+	candidates, err := s.fileRepo.GetCleanupCandidates(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user files: %w", err)
+	}
+
+	return buildCleanupSuggestions(candidates, time.Now()), nil
+}
+
+// buildCleanupSuggestions ranks candidates (ordered oldest first) into suggestions
+func buildCleanupSuggestions(candidates []*models.CleanupCandidate, now time.Time) []CleanupSuggestion {
+	suggestions := []CleanupSuggestion{}
+	suggested := make(map[uuid.UUID]bool)
+	add := func(reason string, candidate *models.CleanupCandidate) {
+		suggested[candidate.File.ID] = true
+		suggestions = append(suggestions, CleanupSuggestion{
+			Reason:         reason,
+			File:           candidate.File,
+			BytesFreed:     cleanupBytesFreed(candidate),
+			LastAccessedAt: candidate.LastAccessedAt,
+		})
+	}
+
+	// Keep the oldest file for each content and suggest the later copies
+	seenHashes := make(map[string]bool)
+	duplicates := 0
+	for _, candidate := range candidates {
+		if !seenHashes[candidate.File.Hash] {
+			seenHashes[candidate.File.Hash] = true
+			continue
+		}
+		if duplicates < cleanupSuggestionsPerReason {
+			add(CleanupReasonDuplicate, candidate)
+			duplicates++
+		}
+	}
+
+	largest := make([]*models.CleanupCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !suggested[candidate.File.ID] && cleanupBytesFreed(candidate) > 0 {
+			largest = append(largest, candidate)
+		}
+	}
+	sort.SliceStable(largest, func(i, j int) bool {
+		return cleanupBytesFreed(largest[i]) > cleanupBytesFreed(largest[j])
+	})
+	for i := 0; i < len(largest) && i < cleanupSuggestionsPerReason; i++ {
+		add(CleanupReasonLargest, largest[i])
+	}
+
+	unaccessed := make([]*models.CleanupCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !suggested[candidate.File.ID] && cleanupBytesFreed(candidate) > 0 &&
+			now.Sub(lastUsed(candidate)) >= cleanupUnaccessedAfter {
+			unaccessed = append(unaccessed, candidate)
+		}
+	}
+	sort.SliceStable(unaccessed, func(i, j int) bool {
+		return lastUsed(unaccessed[i]).Before(lastUsed(unaccessed[j]))
+	})
+	for i := 0; i < len(unaccessed) && i < cleanupSuggestionsPerReason; i++ {
+		add(CleanupReasonUnaccessed, unaccessed[i])
+	}
+
+	return suggestions
+}
+
+// cleanupBytesFreed is the storage deleting the file releases. A private copy always frees
+// its own object; deduplicated content is only freed with its last reference.
+func cleanupBytesFreed(candidate *models.CleanupCandidate) int64 {
+	if candidate.File.DedupDisabled || candidate.SharedReferences <= 1 {
+		return candidate.File.Size
+	}
+	return 0
+}
+
+// lastUsed is when the file was last opened, or uploaded if it never was
+func lastUsed(candidate *models.CleanupCandidate) time.Time {
+	if candidate.LastAccessedAt != nil {
+		return *candidate.LastAccessedAt
+	}
+	return candidate.File.CreatedAt
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cleanupCandidate(name, hash string, size int64, refs int, created time.Time) *models.CleanupCandidate {
+	return &models.CleanupCandidate{
+		File:             &models.File{ID: uuid.New(), OriginalName: name, Hash: hash, Size: size, CreatedAt: created},
+		SharedReferences: refs,
+	}
+}
+
+func suggestionNames(suggestions []CleanupSuggestion, reason string) []string {
+	names := []string{}
+	for _, suggestion := range suggestions {
+		if suggestion.Reason == reason {
+			names = append(names, suggestion.File.OriginalName)
+		}
+	}
+	return names
+}
+
+func TestBuildCleanupSuggestions_OnlyCountsBytesActuallyFreed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Hour)
+
+	video := cleanupCandidate("video.mp4", "v", 500, 1, recent)
+	sharedISO := cleanupCandidate("distro.iso", "iso", 900, 3, recent)
+	private := cleanupCandidate("private.iso", "iso", 900, 3, recent)
+	private.File.DedupDisabled = true
+
+	suggestions := buildCleanupSuggestions([]*models.CleanupCandidate{video, sharedISO, private}, now)
+
+	// The private copy is the user's second file with that content, so it's a duplicate that frees its own object
+	require.Len(t, suggestions, 2)
+	assert.Equal(t, CleanupReasonDuplicate, suggestions[0].Reason)
+	assert.Equal(t, "private.iso", suggestions[0].File.OriginalName)
+	assert.Equal(t, int64(900), suggestions[0].BytesFreed)
+
+	// The shared ISO is larger but other users still reference it, so deleting it frees nothing
+	assert.Equal(t, []string{"video.mp4"}, suggestionNames(suggestions, CleanupReasonLargest))
+	assert.Equal(t, int64(500), suggestions[1].BytesFreed)
+}
+
+func TestBuildCleanupSuggestions_DuplicateReferencesFreeNothing(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	original := cleanupCandidate("report.pdf", "r", 100, 2, now.Add(-2*time.Hour))
+	copied := cleanupCandidate("report (copy).pdf", "r", 100, 2, now.Add(-time.Hour))
+
+	suggestions := buildCleanupSuggestions([]*models.CleanupCandidate{original, copied}, now)
+
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, CleanupReasonDuplicate, suggestions[0].Reason)
+	assert.Equal(t, "report (copy).pdf", suggestions[0].File.OriginalName)
+	assert.Zero(t, suggestions[0].BytesFreed)
+}
+
+func TestBuildCleanupSuggestions_UnaccessedOldestFirst(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var candidates []*models.CleanupCandidate
+	// Enough large files to fill the largest list so the rest are considered as unaccessed
+	for i := 0; i < cleanupSuggestionsPerReason; i++ {
+		candidates = append(candidates, cleanupCandidate("big", uuid.NewString(), 1000, 1, now))
+	}
+	opened := cleanupCandidate("opened-last-year.txt", "a", 10, 1, now.AddDate(-2, 0, 0))
+	lastYear := now.AddDate(-1, 0, 0)
+	opened.LastAccessedAt = &lastYear
+	neverOpened := cleanupCandidate("never-opened.txt", "b", 10, 1, now.AddDate(-3, 0, 0))
+	openedToday := cleanupCandidate("opened-today.txt", "c", 10, 1, now.AddDate(-3, 0, 0))
+	today := now.Add(-time.Hour)
+	openedToday.LastAccessedAt = &today
+	candidates = append(candidates, opened, neverOpened, openedToday)
+
+	suggestions := buildCleanupSuggestions(candidates, now)
+
+	assert.Len(t, suggestionNames(suggestions, CleanupReasonLargest), cleanupSuggestionsPerReason)
+	assert.Equal(t, []string{"never-opened.txt", "opened-last-year.txt"}, suggestionNames(suggestions, CleanupReasonUnaccessed))
+}
+
+func TestBuildCleanupSuggestions_NoFiles(t *testing.T) {
+	suggestions := buildCleanupSuggestions(nil, time.Now())
+	assert.NotNil(t, suggestions)
+	assert.Empty(t, suggestions)
+}
+
+// fakeQuotaUsers stores roles and quota overrides in memory
+type fakeQuotaUsers struct {
+	roles     map[uuid.UUID]string
+	overrides map[uuid.UUID]int64
+}
+
+func (f *fakeQuotaUsers) GetByID(id uuid.UUID) (*models.User, error) {
+	role, ok := f.roles[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	return &models.User{ID: id, Role: role}, nil
+}
+
+func (f *fakeQuotaUsers) GetStorageQuotaOverride(userID uuid.UUID) (*int64, error) {
+	if quota, ok := f.overrides[userID]; ok {
+		return &quota, nil
+	}
+	return nil, nil
+}
+
+func TestGetEffectiveQuota_Precedence(t *testing.T) {
+	regular, admin, overridden := uuid.New(), uuid.New(), uuid.New()
+	users := &fakeQuotaUsers{
+		roles:     map[uuid.UUID]string{regular: models.RoleUser, admin: models.RoleAdmin, overridden: models.RoleUser},
+		overrides: map[uuid.UUID]int64{overridden: 50},
+	}
+
+	tests := []struct {
+		name       string
+		roleQuotas map[string]int64
+		userID     uuid.UUID
+		expected   EffectiveQuota
+	}{
+		{"user override wins over role default", map[string]int64{models.RoleUser: 1024}, overridden, EffectiveQuota{QuotaMB: 50, Source: QuotaSourceUser}},
+		{"role default wins over global", map[string]int64{models.RoleUser: 1024}, regular, EffectiveQuota{QuotaMB: 1024, Source: QuotaSourceRole}},
+		{"admins unlimited by role", map[string]int64{models.RoleAdmin: UnlimitedQuotaMB}, admin, EffectiveQuota{QuotaMB: UnlimitedQuotaMB, Source: QuotaSourceRole}},
+		{"global default without a role quota", map[string]int64{models.RoleAdmin: UnlimitedQuotaMB}, regular, EffectiveQuota{QuotaMB: 10, Source: QuotaSourceGlobal}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewQuotaService(nil, 10)
+			service.SetRoleQuotas(users, tt.roleQuotas)
+
+			quota, err := service.GetEffectiveQuota(tt.userID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, quota)
+		})
+	}
+}
+
+func TestGetEffectiveQuota_FollowsRoleChanges(t *testing.T) {
+	userID := uuid.New()
+	users := &fakeQuotaUsers{roles: map[uuid.UUID]string{userID: models.RoleUser}}
+	service := NewQuotaService(nil, 10)
+	service.SetRoleQuotas(users, map[string]int64{models.RoleAdmin: UnlimitedQuotaMB, models.RoleUser: 100})
+
+	quota, err := service.GetEffectiveQuota(userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), quota.QuotaMB)
+	assert.False(t, quota.Unlimited())
+
+	// Promotion takes effect without any per-user quota update
+	users.roles[userID] = models.RoleAdmin
+	quota, err = service.GetEffectiveQuota(userID)
+	require.NoError(t, err)
+	assert.True(t, quota.Unlimited())
+}
+
+func TestGetEffectiveQuota_GlobalWithoutRoleQuotas(t *testing.T) {
+	service := NewQuotaService(nil, 25)
+
+	quota, err := service.GetEffectiveQuota(uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, EffectiveQuota{QuotaMB: 25, Source: QuotaSourceGlobal}, quota)
+}
+
+func TestParseRoleQuotas(t *testing.T) {
+	quotas, err := ParseRoleQuotas(" admin=unlimited, user=1024 ")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{models.RoleAdmin: UnlimitedQuotaMB, models.RoleUser: 1024}, quotas)
+
+	quotas, err = ParseRoleQuotas("")
+	require.NoError(t, err)
+	assert.Empty(t, quotas)
+
+	for _, invalid := range []string{"user", "guest=10", "user=-5", "user=lots"} {
+		_, err := ParseRoleQuotas(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrRangeNotSatisfiable is returned when a Range header asks for bytes outside the file
+var ErrRangeNotSatisfiable = errors.New("requested range not satisfiable")
+
+// ByteRange is an inclusive range of bytes within a file
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// Length returns the number of bytes in the range
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+// ContentRange formats the range as a Content-Range header value
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)
+}
+
+// ParseRangeHeader parses a single-range "bytes=" Range header for a file of the given size.
+// It returns nil when there is no header or the header can't be honored (e.g. multiple
+// ranges), in which case the whole file should be sent, and ErrRangeNotSatisfiable when
+// the range lies entirely outside the file.
+func ParseRangeHeader(header string, size int64) (*ByteRange, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || !strings.HasPrefix(header, "bytes=") {
+		return nil, nil
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if spec == "" || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, nil
+	}
+	startStr = strings.TrimSpace(startStr)
+	endStr = strings.TrimSpace(endStr)
+
+	// Suffix range: last N bytes
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix < 0 {
+			return nil, nil
+		}
+		if suffix == 0 || size == 0 {
+			return nil, ErrRangeNotSatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return &ByteRange{Start: size - suffix, End: size - 1}, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	if start >= size {
+		return nil, ErrRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return &ByteRange{Start: start, End: end}, nil
+}
+
+// s3ObjectGetter is the subset of the S3 client used to stream downloads
+type s3ObjectGetter interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// ObjectDownload is an S3 object body ready to be written to an HTTP response
+type ObjectDownload struct {
+	Body          io.ReadCloser
+	StatusCode    int
+	ContentLength int64
+	ContentRange  string
+	ETag          string
+	LastModified  *time.Time
+}
+
+// SetHeaders writes the length and range headers for the download
+func (d *ObjectDownload) SetHeaders(header http.Header) {
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(d.ContentLength, 10))
+	if d.ContentRange != "" {
+		header.Set("Content-Range", d.ContentRange)
+	}
+}
+
+// SetFileDownloadHeaders writes the headers describing a whole-file download: its type, its
+// name as an attachment, its length and range support. GET handlers call ObjectDownload's
+// SetHeaders afterwards to narrow the length for partial responses; HEAD handlers send these as is.
+func SetFileDownloadHeaders(header http.Header, file *models.File) {
+	header.Set("Content-Type", file.MimeType)
+	header.Set("Content-Disposition", ContentDisposition("attachment", DownloadFilename(file)))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(file.Size, 10))
+}
+
+// activeContentTypes can run script when a browser renders them, so they are never shown inline
+var activeContentTypes = map[string]bool{
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/xml":               true,
+	"application/xml":        true,
+	"text/xsl":               true,
+	"application/javascript": true,
+	"text/javascript":        true,
+	"application/ecmascript": true,
+	"text/ecmascript":        true,
+}
+
+// InlinePreviewAllowed reports whether a file of this MIME type is safe to render inline from
+// our origin. HTML, SVG, XML and script content could run script with the viewer's session, so
+// they are only ever served as attachments.
+func InlinePreviewAllowed(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	return !activeContentTypes[mediaType]
+}
+
+// SetFilePreviewHeaders sets the headers for showing a file inline in the browser, falling back
+// to an attachment for content types the preview policy doesn't allow
+func SetFilePreviewHeaders(header http.Header, file *models.File, policy PreviewPolicy) {
+	disposition := "inline"
+	if !policy.Allows(file.MimeType) {
+		disposition = "attachment"
+	}
+
+	header.Set("Content-Type", file.MimeType)
+	header.Set("Content-Disposition", ContentDisposition(disposition, DownloadFilename(file)))
+	header.Set("Content-Length", strconv.FormatInt(file.Size, 10))
+}
+
+// GetObjectForDownload fetches an object from S3, honoring the client's Range and If-Range
+// headers. The range is forwarded to S3; If-Range is mapped to IfMatch/IfUnmodifiedSince so
+// that a changed object is sent in full instead of a stale partial body.
+func GetObjectForDownload(ctx context.Context, client s3ObjectGetter, bucket, key string, size int64, rangeHeader, ifRange string) (*ObjectDownload, error) {
+	rng, err := ParseRangeHeader(rangeHeader, size)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if rng != nil {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", rng.Start, rng.End))
+		applyIfRange(input, ifRange)
+	}
+
+	result, err := client.GetObject(ctx, input)
+	if err != nil && rng != nil && isS3StatusError(err, http.StatusPreconditionFailed) {
+		// The object changed since the client's partial download, so send it all again
+		rng = nil
+		result, err = client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+	}
+	if err != nil {
+		if rng != nil && isS3StatusError(err, http.StatusRequestedRangeNotSatisfiable) {
+			return nil, ErrRangeNotSatisfiable
+		}
+		return nil, fmt.Errorf("failed to download file from S3: %w", err)
+	}
+
+	download := &ObjectDownload{
+		Body:          result.Body,
+		StatusCode:    http.StatusOK,
+		ContentLength: size,
+		ETag:          aws.ToString(result.ETag),
+		LastModified:  result.LastModified,
+	}
+	if result.ContentLength != nil {
+		download.ContentLength = *result.ContentLength
+	}
+	if rng != nil {
+		download.StatusCode = http.StatusPartialContent
+		download.ContentRange = aws.ToString(result.ContentRange)
+		if download.ContentRange == "" {
+			download.ContentRange = rng.ContentRange(size)
+		}
+	}
+
+	return download, nil
+}
+
+// applyIfRange maps an If-Range validator onto the S3 request as a precondition
+func applyIfRange(input *s3.GetObjectInput, ifRange string) {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return
+	}
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		input.IfMatch = aws.String(ifRange)
+		return
+	}
+	if t, err := http.ParseTime(ifRange); err == nil {
+		input.IfUnmodifiedSince = aws.Time(t)
+	}
+}
+
+// isS3StatusError reports whether err is an S3 response error with the given HTTP status
+func isS3StatusError(err error, status int) bool {
+	var respErr *smithyhttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == status
+}
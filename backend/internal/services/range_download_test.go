@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeObjectGetter serves a fixed object, honoring the Range on the request like S3 does
+type fakeObjectGetter struct {
+	content string
+	etag    string
+	inputs  []*s3.GetObjectInput
+}
+
+func (f *fakeObjectGetter) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.inputs = append(f.inputs, params)
+
+	if params.IfMatch != nil && *params.IfMatch != f.etag {
+		return nil, &smithyhttp.ResponseError{Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusPreconditionFailed}}, Err: errors.New("precondition failed")}
+	}
+
+	size := int64(len(f.content))
+	output := &s3.GetObjectOutput{ETag: aws.String(f.etag)}
+	if params.Range == nil {
+		output.Body = io.NopCloser(strings.NewReader(f.content))
+		output.ContentLength = aws.Int64(size)
+		return output, nil
+	}
+
+	rng, err := ParseRangeHeader(*params.Range, size)
+	if err != nil || rng == nil {
+		return nil, errors.New("unexpected range forwarded to S3")
+	}
+	output.Body = io.NopCloser(strings.NewReader(f.content[rng.Start : rng.End+1]))
+	output.ContentLength = aws.Int64(rng.Length())
+	output.ContentRange = aws.String(rng.ContentRange(size))
+	return output, nil
+}
+
+func TestParseRangeHeader(t *testing.T) {
+	rng, err := ParseRangeHeader("bytes=10-19", 100)
+	require.NoError(t, err)
+	assert.Equal(t, &ByteRange{Start: 10, End: 19}, rng)
+
+	rng, err = ParseRangeHeader("bytes=90-", 100)
+	require.NoError(t, err)
+	assert.Equal(t, &ByteRange{Start: 90, End: 99}, rng)
+
+	rng, err = ParseRangeHeader("bytes=-5", 100)
+	require.NoError(t, err)
+	assert.Equal(t, &ByteRange{Start: 95, End: 99}, rng)
+
+	rng, err = ParseRangeHeader("bytes=50-500", 100)
+	require.NoError(t, err)
+	assert.Equal(t, &ByteRange{Start: 50, End: 99}, rng)
+
+	_, err = ParseRangeHeader("bytes=100-", 100)
+	assert.ErrorIs(t, err, ErrRangeNotSatisfiable)
+
+	// Missing, malformed and multi-range headers fall back to the full file
+	for _, header := range []string{"", "items=0-1", "bytes=5-2", "bytes=a-b", "bytes=0-1,5-6"} {
+		rng, err := ParseRangeHeader(header, 100)
+		assert.NoError(t, err, header)
+		assert.Nil(t, rng, header)
+	}
+}
+
+func TestGetObjectForDownload_MidFileRange(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	getter := &fakeObjectGetter{content: content, etag: `"v1"`}
+
+	download, err := GetObjectForDownload(context.Background(), getter, "bucket", "key", int64(len(content)), "bytes=10-19", "")
+	require.NoError(t, err)
+	defer download.Body.Close()
+
+	body, err := io.ReadAll(download.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", string(body))
+	assert.Equal(t, http.StatusPartialContent, download.StatusCode)
+	assert.Equal(t, int64(10), download.ContentLength)
+	assert.Equal(t, "bytes 10-19/36", download.ContentRange)
+	assert.Equal(t, "bytes=10-19", aws.ToString(getter.inputs[0].Range))
+
+	header := make(http.Header)
+	download.SetHeaders(header)
+	assert.Equal(t, "bytes", header.Get("Accept-Ranges"))
+	assert.Equal(t, "10", header.Get("Content-Length"))
+	assert.Equal(t, "bytes 10-19/36", header.Get("Content-Range"))
+}
+
+func TestGetObjectForDownload_NoRangeSendsWholeFile(t *testing.T) {
+	content := "hello world"
+	getter := &fakeObjectGetter{content: content, etag: `"v1"`}
+
+	download, err := GetObjectForDownload(context.Background(), getter, "bucket", "key", int64(len(content)), "", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, download.StatusCode)
+	assert.Equal(t, int64(len(content)), download.ContentLength)
+	assert.Empty(t, download.ContentRange)
+	assert.Nil(t, getter.inputs[0].Range)
+}
+
+func TestGetObjectForDownload_StaleIfRangeSendsWholeFile(t *testing.T) {
+	content := "0123456789"
+	getter := &fakeObjectGetter{content: content, etag: `"v2"`}
+
+	download, err := GetObjectForDownload(context.Background(), getter, "bucket", "key", int64(len(content)), "bytes=5-", `"v1"`)
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(download.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(body))
+	assert.Equal(t, http.StatusOK, download.StatusCode)
+	assert.Len(t, getter.inputs, 2)
+	assert.Equal(t, `"v1"`, aws.ToString(getter.inputs[0].IfMatch))
+}
+
+func TestGetObjectForDownload_UnsatisfiableRange(t *testing.T) {
+	getter := &fakeObjectGetter{content: "short", etag: `"v1"`}
+
+	_, err := GetObjectForDownload(context.Background(), getter, "bucket", "key", 5, "bytes=10-20", "")
+
+	assert.ErrorIs(t, err, ErrRangeNotSatisfiable)
+	assert.Empty(t, getter.inputs, "unsatisfiable ranges should not reach S3")
+}
+
+func TestSetFilePreviewHeaders_ActiveContentIsAttachment(t *testing.T) {
+	tests := []struct {
+		mimeType    string
+		disposition string
+	}{
+		{"image/png", "inline"},
+		{"application/pdf", "inline"},
+		{"text/plain; charset=utf-8", "inline"},
+		{"text/html", "attachment"},
+		{"text/html; charset=utf-8", "attachment"},
+		{"image/svg+xml", "attachment"},
+		{"IMAGE/SVG+XML", "attachment"},
+		{"application/xhtml+xml", "attachment"},
+		{"application/xml", "attachment"},
+		{"text/javascript", "attachment"},
+		{"application/x-msdownload", "attachment"},
+		{"application/zip", "attachment"},
+		{"video/mp4", "inline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			header := make(http.Header)
+			SetFilePreviewHeaders(header, &models.File{OriginalName: "file", MimeType: tt.mimeType, Size: 42}, DefaultPreviewPolicy)
+
+			assert.Equal(t, ContentDisposition(tt.disposition, "file"), header.Get("Content-Disposition"))
+			assert.Equal(t, tt.mimeType, header.Get("Content-Type"))
+			assert.Equal(t, "42", header.Get("Content-Length"))
+		})
+	}
+}
+
+func TestSetFileDownloadHeaders_PrefersDownloadName(t *testing.T) {
+	downloadName := "Invoice 2024.pdf"
+	file := &models.File{OriginalName: "scan_0042.pdf", MimeType: "application/pdf", Size: 42}
+
+	header := make(http.Header)
+	SetFileDownloadHeaders(header, file)
+	assert.Equal(t, ContentDisposition("attachment", "scan_0042.pdf"), header.Get("Content-Disposition"))
+
+	file.DownloadName = &downloadName
+	header = make(http.Header)
+	SetFileDownloadHeaders(header, file)
+	assert.Equal(t, `attachment; filename="Invoice 2024.pdf"; filename*=UTF-8''Invoice%202024.pdf`, header.Get("Content-Disposition"))
+
+	header = make(http.Header)
+	SetFilePreviewHeaders(header, file, DefaultPreviewPolicy)
+	assert.Equal(t, ContentDisposition("inline", downloadName), header.Get("Content-Disposition"))
+}
+
+// stuckObjectGetter blocks until the request context ends, like a hung S3 connection
+type stuckObjectGetter struct{}
+
+func (stuckObjectGetter) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGetObjectForDownload_StuckS3TimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := GetObjectForDownload(ctx, stuckObjectGetter{}, "bucket", "key", 10, "", "")
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
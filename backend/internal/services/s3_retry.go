@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3RetryPolicy controls how transient S3 failures (throttling, 5xx, dropped connections)
+// are retried on top of the SDK's own request handling
+type S3RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultS3RetryPolicy returns the policy used when none is configured
+func DefaultS3RetryPolicy() S3RetryPolicy {
+	return S3RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// do runs fn until it succeeds, returns a non-retryable error, the attempts run out or
+// ctx is done. Waits between attempts use exponential backoff with full jitter.
+func (p S3RetryPolicy) do(ctx context.Context, operation string, fn func() error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !isRetryableS3Error(err) {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		fmt.Printf("WARNING: S3 %s failed (attempt %d/%d), retrying in %v: %v\n", operation, attempt, attempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^(attempt-1))]
+func (p S3RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		ceiling *= 2
+		if p.MaxDelay > 0 && ceiling >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// isRetryableS3Error reports whether err is a transient failure worth retrying, using the
+// same checks as the SDK's standard retryer. Cancelled or timed-out contexts are never retried.
+func isRetryableS3Error(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// getObjectWithRetry calls GetObject under the retry policy
+func getObjectWithRetry(ctx context.Context, getter s3ObjectGetter, policy S3RetryPolicy, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	var output *s3.GetObjectOutput
+	err := policy.do(ctx, "GetObject", func() error {
+		var err error
+		output, err = getter.GetObject(ctx, params, optFns...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
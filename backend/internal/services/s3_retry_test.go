@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockObjectGetter is a mock implementation of s3ObjectGetter
+type MockObjectGetter struct {
+	mock.Mock
+}
+
+func (m *MockObjectGetter) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
+}
+
+func s3StatusError(status int) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      errors.New(http.StatusText(status)),
+	}
+}
+
+func testRetryPolicy() S3RetryPolicy {
+	return S3RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+}
+
+func TestGetObjectWithRetry_SucceedsAfterTransientFailures(t *testing.T) {
+	getter := new(MockObjectGetter)
+	input := &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}
+	output := &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("content"))}
+
+	getter.On("GetObject", mock.Anything, input).Return(nil, s3StatusError(http.StatusServiceUnavailable)).Twice()
+	getter.On("GetObject", mock.Anything, input).Return(output, nil).Once()
+
+	result, err := getObjectWithRetry(context.Background(), getter, testRetryPolicy(), input)
+	require.NoError(t, err)
+	assert.Same(t, output, result)
+	getter.AssertNumberOfCalls(t, "GetObject", 3)
+}
+
+func TestGetObjectWithRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	getter := new(MockObjectGetter)
+	input := &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}
+
+	getter.On("GetObject", mock.Anything, input).Return(nil, s3StatusError(http.StatusInternalServerError))
+
+	_, err := getObjectWithRetry(context.Background(), getter, testRetryPolicy(), input)
+	assert.Error(t, err)
+	getter.AssertNumberOfCalls(t, "GetObject", 3)
+}
+
+func TestGetObjectWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	getter := new(MockObjectGetter)
+	input := &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("missing")}
+
+	getter.On("GetObject", mock.Anything, input).Return(nil, s3StatusError(http.StatusNotFound))
+
+	_, err := getObjectWithRetry(context.Background(), getter, testRetryPolicy(), input)
+	assert.Error(t, err)
+	getter.AssertNumberOfCalls(t, "GetObject", 1)
+}
+
+func TestS3RetryPolicy_StopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := S3RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	calls := 0
+	err := policy.do(ctx, "GetObject", func() error {
+		calls++
+		cancel()
+		return s3StatusError(http.StatusServiceUnavailable)
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestS3RetryPolicy_BackoffIsCapped(t *testing.T) {
+	policy := S3RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, 300*time.Millisecond)
+	}
+}
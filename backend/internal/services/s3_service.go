@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -21,7 +22,10 @@ import (
 // S3ServiceInterface defines the interface for S3 operations
 type S3ServiceInterface interface {
 	UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error)
+	UploadFileWithOptions(ctx context.Context, file io.Reader, filename string, contentType string, opts *S3UploadOptions) (string, error)
+	UploadObject(ctx context.Context, key string, body io.Reader, contentType string) error
 	DownloadFile(ctx context.Context, key string) (io.ReadCloser, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	DeleteFile(ctx context.Context, key string) error
 	GeneratePresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error)
 	FileExists(ctx context.Context, key string) (bool, error)
@@ -30,21 +34,93 @@ type S3ServiceInterface interface {
 	GetClient() *s3.Client
 }
 
+// S3FileKeyPrefix is the prefix under which uploaded files are stored
+const S3FileKeyPrefix = "files/"
+
+// S3UploadOptions controls the storage class and server-side encryption of uploaded objects.
+// Empty fields leave the bucket defaults in place.
+type S3UploadOptions struct {
+	StorageClass         string
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+}
+
+// Validate checks the options against the values S3 accepts
+func (o S3UploadOptions) Validate() error {
+	if o.StorageClass != "" && !isKnownStorageClass(o.StorageClass) {
+		return fmt.Errorf("invalid S3 storage class %q", o.StorageClass)
+	}
+
+	switch types.ServerSideEncryption(o.ServerSideEncryption) {
+	case "", types.ServerSideEncryptionAes256:
+		if o.SSEKMSKeyID != "" {
+			return errors.New("an SSE-KMS key ID requires server-side encryption aws:kms")
+		}
+	case types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+	default:
+		return fmt.Errorf("invalid S3 server-side encryption %q", o.ServerSideEncryption)
+	}
+
+	return nil
+}
+
+// merge returns the options with any non-empty override fields taking precedence
+func (o S3UploadOptions) merge(override *S3UploadOptions) S3UploadOptions {
+	if override == nil {
+		return o
+	}
+	if override.StorageClass != "" {
+		o.StorageClass = override.StorageClass
+	}
+	if override.ServerSideEncryption != "" {
+		o.ServerSideEncryption = override.ServerSideEncryption
+		o.SSEKMSKeyID = override.SSEKMSKeyID
+	}
+	return o
+}
+
+// apply sets the storage class and encryption headers on a put request
+func (o S3UploadOptions) apply(input *s3.PutObjectInput) {
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	if o.ServerSideEncryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(o.ServerSideEncryption)
+	}
+	if o.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(o.SSEKMSKeyID)
+	}
+}
+
+func isKnownStorageClass(class string) bool {
+	for _, known := range types.StorageClass("").Values() {
+		if string(known) == class {
+			return true
+		}
+	}
+	return false
+}
+
 // S3Service handles AWS S3 operations for file storage
 type S3Service struct {
-	client     *s3.Client
-	uploader   *manager.Uploader
-	downloader *manager.Downloader
-	bucketName string
-	bucketURL  string
+	client        *s3.Client
+	uploader      *manager.Uploader
+	downloader    *manager.Downloader
+	bucketName    string
+	bucketURL     string
+	uploadOptions S3UploadOptions
+	retryPolicy   S3RetryPolicy
 }
 
 // NewS3Service creates a new S3 service with AWS configuration
-func NewS3Service(region, accessKey, secretKey, bucketName, bucketURL string) (*S3Service, error) {
+func NewS3Service(region, accessKey, secretKey, bucketName, bucketURL string, uploadOptions S3UploadOptions, retryPolicy S3RetryPolicy) (*S3Service, error) {
 	// Validate required parameters
 	if region == "" || accessKey == "" || secretKey == "" || bucketName == "" {
 		return nil, errors.New("region, accessKey, secretKey, and bucketName are required")
 	}
+	if err := uploadOptions.Validate(); err != nil {
+		return nil, err
+	}
 
 	// Create AWS config with explicit credentials
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
@@ -62,21 +138,50 @@ func NewS3Service(region, accessKey, secretKey, bucketName, bucketURL string) (*
 	downloader := manager.NewDownloader(client)
 
 	return &S3Service{
-		client:     client,
-		uploader:   uploader,
-		downloader: downloader,
-		bucketName: bucketName,
-		bucketURL:  bucketURL,
+		client:        client,
+		uploader:      uploader,
+		downloader:    downloader,
+		bucketName:    bucketName,
+		bucketURL:     bucketURL,
+		uploadOptions: uploadOptions,
+		retryPolicy:   retryPolicy,
 	}, nil
 }
 
-// UploadFile uploads a file to S3
+// UploadFile uploads a file to S3 using the configured storage class and encryption
 func (s *S3Service) UploadFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, error) {
+	return s.UploadFileWithOptions(ctx, file, filename, contentType, nil)
+}
+
+// UploadFileWithOptions uploads a file to S3, letting the caller override the configured
+// storage class or encryption (e.g. a cheaper class for thumbnails or cold files)
+func (s *S3Service) UploadFileWithOptions(ctx context.Context, file io.Reader, filename string, contentType string, opts *S3UploadOptions) (string, error) {
 	// Generate unique key for the file
 	key := s.generateFileKey(filename)
 
-	// Upload file to S3
-	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+	if err := s.putObject(ctx, key, file, filename, contentType, opts); err != nil {
+		return "", err
+	}
+
+	// Return the S3 URL
+	return s.getFileURL(key), nil
+}
+
+// UploadObject stores content under a key chosen by the caller, for derived objects such as
+// thumbnails that live outside the files/ prefix
+func (s *S3Service) UploadObject(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return s.putObject(ctx, key, body, path.Base(key), contentType, nil)
+}
+
+// putObject uploads a body to key with the configured storage class and encryption, retrying
+// when the body can be rewound
+func (s *S3Service) putObject(ctx context.Context, key string, file io.Reader, filename string, contentType string, opts *S3UploadOptions) error {
+	options := s.uploadOptions.merge(opts)
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucketName),
 		Key:         aws.String(key),
 		Body:        file,
@@ -85,19 +190,38 @@ func (s *S3Service) UploadFile(ctx context.Context, file io.Reader, filename str
 			"original-filename": filename,
 			"upload-timestamp":  time.Now().Format(time.RFC3339),
 		},
+	}
+	options.apply(input)
+
+	// A body that can't be rewound is only sent once, since a retry would upload a truncated stream
+	policy := s.retryPolicy
+	seeker, rewindable := file.(io.Seeker)
+	if !rewindable {
+		policy.MaxAttempts = 1
+	}
+
+	// Upload file to S3
+	attempt := 0
+	err := policy.do(ctx, "PutObject", func() error {
+		attempt++
+		if attempt > 1 {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to rewind upload body: %w", err)
+			}
+		}
+		_, err := s.uploader.Upload(ctx, input)
+		return err
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to S3: %w", err)
+		return fmt.Errorf("failed to upload file to S3: %w", err)
 	}
-
-	// Return the S3 URL
-	return s.getFileURL(key), nil
+	return nil
 }
 
 // DownloadFile downloads a file from S3
 func (s *S3Service) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
-	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+	result, err := s.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
 	})
@@ -109,11 +233,40 @@ func (s *S3Service) DownloadFile(ctx context.Context, key string) (io.ReadCloser
 	return result.Body, nil
 }
 
-// DeleteFile deletes a file from S3
-func (s *S3Service) DeleteFile(ctx context.Context, key string) error {
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+// DownloadPrefix reads at most the first n bytes of an object with a ranged GET, so content
+// can be inspected without transferring the whole file
+func (s *S3Service) DownloadPrefix(ctx context.Context, key string, n int64) ([]byte, error) {
+	result, err := s.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(result.Body, n))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file from S3: %w", err)
+	}
+	return data, nil
+}
+
+// GetObject fetches an object from S3, retrying transient failures. It satisfies the
+// interface used by GetObjectForDownload so range downloads get the same retries.
+func (s *S3Service) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return getObjectWithRetry(ctx, s.client, s.retryPolicy, params, optFns...)
+}
+
+// DeleteFile deletes a file from S3
+func (s *S3Service) DeleteFile(ctx context.Context, key string) error {
+	err := s.retryPolicy.do(ctx, "DeleteObject", func() error {
+		_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		})
+		return err
 	})
 
 	if err != nil {
@@ -143,9 +296,12 @@ func (s *S3Service) GeneratePresignedURL(ctx context.Context, key string, expira
 
 // FileExists checks if a file exists in S3
 func (s *S3Service) FileExists(ctx context.Context, key string) (bool, error) {
-	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
+	err := s.retryPolicy.do(ctx, "HeadObject", func() error {
+		_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		})
+		return err
 	})
 
 	if err != nil {
@@ -159,6 +315,47 @@ func (s *S3Service) FileExists(ctx context.Context, key string) (bool, error) {
 	return true, nil
 }
 
+// S3Object describes an object returned by ListObjects
+type S3Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// ListObjects walks every object under prefix, calling fn with each page of results
+func (s *S3Service) ListObjects(ctx context.Context, prefix string, fn func([]S3Object) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		var page *s3.ListObjectsV2Output
+		err := s.retryPolicy.do(ctx, "ListObjectsV2", func() error {
+			var err error
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list S3 objects: %w", err)
+		}
+
+		objects := make([]S3Object, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, S3Object{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+		if err := fn(objects); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetFileMetadata gets file metadata from S3
 func (s *S3Service) GetFileMetadata(ctx context.Context, key string) (map[string]string, error) {
 	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
@@ -195,7 +392,7 @@ func (s *S3Service) generateFileKey(filename string) string {
 	datePath := now.Format("2006/01/02")
 
 	// Combine to create unique key
-	key := fmt.Sprintf("files/%s/%s%s", datePath, id, ext)
+	key := fmt.Sprintf("%s%s/%s%s", S3FileKeyPrefix, datePath, id, ext)
 
 	return key
 }
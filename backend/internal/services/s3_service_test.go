@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3UploadOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    S3UploadOptions
+		wantErr bool
+	}{
+		{"defaults", S3UploadOptions{}, false},
+		{"standard ia", S3UploadOptions{StorageClass: "STANDARD_IA"}, false},
+		{"intelligent tiering with sse-s3", S3UploadOptions{StorageClass: "INTELLIGENT_TIERING", ServerSideEncryption: "AES256"}, false},
+		{"sse-kms with key", S3UploadOptions{ServerSideEncryption: "aws:kms", SSEKMSKeyID: "alias/filevault"}, false},
+		{"unknown class", S3UploadOptions{StorageClass: "CHEAP"}, true},
+		{"lowercase class", S3UploadOptions{StorageClass: "standard_ia"}, true},
+		{"unknown encryption", S3UploadOptions{ServerSideEncryption: "rot13"}, true},
+		{"kms key without kms", S3UploadOptions{ServerSideEncryption: "AES256", SSEKMSKeyID: "alias/filevault"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestS3UploadOptions_MergeAndApply(t *testing.T) {
+	defaults := S3UploadOptions{StorageClass: "STANDARD", ServerSideEncryption: "aws:kms", SSEKMSKeyID: "alias/filevault"}
+
+	input := &s3.PutObjectInput{}
+	defaults.merge(nil).apply(input)
+	assert.Equal(t, types.StorageClassStandard, input.StorageClass)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+	assert.Equal(t, "alias/filevault", aws.ToString(input.SSEKMSKeyId))
+
+	// Overriding only the class keeps the configured encryption
+	input = &s3.PutObjectInput{}
+	defaults.merge(&S3UploadOptions{StorageClass: "GLACIER_IR"}).apply(input)
+	assert.Equal(t, types.StorageClassGlacierIr, input.StorageClass)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+
+	// Overriding the encryption replaces the KMS key as well
+	input = &s3.PutObjectInput{}
+	defaults.merge(&S3UploadOptions{ServerSideEncryption: "AES256"}).apply(input)
+	assert.Equal(t, types.ServerSideEncryptionAes256, input.ServerSideEncryption)
+	assert.Nil(t, input.SSEKMSKeyId)
+}
@@ -19,6 +19,8 @@ type SearchFilters struct {
 	MaxSize    *int64     `json:"maxSize"`
 	DateFrom   *time.Time `json:"dateFrom"`
 	DateTo     *time.Time `json:"dateTo"`
+	FolderID   *uuid.UUID `json:"folderId"`  // restrict to files in this folder
+	Recursive  bool       `json:"recursive"` // also include the folder's subfolders
 	SortBy     string     `json:"sortBy"`    // "name", "size", "date", "type"
 	SortOrder  string     `json:"sortOrder"` // "asc", "desc"
 	Limit      int        `json:"limit"`
@@ -68,7 +70,7 @@ func (s *SearchService) AdvancedSearch(userID uuid.UUID, filters SearchFilters)
 
 	// Get the actual files
 	filesQuery := fmt.Sprintf(`
-		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.created_at, f.updated_at,
+		SELECT f.id, f.filename, f.original_name, f.mime_type, f.size, f.hash, f.s3_key, f.uploader_id, f.folder_id, f.description, f.created_at, f.updated_at,
 		       u.id, u.email, u.username, u.role, u.created_at, u.updated_at
 		FROM files f
 		LEFT JOIN users u ON f.uploader_id = u.id
@@ -101,6 +103,7 @@ func (s *SearchService) AdvancedSearch(userID uuid.UUID, filters SearchFilters)
 			&file.S3Key,
 			&file.UploaderID,
 			&file.FolderID,
+			&file.Description,
 			&file.CreatedAt,
 			&file.UpdatedAt,
 			&uploader.ID,
@@ -139,12 +142,12 @@ func (s *SearchService) buildWhereClause(userID uuid.UUID, filters SearchFilters
 	args = append(args, userID)
 	argIndex++
 
-	// Search term (searches in filename and original name)
+	// Search term (searches in filename, original name and description)
 	if filters.SearchTerm != "" {
 		searchPattern := "%" + strings.ToLower(filters.SearchTerm) + "%"
-		conditions = append(conditions, fmt.Sprintf("(LOWER(f.original_name) LIKE $%d OR LOWER(f.filename) LIKE $%d)", argIndex, argIndex+1))
-		args = append(args, searchPattern, searchPattern)
-		argIndex += 2
+		conditions = append(conditions, fmt.Sprintf("(LOWER(f.original_name) LIKE $%d OR LOWER(f.filename) LIKE $%d OR LOWER(COALESCE(f.description, '')) LIKE $%d)", argIndex, argIndex+1, argIndex+2))
+		args = append(args, searchPattern, searchPattern, searchPattern)
+		argIndex += 3
 	}
 
 	// MIME type filter
@@ -184,6 +187,25 @@ func (s *SearchService) buildWhereClause(userID uuid.UUID, filters SearchFilters
 		argIndex++
 	}
 
+	// Folder scope, optionally covering the whole subtree of the user's own folders
+	if filters.FolderID != nil {
+		if filters.Recursive {
+			conditions = append(conditions, fmt.Sprintf(`f.folder_id IN (
+			WITH RECURSIVE folder_tree AS (
+				SELECT id FROM folders WHERE id = $%d AND owner_id = $1
+				UNION
+				SELECT fo.id FROM folders fo INNER JOIN folder_tree ft ON fo.parent_id = ft.id
+				WHERE fo.owner_id = $1
+			)
+			SELECT id FROM folder_tree
+		)`, argIndex))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("f.folder_id = $%d", argIndex))
+		}
+		args = append(args, *filters.FolderID)
+		argIndex++
+	}
+
 	whereClause := ""
 	if len(conditions) > 0 {
 		whereClause = "WHERE " + strings.Join(conditions, " AND ")
@@ -192,33 +214,9 @@ func (s *SearchService) buildWhereClause(userID uuid.UUID, filters SearchFilters
 	return whereClause, args
 }
 
-// buildOrderClause constructs the ORDER BY clause
+// buildOrderClause constructs the ORDER BY clause, shared with the main file listing
 func (s *SearchService) buildOrderClause(sortBy, sortOrder string) string {
-	if sortBy == "" {
-		sortBy = "date"
-	}
-	if sortOrder == "" {
-		sortOrder = "desc"
-	}
-
-	var orderBy string
-	switch strings.ToLower(sortBy) {
-	case "name":
-		orderBy = "f.original_name"
-	case "size":
-		orderBy = "f.size"
-	case "type":
-		orderBy = "f.mime_type"
-	case "date":
-		orderBy = "f.created_at"
-	default:
-		orderBy = "f.created_at"
-	}
-
-	if strings.ToLower(sortOrder) == "asc" {
-		return fmt.Sprintf("ORDER BY %s ASC", orderBy)
-	}
-	return fmt.Sprintf("ORDER BY %s DESC", orderBy)
+	return repositories.FileOrderClause(sortBy, sortOrder)
 }
 
 // GetMimeTypeCategories returns categorized MIME types for filtering
@@ -282,6 +280,12 @@ func (s *SearchService) GetMimeTypeCategories() map[string][]string {
 	}
 }
 
+// GetUserMimeTypes returns the MIME types present in a user's library with their file counts,
+// for filter options that only list types the user actually has
+func (s *SearchService) GetUserMimeTypes(userID uuid.UUID) ([]models.MimeTypeCount, error) {
+	return s.fileRepo.GetMimeTypeCounts(userID)
+}
+
 // GetFileStats returns statistics about user's files
 func (s *SearchService) GetFileStats(userID uuid.UUID) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
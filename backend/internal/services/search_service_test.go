@@ -0,0 +1,62 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchService_BuildWhereClause_FolderScope(t *testing.T) {
+	service := &SearchService{}
+	userID := uuid.New()
+	folderID := uuid.New()
+
+	where, args := service.buildWhereClause(userID, SearchFilters{SearchTerm: "report", FolderID: &folderID})
+	assert.Contains(t, where, "f.folder_id = $5")
+	assert.NotContains(t, where, "WITH RECURSIVE")
+	assert.Equal(t, []interface{}{userID, "%report%", "%report%", "%report%", folderID}, args)
+}
+
+func TestSearchService_BuildWhereClause_RecursiveFolderScope(t *testing.T) {
+	service := &SearchService{}
+	userID := uuid.New()
+	folderID := uuid.New()
+
+	where, args := service.buildWhereClause(userID, SearchFilters{FolderID: &folderID, Recursive: true})
+	assert.Contains(t, where, "WITH RECURSIVE folder_tree")
+	assert.Contains(t, where, "WHERE id = $2 AND owner_id = $1")
+	assert.Equal(t, []interface{}{userID, folderID}, args)
+}
+
+func TestSearchService_BuildWhereClause_NoFolderScope(t *testing.T) {
+	service := &SearchService{}
+
+	where, args := service.buildWhereClause(uuid.New(), SearchFilters{Recursive: true})
+	assert.False(t, strings.Contains(where, "folder_id"))
+	assert.Len(t, args, 1)
+}
+
+func TestSearchService_BuildOrderClause(t *testing.T) {
+	service := &SearchService{}
+
+	tests := []struct {
+		sortBy, sortOrder string
+		expected          string
+	}{
+		{"name", "asc", "ORDER BY f.original_name ASC"},
+		{"SIZE", "DESC", "ORDER BY f.size DESC"},
+		{"type", "asc", "ORDER BY f.mime_type ASC"},
+		{"date", "asc", "ORDER BY f.created_at ASC"},
+		{"", "", "ORDER BY f.created_at DESC"},
+		// Unknown columns and orders fall back to the default instead of erroring
+		{"password; DROP TABLE files", "asc", "ORDER BY f.created_at ASC"},
+		{"name", "sideways", "ORDER BY f.original_name DESC"},
+		{"uploader_id", "", "ORDER BY f.created_at DESC"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, service.buildOrderClause(tt.sortBy, tt.sortOrder), "sortBy=%q sortOrder=%q", tt.sortBy, tt.sortOrder)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"filevault/internal/models"
+)
+
+// maxShareEmailDomains bounds the allowed domains one share can list
+const maxShareEmailDomains = 20
+
+var (
+	// ErrShareEmailRequired is returned when a domain-restricted share is downloaded without an email
+	ErrShareEmailRequired = errors.New("this share requires an email address from an allowed domain")
+	// ErrShareEmailNotAllowed is returned when the viewer's email isn't at one of the share's domains
+	ErrShareEmailNotAllowed = errors.New("email address is not from a domain allowed by this share")
+)
+
+// normalizeEmailDomains validates the allowed domains for a share, lowercasing them and dropping
+// a leading "@" and duplicates. No domains gives nil, leaving the share open to anyone.
+func normalizeEmailDomains(domains []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool, len(domains))
+	for _, raw := range domains {
+		domain := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "@"))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		if len(domain) > 253 || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ \t/\\") ||
+			strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+			return nil, fmt.Errorf("invalid email domain %q", raw)
+		}
+		seen[domain] = true
+		normalized = append(normalized, domain)
+	}
+
+	if len(normalized) > maxShareEmailDomains {
+		return nil, fmt.Errorf("at most %d email domains can be allowed", maxShareEmailDomains)
+	}
+	return normalized, nil
+}
+
+// CheckShareEmail verifies that a domain-restricted share is being downloaded with an email
+// address at one of its allowed domains. Unrestricted shares accept any viewer.
+func CheckShareEmail(share *models.FileShare, email string) error {
+	if len(share.AllowedEmailDomains) == 0 {
+		return nil
+	}
+	if strings.TrimSpace(email) == "" {
+		return ErrShareEmailRequired
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return ErrShareEmailNotAllowed
+	}
+	at := strings.LastIndex(address.Address, "@")
+	domain := strings.ToLower(address.Address[at+1:])
+	for _, allowed := range share.AllowedEmailDomains {
+		if domain == allowed {
+			return nil
+		}
+	}
+	return ErrShareEmailNotAllowed
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeEmailDomains(t *testing.T) {
+	domains, err := normalizeEmailDomains([]string{" Example.COM ", "@example.com", "", "partner.co.uk"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "partner.co.uk"}, domains)
+
+	domains, err = normalizeEmailDomains(nil)
+	require.NoError(t, err)
+	assert.Nil(t, domains)
+
+	for _, invalid := range []string{"localhost", "user@example.com", "example.com.", "exa mple.com"} {
+		_, err := normalizeEmailDomains([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCheckShareEmail(t *testing.T) {
+	open := &models.FileShare{ID: uuid.New()}
+	assert.NoError(t, CheckShareEmail(open, ""))
+
+	restricted := &models.FileShare{ID: uuid.New(), AllowedEmailDomains: []string{"example.com"}}
+	assert.ErrorIs(t, CheckShareEmail(restricted, ""), ErrShareEmailRequired)
+	assert.NoError(t, CheckShareEmail(restricted, "Alice@Example.com"))
+	assert.ErrorIs(t, CheckShareEmail(restricted, "alice@sub.example.com"), ErrShareEmailNotAllowed)
+	assert.ErrorIs(t, CheckShareEmail(restricted, "alice@example.com.evil.org"), ErrShareEmailNotAllowed)
+	assert.ErrorIs(t, CheckShareEmail(restricted, "not an email"), ErrShareEmailNotAllowed)
+}
+
+func TestFileShareService_BuildShareURL_RestrictedSharesUseProxy(t *testing.T) {
+	service, err := NewFileShareService(
+		nil, nil, nil, nil, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
+		nil, nil, 0,
+	)
+	require.NoError(t, err)
+
+	file := &models.File{ID: uuid.New(), S3Key: "files/report", OriginalName: "report.pdf", MimeType: "application/pdf"}
+	share := &models.FileShare{ID: uuid.New(), ShareToken: "token", IsActive: true, AllowedEmailDomains: []string{"example.com"}}
+
+	assert.Equal(t, "http://localhost:8080/api/files/share/token", service.buildShareURL(share, file))
+}
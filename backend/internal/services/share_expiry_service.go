@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"filevault/internal/models"
+)
+
+// Reasons a share stops being downloadable
+const (
+	ShareUnavailableReasonExpired       = "expired"
+	ShareUnavailableReasonDownloadLimit = "download_limit_reached"
+)
+
+// shareExpiryWarningWindow is how far ahead owners are warned about expiring shares
+const shareExpiryWarningWindow = 24 * time.Hour
+
+// ShareExpiryService periodically warns owners about expiring shares and tells them when shares stop working
+type ShareExpiryService struct {
+	fileShareRepo    FileShareRepositoryInterface
+	userRepo         UserRepositoryInterface
+	websocketService *WebSocketService
+	emailService     *EmailService
+	interval         time.Duration
+	stop             chan struct{}
+	stopOnce         sync.Once
+}
+
+// NewShareExpiryService creates a new share expiry service
+func NewShareExpiryService(
+	fileShareRepo FileShareRepositoryInterface,
+	userRepo UserRepositoryInterface,
+	websocketService *WebSocketService,
+	emailService *EmailService,
+	interval time.Duration,
+) *ShareExpiryService {
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	return &ShareExpiryService{
+		fileShareRepo:    fileShareRepo,
+		userRepo:         userRepo,
+		websocketService: websocketService,
+		emailService:     emailService,
+		interval:         interval,
+		stop:             make(chan struct{}),
+	}
+}
+
+// Start runs the expiry check immediately and then on every interval until Stop is called
+func (s *ShareExpiryService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.CheckShares()
+		for {
+			select {
+			case <-ticker.C:
+				s.CheckShares()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	log.Printf("Share expiry job started: interval=%s", s.interval)
+}
+
+// Stop stops the background expiry job
+func (s *ShareExpiryService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// CheckShares sends expiry warnings and unavailable notifications for shares not yet notified
+func (s *ShareExpiryService) CheckShares() {
+	expiring, err := s.fileShareRepo.GetSharesExpiringBefore(time.Now().Add(shareExpiryWarningWindow))
+	if err != nil {
+		log.Printf("Share expiry job: failed to get expiring shares: %v", err)
+	} else {
+		for _, share := range expiring {
+			s.notifyShareExpiringSoon(share)
+		}
+	}
+
+	unavailable, err := s.fileShareRepo.GetUnavailableUnnotifiedShares()
+	if err != nil {
+		log.Printf("Share expiry job: failed to get unavailable shares: %v", err)
+		return
+	}
+	for _, share := range unavailable {
+		s.NotifyShareUnavailable(share, ShareUnavailableReason(share))
+	}
+}
+
+// NotifyShareUnavailable tells the owner that a share can no longer be downloaded.
+// The share must have its File populated. Each share is only ever notified once. It runs inside
+// anonymous share requests (downloads call it once S3 has returned the file), so the email is
+// sent in the background and a slow mail server can't hold those requests up.
+func (s *ShareExpiryService) NotifyShareUnavailable(share *models.FileShare, reason string) {
+	if share.File == nil {
+		return
+	}
+
+	marked, err := s.fileShareRepo.MarkUnavailableNotified(share.ID)
+	if err != nil {
+		log.Printf("Share expiry job: %v", err)
+		return
+	}
+	if !marked {
+		return // Already notified
+	}
+
+	ownerID := share.File.UploaderID.String()
+	if s.websocketService != nil {
+		s.websocketService.BroadcastShareUnavailable(ownerID, share.ID.String(), share.FileID.String(), share.File.OriginalName, reason)
+	}
+
+	var message string
+	if reason == ShareUnavailableReasonDownloadLimit {
+		message = fmt.Sprintf("The share link for \"%s\" reached its download limit and no longer works.", share.File.OriginalName)
+	} else {
+		message = fmt.Sprintf("The share link for \"%s\" has expired and no longer works.", share.File.OriginalName)
+	}
+	go s.sendEmail(share, "Your share link is no longer available", message)
+}
+
+// notifyShareExpiringSoon warns the owner that a share expires within the warning window
+func (s *ShareExpiryService) notifyShareExpiringSoon(share *models.FileShare) {
+	if share.File == nil || share.ExpiresAt == nil {
+		return
+	}
+
+	marked, err := s.fileShareRepo.MarkExpiryNotified(share.ID)
+	if err != nil {
+		log.Printf("Share expiry job: %v", err)
+		return
+	}
+	if !marked {
+		return // Already notified
+	}
+
+	message := fmt.Sprintf("The share link for \"%s\" expires on %s.", share.File.OriginalName, share.ExpiresAt.Format(time.RFC1123))
+	if s.websocketService != nil {
+		s.websocketService.BroadcastNotification(share.File.UploaderID.String(), "warning", "Share expiring soon", message, 10000)
+	}
+	s.sendEmail(share, "Your share link expires soon", message)
+}
+
+// sendEmail emails the share owner if email notifications are configured
+func (s *ShareExpiryService) sendEmail(share *models.FileShare, subject, body string) {
+	if s.emailService == nil || s.userRepo == nil {
+		return
+	}
+
+	owner, err := s.userRepo.GetByID(share.File.UploaderID)
+	if err != nil || owner == nil {
+		log.Printf("Share expiry job: failed to get owner for share %s: %v", share.ID, err)
+		return
+	}
+
+	if err := s.emailService.SendEmail(owner.Email, subject, body); err != nil {
+		log.Printf("Share expiry job: failed to email owner for share %s: %v", share.ID, err)
+	}
+}
+
+// ShareUnavailableReason returns why a share can no longer be downloaded
+func ShareUnavailableReason(share *models.FileShare) string {
+	if share.IsDownloadLimitReached() {
+		return ShareUnavailableReasonDownloadLimit
+	}
+	return ShareUnavailableReasonExpired
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareExpiryService_CheckShares_MarksEachShareOnce(t *testing.T) {
+	mockFileShareRepo := new(MockFileShareRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	// Email is configured so any notification that gets past the marker would look up the owner
+	emailService := NewEmailService("localhost", "25", "", "", "noreply@example.com")
+	service := NewShareExpiryService(mockFileShareRepo, mockUserRepo, nil, emailService, time.Minute)
+
+	expiresAt := time.Now().Add(2 * time.Hour)
+	maxDownloads := 1
+	expiring := &models.FileShare{
+		ID:        uuid.New(),
+		FileID:    uuid.New(),
+		IsActive:  true,
+		ExpiresAt: &expiresAt,
+		File:      &models.File{OriginalName: "report.pdf", UploaderID: uuid.New()},
+	}
+	exhausted := &models.FileShare{
+		ID:            uuid.New(),
+		FileID:        uuid.New(),
+		IsActive:      true,
+		DownloadCount: 1,
+		MaxDownloads:  &maxDownloads,
+		File:          &models.File{OriginalName: "photo.png", UploaderID: uuid.New()},
+	}
+
+	mockFileShareRepo.On("GetSharesExpiringBefore", mock.AnythingOfType("time.Time")).Return([]*models.FileShare{expiring}, nil)
+	mockFileShareRepo.On("GetUnavailableUnnotifiedShares").Return([]*models.FileShare{exhausted}, nil)
+	// Another instance already notified both shares
+	mockFileShareRepo.On("MarkExpiryNotified", expiring.ID).Return(false, nil)
+	mockFileShareRepo.On("MarkUnavailableNotified", exhausted.ID).Return(false, nil)
+
+	service.CheckShares()
+
+	mockFileShareRepo.AssertExpectations(t)
+	mockUserRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+}
+
+func TestShareExpiryService_NotifyShareUnavailable_DoesNotWaitForMailServer(t *testing.T) {
+	// A mail server that accepts connections but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	connected := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			connected <- conn
+		}
+	}()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	mockFileShareRepo := new(MockFileShareRepository)
+	mockUserRepo := new(MockUserRepository)
+	service := NewShareExpiryService(mockFileShareRepo, mockUserRepo, nil, NewEmailService(host, port, "", "", "noreply@example.com"), time.Minute)
+
+	maxDownloads := 1
+	share := &models.FileShare{
+		ID:            uuid.New(),
+		FileID:        uuid.New(),
+		IsActive:      true,
+		DownloadCount: 1,
+		MaxDownloads:  &maxDownloads,
+		File:          &models.File{OriginalName: "photo.png", UploaderID: uuid.New()},
+	}
+	mockFileShareRepo.On("MarkUnavailableNotified", share.ID).Return(true, nil)
+	mockUserRepo.On("GetByID", share.File.UploaderID).Return(&models.User{ID: share.File.UploaderID, Email: "owner@example.com"}, nil)
+
+	returned := make(chan struct{})
+	go func() {
+		service.NotifyShareUnavailable(share, ShareUnavailableReasonDownloadLimit)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("NotifyShareUnavailable waited for the mail server")
+	}
+
+	// The email is still attempted in the background
+	select {
+	case conn := <-connected:
+		conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("owner was never emailed")
+	}
+}
+
+func TestShareUnavailableReason(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	maxDownloads := 3
+
+	assert.Equal(t, ShareUnavailableReasonExpired, ShareUnavailableReason(&models.FileShare{ExpiresAt: &past}))
+	assert.Equal(t, ShareUnavailableReasonDownloadLimit, ShareUnavailableReason(&models.FileShare{DownloadCount: 3, MaxDownloads: &maxDownloads}))
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// DefaultShareQRCodeSize is the width and height in pixels of a share QR code
+	DefaultShareQRCodeSize = 256
+	// MinShareQRCodeSize and MaxShareQRCodeSize bound the size that may be requested; below the
+	// minimum a share URL's modules get too small to scan reliably
+	MinShareQRCodeSize = 128
+	MaxShareQRCodeSize = 1024
+)
+
+// ErrInvalidQRCodeSize is returned for a QR code size outside the allowed range
+var ErrInvalidQRCodeSize = fmt.Errorf("QR code size must be between %d and %d pixels", MinShareQRCodeSize, MaxShareQRCodeSize)
+
+// GetShareQRCode renders a PNG QR code of the default size for a share link. See
+// GetShareQRCodeWithSize.
+func (s *FileShareService) GetShareQRCode(token string) ([]byte, error) {
+	return s.GetShareQRCodeWithSize(token, DefaultShareQRCodeSize)
+}
+
+// GetShareQRCodeWithSize renders a size x size PNG QR code encoding the public URL of a share,
+// for scanning on a phone. Unknown and unavailable shares give the same error as GetFileShare.
+//
+// The code always encodes the backend share URL, even in direct URL mode: a QR code tends to be
+// printed or screenshotted and kept around, and a presigned S3 URL would stop working long
+// before the share does (and skip its download limit).
+func (s *FileShareService) GetShareQRCodeWithSize(token string, size int) ([]byte, error) {
+	if size < MinShareQRCodeSize || size > MaxShareQRCodeSize {
+		return nil, ErrInvalidQRCodeSize
+	}
+
+	share, err := s.GetFileShare(token)
+	if err != nil {
+		return nil, err
+	}
+
+	png, err := qrcode.Encode(s.proxyShareURL(share), qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+	return png, nil
+}
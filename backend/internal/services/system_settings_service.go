@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUploadsDisabled is returned for uploads while an admin has paused them
+var ErrUploadsDisabled = errors.New("uploads temporarily disabled")
+
+// settingUploadsEnabled is the system_settings key of the global upload switch
+const settingUploadsEnabled = "uploads_enabled"
+
+// defaultSettingsCacheTTL is how long a setting read from the database is trusted
+const defaultSettingsCacheTTL = 10 * time.Second
+
+// SystemSettingsRepositoryInterface defines the settings storage used by SystemSettingsService
+type SystemSettingsRepositoryInterface interface {
+	Get(key string) (string, bool, error)
+	Set(key, value string, updatedBy uuid.UUID) error
+}
+
+// SystemSettingsService exposes admin-controlled runtime switches. Values are cached for a
+// short TTL so hot paths like uploads don't query the database on every request; other
+// instances pick up a change once their cache expires.
+type SystemSettingsService struct {
+	repo SystemSettingsRepositoryInterface
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu             sync.Mutex
+	uploadsEnabled bool
+	fetchedAt      time.Time
+	loaded         bool
+}
+
+// NewSystemSettingsService creates a new system settings service. A ttl of zero uses the default.
+func NewSystemSettingsService(repo SystemSettingsRepositoryInterface, ttl time.Duration) *SystemSettingsService {
+	if ttl <= 0 {
+		ttl = defaultSettingsCacheTTL
+	}
+	return &SystemSettingsService{
+		repo: repo,
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// UploadsEnabled reports whether uploads are currently allowed. If the setting can't be read,
+// the last known value is used (or uploads stay enabled if it was never read) so a database
+// hiccup doesn't turn into an upload outage.
+func (s *SystemSettingsService) UploadsEnabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loaded && s.now().Sub(s.fetchedAt) < s.ttl {
+		return s.uploadsEnabled
+	}
+
+	value, found, err := s.repo.Get(settingUploadsEnabled)
+	if err != nil {
+		log.Printf("WARNING: failed to read upload setting, using last known value: %v", err)
+		if !s.loaded {
+			return true
+		}
+		return s.uploadsEnabled
+	}
+
+	enabled := true
+	if found {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			enabled = parsed
+		}
+	}
+
+	s.uploadsEnabled = enabled
+	s.fetchedAt = s.now()
+	s.loaded = true
+	return enabled
+}
+
+// SetUploadsEnabled turns uploads on or off for everyone
+func (s *SystemSettingsService) SetUploadsEnabled(enabled bool, updatedBy uuid.UUID) error {
+	if err := s.repo.Set(settingUploadsEnabled, strconv.FormatBool(enabled), updatedBy); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.uploadsEnabled = enabled
+	s.fetchedAt = s.now()
+	s.loaded = true
+	s.mu.Unlock()
+
+	log.Printf("Uploads %s by admin %s", map[bool]string{true: "enabled", false: "disabled"}[enabled], updatedBy)
+	return nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockSystemSettingsRepository is a mock implementation of SystemSettingsRepositoryInterface
+type MockSystemSettingsRepository struct {
+	mock.Mock
+}
+
+func (m *MockSystemSettingsRepository) Get(key string) (string, bool, error) {
+	args := m.Called(key)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockSystemSettingsRepository) Set(key, value string, updatedBy uuid.UUID) error {
+	args := m.Called(key, value, updatedBy)
+	return args.Error(0)
+}
+
+func newTestSettingsService(repo SystemSettingsRepositoryInterface) (*SystemSettingsService, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := NewSystemSettingsService(repo, 10*time.Second)
+	service.now = func() time.Time { return now }
+	return service, &now
+}
+
+func TestSystemSettingsService_UploadsEnabledCachesUntilTTL(t *testing.T) {
+	repo := new(MockSystemSettingsRepository)
+	service, now := newTestSettingsService(repo)
+
+	repo.On("Get", settingUploadsEnabled).Return("false", true, nil).Once()
+	assert.False(t, service.UploadsEnabled())
+	assert.False(t, service.UploadsEnabled())
+	repo.AssertNumberOfCalls(t, "Get", 1)
+
+	*now = now.Add(11 * time.Second)
+	repo.On("Get", settingUploadsEnabled).Return("true", true, nil).Once()
+	assert.True(t, service.UploadsEnabled())
+	repo.AssertNumberOfCalls(t, "Get", 2)
+}
+
+func TestSystemSettingsService_UploadsEnabledDefaultsToTrue(t *testing.T) {
+	repo := new(MockSystemSettingsRepository)
+	service, _ := newTestSettingsService(repo)
+
+	repo.On("Get", settingUploadsEnabled).Return("", false, nil)
+	assert.True(t, service.UploadsEnabled())
+}
+
+func TestSystemSettingsService_UploadsEnabledKeepsLastValueOnError(t *testing.T) {
+	repo := new(MockSystemSettingsRepository)
+	service, now := newTestSettingsService(repo)
+
+	repo.On("Get", settingUploadsEnabled).Return("false", true, nil).Once()
+	assert.False(t, service.UploadsEnabled())
+
+	*now = now.Add(time.Minute)
+	repo.On("Get", settingUploadsEnabled).Return("", false, errors.New("connection refused"))
+	assert.False(t, service.UploadsEnabled())
+}
+
+func TestSystemSettingsService_SetUploadsEnabledUpdatesCache(t *testing.T) {
+	repo := new(MockSystemSettingsRepository)
+	service, _ := newTestSettingsService(repo)
+	adminID := uuid.New()
+
+	repo.On("Set", settingUploadsEnabled, "false", adminID).Return(nil)
+	require.NoError(t, service.SetUploadsEnabled(false, adminID))
+
+	assert.False(t, service.UploadsEnabled())
+	repo.AssertNotCalled(t, "Get", mock.Anything)
+}
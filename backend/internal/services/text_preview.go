@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultTextPreviewBytes is how much of a file GetTextContent returns when no limit is given
+	DefaultTextPreviewBytes = 256 * 1024
+	// MaxTextPreviewBytes caps the limit a caller may ask GetTextContent for
+	MaxTextPreviewBytes = 2 * 1024 * 1024
+)
+
+// ErrBinaryContent is returned when a file asked for as text is not text
+var ErrBinaryContent = errors.New("file is not a text file and cannot be previewed as text")
+
+// textMimeTypes are non text/* MIME types whose content is plain text
+var textMimeTypes = map[string]bool{
+	"application/json":          true,
+	"application/xml":           true,
+	"application/javascript":    true,
+	"application/x-javascript":  true,
+	"application/typescript":    true,
+	"application/x-yaml":        true,
+	"application/yaml":          true,
+	"application/toml":          true,
+	"application/x-sh":          true,
+	"application/x-shellscript": true,
+	"application/sql":           true,
+	"application/x-httpd-php":   true,
+	"application/x-python":      true,
+	"application/graphql":       true,
+	"image/svg+xml":             true,
+}
+
+// languagesByExtension maps file extensions to the language name used for syntax highlighting
+var languagesByExtension = map[string]string{
+	".go":       "go",
+	".py":       "python",
+	".js":       "javascript",
+	".mjs":      "javascript",
+	".cjs":      "javascript",
+	".jsx":      "jsx",
+	".ts":       "typescript",
+	".tsx":      "tsx",
+	".java":     "java",
+	".kt":       "kotlin",
+	".c":        "c",
+	".h":        "c",
+	".cpp":      "cpp",
+	".cc":       "cpp",
+	".hpp":      "cpp",
+	".cs":       "csharp",
+	".rs":       "rust",
+	".rb":       "ruby",
+	".php":      "php",
+	".swift":    "swift",
+	".scala":    "scala",
+	".sh":       "bash",
+	".bash":     "bash",
+	".zsh":      "bash",
+	".ps1":      "powershell",
+	".sql":      "sql",
+	".html":     "html",
+	".htm":      "html",
+	".css":      "css",
+	".scss":     "scss",
+	".json":     "json",
+	".xml":      "xml",
+	".svg":      "xml",
+	".yaml":     "yaml",
+	".yml":      "yaml",
+	".toml":     "toml",
+	".ini":      "ini",
+	".md":       "markdown",
+	".graphql":  "graphql",
+	".graphqls": "graphql",
+	".proto":    "protobuf",
+	".lua":      "lua",
+	".r":        "r",
+	".csv":      "csv",
+}
+
+// languagesByFilename covers well-known files without a telling extension
+var languagesByFilename = map[string]string{
+	"dockerfile":  "dockerfile",
+	"makefile":    "makefile",
+	"jenkinsfile": "groovy",
+	"go.mod":      "go",
+}
+
+// DetectLanguage guesses a file's programming language from its name, or "plaintext"
+func DetectLanguage(filename string) string {
+	base := strings.ToLower(filepath.Base(filename))
+	if language, ok := languagesByFilename[base]; ok {
+		return language
+	}
+	if language, ok := languagesByExtension[filepath.Ext(base)]; ok {
+		return language
+	}
+	return "plaintext"
+}
+
+// isTextMimeType reports whether a MIME type describes text content
+func isTextMimeType(mimeType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(mimeType))
+	if parsed, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mediaType = parsed
+	}
+	return strings.HasPrefix(mediaType, "text/") || textMimeTypes[mediaType] ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// GetTextContent returns up to maxBytes of a text or code file (only if user is the uploader)
+// along with the language guessed from its name, so it can be shown inline instead of downloaded.
+// A non-positive maxBytes uses DefaultTextPreviewBytes. Browsers often upload source code as
+// application/octet-stream, so that is accepted for files with a known language; the content
+// itself must still be UTF-8 text.
+func (s *FileService) GetTextContent(ctx context.Context, fileID, userID uuid.UUID, maxBytes int) (string, bool, string, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultTextPreviewBytes
+	}
+	if maxBytes > MaxTextPreviewBytes {
+		maxBytes = MaxTextPreviewBytes
+	}
+
+	file, err := s.fileRepo.GetByID(fileID)
+	if err != nil {
+		return "", false, "", fmt.Errorf("file not found: %w", err)
+	}
+	if file == nil || file.UploaderID != userID {
+		return "", false, "", fmt.Errorf("file not found")
+	}
+
+	language := DetectLanguage(file.OriginalName)
+	if !isTextMimeType(file.MimeType) && (language == "plaintext" || !strings.HasPrefix(file.MimeType, "application/octet-stream")) {
+		return "", false, "", ErrBinaryContent
+	}
+
+	body, err := s.s3Service.DownloadFile(ctx, file.S3Key)
+	if err != nil {
+		return "", false, "", fmt.Errorf("failed to download file: %w", err)
+	}
+	defer body.Close()
+
+	// One extra byte tells whether the content was cut off
+	content, err := io.ReadAll(io.LimitReader(body, int64(maxBytes)+1))
+	if err != nil {
+		return "", false, "", fmt.Errorf("failed to read file content: %w", err)
+	}
+	truncated := len(content) > maxBytes
+	if truncated {
+		content = trimPartialRune(content[:maxBytes])
+	}
+
+	if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return "", false, "", ErrBinaryContent
+	}
+
+	return string(content), truncated, language, nil
+}
+
+// trimPartialRune drops a UTF-8 sequence cut off at the end of truncated content
+func trimPartialRune(content []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(content); i++ {
+		start := len(content) - i
+		if utf8.RuneStart(content[start]) {
+			if !utf8.FullRune(content[start:]) {
+				return content[:start]
+			}
+			break
+		}
+	}
+	return content
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contentS3Stub serves fixed object contents by key
+type contentS3Stub struct {
+	S3ServiceInterface
+	objects map[string]string
+}
+
+func (s *contentS3Stub) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(s.objects[key])), nil
+}
+
+func newTextPreviewFixture(name, mimeType, content string) (*FileService, *models.File) {
+	mockFileRepo := new(MockFileRepository)
+	s3Stub := &contentS3Stub{objects: map[string]string{"files/" + name: content}}
+	service := NewFileService(mockFileRepo, nil, nil, nil, s3Stub, nil, nil, nil)
+
+	file := &models.File{ID: uuid.New(), OriginalName: name, MimeType: mimeType, S3Key: "files/" + name, UploaderID: uuid.New()}
+	mockFileRepo.On("GetByID", file.ID).Return(file, nil)
+	return service, file
+}
+
+func TestGetTextContent_ReturnsContentAndLanguage(t *testing.T) {
+	service, file := newTextPreviewFixture("main.go", "text/plain; charset=utf-8", "package main\n")
+
+	content, truncated, language, err := service.GetTextContent(context.Background(), file.ID, file.UploaderID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", content)
+	assert.False(t, truncated)
+	assert.Equal(t, "go", language)
+}
+
+func TestGetTextContent_TruncatesOnRuneBoundary(t *testing.T) {
+	service, file := newTextPreviewFixture("notes.md", "text/markdown", "abcé and more")
+
+	// The limit falls inside the two-byte é, which is dropped rather than split
+	content, truncated, language, err := service.GetTextContent(context.Background(), file.ID, file.UploaderID, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", content)
+	assert.True(t, truncated)
+	assert.Equal(t, "markdown", language)
+}
+
+func TestGetTextContent_AcceptsOctetStreamSourceCode(t *testing.T) {
+	service, file := newTextPreviewFixture("script.py", "application/octet-stream", "print('hi')\n")
+
+	content, _, language, err := service.GetTextContent(context.Background(), file.ID, file.UploaderID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "print('hi')\n", content)
+	assert.Equal(t, "python", language)
+}
+
+func TestGetTextContent_RejectsBinaryFiles(t *testing.T) {
+	service, file := newTextPreviewFixture("photo.png", "image/png", "\x89PNG\r\n\x1a\n")
+	_, _, _, err := service.GetTextContent(context.Background(), file.ID, file.UploaderID, 0)
+	assert.ErrorIs(t, err, ErrBinaryContent)
+
+	// Declared as text but containing binary data
+	service, file = newTextPreviewFixture("data.txt", "text/plain", "abc\x00\x01\x02")
+	_, _, _, err = service.GetTextContent(context.Background(), file.ID, file.UploaderID, 0)
+	assert.ErrorIs(t, err, ErrBinaryContent)
+}
+
+func TestGetTextContent_OnlyUploader(t *testing.T) {
+	service, file := newTextPreviewFixture("main.go", "text/plain", "package main\n")
+
+	_, _, _, err := service.GetTextContent(context.Background(), file.ID, uuid.New(), 0)
+	assert.Error(t, err)
+}
+
+func TestDetectLanguage(t *testing.T) {
+	assert.Equal(t, "typescript", DetectLanguage("src/App.TS"))
+	assert.Equal(t, "dockerfile", DetectLanguage("Dockerfile"))
+	assert.Equal(t, "yaml", DetectLanguage("config.yml"))
+	assert.Equal(t, "plaintext", DetectLanguage("README"))
+}
+
+// stuckS3Stub never answers, like an S3 connection that hangs, until the context ends
+type stuckS3Stub struct {
+	S3ServiceInterface
+}
+
+func (s *stuckS3Stub) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGetTextContent_StuckS3TimesOut(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	service := NewFileService(mockFileRepo, nil, nil, nil, &stuckS3Stub{}, nil, nil, nil)
+	file := &models.File{ID: uuid.New(), OriginalName: "notes.txt", MimeType: "text/plain", S3Key: "files/notes.txt", UploaderID: uuid.New()}
+	mockFileRepo.On("GetByID", file.ID).Return(file, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, _, err := service.GetTextContent(ctx, file.ID, file.UploaderID, 0)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("GetTextContent hung on a stuck S3 call instead of timing out")
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"io"
+	"time"
+)
+
+// throttleBurstFraction sets the token bucket's capacity to a tenth of a second of traffic,
+// which keeps each write small enough that the rate stays smooth
+const throttleBurstFraction = 10
+
+// throttledReader limits how fast a body can be read using a token bucket. Tokens are bytes;
+// the bucket refills at rate bytes per second up to burst, and a read that takes more bytes
+// than are available sleeps until the debt has been paid back.
+type throttledReader struct {
+	io.ReadCloser
+	rate   int64
+	burst  int64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+// NewThrottledReader wraps body so that it is read at no more than bytesPerSecond
+func NewThrottledReader(body io.ReadCloser, bytesPerSecond int64) io.ReadCloser {
+	burst := bytesPerSecond / throttleBurstFraction
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttledReader{
+		ReadCloser: body,
+		rate:       bytesPerSecond,
+		burst:      burst,
+		tokens:     float64(burst),
+		now:        time.Now,
+		sleep:      time.Sleep,
+	}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.burst {
+		p = p[:r.burst]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.take(n)
+	}
+	return n, err
+}
+
+// take removes n tokens from the bucket, sleeping if that leaves it in debt
+func (r *throttledReader) take(n int) {
+	now := r.now()
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * float64(r.rate)
+		if r.tokens > float64(r.burst) {
+			r.tokens = float64(r.burst)
+		}
+	}
+	r.last = now
+
+	r.tokens -= float64(n)
+	if r.tokens < 0 {
+		wait := time.Duration(-r.tokens / float64(r.rate) * float64(time.Second))
+		r.sleep(wait)
+		r.last = r.last.Add(wait)
+		r.tokens = 0
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readThrottled drains size bytes through a throttled reader on a virtual clock and returns
+// how long the read would have taken
+func readThrottled(t *testing.T, size int, bytesPerSecond int64) time.Duration {
+	t.Helper()
+
+	reader := NewThrottledReader(io.NopCloser(bytes.NewReader(make([]byte, size))), bytesPerSecond).(*throttledReader)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := clock
+	reader.now = func() time.Time { return clock }
+	reader.sleep = func(d time.Duration) { clock = clock.Add(d) }
+
+	n, err := io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	require.Equal(t, int64(size), n)
+	return clock.Sub(start)
+}
+
+func TestThrottledReader_PacesToRate(t *testing.T) {
+	const rate = 64 * 1024
+
+	oneSecond := readThrottled(t, rate, rate)
+	twoSeconds := readThrottled(t, 2*rate, rate)
+
+	// The first burst is free, so a capped read takes the size minus one burst at the rate
+	assert.InDelta(t, 0.9, oneSecond.Seconds(), 0.01)
+	assert.InDelta(t, 1.9, twoSeconds.Seconds(), 0.01)
+}
+
+func TestThrottledReader_CappedStreamTakesLonger(t *testing.T) {
+	data := make([]byte, 32*1024)
+
+	start := time.Now()
+	_, err := io.Copy(io.Discard, io.NopCloser(bytes.NewReader(data)))
+	require.NoError(t, err)
+	uncapped := time.Since(start)
+
+	start = time.Now()
+	_, err = io.Copy(io.Discard, NewThrottledReader(io.NopCloser(bytes.NewReader(data)), 128*1024))
+	require.NoError(t, err)
+	capped := time.Since(start)
+
+	// 32 KB at 128 KB/s with a 12.8 KB burst needs roughly 150ms
+	assert.GreaterOrEqual(t, capped, 120*time.Millisecond)
+	assert.Greater(t, capped, uncapped)
+}
+
+func TestFileShareService_BuildShareURL_CappedSharesUseProxy(t *testing.T) {
+	service, err := NewFileShareService(
+		nil, nil, nil, nil, nil, nil,
+		"us-east-1", "test-key", "test-secret", "test-bucket", "http://localhost:8080",
+		nil, nil, 0,
+	)
+	require.NoError(t, err)
+
+	file := &models.File{ID: uuid.New(), S3Key: "files/report", OriginalName: "report.pdf", MimeType: "application/pdf"}
+	uncapped := &models.FileShare{ID: uuid.New(), ShareToken: "open", IsActive: true}
+	rate := int64(64 * 1024)
+	capped := &models.FileShare{ID: uuid.New(), ShareToken: "capped", IsActive: true, MaxBandwidthBps: &rate}
+
+	// In direct mode only the capped share is sent through the backend, where it is throttled
+	assert.Contains(t, service.buildShareURL(uncapped, file), "test-bucket")
+	assert.Equal(t, "http://localhost:8080/api/files/share/capped", service.buildShareURL(capped, file))
+}
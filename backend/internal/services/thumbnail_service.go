@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filevault/internal/models"
+
+	// Decoders for the formats thumbnails are made from
+	_ "image/gif"
+)
+
+const (
+	// ThumbnailKeyPrefix is where thumbnails are stored, outside the files/ prefix the orphan scan covers
+	ThumbnailKeyPrefix = "thumbnails/"
+	// maxThumbnailSourceSize skips images larger than this, to bound download and decode memory
+	maxThumbnailSourceSize = 25 * 1024 * 1024
+	// maxThumbnailSourcePixels rejects images whose dimensions would decode to an enormous
+	// bitmap even though the file is small
+	maxThumbnailSourcePixels = 50_000_000
+	// minThumbnailSize and maxThumbnailSize bound the sizes that may be configured
+	minThumbnailSize = 16
+	maxThumbnailSize = 2048
+	// thumbnailJPEGQuality is used for images without transparency
+	thumbnailJPEGQuality = 85
+)
+
+// DefaultThumbnailSizes are the sizes that may be requested when THUMBNAIL_SIZES isn't set
+var DefaultThumbnailSizes = []int{128, 256, 512}
+
+var (
+	// ErrThumbnailSizeNotAllowed is returned for a size that isn't in the configured list
+	ErrThumbnailSizeNotAllowed = errors.New("thumbnail size not allowed")
+	// ErrThumbnailUnsupported is returned for files no thumbnail can be made from
+	ErrThumbnailUnsupported = errors.New("thumbnails are not available for this file")
+)
+
+// thumbnailSourceTypes are the image formats with a registered decoder
+var thumbnailSourceTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// ParseThumbnailSizes parses a comma-separated list of thumbnail sizes in pixels such as
+// "128,256,512". An empty value gives the default sizes.
+func ParseThumbnailSizes(value string) ([]int, error) {
+	seen := make(map[int]bool)
+	var sizes []int
+	for _, raw := range strings.Split(value, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < minThumbnailSize || size > maxThumbnailSize {
+			return nil, fmt.Errorf("invalid thumbnail size %q: expected a number of pixels between %d and %d", raw, minThumbnailSize, maxThumbnailSize)
+		}
+		if !seen[size] {
+			seen[size] = true
+			sizes = append(sizes, size)
+		}
+	}
+
+	if len(sizes) == 0 {
+		return DefaultThumbnailSizes, nil
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// ThumbnailStore persists generated thumbnails
+type ThumbnailStore interface {
+	GetThumbnail(hash string, size int) (*models.Thumbnail, error)
+	CreateThumbnail(thumb *models.Thumbnail) error
+	DeleteByHash(hash string) ([]string, error)
+}
+
+// ThumbnailService makes scaled-down copies of image files at a fixed set of sizes. Each size
+// is generated the first time it's asked for and cached in S3, keyed by content hash, so sizes
+// nobody looks at are never made.
+type ThumbnailService struct {
+	s3Service S3ServiceInterface
+	store     ThumbnailStore
+	sizes     []int
+
+	// inflight holds a channel per hash and size being generated, so concurrent requests for
+	// the same thumbnail wait for one generation instead of each doing the work
+	mutex    sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// NewThumbnailService creates a thumbnail service allowing the given sizes (see ParseThumbnailSizes)
+func NewThumbnailService(s3Service S3ServiceInterface, store ThumbnailStore, sizes []int) *ThumbnailService {
+	if len(sizes) == 0 {
+		sizes = DefaultThumbnailSizes
+	}
+	return &ThumbnailService{
+		s3Service: s3Service,
+		store:     store,
+		sizes:     sizes,
+		inflight:  make(map[string]chan struct{}),
+	}
+}
+
+// Sizes returns the allowed thumbnail sizes, smallest first
+func (s *ThumbnailService) Sizes() []int {
+	return s.sizes
+}
+
+// AllowsSize reports whether thumbnails of this size may be requested
+func (s *ThumbnailService) AllowsSize(size int) bool {
+	for _, allowed := range s.sizes {
+		if allowed == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Supports reports whether thumbnails can be made from the file
+func (s *ThumbnailService) Supports(file *models.File) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(file.MimeType, ";", 2)[0]))
+	return thumbnailSourceTypes[mediaType] && file.Hash != "" && file.S3Key != "" && file.Size <= maxThumbnailSourceSize
+}
+
+// Get returns the file's thumbnail at the given size, generating it if this is the first request
+func (s *ThumbnailService) Get(ctx context.Context, file *models.File, size int) (*models.Thumbnail, error) {
+	if !s.AllowsSize(size) {
+		return nil, fmt.Errorf("%w: %d (allowed: %s)", ErrThumbnailSizeNotAllowed, size, formatSizes(s.sizes))
+	}
+	if !s.Supports(file) {
+		return nil, ErrThumbnailUnsupported
+	}
+
+	thumb, err := s.store.GetThumbnail(file.Hash, size)
+	if err != nil || thumb != nil {
+		return thumb, err
+	}
+
+	return s.generateOnce(ctx, file, size)
+}
+
+// Open streams a thumbnail's content from S3
+func (s *ThumbnailService) Open(ctx context.Context, thumb *models.Thumbnail) (io.ReadCloser, error) {
+	return s.s3Service.DownloadFile(ctx, thumb.S3Key)
+}
+
+// DeleteForHash removes every thumbnail of some content, once no file references it any more
+func (s *ThumbnailService) DeleteForHash(ctx context.Context, hash string) {
+	keys, err := s.store.DeleteByHash(hash)
+	if err != nil {
+		log.Printf("WARNING: Failed to delete thumbnails of %s: %v", hash, err)
+		return
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s3CleanupTimeout)
+	defer cancel()
+	for _, key := range keys {
+		if err := s.s3Service.DeleteFile(cleanupCtx, key); err != nil {
+			log.Printf("WARNING: Failed to delete thumbnail object %s: %v", key, err)
+		}
+	}
+}
+
+// generateOnce generates a thumbnail unless another request is already doing so, in which case
+// it waits for that one and returns its result
+func (s *ThumbnailService) generateOnce(ctx context.Context, file *models.File, size int) (*models.Thumbnail, error) {
+	key := fmt.Sprintf("%s/%d", file.Hash, size)
+
+	s.mutex.Lock()
+	if wait, busy := s.inflight[key]; busy {
+		s.mutex.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		thumb, err := s.store.GetThumbnail(file.Hash, size)
+		if err != nil || thumb != nil {
+			return thumb, err
+		}
+		return nil, fmt.Errorf("failed to generate thumbnail")
+	}
+	done := make(chan struct{})
+	s.inflight[key] = done
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.inflight, key)
+		s.mutex.Unlock()
+		close(done)
+	}()
+
+	return s.generate(ctx, file, size)
+}
+
+// generate downloads the source image, scales it and stores the result
+func (s *ThumbnailService) generate(ctx context.Context, file *models.File, size int) (*models.Thumbnail, error) {
+	body, err := s.s3Service.DownloadFile(ctx, file.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(body, maxThumbnailSourceSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(content) > maxThumbnailSourceSize {
+		return nil, ErrThumbnailUnsupported
+	}
+
+	encoded, contentType, bounds, err := renderThumbnail(content, size)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	thumb := &models.Thumbnail{
+		Hash:        file.Hash,
+		Size:        size,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		S3Key:       fmt.Sprintf("%s%s/%d%s", ThumbnailKeyPrefix, file.Hash, size, ext),
+		ContentType: contentType,
+		ByteSize:    int64(len(encoded)),
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.s3Service.UploadObject(ctx, thumb.S3Key, bytes.NewReader(encoded), contentType); err != nil {
+		return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	if err := s.store.CreateThumbnail(thumb); err != nil {
+		return nil, err
+	}
+	return thumb, nil
+}
+
+// renderThumbnail decodes an image and re-encodes it scaled to fit in a size x size box. Images
+// with transparency become PNGs, everything else a JPEG. Content that can't be decoded, or
+// whose dimensions are implausibly large, gives ErrThumbnailUnsupported.
+func renderThumbnail(content []byte, size int) ([]byte, string, image.Rectangle, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", image.Rectangle{}, fmt.Errorf("%w: %v", ErrThumbnailUnsupported, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxThumbnailSourcePixels {
+		return nil, "", image.Rectangle{}, fmt.Errorf("%w: image is %dx%d pixels", ErrThumbnailUnsupported, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", image.Rectangle{}, fmt.Errorf("%w: %v", ErrThumbnailUnsupported, err)
+	}
+
+	scaled := scaleToFit(img, size)
+
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+	if scaled.Opaque() {
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: thumbnailJPEGQuality})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buf, scaled)
+	}
+	if err != nil {
+		return nil, "", image.Rectangle{}, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), contentType, scaled.Bounds(), nil
+}
+
+// scaleToFit shrinks an image to fit in a size x size box, keeping its aspect ratio, by
+// averaging the source pixels that fall into each target pixel. Smaller images keep their size.
+func scaleToFit(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	targetWidth, targetHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			targetWidth = size
+			targetHeight = max(1, (height*size+width/2)/width)
+		} else {
+			targetHeight = size
+			targetWidth = max(1, (width*size+height/2)/height)
+		}
+	}
+
+	// Premultiplied 16-bit channel sums per target pixel
+	type cell struct{ r, g, b, a, n uint64 }
+	cells := make([]cell, targetWidth*targetHeight)
+	for y := 0; y < height; y++ {
+		ty := y * targetHeight / height
+		for x := 0; x < width; x++ {
+			tx := x * targetWidth / width
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			c := &cells[ty*targetWidth+tx]
+			c.r += uint64(r)
+			c.g += uint64(g)
+			c.b += uint64(b)
+			c.a += uint64(a)
+			c.n++
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for i, c := range cells {
+		if c.n == 0 {
+			continue
+		}
+		offset := i * 4
+		out.Pix[offset] = uint8(c.r / c.n >> 8)
+		out.Pix[offset+1] = uint8(c.g / c.n >> 8)
+		out.Pix[offset+2] = uint8(c.b / c.n >> 8)
+		out.Pix[offset+3] = uint8(c.a / c.n >> 8)
+	}
+	return out
+}
+
+// ThumbnailETag returns the entity tag of a thumbnail; like the content it's made from, a
+// thumbnail never changes once generated
+func ThumbnailETag(thumb *models.Thumbnail) string {
+	return fmt.Sprintf(`"%s-%d"`, thumb.Hash, thumb.Size)
+}
+
+// ThumbnailNotModified reports whether the request's cached copy of the thumbnail is current
+func ThumbnailNotModified(r *http.Request, thumb *models.Thumbnail) bool {
+	inm := r.Header.Get("If-None-Match")
+	return inm != "" && etagListMatches(inm, ThumbnailETag(thumb))
+}
+
+// formatSizes lists sizes for error messages
+func formatSizes(sizes []int) string {
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = strconv.Itoa(size)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ThumbnailTask makes the smallest thumbnail of each image upload in the background, so file
+// lists have one to show straight away; larger sizes are made when first requested
+type ThumbnailTask struct {
+	thumbnails *ThumbnailService
+}
+
+// NewThumbnailTask creates the processing task that generates upload thumbnails
+func NewThumbnailTask(thumbnails *ThumbnailService) *ThumbnailTask {
+	return &ThumbnailTask{thumbnails: thumbnails}
+}
+
+// Name identifies the task in logs
+func (t *ThumbnailTask) Name() string {
+	return "thumbnail"
+}
+
+// Applies reports whether a thumbnail can be made from the file
+func (t *ThumbnailTask) Applies(file *models.File) bool {
+	return t.thumbnails.Supports(file)
+}
+
+// Run generates the smallest thumbnail. Images that can't be decoded are left without one
+// rather than failing the job, since retrying won't help.
+func (t *ThumbnailTask) Run(ctx context.Context, file *models.File) error {
+	_, err := t.thumbnails.Get(ctx, file, t.thumbnails.Sizes()[0])
+	if errors.Is(err, ErrThumbnailUnsupported) {
+		log.Printf("WARNING: Failed to generate thumbnail for file %s: %v", file.ID, err)
+		return nil
+	}
+	return err
+}
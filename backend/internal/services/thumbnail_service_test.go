@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"sync"
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thumbnailS3Stub serves and stores objects in memory, counting uploads
+type thumbnailS3Stub struct {
+	S3ServiceInterface
+	mutex   sync.Mutex
+	objects map[string][]byte
+	uploads int
+}
+
+func (s *thumbnailS3Stub) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return io.NopCloser(bytes.NewReader(s.objects[key])), nil
+}
+
+func (s *thumbnailS3Stub) UploadObject(ctx context.Context, key string, body io.Reader, contentType string) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[key] = content
+	s.uploads++
+	return nil
+}
+
+func (s *thumbnailS3Stub) DeleteFile(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// memoryThumbnailStore keeps thumbnail records in a map
+type memoryThumbnailStore struct {
+	mutex  sync.Mutex
+	thumbs map[string]*models.Thumbnail
+}
+
+func thumbKey(hash string, size int) string {
+	return fmt.Sprintf("%s/%d", hash, size)
+}
+
+func (s *memoryThumbnailStore) GetThumbnail(hash string, size int) (*models.Thumbnail, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.thumbs[thumbKey(hash, size)], nil
+}
+
+func (s *memoryThumbnailStore) CreateThumbnail(thumb *models.Thumbnail) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.thumbs[thumbKey(thumb.Hash, thumb.Size)]; !exists {
+		s.thumbs[thumbKey(thumb.Hash, thumb.Size)] = thumb
+	}
+	return nil
+}
+
+func (s *memoryThumbnailStore) DeleteByHash(hash string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var keys []string
+	for key, thumb := range s.thumbs {
+		if thumb.Hash == hash {
+			keys = append(keys, thumb.S3Key)
+			delete(s.thumbs, key)
+		}
+	}
+	return keys, nil
+}
+
+func encodeTestPNG(t *testing.T, width, height int, fill color.Color) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func newThumbnailFixture(t *testing.T, content []byte) (*ThumbnailService, *thumbnailS3Stub, *memoryThumbnailStore, *models.File) {
+	file := &models.File{
+		ID:       uuid.New(),
+		Hash:     "abc123",
+		S3Key:    "files/abc123",
+		MimeType: "image/png",
+		Size:     int64(len(content)),
+	}
+	s3Stub := &thumbnailS3Stub{objects: map[string][]byte{file.S3Key: content}}
+	store := &memoryThumbnailStore{thumbs: make(map[string]*models.Thumbnail)}
+	return NewThumbnailService(s3Stub, store, []int{128, 256}), s3Stub, store, file
+}
+
+func TestParseThumbnailSizes(t *testing.T) {
+	sizes, err := ParseThumbnailSizes(" 512, 128,256,128 ")
+	require.NoError(t, err)
+	assert.Equal(t, []int{128, 256, 512}, sizes)
+
+	sizes, err = ParseThumbnailSizes("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultThumbnailSizes, sizes)
+
+	for _, invalid := range []string{"big", "0", "8", "4096", "128,-1"} {
+		_, err := ParseThumbnailSizes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestScaleToFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		size          int
+		wantW, wantH  int
+	}{
+		{"landscape", 1000, 500, 256, 256, 128},
+		{"portrait", 300, 900, 128, 43, 128},
+		{"square", 640, 640, 128, 128, 128},
+		{"smaller than the size is not enlarged", 100, 60, 256, 100, 60},
+		{"very thin keeps one pixel", 5000, 2, 128, 128, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+			bounds := scaleToFit(img, tt.size).Bounds()
+			assert.Equal(t, tt.wantW, bounds.Dx())
+			assert.Equal(t, tt.wantH, bounds.Dy())
+		})
+	}
+}
+
+func TestScaleToFit_AveragesPixels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x%2 == 0 {
+				img.Set(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+
+	out := scaleToFit(img, 2)
+	r, g, b, a := out.At(0, 0).RGBA()
+	assert.InDelta(t, 0x7f, r>>8, 1)
+	assert.InDelta(t, 0x7f, g>>8, 1)
+	assert.InDelta(t, 0x7f, b>>8, 1)
+	assert.Equal(t, uint32(0xff), a>>8)
+}
+
+func TestThumbnailService_GeneratesOnceAndCaches(t *testing.T) {
+	service, s3Stub, _, file := newThumbnailFixture(t, encodeTestPNG(t, 800, 400, color.RGBA{200, 10, 10, 255}))
+
+	thumb, err := service.Get(context.Background(), file, 256)
+	require.NoError(t, err)
+	assert.Equal(t, 256, thumb.Width)
+	assert.Equal(t, 128, thumb.Height)
+	assert.Equal(t, "image/jpeg", thumb.ContentType)
+	assert.Equal(t, "thumbnails/abc123/256.jpg", thumb.S3Key)
+	assert.Equal(t, int64(len(s3Stub.objects[thumb.S3Key])), thumb.ByteSize)
+
+	again, err := service.Get(context.Background(), file, 256)
+	require.NoError(t, err)
+	assert.Equal(t, thumb, again)
+	assert.Equal(t, 1, s3Stub.uploads)
+
+	// Each size is generated separately
+	_, err = service.Get(context.Background(), file, 128)
+	require.NoError(t, err)
+	assert.Equal(t, 2, s3Stub.uploads)
+}
+
+func TestThumbnailService_ConcurrentRequestsGenerateOnce(t *testing.T) {
+	service, s3Stub, _, file := newThumbnailFixture(t, encodeTestPNG(t, 600, 600, color.RGBA{0, 0, 255, 255}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.Get(context.Background(), file, 128)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, s3Stub.uploads)
+}
+
+func TestThumbnailService_TransparentImagesStayPNG(t *testing.T) {
+	service, _, _, file := newThumbnailFixture(t, encodeTestPNG(t, 300, 300, color.NRGBA{0, 255, 0, 100}))
+
+	thumb, err := service.Get(context.Background(), file, 128)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", thumb.ContentType)
+	assert.Equal(t, "thumbnails/abc123/128.png", thumb.S3Key)
+}
+
+func TestThumbnailService_RejectsSizesNotConfigured(t *testing.T) {
+	service, s3Stub, _, file := newThumbnailFixture(t, encodeTestPNG(t, 50, 50, color.White))
+
+	_, err := service.Get(context.Background(), file, 512)
+	assert.ErrorIs(t, err, ErrThumbnailSizeNotAllowed)
+	assert.Equal(t, 0, s3Stub.uploads)
+}
+
+func TestThumbnailService_UnsupportedFiles(t *testing.T) {
+	service, s3Stub, _, file := newThumbnailFixture(t, []byte("%PDF-1.4\n"))
+
+	file.MimeType = "application/pdf"
+	_, err := service.Get(context.Background(), file, 128)
+	assert.ErrorIs(t, err, ErrThumbnailUnsupported)
+
+	// A file claiming to be an image that doesn't decode
+	file.MimeType = "image/png"
+	_, err = service.Get(context.Background(), file, 128)
+	assert.ErrorIs(t, err, ErrThumbnailUnsupported)
+	assert.Equal(t, 0, s3Stub.uploads)
+}
+
+func TestThumbnailService_DeleteForHash(t *testing.T) {
+	service, s3Stub, store, file := newThumbnailFixture(t, encodeTestPNG(t, 400, 400, color.Black))
+
+	_, err := service.Get(context.Background(), file, 128)
+	require.NoError(t, err)
+	_, err = service.Get(context.Background(), file, 256)
+	require.NoError(t, err)
+
+	service.DeleteForHash(context.Background(), file.Hash)
+	assert.Empty(t, store.thumbs)
+	assert.Len(t, s3Stub.objects, 1) // only the source image remains
+}
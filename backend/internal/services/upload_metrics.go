@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"filevault/internal/repositories"
+)
+
+// Outcomes of an upload attempt recorded in the upload metrics: success or why it failed
+const (
+	UploadOutcomeSuccess         = "success"
+	UploadFailureUploadsDisabled = "uploads_disabled"
+	UploadFailureTooLarge        = "too_large"
+	UploadFailureQuotaExceeded   = "quota_exceeded"
+	UploadFailureMimeRejected    = "mime_rejected"
+	UploadFailureArchiveRejected = "archive_rejected"
+	UploadFailureReadError       = "read_error"
+	UploadFailureStorageError    = "storage_error"
+	UploadFailureDatabaseError   = "database_error"
+	UploadFailureOther           = "other"
+)
+
+// uploadFailure tags an upload error with the reason it is counted under. Its message and
+// wrapped error are those of the original error, so callers see no difference.
+type uploadFailure struct {
+	reason string
+	err    error
+}
+
+func (f *uploadFailure) Error() string { return f.err.Error() }
+
+func (f *uploadFailure) Unwrap() error { return f.err }
+
+// failUpload tags err with the failure reason it is recorded under
+func failUpload(reason string, err error) error {
+	return &uploadFailure{reason: reason, err: err}
+}
+
+// UploadFailureReason classifies an upload error for the upload metrics
+func UploadFailureReason(err error) string {
+	var failure *uploadFailure
+	switch {
+	case errors.As(err, &failure):
+		return failure.reason
+	case errors.Is(err, ErrUploadsDisabled):
+		return UploadFailureUploadsDisabled
+	case errors.Is(err, ErrQuotaExceeded):
+		return UploadFailureQuotaExceeded
+	default:
+		return UploadFailureOther
+	}
+}
+
+// SetUploadMetrics makes uploads count their outcomes in repo
+func (s *FileService) SetUploadMetrics(repo repositories.UploadMetricsRepositoryInterface) {
+	s.uploadMetricsRepo = repo
+}
+
+// recordUploadOutcome counts an upload attempt as a success (nil err) or under its failure
+// reason. Metrics are best effort and never fail the upload.
+func (s *FileService) recordUploadOutcome(err error) {
+	if s.uploadMetricsRepo == nil {
+		return
+	}
+
+	outcome := UploadOutcomeSuccess
+	if err != nil {
+		outcome = UploadFailureReason(err)
+	}
+	if recordErr := s.uploadMetricsRepo.Increment(outcome); recordErr != nil {
+		log.Printf("WARNING: Failed to record upload outcome %s: %v", outcome, recordErr)
+	}
+}
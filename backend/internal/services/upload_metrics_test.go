@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"filevault/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// countingUploadMetrics counts recorded upload outcomes in memory
+type countingUploadMetrics map[string]int
+
+func (m countingUploadMetrics) Increment(outcome string) error {
+	m[outcome]++
+	return nil
+}
+
+func TestFileService_UploadFile_RecordsOutcomes(t *testing.T) {
+	mockFileRepo := new(MockFileRepository)
+	mockHashRepo := new(MockFileHashRepository)
+	service := NewFileService(mockFileRepo, mockHashRepo, nil, nil, nil, NewMimeValidationService(), nil, nil)
+	metrics := countingUploadMetrics{}
+	service.SetUploadMetrics(metrics)
+
+	file, header, hash := newUploadFixture("notes.txt", []byte("counted notes"))
+	mockHashRepo.On("GetByHash", hash).Return(&models.FileHash{Hash: hash, S3Key: "files/existing"}, nil)
+	mockFileRepo.On("GetByHash", hash).Return([]*models.File{}, nil)
+	mockFileRepo.On("Create", mock.AnythingOfType("*models.File")).Return(nil)
+	_, err := service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.NoError(t, err)
+
+	file, header, _ = newUploadFixture("huge.bin", []byte("pretend this is big"))
+	header.Size = 200 * 1024 * 1024
+	_, err = service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file too large", "tagging must not change the error message")
+
+	file, header, _ = newUploadFixture("fake.png", []byte("definitely not a png"))
+	header.Header.Set("Content-Type", "image/png")
+	_, err = service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	require.Error(t, err)
+
+	service.SetQuotaChecker(quotaCheckerFunc(func(uuid.UUID, int64) error {
+		return fmt.Errorf("%w: 10 bytes used", ErrQuotaExceeded)
+	}))
+	file, header, _ = newUploadFixture("notes.txt", []byte("over quota"))
+	_, err = service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	service.SetUploadGate(staticUploadGate(false))
+	file, header, _ = newUploadFixture("notes.txt", []byte("paused"))
+	_, err = service.UploadFile(context.Background(), file, header, uuid.New(), nil)
+	assert.ErrorIs(t, err, ErrUploadsDisabled)
+
+	assert.Equal(t, countingUploadMetrics{
+		UploadOutcomeSuccess:         1,
+		UploadFailureTooLarge:        1,
+		UploadFailureMimeRejected:    1,
+		UploadFailureQuotaExceeded:   1,
+		UploadFailureUploadsDisabled: 1,
+	}, metrics)
+}
+
+func TestUploadFailureReason(t *testing.T) {
+	quota := fmt.Errorf("%w: 10 bytes used", ErrQuotaExceeded)
+	storage := failUpload(UploadFailureStorageError, errors.New("failed to upload file to S3: timeout"))
+
+	assert.Equal(t, UploadFailureQuotaExceeded, UploadFailureReason(quota))
+	assert.Equal(t, UploadFailureStorageError, UploadFailureReason(storage))
+	assert.Equal(t, UploadFailureStorageError, UploadFailureReason(fmt.Errorf("batch: %w", storage)))
+	assert.Equal(t, UploadFailureOther, UploadFailureReason(errors.New("unexpected")))
+}
@@ -2,18 +2,41 @@ package services
 
 import (
 	"filevault/internal/websocket"
+	"fmt"
 	"log"
+
+	"github.com/google/uuid"
 )
 
 // WebSocketService handles real-time communication
 type WebSocketService struct {
-	hub *websocket.Hub
+	hub                 *websocket.Hub
+	notificationService *NotificationService
 }
 
-// NewWebSocketService creates a new WebSocket service
-func NewWebSocketService(hub *websocket.Hub) *WebSocketService {
+// NewWebSocketService creates a new WebSocket service. When notificationService is set,
+// user-facing notifications are also stored so offline users see them on next login.
+func NewWebSocketService(hub *websocket.Hub, notificationService *NotificationService) *WebSocketService {
 	return &WebSocketService{
-		hub: hub,
+		hub:                 hub,
+		notificationService: notificationService,
+	}
+}
+
+// persistNotification stores a notification for a user; failures are logged, not returned
+func (s *WebSocketService) persistNotification(userID, notificationType, title, message string) {
+	if s.notificationService == nil {
+		return
+	}
+
+	parsedUserID, err := uuid.Parse(userID)
+	if err != nil {
+		log.Printf("Failed to store notification: invalid user ID %s", userID)
+		return
+	}
+
+	if _, err := s.notificationService.Create(parsedUserID, notificationType, title, message); err != nil {
+		log.Printf("Failed to store notification for user %s: %v", userID, err)
 	}
 }
 
@@ -32,7 +55,7 @@ func (s *WebSocketService) BroadcastFileUploadProgress(userID, fileID, fileName
 
 // BroadcastFileUploadComplete broadcasts file upload completion to user
 func (s *WebSocketService) BroadcastFileUploadComplete(userID, fileID, fileName string, fileSize int64, isDuplicate bool) {
-	message := websocket.NewFileUploadCompleteMessage(fileID, fileName, fileSize, false) // Always false since we removed isDuplicate concept
+	message := websocket.NewFileUploadCompleteMessage(fileID, fileName, fileSize, isDuplicate)
 	s.hub.BroadcastToUser(userID, message)
 	log.Printf("Broadcasted file upload complete: UserID=%s, FileID=%s, FileName=%s", userID, fileID, fileName)
 }
@@ -44,6 +67,13 @@ func (s *WebSocketService) BroadcastFileUploadError(userID, fileID, fileName, er
 	log.Printf("Broadcasted file upload error: UserID=%s, FileID=%s, Error=%s", userID, fileID, errorMsg)
 }
 
+// BroadcastFileProcessed tells the uploader that background processing of a file has finished
+func (s *WebSocketService) BroadcastFileProcessed(userID, fileID, fileName, status string) {
+	message := websocket.NewFileProcessedMessage(fileID, fileName, status)
+	s.hub.BroadcastToUser(userID, message)
+	log.Printf("Broadcasted file processed: UserID=%s, FileID=%s, Status=%s", userID, fileID, status)
+}
+
 // BroadcastFileDeleted broadcasts file deletion to user
 func (s *WebSocketService) BroadcastFileDeleted(userID, fileID, fileName string) {
 	message := websocket.NewFileDeletedMessage(fileID, fileName)
@@ -55,9 +85,29 @@ func (s *WebSocketService) BroadcastFileDeleted(userID, fileID, fileName string)
 func (s *WebSocketService) BroadcastFileSharedWithUser(userID, fromUsername, fileName, shareID string) {
 	message := websocket.NewFileSharedWithUserMessage(fromUsername, fileName, shareID)
 	s.hub.BroadcastToUser(userID, message)
+	s.persistNotification(userID, websocket.EventTypeFileSharedWithUser, "File shared with you",
+		fmt.Sprintf("%s shared \"%s\" with you", fromUsername, fileName))
 	log.Printf("Broadcasted file shared: UserID=%s, From=%s, FileName=%s, ShareID=%s", userID, fromUsername, fileName, shareID)
 }
 
+// BroadcastFolderSharedWithUser broadcasts folder shared notification to user
+func (s *WebSocketService) BroadcastFolderSharedWithUser(userID, fromUsername, folderName, shareID string) {
+	message := websocket.NewFolderSharedWithUserMessage(fromUsername, folderName, shareID)
+	s.hub.BroadcastToUser(userID, message)
+	s.persistNotification(userID, websocket.EventTypeFolderSharedWithUser, "Folder shared with you",
+		fmt.Sprintf("%s shared the folder \"%s\" with you", fromUsername, folderName))
+	log.Printf("Broadcasted folder shared: UserID=%s, From=%s, FolderName=%s, ShareID=%s", userID, fromUsername, folderName, shareID)
+}
+
+// BroadcastFileCommentAdded notifies a file's owner of a new comment on it
+func (s *WebSocketService) BroadcastFileCommentAdded(ownerID, fileID, fileName, commentID, authorUsername, body string) {
+	message := websocket.NewFileCommentAddedMessage(fileID, fileName, commentID, authorUsername, body)
+	s.hub.BroadcastToUser(ownerID, message)
+	s.persistNotification(ownerID, websocket.EventTypeFileCommentAdded, "New comment",
+		fmt.Sprintf("%s commented on \"%s\"", authorUsername, fileName))
+	log.Printf("Broadcasted file comment: OwnerID=%s, FileID=%s, CommentID=%s", ownerID, fileID, commentID)
+}
+
 // BroadcastFileShared broadcasts file sharing to user
 func (s *WebSocketService) BroadcastFileShared(userID, fileID, fileName, shareID, shareURL, expiresAt string) {
 	message := websocket.NewFileSharedMessage(fileID, fileName, shareID, shareURL, expiresAt)
@@ -72,6 +122,18 @@ func (s *WebSocketService) BroadcastShareDeleted(userID, shareID, fileID, fileNa
 	log.Printf("Broadcasted share deleted: UserID=%s, ShareID=%s", userID, shareID)
 }
 
+// BroadcastShareUnavailable broadcasts that a share can no longer be downloaded to its owner
+func (s *WebSocketService) BroadcastShareUnavailable(userID, shareID, fileID, fileName, reason string) {
+	message := websocket.NewShareUnavailableMessage(shareID, fileID, fileName, reason)
+	s.hub.BroadcastToUser(userID, message)
+	notificationMessage := fmt.Sprintf("The share link for \"%s\" has expired", fileName)
+	if reason == ShareUnavailableReasonDownloadLimit {
+		notificationMessage = fmt.Sprintf("The share link for \"%s\" reached its download limit", fileName)
+	}
+	s.persistNotification(userID, websocket.EventTypeShareUnavailable, "Share link no longer available", notificationMessage)
+	log.Printf("Broadcasted share unavailable: UserID=%s, ShareID=%s, Reason=%s", userID, shareID, reason)
+}
+
 // BroadcastSystemStatsUpdate broadcasts system stats update to all admins
 func (s *WebSocketService) BroadcastSystemStatsUpdate(stats websocket.SystemStatsUpdateData) {
 	message := websocket.NewSystemStatsUpdateMessage(stats)
@@ -90,6 +152,7 @@ func (s *WebSocketService) BroadcastUserStatsUpdate(userID string, totalFiles in
 func (s *WebSocketService) BroadcastNotification(userID, notificationType, title, message string, duration int) {
 	wsMessage := websocket.NewNotificationMessage(notificationType, title, message, duration)
 	s.hub.BroadcastToUser(userID, wsMessage)
+	s.persistNotification(userID, notificationType, title, message)
 	log.Printf("Broadcasted notification: UserID=%s, Type=%s, Title=%s", userID, notificationType, title)
 }
 
@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// Close reasons sent when a connection loses its authentication
+const (
+	closeReasonAuthFailed   = "authentication failed"
+	closeReasonTokenExpired = "token expired"
+)
+
+// Identity is the user a token authenticates and when the token expires
+type Identity struct {
+	UserID string
+	Role   string
+	// ExpiresAt is the zero time for tokens that don't expire
+	ExpiresAt time.Time
+}
+
+// Authenticator checks tokens sent over an open connection to refresh its authentication
+type Authenticator interface {
+	AuthenticateToken(token string) (Identity, error)
+}
+
+// authUpdate is the outcome of an auth_refresh message for writePump to act on
+type authUpdate struct {
+	reply     []byte
+	expiresAt time.Time
+	// failed closes the connection once the reply is sent
+	failed bool
+}
+
+// handleMessage acts on a message sent by the client. Only auth_refresh is understood; other
+// messages are ignored, as are refreshes on connections opened without an Authenticator.
+func (c *Client) handleMessage(data []byte) {
+	var message struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil || message.Type != EventTypeAuthRefresh || c.auth == nil {
+		return
+	}
+
+	// A malformed request leaves the token empty, which fails like any other bad token
+	var request AuthRefreshRequest
+	json.Unmarshal(message.Data, &request)
+	c.queueAuthUpdate(c.refreshAuth(request.Token))
+}
+
+// refreshAuth checks a fresh token for the connection. The token must belong to the user the
+// connection was opened for; the user's current role and the new expiry are taken from it.
+func (c *Client) refreshAuth(token string) authUpdate {
+	identity, err := c.auth.AuthenticateToken(token)
+	if err == nil && identity.UserID != c.userID {
+		err = errors.New("token belongs to another user")
+	}
+	if err != nil {
+		log.Printf("WebSocket token refresh failed for user %s: %v", c.userID, err)
+		reply, _ := json.Marshal(NewAuthRefreshMessage("failed", time.Time{}, "Invalid or expired token"))
+		return authUpdate{reply: reply, failed: true}
+	}
+
+	c.hub.mutex.Lock()
+	c.userRole = identity.Role
+	c.hub.mutex.Unlock()
+
+	reply, _ := json.Marshal(NewAuthRefreshMessage("ok", identity.ExpiresAt, ""))
+	return authUpdate{reply: reply, expiresAt: identity.ExpiresAt}
+}
+
+// queueAuthUpdate hands an update to writePump, replacing one it hasn't picked up yet so the
+// read pump never blocks on it
+func (c *Client) queueAuthUpdate(update authUpdate) {
+	for {
+		select {
+		case c.authUpdates <- update:
+			return
+		default:
+			select {
+			case <-c.authUpdates:
+			default:
+			}
+		}
+	}
+}
+
+// expiryTimer fires when a connection's token expires; it never fires for a zero expiry
+type expiryTimer struct {
+	timer *time.Timer
+}
+
+func newExpiryTimer(expiresAt time.Time) *expiryTimer {
+	t := &expiryTimer{}
+	t.reset(expiresAt)
+	return t
+}
+
+// reset moves the timer to a new expiry
+func (t *expiryTimer) reset(expiresAt time.Time) {
+	t.stop()
+	if !expiresAt.IsZero() {
+		t.timer = time.NewTimer(time.Until(expiresAt))
+	}
+}
+
+// expired returns the channel the expiry is delivered on, nil if there is none
+func (t *expiryTimer) expired() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+func (t *expiryTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticAuthenticator accepts the tokens it knows
+type staticAuthenticator map[string]Identity
+
+func (a staticAuthenticator) AuthenticateToken(token string) (Identity, error) {
+	identity, ok := a[token]
+	if !ok {
+		return Identity{}, errors.New("invalid token")
+	}
+	return identity, nil
+}
+
+// dialAuthenticated connects to a hub as identity and reads the connected status
+func dialAuthenticated(t *testing.T, hub *Hub, identity Identity, auth Authenticator) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeAuthenticatedWS(hub, w, r, identity, auth)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	assert.Equal(t, "connected", readStatus(t, conn).Status)
+	return conn
+}
+
+func sendAuthRefresh(t *testing.T, conn *websocket.Conn, token string) AuthRefreshData {
+	t.Helper()
+	require.NoError(t, conn.WriteJSON(Message{Type: EventTypeAuthRefresh, Data: AuthRefreshRequest{Token: token}}))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var message struct {
+		Type string          `json:"type"`
+		Data AuthRefreshData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(data, &message))
+	require.Equal(t, EventTypeAuthRefresh, message.Type)
+	return message.Data
+}
+
+func TestServeAuthenticatedWS_ClosesWhenTokenExpires(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	conn := dialAuthenticated(t, hub, Identity{UserID: "user-1", Role: "user", ExpiresAt: time.Now().Add(200 * time.Millisecond)}, staticAuthenticator{})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "expected a policy violation close frame, got %v", err)
+	assert.Contains(t, err.Error(), closeReasonTokenExpired)
+}
+
+func TestServeAuthenticatedWS_RefreshExtendsConnection(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	refreshedExpiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	auth := staticAuthenticator{"fresh": {UserID: "user-1", Role: "admin", ExpiresAt: refreshedExpiry}}
+	conn := dialAuthenticated(t, hub, Identity{UserID: "user-1", Role: "user", ExpiresAt: time.Now().Add(400 * time.Millisecond)}, auth)
+
+	result := sendAuthRefresh(t, conn, "fresh")
+	assert.Equal(t, "ok", result.Status)
+	assert.Equal(t, refreshedExpiry.UTC().Format(time.RFC3339), result.ExpiresAt)
+	assert.Equal(t, 1, hub.GetConnectedAdmins(), "the role is taken from the fresh token")
+
+	// The original expiry passes without the connection being closed
+	conn.SetReadDeadline(time.Now().Add(700 * time.Millisecond))
+	_, _, err := conn.ReadMessage()
+	var netErr interface{ Timeout() bool }
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout(), "expected the read to time out, got %v", err)
+}
+
+func TestServeAuthenticatedWS_FailedRefreshCloses(t *testing.T) {
+	for name, token := range map[string]string{
+		"invalid token":      "forged",
+		"another user's one": "other-user",
+	} {
+		t.Run(name, func(t *testing.T) {
+			hub := NewHub()
+			go hub.Run()
+
+			auth := staticAuthenticator{"other-user": {UserID: "user-2", Role: "user"}}
+			conn := dialAuthenticated(t, hub, Identity{UserID: "user-1", Role: "user", ExpiresAt: time.Now().Add(time.Hour)}, auth)
+
+			result := sendAuthRefresh(t, conn, token)
+			assert.Equal(t, "failed", result.Status)
+			assert.NotEmpty(t, result.Error)
+
+			_, _, err := conn.ReadMessage()
+			require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "expected a policy violation close frame, got %v", err)
+			assert.Contains(t, err.Error(), closeReasonAuthFailed)
+		})
+	}
+}
@@ -47,22 +47,26 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+		c.handleMessage(data)
 	}
 }
 
 // writePump pumps messages from the hub to the websocket connection
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
+	expiry := newExpiryTimer(c.expiresAt)
 	defer func() {
 		ticker.Stop()
+		expiry.stop()
 		c.conn.Close()
+		c.hub.writers.Done()
 	}()
 
 	for {
@@ -70,8 +74,12 @@ func (c *Client) writePump() {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				// The hub closed the channel
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// The hub closed the channel; during shutdown say why so clients reconnect
+				closeMessage := []byte{}
+				if c.hub.IsShuttingDown() {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
@@ -81,6 +89,24 @@ func (c *Client) writePump() {
 				return
 			}
 
+		case update := <-c.authUpdates:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, update.reply); err != nil {
+				return
+			}
+			if update.failed {
+				c.writeClose(closeReasonAuthFailed)
+				return
+			}
+			expiry.reset(update.expiresAt)
+
+		case <-expiry.expired():
+			// The client didn't send a fresh token in time
+			log.Printf("WebSocket token expired for user %s, closing connection", c.userID)
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.writeClose(closeReasonTokenExpired)
+			return
+
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -90,8 +116,23 @@ func (c *Client) writePump() {
 	}
 }
 
-// ServeWS handles websocket requests from the peer
+// writeClose sends a policy violation close frame telling the client why it lost its connection
+func (c *Client) writeClose(reason string) {
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
+
+// ServeWS handles websocket requests from the peer. The connection never expires and can't
+// refresh its authentication; see ServeAuthenticatedWS.
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID, userRole string) {
+	ServeAuthenticatedWS(hub, w, r, Identity{UserID: userID, Role: userRole}, nil)
+}
+
+// ServeAuthenticatedWS handles websocket requests from a peer authenticated as identity. The
+// connection is closed when identity's token expires unless the client sends an auth_refresh
+// message with a fresh token first, which auth checks; a token that fails the check closes the
+// connection straight away.
+func ServeAuthenticatedWS(hub *Hub, w http.ResponseWriter, r *http.Request, identity Identity, auth Authenticator) {
+	userID, userRole := identity.UserID, identity.Role
 	log.Printf("Attempting WebSocket upgrade for user: %s (role: %s)", userID, userRole)
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -103,13 +144,17 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID, userRole
 	log.Printf("WebSocket upgrade successful for user: %s", userID)
 
 	client := &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		userID:   userID,
-		userRole: userRole,
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		userID:      userID,
+		userRole:    userRole,
+		auth:        auth,
+		expiresAt:   identity.ExpiresAt,
+		authUpdates: make(chan authUpdate, 1),
 	}
 
+	hub.writers.Add(1)
 	client.hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -8,18 +8,25 @@ import (
 
 // Event types
 const (
-	EventTypeDownloadCountUpdate = "download_count_update"
-	EventTypeFileUploadProgress  = "file_upload_progress"
-	EventTypeFileUploadComplete  = "file_upload_complete"
-	EventTypeFileUploadError     = "file_upload_error"
-	EventTypeFileDeleted         = "file_deleted"
-	EventTypeFileShared          = "file_shared"
-	EventTypeFileSharedWithUser  = "file_shared_with_user"
-	EventTypeShareDeleted        = "share_deleted"
-	EventTypeSystemStatsUpdate   = "system_stats_update"
-	EventTypeUserStatsUpdate     = "user_stats_update"
-	EventTypeNotification        = "notification"
-	EventTypeConnectionStatus    = "connection_status"
+	EventTypeDownloadCountUpdate  = "download_count_update"
+	EventTypeFileUploadProgress   = "file_upload_progress"
+	EventTypeFileUploadComplete   = "file_upload_complete"
+	EventTypeFileUploadError      = "file_upload_error"
+	EventTypeFileDeleted          = "file_deleted"
+	EventTypeFileShared           = "file_shared"
+	EventTypeFileSharedWithUser   = "file_shared_with_user"
+	EventTypeFolderSharedWithUser = "folder_shared_with_user"
+	EventTypeShareDeleted         = "share_deleted"
+	EventTypeShareUnavailable     = "share_unavailable"
+	EventTypeSystemStatsUpdate    = "system_stats_update"
+	EventTypeUserStatsUpdate      = "user_stats_update"
+	EventTypeNotification         = "notification"
+	EventTypeConnectionStatus     = "connection_status"
+	EventTypeFileCommentAdded     = "file_comment_added"
+	EventTypeFileProcessed        = "file_processed"
+	// EventTypeAuthRefresh is sent by clients with a fresh token before theirs expires, and
+	// answered by the server with the outcome
+	EventTypeAuthRefresh = "auth_refresh"
 )
 
 // DownloadCountUpdateData represents download count update data
@@ -82,6 +89,32 @@ type FileSharedWithUserData struct {
 	Timestamp    string `json:"timestamp"`
 }
 
+// FolderSharedWithUserData represents folder shared with user data
+type FolderSharedWithUserData struct {
+	FromUsername string `json:"fromUsername"`
+	FolderName   string `json:"folderName"`
+	ShareID      string `json:"shareId"`
+	Timestamp    string `json:"timestamp"`
+}
+
+// FileProcessedData represents the end of background processing of an upload
+type FileProcessedData struct {
+	FileID    string `json:"fileId"`
+	FileName  string `json:"fileName"`
+	Status    string `json:"status"` // completed, failed
+	Timestamp string `json:"timestamp"`
+}
+
+// FileCommentAddedData represents a new comment on a file
+type FileCommentAddedData struct {
+	FileID         string `json:"fileId"`
+	FileName       string `json:"fileName"`
+	CommentID      string `json:"commentId"`
+	AuthorUsername string `json:"authorUsername"`
+	Body           string `json:"body"`
+	Timestamp      string `json:"timestamp"`
+}
+
 // ShareDeletedData represents share deletion data
 type ShareDeletedData struct {
 	ShareID   string `json:"shareId"`
@@ -90,6 +123,15 @@ type ShareDeletedData struct {
 	Timestamp string `json:"timestamp"`
 }
 
+// ShareUnavailableData represents data for a share that can no longer be downloaded
+type ShareUnavailableData struct {
+	ShareID   string `json:"shareId"`
+	FileID    string `json:"fileId"`
+	FileName  string `json:"fileName"`
+	Reason    string `json:"reason"` // expired, download_limit_reached
+	Timestamp string `json:"timestamp"`
+}
+
 // SystemStatsUpdateData represents system statistics update data
 type SystemStatsUpdateData struct {
 	TotalUsers        int     `json:"totalUsers"`
@@ -123,8 +165,34 @@ type NotificationData struct {
 
 // ConnectionStatusData represents connection status data
 type ConnectionStatusData struct {
-	Status    string `json:"status"` // connected, disconnected, reconnecting
+	Status    string `json:"status"` // connected, disconnecting, disconnected, reconnecting
 	Timestamp string `json:"timestamp"`
+	// ReconnectAfterMs asks the client to wait this long before reconnecting (sent with disconnecting)
+	ReconnectAfterMs int64 `json:"reconnectAfterMs,omitempty"`
+	// Backoff is how the client should pace reconnect attempts after an unexpected drop
+	Backoff *ReconnectBackoff `json:"backoff,omitempty"`
+}
+
+// AuthRefreshRequest is the data of an auth_refresh message sent by a client
+type AuthRefreshRequest struct {
+	Token string `json:"token"`
+}
+
+// AuthRefreshData represents the outcome of an auth_refresh request
+type AuthRefreshData struct {
+	Status    string `json:"status"`              // ok, failed
+	ExpiresAt string `json:"expiresAt,omitempty"` // when the new token expires, if it does
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ReconnectBackoff describes exponential backoff with jitter for client reconnects: attempt n
+// waits min(MaxDelayMs, InitialDelayMs * Multiplier^(n-1)), randomized by ±JitterRatio
+type ReconnectBackoff struct {
+	InitialDelayMs int64   `json:"initialDelayMs"`
+	MaxDelayMs     int64   `json:"maxDelayMs"`
+	Multiplier     float64 `json:"multiplier"`
+	JitterRatio    float64 `json:"jitterRatio"`
 }
 
 // Helper functions to create messages
@@ -224,6 +292,47 @@ func NewFileSharedWithUserMessage(fromUsername, fileName, shareID string) Messag
 	}
 }
 
+// NewFolderSharedWithUserMessage creates a folder shared with user message
+func NewFolderSharedWithUserMessage(fromUsername, folderName, shareID string) Message {
+	return Message{
+		Type: EventTypeFolderSharedWithUser,
+		Data: FolderSharedWithUserData{
+			FromUsername: fromUsername,
+			FolderName:   folderName,
+			ShareID:      shareID,
+			Timestamp:    time.Now().Format(time.RFC3339),
+		},
+	}
+}
+
+// NewFileProcessedMessage creates a file processed message
+func NewFileProcessedMessage(fileID, fileName, status string) Message {
+	return Message{
+		Type: EventTypeFileProcessed,
+		Data: FileProcessedData{
+			FileID:    fileID,
+			FileName:  fileName,
+			Status:    status,
+			Timestamp: time.Now().Format(time.RFC3339),
+		},
+	}
+}
+
+// NewFileCommentAddedMessage creates a file comment added message
+func NewFileCommentAddedMessage(fileID, fileName, commentID, authorUsername, body string) Message {
+	return Message{
+		Type: EventTypeFileCommentAdded,
+		Data: FileCommentAddedData{
+			FileID:         fileID,
+			FileName:       fileName,
+			CommentID:      commentID,
+			AuthorUsername: authorUsername,
+			Body:           body,
+			Timestamp:      time.Now().Format(time.RFC3339),
+		},
+	}
+}
+
 // NewShareDeletedMessage creates a share deleted message
 func NewShareDeletedMessage(shareID, fileID, fileName string) Message {
 	return Message{
@@ -237,6 +346,20 @@ func NewShareDeletedMessage(shareID, fileID, fileName string) Message {
 	}
 }
 
+// NewShareUnavailableMessage creates a share unavailable message
+func NewShareUnavailableMessage(shareID, fileID, fileName, reason string) Message {
+	return Message{
+		Type: EventTypeShareUnavailable,
+		Data: ShareUnavailableData{
+			ShareID:   shareID,
+			FileID:    fileID,
+			FileName:  fileName,
+			Reason:    reason,
+			Timestamp: time.Now().Format(time.RFC3339),
+		},
+	}
+}
+
 // NewSystemStatsUpdateMessage creates a system stats update message
 func NewSystemStatsUpdateMessage(stats SystemStatsUpdateData) Message {
 	stats.Timestamp = time.Now().Format(time.RFC3339)
@@ -284,3 +407,33 @@ func NewConnectionStatusMessage(status string) Message {
 		},
 	}
 }
+
+// NewAuthRefreshMessage creates an auth refresh result message. A zero expiresAt is left out.
+func NewAuthRefreshMessage(status string, expiresAt time.Time, errorMsg string) Message {
+	data := AuthRefreshData{
+		Status:    status,
+		Error:     errorMsg,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if !expiresAt.IsZero() {
+		data.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return Message{
+		Type: EventTypeAuthRefresh,
+		Data: data,
+	}
+}
+
+// NewReconnectHintMessage creates a connection status message carrying reconnect guidance.
+// A zero reconnectAfter leaves the delay to the backoff policy.
+func NewReconnectHintMessage(status string, reconnectAfter time.Duration, backoff ReconnectBackoff) Message {
+	return Message{
+		Type: EventTypeConnectionStatus,
+		Data: ConnectionStatusData{
+			Status:           status,
+			Timestamp:        time.Now().Format(time.RFC3339),
+			ReconnectAfterMs: reconnectAfter.Milliseconds(),
+			Backoff:          &backoff,
+		},
+	}
+}
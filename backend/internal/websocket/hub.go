@@ -1,13 +1,57 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// ReconnectPolicy is the reconnect guidance the hub hands to clients. Clients get the backoff
+// when they connect; on shutdown each one is told to come back after a random delay within
+// ShutdownSpread so a restart isn't followed by every client reconnecting at once.
+type ReconnectPolicy struct {
+	InitialDelay   time.Duration
+	MaxDelay       time.Duration
+	Multiplier     float64
+	JitterRatio    float64
+	ShutdownSpread time.Duration
+}
+
+// DefaultReconnectPolicy returns the policy used unless SetReconnectPolicy is called
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay:   time.Second,
+		MaxDelay:       30 * time.Second,
+		Multiplier:     2,
+		JitterRatio:    0.5,
+		ShutdownSpread: 10 * time.Second,
+	}
+}
+
+// backoff returns the policy in the form sent to clients
+func (p ReconnectPolicy) backoff() ReconnectBackoff {
+	return ReconnectBackoff{
+		InitialDelayMs: p.InitialDelay.Milliseconds(),
+		MaxDelayMs:     p.MaxDelay.Milliseconds(),
+		Multiplier:     p.Multiplier,
+		JitterRatio:    p.JitterRatio,
+	}
+}
+
+// shutdownDelay picks how long a client should wait before reconnecting after a shutdown
+func (p ReconnectPolicy) shutdownDelay() time.Duration {
+	if p.ShutdownSpread <= 0 {
+		return p.InitialDelay
+	}
+	return p.InitialDelay + time.Duration(rand.Int63n(int64(p.ShutdownSpread)+1))
+}
+
 // Hub maintains the set of active clients and broadcasts messages to the clients
 type Hub struct {
 	// Registered clients
@@ -24,6 +68,15 @@ type Hub struct {
 
 	// Mutex for thread safety
 	mutex sync.RWMutex
+
+	// Reconnect guidance sent to clients
+	reconnect ReconnectPolicy
+
+	// Set once Shutdown starts; new connections are turned away from then on
+	shuttingDown atomic.Bool
+
+	// Running write pumps, so Shutdown can wait for close frames to be written
+	writers sync.WaitGroup
 }
 
 // Client represents a websocket client
@@ -39,8 +92,17 @@ type Client struct {
 	// User ID for this client
 	userID string
 
-	// User role for this client
+	// User role for this client; updated under the hub mutex when the client refreshes its token
 	userRole string
+
+	// Checks tokens sent in auth_refresh messages; nil if the connection can't refresh
+	auth Authenticator
+
+	// When the connection's token expires; the zero time if it doesn't
+	expiresAt time.Time
+
+	// Outcomes of auth_refresh messages, handed from readPump to writePump
+	authUpdates chan authUpdate
 }
 
 // Message represents a websocket message
@@ -58,19 +120,39 @@ func NewHub() *Hub {
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		reconnect:  DefaultReconnectPolicy(),
 	}
 }
 
+// SetReconnectPolicy replaces the reconnect guidance sent to clients. Call it before Run.
+func (h *Hub) SetReconnectPolicy(policy ReconnectPolicy) {
+	h.reconnect = policy
+}
+
 // Run starts the hub
 func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
+			if h.shuttingDown.Load() {
+				// Tell late arrivals when to come back and close them straight away
+				h.sendDisconnecting(client)
+				close(client.send)
+				continue
+			}
 			h.mutex.Lock()
 			h.clients[client] = true
 			h.mutex.Unlock()
 			log.Printf("Client connected: %s (role: %s) - Total clients: %d", client.userID, client.userRole, len(h.clients))
 
+			// Let the client know how to back off if the connection drops
+			if data, err := json.Marshal(NewReconnectHintMessage("connected", 0, h.reconnect.backoff())); err == nil {
+				select {
+				case client.send <- data:
+				default:
+				}
+			}
+
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
@@ -95,6 +177,56 @@ func (h *Hub) Run() {
 	}
 }
 
+// Shutdown sends every client a "disconnecting" status with a staggered reconnect-after hint,
+// closes their connections with a service-restart close frame and waits until the close frames
+// have been written or ctx is done. Connections attempted during shutdown are turned away.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	if !h.shuttingDown.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	h.mutex.Lock()
+	count := len(h.clients)
+	for client := range h.clients {
+		h.sendDisconnecting(client)
+		close(client.send)
+		delete(h.clients, client)
+	}
+	h.mutex.Unlock()
+	log.Printf("WebSocket hub shutting down, closing %d client connection(s)", count)
+
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsShuttingDown reports whether Shutdown has been called
+func (h *Hub) IsShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// sendDisconnecting queues the shutdown notice for a client without blocking
+func (h *Hub) sendDisconnecting(client *Client) {
+	message := NewReconnectHintMessage("disconnecting", h.reconnect.shutdownDelay(), h.reconnect.backoff())
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+	}
+}
+
 // BroadcastToUser sends a message to a specific user
 func (h *Hub) BroadcastToUser(userID string, message Message) {
 	data, err := json.Marshal(message)
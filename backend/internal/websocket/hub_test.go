@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readStatus(t *testing.T, conn *websocket.Conn) ConnectionStatusData {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var message struct {
+		Type string               `json:"type"`
+		Data ConnectionStatusData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(data, &message))
+	require.Equal(t, EventTypeConnectionStatus, message.Type)
+	return message.Data
+}
+
+func TestHub_ShutdownSendsReconnectHints(t *testing.T) {
+	hub := NewHub()
+	policy := ReconnectPolicy{
+		InitialDelay:   500 * time.Millisecond,
+		MaxDelay:       10 * time.Second,
+		Multiplier:     2,
+		JitterRatio:    0.25,
+		ShutdownSpread: 3 * time.Second,
+	}
+	hub.SetReconnectPolicy(policy)
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWS(hub, w, r, "user-1", "user")
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	connected := readStatus(t, conn)
+	assert.Equal(t, "connected", connected.Status)
+	require.NotNil(t, connected.Backoff)
+	assert.Equal(t, int64(500), connected.Backoff.InitialDelayMs)
+	assert.Equal(t, int64(10000), connected.Backoff.MaxDelayMs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, hub.Shutdown(ctx))
+
+	disconnecting := readStatus(t, conn)
+	assert.Equal(t, "disconnecting", disconnecting.Status)
+	assert.GreaterOrEqual(t, disconnecting.ReconnectAfterMs, int64(500))
+	assert.LessOrEqual(t, disconnecting.ReconnectAfterMs, int64(3500))
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), "expected a service restart close frame, got %v", err)
+	assert.Equal(t, 0, hub.GetConnectedUsers())
+}
+
+func TestReconnectPolicy_ShutdownDelayStaysInWindow(t *testing.T) {
+	policy := DefaultReconnectPolicy()
+	for i := 0; i < 100; i++ {
+		delay := policy.shutdownDelay()
+		assert.GreaterOrEqual(t, delay, policy.InitialDelay)
+		assert.LessOrEqual(t, delay, policy.InitialDelay+policy.ShutdownSpread)
+	}
+}
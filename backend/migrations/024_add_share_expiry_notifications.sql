@@ -0,0 +1,8 @@
+-- Track which share lifecycle notifications have already been sent to the owner
+-- so the expiry job never notifies about the same share twice
+
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMP;
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS unavailable_notified_at TIMESTAMP;
+
+-- Partial index for the periodic scan of active shares that have an expiry date
+CREATE INDEX IF NOT EXISTS idx_file_shares_expires_at ON file_shares(expires_at) WHERE is_active = true AND expires_at IS NOT NULL;
@@ -0,0 +1,39 @@
+-- Enforce case-insensitive folder name uniqueness within a parent folder. The indexes only
+-- ignore case; the folder service also ignores accents when it checks a name before saving.
+
+-- Rename existing case-insensitive duplicates so the unique indexes can be built.
+-- The oldest folder keeps its name, later ones get a numeric suffix.
+DO $$
+DECLARE
+    renamed INTEGER;
+BEGIN
+    WITH duplicates AS (
+        SELECT id,
+               ROW_NUMBER() OVER (
+                   PARTITION BY owner_id, parent_id, lower(name)
+                   ORDER BY created_at, id
+               ) AS rn
+        FROM folders
+    )
+    UPDATE folders f
+    SET name = f.name || ' (' || d.rn || ')'
+    FROM duplicates d
+    WHERE f.id = d.id AND d.rn > 1;
+
+    GET DIAGNOSTICS renamed = ROW_COUNT;
+
+    -- Rebuild paths for renamed folders and their descendants
+    IF renamed > 0 THEN
+        UPDATE folders SET path = get_folder_path(id) WHERE path IS DISTINCT FROM get_folder_path(id);
+    END IF;
+END $$;
+
+-- Root folders have a NULL parent_id, which a plain unique index would treat as distinct,
+-- so root and nested folders get separate partial indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_unique_name_in_parent
+    ON folders(owner_id, parent_id, lower(name))
+    WHERE parent_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_unique_name_at_root
+    ON folders(owner_id, lower(name))
+    WHERE parent_id IS NULL;
@@ -0,0 +1,37 @@
+-- Add user folder sharing table
+-- Recipients get read access to every file in the folder (and its subfolders),
+-- including files added after the share was created
+CREATE TABLE IF NOT EXISTS user_folder_shares (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message TEXT,
+    is_read BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    -- Ensure a user can't share the same folder to the same user multiple times
+    UNIQUE(folder_id, to_user_id)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_folder_shares_to_user_id ON user_folder_shares(to_user_id);
+CREATE INDEX IF NOT EXISTS idx_user_folder_shares_from_user_id ON user_folder_shares(from_user_id);
+CREATE INDEX IF NOT EXISTS idx_user_folder_shares_folder_id ON user_folder_shares(folder_id);
+
+-- Add trigger to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_user_folder_shares_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Drop trigger if it exists, then create it
+DROP TRIGGER IF EXISTS trigger_update_user_folder_shares_updated_at ON user_folder_shares;
+CREATE TRIGGER trigger_update_user_folder_shares_updated_at
+    BEFORE UPDATE ON user_folder_shares
+    FOR EACH ROW
+    EXECUTE FUNCTION update_user_folder_shares_updated_at();
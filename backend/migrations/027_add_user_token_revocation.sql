@@ -0,0 +1,2 @@
+-- Allow revoking all tokens issued to a user before a point in time (e.g. after a password change)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_invalid_before TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+-- Free-text description/notes that users can attach to a file
+ALTER TABLE files ADD COLUMN IF NOT EXISTS description TEXT;
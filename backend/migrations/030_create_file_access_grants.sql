@@ -0,0 +1,14 @@
+-- Persistent per-file collaborator access. Grantees can view (and optionally download)
+-- the file through the normal authenticated endpoints but never modify or delete it
+CREATE TABLE IF NOT EXISTS file_access_grants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    grantee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    granted_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission VARCHAR(20) NOT NULL CHECK (permission IN ('view', 'download')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (file_id, grantee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_access_grants_grantee ON file_access_grants(grantee_id);
@@ -0,0 +1,2 @@
+-- Supports keyset pagination of a user's files ordered newest first by (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_files_uploader_created_id ON files(uploader_id, created_at DESC, id DESC);
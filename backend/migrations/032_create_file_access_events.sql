@@ -0,0 +1,12 @@
+-- Lightweight record of authenticated file reads (previews and downloads),
+-- used for each user's "recently accessed" list
+CREATE TABLE IF NOT EXISTS file_access_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    access_type VARCHAR(20) NOT NULL CHECK (access_type IN ('preview', 'download')),
+    accessed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_access_events_user_accessed ON file_access_events(user_id, accessed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_file_access_events_user_file ON file_access_events(user_id, file_id, accessed_at DESC);
@@ -0,0 +1,10 @@
+-- Runtime switches that admins can flip without a deploy
+CREATE TABLE IF NOT EXISTS system_settings (
+    key VARCHAR(100) PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+INSERT INTO system_settings (key, value) VALUES ('uploads_enabled', 'true')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,2 @@
+-- Optional per-share download speed cap in bytes per second; NULL streams at full speed
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS max_bandwidth_bps BIGINT;
@@ -0,0 +1,3 @@
+-- Files uploaded with deduplication turned off own a private S3 object that no other
+-- file record may reference
+ALTER TABLE files ADD COLUMN IF NOT EXISTS dedup_disabled BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Optional appearance for folders: a hex color (#rrggbb) and an icon name from the allowed set
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS color VARCHAR(7);
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS icon VARCHAR(32);
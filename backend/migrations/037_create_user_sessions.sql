@@ -0,0 +1,9 @@
+-- Last activity of each issued token (keyed by its jti claim), used to expire idle sessions
+CREATE TABLE IF NOT EXISTS user_sessions (
+    token_id VARCHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_last_seen ON user_sessions(user_id, last_seen_at);
@@ -0,0 +1,4 @@
+-- Perceptual hash (pHash) of image uploads, used to find visually similar images
+ALTER TABLE files ADD COLUMN IF NOT EXISTS perceptual_hash BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_files_perceptual_hash ON files(uploader_id) WHERE perceptual_hash IS NOT NULL;
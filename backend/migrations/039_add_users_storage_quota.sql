@@ -0,0 +1,2 @@
+-- Per-user storage quota override in MB; NULL falls back to the role default, negative is unlimited
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_quota_mb BIGINT;
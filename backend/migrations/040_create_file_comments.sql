@@ -0,0 +1,10 @@
+-- Comments left on a file by its owner and the users it is shared with
+CREATE TABLE IF NOT EXISTS file_comments (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_comments_file_created ON file_comments(file_id, created_at);
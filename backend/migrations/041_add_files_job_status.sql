@@ -0,0 +1,4 @@
+-- Background processing state of an upload: pending, processing, completed or failed
+ALTER TABLE files ADD COLUMN IF NOT EXISTS job_status VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS idx_files_job_status ON files(job_status) WHERE job_status IN ('pending', 'processing');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_files_mime_unchecked;
+ALTER TABLE files DROP COLUMN IF EXISTS mime_checked_at;
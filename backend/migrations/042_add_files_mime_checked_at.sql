@@ -0,0 +1,4 @@
+-- When the stored MIME type was last checked against the object's content by the admin re-detection job
+ALTER TABLE files ADD COLUMN IF NOT EXISTS mime_checked_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_files_mime_unchecked ON files(created_at) WHERE mime_checked_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_files_original_file_id;
+ALTER TABLE files DROP COLUMN IF EXISTS original_file_id;
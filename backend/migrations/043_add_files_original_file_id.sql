@@ -0,0 +1,21 @@
+-- The file whose stored content a deduplicated upload reuses. Deliberately not a foreign key:
+-- deleting an original repoints its copies, and a dangling id left by other deletions makes
+-- readers fall back to any remaining file with the same content.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS original_file_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_files_original_file_id ON files(original_file_id) WHERE original_file_id IS NOT NULL;
+
+-- Point existing copies at the earliest shared file with the same content, preferring the same uploader
+UPDATE files f
+SET original_file_id = (
+	SELECT o.id FROM files o
+	WHERE o.hash = f.hash AND NOT o.dedup_disabled AND (o.created_at, o.id) < (f.created_at, f.id)
+	ORDER BY (o.uploader_id = f.uploader_id) DESC, o.created_at, o.id
+	LIMIT 1
+)
+WHERE f.original_file_id IS NULL
+  AND NOT f.dedup_disabled
+  AND EXISTS (
+	SELECT 1 FROM files o
+	WHERE o.hash = f.hash AND NOT o.dedup_disabled AND (o.created_at, o.id) < (f.created_at, f.id)
+  );
@@ -0,0 +1,2 @@
+-- Who last renamed or re-described a file; updated_at records when
+ALTER TABLE files ADD COLUMN IF NOT EXISTS last_modified_by UUID REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- The thumbnail objects in S3 are left behind; the admin orphan purge removes them
+DROP TABLE IF EXISTS thumbnails;
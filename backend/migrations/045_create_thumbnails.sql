@@ -0,0 +1,13 @@
+-- Thumbnails generated from stored content, one row per content hash and size. Sizes are
+-- generated on first request, so most files only ever have the small one made at upload.
+CREATE TABLE IF NOT EXISTS thumbnails (
+    hash VARCHAR(64) NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    s3_key VARCHAR(500) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    byte_size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hash, size)
+);
@@ -0,0 +1,14 @@
+-- Hashes must be unique again, so per-user copies of content that is also stored for everyone, or
+-- stored by more than one user, lose their hash record. Their files keep working; the content is
+-- just no longer deduplicated against.
+DELETE FROM file_hashes o
+WHERE o.owner_id IS NOT NULL
+  AND EXISTS (
+	SELECT 1 FROM file_hashes s
+	WHERE s.hash = o.hash AND (s.owner_id IS NULL OR (s.created_at, s.id) < (o.created_at, o.id))
+  );
+
+DROP INDEX IF EXISTS idx_file_hashes_owner_hash;
+DROP INDEX IF EXISTS idx_file_hashes_shared_hash;
+ALTER TABLE file_hashes DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE file_hashes ADD CONSTRAINT file_hashes_hash_key UNIQUE (hash);
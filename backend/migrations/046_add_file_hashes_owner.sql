@@ -0,0 +1,7 @@
+-- With the per-user deduplication scope a file hash belongs to the user who uploaded it and
+-- only deduplicates their own uploads, so the same content may be stored once per user.
+-- Hashes without an owner are shared by everyone and stay unique per hash.
+ALTER TABLE file_hashes ADD COLUMN IF NOT EXISTS owner_id UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE file_hashes DROP CONSTRAINT IF EXISTS file_hashes_hash_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_hashes_shared_hash ON file_hashes(hash) WHERE owner_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_hashes_owner_hash ON file_hashes(owner_id, hash) WHERE owner_id IS NOT NULL;
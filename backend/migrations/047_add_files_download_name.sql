@@ -0,0 +1,2 @@
+-- Optional filename downloads are served under instead of original_name; NULL means original_name
+ALTER TABLE files ADD COLUMN IF NOT EXISTS download_name VARCHAR(255);
@@ -0,0 +1,2 @@
+-- Files marked public can be downloaded by anyone from /public/files/:id without a share link
+ALTER TABLE files ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
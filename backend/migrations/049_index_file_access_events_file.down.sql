@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_file_access_events_file_accessed;
@@ -0,0 +1,2 @@
+-- Lets the storage heatmap find each file's latest access without scanning every event
+CREATE INDEX IF NOT EXISTS idx_file_access_events_file_accessed ON file_access_events(file_id, accessed_at DESC);
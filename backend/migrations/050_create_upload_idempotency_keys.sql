@@ -0,0 +1,12 @@
+-- Idempotency-Key values sent with uploads and the file each one created, so a retried upload
+-- returns the original file instead of adding another record. Keys are scoped to the user and
+-- disappear with the file they point at.
+CREATE TABLE IF NOT EXISTS upload_idempotency_keys (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_idempotency_keys_file_id ON upload_idempotency_keys(file_id);
@@ -0,0 +1,3 @@
+-- Presigned links for shares with force_download always download; others open inline when the
+-- file's type may be previewed
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS force_download BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,7 @@
+-- Daily count of upload attempts by outcome: "success" or the reason the upload failed
+CREATE TABLE IF NOT EXISTS upload_metrics (
+    day DATE NOT NULL,
+    outcome VARCHAR(40) NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, outcome)
+);
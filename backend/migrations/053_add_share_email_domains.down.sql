@@ -0,0 +1,2 @@
+ALTER TABLE download_logs DROP COLUMN IF EXISTS email;
+ALTER TABLE file_shares DROP COLUMN IF EXISTS allowed_email_domains;
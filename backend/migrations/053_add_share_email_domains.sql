@@ -0,0 +1,6 @@
+-- Shares with allowed_email_domains can only be downloaded by viewers giving an email address at
+-- one of those domains; NULL leaves the share open to anyone with the link
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS allowed_email_domains TEXT[];
+
+-- Email address a viewer gave to download a domain-restricted share
+ALTER TABLE download_logs ADD COLUMN IF NOT EXISTS email VARCHAR(320);
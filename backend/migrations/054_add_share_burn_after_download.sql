@@ -0,0 +1,3 @@
+-- Shares with burn_after_download are deactivated, and their token replaced, by the same
+-- statement that counts their first download
+ALTER TABLE file_shares ADD COLUMN IF NOT EXISTS burn_after_download BOOLEAN NOT NULL DEFAULT FALSE;
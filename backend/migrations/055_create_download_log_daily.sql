@@ -0,0 +1,8 @@
+-- Per-share daily download counts for download_logs rows removed by the retention cleanup, so
+-- share statistics still include downloads older than the retention window
+CREATE TABLE IF NOT EXISTS download_log_daily (
+    share_id UUID NOT NULL REFERENCES file_shares(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (share_id, day)
+);
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS dedup_opt_out;
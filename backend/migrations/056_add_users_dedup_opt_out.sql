@@ -0,0 +1,3 @@
+-- Users with dedup_opt_out have every upload stored as a private object (files.dedup_disabled),
+-- so their content is never shared with, or matched against, other users' uploads
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dedup_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
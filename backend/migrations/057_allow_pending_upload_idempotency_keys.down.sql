@@ -0,0 +1,2 @@
+DELETE FROM upload_idempotency_keys WHERE file_id IS NULL;
+ALTER TABLE upload_idempotency_keys ALTER COLUMN file_id SET NOT NULL;
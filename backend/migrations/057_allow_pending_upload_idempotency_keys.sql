@@ -0,0 +1,3 @@
+-- An upload reserves its Idempotency-Key before it starts, with no file yet, so a retry that
+-- overlaps it waits for that upload instead of creating a second file
+ALTER TABLE upload_idempotency_keys ALTER COLUMN file_id DROP NOT NULL;
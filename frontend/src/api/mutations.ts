@@ -109,8 +109,8 @@ export const CREATE_FILE_SHARE = gql`
 `;
 
 export const UPDATE_FILE_SHARE = gql`
-  mutation UpdateFileShare($id: ID!, $isActive: Boolean, $expiresAt: String, $maxDownloads: Int) {
-    updateFileShare(id: $id, isActive: $isActive, expiresAt: $expiresAt, maxDownloads: $maxDownloads) {
+  mutation UpdateFileShare($shareId: ID!, $isActive: Boolean, $expiresAt: String, $maxDownloads: Int) {
+    updateFileShare(shareId: $shareId, isActive: $isActive, expiresAt: $expiresAt, maxDownloads: $maxDownloads) {
       id
       fileId
       shareToken
@@ -125,7 +125,7 @@ export const UPDATE_FILE_SHARE = gql`
 `;
 
 export const DELETE_FILE_SHARE = gql`
-  mutation DeleteFileShare($id: ID!) {
-    deleteFileShare(id: $id)
+  mutation DeleteFileShare($shareId: ID!) {
+    deleteFileShare(shareId: $shareId)
   }
 `;
@@ -103,10 +103,36 @@ const ShareModal: React.FC<ShareModalProps> = ({ file, isOpen, onClose }) => {
   const createPublicShare = async () => {
     setIsLoading(true);
     try {
+      // Public links only serve files marked public, so mark this one first
+      const token = localStorage.getItem('token');
+      const response = await fetch(process.env.REACT_APP_GRAPHQL_URL || 'http://localhost:8080/query', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': `Bearer ${token}`
+        },
+        body: JSON.stringify({
+          query: `
+            mutation SetFilePublic($id: ID!, $public: Boolean!) {
+              setFilePublic(id: $id, public: $public) {
+                id
+                isPublic
+              }
+            }
+          `,
+          variables: { id: file.id, public: true }
+        })
+      });
+
+      const result = await response.json();
+      if (result.errors || !result.data?.setFilePublic?.isPublic) {
+        throw new Error(result.errors?.[0]?.message || 'Failed to make file public');
+      }
+
       // Generate public share URL with proper filename headers
       // Use environment variable or fallback to current origin
       const baseUrl = process.env.REACT_APP_API_URL || window.location.origin;
-      const publicUrl = `${baseUrl}/public/${file.id}`;
+      const publicUrl = `${baseUrl}/public/files/${file.id}`;
       
       setPublicShareUrl(publicUrl);
       addNotification({
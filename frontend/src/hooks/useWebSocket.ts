@@ -16,6 +16,28 @@ export interface WebSocketHook {
   error: string | null;
 }
 
+// Reconnect pacing sent by the server in connection_status messages
+interface ReconnectBackoff {
+  initialDelayMs: number;
+  maxDelayMs: number;
+  multiplier: number;
+  jitterRatio: number;
+}
+
+const defaultBackoff: ReconnectBackoff = {
+  initialDelayMs: 1000,
+  maxDelayMs: 30000,
+  multiplier: 2,
+  jitterRatio: 0.5,
+};
+
+// Exponential backoff with jitter so clients don't all reconnect at the same moment
+const backoffDelay = (backoff: ReconnectBackoff, attempt: number): number => {
+  const base = Math.min(backoff.maxDelayMs, backoff.initialDelayMs * Math.pow(backoff.multiplier, attempt - 1));
+  const jitter = base * backoff.jitterRatio * (Math.random() * 2 - 1);
+  return Math.max(0, Math.round(base + jitter));
+};
+
 export const useWebSocket = (url: string): WebSocketHook => {
   const [isConnected, setIsConnected] = useState(false);
   const [connectionStatus, setConnectionStatus] = useState<'connecting' | 'connected' | 'disconnected' | 'error'>('disconnected');
@@ -25,7 +47,8 @@ export const useWebSocket = (url: string): WebSocketHook => {
   const reconnectTimeoutRef = useRef<NodeJS.Timeout | null>(null);
   const reconnectAttempts = useRef(0);
   const maxReconnectAttempts = 5;
-  const reconnectDelay = 3000; // 3 seconds
+  const backoffRef = useRef<ReconnectBackoff>(defaultBackoff);
+  const reconnectAfterRef = useRef<number | null>(null);
 
   const connect = useCallback(() => {
     if (ws.current?.readyState === WebSocket.OPEN) {
@@ -59,6 +82,16 @@ export const useWebSocket = (url: string): WebSocketHook => {
         try {
           const message: WebSocketMessage = JSON.parse(event.data);
           setLastMessage(message);
+
+          // Remember the server's reconnect guidance for when the connection closes
+          if (message.type === 'connection_status' && message.data) {
+            if (message.data.backoff) {
+              backoffRef.current = message.data.backoff;
+            }
+            if (message.data.status === 'disconnecting' && message.data.reconnectAfterMs) {
+              reconnectAfterRef.current = message.data.reconnectAfterMs;
+            }
+          }
           
           // Dispatch the message to the dispatcher
           websocketDispatcher.dispatch(message.type, message.data);
@@ -75,11 +108,14 @@ export const useWebSocket = (url: string): WebSocketHook => {
         // Attempt to reconnect if not a normal closure
         if (event.code !== 1000 && reconnectAttempts.current < maxReconnectAttempts) {
           reconnectAttempts.current++;
-          console.log(`Attempting to reconnect (${reconnectAttempts.current}/${maxReconnectAttempts})...`);
-          
+          // A server restart says when to come back; otherwise back off exponentially
+          const delay = reconnectAfterRef.current ?? backoffDelay(backoffRef.current, reconnectAttempts.current);
+          reconnectAfterRef.current = null;
+          console.log(`Attempting to reconnect in ${delay}ms (${reconnectAttempts.current}/${maxReconnectAttempts})...`);
+
           reconnectTimeoutRef.current = setTimeout(() => {
             connect();
-          }, reconnectDelay);
+          }, delay);
         } else if (reconnectAttempts.current >= maxReconnectAttempts) {
           setError('Failed to reconnect after multiple attempts');
           setConnectionStatus('error');
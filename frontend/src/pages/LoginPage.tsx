@@ -72,16 +72,16 @@ const LoginPage: React.FC = () => {
           <div className="space-y-3">
             <div>
               <label htmlFor="email" className="sr-only">
-                Email address
+                Email or username
               </label>
               <input
                 id="email"
                 name="email"
-                type="email"
-                autoComplete="email"
+                type="text"
+                autoComplete="username"
                 required
                 className="theme-input w-full"
-                placeholder="Email address"
+                placeholder="Email or username"
                 value={email}
                 onChange={(e) => setEmail(e.target.value)}
               />